@@ -0,0 +1,1896 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/cmd"
+	"github.com/adamdecaf/cert-manage/pkg/crtsh"
+	"github.com/adamdecaf/cert-manage/pkg/fetch"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/ui"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+// Sub-command flags, these are only registered on the sub-commands using them
+var (
+	// -file is used to specify an input file path
+	flagFile string
+
+	// -url is used to specify an input URL
+	flagURL string
+
+	// -out is used to specify output file location
+	flagOutFile string
+
+	// -from is used by 'gen-whitelist' to specify url sources and by 'restore' to read an archive
+	flagFrom string
+
+	// -from-backup is used by 'gen-whitelist' to snapshot a backup
+	flagFromBackup string
+
+	// -all is used by 'backup' to archive every detected store
+	flagAll bool
+
+	// -profile is used by 'whitelist' and 'blacklist' to apply a built-in whitelist
+	flagProfile string
+
+	// -policy is used by 'whitelist' to apply some of a whitelist's policies
+	flagPolicy string
+
+	// -blacklist is used by 'export' to only write certificates matching a blacklist
+	flagBlacklist string
+
+	// -weak is used by 'audit' to report small keys and weak signatures
+	flagWeak bool
+
+	// -crlset is used by 'audit' to check certificates against a Chrome CRLSet
+	flagCRLSet string
+
+	// -certdata is used by 'audit' and 'list' to read Mozilla's distrust-after dates
+	flagCertdata string
+
+	// -issuance and -ct-* are used by 'list' and 'audit' to count what each root has issued
+	flagIssuance     bool
+	flagCTURL        string
+	flagCTInterval   time.Duration
+	flagCTCheckpoint string
+
+	// -hosts is used by 'pins' to read which hosts to pin and by 'fleet' as its inventory
+	flagHosts string
+
+	// -binary is used by 'fleet' to copy a binary built for the hosts
+	flagBinary string
+
+	// -added-only is used by 'list' to hide roots from the platform's root program
+	flagAddedOnly bool
+
+	// -host is used by 'detect-mitm' for the hosts to check
+	flagHost string
+
+	// -name, -schedule, -log and -remove are used by 'install-service'
+	flagServiceName string
+	flagSchedule    string
+	flagLog         string
+	flagRemove      bool
+
+	// -listen and -duration are used by 'observe'
+	flagListen   string
+	flagDuration time.Duration
+
+	// -force is used by 'whitelist' to apply a whitelist which was already applied
+	flagForce bool
+
+	// -verify-hosts is used by 'whitelist' to check hosts still verify afterwards
+	flagVerifyHosts string
+
+	// -cascade is used by 'whitelist' to remove intermediates of removed roots
+	flagCascade bool
+
+	// -diff is used by 'restore' to show what restoring changes, -y skips
+	// confirming the restore, -keychain restores one keychain (darwin) and
+	// -adapt restores an archive from another user or machine
+	flagDiff     bool
+	flagYes      bool
+	flagKeychain string
+	flagAdapt    bool
+
+	// -directory, -step-ca, -fingerprint and -stores are used by 'trust-acme'
+	flagDirectory   string
+	flagStepCA      string
+	flagFingerprint string
+	flagStores      string
+
+	// -mount is used by 'trust-vault' to read Vault PKI mounts, with -stores
+	flagMount string
+
+	// -scep and -bootstrap are used by 'fetch-est', with -fingerprint and -stores
+	flagSCEP      bool
+	flagBootstrap bool
+
+	// -all-keystores, -keystore-roots and -parallel are used by 'whitelist -app java'
+	// to find and whitelist every java keystore
+	flagAllKeystores  bool
+	flagKeystoreRoots string
+	flagParallel      int
+
+	// -all-jvms is used by 'list -app java' to show every java install, also
+	// searching -keystore-roots
+	flagAllJVMs bool
+
+	// -whitelist is used by 'list' to highlight certificates it doesn't match
+	// by 'simulate' for the whitelist to simulate, by 'audit' to check for expired
+	// entries and by 'show' to explain why a certificate is kept
+	flagWhitelist string
+
+	// -top-sites, -sites and -refresh are used by 'simulate'
+	flagTopSites int
+	flagSites    string
+	flagRefresh  bool
+
+	// -skip-verify is used by 'fetch'
+	flagSkipVerify bool
+
+	// -refresh-snapshot and -reset are used by 'embedded', along with -from
+	flagRefreshSnapshot bool
+	flagReset           bool
+
+	// -expired and -before are used by 'prune'
+	flagExpired bool
+	flagBefore  string
+
+	// -servername and -starttls are used by 'grab'
+	flagServerName string
+	flagStartTLS   string
+
+	// -server, -server-ca, -token-file and -group are used by 'agent enroll',
+	// -interval and -once by 'agent run' and -dir by both
+	flagServer    string
+	flagServerCA  string
+	flagTokenFile string
+	flagGroup     string
+	flagInterval  time.Duration
+	flagOnce      bool
+	flagDir       string
+
+	// -dashboard, -hostname, -cert and -key are used by 'server', along
+	// with -listen, -token-file, -interval and -dir
+	flagDashboard string
+	flagHostname  string
+	flagCert      string
+	flagKey       string
+
+	// Output
+	flagCount           bool
+	flagUI              string
+	flagColumns         string
+	flagSort            string
+	flagWide            bool
+	flagFingerprintAlgo string
+	flagNoColor         bool
+)
+
+var (
+	// errShowHelp is returned by a sub-command to print its help text
+	errShowHelp = errors.New("show help")
+
+	// commands holds every sub-command, sorted by name
+	commands []*command
+)
+
+// command is a sub-command of cert-manage, e.g. `cert-manage list`
+type command struct {
+	name    string
+	summary string // one line description, shown in Usage()
+	args    string // arguments shown after the command name in help
+	help    string // examples and further details
+
+	// flags registers sub-command specific flags
+	flags func(fs *flag.FlagSet)
+
+	// fn is called against the platform store and appfn against -app
+	// If appfn is nil then -app isn't supported
+	fn    func(fs *flag.FlagSet) error
+	appfn func(app string, fs *flag.FlagSet) error
+
+	// hidden commands aren't shown in Usage() or completion scripts
+	hidden bool
+}
+
+// flagSet returns a FlagSet with the global and sub-command flags registered
+func (c *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ExitOnError)
+	fs.SetOutput(os.Stdout)
+	globalFlags(fs)
+	if c.flags != nil {
+		c.flags(fs)
+	}
+	if fs.Lookup("out") == nil {
+		fs.StringVar(&flagOutput, "out", flagOutput, "Where to write output and errors: a file (appended to), syslog or - for stdout")
+	}
+	fs.Usage = func() { c.printHelp(fs) }
+	return fs
+}
+
+func (c *command) printHelp(fs *flag.FlagSet) {
+	fmt.Printf("Usage: cert-manage %s %s\n\n  %s\n", c.name, c.args, c.summary)
+	if c.help != "" {
+		fmt.Printf("\n%s\n", strings.TrimRight(c.help, "\n"))
+	}
+	if c.appfn != nil {
+		fmt.Printf("\nAPPS\n  Supported apps: %s, gpg, ssh, snap:<name>, flatpak:<id>, file:<path>\n", strings.Join(store.GetApps(), ", "))
+	}
+	fmt.Println("\nFLAGS")
+	fs.PrintDefaults()
+}
+
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == strings.ToLower(name) {
+			return c
+		}
+	}
+	return nil
+}
+
+// allFlags returns the names of every flag across all sub-commands
+func allFlags() []string {
+	seen := make(map[string]bool)
+	for _, c := range commands {
+		c.flagSet().VisitAll(func(f *flag.Flag) {
+			seen[f.Name] = true
+		})
+	}
+	var out []string
+	for k := range seen {
+		out = append(out, k)
+	}
+	file.SortNames(out)
+	return out
+}
+
+func fileFlag(fs *flag.FlagSet, usage string) {
+	fs.StringVar(&flagFile, "file", "", usage)
+}
+
+func outFlag(fs *flag.FlagSet, usage string) {
+	fs.StringVar(&flagOutFile, "out", "", usage)
+}
+
+func profileFlag(fs *flag.FlagSet) {
+	fs.StringVar(&flagProfile, "profile", "", fmt.Sprintf("Built-in whitelist to use instead of -file (options: %s)", strings.Join(whitelist.GetProfiles(), ", ")))
+}
+
+func issuanceFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&flagIssuance, "issuance", false, "Look up how many certificates each root issued in the last 12 months (queries crt.sh)")
+	fs.StringVar(&flagCTURL, "ct-url", crtsh.URL, "crt.sh compatible Certificate Transparency search used by -issuance, e.g. a local mirror")
+	fs.DurationVar(&flagCTInterval, "ct-interval", crtsh.Interval, "Least time between requests to the -ct-url server")
+	fs.StringVar(&flagCTCheckpoint, "ct-checkpoint", "", "File saving -issuance lookups so an interrupted run resumes where it stopped (default: in the cert-manage directory, 'none' disables it)")
+}
+
+func certdataFlag(fs *flag.FlagSet) {
+	fs.StringVar(&flagCertdata, "certdata", "", "Mozilla certdata.txt to read distrust-after dates from, 'download' fetches the current one and 'embedded' uses the built-in snapshot")
+}
+
+// setSnapshotDir keeps snapshots of Mozilla's roots saved by 'embedded -refresh'
+// in the state dir, where they're used over the built-in snapshot
+func setSnapshotDir() {
+	if dir, err := store.StateDir(); err == nil {
+		fetch.SnapshotDir = filepath.Join(dir, "embedded")
+	}
+}
+
+// setCTOptions applies -ct-url, -ct-interval and -ct-checkpoint to -issuance lookups
+func setCTOptions() {
+	if flagCTURL != "" {
+		crtsh.URL = flagCTURL
+	}
+	crtsh.Interval = flagCTInterval
+	switch flagCTCheckpoint {
+	case "none":
+		crtsh.Checkpoint = ""
+	case "":
+		if dir, err := store.StateDir(); err == nil {
+			crtsh.Checkpoint = filepath.Join(dir, "crtsh-checkpoint.json")
+		}
+	default:
+		crtsh.Checkpoint = flagCTCheckpoint
+	}
+}
+
+func outputFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&flagCount, "count", false, "Output the count of certificates instead of each certificate")
+	fs.StringVar(&flagUI, "ui", ui.DefaultUI(), fmt.Sprintf("Method of showing certificates (options: %s)", strings.Join(ui.GetUIs(), ", ")))
+	fs.StringVar(&flagColumns, "columns", "", fmt.Sprintf("Comma separated columns to show with '-format table' (options: %s)", strings.Join(ui.GetTableColumns(), ", ")))
+	fs.StringVar(&flagSort, "sort", "", "Column to sort '-format table' output by")
+	fs.BoolVar(&flagWide, "wide", false, "Show full fingerprints with '-format table'")
+	fs.StringVar(&flagFingerprintAlgo, "fingerprint-algo", "", fmt.Sprintf("Fingerprint shown for certificates (default: sha256, options: %s)", strings.Join(ui.GetFingerprintAlgos(), ", ")))
+	fs.BoolVar(&flagNoColor, "no-color", false, "Don't highlight expired, expiring or non-whitelisted certificates in '-format table' output")
+}
+
+// outputConfig lifts the output flags into a ui.Config
+func outputConfig() *ui.Config {
+	cfg := &ui.Config{
+		Count:   flagCount,
+		Format:  flagFormat,
+		Outfile: flagOutFile,
+		UI:      flagUI,
+		Sort:    flagSort,
+		Wide:    flagWide,
+
+		FingerprintAlgo: flagFingerprintAlgo,
+		NoColor:         flagNoColor,
+	}
+	if flagIssuance {
+		setCTOptions()
+		cfg.Issuance = make(map[string]int)
+	}
+	if flagColumns != "" {
+		cfg.Columns = strings.Split(flagColumns, ",")
+	}
+	return cfg
+}
+
+// listConfig is outputConfig with the whitelist given to 'list -whitelist'
+func listConfig() (*ui.Config, error) {
+	cfg := outputConfig()
+	if flagWhitelist != "" {
+		wh, err := cmd.LoadWhitelist(flagWhitelist)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Whitelist = &wh
+	}
+	if flagCertdata == "embedded" {
+		setSnapshotDir()
+	}
+	distrustAfter, err := cmd.LoadDistrustAfter(flagCertdata)
+	if err != nil {
+		return nil, err
+	}
+	cfg.DistrustAfter = distrustAfter
+	return cfg, nil
+}
+
+func init() {
+	commands = []*command{
+		{
+			name:    "add",
+			summary: "Add certificate(s) to a store",
+			args:    "[-app <name>] -file <path> | -",
+			help: `  Add a certificate to the platform store
+    cert-manage add -file <path>
+
+  Add PEM or DER certificates read from stdin
+    openssl s_client -connect example.com:443 -showcerts </dev/null | cert-manage add -
+
+  Add a certificate to an application's store
+    cert-manage add -file <path> -app <name>
+
+  .p12 and .pfx files are read as PKCS#12, the password is prompted for (or read from stdin)
+    cert-manage add -file corporate-roots.pfx`,
+			flags: func(fs *flag.FlagSet) {
+				fileFlag(fs, "Certificate(s) to add")
+			},
+			fn: func(fs *flag.FlagSet) error {
+				where, ok := fileOrStdin(fs)
+				if !ok {
+					return errShowHelp
+				}
+				return cmd.AddCertsFromFile(where)
+			},
+			appfn: func(a string, fs *flag.FlagSet) error {
+				where, ok := fileOrStdin(fs)
+				if !ok {
+					return errShowHelp
+				}
+				return cmd.AddCertsToAppFromFile(a, where)
+			},
+		},
+		{
+			name:    "agent",
+			summary: "Enroll with a policy server and apply the whitelist it gives this host",
+			args:    "enroll -server <url> [-token-file <path> | -] [-group <name>] [-server-ca <path>] | run [-app <name>] [-interval <d>] [-once]",
+			help: `  Enroll this host with a policy server using a token from its operators, read from
+  -token-file (- for stdin) or $CERT_MANAGE_TOKEN. A key is created and exchanged for a
+  client certificate which authenticates the agent afterwards
+    cert-manage agent enroll -server https://certs.internal:8443 -token-file token.txt -group servers
+
+  Trust -server-ca for the policy server rather than the system's roots
+    echo $TOKEN | cert-manage agent enroll -server https://certs.internal:8443 -token-file - -server-ca ca.pem
+
+  Check in with the policy server: fetch the group's whitelist, apply it if it isn't already
+  and report what the store trusts. The last policy is cached and applied while the server
+  can't be reached, results are sent once it's back
+    cert-manage agent run
+    cert-manage agent run -once
+    cert-manage agent run -app java -interval 1h
+
+  Labels select the variants of the group's whitelist this host gets
+    cert-manage agent run -labels role=ci,env=prod
+
+  The agent's key, certificate and cached policy are kept in agent/ of cert-manage's
+  state directory, -dir changes where`,
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&flagServer, "server", "", "URL of the policy server to enroll with")
+				fs.StringVar(&flagServerCA, "server-ca", "", "PEM file of roots to trust for the policy server instead of the system's")
+				fs.StringVar(&flagTokenFile, "token-file", "", "File holding the enrollment token given by the policy server's operators, - reads stdin (default $CERT_MANAGE_TOKEN)")
+				fs.StringVar(&flagGroup, "group", "", "Group to enroll in, the server can choose one instead")
+				fs.DurationVar(&flagInterval, "interval", 0, "How often to check in, defaults to what the policy server asks for (or 15m)")
+				fs.BoolVar(&flagOnce, "once", false, "Check in once and exit")
+				fs.StringVar(&flagDir, "dir", "", "Directory the agent's key, certificate and cached policy are kept in")
+			},
+			fn: func(fs *flag.FlagSet) error {
+				return agentCommand(fs)
+			},
+			appfn: func(_ string, fs *flag.FlagSet) error {
+				return agentCommand(fs)
+			},
+		},
+		{
+			name:    "audit",
+			summary: "Report certificates which are expired, not yet valid or expiring soon",
+			args:    "[-app <name>] [-weak [-out <path>]] [-issuance] [-crlset <path>|download|none] [-certdata <path>|download] [-whitelist <path>]",
+			help: `  Report problems with the platform's certificates
+    cert-manage audit
+
+  Also report roots with small keys or which issued SHA-1 signed certificates,
+  writing them to a blacklist which can be applied later
+    cert-manage audit -weak -out weak.yaml
+    cert-manage blacklist -file weak.yaml
+
+  Certificates Chrome has blocked through its CRLSet are reported, using the
+  CRLSet Chrome last downloaded. The current CRLSet can be downloaded instead
+    cert-manage audit -crlset download
+
+  Report roots which are past the distrust-after date Mozilla set for them, after which
+  Firefox stops trusting TLS certificates they issue
+    cert-manage audit -certdata download
+
+  Warn about whitelist entries which have expired (or expire within 90 days), reporting
+  certificates only an expired entry kept
+    cert-manage audit -whitelist whitelist.yaml`,
+			flags: func(fs *flag.FlagSet) {
+				fs.BoolVar(&flagWeak, "weak", false, "Report RSA keys under 2048 bits, DSA keys, small curves and SHA-1/MD5 signatures")
+				fs.StringVar(&flagCRLSet, "crlset", "", "Chrome CRLSet to check against, 'download' fetches the current one and 'none' skips it")
+				certdataFlag(fs)
+				fs.StringVar(&flagWhitelist, "whitelist", "", "Whitelist to check for expired entries")
+				outFlag(fs, "Write the weak certificates found by -weak as a blacklist")
+				issuanceFlags(fs)
+			},
+			fn: func(_ *flag.FlagSet) error {
+				opts, err := auditOptions()
+				if err != nil {
+					return err
+				}
+				return cmd.AuditForPlatform(opts)
+			},
+			appfn: func(a string, _ *flag.FlagSet) error {
+				opts, err := auditOptions()
+				if err != nil {
+					return err
+				}
+				return cmd.AuditForApp(a, opts)
+			},
+		},
+		{
+			name:    "backup",
+			summary: "Take a backup of the specified certificate store",
+			args:    "[-app <name>] | -all -out <path>",
+			help: `  Backup a certificate store. This can be done for the platform or a given app.
+
+  Backup every detected store (platform, java, firefox, ...) into one archive,
+  which can be restored on this or another machine with 'restore -from'
+    cert-manage backup -all -out backup.tar.gz`,
+			flags: func(fs *flag.FlagSet) {
+				fs.BoolVar(&flagAll, "all", false, "Backup every detected store into the archive given with -out")
+				outFlag(fs, "Where to write the archive of -all (.tar.gz)")
+			},
+			fn: func(_ *flag.FlagSet) error {
+				if flagAll != (flagOutFile != "") {
+					return errShowHelp
+				}
+				if flagAll {
+					return cmd.BackupAll(flagOutFile)
+				}
+				return cmd.BackupForPlatform()
+			},
+			appfn: func(a string, _ *flag.FlagSet) error {
+				if flagAll || flagOutFile != "" {
+					return errShowHelp
+				}
+				return cmd.BackupForApp(a)
+			},
+		},
+		{
+			name:    "blacklist",
+			summary: "Remove trust from certificates which match the blacklist in <path>",
+			args:    "[-app <name>] -file <path> | -profile <name>",
+			help: `  Blacklists use the same format as whitelists, but matching certificates are removed.
+
+  Remove certificates from a store for the platform
+    cert-manage blacklist -file blacklist.json
+
+  Remove certificates in an app
+    cert-manage blacklist -file blacklist.json -app java`,
+			flags: func(fs *flag.FlagSet) {
+				fileFlag(fs, "Blacklist to apply")
+				profileFlag(fs)
+			},
+			fn: func(_ *flag.FlagSet) error {
+				if flagFile == "" && flagProfile == "" {
+					return errShowHelp
+				}
+				return cmd.BlacklistForPlatform(flagFile, flagProfile)
+			},
+			appfn: func(a string, _ *flag.FlagSet) error {
+				if flagFile == "" && flagProfile == "" {
+					return errShowHelp
+				}
+				return cmd.BlacklistForApp(a, flagFile, flagProfile)
+			},
+		},
+		{
+			name:    "completion",
+			summary: "Output a shell completion script for bash, zsh or fish",
+			args:    "<shell>",
+			help: `  Install completion for your shell
+    source <(cert-manage completion bash)
+    cert-manage completion zsh > "${fpath[1]}/_cert-manage"
+    cert-manage completion fish > ~/.config/fish/completions/cert-manage.fish`,
+			fn: func(fs *flag.FlagSet) error {
+				if fs.NArg() != 1 {
+					return errShowHelp
+				}
+				var names []string
+				for _, c := range commands {
+					if !c.hidden {
+						names = append(names, c.name)
+					}
+				}
+				return writeCompletion(os.Stdout, fs.Arg(0), names, allFlags())
+			},
+		},
+		{
+			// __complete is called by completion scripts for values which change at runtime
+			name:    "__complete",
+			summary: "Print values for shell completion",
+			args:    "apps | backups",
+			hidden:  true,
+			fn: func(fs *flag.FlagSet) error {
+				switch fs.Arg(0) {
+				case "apps":
+					fmt.Println(strings.Join(append(store.GetApps(), store.GetSandboxedApps()...), "\n"))
+				case "backups":
+					return completeBackups(os.Stdout, store.Platform())
+				}
+				return nil
+			},
+			appfn: func(a string, fs *flag.FlagSet) error {
+				if fs.Arg(0) != "backups" {
+					return nil
+				}
+				s, err := store.ForApp(a)
+				if err != nil {
+					return err
+				}
+				return completeBackups(os.Stdout, s)
+			},
+		},
+		{
+			name:    "connect",
+			summary: "Attempt to load a remote URL with the platform (or app) store",
+			args:    "[-app <name>] <url>",
+			help: `  Attempt an HTTP connect to <url> with the given certificate store. If -app is provided then
+  the certificates for that application are loaded and used for the connection.`,
+			fn: func(fs *flag.FlagSet) error {
+				u, err := parseConnectUrl(fs)
+				if err != nil {
+					return err
+				}
+				return cmd.ConnectWithPlatformStore(u)
+			},
+			appfn: func(a string, fs *flag.FlagSet) error {
+				u, err := parseConnectUrl(fs)
+				if err != nil {
+					return err
+				}
+				return cmd.ConnectWithAppStore(u, a)
+			},
+		},
+		{
+			name:    "detect-mitm",
+			summary: "Detect TLS interception by connecting to well-known sites",
+			args:    "[-app <name>] [-host <host>,...]",
+			help: `  Connect to well-known sites, or each -host, and report those whose chain ends at a root
+  which isn't in a public root program (Mozilla's, plus Apple's or Microsoft's on darwin and
+  windows). This identifies TLS interception appliances and antivirus, and names their root.
+    cert-manage detect-mitm
+    cert-manage detect-mitm -host example.com,intranet.example.com:8443
+
+  The exit code is non-zero when interception is found.`,
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&flagHost, "host", "", "Comma separated hosts to check, defaults to well-known sites")
+			},
+			fn: func(_ *flag.FlagSet) error {
+				setSnapshotDir()
+				return cmd.DetectMITMForPlatform(splitList(flagHost))
+			},
+			appfn: func(a string, _ *flag.FlagSet) error {
+				setSnapshotDir()
+				return cmd.DetectMITMForApp(a, splitList(flagHost))
+			},
+		},
+		{
+			name:    "embedded",
+			summary: "List or refresh the snapshot of Mozilla's roots built into cert-manage",
+			args:    "[-refresh [-from <certdata.txt>] | -reset] [-out <path>]",
+			help: `  List the roots in the snapshot of Mozilla's root program (certdata.txt) built into cert-manage,
+  which gen-whitelist, simulate and detect-mitm (with -offline) verify against, so they work
+  offline right after install
+    cert-manage embedded
+
+  Write a whitelist of the snapshot's roots, or read them as a fetch source
+    cert-manage embedded -out whitelist.yaml
+    cert-manage fetch embedded -format json
+
+  Replace the snapshot with Mozilla's current certdata.txt, or one copied onto an air-gapped
+  machine. The refreshed snapshot is kept in cert-manage's state directory
+    cert-manage embedded -refresh
+    cert-manage embedded -refresh -from certdata.txt
+
+  Go back to the built-in snapshot
+    cert-manage embedded -reset`,
+			flags: func(fs *flag.FlagSet) {
+				fs.BoolVar(&flagRefreshSnapshot, "refresh", false, "Replace the snapshot with Mozilla's current certdata.txt (or -from)")
+				fs.StringVar(&flagFrom, "from", "", "certdata.txt (or certdata.txt.gz) to refresh the snapshot from")
+				fs.BoolVar(&flagReset, "reset", false, "Remove a refreshed snapshot and use the built-in one")
+				outFlag(fs, "Where to write a whitelist of the snapshot's roots")
+				outputFlags(fs)
+			},
+			fn: func(_ *flag.FlagSet) error {
+				if (flagRefreshSnapshot && flagReset) || (flagFrom != "" && !flagRefreshSnapshot) {
+					return errShowHelp
+				}
+				setSnapshotDir()
+				cfg := outputConfig()
+				cfg.Outfile = ""
+				return cmd.Embedded(cmd.EmbeddedOptions{
+					Refresh: flagRefreshSnapshot,
+					From:    flagFrom,
+					Reset:   flagReset,
+					Out:     flagOutFile,
+				}, cfg)
+			},
+		},
+		{
+			name:    "export",
+			summary: "Write the trusted certificates of a store to a PEM file",
+			args:    "[-app <name>] [-whitelist <path>] [-format ics|capath|ddm [-url <url>]] -out <path>",
+			help: `  Export the platform's trusted certificates
+    cert-manage export -out certs.pem
+
+  Export an application's trusted certificates
+    cert-manage export -app java -out certs.pem
+
+  Export the certificates matching a blacklist for the Group Policy Disallowed store
+    cert-manage export -blacklist blacklist.yaml -out disallowed.sst
+    cert-manage export -blacklist blacklist.yaml -out Registry.pol
+
+  .sst files can be imported under "Untrusted Certificates" in a Group Policy Object
+  (or with 'certutil -addstore Disallowed'), .pol files are a GPO's Machine\Registry.pol
+
+  Export as PKCS#12, prompting for a password (which can be empty)
+    cert-manage export -out roots.p12
+
+  Write a calendar with a reminder before each certificate trusted by the platform, or any
+  installed app, expires
+    cert-manage export -format ics -out expirations.ics
+
+  Write the trusted certificates matching a whitelist as an OpenSSL -CApath directory (with
+  hash symlinks) and an openssl.cnf pointing at it, for applications cert-manage doesn't manage
+    cert-manage export -whitelist whitelist.yaml -format capath -out /opt/trusted-certs
+    SSL_CERT_DIR=/opt/trusted-certs curl https://example.com
+
+  Write Apple declarative device management (DDM) declarations installing the certificates a
+  whitelist keeps, -url is where the certificates/ directory will be served from
+    cert-manage export -whitelist whitelist.yaml -format ddm -url https://mdm.example.com/certs/ -out ddm
+
+  Declarations can add trust but not remove it from Apple's built-in roots, apply the whitelist
+  with 'cert-manage whitelist' for that.`,
+			flags: func(fs *flag.FlagSet) {
+				outFlag(fs, "Where to write certificates, .sst and .pol files are written for Group Policy and .p12/.pfx as PKCS#12")
+				fs.StringVar(&flagBlacklist, "blacklist", "", "Only export certificates matching this blacklist")
+				fs.StringVar(&flagWhitelist, "whitelist", "", "Only export certificates matching this whitelist")
+				fs.StringVar(&flagURL, "url", "", "Where the certificates of '-format ddm' are served from")
+			},
+			fn: func(_ *flag.FlagSet) error {
+				opts, calendar, err := exportOptions()
+				if err != nil {
+					return err
+				}
+				if calendar {
+					return cmd.ExportCalendarForPlatform(flagOutFile)
+				}
+				return cmd.ExportForPlatform(flagOutFile, opts)
+			},
+			appfn: func(a string, _ *flag.FlagSet) error {
+				opts, calendar, err := exportOptions()
+				if err != nil {
+					return err
+				}
+				if calendar {
+					return cmd.ExportCalendarForApp(a, flagOutFile)
+				}
+				return cmd.ExportForApp(a, flagOutFile, opts)
+			},
+		},
+		{
+			name:    "facts",
+			summary: "Print facts about each store for Puppet (facter) or Chef (ohai)",
+			args:    "[-format keyvalue|json]",
+			help: `  Print the certificate count, last applied whitelist and last backup of the
+  platform and each installed app as key=value lines
+    cert-manage facts
+
+  Puppet reads these as external facts from an executable in facts.d, e.g.
+    #!/bin/sh
+    exec cert-manage facts
+
+  Print the same facts as JSON, e.g. for a Chef ohai plugin or structured facts
+    cert-manage facts -format json`,
+			fn: func(_ *flag.FlagSet) error {
+				return cmd.WriteFacts(Version, factsFormat())
+			},
+		},
+		{
+			name:    "fetch",
+			summary: "Download the roots included in public root programs",
+			args:    "<source>... [-out <path>]",
+			help: `  Write a whitelist of the roots in Mozilla's and Microsoft's root programs
+    cert-manage fetch nss microsoft -out whitelist.json
+
+  List the roots included in NSS
+    cert-manage fetch nss -format table
+
+  Show where each fingerprint was downloaded from, when, and the SHA256 of the download
+    cert-manage fetch nss apple -format json
+
+  Write a whitelist of the roots OpenJDK 11 ships, rather than those of the local java install
+    cert-manage fetch java:11 -out java11.yaml
+
+  Bundles which are signed upstream (authroot) are refused if their signature can't
+  be verified, other sources are only protected by TLS.
+
+SOURCES
+  apple      Roots trusted by Apple's operating systems
+  authroot   Roots Windows trusts, from Microsoft's signed trust list (authroot.stl)
+  est:<url>  CA certificates of an enterprise EST server, see fetch-est
+  java       Roots in the keystore of the local java install
+  java:<v>   Roots OpenJDK <v> ships in its cacerts (8, 11, 17 or 21)
+  embedded   Roots in the snapshot of Mozilla's NSS built into cert-manage, see embedded
+  microsoft  Roots included in Microsoft's root program (via CCADB)
+  nss        Roots included in Mozilla's NSS (certdata.txt)
+  scep:<url> CA certificates of an enterprise SCEP server, see fetch-est`,
+			flags: func(fs *flag.FlagSet) {
+				outFlag(fs, "Where to write a whitelist of the fetched roots")
+				fs.BoolVar(&flagSkipVerify, "skip-verify", false, "Accept signed bundles whose signature can't be verified")
+				outputFlags(fs)
+			},
+			fn: func(fs *flag.FlagSet) error {
+				if fs.NArg() == 0 {
+					return errShowHelp
+				}
+				fetch.SkipVerify = flagSkipVerify
+				setSnapshotDir()
+				cfg := outputConfig()
+				cfg.Outfile = ""
+				return cmd.Fetch(fs.Args(), flagOutFile, cfg)
+			},
+		},
+		{
+			name:    "fetch-est",
+			summary: "Read the CA certificates of an enterprise CA over EST or SCEP",
+			args:    "<url> [-scep] [-bootstrap] [-out <path>] [-stores platform,<app>,...] [-fingerprint <sha256>] [-y]",
+			help: `  List the CA certificates an EST server (RFC 7030) serves on /.well-known/est/cacerts
+    cert-manage fetch-est https://est.corp
+
+  Read them from a SCEP server's GetCACert instead and write a whitelist of them
+    cert-manage fetch-est https://scep.corp/scep -scep -out corp.yaml
+
+  Bootstrap a managed endpoint: the server's TLS certificate isn't verified (the CA likely isn't
+  trusted yet) so the root is checked against its fingerprint, then added to the platform and java stores
+    cert-manage fetch-est https://est.corp/.well-known/est/corp -bootstrap -fingerprint 3b4c... -stores platform,java
+
+  Only roots are added to stores, without -fingerprint they're shown for confirmation.`,
+			flags: func(fs *flag.FlagSet) {
+				fs.BoolVar(&flagSCEP, "scep", false, "Send a SCEP GetCACert request rather than reading EST /cacerts")
+				fs.BoolVar(&flagBootstrap, "bootstrap", false, "Don't verify the server's TLS certificate, check roots with -fingerprint instead")
+				outFlag(fs, "Where to write a whitelist of the CA certificates")
+				fs.StringVar(&flagStores, "stores", "", "Comma separated stores to add the roots to, 'platform' or app names")
+				fs.StringVar(&flagFingerprint, "fingerprint", "", "SHA256 fingerprint the CA's root must have")
+				fs.BoolVar(&flagYes, "y", false, "Add the roots without confirming their fingerprints")
+				outputFlags(fs)
+			},
+			fn: func(fs *flag.FlagSet) error {
+				if fs.NArg() != 1 {
+					return errShowHelp
+				}
+				fetch.Bootstrap = flagBootstrap
+				opts := cmd.FetchESTOptions{
+					URL:         fs.Arg(0),
+					SCEP:        flagSCEP,
+					Out:         flagOutFile,
+					Fingerprint: flagFingerprint,
+					Yes:         flagYes,
+				}
+				if flagStores != "" {
+					opts.Stores = strings.Split(flagStores, ",")
+				}
+				cfg := outputConfig()
+				cfg.Outfile = ""
+				return cmd.FetchEST(opts, cfg)
+			},
+		},
+		{
+			name:    "fleet",
+			summary: "Run a cert-manage command on many hosts over ssh",
+			args:    "-hosts <inventory> [-parallel <n>] [-binary <path>] -- <sub-command> [flags]",
+			help: `  Copy cert-manage to each host in the inventory ([user@]host[:port] per line),
+  run a sub-command and print a summary of every host. Local files given to the
+  sub-command (e.g. the whitelist) are copied alongside.
+    cert-manage fleet -hosts inventory.txt -- whitelist -file wl.json
+
+  ssh is ran without prompting, so hosts need key based auth (an agent works).
+  Hosts with another OS or architecture need a binary built for them, e.g. from a mac
+    make linux
+    cert-manage fleet -hosts inventory.txt -binary bin/cert-manage-linux-amd64 -- list -count`,
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&flagHosts, "hosts", "", "Inventory of ssh destinations, one per line")
+				fs.StringVar(&flagBinary, "binary", "", "cert-manage binary to copy to each host (default: this executable)")
+				fs.IntVar(&flagParallel, "parallel", 4, "How many hosts to run on at once")
+			},
+			fn: func(fs *flag.FlagSet) error {
+				if flagHosts == "" || fs.NArg() == 0 {
+					return errShowHelp
+				}
+				return cmd.Fleet(flagHosts, fs.Args(), cmd.FleetOptions{
+					Binary:   flagBinary,
+					Parallel: flagParallel,
+				})
+			},
+		},
+		{
+			name:    "gen-whitelist",
+			summary: "Create a whitelist from various sources",
+			args:    "-out <where> [-file <file>] [-from <type>] | -from - | -from-backup <path>",
+			help: `  Generate a whitelist and write it to the filesystem. (At wherever -out points to.)
+
+  Also, you can pass -file to read a newline delimited file of URL's.
+    cert-manage gen-whitelist -file <path> -out whitelist.json
+
+  Generate a whitelist from browser history
+    cert-manage gen-whitelist -from firefox -out whitelist.json
+
+  Generate a whitelist from all browsers on a computer
+    cert-manage gen-whitelist -from browsers -out whitelist.json
+
+  Whitelist the PEM or DER certificates read from stdin
+    openssl s_client -connect example.com:443 -showcerts </dev/null | cert-manage gen-whitelist -from - -out whitelist.json
+
+  Snapshot what a backup trusts as a whitelist. Backups can be a directory or tar archive of
+  certificates, a java keystore or a darwin trust settings plist (only read on darwin)
+    cert-manage gen-whitelist -from-backup ~/.cert-manage/java/cacerts-1520000000 -out whitelist.json`,
+			flags: func(fs *flag.FlagSet) {
+				fileFlag(fs, "Newline delimited file of URL's")
+				outFlag(fs, "Where to write the whitelist")
+				fs.StringVar(&flagFrom, "from", "", "Which sources to capture urls from. Comma separated list, or - to whitelist certificates from stdin. (Options: browser, chrome, firefox, file)")
+				fs.StringVar(&flagFromBackup, "from-backup", "", "Whitelist every certificate trusted by this backup")
+			},
+			fn: func(_ *flag.FlagSet) error {
+				if flagFromBackup != "" {
+					if flagOutFile == "" || flagFrom != "" || flagFile != "" {
+						return errShowHelp
+					}
+					return cmd.GenerateWhitelistFromBackup(flagFromBackup, flagOutFile)
+				}
+				if flagFrom == "-" {
+					if flagOutFile == "" || flagFile != "" {
+						return errShowHelp
+					}
+					return cmd.GenerateWhitelistFromStdin(flagOutFile)
+				}
+				if flagOutFile == "" || (flagFrom == "" && flagFile == "") {
+					return errShowHelp
+				}
+				setSnapshotDir()
+				return cmd.GenerateWhitelist(flagOutFile, flagFrom, flagFile)
+			},
+		},
+		{
+			name:    "grab",
+			summary: "Fetch the certificate chain a server presents",
+			args:    "[-servername <name>] [-starttls <protocol>] [-out <path>] <host[:port]>",
+			help: `  Connect to a server and write the chain it presents, leaf first, as PEM to stdout. Whether
+  the chain verifies against the platform's roots is noted, but it's written either way.
+    cert-manage grab example.com:443
+
+  Grabbed chains can be piped into other commands
+    cert-manage grab example.com | cert-manage gen-whitelist -from - -out whitelist.json
+    cert-manage grab example.com | cert-manage show -
+
+  Negotiate TLS from a plaintext protocol with -starttls, the protocol's port is used when
+  none is given. Save the chain with -out, files ending in .p12 or .pfx are written as PKCS#12.
+    cert-manage grab -starttls smtp -out mx.pem mail.example.com:587
+
+  -servername sends a different SNI name, e.g. when connecting to an IP address.`,
+			flags: func(fs *flag.FlagSet) {
+				outFlag(fs, "Where to save the chain, defaults to stdout")
+				fs.StringVar(&flagServerName, "servername", "", "Server name to send (SNI) and verify, defaults to the host")
+				fs.StringVar(&flagStartTLS, "starttls", "", fmt.Sprintf("Upgrade to TLS from a plaintext protocol (options: %s)", strings.Join(cmd.GetStartTLSProtocols(), ", ")))
+			},
+			fn: func(fs *flag.FlagSet) error {
+				if fs.NArg() != 1 {
+					return errShowHelp
+				}
+				return cmd.Grab(fs.Arg(0), cmd.GrabOptions{
+					ServerName: flagServerName,
+					StartTLS:   flagStartTLS,
+					Out:        flagOutFile,
+				})
+			},
+		},
+		{
+			name:    "install-service",
+			summary: "Run a cert-manage command periodically as a scheduled task (windows)",
+			args:    "[-name <task>] [-schedule hourly|daily|weekly] [-log <path>] -- <sub-command> [flags] | -remove",
+			help: `  Create a scheduled task, ran as SYSTEM, which audits or enforces a whitelist
+  periodically. Local files given to the sub-command are referenced by their full path.
+    cert-manage install-service -schedule daily -- whitelist -file C:\whitelist.yaml
+
+  Output of each run is appended to %ProgramData%\cert-manage\<name>.log unless -log is given.
+
+  Remove the task
+    cert-manage install-service -remove`,
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&flagServiceName, "name", "cert-manage", "Name of the scheduled task")
+				fs.StringVar(&flagSchedule, "schedule", "daily", "How often to run: hourly, daily or weekly")
+				fs.StringVar(&flagLog, "log", "", "Where to append the output of each run")
+				fs.BoolVar(&flagRemove, "remove", false, "Remove the scheduled task")
+			},
+			fn: func(fs *flag.FlagSet) error {
+				if !flagRemove && (fs.NArg() == 0 || findCommand(fs.Arg(0)) == nil) {
+					return errShowHelp
+				}
+				return cmd.InstallService(fs.Args(), cmd.ServiceOptions{
+					Name:     flagServiceName,
+					Schedule: flagSchedule,
+					Log:      flagLog,
+					Remove:   flagRemove,
+				})
+			},
+		},
+		{
+			name:    "list",
+			summary: "List the currently installed and trusted certificates",
+			args:    "[options]",
+			help: `  List certificates from an application
+    cert-manage list -app firefox
+
+  List certificates from a file
+    cert-manage list -file <path>
+
+  List certificates from a URL
+    cert-manage list -url <endpoint>
+
+FORMATTING
+  Change the output format
+    cert-manage list -format openssl
+
+  Only show the count of certificates found
+    cert-manage list -count
+    cert-manage list -app java -count
+    cert-manage list -file <path> -count
+
+  Choose columns, sorting and full fingerprints for table output
+    cert-manage list -format table -columns subject,issuer,expiry -sort expiry
+    cert-manage list -format table -wide
+
+  Show SPKI hashes, as used in HPKP pins and Android's network_security_config
+    cert-manage list -fingerprint-algo spki-sha256
+
+  Certificates sharing a key (one CA which is cross-signed or reissued) are marked with
+  the other certificates of that key, in tables as the samekey column
+    cert-manage list -format table -columns subject,expiry,samekey
+
+  Show how many certificates each root issued in the last 12 months, from crt.sh
+    cert-manage list -format table -issuance
+
+  Show the date Mozilla distrusts TLS certificates issued by a root after, read from
+  certdata.txt, in tables as the distrustafter column
+    cert-manage list -certdata download
+
+  On a terminal table rows are colored: expired in red, expiring within 90 days in yellow and
+  (with -whitelist) certificates the whitelist doesn't match in magenta. Use -no-color (or set
+  NO_COLOR) to disable this.
+    cert-manage list -format table -whitelist whitelist.yaml
+
+  Show the certificates on a local webpage
+    cert-manage list -ui web
+
+  Only show certificates which aren't in the platform's root program (apple on darwin,
+  microsoft on windows), e.g. roots added by an admin, a corporate proxy or malware
+    cert-manage list -added-only
+
+  Show every java install (JDKs, JREs, SDKMAN candidates, jlink runtimes and the JAVA_HOMEs
+  of unpacked container images) with its keystore, vendor and version
+    cert-manage list -app java -all-jvms
+    cert-manage list -app java -all-jvms -keystore-roots /srv/apps`,
+			flags: func(fs *flag.FlagSet) {
+				fileFlag(fs, "List certificates from a local file")
+				fs.StringVar(&flagURL, "url", "", "List certificates from a remote URL")
+				fs.BoolVar(&flagAddedOnly, "added-only", false, "Only list certificates which aren't in the platform's root program")
+				fs.BoolVar(&flagAllJVMs, "all-jvms", false, "With -app java, list every java install and its keystore")
+				fs.StringVar(&flagWhitelist, "whitelist", "", "Highlight certificates which don't match this whitelist in '-format table' output")
+				fs.StringVar(&flagKeystoreRoots, "keystore-roots", "", "Comma separated directories searched by -all-jvms, defaults to where java is installed")
+				outFlag(fs, "Where to write the output, used by some formats")
+				outputFlags(fs)
+				issuanceFlags(fs)
+				certdataFlag(fs)
+			},
+			fn: func(_ *flag.FlagSet) error {
+				if flagAllJVMs {
+					return errShowHelp
+				}
+				cfg, err := listConfig()
+				if err != nil {
+					return err
+				}
+				if flagAddedOnly {
+					if flagFile != "" || flagURL != "" {
+						return errShowHelp
+					}
+					return cmd.ListAddedCertsForPlatform(cfg)
+				}
+				if flagFile != "" {
+					return cmd.ListCertsFromFile(flagFile, cfg)
+				}
+				if flagURL != "" {
+					return cmd.ListCertsFromURL(flagURL, cfg)
+				}
+				return cmd.ListCertsForPlatform(cfg)
+			},
+			appfn: func(a string, _ *flag.FlagSet) error {
+				if flagAddedOnly {
+					return errShowHelp
+				}
+				if flagAllJVMs {
+					if !strings.EqualFold(a, "java") {
+						return errShowHelp
+					}
+					return cmd.ListJavaInstalls(keystoreRoots())
+				}
+				cfg, err := listConfig()
+				if err != nil {
+					return err
+				}
+				return cmd.ListCertsForApp(a, cfg)
+			},
+		},
+		{
+			name:    "observe",
+			summary: "Record which roots terminate TLS connections made through a local proxy",
+			args:    "[-app <name>] [-listen <addr>] [-duration <d>] [-file <whitelist>] [-out <path>]",
+			help: `  Run an HTTP proxy which records the root each TLS connection through it
+  chains to. Connections aren't intercepted, certificates are read from the
+  handshake (or fetched from the server for TLS 1.3).
+    cert-manage observe -listen :8888
+    HTTPS_PROXY=http://localhost:8888 curl https://example.com
+
+  Compare the observed roots against a whitelist after a day of browsing,
+  suggesting roots to add and whitelisted roots which went unused
+    cert-manage observe -duration 24h -file whitelist.yaml -out observed.yaml`,
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&flagListen, "listen", "localhost:8888", "Address to accept proxy connections on")
+				fs.DurationVar(&flagDuration, "duration", 0, "How long to observe for, otherwise until Ctrl-C")
+				fileFlag(fs, "Whitelist to suggest additions and removals for")
+				outFlag(fs, "Where to write a whitelist of the observed roots")
+			},
+			fn: func(_ *flag.FlagSet) error {
+				return cmd.ObserveForPlatform(observeOptions())
+			},
+			appfn: func(a string, _ *flag.FlagSet) error {
+				return cmd.ObserveForApp(a, observeOptions())
+			},
+		},
+		{
+			name:    "pins",
+			summary: "Generate SPKI pin sets from the chains served by hosts",
+			args:    "[-app <name>] -hosts <path> [-format android|hpkp|go] [-out <path>]",
+			help: `  Pin the intermediate and root certificates (as backup pins) each host in
+  hosts.txt chains to. Hosts are read one per line as a hostname, host:port or URL.
+
+  Write an Android network_security_config.xml
+    cert-manage pins -hosts hosts.txt -out network_security_config.xml
+
+  Print Public-Key-Pins headers or Go code
+    cert-manage pins -hosts hosts.txt -format hpkp
+    cert-manage pins -hosts hosts.txt -format go
+
+  Chains are verified with the platform's roots, or an app's with -app.`,
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&flagHosts, "hosts", "", "File of hosts to connect to and pin, one per line")
+				outFlag(fs, "Where to write the pin sets, stdout is used otherwise")
+			},
+			fn: func(_ *flag.FlagSet) error {
+				if flagHosts == "" {
+					return errShowHelp
+				}
+				return cmd.PinsForPlatform(flagHosts, pinFormat(), flagOutFile)
+			},
+			appfn: func(a string, _ *flag.FlagSet) error {
+				if flagHosts == "" {
+					return errShowHelp
+				}
+				return cmd.PinsForApp(a, flagHosts, pinFormat(), flagOutFile)
+			},
+		},
+		{
+			name:    "plist-diff",
+			summary: "Compare two darwin trust settings exports",
+			args:    "[-format json] <a.xml> <b.xml>",
+			help: `  Show the certificates added, removed or with changed trust results between two
+  'security trust-settings-export' plists, e.g. from before and after a change
+    security trust-settings-export -d before.xml
+    security trust-settings-export -d after.xml
+    cert-manage plist-diff before.xml after.xml
+
+  Plists are read on any platform.`,
+			fn: func(fs *flag.FlagSet) error {
+				if fs.NArg() != 2 {
+					return errShowHelp
+				}
+				return cmd.PlistDiff(fs.Arg(0), fs.Arg(1), flagFormat)
+			},
+		},
+		{
+			name:    "prune",
+			summary: "Remove trust from expired certificates, a backup is taken first",
+			args:    "[-app <name>] -expired [-before <YYYY-MM-DD>]",
+			help: `  Remove expired certificates from the platform store
+    cert-manage prune -expired
+
+  Remove certificates from an app which expired before 2015
+    cert-manage prune -expired -before 2015-01-01 -app java`,
+			flags: func(fs *flag.FlagSet) {
+				fs.BoolVar(&flagExpired, "expired", false, "Remove expired certificates")
+				fs.StringVar(&flagBefore, "before", "", "Only remove certificates which expired before this date, YYYY-MM-DD (default: now)")
+			},
+			fn: func(_ *flag.FlagSet) error {
+				before, err := parseBefore()
+				if err != nil {
+					return err
+				}
+				return cmd.PruneForPlatform(before)
+			},
+			appfn: func(a string, _ *flag.FlagSet) error {
+				before, err := parseBefore()
+				if err != nil {
+					return err
+				}
+				return cmd.PruneForApp(a, before)
+			},
+		},
+		{
+			name:    "reconcile",
+			summary: "Remove certificates which came back after the last whitelist was applied",
+			help: `  OS and package updates can reinstall certificates a whitelist removed. Compare the
+  store against what was left by the last whitelist applied, report what came back
+  (and package updates since) and apply the same whitelist again
+    cert-manage reconcile
+    cert-manage reconcile -app java
+
+  Only report what came back
+    cert-manage reconcile -dry-run`,
+			fn: func(_ *flag.FlagSet) error {
+				return cmd.ReconcileForPlatform()
+			},
+			appfn: func(a string, _ *flag.FlagSet) error {
+				return cmd.ReconcileForApp(a)
+			},
+		},
+		{
+			name:    "report",
+			summary: "Write an HTML report of the trust posture of every store found",
+			args:    "-out <path> [-file <whitelist> | -profile <name>]",
+			help: `  Write a self-contained report of the platform and installed apps, including
+  certificate counts, expirations and a per-country breakdown
+    cert-manage report -out report.html
+
+  Also report which certificates don't comply with a whitelist
+    cert-manage report -out report.html -file whitelist.yaml
+    cert-manage report -out report.html -profile minimal-web`,
+			flags: func(fs *flag.FlagSet) {
+				outFlag(fs, "Where to write the HTML report")
+				fileFlag(fs, "Whitelist to check each store's compliance against")
+				profileFlag(fs)
+			},
+			fn: func(_ *flag.FlagSet) error {
+				if flagOutFile == "" {
+					return errShowHelp
+				}
+				return cmd.Report(flagOutFile, flagFile, flagProfile)
+			},
+		},
+		{
+			name:    "restore",
+			summary: "Revert the certificate trust back to, optionally takes -file <path>",
+			args:    "[-app <name>] [-file <path> | -from <archive> [-adapt]] [-keychain <name>] [-diff [-format json]] [-y]",
+			help: `  Restore certificates from the latest backup, after showing how many certificates
+  are trusted again or lose trust and asking to continue
+    cert-manage restore
+
+  Restore without asking, e.g. from scripts
+    cert-manage restore -y
+
+  Restore certificates for the platform from a file
+    cert-manage restore -file <path>
+
+  Restore certificates for an application from the latest backup
+    cert-manage restore -app java
+
+  Only restore the login keychain (or System, or another keychain) on darwin
+    cert-manage restore -keychain login
+
+  Review which certificates restoring would add and remove, without restoring
+    cert-manage restore -diff -dry-run
+    cert-manage restore -diff -dry-run -format json
+
+  Restore every store in an archive made with 'backup -all'
+    cert-manage restore -from backup.tar.gz
+
+  Restore an archive taken as another user or on another machine (e.g. an old laptop),
+  moving its keychains into the current user's home directory (darwin)
+    cert-manage restore -from backup.tar.gz -adapt`,
+			flags: func(fs *flag.FlagSet) {
+				fileFlag(fs, "Backup to restore from, the latest is used otherwise")
+				fs.StringVar(&flagFrom, "from", "", "Archive made with 'backup -all' to restore every store from")
+				fs.BoolVar(&flagDiff, "diff", false, "Show the certificates restoring adds and removes, as a table or with '-format json'")
+				fs.BoolVar(&flagYes, "y", false, "Restore without showing a summary and asking to continue")
+				fs.StringVar(&flagKeychain, "keychain", "", "Only restore this keychain from the backup, by name or path (darwin only)")
+				fs.BoolVar(&flagAdapt, "adapt", false, "Restore an archive from another user or machine into this user's keychains (darwin only)")
+			},
+			fn: func(_ *flag.FlagSet) error {
+				if flagKeychain != "" {
+					store.RestoreKeychain(flagKeychain)
+				}
+				if flagAdapt && flagFrom == "" {
+					return errShowHelp
+				}
+				if flagFrom != "" {
+					if flagFile != "" {
+						return errShowHelp
+					}
+					return cmd.RestoreFromArchive(flagFrom, restoreOptions())
+				}
+				return cmd.RestoreForPlatform(flagFile, restoreOptions())
+			},
+			appfn: func(a string, _ *flag.FlagSet) error {
+				if flagFrom != "" || flagAdapt {
+					return errShowHelp
+				}
+				return cmd.RestoreForApp(a, flagFile, restoreOptions())
+			},
+		},
+		{
+			name:    "server",
+			summary: "Run a policy server which hands each group of agents a whitelist",
+			args:    "[-token-file <path> | -] [-listen <addr>] [-dashboard <addr>] [-hostname <name>,...] [-cert <path> -key <path>] [-interval <d>]",
+			help: `  Serve whitelists to agents (see 'agent'), one per group from groups/<group>.yaml in
+  the server's directory, and record what each agent's stores trust. Variants of a
+  group's whitelist are selected with each agent's -labels. Agents enroll with a secret
+  read from -token-file (- for stdin) or $CERT_MANAGE_TOKEN
+    cert-manage server -token-file /etc/cert-manage/token
+
+  Agents verify the server with a certificate it issues from its own CA (ca.crt, give it
+  to agents as -server-ca), set the names agents connect with or serve another certificate
+    cert-manage server -token-file token.txt -hostname certs.internal,10.0.0.5
+    cert-manage server -token-file token.txt -cert server.crt -key server.key
+
+  The dashboard shows which agents comply with their group's whitelist, it's served over
+  plain HTTP on localhost unless -dashboard is changed (an empty value disables it)
+    CERT_MANAGE_TOKEN=... cert-manage server -dashboard localhost:8080
+    curl http://localhost:8080/status.json
+
+  The whitelists, agents and CA are kept in server/ of cert-manage's state directory,
+  -dir changes where. Remove an agent from agents.json to revoke it`,
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&flagTokenFile, "token-file", "", "File holding the secret agents enroll with, - reads stdin (default $CERT_MANAGE_TOKEN)")
+				fs.StringVar(&flagListen, "listen", ":8443", "Address to serve agents on")
+				fs.StringVar(&flagDashboard, "dashboard", "localhost:8080", "Address to serve the dashboard on")
+				fs.StringVar(&flagHostname, "hostname", "", "Comma separated names (or IPs) for the server's certificate, defaults to this host's")
+				fs.StringVar(&flagCert, "cert", "", "PEM certificate to serve agents with instead of one issued by the server's CA")
+				fs.StringVar(&flagKey, "key", "", "PEM private key of -cert")
+				fs.DurationVar(&flagInterval, "interval", 0, "How often agents are asked to check in (default 15m)")
+				fs.StringVar(&flagDir, "dir", "", "Directory the group whitelists, agents and CA are kept in")
+			},
+			fn: func(_ *flag.FlagSet) error {
+				token, err := readToken(os.Stdin)
+				if err != nil {
+					return err
+				}
+				opts := cmd.ServerOptions{
+					Dir:       flagDir,
+					Listen:    flagListen,
+					Dashboard: flagDashboard,
+					Token:     token,
+					Cert:      flagCert,
+					Key:       flagKey,
+					Interval:  flagInterval,
+				}
+				if flagHostname != "" {
+					opts.Hostnames = strings.Split(flagHostname, ",")
+				}
+				return cmd.Server(opts)
+			},
+		},
+		{
+			name:    "show",
+			summary: "Show the full details of a certificate, given a fingerprint or -file <path>",
+			args:    "[-app <name>] [-file <path> | -] [-whitelist <path>] <fingerprint>",
+			help: `  Show a certificate from the platform store, given a SHA256 (or SHA1) fingerprint prefix
+    cert-manage show 05a6db389391df92
+
+  Show a certificate from an application
+    cert-manage show -app firefox 05a6db389391df92
+
+  Show each certificate in a PEM file
+    cert-manage show -file <path>
+
+  Show PEM or DER certificates read from stdin
+    openssl s_client -connect example.com:443 -showcerts </dev/null | cert-manage show -
+
+  Explain whether a whitelist keeps a certificate, with the owner, ticket and reason
+  of the whitelist entries which include it
+    cert-manage show -whitelist wh.yaml 05a6db389391df92
+
+  SHA1, SHA256 and SPKI SHA256 (base64) fingerprints are shown for each certificate,
+  use -fingerprint-algo to show only one of them
+    cert-manage show -fingerprint-algo spki-sha256 05a6db389391df92`,
+			flags: func(fs *flag.FlagSet) {
+				fileFlag(fs, "Show certificates from a local file")
+				fs.StringVar(&flagWhitelist, "whitelist", "", "Explain whether this whitelist keeps the certificate")
+				fs.StringVar(&flagFingerprintAlgo, "fingerprint-algo", "", fmt.Sprintf("Only show this fingerprint (options: %s)", strings.Join(ui.GetFingerprintAlgos(), ", ")))
+			},
+			fn: func(fs *flag.FlagSet) error {
+				if flagFile != "" {
+					return cmd.ShowCertFromFile(flagFile, fs.Arg(0), showOptions())
+				}
+				if fs.Arg(0) == "-" {
+					return cmd.ShowCertFromFile("-", fs.Arg(1), showOptions())
+				}
+				if fs.NArg() != 1 {
+					return errShowHelp
+				}
+				return cmd.ShowCertForPlatform(fs.Arg(0), showOptions())
+			},
+			appfn: func(a string, fs *flag.FlagSet) error {
+				if fs.NArg() != 1 {
+					return errShowHelp
+				}
+				return cmd.ShowCertForApp(a, fs.Arg(0), showOptions())
+			},
+		},
+		{
+			name:    "simulate",
+			summary: "Report how many popular sites a whitelist would break",
+			args:    "-whitelist <path> | -profile <name> [-top-sites <n>] [-sites <path|url>] [-refresh]",
+			help: `  Check the 1000 most popular sites (from the Tranco list) and report which would stop
+  verifying if only the roots matched by a whitelist were trusted
+    cert-manage simulate -whitelist whitelist.json -top-sites 1000
+
+  Try a built-in profile before applying it
+    cert-manage simulate -profile minimal-web
+
+  Use another "rank,domain" list, such as Alexa or Cisco Umbrella's, from a file or url
+    cert-manage simulate -whitelist whitelist.json -sites top-1m.csv.gz
+
+  Each site is connected to and the roots its chain verifies to are cached for a week,
+  -refresh connects to every site again. Sites are weighted by 1/rank to estimate traffic.`,
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&flagWhitelist, "whitelist", "", "Whitelist to simulate")
+				profileFlag(fs)
+				fs.IntVar(&flagTopSites, "top-sites", 1000, "How many of the most popular sites to check")
+				fs.StringVar(&flagSites, "sites", cmd.TopSitesURL, "Ranked list of sites to check, a path or url (zip and gzip are read)")
+				fs.BoolVar(&flagRefresh, "refresh", false, "Connect to every site again rather than using cached results")
+			},
+			fn: func(_ *flag.FlagSet) error {
+				if (flagWhitelist == "") == (flagProfile == "") {
+					return errShowHelp
+				}
+				setSnapshotDir()
+				return cmd.Simulate(cmd.SimulateOptions{
+					Whitelist: flagWhitelist,
+					Profile:   flagProfile,
+					Sites:     flagSites,
+					TopSites:  flagTopSites,
+					Refresh:   flagRefresh,
+				})
+			},
+		},
+		{
+			name:    "stats",
+			summary: "Summarize the certificates in a store",
+			args:    "[-app <name>] [-file <path> | -profile <name>]",
+			help: `  Summarize the platform's certificates: how many there are, their key algorithms and sizes,
+  countries, the oldest and newest expiry and how many are SHA-1 signed
+    cert-manage stats
+
+  Summarize an application's certificates
+    cert-manage stats -app java
+
+  Include how many certificates a whitelist covers
+    cert-manage stats -file whitelist.json
+    cert-manage stats -profile minimal-web`,
+			flags: func(fs *flag.FlagSet) {
+				fileFlag(fs, "Whitelist to report coverage of")
+				profileFlag(fs)
+			},
+			fn: func(_ *flag.FlagSet) error {
+				return cmd.StatsForPlatform(flagFile, flagProfile)
+			},
+			appfn: func(a string, _ *flag.FlagSet) error {
+				return cmd.StatsForApp(a, flagFile, flagProfile)
+			},
+		},
+		{
+			name:    "trust-acme",
+			summary: "Add the root of an internal ACME CA (e.g. step-ca) to stores",
+			args:    "-directory <url> | -step-ca <url> [-fingerprint <sha256>] [-stores platform,<app>,...] [-y]",
+			help: `  Fetch the root of an internal CA from where it's published and add it to the platform store
+    cert-manage trust-acme -directory https://ca.internal/acme/acme/directory
+
+  Check the root against its fingerprint (as printed by 'step certificate fingerprint') rather
+  than confirming it, and add it to the platform, java and firefox stores
+    cert-manage trust-acme -step-ca https://ca.internal -fingerprint 3b4c... -stores platform,java,firefox
+
+  The root is pinned in the cert-manage directory, running trust-acme again only adds the same
+  root. If the CA's root is replaced give the new one's -fingerprint.`,
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&flagDirectory, "directory", "", "ACME directory URL of the CA")
+				fs.StringVar(&flagStepCA, "step-ca", "", "URL of a step-ca server, instead of -directory")
+				fs.StringVar(&flagFingerprint, "fingerprint", "", "SHA256 fingerprint the CA's root must have")
+				fs.StringVar(&flagStores, "stores", "platform", "Comma separated stores to add the root to, 'platform' or app names")
+				fs.BoolVar(&flagYes, "y", false, "Add the roots without confirming their fingerprints")
+			},
+			fn: func(_ *flag.FlagSet) error {
+				return trustACME(strings.Split(flagStores, ","))
+			},
+			appfn: func(a string, _ *flag.FlagSet) error {
+				return trustACME([]string{a})
+			},
+		},
+		{
+			name:    "trust-vault",
+			summary: "Sync the CAs of HashiCorp Vault PKI mounts to stores",
+			args:    "-mount <name>,... [-stores platform,<app>,...] [-out <path>]",
+			help: `  Add the root and intermediate CAs of Vault PKI mounts to the platform store, the server is
+  read from VAULT_ADDR (and VAULT_TOKEN, VAULT_NAMESPACE and VAULT_CACERT) as the vault CLI does
+    cert-manage trust-vault -mount pki,pki_int
+
+  Sync them to the platform and java stores and write a whitelist of them, which other
+  whitelists can extend
+    cert-manage trust-vault -mount pki -stores platform,java -out vault.yaml
+
+  CAs an earlier run added which Vault no longer serves (e.g. after rotating a root) are
+  removed, so running this on a schedule keeps stores in sync with Vault.`,
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&flagMount, "mount", "", "Comma separated Vault PKI mounts to read CAs from")
+				fs.StringVar(&flagStores, "stores", "platform", "Comma separated stores to add the CAs to, 'platform' or app names")
+				outFlag(fs, "Where to write a whitelist of the CAs")
+			},
+			fn: func(_ *flag.FlagSet) error {
+				return trustVault(strings.Split(flagStores, ","))
+			},
+			appfn: func(a string, _ *flag.FlagSet) error {
+				return trustVault([]string{a})
+			},
+		},
+		{
+			name:    "version",
+			summary: "Show the version of cert-manage",
+			fn: func(_ *flag.FlagSet) error {
+				fmt.Printf("%s\n", getVersion())
+				return nil
+			},
+		},
+		{
+			name:    "whitelist",
+			summary: "Remove trust from certificates which do not match the whitelist in <path>",
+			args:    "[-app <name>] -file <path> | -profile <name> [-policy <name>,...] [-verify-hosts <path>] [-cascade] | edit -file <path>",
+			help: `  Remove untrusted certificates from a store for the platform
+    cert-manage whitelist -file whitelist.json
+
+  Edit a whitelist (which is created if missing) against the platform's certificates: search,
+  toggle which are kept and see how many would remain, the whitelist is written on save
+    cert-manage whitelist edit -file whitelist.json
+    cert-manage whitelist edit -file whitelist.yaml -app firefox
+
+  Remove untrusted certificates in an app
+    cert-manage whitelist -file whitelist.json -app java
+
+  Apply a built-in whitelist profile
+    cert-manage whitelist -profile minimal-web
+
+  Keep the variants of a whitelist this host's labels select (see docs/whitelists.md)
+    cert-manage whitelist -file fleet.yaml -labels role=ci,env=prod
+
+  Applying the same whitelist to an unchanged store again does nothing, unless -force is given
+    cert-manage whitelist -file whitelist.json -force
+
+  Verify critical hosts (one per line, as in 'pins') still connect afterwards, restoring the
+  backup taken beforehand if any fail. This makes unattended rollouts safe
+    cert-manage whitelist -file whitelist.json -verify-hosts hosts.txt
+
+  Intermediates which only chain to removed roots are warned about, -cascade removes them too
+    cert-manage whitelist -file whitelist.json -cascade
+
+  Apply some of the policies a whitelist defines (e.g. web, email or code-signing), which
+  restrict the certificates only they keep to that usage where the store supports it
+    cert-manage whitelist -file whitelist.yaml -policy web
+    cert-manage whitelist -file whitelist.yaml -policy web,email
+
+  Find every java keystore (e.g. many JVMs or container images) and whitelist them in parallel,
+  each keystore is backed up first
+    cert-manage whitelist -app java -all-keystores -file whitelist.json
+    cert-manage whitelist -app java -all-keystores -keystore-roots /opt,/var/lib/docker -parallel 8 -file whitelist.json
+
+PROFILES
+  minimal-web      Roots which anchor the vast majority of publicly trusted websites
+  mozilla-only     Every root included in Mozilla's root program
+  us-gov-excluded  Mozilla's roots, minus CAs under United States jurisdiction`,
+			flags: func(fs *flag.FlagSet) {
+				fileFlag(fs, "Whitelist to apply")
+				profileFlag(fs)
+				fs.BoolVar(&flagForce, "force", false, "Apply the whitelist even if it was the last one applied and the store hasn't changed")
+				fs.StringVar(&flagVerifyHosts, "verify-hosts", "", "File of hosts which must verify after the whitelist is applied, otherwise the backup is restored")
+				fs.BoolVar(&flagCascade, "cascade", false, "Also remove intermediates which only chain to removed roots")
+				fs.StringVar(&flagPolicy, "policy", "", "Comma separated policies of the whitelist to apply, defaults to every policy")
+				fs.BoolVar(&flagAllKeystores, "all-keystores", false, "With -app java, whitelist every java keystore found")
+				fs.StringVar(&flagKeystoreRoots, "keystore-roots", "", "Comma separated directories searched for keystores by -all-keystores, defaults to where java is installed")
+				fs.IntVar(&flagParallel, "parallel", 4, "How many keystores -all-keystores whitelists at once")
+			},
+			fn: func(fs *flag.FlagSet) error {
+				if fs.Arg(0) == "edit" {
+					return whitelistEdit(fs)
+				}
+				if flagFile == "" && flagProfile == "" || flagAllKeystores {
+					return errShowHelp
+				}
+				return cmd.WhitelistForPlatform(flagFile, flagProfile, whitelistOptions())
+			},
+			appfn: func(a string, fs *flag.FlagSet) error {
+				if fs.Arg(0) == "edit" {
+					return whitelistEdit(fs)
+				}
+				if flagFile == "" && flagProfile == "" {
+					return errShowHelp
+				}
+				if flagAllKeystores {
+					if !strings.EqualFold(a, "java") || flagVerifyHosts != "" || flagCascade || flagPolicy != "" {
+						return errShowHelp
+					}
+					return cmd.WhitelistJavaKeystores(flagFile, flagProfile, keystoreRoots(), flagParallel, flagForce)
+				}
+				return cmd.WhitelistForApp(a, flagFile, flagProfile, whitelistOptions())
+			},
+		},
+	}
+}
+
+// auditOptions reads -weak and -out for 'audit', a blacklist is only written with -weak
+func auditOptions() (cmd.AuditOptions, error) {
+	if flagOutFile != "" && !flagWeak {
+		return cmd.AuditOptions{}, errShowHelp
+	}
+	setCTOptions()
+	if flagCertdata == "embedded" {
+		setSnapshotDir()
+	}
+	return cmd.AuditOptions{
+		Weak:      flagWeak,
+		Blacklist: flagOutFile,
+		Issuance:  flagIssuance,
+		CRLSet:    flagCRLSet,
+		Certdata:  flagCertdata,
+		Whitelist: flagWhitelist,
+	}, nil
+}
+
+func showOptions() cmd.ShowOptions {
+	return cmd.ShowOptions{
+		Whitelist:       flagWhitelist,
+		FingerprintAlgo: flagFingerprintAlgo,
+	}
+}
+
+func observeOptions() cmd.ObserveOptions {
+	return cmd.ObserveOptions{
+		Listen:    flagListen,
+		Duration:  flagDuration,
+		Whitelist: flagFile,
+		Out:       flagOutFile,
+	}
+}
+
+// trustACME runs 'trust-acme' against stores
+func trustACME(stores []string) error {
+	if (flagDirectory == "") == (flagStepCA == "") {
+		return errShowHelp
+	}
+	return cmd.TrustACME(cmd.TrustACMEOptions{
+		Directory:   flagDirectory,
+		StepCA:      flagStepCA,
+		Fingerprint: flagFingerprint,
+		Yes:         flagYes,
+		Stores:      stores,
+	})
+}
+
+// trustVault runs 'trust-vault' against stores
+func trustVault(stores []string) error {
+	if flagMount == "" {
+		return errShowHelp
+	}
+	return cmd.TrustVault(cmd.TrustVaultOptions{
+		Mounts: strings.Split(flagMount, ","),
+		Stores: stores,
+		Out:    flagOutFile,
+	})
+}
+
+// agentCommand runs 'agent enroll' or 'agent run', the flags given after
+// them are parsed again as the flag package stops at the sub-command
+func agentCommand(fs *flag.FlagSet) error {
+	sub := fs.Arg(0)
+	if sub == "" {
+		return errShowHelp
+	}
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errShowHelp
+	}
+	if err := whitelist.SetLabels(flagLabels); err != nil {
+		return err
+	}
+	opts := cmd.AgentOptions{
+		Dir:      flagDir,
+		Server:   flagServer,
+		ServerCA: flagServerCA,
+		Group:    flagGroup,
+		Interval: flagInterval,
+		Once:     flagOnce,
+		Version:  Version,
+	}
+	switch sub {
+	case "enroll":
+		if flagServer == "" || flagApp != "" {
+			return errShowHelp
+		}
+		token, err := readToken(os.Stdin)
+		if err != nil {
+			return err
+		}
+		opts.Token = token
+		return cmd.AgentEnroll(opts)
+	case "run":
+		if flagServer != "" || flagTokenFile != "" {
+			return errShowHelp
+		}
+		if flagApp != "" {
+			return cmd.AgentRunForApp(flagApp, opts)
+		}
+		return cmd.AgentRunForPlatform(opts)
+	}
+	return errShowHelp
+}
+
+// readToken returns the enrollment token from -token-file (- reads stdin) or
+// $CERT_MANAGE_TOKEN. Tokens aren't taken as arguments, which any user on the
+// host can see for as long as the process runs.
+func readToken(stdin io.Reader) (string, error) {
+	var token string
+	switch flagTokenFile {
+	case "":
+		token = os.Getenv("CERT_MANAGE_TOKEN")
+	case "-":
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", fmt.Errorf("error reading token: %v", err)
+		}
+		token = line
+	default:
+		bs, err := ioutil.ReadFile(flagTokenFile)
+		if err != nil {
+			return "", fmt.Errorf("error reading token: %v", err)
+		}
+		token = string(bs)
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", errors.New("no token given, use -token-file or $CERT_MANAGE_TOKEN")
+	}
+	return token, nil
+}
+
+// whitelistEdit runs 'whitelist edit', the flags given after "edit" are
+// parsed again as the flag package stops at it
+func whitelistEdit(fs *flag.FlagSet) error {
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return err
+	}
+	if flagFile == "" || flagProfile != "" || fs.NArg() > 0 {
+		return errShowHelp
+	}
+	if flagApp != "" {
+		return cmd.EditWhitelistForApp(flagApp, flagFile)
+	}
+	return cmd.EditWhitelistForPlatform(flagFile)
+}
+
+func whitelistOptions() cmd.WhitelistOptions {
+	opts := cmd.WhitelistOptions{
+		Force:       flagForce,
+		VerifyHosts: flagVerifyHosts,
+		Cascade:     flagCascade,
+	}
+	if flagPolicy != "" {
+		opts.Policies = strings.Split(flagPolicy, ",")
+	}
+	return opts
+}
+
+func restoreOptions() cmd.RestoreOptions {
+	return cmd.RestoreOptions{
+		Diff:   flagDiff,
+		Format: flagFormat,
+		Yes:    flagYes,
+		Adapt:  flagAdapt,
+	}
+}
+
+// exportOptions lifts the 'export' flags into cmd.ExportOptions, calendar is
+// true when '-format ics' was given. Other file formats are picked from the
+// -out extension instead.
+func exportOptions() (opts cmd.ExportOptions, calendar bool, err error) {
+	if flagOutFile == "" {
+		return opts, false, errShowHelp
+	}
+	opts = cmd.ExportOptions{
+		Blacklist: flagBlacklist,
+		Whitelist: flagWhitelist,
+	}
+	switch flagFormat {
+	case ui.DefaultFormat():
+		return opts, false, nil
+	case "ics":
+		if flagBlacklist != "" || flagWhitelist != "" {
+			return opts, false, errShowHelp
+		}
+		return opts, true, nil
+	case "capath":
+		opts.Format = flagFormat
+		return opts, false, nil
+	case "ddm":
+		if flagURL == "" {
+			return opts, false, errShowHelp
+		}
+		opts.Format, opts.URL = flagFormat, flagURL
+		return opts, false, nil
+	}
+	return opts, false, fmt.Errorf("unknown export format %q, only ics, capath or ddm can be given", flagFormat)
+}
+
+// factsFormat returns -format for 'facts', key=value lines are the default
+func factsFormat() string {
+	if flagFormat == ui.DefaultFormat() {
+		return "keyvalue"
+	}
+	return flagFormat
+}
+
+// pinFormat returns -format for 'pins', which shares the global flag. The
+// default output format isn't a pin format so android is used instead.
+func pinFormat() string {
+	if flagFormat == ui.DefaultFormat() {
+		return "android"
+	}
+	return flagFormat
+}
+
+// parseBefore reads -before for 'prune', which defaults to now
+func parseBefore() (time.Time, error) {
+	if !flagExpired {
+		return time.Time{}, errShowHelp
+	}
+	if flagBefore == "" {
+		return time.Now(), nil
+	}
+	t, err := time.Parse("2006-01-02", flagBefore)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -before %q, expected YYYY-MM-DD", flagBefore)
+	}
+	return t, nil
+}
+
+// keystoreRoots splits -keystore-roots, empty means the default locations are searched
+func keystoreRoots() []string {
+	return splitList(flagKeystoreRoots)
+}
+
+// fileOrStdin returns -file, or "-" (stdin) when that's the only argument
+func fileOrStdin(fs *flag.FlagSet) (string, bool) {
+	if flagFile != "" {
+		return flagFile, fs.NArg() == 0
+	}
+	if fs.NArg() == 1 && fs.Arg(0) == "-" {
+		return "-", true
+	}
+	return "", false
+}
+
+// splitList splits a comma separated flag value, dropping empty items
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func parseConnectUrl(fs *flag.FlagSet) (*url.URL, error) {
+	if fs.NArg() != 1 {
+		return nil, fmt.Errorf("unknown arguments: %s", strings.Join(fs.Args(), ", "))
+	}
+
+	raw := fs.Arg(0)
+	if raw == "" {
+		return nil, errors.New("no url specified")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", raw, err)
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("non-secure url scheme used: %s", u.String())
+	}
+	return u, nil
+}
@@ -0,0 +1,222 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/ui"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+// completionData is rendered into each shell's completion script. Values which
+// can change at runtime (-app and backups) are completed by calling
+// `cert-manage __complete` instead.
+type completionData struct {
+	Commands []string
+	Flags    []string
+
+	Formats          string
+	UIs              string
+	FingerprintAlgos string
+	Profiles         string
+	Columns          string
+	Scopes           string
+}
+
+var completionScripts = map[string]string{
+	"bash": `# bash completion for cert-manage
+# Install with: source <(cert-manage completion bash)
+_cert_manage() {
+  local cur prev app i
+  cur="${COMP_WORDS[COMP_CWORD]}"
+  prev="${COMP_WORDS[COMP_CWORD-1]}"
+
+  for (( i=1; i < COMP_CWORD; i++ )); do
+    if [[ "${COMP_WORDS[i]}" == "-app" ]]; then
+      app="${COMP_WORDS[i+1]}"
+    fi
+  done
+
+  case "$prev" in
+    -app)
+      COMPREPLY=( $(compgen -W "$(cert-manage __complete apps)" -- "$cur") ); return ;;
+    -file)
+      if [[ "${COMP_WORDS[1]}" == "restore" ]]; then
+        COMPREPLY=( $(compgen -W "$(cert-manage __complete ${app:+-app $app} backups)" -- "$cur") )
+      else
+        COMPREPLY=( $(compgen -f -- "$cur") )
+      fi
+      return ;;
+    -out|-hosts)
+      COMPREPLY=( $(compgen -f -- "$cur") ); return ;;
+    -format)
+      COMPREPLY=( $(compgen -W "{{.Formats}}" -- "$cur") ); return ;;
+    -ui)
+      COMPREPLY=( $(compgen -W "{{.UIs}}" -- "$cur") ); return ;;
+    -fingerprint-algo)
+      COMPREPLY=( $(compgen -W "{{.FingerprintAlgos}}" -- "$cur") ); return ;;
+    -profile)
+      COMPREPLY=( $(compgen -W "{{.Profiles}}" -- "$cur") ); return ;;
+    -sort)
+      COMPREPLY=( $(compgen -W "{{.Columns}}" -- "$cur") ); return ;;
+    -scope)
+      COMPREPLY=( $(compgen -W "{{.Scopes}}" -- "$cur") ); return ;;
+  esac
+
+  if [[ $COMP_CWORD -eq 1 ]]; then
+    COMPREPLY=( $(compgen -W "{{join .Commands}}" -- "$cur") )
+  else
+    COMPREPLY=( $(compgen -W "{{join .Flags}}" -- "$cur") )
+  fi
+}
+complete -F _cert_manage cert-manage
+`,
+	"zsh": `#compdef cert-manage
+# zsh completion for cert-manage
+# Install with: cert-manage completion zsh > "${fpath[1]}/_cert-manage"
+_cert_manage() {
+  local app
+  local -i i
+  for (( i=2; i < CURRENT; i++ )); do
+    if [[ "$words[i]" == "-app" ]]; then
+      app="$words[i+1]"
+    fi
+  done
+
+  if (( CURRENT == 2 )); then
+    compadd -- {{join .Commands}}
+    return
+  fi
+
+  case "$words[CURRENT-1]" in
+    -app)
+      compadd -- ${(f)"$(cert-manage __complete apps)"} ;;
+    -file)
+      if [[ "$words[2]" == "restore" ]]; then
+        compadd -- ${(f)"$(cert-manage __complete ${app:+-app} $app backups)"}
+      else
+        _files
+      fi ;;
+    -out|-hosts)
+      _files ;;
+    -format)
+      compadd -- {{.Formats}} ;;
+    -ui)
+      compadd -- {{.UIs}} ;;
+    -fingerprint-algo)
+      compadd -- {{.FingerprintAlgos}} ;;
+    -profile)
+      compadd -- {{.Profiles}} ;;
+    -sort)
+      compadd -- {{.Columns}} ;;
+    -scope)
+      compadd -- {{.Scopes}} ;;
+    *)
+      compadd -- {{join .Flags}} ;;
+  esac
+}
+compdef _cert_manage cert-manage
+`,
+	"fish": `# fish completion for cert-manage
+# Install with: cert-manage completion fish > ~/.config/fish/completions/cert-manage.fish
+function __cert_manage_backups
+  set -l app (string match -r -- '-app\s+(\S+)' (commandline) | tail -n 1)
+  if test -n "$app"
+    cert-manage __complete -app $app backups
+  else
+    cert-manage __complete backups
+  end
+end
+
+complete -c cert-manage -f
+complete -c cert-manage -n '__fish_use_subcommand' -a '{{join .Commands}}'
+{{range .Flags}}complete -c cert-manage -n 'not __fish_use_subcommand' -o {{trim .}}
+{{end}}complete -c cert-manage -o app -x -a '(cert-manage __complete apps)'
+complete -c cert-manage -n '__fish_seen_subcommand_from restore' -o file -x -a '(__cert_manage_backups)'
+complete -c cert-manage -n 'not __fish_seen_subcommand_from restore' -o file -r -F
+complete -c cert-manage -o out -r -F
+complete -c cert-manage -o hosts -r -F
+complete -c cert-manage -o format -x -a '{{.Formats}}'
+complete -c cert-manage -o ui -x -a '{{.UIs}}'
+complete -c cert-manage -o fingerprint-algo -x -a '{{.FingerprintAlgos}}'
+complete -c cert-manage -o profile -x -a '{{.Profiles}}'
+complete -c cert-manage -o sort -x -a '{{.Columns}}'
+complete -c cert-manage -o scope -x -a '{{.Scopes}}'
+`,
+}
+
+// getCompletionShells returns the shells we can generate completion scripts for
+func getCompletionShells() []string {
+	var out []string
+	for k := range completionScripts {
+		out = append(out, k)
+	}
+	file.SortNames(out)
+	return out
+}
+
+// writeCompletion renders the completion script for `shell` into w
+func writeCompletion(w io.Writer, shell string, commands []string, flags []string) error {
+	script, ok := completionScripts[strings.ToLower(shell)]
+	if !ok {
+		return fmt.Errorf("unknown shell %q, options: %s", shell, strings.Join(getCompletionShells(), ", "))
+	}
+
+	data := completionData{
+		Commands:         commands,
+		Formats:          strings.Join(ui.GetFormats(), " "),
+		UIs:              strings.Join(ui.GetUIs(), " "),
+		FingerprintAlgos: strings.Join(ui.GetFingerprintAlgos(), " "),
+		Profiles:         strings.Join(whitelist.GetProfiles(), " "),
+		Columns:          strings.Join(ui.GetTableColumns(), " "),
+		Scopes:           strings.Join(store.GetScopes(), " "),
+	}
+	for i := range flags {
+		if len(flags[i]) > 1 { // skip -h
+			data.Flags = append(data.Flags, "-"+flags[i])
+		}
+	}
+	file.SortNames(data.Commands)
+	file.SortNames(data.Flags)
+
+	funcs := template.FuncMap{
+		"join": func(ss []string) string {
+			return strings.Join(ss, " ")
+		},
+		"trim": func(s string) string {
+			return strings.TrimPrefix(s, "-")
+		},
+	}
+	t := template.Must(template.New(shell).Funcs(funcs).Parse(script))
+	return t.Execute(w, data)
+}
+
+// completeBackups prints the backups of a store, used by `cert-manage __complete backups`
+func completeBackups(w io.Writer, s store.Store) error {
+	backups, err := store.GetBackups(s)
+	if err != nil {
+		return err
+	}
+	for i := range backups {
+		fmt.Fprintln(w, backups[i])
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/file"
+)
+
+func TestMain__writeCompletion(t *testing.T) {
+	var names []string
+	for _, c := range commands {
+		if !c.hidden {
+			names = append(names, c.name)
+		}
+	}
+	file.SortNames(names)
+
+	var flags []string
+	for _, f := range allFlags() {
+		if len(f) > 1 {
+			flags = append(flags, "-"+f)
+		}
+	}
+	file.SortNames(flags)
+
+	for _, shell := range []string{"bash", "zsh"} {
+		var buf bytes.Buffer
+		if err := writeCompletion(&buf, shell, names, allFlags()); err != nil {
+			t.Fatalf("%s: %v", shell, err)
+		}
+		out := buf.String()
+
+		if !strings.Contains(out, strings.Join(names, " ")) {
+			t.Errorf("%s: missing commands %v", shell, names)
+		}
+		if !strings.Contains(out, strings.Join(flags, " ")) {
+			t.Errorf("%s: missing flags %v", shell, flags)
+		}
+		if !strings.Contains(out, "sha256 sha1 spki-sha256") {
+			t.Errorf("%s: missing -fingerprint-algo values", shell)
+		}
+	}
+
+	if err := writeCompletion(&bytes.Buffer{}, "tcsh", names, allFlags()); err == nil {
+		t.Error("expected error")
+	}
+}
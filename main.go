@@ -18,111 +18,168 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"net/url"
+	"io"
 	"os"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/adamdecaf/cert-manage/pkg/cmd"
+	"github.com/adamdecaf/cert-manage/pkg/cosign"
+	"github.com/adamdecaf/cert-manage/pkg/events"
+	"github.com/adamdecaf/cert-manage/pkg/httputil"
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
+	"github.com/adamdecaf/cert-manage/pkg/metrics"
+	"github.com/adamdecaf/cert-manage/pkg/output"
+	"github.com/adamdecaf/cert-manage/pkg/privilege"
 	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
 	"github.com/adamdecaf/cert-manage/pkg/ui"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
 )
 
 const Version = "0.1.1-dev"
 
+// Global flags, these are accepted before or after a sub-command
 var (
-	fs = flag.NewFlagSet("flags", flag.ExitOnError)
+	// -app is used for operating on an installed application
+	flagApp = ""
 
-	// incantations of "--help"
-	flagHelp1 = fs.Bool("h", false, "")
-	flagHelp2 = fs.Bool("help", false, "")
-	flagHelp3 = fs.Bool("-help", false, "") // --help
+	// -dry-run is used to show what would change, without changing anything
+	flagDryRun = false
 
-	// -file is used to specify an input file path
-	flagFile = fs.String("file", "", "")
+	// -format is used to change the output format
+	flagFormat = ui.DefaultFormat()
 
-	// -url is used to specify an input URL
-	flagURL = fs.String("url", "", "")
+	// -no-sudo is used to prevent escalating privileges
+	flagNoSudo = false
 
-	// -app is used for operating on an installed application
-	flagApp = fs.String("app", "", "")
+	// -scope limits which stores are used, e.g. CurrentUser or LocalMachine on windows
+	flagScope = store.ScopeAll
 
-	// -ui is used for choosing a different ui
-	flagUI = fs.String("ui", ui.DefaultUI(), "")
+	// -unlock-keychain and -keychain-password-stdin unlock keychains before they're used (darwin)
+	flagUnlockKeychain        = false
+	flagKeychainPasswordStdin = false
 
-	// -from is used by 'gen-whitelist' to specify url sources
-	flagFrom = fs.String("from", "", "")
+	// -include-smartcards removes trust in roots smart card certificates chain to (darwin)
+	flagIncludeSmartCards = false
 
-	// -out is used by 'gen-whitelist' to specify output file location
-	flagOutFile = fs.String("out", "", "")
+	// -enterprise-stores also whitelists the intermediate CA and NTAuth stores (windows)
+	flagEnterpriseStores = false
 
-	// Output
-	flagCount  = fs.Bool("count", false, "")
-	flagFormat = fs.String("format", ui.DefaultFormat(), "")
+	// -timeout is how long an external command (e.g. security or keytool) can run
+	flagTimeout = interrupt.Timeout
 
-	// internal override to show help text
-	callForHelp = false
-)
+	// -offline forbids network access, only cached data is used
+	flagOffline = false
 
-func init() {
-	fs.Usage = func() {
-		fmt.Printf(`Usage of cert-manage version %s
-SUB-COMMANDS
-  add           Add certificate(s) to a store
+	// -pprof writes CPU and heap profiles into a directory
+	flagPprof = ""
 
-  backup        Take a backup of the specified certificate store
+	// -utc and -local pick the zone dates are shown in, and -time-format
+	// their layout
+	flagUTC        = false
+	flagLocal      = false
+	flagTimeFormat = "date"
 
-  connect       Attempt to load a remote URL with the platform (or app) store
+	// -cosign-key, or -cosign-identity, -cosign-issuer, -cosign-roots and
+	// -cosign-rekor-key for keyless signatures, require downloaded whitelists
+	// and certificate bundles to be signed with cosign
+	flagCosignKey      = ""
+	flagCosignIdentity = ""
+	flagCosignIssuer   = ""
+	flagCosignRoots    = ""
+	flagCosignRekorKey = ""
 
-  gen-whitelist Create a whitelist from various sources
+	// -labels describe this host, e.g. role=ci,env=prod, and select the
+	// variants of whitelists it gets
+	flagLabels = ""
 
-  list          List the currently installed and trusted certificates
+	// -metrics-push sends the results of the run (e.g. certificates removed)
+	// to a Prometheus Pushgateway or statsd://host:port once it's done
+	flagMetricsPush = ""
 
-  restore       Revert the certificate trust back to, optionally takes -file <path>
+	// -events writes trust store changes and audit findings as security
+	// events, in -events-format (cef or leef), for SIEMs to ingest
+	flagEvents       = ""
+	flagEventsFormat = events.CEF
 
-  version       Show the version of cert-manage
+	// -h, -help and --help show help text
+	flagHelp = false
 
-  whitelist     Remove trust from certificates which do not match the whitelist in <path>
+	// -out given before the sub-command (or after it, for sub-commands without
+	// their own -out) is where output and errors are written: a file, syslog
+	// or - for stdout
+	flagOutput = output.Stdout
+)
 
-APPS
-  Supported apps: %s
+// globalFlags registers the flags shared by every sub-command on fs. The
+// current values are used as defaults so flags given before the sub-command
+// are kept.
+func globalFlags(fs *flag.FlagSet) {
+	fs.StringVar(&flagApp, "app", flagApp, fmt.Sprintf("The name of an application which to perform the given command on (options: %s)", strings.Join(store.GetApps(), ", ")))
+	fs.BoolVar(&flagDryRun, "dry-run", flagDryRun, "Show what would change, without modifying any certificate store")
+	fs.StringVar(&flagFormat, "format", flagFormat, fmt.Sprintf("Change the output format for a given command (options: %s)", strings.Join(ui.GetFormats(), ", ")))
+	fs.BoolVar(&flagNoSudo, "no-sudo", flagNoSudo, "Never escalate privileges, operations which need them are skipped and reported")
+	fs.StringVar(&flagScope, "scope", flagScope, fmt.Sprintf("Limit the stores used to the current user's (login keychain, CurrentUser, ~/.pki/nssdb) or the system's (options: %s)", strings.Join(store.GetScopes(), ", ")))
+	fs.BoolVar(&flagUnlockKeychain, "unlock-keychain", flagUnlockKeychain, "Prompt to unlock keychains before they're used (darwin only)")
+	fs.BoolVar(&flagEnterpriseStores, "enterprise-stores", flagEnterpriseStores, "Also whitelist the intermediate CA and NTAuth stores (windows only)")
+	fs.BoolVar(&flagKeychainPasswordStdin, "keychain-password-stdin", flagKeychainPasswordStdin, "Read the password to unlock keychains from stdin (darwin only)")
+	fs.BoolVar(&flagIncludeSmartCards, "include-smartcards", flagIncludeSmartCards, "Also remove trust in roots which smart card or token certificates chain to (darwin only)")
+	fs.DurationVar(&flagTimeout, "timeout", flagTimeout, "How long an external command (e.g. security, keytool or certutil) can run before it's killed")
+	fs.BoolVar(&flagOffline, "offline", flagOffline, "Forbid network access, commands needing it fail and only cached data (e.g. -issuance checkpoints) is used")
+	fs.StringVar(&flagPprof, "pprof", flagPprof, "Write CPU and heap profiles (cpu.pprof and heap.pprof) into this directory, for reporting slow runs")
+	fs.BoolVar(&flagUTC, "utc", flagUTC, "Show dates and times in UTC (the default)")
+	fs.BoolVar(&flagLocal, "local", flagLocal, "Show dates and times in the local timezone")
+	fs.StringVar(&flagTimeFormat, "time-format", flagTimeFormat, fmt.Sprintf("How dates and times are shown (options: %s)", strings.Join(timeutil.GetFormats(), ", ")))
+	fs.StringVar(&flagCosignKey, "cosign-key", flagCosignKey, "Refuse downloaded whitelists and certificate bundles unless signed (<url>.sig) by this cosign public key")
+	fs.StringVar(&flagCosignIdentity, "cosign-identity", flagCosignIdentity, "Refuse downloads unless signed keyless (<url>.bundle) by this email or URI")
+	fs.StringVar(&flagCosignIssuer, "cosign-issuer", flagCosignIssuer, "OIDC issuer keyless signers must have authenticated with, e.g. https://accounts.google.com")
+	fs.StringVar(&flagCosignRoots, "cosign-roots", flagCosignRoots, "Fulcio root and intermediate certificates keyless signatures are verified against")
+	fs.StringVar(&flagCosignRekorKey, "cosign-rekor-key", flagCosignRekorKey, "Rekor's public key, which keyless signatures must be logged with")
+	fs.StringVar(&flagLabels, "labels", flagLabels, "Comma separated key=value labels of this host (e.g. role=ci,env=prod) which select whitelist variants, hostname is always set")
+	fs.StringVar(&flagEvents, "events", flagEvents, "Write removed certificates and audit findings as security events to a file (appended to), syslog or - for stdout")
+	fs.StringVar(&flagEventsFormat, "events-format", flagEventsFormat, fmt.Sprintf("Format of -events (options: %s)", strings.Join(events.GetFormats(), ", ")))
+	fs.StringVar(&flagMetricsPush, "metrics-push", flagMetricsPush, "Push the run's results (certificates removed, violations, duration) to a Pushgateway URL or statsd://host:port")
+	fs.BoolVar(&flagHelp, "h", flagHelp, "Show this help dialog")
+	fs.BoolVar(&flagHelp, "help", flagHelp, "Show this help dialog")
+}
 
-FLAGS
-  -app <name>      The name of an application which to perform the given command on.
-  -file <path>     Local file path
-  -from <type(s)>  Which sources to capture urls from. Comma separated list. (Options: browser, chrome, firefox, file)
-  -help            Show this help dialog
-  -ui <type>       Method of adjusting certificates to be removed/untrusted. (default: %s, options: %s)
-  -url <where>     Remote URL to download and use in a command
+func usage(global *flag.FlagSet) {
+	fmt.Printf(`Usage of cert-manage version %s
+  cert-manage [flags] <sub-command> [flags]
 
-OUTPUT
-  -count  Output the count of certificates instead of each certificate
-  -format <format> Change the output format for a given command (default: %s, options: %s)
+SUB-COMMANDS
+`, getVersion())
+	for _, c := range commands {
+		if !c.hidden {
+			fmt.Printf("  %-14s %s\n", c.name, c.summary)
+		}
+	}
+	fmt.Printf(`
+APPS
+  Supported apps: %s
+  Snaps and flatpaks carry their own CA bundles, use -app snap:<name> or -app flatpak:<id>
+  Any PEM bundle on disk can be managed with -app file:<path>
+  The ownertrust of GnuPG keys can be listed, audited and whitelisted with -app gpg
+  OpenSSH's trusted host and user CAs can be listed and whitelisted with -app ssh
+
+GLOBAL FLAGS
+`, strings.Join(store.GetApps(), ", "))
+	global.PrintDefaults()
+	fmt.Println(`
+  Run 'cert-manage <sub-command> -help' to see the flags of each sub-command.
+
+ANSIBLE
+  cert-manage -module [<args.json>] runs the sub-command described by JSON read from the
+  file (how Ansible runs binary modules) or stdin, printing changed/failed/msg as JSON:
+    {"command": "whitelist", "app": "java", "file": "/etc/whitelist.yaml"}
 
 DEBUGGING
   Alongside command line flags are two environmental varialbes read by cert-manage:
   - DEBUG=1        Enabled debug logging, GODEBUG=x509roots=1 also works and enabled Go's debugging
   - TRACE=<where>  Saves a binary trace file at <where> of the execution
-`,
-			getVersion(),
-			strings.Join(store.GetApps(), ", "),
-			ui.DefaultUI(),
-			strings.Join(ui.GetUIs(), ", "),
-			ui.DefaultFormat(),
-			strings.Join(ui.GetFormats(), ", "),
-		)
-	}
-}
-
-func calledHelp() bool {
-	return callForHelp || *flagHelp1 || *flagHelp2 || *flagHelp3
-}
-
-type command struct {
-	fn    func() error
-	appfn func(string) error
-
-	help string
+  -pprof <dir> writes CPU and heap profiles, read with 'go tool pprof'`)
 }
 
 func trace() *cmd.Trace {
@@ -139,279 +196,223 @@ func trace() *cmd.Trace {
 
 func main() {
 	t := trace()
-	defer func() {
-		err := t.Stop()
-		if err != nil {
-			panic(err)
-		}
-	}()
-
-	// Just show help if there aren't enough arguments to do anything
-	if len(os.Args) < 2 {
-		fs.Usage()
-		return
-	}
-	fs.Parse(os.Args[1:])
-	if len(os.Args) == 2 && calledHelp() {
-		fs.Usage()
-		return
+	code := run(os.Args[1:])
+	if err := t.Stop(); err != nil {
+		panic(err)
 	}
-	fs.Parse(os.Args[2:]) // reparse
+	os.Exit(code)
+}
 
-	// Lift config options into a higher-level
-	cfg := &ui.Config{
-		Count:   *flagCount,
-		Format:  *flagFormat,
-		Outfile: *flagOutFile,
-		UI:      *flagUI,
+// run parses args, executes the sub-command and returns the exit code
+func run(args []string) int {
+	if len(args) > 0 && (args[0] == "-module" || args[0] == "--module") {
+		return runModule(args[1:])
 	}
 
-	// Build up sub-commands
-	commands := make(map[string]*command)
-	commands["add"] = &command{
-		fn: func() error {
-			if *flagFile == "" {
-				callForHelp = true
-				return nil
-			}
-			return cmd.AddCertsFromFile(*flagFile)
-		},
-		appfn: func(a string) error {
-			if *flagFile == "" {
-				callForHelp = true
-				return nil
-			}
-			return cmd.AddCertsToAppFromFile(a, *flagFile)
-		},
-		help: fmt.Sprintf(`Usage: cert-manage add -file <path> [-app <name>]
-
-  Add a certificate to the platform store
-    cert-manage add -file <path>
-
-  Add a certificate to an application's store
-    cert-manage add -file <path> -app <name>
-
-APPS
-  Supported apps: %s`, strings.Join(store.GetApps(), ", ")),
+	global := flag.NewFlagSet("cert-manage", flag.ExitOnError)
+	global.SetOutput(os.Stdout)
+	global.Usage = func() { usage(global) }
+	globalFlags(global)
+	global.StringVar(&flagOutput, "out", flagOutput, "Where to write output and errors: a file (appended to), syslog or - for stdout")
+	global.Parse(args)
+
+	// Just show help if there isn't a sub-command to run
+	if global.NArg() == 0 {
+		usage(global)
+		return 0
 	}
-	commands["backup"] = &command{
-		fn: func() error {
-			return cmd.BackupForPlatform()
-		},
-		appfn: func(a string) error {
-			return cmd.BackupForApp(a)
-		},
-		help: fmt.Sprintf(`Usage: cert-manage backup [-app <name>]
-
-  Backup a certificate store. This can be done for the platform or a given app.
-
-APPS
-  Supported apps: %s`, strings.Join(store.GetApps(), ", ")),
+	c := findCommand(global.Arg(0))
+	if c == nil {
+		usage(global)
+		return 1
 	}
-	commands["connect"] = &command{
-		fn: func() error {
-			u, err := parseConnectUrl(fs)
-			if err != nil {
-				return err
-			}
-			return cmd.ConnectWithPlatformStore(u)
-		},
-		appfn: func(a string) error {
-			u, err := parseConnectUrl(fs)
-			if err != nil {
-				return err
-			}
-			return cmd.ConnectWithAppStore(u, *flagApp)
-		},
-		help: fmt.Sprintf(`Usage: cert-manage connect [-app <name>] <url>
 
-Attempt an HTTP connect to <url> with the given certificate store. If -app is provided then
-the certificates for that application are loaded and used for the connection.
-
-APPS
-  Supported apps: %s`, strings.Join(store.GetApps(), ", ")),
+	fs := c.flagSet()
+	fs.Parse(global.Args()[1:])
+	if flagHelp {
+		c.printHelp(fs)
+		return 1
 	}
-	commands["gen-whitelist"] = &command{
-		fn: func() error {
-			if *flagOutFile == "" || (*flagFrom == "" && *flagFile == "") {
-				callForHelp = true
-				return nil
-			}
-			return cmd.GenerateWhitelist(*flagOutFile, *flagFrom, *flagFile)
-		},
-		help: fmt.Sprintf(`Usage: cert-manage gen-whitelist -out <where> [-file <file>] [-from <type>]
-
-  Generate a whitelist and write it to the filesystem. (At wherever -out points to.)
-
-  Also, you can pass -file to read a newline delimited file of URL's.
-    cert-manage gen-whitelist -file <path> -out whitelist.json
 
-  Generate a whitelist from browser history
-    cert-manage gen-whitelist -from firefox -out whitelist.json
-
-  Generate a whitelist from all browsers on a computer
-    cert-manage gen-whitelist -from browsers -out whitelist.json
-
-APPS
-  Supported apps: %s`, strings.Join(store.GetApps(), ", ")),
+	restore, err := output.Redirect(flagOutput)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return 1
 	}
-	commands["list"] = &command{
-		fn: func() error {
-			if *flagFile != "" {
-				return cmd.ListCertsFromFile(*flagFile, cfg)
-			}
-			if *flagURL != "" {
-				return cmd.ListCertsFromURL(*flagURL, cfg)
-			}
-			return cmd.ListCertsForPlatform(cfg)
-		},
-		appfn: func(a string) error {
-			return cmd.ListCertsForApp(a, cfg)
-		},
-		help: fmt.Sprintf(`Usage: cert-manage list [options]
-
-  List certificates currently installed on the platform or application.
-
-  List certificates from an application
-    cert-mange list -app firefox
-
-  List certificates from a file
-    cert-mange list -file <path>
-
-  List certificates from a URL
-    cert-manage list -url <endpoint>
-
-FORMATTING
-
-  Change the output format (Default: %s, Options: %s)
-    cert-manage list -format openssl
-
-  Only show the count of certificates found
-    cert-manage list -count
-    cert-manage list -app java -count
-    cert-manage list -file <path> -count
+	defer restore()
 
-  Show the certificates on a local webpage (Default: %s, Options: %s)
-    cert-manage list -ui web
-
-APPS
-  Supported apps: %s`,
-			ui.DefaultFormat(),
-			strings.Join(ui.GetFormats(), ", "),
-			ui.DefaultUI(),
-			strings.Join(ui.GetUIs(), ", "),
-			strings.Join(store.GetApps(), ", ")),
-	}
-	commands["restore"] = &command{
-		fn: func() error {
-			return cmd.RestoreForPlatform(*flagFile)
-		},
-		appfn: func(a string) error {
-			return cmd.RestoreForApp(a, *flagFile)
-		},
-		help: fmt.Sprintf(`Usage: cert-manage restore [-app <name>] [-file <path>]
-
-  Restore certificates from the latest backup
-    cert-manage restore
-
-  Restore certificates for the platform from a file
-    cert-manage restore -file <path>
-
-  Restore certificates for an application from the latest backup
-    cert-manage restore -app java
-
-APPS
-  Supported apps: %s`, strings.Join(store.GetApps(), ", ")),
+	prof, err := cmd.NewProfile(flagPprof)
+	if err == nil {
+		err = prof.Start()
 	}
-	commands["whitelist"] = &command{
-		fn: func() error {
-			if *flagFile == "" {
-				callForHelp = true
-				return nil
-			}
-			return cmd.WhitelistForPlatform(*flagFile)
-		},
-		appfn: func(a string) error {
-			if *flagFile == "" {
-				callForHelp = true
-				return nil
-			}
-			return cmd.WhitelistForApp(a, *flagFile)
-		},
-		help: fmt.Sprintf(`Usage: cert-manage whitelist [-app <name>] -file <path>
-
-  Remove untrusted certificates from a store for the platform
-    cert-manage whitelist -file whitelist.json
-
-  Remove untrusted certificates in an app
-    cert-manage whitelist -file whitelist.json -app java
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return 1
+	}
+	defer func() {
+		if err := prof.Stop(); err != nil {
+			fmt.Printf("ERROR: writing profile: %v\n", err)
+		}
+	}()
 
-APPS
-  Supported apps: %s`, strings.Join(store.GetApps(), ", ")),
+	store.SetVersion(Version)
+	if flagEvents != "" {
+		events.Version = Version
+		if err := events.Open(flagEvents, flagEventsFormat); err != nil {
+			fmt.Printf("ERROR: %v\n", err)
+			return 1
+		}
+		defer events.Close()
 	}
-	commands["version"] = &command{
-		fn: func() error {
-			fmt.Printf("%s\n", getVersion())
-			return nil
-		},
-		appfn: func(_ string) error {
-			return nil
-		},
-		help: getVersion(),
+	if flagNoSudo {
+		privilege.Disable()
 	}
-
-	// Run whatever function we've got here..
-	c, ok := commands[strings.ToLower(os.Args[1])]
-	if (!ok && calledHelp()) || c == nil { // sub-command wasn't found
-		fs.Usage()
-		os.Exit(1)
+	if flagDryRun {
+		store.EnableDryRun()
 	}
-	if ok && calledHelp() {
-		fmt.Println(c.help)
-		os.Exit(1)
+	if err := store.SetScope(flagScope); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return 1
 	}
-
-	// sub-command found, try and exec something off it
-	if flagApp != nil && *flagApp != "" {
-		err := c.appfn(*flagApp)
+	if err := setTimeOptions(); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return 1
+	}
+	if err := whitelist.SetLabels(flagLabels); err != nil {
+		fmt.Printf("ERROR: -labels: %v\n", err)
+		return 1
+	}
+	cosign.Required = cosign.Policy{
+		Key:      flagCosignKey,
+		Identity: flagCosignIdentity,
+		Issuer:   flagCosignIssuer,
+		Roots:    flagCosignRoots,
+		RekorKey: flagCosignRekorKey,
+	}
+	if flagKeychainPasswordStdin {
+		pass, err := readKeychainPassword(os.Stdin)
 		if err != nil {
 			fmt.Printf("ERROR: %v\n", err)
-			os.Exit(1)
+			return 1
+		}
+		store.UnlockKeychains(pass)
+	} else if flagUnlockKeychain {
+		store.UnlockKeychains("")
+	}
+	if flagIncludeSmartCards {
+		store.IncludeSmartCards()
+	}
+	if flagEnterpriseStores {
+		store.IncludeEnterpriseStores()
+	}
+	interrupt.Timeout = flagTimeout
+	interrupt.Notify()
+	httputil.Offline = flagOffline
+
+	// sub-command found, try and exec something off it
+	start := time.Now()
+	if flagApp != "" {
+		if c.appfn == nil {
+			err = fmt.Errorf("%s doesn't support -app", c.name)
+		} else {
+			err = c.appfn(flagApp, fs)
 		}
-		os.Exit(0)
+	} else {
+		err = c.fn(fs)
 	}
-	err := c.fn()
+	reportSkipped()
+	if err == errShowHelp {
+		c.printHelp(fs)
+		return 1
+	}
+	pushMetrics(c.name, time.Since(start), err == nil)
 	if err != nil {
 		fmt.Printf("ERROR: %v\n", err)
-		os.Exit(1)
 	}
-
-	// some flags can set callForHelp, so let's check again
-	if calledHelp() {
-		fmt.Println(c.help)
-		os.Exit(1)
+	if interrupt.Interrupted() {
+		return 130 // as shells report SIGINT
 	}
+	if err != nil {
+		return 1
+	}
+	return 0
 }
 
-func getVersion() string {
-	return fmt.Sprintf("%s (Go: %s)", Version, runtime.Version())
+// pushMetrics sends the run's results to -metrics-push, if given. Failing
+// to push doesn't fail the run.
+func pushMetrics(command string, took time.Duration, success bool) {
+	if flagMetricsPush == "" {
+		return
+	}
+	where := flagApp
+	if where == "" {
+		where = runtime.GOOS
+	}
+	run := metrics.Run{
+		Command:  command,
+		Store:    where,
+		Duration: took,
+		Success:  success,
+	}
+	if err := metrics.Push(flagMetricsPush, run); err != nil {
+		fmt.Printf("WARNING: pushing metrics to %s: %v\n", flagMetricsPush, err)
+	}
 }
 
-func parseConnectUrl(fs *flag.FlagSet) (*url.URL, error) {
-	if fs.NArg() != 1 {
-		return nil, fmt.Errorf("unknown arguments: %s", strings.Join(fs.Args(), ", "))
+// reportSkipped prints each operation which needed escalated privileges,
+// but wasn't ran because of -no-sudo.
+func reportSkipped() {
+	skipped := privilege.Skipped()
+	if len(skipped) == 0 {
+		return
+	}
+	fmt.Printf("WARNING: skipped %d operation(s) which required escalated privileges:\n", len(skipped))
+	for i := range skipped {
+		fmt.Printf("  %s\n", skipped[i])
 	}
+}
 
-	raw := fs.Arg(0)
-	if raw == "" {
-		return nil, errors.New("no url specified")
+// setTimeOptions applies -utc, -local and -time-format
+func setTimeOptions() error {
+	if flagUTC && flagLocal {
+		return errors.New("only one of -utc or -local can be given")
 	}
-	u, err := url.Parse(raw)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse %s: %v", raw, err)
+	if flagLocal {
+		timeutil.UseLocal()
+	} else {
+		timeutil.UseUTC()
+	}
+	return timeutil.SetFormat(flagTimeFormat)
+}
+
+// readKeychainPassword reads the first line of r, without its line ending. It's
+// read a byte at a time so the rest of stdin (e.g. 'add -file -' or restore's
+// prompt) is left for the command.
+func readKeychainPassword(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("error reading keychain password: %v", err)
+		}
 	}
-	if u.Scheme != "https" {
-		return nil, fmt.Errorf("non-secure url scheme used: %s", u.String())
+	pass := strings.TrimRight(string(line), "\r")
+	if pass == "" {
+		return "", errors.New("no keychain password given on stdin")
 	}
-	return u, nil
+	return pass, nil
+}
+
+func getVersion() string {
+	return fmt.Sprintf("%s (Go: %s)", Version, runtime.Version())
 }
@@ -0,0 +1,120 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMain__readKeychainPassword(t *testing.T) {
+	cases := map[string]string{
+		"secret\n":         "secret",
+		"secret\r\n":       "secret",
+		"secret":           "secret",
+		"two words\nxyz\n": "two words",
+	}
+	for in, expected := range cases {
+		pass, err := readKeychainPassword(strings.NewReader(in))
+		if err != nil {
+			t.Errorf("%q: %v", in, err)
+		}
+		if pass != expected {
+			t.Errorf("%q: got %q", in, pass)
+		}
+	}
+
+	if _, err := readKeychainPassword(strings.NewReader("\n")); err == nil {
+		t.Error("expected error")
+	}
+
+	// the rest of the input is left to be read
+	r := strings.NewReader("secret\n-----BEGIN CERTIFICATE-----\n")
+	if _, err := readKeychainPassword(r); err != nil {
+		t.Fatal(err)
+	}
+	if rest, _ := ioutil.ReadAll(r); string(rest) != "-----BEGIN CERTIFICATE-----\n" {
+		t.Errorf("got %q", rest)
+	}
+}
+
+func TestMain__out(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	where := filepath.Join(dir, "out.log")
+	defer func() { flagOutput = "-" }()
+
+	// before the sub-command, and after it for sub-commands without their own -out
+	if code := run([]string{"-out", where, "version"}); code != 0 {
+		t.Fatalf("got exit code %d", code)
+	}
+	if code := run([]string{"show", "-file", filepath.Join(dir, "missing.crt"), "-out", where}); code != 1 {
+		t.Fatalf("got exit code %d", code)
+	}
+	bs, err := ioutil.ReadFile(where)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(bs)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], Version) || !strings.HasPrefix(lines[1], "ERROR: ") {
+		t.Errorf("got %q", string(bs))
+	}
+}
+
+func TestMain__readToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(path, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	orig := flagTokenFile
+	defer func() {
+		flagTokenFile = orig
+		os.Unsetenv("CERT_MANAGE_TOKEN")
+	}()
+
+	os.Setenv("CERT_MANAGE_TOKEN", "from-env")
+	cases := map[string]string{
+		"":   "from-env",
+		"-":  "from-stdin",
+		path: "from-file",
+	}
+	for file, ans := range cases {
+		flagTokenFile = file
+		token, err := readToken(strings.NewReader("from-stdin\nmore\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != ans {
+			t.Errorf("-token-file %q: got %q", file, token)
+		}
+	}
+
+	os.Unsetenv("CERT_MANAGE_TOKEN")
+	flagTokenFile = ""
+	if _, err := readToken(strings.NewReader("")); err == nil {
+		t.Error("expected error")
+	}
+}
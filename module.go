@@ -0,0 +1,227 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/store"
+)
+
+var (
+	// moduleModifies are the sub-commands which change a store, their
+	// store is compared before and after to report if anything changed.
+	moduleModifies = map[string]bool{
+		"add":       true,
+		"blacklist": true,
+		"prune":     true,
+		"restore":   true,
+		"whitelist": true,
+	}
+)
+
+// moduleTask is the JSON read by -module, which are Ansible's module arguments
+//
+// https://docs.ansible.com/ansible/latest/dev_guide/developing_program_flow_modules.html
+type moduleTask struct {
+	Command string   `json:"command"`
+	App     string   `json:"app"`
+	File    string   `json:"file"`
+	Profile string   `json:"profile"`
+	DryRun  bool     `json:"dry_run"`
+	Args    []string `json:"args"`
+
+	// CheckMode is set by `ansible --check`, which runs with -dry-run
+	CheckMode bool `json:"_ansible_check_mode"`
+}
+
+// moduleResult is written as JSON, in the form Ansible expects from modules
+type moduleResult struct {
+	Changed     bool     `json:"changed"`
+	Failed      bool     `json:"failed"`
+	Msg         string   `json:"msg"`
+	RC          int      `json:"rc"`
+	Stdout      string   `json:"stdout"`
+	StdoutLines []string `json:"stdout_lines"`
+}
+
+// runModule runs a sub-command described by the JSON task in the file
+// args[0] (how Ansible runs binary modules) or stdin, writing the result as
+// JSON to stdout. All other output is captured into the result.
+func runModule(args []string) int {
+	in := io.Reader(os.Stdin)
+	if len(args) > 0 {
+		fd, err := os.Open(args[0])
+		if err != nil {
+			return writeModuleResult(os.Stdout, moduleResult{Failed: true, Msg: err.Error(), RC: 1})
+		}
+		defer fd.Close()
+		in = fd
+	}
+	return writeModuleResult(os.Stdout, module(in))
+}
+
+func module(r io.Reader) moduleResult {
+	var task moduleTask
+	if err := json.NewDecoder(r).Decode(&task); err != nil {
+		return moduleResult{Failed: true, Msg: fmt.Sprintf("invalid task: %v", err), RC: 1}
+	}
+	args, err := task.args()
+	if err != nil {
+		return moduleResult{Failed: true, Msg: err.Error(), RC: 1}
+	}
+	dryRun := task.DryRun || task.CheckMode
+
+	before := moduleStoreHash(task)
+	var code int
+	out, err := captureStdout(func() {
+		code = run(args)
+	})
+	if err != nil {
+		return moduleResult{Failed: true, Msg: err.Error(), RC: 1}
+	}
+
+	res := moduleResult{
+		Failed:      code != 0,
+		RC:          code,
+		Stdout:      out,
+		StdoutLines: strings.Split(strings.TrimRight(out, "\n"), "\n"),
+		Msg:         moduleMessage(out, code),
+	}
+	if !res.Failed && !dryRun {
+		switch {
+		case task.Command == "backup":
+			res.Changed = true
+		case moduleModifies[task.Command]:
+			res.Changed = before != moduleStoreHash(task)
+		}
+	}
+	return res
+}
+
+// args returns the command line for a task, which is checked before being
+// ran as invalid flags would exit with usage output.
+func (t moduleTask) args() ([]string, error) {
+	if t.Command == "" {
+		return nil, errors.New("no command given")
+	}
+	c := findCommand(t.Command)
+	if c == nil || c.hidden {
+		return nil, fmt.Errorf("unknown command %q", t.Command)
+	}
+
+	args := []string{t.Command}
+	if t.App != "" {
+		args = append(args, "-app", t.App)
+	}
+	if t.File != "" {
+		args = append(args, "-file", t.File)
+	}
+	if t.Profile != "" {
+		args = append(args, "-profile", t.Profile)
+	}
+	if t.DryRun || t.CheckMode {
+		args = append(args, "-dry-run")
+	}
+	// modules can't answer prompts
+	if t.Command == "restore" {
+		args = append(args, "-y")
+	}
+	args = append(args, t.Args...)
+
+	fs := c.flagSet()
+	fs.Init(c.name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	if err := fs.Parse(args[1:]); err != nil {
+		return nil, fmt.Errorf("invalid arguments for %s: %v", t.Command, err)
+	}
+	return args, nil
+}
+
+// moduleStoreHash returns a hash of the certificates trusted by the task's
+// store, or an empty string if they can't be read.
+func moduleStoreHash(t moduleTask) string {
+	if !moduleModifies[t.Command] {
+		return ""
+	}
+	s := store.Platform()
+	if t.App != "" {
+		var err error
+		s, err = store.ForApp(t.App)
+		if err != nil {
+			return ""
+		}
+	}
+	certs, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	if err != nil {
+		return ""
+	}
+	return store.HashCertificates(certs)
+}
+
+// moduleMessage is the error printed by run, or the last line of output
+func moduleMessage(out string, code int) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	for i := len(lines) - 1; code != 0 && i >= 0; i-- {
+		if strings.HasPrefix(lines[i], "ERROR: ") {
+			return strings.TrimPrefix(lines[i], "ERROR: ")
+		}
+	}
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// captureStdout runs fn with os.Stdout redirected, returning what was written
+func captureStdout(fn func()) (string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+	orig := os.Stdout
+	os.Stdout = w
+
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		io.Copy(&buf, r)
+		close(done)
+	}()
+
+	fn()
+	os.Stdout = orig
+	w.Close()
+	<-done
+	r.Close()
+	return buf.String(), nil
+}
+
+func writeModuleResult(w io.Writer, res moduleResult) int {
+	if res.StdoutLines == nil {
+		res.StdoutLines = []string{}
+	}
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		return 1
+	}
+	return res.RC
+}
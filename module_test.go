@@ -0,0 +1,92 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+func TestMain__module(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-module")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certs, err := certutil.FromFile("testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := filepath.Join(dir, "bundle.pem")
+	if err := certutil.ToFile(bundle, certs[:3]); err != nil {
+		t.Fatal(err)
+	}
+	wl := filepath.Join(dir, "whitelist.json")
+	if err := whitelist.FromCertificates(certs[:1]).ToFile(wl); err != nil {
+		t.Fatal(err)
+	}
+	app := "file:" + bundle
+	defer func() {
+		if s, err := store.ForApp(app); err == nil {
+			if latest, _ := s.GetLatestBackup(); latest != "" {
+				os.RemoveAll(filepath.Dir(latest))
+			}
+		}
+	}()
+
+	cases := []struct {
+		task    string
+		changed bool
+		failed  bool
+		msg     string
+	}{
+		{`{"command": "list", "app": "` + app + `", "args": ["-count"]}`, false, false, "3"},
+		{`{"command": "backup", "app": "` + app + `"}`, true, false, ""},
+		{`{"command": "whitelist", "app": "` + app + `", "file": "` + wl + `"}`, true, false, "Whitelist completed successfully"},
+		{`{"command": "whitelist", "app": "` + app + `", "file": "` + wl + `"}`, false, false, "Whitelist already applied, nothing changed (use -force to apply again)"},
+		{`{"command": "whitelist", "app": "` + app + `"}`, false, true, ""},
+		{`{"command": "whitelist", "args": ["-bogus"]}`, false, true, "invalid arguments for whitelist: flag provided but not defined: -bogus"},
+		{`{"command": "add", "app": "bogusapp", "file": "/nonexistent.pem"}`, false, true, "application \"bogusapp\" not found"},
+		{`{"command": "add", "app": "` + app + `", "file": "` + filepath.Join(dir, "nonexistent.pem") + `"}`, false, true, ""},
+		{`{"command": "list", "app": "bogusapp"}`, false, true, "application \"bogusapp\" not found"},
+		{`{"command": "nope"}`, false, true, "unknown command \"nope\""},
+		{`{"command": `, false, true, "invalid task: unexpected EOF"},
+	}
+	for i := range cases {
+		res := module(strings.NewReader(cases[i].task))
+		if res.Changed != cases[i].changed || res.Failed != cases[i].failed {
+			t.Errorf("%s: changed=%v failed=%v msg=%q\n%s", cases[i].task, res.Changed, res.Failed, res.Msg, res.Stdout)
+		}
+		if cases[i].msg != "" && res.Msg != cases[i].msg {
+			t.Errorf("%s: got msg %q", cases[i].task, res.Msg)
+		}
+	}
+
+	after, err := certutil.FromFile(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != 1 {
+		t.Errorf("expected whitelist to be applied, got %d certificates", len(after))
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/httputil"
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+)
+
+// fakeService is a Service with one group's policy
+type fakeService struct {
+	ca *CA
+
+	mu      sync.Mutex
+	reports map[string]*ReportStateRequest
+	results []ApplyResultRequest
+}
+
+func (s *fakeService) Enroll(req *EnrollRequest) (*EnrollResponse, error) {
+	if req.Token != "secret" {
+		return nil, ErrPermissionDenied
+	}
+	id := "agent-" + req.Hostname
+	cert, err := s.ca.Sign(req.CSR, id)
+	if err != nil {
+		return nil, err
+	}
+	return &EnrollResponse{
+		AgentID:      id,
+		Group:        req.Group,
+		Certificates: [][]byte{cert, s.ca.Certificate.Raw},
+	}, nil
+}
+
+func (s *fakeService) ReportState(id string, req *ReportStateRequest) (*ReportStateResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reports[id] = req
+	return &ReportStateResponse{}, nil
+}
+
+func (s *fakeService) FetchPolicy(id string, req *FetchPolicyRequest) (*FetchPolicyResponse, error) {
+	if req.Version == "v1" {
+		return &FetchPolicyResponse{Version: "v1", NotModified: true}, nil
+	}
+	return &FetchPolicyResponse{
+		Group:     "servers",
+		Version:   "v1",
+		Whitelist: []byte(`{"Fingerprints":["abc"]}`),
+		Interval:  60,
+	}, nil
+}
+
+func (s *fakeService) ApplyResult(id string, req *ApplyResultRequest) (*ApplyResultResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = append(s.results, *req)
+	return &ApplyResultResponse{}, nil
+}
+
+// newServer starts svc over TLS and returns it with a PEM file of its certificate
+func newServer(t *testing.T, dir string) (*httptest.Server, *fakeService) {
+	root, err := testca.NewRoot("agents", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := &fakeService{
+		ca:      &CA{root.Certificate, root.Key},
+		reports: make(map[string]*ReportStateRequest),
+	}
+	srv := httptest.NewUnstartedServer(NewHandler(svc))
+	cfg := ServerTLSConfig(tls.Certificate{}, root.Certificate)
+	cfg.Certificates = nil // use httptest's certificate
+	srv.TLS = cfg
+	srv.StartTLS()
+
+	var buf bytes.Buffer
+	pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(filepath.Join(dir, "server.pem"), buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return srv, svc
+}
+
+func TestAgent__enroll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv, svc := newServer(t, dir)
+	defer srv.Close()
+
+	client := &Client{
+		Dir:      filepath.Join(dir, "agent"),
+		Server:   srv.URL,
+		ServerCA: filepath.Join(dir, "server.pem"),
+	}
+	if err := client.Enroll("wrong", "servers"); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("expected permission denied, got %v", err)
+	}
+	if _, err := Load(client.Dir); err != ErrNotEnrolled {
+		t.Errorf("expected ErrNotEnrolled, got %v", err)
+	}
+	if err := client.Enroll("secret", "servers"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a new process only needs the directory
+	loaded, err := Load(client.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.AgentID != client.AgentID || loaded.Group != "servers" || loaded.Server != srv.URL {
+		t.Errorf("got %#v", loaded)
+	}
+	if loaded.ServerCA != filepath.Join(client.Dir, serverCAFile) {
+		t.Errorf("server CA wasn't kept: %q", loaded.ServerCA)
+	}
+	if err := loaded.ReportState(&ReportStateRequest{Hostname: "host", Stores: []StoreState{{Name: "linux"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if r := svc.reports[loaded.AgentID]; r == nil || len(r.Stores) != 1 || r.Stores[0].Name != "linux" {
+		t.Errorf("got %#v", r)
+	}
+}
+
+func TestAgent__clientCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv, _ := newServer(t, dir)
+	defer srv.Close()
+
+	// only Enroll can be called without a client certificate
+	resp, err := srv.Client().Post(srv.URL+PathFetchPolicy, "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got %s", resp.Status)
+	}
+}
+
+func TestAgent__policyCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv, svc := newServer(t, dir)
+	defer srv.Close()
+
+	client := &Client{
+		Dir:      filepath.Join(dir, "agent"),
+		Server:   srv.URL,
+		ServerCA: filepath.Join(dir, "server.pem"),
+	}
+	if err := client.Enroll("secret", "servers"); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := client.FetchPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.Version != "v1" || policy.Cached || string(policy.Whitelist) != `{"Fingerprints":["abc"]}` {
+		t.Errorf("got %#v", policy)
+	}
+
+	// unchanged, the server only says so
+	policy, err = client.FetchPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.Version != "v1" || policy.Interval != 60 || len(policy.Whitelist) == 0 {
+		t.Errorf("got %#v", policy)
+	}
+
+	// unreachable, the cache is used and results are kept
+	httputil.Offline = true
+	policy, err = client.FetchPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !policy.Cached || policy.Version != "v1" {
+		t.Errorf("got %#v", policy)
+	}
+	if err := client.ApplyResult(&ApplyResultRequest{Version: "v1", Store: "linux", Success: true}); err == nil {
+		t.Error("expected error")
+	}
+	httputil.Offline = false
+
+	if err := client.ApplyResult(&ApplyResultRequest{Version: "v1", Store: "java", Success: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(svc.results) != 2 || svc.results[0].Store != "linux" || svc.results[1].Store != "java" {
+		t.Errorf("got %#v", svc.results)
+	}
+	if _, err := os.Stat(filepath.Join(client.Dir, pendingFile)); !os.IsNotExist(err) {
+		t.Errorf("pending results weren't removed: %v", err)
+	}
+}
+
+func TestAgent__Sign(t *testing.T) {
+	root, err := testca.NewRoot("agents", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &CA{root.Certificate, root.Key}
+	if _, err := ca.Sign([]byte("junk"), "agent-1"); err == nil {
+		t.Error("expected error")
+	}
+
+	var req EnrollRequest
+	if err := json.Unmarshal([]byte(`{"csr":"AAAA"}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ca.Sign(req.CSR, ""); err == nil {
+		t.Error("expected error for no agent ID")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"time"
+)
+
+var (
+	// CertificateLifetime is how long agent certificates are valid
+	CertificateLifetime = 365 * 24 * time.Hour
+
+	serialLimit = new(big.Int).Lsh(big.NewInt(1), 128)
+)
+
+// CA issues the client certificates of enrolled agents
+type CA struct {
+	Certificate *x509.Certificate
+	Key         crypto.Signer
+}
+
+// Sign issues a client certificate for the key of csr (DER encoded) with
+// agentID as its CommonName. Anything else the CSR asks for is ignored.
+func (ca *CA) Sign(csr []byte, agentID string) ([]byte, error) {
+	if agentID == "" {
+		return nil, errors.New("no agent ID given")
+	}
+	req, err := x509.ParseCertificateRequest(csr)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.CheckSignature(); err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, serialLimit)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: agentID},
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     now.Add(CertificateLifetime),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	return x509.CreateCertificate(rand.Reader, tmpl, ca.Certificate, req.PublicKey, ca.Key)
+}
@@ -0,0 +1,396 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/httputil"
+)
+
+var (
+	// ErrNotEnrolled is returned for an agent directory Enroll hasn't been ran in
+	ErrNotEnrolled = errors.New("agent isn't enrolled, run 'cert-manage agent enroll' first")
+
+	maxResponseSize int64 = 10 * 1024 * 1024 // bytes
+
+	// maxPending is how many apply results are kept while the server can't
+	// be reached, the oldest are dropped beyond it
+	maxPending = 100
+)
+
+// Files kept in an agent's directory
+const (
+	configFile   = "agent.json"
+	keyFile      = "agent.key"
+	certFile     = "agent.crt"
+	serverCAFile = "server-ca.pem"
+	policyFile   = "policy.json"
+	pendingFile  = "pending.json"
+)
+
+// Client is an agent of a policy server. Its key, certificate and cached
+// policy are kept in Dir.
+type Client struct {
+	// Dir is the agent's directory, e.g. ~/.cert-manage/agent
+	Dir string
+
+	// Server is the policy server's URL, e.g. https://certs.internal:8443
+	Server string
+
+	// ServerCA is a PEM file of roots to trust for Server instead of the
+	// system's. Enroll copies it into Dir.
+	ServerCA string
+
+	// Labels of the host are sent when enrolling and fetching the policy,
+	// the server selects whitelist variants with them
+	Labels map[string]string
+
+	// AgentID and Group are set once enrolled
+	AgentID string
+	Group   string
+}
+
+// config is what's saved in configFile
+type config struct {
+	Server  string `json:"server"`
+	AgentID string `json:"agentId"`
+	Group   string `json:"group,omitempty"`
+}
+
+// Load returns the Client enrolled in dir, or ErrNotEnrolled
+func Load(dir string) (*Client, error) {
+	bs, err := ioutil.ReadFile(filepath.Join(dir, configFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotEnrolled
+		}
+		return nil, err
+	}
+	var cfg config
+	if err := json.Unmarshal(bs, &cfg); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", configFile, err)
+	}
+	c := &Client{
+		Dir:     dir,
+		Server:  cfg.Server,
+		AgentID: cfg.AgentID,
+		Group:   cfg.Group,
+	}
+	if _, err := os.Stat(filepath.Join(dir, serverCAFile)); err == nil {
+		c.ServerCA = filepath.Join(dir, serverCAFile)
+	}
+	return c, nil
+}
+
+// Enroll creates a key for the agent and exchanges token and a CSR for its
+// client certificate. Everything later calls need is saved in Dir, so the
+// agent can be loaded with Load afterwards.
+func (c *Client) Enroll(token, group string) error {
+	if c.Server == "" {
+		return errors.New("no policy server given")
+	}
+	if err := os.MkdirAll(c.Dir, file.TempDirPermissions); err != nil {
+		return err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	hostname, _ := os.Hostname()
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: hostname},
+	}, key)
+	if err != nil {
+		return err
+	}
+
+	roots, err := c.roots()
+	if err != nil {
+		return err
+	}
+	var resp EnrollResponse
+	req := &EnrollRequest{
+		Token:    token,
+		Group:    group,
+		Hostname: hostname,
+		OS:       runtime.GOOS,
+		CSR:      csr,
+		Labels:   c.Labels,
+	}
+	if err := c.call(httputil.WithRoots(roots), PathEnroll, req, &resp); err != nil {
+		return err
+	}
+	if resp.AgentID == "" || len(resp.Certificates) == 0 {
+		return errors.New("enroll: server returned no certificate")
+	}
+	cert, err := x509.ParseCertificate(resp.Certificates[0])
+	if err != nil {
+		return fmt.Errorf("enroll: %v", err)
+	}
+	if pub, ok := cert.PublicKey.(*ecdsa.PublicKey); !ok || pub.X.Cmp(key.X) != 0 || pub.Y.Cmp(key.Y) != 0 {
+		return errors.New("enroll: server returned a certificate for another key")
+	}
+
+	// save what later calls need
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := writePEM(filepath.Join(c.Dir, keyFile), "EC PRIVATE KEY", [][]byte{keyDER}); err != nil {
+		return err
+	}
+	if err := writePEM(filepath.Join(c.Dir, certFile), "CERTIFICATE", resp.Certificates); err != nil {
+		return err
+	}
+	if c.ServerCA != "" && c.ServerCA != filepath.Join(c.Dir, serverCAFile) {
+		bs, err := ioutil.ReadFile(c.ServerCA)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(c.Dir, serverCAFile), bs, file.TempFilePermissions); err != nil {
+			return err
+		}
+		c.ServerCA = filepath.Join(c.Dir, serverCAFile)
+	}
+	c.AgentID, c.Group = resp.AgentID, resp.Group
+	if c.Group == "" {
+		c.Group = group
+	}
+	os.Remove(filepath.Join(c.Dir, policyFile))
+	return writeJSON(filepath.Join(c.Dir, configFile), config{
+		Server:  c.Server,
+		AgentID: c.AgentID,
+		Group:   c.Group,
+	})
+}
+
+// ReportState sends what the agent's stores trust
+func (c *Client) ReportState(req *ReportStateRequest) error {
+	client, err := c.httpClient()
+	if err != nil {
+		return err
+	}
+	return c.call(client, PathReportState, req, &ReportStateResponse{})
+}
+
+// FetchPolicy returns the agent's policy. The last policy fetched is cached
+// and returned (with Cached set) when the server can't be reached, so agents
+// keep enforcing it while offline.
+func (c *Client) FetchPolicy() (*FetchPolicyResponse, error) {
+	cached, err := c.cachedPolicy()
+	if err != nil {
+		return nil, err
+	}
+	client, err := c.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	req := &FetchPolicyRequest{
+		Labels: c.Labels,
+	}
+	if cached != nil {
+		req.Version = cached.Version
+	}
+	var resp FetchPolicyResponse
+	if err := c.call(client, PathFetchPolicy, req, &resp); err != nil {
+		if cached != nil && isUnreachable(err) {
+			cached.Cached = true
+			return cached, nil
+		}
+		return nil, err
+	}
+	if resp.NotModified && cached != nil {
+		if resp.Interval != 0 {
+			cached.Interval = resp.Interval
+		}
+		return cached, nil
+	}
+	if len(resp.Whitelist) == 0 {
+		return nil, errors.New("fetch policy: server returned no whitelist")
+	}
+	if err := writeJSON(filepath.Join(c.Dir, policyFile), resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ApplyResult sends the outcome of applying a policy. Results which can't be
+// sent are kept and sent before the next one.
+func (c *Client) ApplyResult(req *ApplyResultRequest) error {
+	pending, err := c.pending()
+	if err != nil {
+		return err
+	}
+	pending = append(pending, *req)
+	if len(pending) > maxPending {
+		pending = pending[len(pending)-maxPending:]
+	}
+
+	client, err := c.httpClient()
+	if err != nil {
+		return err
+	}
+	for len(pending) > 0 {
+		if err = c.call(client, PathApplyResult, &pending[0], &ApplyResultResponse{}); err != nil {
+			break
+		}
+		pending = pending[1:]
+	}
+	if len(pending) == 0 {
+		os.Remove(filepath.Join(c.Dir, pendingFile))
+		return nil
+	}
+	if werr := writeJSON(filepath.Join(c.Dir, pendingFile), pending); werr != nil {
+		return werr
+	}
+	return fmt.Errorf("%v (%d result(s) kept to send later)", err, len(pending))
+}
+
+func (c *Client) cachedPolicy() (*FetchPolicyResponse, error) {
+	bs, err := ioutil.ReadFile(filepath.Join(c.Dir, policyFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var resp FetchPolicyResponse
+	if err := json.Unmarshal(bs, &resp); err != nil {
+		return nil, fmt.Errorf("reading cached policy: %v", err)
+	}
+	return &resp, nil
+}
+
+func (c *Client) pending() ([]ApplyResultRequest, error) {
+	bs, err := ioutil.ReadFile(filepath.Join(c.Dir, pendingFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var out []ApplyResultRequest
+	if err := json.Unmarshal(bs, &out); err != nil {
+		return nil, fmt.Errorf("reading pending results: %v", err)
+	}
+	return out, nil
+}
+
+// roots returns the pool Server is verified with, nil for the system's
+func (c *Client) roots() (*x509.CertPool, error) {
+	if c.ServerCA == "" {
+		return nil, nil
+	}
+	certs, err := certutil.FromFile(c.ServerCA)
+	if err != nil {
+		return nil, fmt.Errorf("reading server CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	for i := range certs {
+		pool.AddCert(certs[i])
+	}
+	return pool, nil
+}
+
+// httpClient returns a client presenting the agent's certificate
+func (c *Client) httpClient() (*http.Client, error) {
+	if c.AgentID == "" {
+		return nil, ErrNotEnrolled
+	}
+	cert, err := tls.LoadX509KeyPair(filepath.Join(c.Dir, certFile), filepath.Join(c.Dir, keyFile))
+	if err != nil {
+		return nil, fmt.Errorf("loading agent certificate: %v", err)
+	}
+	roots, err := c.roots()
+	if err != nil {
+		return nil, err
+	}
+	return httputil.WithClientCertificate(roots, cert), nil
+}
+
+// call POSTs req to path and decodes the response into resp
+func (c *Client) call(client *http.Client, path string, req, resp interface{}) error {
+	bs, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	u := strings.TrimSuffix(c.Server, "/") + path
+	r, err := client.Post(u, "application/json", bytes.NewReader(bs))
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if r.StatusCode != http.StatusOK {
+		var e errorResponse
+		if json.Unmarshal(body, &e) == nil && e.Error != "" {
+			return fmt.Errorf("%s: %s", path, e.Error)
+		}
+		return fmt.Errorf("%s: unexpected status %s", path, r.Status)
+	}
+	if err := json.Unmarshal(body, resp); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// isUnreachable returns true for errors reaching the server (including
+// -offline), rather than errors it returned
+func isUnreachable(err error) bool {
+	_, ok := err.(*url.Error)
+	return ok
+}
+
+func writePEM(path, typ string, blocks [][]byte) error {
+	var buf bytes.Buffer
+	for i := range blocks {
+		if err := pem.Encode(&buf, &pem.Block{Type: typ, Bytes: blocks[i]}); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), file.TempFilePermissions)
+}
+
+func writeJSON(path string, v interface{}) error {
+	bs, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bs, file.TempFilePermissions)
+}
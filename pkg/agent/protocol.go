@@ -0,0 +1,130 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package agent is the protocol between cert-manage agents and a central
+// policy server, which hands each group of agents a whitelist and collects
+// what their stores trust.
+//
+// The protocol is JSON over HTTPS: each call is a POST of its request to its
+// path below, answered with the response (or an error) as JSON. Enroll is the
+// only call which doesn't need a client certificate, every other call is
+// authenticated with the certificate Enroll returned and the agent is
+// identified by its CommonName.
+package agent
+
+import (
+	"time"
+)
+
+const (
+	// PathPrefix is the version of the protocol, every path starts with it
+	PathPrefix = "/v1/agent/"
+
+	// PathEnroll exchanges an enrollment token and CSR for a client certificate
+	PathEnroll = PathPrefix + "enroll"
+
+	// PathReportState sends what the agent's stores currently trust
+	PathReportState = PathPrefix + "state"
+
+	// PathFetchPolicy returns the whitelist for the agent's group
+	PathFetchPolicy = PathPrefix + "policy"
+
+	// PathApplyResult records the outcome of applying a policy
+	PathApplyResult = PathPrefix + "result"
+)
+
+// The JSON of the messages below uses camelCase names, base64 for bytes and
+// RFC 3339 timestamps.
+
+type EnrollRequest struct {
+	Token    string `json:"token,omitempty"`
+	Group    string `json:"group,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	OS       string `json:"os,omitempty"`
+
+	// CSR is a DER encoded PKCS#10 request for the agent's key
+	CSR []byte `json:"csr,omitempty"`
+
+	// Labels of the host (see -labels), which select whitelist variants
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type EnrollResponse struct {
+	AgentID string `json:"agentId,omitempty"`
+	Group   string `json:"group,omitempty"`
+
+	// Certificates are the DER encoded client certificate followed by its issuers
+	Certificates [][]byte `json:"certificates,omitempty"`
+}
+
+// StoreState is what a store trusts, see store.State
+type StoreState struct {
+	Name string `json:"name,omitempty"`
+
+	// Whitelist is the SHA256 of the applied whitelist, empty if none has been applied
+	Whitelist string `json:"whitelist,omitempty"`
+
+	// Fingerprints are the SHA256 fingerprints of the trusted certificates
+	Fingerprints []string `json:"fingerprints,omitempty"`
+
+	Applied *time.Time `json:"applied,omitempty"`
+
+	// Error is set if the store couldn't be read
+	Error string `json:"error,omitempty"`
+}
+
+type ReportStateRequest struct {
+	Hostname string       `json:"hostname,omitempty"`
+	OS       string       `json:"os,omitempty"`
+	Version  string       `json:"version,omitempty"`
+	Stores   []StoreState `json:"stores,omitempty"`
+}
+
+type ReportStateResponse struct{}
+
+type FetchPolicyRequest struct {
+	// Version of the policy the agent has cached, if any
+	Version string `json:"version,omitempty"`
+
+	// Labels of the host, they can change after enrolling
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type FetchPolicyResponse struct {
+	Group   string `json:"group,omitempty"`
+	Version string `json:"version,omitempty"`
+
+	// NotModified is set when Version matches the request, Whitelist is left out
+	NotModified bool `json:"notModified,omitempty"`
+
+	// Whitelist is the group's whitelist as JSON
+	Whitelist []byte `json:"whitelist,omitempty"`
+
+	// Interval is how often the agent should check in, in seconds
+	Interval int32 `json:"interval,omitempty"`
+
+	// Cached is set by Client.FetchPolicy when the server couldn't be reached
+	// and the policy was read from the agent's cache
+	Cached bool `json:"-"`
+}
+
+type ApplyResultRequest struct {
+	Version string     `json:"version,omitempty"`
+	Store   string     `json:"store,omitempty"`
+	Success bool       `json:"success,omitempty"`
+	Error   string     `json:"error,omitempty"`
+	Applied *time.Time `json:"applied,omitempty"`
+}
+
+type ApplyResultResponse struct{}
@@ -0,0 +1,156 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+var (
+	// ErrPermissionDenied is returned by a Service for a bad enrollment
+	// token, or an agent which isn't (or is no longer) enrolled
+	ErrPermissionDenied = errors.New("permission denied")
+
+	// ErrUnauthenticated is returned for RPCs made without a client certificate
+	ErrUnauthenticated = errors.New("client certificate required")
+
+	maxRequestSize int64 = 10 * 1024 * 1024 // bytes
+)
+
+// Service is implemented by policy servers. Besides Enroll each method is
+// given the ID of the agent calling it, read from its client certificate.
+type Service interface {
+	Enroll(req *EnrollRequest) (*EnrollResponse, error)
+	ReportState(agentID string, req *ReportStateRequest) (*ReportStateResponse, error)
+	FetchPolicy(agentID string, req *FetchPolicyRequest) (*FetchPolicyResponse, error)
+	ApplyResult(agentID string, req *ApplyResultRequest) (*ApplyResultResponse, error)
+}
+
+// NewHandler serves svc on the paths of the protocol (see PathPrefix). It has to be
+// served over TLS with a config from ServerTLSConfig so client certificates
+// are verified.
+func NewHandler(svc Service) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(PathEnroll, func(w http.ResponseWriter, r *http.Request) {
+		var req EnrollRequest
+		if !decode(w, r, &req) {
+			return
+		}
+		resp, err := svc.Enroll(&req)
+		encode(w, resp, err)
+	})
+	mux.HandleFunc(PathReportState, func(w http.ResponseWriter, r *http.Request) {
+		var req ReportStateRequest
+		id, ok := authenticate(w, r)
+		if !ok || !decode(w, r, &req) {
+			return
+		}
+		resp, err := svc.ReportState(id, &req)
+		encode(w, resp, err)
+	})
+	mux.HandleFunc(PathFetchPolicy, func(w http.ResponseWriter, r *http.Request) {
+		var req FetchPolicyRequest
+		id, ok := authenticate(w, r)
+		if !ok || !decode(w, r, &req) {
+			return
+		}
+		resp, err := svc.FetchPolicy(id, &req)
+		encode(w, resp, err)
+	})
+	mux.HandleFunc(PathApplyResult, func(w http.ResponseWriter, r *http.Request) {
+		var req ApplyResultRequest
+		id, ok := authenticate(w, r)
+		if !ok || !decode(w, r, &req) {
+			return
+		}
+		resp, err := svc.ApplyResult(id, &req)
+		encode(w, resp, err)
+	})
+	return mux
+}
+
+// ServerTLSConfig returns a TLS config serving cert which asks agents for a
+// client certificate issued by ca. Clients without one can only Enroll.
+func ServerTLSConfig(cert tls.Certificate, ca *x509.Certificate) *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// authenticate returns the agent ID of the verified client certificate
+func authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		writeError(w, http.StatusUnauthorized, ErrUnauthenticated)
+		return "", false
+	}
+	id := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if id == "" {
+		writeError(w, http.StatusUnauthorized, ErrUnauthenticated)
+		return "", false
+	}
+	return id, true
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return false
+	}
+	bs, err := ioutil.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err == nil {
+		err = json.Unmarshal(bs, v)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+func encode(w http.ResponseWriter, resp interface{}, err error) {
+	if err != nil {
+		code := http.StatusInternalServerError
+		if err == ErrPermissionDenied {
+			code = http.StatusForbidden
+		}
+		writeError(w, code, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// errorResponse is the body of failed RPCs
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(errorResponse{err.Error()})
+}
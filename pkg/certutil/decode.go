@@ -26,6 +26,7 @@ type decoder func([]byte) ([]*x509.Certificate, error)
 var (
 	decoders = []decoder{
 		ParsePEM,
+		x509.ParseCertificates, // DER, one or more concatenated
 		readNSSCerts,
 	}
 )
@@ -0,0 +1,65 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certutil
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+)
+
+// Dedup returns certs without duplicates (the same DER), keeping the first
+// of each in order. nil certificates are dropped.
+func Dedup(certs []*x509.Certificate) []*x509.Certificate {
+	seen := make(map[[sha256.Size]byte]bool, len(certs))
+	var out []*x509.Certificate
+	for i := range certs {
+		if certs[i] == nil {
+			continue
+		}
+		sum := sha256.Sum256(certs[i].Raw)
+		if seen[sum] {
+			continue
+		}
+		seen[sum] = true
+		out = append(out, certs[i])
+	}
+	return out
+}
+
+// SameKeyGroups returns groups of (distinct) certificates which share a
+// SubjectPublicKeyInfo. These are one CA under several certificates, which
+// happens when it's cross-signed by another root or reissued (e.g. with a new
+// expiration). Only groups of two or more are returned, in the order their
+// first certificate appears.
+func SameKeyGroups(certs []*x509.Certificate) [][]*x509.Certificate {
+	index := make(map[[sha256.Size]byte]int)
+	var groups [][]*x509.Certificate
+	for _, c := range Dedup(certs) {
+		key := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+		if i, ok := index[key]; ok {
+			groups[i] = append(groups[i], c)
+			continue
+		}
+		index[key] = len(groups)
+		groups = append(groups, []*x509.Certificate{c})
+	}
+	var out [][]*x509.Certificate
+	for i := range groups {
+		if len(groups[i]) > 1 {
+			out = append(out, groups[i])
+		}
+	}
+	return out
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certutil
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+)
+
+func TestCertutil__Dedup(t *testing.T) {
+	certs, err := FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// copies are parsed separately, so they're only equal by DER
+	copies, err := FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := Dedup(append(append(certs, nil), copies...))
+	if len(out) != len(certs) {
+		t.Fatalf("got %d certificates", len(out))
+	}
+	for i := range out {
+		if out[i] != certs[i] {
+			t.Errorf("%d: order changed", i)
+		}
+	}
+}
+
+func TestCertutil__SameKeyGroups(t *testing.T) {
+	certs, err := FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groups := SameKeyGroups(certs); len(groups) != 0 {
+		t.Errorf("got %d groups", len(groups))
+	}
+
+	old, err := testca.NewRoot("Old Root", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := testca.NewRoot("New Root", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cross, err := old.CrossSign(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all := append([]*x509.Certificate{root.Certificate, old.Certificate, cross, root.Certificate}, certs...)
+	groups := SameKeyGroups(all)
+	if len(groups) != 1 || len(groups[0]) != 2 {
+		t.Fatalf("got %v", groups)
+	}
+	if groups[0][0] != root.Certificate || groups[0][1] != cross {
+		t.Error("unexpected group")
+	}
+}
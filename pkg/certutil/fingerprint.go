@@ -0,0 +1,114 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certutil
+
+import (
+	"crypto/x509"
+	"runtime"
+	"sync"
+)
+
+var (
+	// Workers is how many goroutines ForEach uses
+	Workers = runtime.NumCPU()
+
+	// Stores, whitelists and printing each fingerprint the same certificates,
+	// so they're only hashed once.
+	sha1Fingerprints   = newFingerprintCache()
+	sha256Fingerprints = newFingerprintCache()
+
+	// maxCachedFingerprints bounds the memory of each cache, it's larger
+	// than any store we've seen.
+	maxCachedFingerprints = 20000
+
+	// parallelThreshold is how many items are needed before ForEach uses
+	// goroutines, below it they aren't worth starting.
+	parallelThreshold = 64
+)
+
+type fingerprintCache struct {
+	mu sync.RWMutex // protects fingerprints
+
+	// fingerprints is keyed by certificate DER
+	fingerprints map[string]string
+}
+
+func newFingerprintCache() *fingerprintCache {
+	return &fingerprintCache{
+		fingerprints: make(map[string]string),
+	}
+}
+
+func (c *fingerprintCache) get(raw []byte, compute func([]byte) string) string {
+	c.mu.RLock()
+	fp, ok := c.fingerprints[string(raw)]
+	c.mu.RUnlock()
+	if ok {
+		return fp
+	}
+
+	fp = compute(raw)
+	c.mu.Lock()
+	if len(c.fingerprints) >= maxCachedFingerprints {
+		c.fingerprints = make(map[string]string)
+	}
+	c.fingerprints[string(raw)] = fp
+	c.mu.Unlock()
+	return fp
+}
+
+// PrecomputeFingerprints hashes each certificate (SHA1 and SHA256) in
+// parallel, so later fingerprints of them are cached.
+func PrecomputeFingerprints(certs []*x509.Certificate) {
+	ForEach(len(certs), func(i int) {
+		if certs[i] == nil || len(certs[i].Raw) == 0 {
+			return
+		}
+		GetHexSHA1Fingerprint(*certs[i])
+		GetHexSHA256Fingerprint(*certs[i])
+	})
+}
+
+// ForEach calls fn with 0 through n-1 over a pool of (at most) Workers
+// goroutines and returns once every call has.
+func ForEach(n int, fn func(i int)) {
+	workers := Workers
+	if workers > n {
+		workers = n
+	}
+	if n < parallelThreshold || workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCertutil__fingerprintCache(t *testing.T) {
+	c := newFingerprintCache()
+	calls := 0
+	compute := func(raw []byte) string {
+		calls++
+		sum := sha256.Sum256(raw)
+		return hex.EncodeToString(sum[:])
+	}
+	first := c.get([]byte("a"), compute)
+	if second := c.get([]byte("a"), compute); first != second || calls != 1 {
+		t.Errorf("calls=%d first=%s second=%s", calls, first, second)
+	}
+	if c.get([]byte("b"), compute) == first || calls != 2 {
+		t.Errorf("calls=%d", calls)
+	}
+
+	// the cache is bounded
+	defer func(n int) { maxCachedFingerprints = n }(maxCachedFingerprints)
+	maxCachedFingerprints = 2
+	c.get([]byte("c"), compute)
+	if len(c.fingerprints) != 1 {
+		t.Errorf("got %d cached fingerprints", len(c.fingerprints))
+	}
+}
+
+func TestCertutil__ForEach(t *testing.T) {
+	for _, n := range []int{0, 1, parallelThreshold - 1, 1000} {
+		seen := make([]int32, n)
+		var calls int32
+		ForEach(n, func(i int) {
+			atomic.AddInt32(&seen[i], 1)
+			atomic.AddInt32(&calls, 1)
+		})
+		if int(calls) != n {
+			t.Errorf("n=%d: got %d calls", n, calls)
+		}
+		for i := range seen {
+			if seen[i] != 1 {
+				t.Fatalf("n=%d: %d was called %d times", n, i, seen[i])
+			}
+		}
+	}
+}
+
+func TestCertutil__PrecomputeFingerprints(t *testing.T) {
+	certs, err := FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	PrecomputeFingerprints(append(certs, nil))
+	for i := range certs {
+		sha256Fingerprints.mu.RLock()
+		fp, ok := sha256Fingerprints.fingerprints[string(certs[i].Raw)]
+		sha256Fingerprints.mu.RUnlock()
+		if !ok || fp != GetHexSHA256Fingerprint(*certs[i]) {
+			t.Errorf("%d wasn't cached", i)
+		}
+	}
+}
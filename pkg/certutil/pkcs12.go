@@ -15,30 +15,591 @@
 package certutil
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/x509"
-	// "errors"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+)
+
+// golang.org/x/crypto/pkcs12 only reads files with exactly one certificate
+// and private key, but roots are usually distributed in PKCS#12 files with
+// only certificates (https://github.com/golang/go/issues/23499). So certificate
+// bags are read (and written) here instead.
+
+var (
+	// ErrPKCS12Password is returned when the password of a PKCS#12 file is wrong
+	ErrPKCS12Password = errors.New("pkcs12: incorrect password")
+
+	oidDataContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedDataContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+
+	oidCertBag             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidCertTypeX509        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidFriendlyName        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidJavaTrustedKeyUsage = asn1.ObjectIdentifier{2, 16, 840, 1, 113894, 746875, 1, 1}
+	oidAnyExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37, 0}
 
-	"golang.org/x/crypto/pkcs12"
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+
+	oidPBEWithSHAAnd3KeyTripleDESCBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidPBEWithSHAAnd40BitRC2CBC      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 6}
+	oidPBES2                         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2                        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1                  = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256                = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC                     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC                     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC                     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+
+	pkcs12MacIterations = 2048
+
+	// maxPKCS12Iterations caps the iterations read from a file, as each
+	// one is a hash computed before the password can be checked
+	maxPKCS12Iterations = 1 << 21
 )
 
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// DecodePKCS12 returns the first certificate of a PKCS#12 (.p12 or .pfx) file
 func DecodePKCS12(bs []byte, pass string) (*x509.Certificate, error) {
-	_, cert, err := pkcs12.Decode(bs, pass)
-	return cert, err
-
-	// TODO(adam): https://github.com/golang/go/issues/23499
-	// out, err := pkcs12.ToPEM(bs, pass)
-	// if err != nil {
-	// 	return nil, err
-	// }
-	// if out == nil {
-	// 	return nil, errors.New("empty pem block")
-	// }
-	// if len(out) > 0 {
-	// 	p, err := Parse(out[0].Bytes)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-	// 	return p[0], nil
-	// }
-	// return nil, nil
+	certs, err := DecodePKCS12Certificates(bs, pass)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("pkcs12: no certificates found")
+	}
+	return certs[0], nil
+}
+
+// PKCS12Entry is a certificate of a PKCS#12 file and its friendly name, which
+// Java uses as the alias.
+type PKCS12Entry struct {
+	Name string
+	Cert *x509.Certificate
+}
+
+// DecodePKCS12Certificates returns every certificate in a PKCS#12 (.p12 or
+// .pfx) file, private keys are ignored. ErrPKCS12Password is returned if the
+// password is wrong.
+func DecodePKCS12Certificates(bs []byte, pass string) ([]*x509.Certificate, error) {
+	entries, _, err := DecodePKCS12Entries(bs, pass)
+	if err != nil {
+		return nil, err
+	}
+	certs := make([]*x509.Certificate, len(entries))
+	for i := range entries {
+		certs[i] = entries[i].Cert
+	}
+	return certs, nil
+}
+
+// DecodePKCS12Entries returns every certificate bag in a PKCS#12 file along
+// with how many other bags (e.g. private keys) were skipped.
+func DecodePKCS12Entries(bs []byte, pass string) ([]PKCS12Entry, int, error) {
+	var pfx pfxPdu
+	if rest, err := asn1.Unmarshal(bs, &pfx); err != nil || len(rest) > 0 {
+		return nil, 0, fmt.Errorf("pkcs12: not a PKCS#12 file: %v", err)
+	}
+	if pfx.Version != 3 {
+		return nil, 0, fmt.Errorf("pkcs12: unsupported version %d", pfx.Version)
+	}
+	if !pfx.AuthSafe.ContentType.Equal(oidDataContentType) {
+		return nil, 0, errors.New("pkcs12: only password integrity is supported")
+	}
+	var authSafe []byte
+	if _, err := asn1.Unmarshal(pfx.AuthSafe.Content.Bytes, &authSafe); err != nil {
+		return nil, 0, fmt.Errorf("pkcs12: error reading authenticated safe: %v", err)
+	}
+
+	// Empty passwords are encoded as two zero bytes by some tools and as
+	// nothing by others (e.g. Windows), try both.
+	password, err := bmpString(pass)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(pfx.MacData.Mac.Algorithm.Algorithm) > 0 {
+		err := verifyPKCS12Mac(&pfx.MacData, authSafe, password)
+		if err == ErrPKCS12Password && pass == "" {
+			password = nil
+			err = verifyPKCS12Mac(&pfx.MacData, authSafe, password)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var infos []contentInfo
+	if _, err := asn1.Unmarshal(authSafe, &infos); err != nil {
+		return nil, 0, fmt.Errorf("pkcs12: error reading content: %v", err)
+	}
+	var entries []PKCS12Entry
+	other := 0
+	for i := range infos {
+		var data []byte
+		switch {
+		case infos[i].ContentType.Equal(oidDataContentType):
+			if _, err := asn1.Unmarshal(infos[i].Content.Bytes, &data); err != nil {
+				return nil, 0, fmt.Errorf("pkcs12: error reading data: %v", err)
+			}
+		case infos[i].ContentType.Equal(oidEncryptedDataContentType):
+			var ed encryptedData
+			if _, err := asn1.Unmarshal(infos[i].Content.Bytes, &ed); err != nil {
+				return nil, 0, fmt.Errorf("pkcs12: error reading encrypted data: %v", err)
+			}
+			data, err = pkcs12Decrypt(ed.EncryptedContentInfo, pass, password)
+			if err != nil {
+				return nil, 0, err
+			}
+		default:
+			other++ // e.g. public key protected (enveloped) data
+			continue
+		}
+
+		var bags []safeBag
+		if _, err := asn1.Unmarshal(data, &bags); err != nil {
+			return nil, 0, fmt.Errorf("pkcs12: error reading safe contents: %v", err)
+		}
+		for j := range bags {
+			if !bags[j].ID.Equal(oidCertBag) {
+				other++
+				continue
+			}
+			var cb certBag
+			if _, err := asn1.Unmarshal(bags[j].Value.Bytes, &cb); err != nil {
+				return nil, 0, fmt.Errorf("pkcs12: error reading certificate bag: %v", err)
+			}
+			if !cb.ID.Equal(oidCertTypeX509) {
+				other++
+				continue
+			}
+			cert, err := x509.ParseCertificate(cb.Data)
+			if err != nil {
+				return nil, 0, err
+			}
+			entries = append(entries, PKCS12Entry{
+				Name: friendlyName(bags[j].Attributes),
+				Cert: cert,
+			})
+		}
+	}
+	return entries, other, nil
+}
+
+func friendlyName(attrs []pkcs12Attribute) string {
+	for i := range attrs {
+		if !attrs[i].ID.Equal(oidFriendlyName) {
+			continue
+		}
+		var name asn1.RawValue
+		if _, err := asn1.Unmarshal(attrs[i].Value.Bytes, &name); err != nil || name.Tag != asn1.TagBMPString {
+			return ""
+		}
+		return decodeBMPString(name.Bytes)
+	}
+	return ""
+}
+
+// EncodePKCS12 writes certs into a PKCS#12 file protected (for integrity
+// only, certificates aren't secret) by password. Each certificate is marked
+// as trusted for Java's keytool.
+func EncodePKCS12(certs []*x509.Certificate, pass string) ([]byte, error) {
+	entries := make([]PKCS12Entry, len(certs))
+	for i := range certs {
+		entries[i] = PKCS12Entry{
+			Name: StringifyPKIXName(certs[i].Subject),
+			Cert: certs[i],
+		}
+	}
+	return EncodePKCS12Entries(entries, pass)
+}
+
+// EncodePKCS12Entries is EncodePKCS12 with the friendly name of each
+// certificate given.
+func EncodePKCS12Entries(entries []PKCS12Entry, pass string) ([]byte, error) {
+	var bags []safeBag
+	for i := range entries {
+		value, err := asn1.Marshal(certBag{
+			ID:   oidCertTypeX509,
+			Data: entries[i].Cert.Raw,
+		})
+		if err != nil {
+			return nil, err
+		}
+		name, err := bmpString(entries[i].Name)
+		if err != nil {
+			name, _ = bmpString(GetHexSHA256Fingerprint(*entries[i].Cert))
+		}
+		friendlyName, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagBMPString, Bytes: name[:len(name)-2]})
+		if err != nil {
+			return nil, err
+		}
+		usage, err := asn1.Marshal(oidAnyExtendedKeyUsage)
+		if err != nil {
+			return nil, err
+		}
+		bags = append(bags, safeBag{
+			ID:    oidCertBag,
+			Value: explicitTag(value),
+			Attributes: []pkcs12Attribute{
+				{ID: oidFriendlyName, Value: asn1Set(friendlyName)},
+				{ID: oidJavaTrustedKeyUsage, Value: asn1Set(usage)},
+			},
+		})
+	}
+	contents, err := asn1.Marshal(bags)
+	if err != nil {
+		return nil, err
+	}
+	authSafe, err := asn1.Marshal([]contentInfo{dataContentInfo(contents)})
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := bmpString(pass)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	md := macData{
+		Mac: digestInfo{
+			Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+		},
+		MacSalt:    salt,
+		Iterations: pkcs12MacIterations,
+	}
+	md.Mac.Digest = pkcs12Mac(sha256.New, salt, password, authSafe, pkcs12MacIterations)
+
+	return asn1.Marshal(pfxPdu{
+		Version:  3,
+		AuthSafe: dataContentInfo(authSafe),
+		MacData:  md,
+	})
+}
+
+func dataContentInfo(data []byte) contentInfo {
+	octets, _ := asn1.Marshal(data)
+	return contentInfo{
+		ContentType: oidDataContentType,
+		Content:     explicitTag(octets),
+	}
+}
+
+// explicitTag wraps inner in [0], asn1.Marshal ignores struct tags on RawValue
+func explicitTag(inner []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: inner}
+}
+
+func asn1Set(inner []byte) asn1.RawValue {
+	return asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: inner}
+}
+
+func verifyPKCS12Mac(md *macData, message, password []byte) error {
+	var h func() hash.Hash
+	switch {
+	case md.Mac.Algorithm.Algorithm.Equal(oidSHA1):
+		h = sha1.New
+	case md.Mac.Algorithm.Algorithm.Equal(oidSHA256):
+		h = sha256.New
+	default:
+		return fmt.Errorf("pkcs12: unsupported MAC algorithm %v", md.Mac.Algorithm.Algorithm)
+	}
+	if err := checkPKCS12Iterations(md.Iterations); err != nil {
+		return err
+	}
+	expected := pkcs12Mac(h, md.MacSalt, password, message, md.Iterations)
+	if !hmac.Equal(expected, md.Mac.Digest) {
+		return ErrPKCS12Password
+	}
+	return nil
+}
+
+// checkPKCS12Iterations refuses iteration counts which are invalid or would
+// take too long to compute
+func checkPKCS12Iterations(n int) error {
+	if n < 1 || n > maxPKCS12Iterations {
+		return fmt.Errorf("pkcs12: unsupported iteration count %d", n)
+	}
+	return nil
+}
+
+func pkcs12Mac(h func() hash.Hash, salt, password, message []byte, iterations int) []byte {
+	size := h().Size()
+	key := pkcs12KDF(h, 64, salt, password, iterations, 3, size)
+	mac := hmac.New(h, key)
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+// pkcs12Decrypt decrypts password protected content. Legacy PBE (3DES) uses
+// the BMP encoded password and PBES2 the UTF-8 password.
+func pkcs12Decrypt(info encryptedContentInfo, pass string, password []byte) ([]byte, error) {
+	alg := info.ContentEncryptionAlgorithm
+	var block cipher.Block
+	var iv []byte
+	switch {
+	case alg.Algorithm.Equal(oidPBEWithSHAAnd3KeyTripleDESCBC):
+		var params pbeParams
+		if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+			return nil, err
+		}
+		if err := checkPKCS12Iterations(params.Iterations); err != nil {
+			return nil, err
+		}
+		key := pkcs12KDF(sha1.New, 64, params.Salt, password, params.Iterations, 1, 24)
+		iv = pkcs12KDF(sha1.New, 64, params.Salt, password, params.Iterations, 2, 8)
+		var err error
+		if block, err = des.NewTripleDESCipher(key); err != nil {
+			return nil, err
+		}
+
+	case alg.Algorithm.Equal(oidPBES2):
+		var params pbes2Params
+		if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+			return nil, err
+		}
+		if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+			return nil, fmt.Errorf("pkcs12: unsupported key derivation %v", params.KeyDerivationFunc.Algorithm)
+		}
+		var kdf pbkdf2Params
+		if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+			return nil, err
+		}
+		if err := checkPKCS12Iterations(kdf.Iterations); err != nil {
+			return nil, err
+		}
+		h := sha1.New
+		if kdf.PRF.Algorithm.Equal(oidHMACWithSHA256) {
+			h = sha256.New
+		} else if len(kdf.PRF.Algorithm) > 0 && !kdf.PRF.Algorithm.Equal(oidHMACWithSHA1) {
+			return nil, fmt.Errorf("pkcs12: unsupported PBKDF2 function %v", kdf.PRF.Algorithm)
+		}
+		var keyLen int
+		switch {
+		case params.EncryptionScheme.Algorithm.Equal(oidAES128CBC):
+			keyLen = 16
+		case params.EncryptionScheme.Algorithm.Equal(oidAES192CBC):
+			keyLen = 24
+		case params.EncryptionScheme.Algorithm.Equal(oidAES256CBC):
+			keyLen = 32
+		default:
+			return nil, fmt.Errorf("pkcs12: unsupported cipher %v", params.EncryptionScheme.Algorithm)
+		}
+		if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+			return nil, err
+		}
+		var err error
+		if block, err = aes.NewCipher(pbkdf2Key(h, []byte(pass), kdf.Salt, kdf.Iterations, keyLen)); err != nil {
+			return nil, err
+		}
+
+	case alg.Algorithm.Equal(oidPBEWithSHAAnd40BitRC2CBC):
+		// the default for certificates exported by Windows, OpenSSL 1.x and Java 8
+		var params pbeParams
+		if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+			return nil, err
+		}
+		if err := checkPKCS12Iterations(params.Iterations); err != nil {
+			return nil, err
+		}
+		key := pkcs12KDF(sha1.New, 64, params.Salt, password, params.Iterations, 1, 5)
+		iv = pkcs12KDF(sha1.New, 64, params.Salt, password, params.Iterations, 2, 8)
+		var err error
+		if block, err = newRC2Cipher(key, len(key)*8); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("pkcs12: unsupported encryption %v", alg.Algorithm)
+	}
+
+	data := info.EncryptedContent
+	if len(data) == 0 || len(data)%block.BlockSize() != 0 || len(iv) != block.BlockSize() {
+		return nil, errors.New("pkcs12: invalid encrypted content")
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+
+	// remove PKCS#7 padding, bad padding means the wrong password
+	pad := int(out[len(out)-1])
+	if pad == 0 || pad > block.BlockSize() || pad > len(out) {
+		return nil, ErrPKCS12Password
+	}
+	for _, b := range out[len(out)-pad:] {
+		if int(b) != pad {
+			return nil, ErrPKCS12Password
+		}
+	}
+	return out[:len(out)-pad], nil
+}
+
+// pkcs12KDF derives key material from a password, see RFC 7292 appendix B.2.
+// The block size v is 64 for SHA1 and SHA256.
+func pkcs12KDF(h func() hash.Hash, v int, salt, password []byte, iterations int, id byte, size int) []byte {
+	D := bytes.Repeat([]byte{id}, v)
+	I := append(fillWithRepeats(salt, v), fillWithRepeats(password, v)...)
+
+	one := big.NewInt(1)
+	mod := new(big.Int).Lsh(one, uint(v*8))
+	var out []byte
+	for len(out) < size {
+		hh := h()
+		hh.Write(D)
+		hh.Write(I)
+		A := hh.Sum(nil)
+		for j := 1; j < iterations; j++ {
+			hh = h()
+			hh.Write(A)
+			A = hh.Sum(nil)
+		}
+		out = append(out, A...)
+		if len(out) >= size {
+			break
+		}
+
+		// I_j = (I_j + B + 1) mod 2^(v*8) for each v byte block of I
+		B := new(big.Int).SetBytes(fillWithRepeats(A, v)[:v])
+		B.Add(B, one)
+		for j := 0; j < len(I)/v; j++ {
+			Ij := new(big.Int).SetBytes(I[j*v : (j+1)*v])
+			Ij.Add(Ij, B).Mod(Ij, mod)
+			bs := Ij.Bytes()
+			block := I[j*v : (j+1)*v]
+			for k := range block {
+				block[k] = 0
+			}
+			copy(block[v-len(bs):], bs)
+		}
+	}
+	return out[:size]
+}
+
+// fillWithRepeats repeats pattern up to the next multiple of v bytes
+func fillWithRepeats(pattern []byte, v int) []byte {
+	if len(pattern) == 0 {
+		return nil
+	}
+	n := v * ((len(pattern) + v - 1) / v)
+	return bytes.Repeat(pattern, (n+len(pattern)-1)/len(pattern))[:n]
+}
+
+// pbkdf2Key derives a key with PBKDF2, see RFC 8018 section 5.2
+func pbkdf2Key(h func() hash.Hash, password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(h, password)
+	var out []byte
+	for block := uint32(1); len(out) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		U := prf.Sum(nil)
+		T := append([]byte{}, U...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(U)
+			U = prf.Sum(nil)
+			for j := range T {
+				T[j] ^= U[j]
+			}
+		}
+		out = append(out, T...)
+	}
+	return out[:keyLen]
+}
+
+// bmpString encodes s as UCS-2 with a trailing null, as PKCS#12 passwords are
+func bmpString(s string) ([]byte, error) {
+	out := make([]byte, 0, 2*len(s)+2)
+	for _, r := range s {
+		if r > 0xffff {
+			return nil, fmt.Errorf("pkcs12: %q can't be encoded in a BMPString", r)
+		}
+		out = append(out, byte(r>>8), byte(r))
+	}
+	return append(out, 0, 0), nil
+}
+
+func decodeBMPString(bs []byte) string {
+	runes := make([]rune, 0, len(bs)/2)
+	for i := 0; i+1 < len(bs); i += 2 {
+		runes = append(runes, rune(bs[i])<<8|rune(bs[i+1]))
+	}
+	return string(runes)
 }
@@ -15,14 +15,11 @@
 package certutil
 
 import (
-	"fmt"
 	"io/ioutil"
 	"testing"
 )
 
 func TestCertutil__decodePKCS12(t *testing.T) {
-	t.Skip("broken upstream See https://github.com/golang/go/issues/23499")
-
 	bs, err := ioutil.ReadFile("../../testdata/cert.pfx")
 	if err != nil {
 		t.Fatal(err)
@@ -36,17 +33,74 @@ func TestCertutil__decodePKCS12(t *testing.T) {
 	}
 
 	// Subject: C=US, ST=Washington, L=Redmond, O=Microsoft Corporation, CN=Microsoft Root Certificate Authority 2010
-	// Serial: 28:cc:3a:25:bf:ba:44:ac:44:9a:9b:58:6b:43:39:aa (hex?) 54229527761073585954067062875972909482 (...decimal?)
+	// SHA256 Fingerprint=DF:54:5B:F9:19:A2:43:9C:36:98:3B:54:CD:FC:90:3D:FA:4F:37:D3:99:6D:8D:84:B4:C3:1E:EC:6F:3C:16:3E
+	if fp := GetHexSHA256Fingerprint(*cert); fp != "df545bf919a2439c36983b54cdfc903dfa4f37d3996d8d84b4c31eec6f3c163e" {
+		t.Errorf("got %s", fp)
+	}
+	if cert.Subject.CommonName != "Microsoft Root Certificate Authority 2010" {
+		t.Errorf("got %s", cert.Subject.CommonName)
+	}
 
-	// Subject: Microsoft Corporation
-	// Issuer: Microsoft Corporation
+	if _, err := DecodePKCS12(bs, "wrong"); err != ErrPKCS12Password {
+		t.Errorf("expected ErrPKCS12Password, got %v", err)
+	}
+}
 
-	// df545bf919a2439c36983b54cdfc903dfa4f37d3996d8d84b4c31eec6f3c163e
-	// SHA256 Fingerprint=DF:54:5B:F9:19:A2:43:9C:36:98:3B:54:CD:FC:90:3D:FA:4F:37:D3:99:6D:8D:84:B4:C3:1E:EC:6F:3C:16:3E
+func TestCertutil__decodePKCS12RC2(t *testing.T) {
+	// pbeWithSHA1And40BitRC2-CBC, as Windows, OpenSSL 1.x and Java 8 export
+	bs, err := ioutil.ReadFile("../../testdata/cert-rc2.pfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := DecodePKCS12(bs, "Password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp := GetHexSHA256Fingerprint(*cert); fp != "df545bf919a2439c36983b54cdfc903dfa4f37d3996d8d84b4c31eec6f3c163e" {
+		t.Errorf("got %s", fp)
+	}
+}
 
-	// Not Before: Jun 23 21:57:24 2010 GMT
-	// Not After : Jun 23 22:04:01 2035 GMT
-	// CA:TRUE
+func TestCertutil__pkcs12Iterations(t *testing.T) {
+	for _, n := range []int{0, -1, maxPKCS12Iterations + 1} {
+		if err := checkPKCS12Iterations(n); err == nil {
+			t.Errorf("expected error for %d iterations", n)
+		}
+	}
+	if err := checkPKCS12Iterations(2048); err != nil {
+		t.Error(err)
+	}
+}
 
-	fmt.Println(cert)
+func TestCertutil__encodePKCS12(t *testing.T) {
+	certs, err := FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pass := range []string{"", "secret"} {
+		bs, err := EncodePKCS12(certs, pass)
+		if err != nil {
+			t.Fatal(err)
+		}
+		read, err := DecodePKCS12Certificates(bs, pass)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(read) != len(certs) {
+			t.Fatalf("got %d certificates", len(read))
+		}
+		for i := range certs {
+			if !read[i].Equal(certs[i]) {
+				t.Errorf("certificate %d differs", i)
+			}
+		}
+	}
+	bs, _ := EncodePKCS12Entries([]PKCS12Entry{{Name: "mykey ☃", Cert: certs[0]}}, "secret")
+	entries, other, err := DecodePKCS12Entries(bs, "secret")
+	if err != nil || other != 0 || len(entries) != 1 || entries[0].Name != "mykey ☃" {
+		t.Errorf("entries=%v other=%d err=%v", entries, other, err)
+	}
+	if _, err := DecodePKCS12Certificates(bs, "other"); err != ErrPKCS12Password {
+		t.Errorf("expected ErrPKCS12Password, got %v", err)
+	}
 }
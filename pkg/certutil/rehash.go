@@ -0,0 +1,241 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certutil
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+var (
+	// hashLinkName matches the symlinks created by c_rehash, e.g. 3513523f.0
+	hashLinkName = regexp.MustCompile(`^[0-9a-f]{8}\.r?[0-9]+$`)
+
+	rehashExtensions = []string{".pem", ".crt", ".cer"}
+)
+
+// SubjectHash returns OpenSSL's hash of the certificate's subject, which
+// is used to name certificates in directories given to -CApath.
+//
+// It matches X509_subject_name_hash (openssl x509 -hash) from OpenSSL 1.0.0
+// onwards: the SHA1 of the subject's canonical encoding (string values are
+// converted to UTF8, lowercased and have their whitespace collapsed)
+// read as a little endian uint32.
+func SubjectHash(cert *x509.Certificate) (uint32, error) {
+	canon, err := canonicalName(cert.RawSubject)
+	if err != nil {
+		return 0, err
+	}
+	sum := sha1.Sum(canon)
+	return binary.LittleEndian.Uint32(sum[:4]), nil
+}
+
+// canonicalName re-encodes each RDN of a DER encoded Name, the result is
+// the concatenation of each SET without the outer SEQUENCE.
+func canonicalName(raw []byte) ([]byte, error) {
+	var name asn1.RawValue
+	if _, err := asn1.Unmarshal(raw, &name); err != nil {
+		return nil, fmt.Errorf("error parsing name: %v", err)
+	}
+
+	var out bytes.Buffer
+	rest := name.Bytes
+	for len(rest) > 0 {
+		var set asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &set); err != nil {
+			return nil, fmt.Errorf("error parsing RDN: %v", err)
+		}
+
+		var avas [][]byte
+		inner := set.Bytes
+		for len(inner) > 0 {
+			var ava asn1.RawValue
+			if inner, err = asn1.Unmarshal(inner, &ava); err != nil {
+				return nil, fmt.Errorf("error parsing attribute: %v", err)
+			}
+			enc, err := canonicalAttribute(ava.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			avas = append(avas, enc)
+		}
+
+		// DER requires the members of a SET OF to be sorted
+		sort.Slice(avas, func(i, j int) bool {
+			return bytes.Compare(avas[i], avas[j]) < 0
+		})
+		enc, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: bytes.Join(avas, nil)})
+		if err != nil {
+			return nil, err
+		}
+		out.Write(enc)
+	}
+	return out.Bytes(), nil
+}
+
+func canonicalAttribute(raw []byte) ([]byte, error) {
+	var oid, value asn1.RawValue
+	rest, err := asn1.Unmarshal(raw, &oid)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing attribute type: %v", err)
+	}
+	if _, err := asn1.Unmarshal(rest, &value); err != nil {
+		return nil, fmt.Errorf("error parsing attribute value: %v", err)
+	}
+
+	valueBytes := value.FullBytes
+	if s, ok := stringValue(value); ok {
+		valueBytes, err = asn1.Marshal(asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: []byte(canonicalString(s))})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return asn1.Marshal(asn1.RawValue{
+		Tag:        asn1.TagSequence,
+		IsCompound: true,
+		Bytes:      append(append([]byte{}, oid.FullBytes...), valueBytes...),
+	})
+}
+
+// stringValue converts the string types OpenSSL canonicalizes to UTF8,
+// other types (e.g. an OCTET STRING) are hashed as they are.
+func stringValue(v asn1.RawValue) (string, bool) {
+	if v.Class != asn1.ClassUniversal {
+		return "", false
+	}
+	switch v.Tag {
+	case asn1.TagUTF8String, asn1.TagPrintableString, asn1.TagIA5String, 26: // VisibleString
+		return string(v.Bytes), true
+	case asn1.TagT61String:
+		// OpenSSL reads T61String as latin1
+		runes := make([]rune, len(v.Bytes))
+		for i := range v.Bytes {
+			runes[i] = rune(v.Bytes[i])
+		}
+		return string(runes), true
+	case 30: // BMPString, UCS-2
+		u := make([]uint16, len(v.Bytes)/2)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(v.Bytes[2*i:])
+		}
+		return string(utf16.Decode(u)), true
+	case 28: // UniversalString, UCS-4
+		runes := make([]rune, len(v.Bytes)/4)
+		for i := range runes {
+			runes[i] = rune(binary.BigEndian.Uint32(v.Bytes[4*i:]))
+		}
+		return string(runes), true
+	}
+	return "", false
+}
+
+// canonicalString trims leading and trailing whitespace, collapses each
+// run of whitespace into one space and lowercases ASCII letters.
+func canonicalString(s string) string {
+	var buf bytes.Buffer
+	space := false
+	for _, b := range []byte(strings.Trim(s, " \t\n\v\f\r")) {
+		switch {
+		case b == ' ' || (b >= '\t' && b <= '\r'):
+			space = true
+			continue
+		case b >= 'A' && b <= 'Z':
+			b += 'a' - 'A'
+		}
+		if space {
+			buf.WriteByte(' ')
+			space = false
+		}
+		buf.WriteByte(b)
+	}
+	return buf.String()
+}
+
+// Rehash recreates the OpenSSL hash symlinks (<subject hash>.<n>) for each
+// certificate file in dir, like c_rehash or 'openssl rehash'. Existing hash
+// symlinks are removed first.
+func Rehash(dir string) error {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for i := range infos {
+		name := infos[i].Name()
+		if hashLinkName.MatchString(name) {
+			if infos[i].Mode()&os.ModeSymlink != 0 {
+				if err := os.Remove(filepath.Join(dir, name)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if infos[i].IsDir() || !hasRehashExtension(name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// link each certificate, certificates with the same subject hash
+	// are numbered in the order their files sort
+	seen := make(map[string]bool)
+	counts := make(map[uint32]int)
+	for i := range names {
+		certs, err := FromFile(filepath.Join(dir, names[i]))
+		if err != nil || len(certs) == 0 {
+			continue // not a certificate, e.g. a CRL
+		}
+		fp := GetHexSHA256Fingerprint(*certs[0])
+		if seen[fp] {
+			continue // duplicate certificate
+		}
+		seen[fp] = true
+
+		hash, err := SubjectHash(certs[0])
+		if err != nil {
+			return fmt.Errorf("error hashing %s: %v", names[i], err)
+		}
+		link := filepath.Join(dir, fmt.Sprintf("%08x.%d", hash, counts[hash]))
+		counts[hash]++
+		if err := os.Symlink(names[i], link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasRehashExtension(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for i := range rehashExtensions {
+		if ext == rehashExtensions[i] {
+			return true
+		}
+	}
+	return false
+}
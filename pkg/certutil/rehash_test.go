@@ -0,0 +1,110 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCertutilRehash__subjectHash(t *testing.T) {
+	certs, err := FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// openssl x509 -hash -noout
+	expected := []string{"aee5f10d", "02265526", "106f3e4d", "6b99d060", "128805a3"}
+	if len(certs) != len(expected) {
+		t.Fatalf("got %d certs", len(certs))
+	}
+	for i := range certs {
+		hash, err := SubjectHash(certs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ans := fmt.Sprintf("%08x", hash); ans != expected[i] {
+			t.Errorf("%s: got %s, expected %s", certs[i].Subject.CommonName, ans, expected[i])
+		}
+	}
+}
+
+func TestCertutilRehash__canonicalString(t *testing.T) {
+	cases := map[string]string{
+		"Entrust.net":            "entrust.net",
+		"  Two   Spaces\t\nCA  ": "two spaces ca",
+		"Ü Straße B":             "Ü straße b",
+		"":                       "",
+	}
+	for in, expected := range cases {
+		if ans := canonicalString(in); ans != expected {
+			t.Errorf("%q: got %q, expected %q", in, ans, expected)
+		}
+	}
+}
+
+func TestCertutilRehash__dir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-rehash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certs, err := FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range certs {
+		if err := ToFile(filepath.Join(dir, fmt.Sprintf("%d.pem", i)), certs[i:i+1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a duplicate, a stale link and a file which isn't a certificate
+	if err := ToFile(filepath.Join(dir, "dup.crt"), certs[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("0.pem", filepath.Join(dir, "00000000.0")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "README.pem"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Rehash(dir); err != nil {
+		t.Fatal(err)
+	}
+	// running twice replaces the links
+	if err := Rehash(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Lstat(filepath.Join(dir, "00000000.0")); !os.IsNotExist(err) {
+		t.Errorf("stale link kept: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "aee5f10d.1")); !os.IsNotExist(err) {
+		t.Errorf("duplicate linked: %v", err)
+	}
+	target, err := os.Readlink(filepath.Join(dir, "aee5f10d.0"))
+	if err != nil || target != "0.pem" {
+		t.Errorf("got %q, %v", target, err)
+	}
+	target, err = os.Readlink(filepath.Join(dir, "128805a3.0"))
+	if err != nil || target != "4.pem" {
+		t.Errorf("got %q, %v", target, err)
+	}
+}
@@ -15,35 +15,47 @@
 package certutil
 
 import (
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 )
 
+// GetHexSHA1Fingerprint returns the hex encoded SHA1 hash of a certificate,
+// results are cached by the certificate's DER.
 func GetHexSHA1Fingerprint(c x509.Certificate) string {
-	ss := sha1.New()
-	n, err := ss.Write(c.Raw)
-	if err != nil {
-		panic(fmt.Sprintf("error writing %s: %v", c.Subject.String(), err))
-	}
-	if n == 0 {
+	if len(c.Raw) == 0 {
 		panic(fmt.Sprintf("no bytes written for %s", c.Subject.String()))
 	}
-	return hex.EncodeToString(ss.Sum(nil))
+	return sha1Fingerprints.get(c.Raw, func(raw []byte) string {
+		sum := sha1.Sum(raw)
+		return hex.EncodeToString(sum[:])
+	})
 }
 
+// GetHexSHA256Fingerprint returns the hex encoded SHA256 hash of a
+// certificate, results are cached by the certificate's DER.
 func GetHexSHA256Fingerprint(c x509.Certificate) string {
-	ss := sha256.New()
-	n, err := ss.Write(c.Raw)
-	if err != nil {
-		panic(fmt.Sprintf("error writing %s: %v", c.Subject.String(), err))
-	}
-	if n == 0 {
+	if len(c.Raw) == 0 {
 		panic(fmt.Sprintf("no bytes written for %s", c.Subject.String()))
 	}
-	return hex.EncodeToString(ss.Sum(nil))
+	return sha256Fingerprints.get(c.Raw, func(raw []byte) string {
+		sum := sha256.Sum256(raw)
+		return hex.EncodeToString(sum[:])
+	})
+}
+
+// GetBase64SPKISHA256Fingerprint returns the base64 encoded SHA256 hash of a
+// certificate's SubjectPublicKeyInfo. This is the format used for HPKP pins and
+// Android's network_security_config.
+func GetBase64SPKISHA256Fingerprint(c x509.Certificate) string {
+	ss := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(ss[:])
 }
 
 func StringifyPubKeyAlgo(p x509.PublicKeyAlgorithm) string {
@@ -58,3 +70,17 @@ func StringifyPubKeyAlgo(p x509.PublicKeyAlgorithm) string {
 	}
 	return res
 }
+
+// PublicKeySize returns the size (in bits) of a certificate's public key,
+// or 0 if the key type is unknown.
+func PublicKeySize(c x509.Certificate) int {
+	switch k := c.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return k.N.BitLen()
+	case *dsa.PublicKey:
+		return k.P.BitLen()
+	case *ecdsa.PublicKey:
+		return k.Curve.Params().BitSize
+	}
+	return 0
+}
@@ -66,3 +66,24 @@ func verify(path, algo, fp string, t *testing.T) {
 		t.Errorf("bad fingerprint match with openssl:\n  openssl=%s\n  expected=%s", resp, fp)
 	}
 }
+
+func TestCertutil__spkiFingerprint(t *testing.T) {
+	certs, _ := FromFile("../../testdata/example.crt")
+	if len(certs) != 1 {
+		t.Errorf("didn't expect %d certs", len(certs))
+	}
+	fp := GetBase64SPKISHA256Fingerprint(*certs[0])
+	if len(fp) != 44 {
+		t.Fatalf("fp=%q isn't a base64 sha256", fp)
+	}
+
+	// verify with openssl
+	cmd := exec.Command("sh", "-c", "openssl x509 -in ../../testdata/example.crt -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | openssl enc -base64")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Skipf("openssl failed: %v", err)
+	}
+	if v := strings.TrimSpace(string(out)); v != fp {
+		t.Errorf("openssl=%q, fp=%q", v, fp)
+	}
+}
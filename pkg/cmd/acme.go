@@ -0,0 +1,303 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/httputil"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+)
+
+var (
+	// acmeRootPaths are where internal CAs publish their roots, relative
+	// to the CA's origin. step-ca serves every root as PEM on /roots.pem.
+	acmeRootPaths = []string{"/roots.pem"}
+
+	// acmePinsFile records the root fingerprint trusted for each CA, in the
+	// cert-manage directory
+	acmePinsFile = "acme-pins.json"
+
+	errTrustCancelled = errors.New("trust-acme cancelled")
+)
+
+// TrustACMEOptions describes the internal CA whose roots are trusted
+type TrustACMEOptions struct {
+	// Directory is the CA's ACME directory URL, e.g. https://ca.internal/acme/acme/directory
+	Directory string
+
+	// StepCA is the URL of a step-ca server, used instead of Directory
+	StepCA string
+
+	// Fingerprint is the SHA256 fingerprint the CA's root must have, as
+	// printed by 'step certificate fingerprint'. Without it the roots
+	// found are shown for confirmation.
+	Fingerprint string
+
+	// Yes skips confirming roots without Fingerprint
+	Yes bool
+
+	// Stores are the app names (or "platform") the roots are added to
+	Stores []string
+}
+
+// trustTarget is a store roots are added to
+type trustTarget struct {
+	name string
+	s    store.Store
+}
+
+// TrustACME fetches the roots of an internal ACME CA (e.g. step-ca) from
+// where it publishes them and adds them to each store. The root is pinned,
+// so if the CA later serves a different root it's refused until the new
+// fingerprint is given.
+func TrustACME(opts TrustACMEOptions) error {
+	targets, err := trustTargets(opts.Stores)
+	if err != nil {
+		return err
+	}
+	pinsPath := ""
+	if dir, err := store.StateDir(); err == nil {
+		pinsPath = filepath.Join(dir, acmePinsFile)
+	}
+	return trustACME(os.Stdin, os.Stdout, opts, targets, pinsPath)
+}
+
+// trustTargets returns the stores named, "platform" is the platform's store
+// and is used when none are given
+func trustTargets(stores []string) ([]trustTarget, error) {
+	if len(stores) == 0 {
+		stores = []string{"platform"}
+	}
+	var out []trustTarget
+	for i := range stores {
+		name := strings.TrimSpace(stores[i])
+		if strings.EqualFold(name, "platform") {
+			out = append(out, trustTarget{"platform", store.Platform()})
+			continue
+		}
+		s, err := store.ForApp(name)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, trustTarget{name, s})
+	}
+	return out, nil
+}
+
+// writable returns an error if certificates can't be added to the target
+func (t trustTarget) writable() error {
+	if info := t.s.GetInfo(); info != nil && !info.Writable {
+		return fmt.Errorf("%s is read-only, certificates can't be added to it", info.Name)
+	}
+	return nil
+}
+
+func trustACME(in io.Reader, out io.Writer, opts TrustACMEOptions, targets []trustTarget, pinsPath string) error {
+	origin, err := acmeOrigin(opts)
+	if err != nil {
+		return err
+	}
+	roots, err := fetchACMERoots(origin)
+	if err != nil {
+		return err
+	}
+
+	pins := readACMEPins(pinsPath)
+	want := normalizeFingerprint(opts.Fingerprint)
+	if want == "" {
+		want = pins[origin]
+	}
+	if want != "" {
+		roots = rootsWithFingerprint(roots, want)
+		if len(roots) == 0 {
+			if opts.Fingerprint == "" {
+				return fmt.Errorf("%s no longer serves the pinned root %s, give -fingerprint to trust its new root", origin, want)
+			}
+			return fmt.Errorf("%s doesn't serve a root with fingerprint %s", origin, want)
+		}
+	} else if !opts.Yes {
+		summary := []string{fmt.Sprintf("%s publishes %d root(s):", origin, len(roots))}
+		for i := range roots {
+			summary = append(summary, fmt.Sprintf("  %s  %s", certutil.GetHexSHA256Fingerprint(*roots[i]), certutil.StringifyPKIXName(roots[i].Subject)))
+		}
+		summary = append(summary, "Compare these with the CA's fingerprint (e.g. 'step certificate fingerprint root_ca.crt'), or give -fingerprint")
+		if err := confirmRestore(in, out, summary); err != nil {
+			if err == errRestoreCancelled {
+				return errTrustCancelled
+			}
+			return err
+		}
+	}
+
+	for i := range targets {
+		if err := targets[i].writable(); err != nil {
+			return err
+		}
+		if err := targets[i].s.Add(roots); err != nil {
+			return fmt.Errorf("adding roots to %s: %v", targets[i].name, err)
+		}
+		fmt.Fprintf(out, "Added %d root(s) from %s to %s\n", len(roots), origin, targets[i].name)
+	}
+
+	if !store.DryRun() {
+		pins[origin] = certutil.GetHexSHA256Fingerprint(*roots[0])
+		if err := writeACMEPins(pinsPath, pins); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acmeOrigin returns the scheme and host of the CA, an ACME directory is
+// read first to check it's one
+func acmeOrigin(opts TrustACMEOptions) (string, error) {
+	raw := opts.StepCA
+	if raw == "" {
+		raw = opts.Directory
+	}
+	if raw == "" {
+		return "", errors.New("one of -directory or -step-ca is needed")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return "", fmt.Errorf("%s isn't an https URL", raw)
+	}
+	if opts.StepCA == "" {
+		if err := checkACMEDirectory(raw); err != nil {
+			return "", err
+		}
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// checkACMEDirectory returns an error unless u is an ACME directory (RFC 8555)
+func checkACMEDirectory(u string) error {
+	bs, err := acmeGet(u)
+	if err != nil {
+		return err
+	}
+	var dir map[string]interface{}
+	if err := json.Unmarshal(bs, &dir); err != nil {
+		return fmt.Errorf("reading ACME directory %s: %v", u, err)
+	}
+	if _, ok := dir["newNonce"]; !ok {
+		return fmt.Errorf("%s isn't an ACME directory, it has no newNonce", u)
+	}
+	return nil
+}
+
+// fetchACMERoots downloads the CA's roots. The CA's own certificate can't be
+// verified yet, so only self-signed CA certificates are kept and they still
+// need checking against a fingerprint.
+func fetchACMERoots(origin string) ([]*x509.Certificate, error) {
+	var lastErr error
+	for i := range acmeRootPaths {
+		bs, err := acmeGet(origin + acmeRootPaths[i])
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		certs, err := certutil.ParsePEM(bs)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		var roots []*x509.Certificate
+		for j := range certs {
+			if certs[j].IsCA && isSelfSigned(certs[j]) {
+				roots = append(roots, certs[j])
+			}
+		}
+		if len(roots) > 0 {
+			return roots, nil
+		}
+		lastErr = fmt.Errorf("no roots found at %s%s", origin, acmeRootPaths[i])
+	}
+	return nil, lastErr
+}
+
+func acmeGet(u string) ([]byte, error) {
+	resp, err := httputil.Unverified().Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %s", u, resp.Status)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxDownloadSize))
+}
+
+// normalizeFingerprint lowercases a hex fingerprint and drops separators
+func normalizeFingerprint(fp string) string {
+	fp = strings.Replace(strings.TrimSpace(fp), ":", "", -1)
+	return strings.ToLower(strings.Replace(fp, " ", "", -1))
+}
+
+func rootsWithFingerprint(roots []*x509.Certificate, fp string) []*x509.Certificate {
+	for i := range roots {
+		if certutil.GetHexSHA256Fingerprint(*roots[i]) == fp {
+			return roots[i : i+1]
+		}
+	}
+	return nil
+}
+
+// readACMEPins returns the pinned root fingerprint of each CA, keyed by
+// its origin
+func readACMEPins(path string) map[string]string {
+	pins := make(map[string]string)
+	if path == "" {
+		return pins
+	}
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return pins
+	}
+	if err := json.Unmarshal(bs, &pins); err != nil {
+		if debug {
+			fmt.Printf("cmd: ignoring corrupt %s: %v\n", path, err)
+		}
+		return make(map[string]string)
+	}
+	return pins
+}
+
+func writeACMEPins(path string, pins map[string]string) error {
+	if path == "" {
+		return nil
+	}
+	bs, err := json.MarshalIndent(pins, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bs, file.TempFilePermissions)
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+)
+
+func TestCmdTrustACME(t *testing.T) {
+	first, err := testca.NewRoot("Internal Root CA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := testca.NewRoot("Internal Root CA 2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := first.Certificate
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/acme/acme/directory":
+			w.Write([]byte(`{"newNonce": "https://ca.internal/acme/acme/new-nonce"}`))
+		case "/roots.pem":
+			pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "cert-manage-acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pins := filepath.Join(dir, acmePinsFile)
+
+	opts := TrustACMEOptions{Directory: srv.URL + "/acme/acme/directory"}
+	trust := func(opts TrustACMEOptions, answer string) ([]*x509.Certificate, error) {
+		s := store.MemoryStore(nil)
+		var out bytes.Buffer
+		err := trustACME(strings.NewReader(answer), &out, opts, []trustTarget{{"memory", s}}, pins)
+		certs, _ := s.List(&store.ListOptions{Trusted: true})
+		return certs, err
+	}
+
+	// the root is confirmed before it's added
+	if certs, err := trust(opts, "n\n"); err != errTrustCancelled || len(certs) != 0 {
+		t.Fatalf("got %d certs, err=%v", len(certs), err)
+	}
+	certs, err := trust(opts, "y\n")
+	if err != nil || len(certs) != 1 || !certs[0].Equal(root) {
+		t.Fatalf("got %d certs, err=%v", len(certs), err)
+	}
+
+	// it's pinned now, so a new root is refused
+	root = second.Certificate
+	if _, err := trust(opts, "y\n"); err == nil || !strings.Contains(err.Error(), "pinned root") {
+		t.Errorf("expected pinned error, got %v", err)
+	}
+
+	// unless its fingerprint is given
+	opts.Fingerprint = strings.ToUpper(certutil.GetHexSHA256Fingerprint(*root))
+	if certs, err := trust(opts, ""); err != nil || len(certs) != 1 || !certs[0].Equal(root) {
+		t.Errorf("got %d certs, err=%v", len(certs), err)
+	}
+	opts.Fingerprint = certutil.GetHexSHA256Fingerprint(*first.Certificate)
+	if _, err := trust(opts, ""); err == nil {
+		t.Error("expected fingerprint mismatch")
+	}
+
+	// step-ca is read without a directory, which has to be ACME's
+	opts = TrustACMEOptions{StepCA: srv.URL, Yes: true}
+	if certs, err := trust(opts, ""); err != nil || len(certs) != 1 {
+		t.Errorf("got %d certs, err=%v", len(certs), err)
+	}
+	opts = TrustACMEOptions{Directory: srv.URL + "/roots.pem", Yes: true}
+	if _, err := trust(opts, ""); err == nil {
+		t.Error("expected error reading a non-ACME directory")
+	}
+}
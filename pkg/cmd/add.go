@@ -16,10 +16,7 @@ package cmd
 
 import (
 	"fmt"
-	"io/ioutil"
-	"os"
 
-	"github.com/adamdecaf/cert-manage/pkg/certutil"
 	"github.com/adamdecaf/cert-manage/pkg/store"
 )
 
@@ -31,22 +28,18 @@ func AddCertsFromFile(where string) error {
 func AddCertsToAppFromFile(app string, where string) error {
 	st, err := store.ForApp(app)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return err
 	}
 	return addCerts(st, where)
 }
 
 func addCerts(st store.Store, where string) error {
-	bs, err := ioutil.ReadFile(where)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	if info := st.GetInfo(); info != nil && !info.Writable {
+		return fmt.Errorf("%s is read-only, certificates can't be added to it", info.Name)
 	}
-	certs, err := certutil.Decode(bs)
+	certs, err := readCertificates(where)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return err
 	}
 	return st.Add(certs)
 }
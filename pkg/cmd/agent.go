@@ -0,0 +1,230 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/agent"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+var (
+	// defaultAgentInterval is how often agents check in when neither -interval
+	// nor the policy server says otherwise
+	defaultAgentInterval = 15 * time.Minute
+)
+
+// AgentOptions configures 'agent'
+type AgentOptions struct {
+	// Dir holds the agent's key, certificate and cached policy, defaults to
+	// agent/ in cert-manage's state directory
+	Dir string
+
+	// Server, ServerCA, Token and Group are used by enroll
+	Server   string
+	ServerCA string
+	Token    string
+	Group    string
+
+	// Interval overrides how often run checks in, Once checks in once and
+	// returns any error
+	Interval time.Duration
+	Once     bool
+
+	// Version of cert-manage, reported to the server
+	Version string
+}
+
+// AgentEnroll enrolls this host with a policy server
+func AgentEnroll(opts AgentOptions) error {
+	if opts.Server == "" || opts.Token == "" {
+		return errors.New("enrolling needs -server and a token")
+	}
+	dir, err := agentDir(opts)
+	if err != nil {
+		return err
+	}
+	client := &agent.Client{
+		Dir:      dir,
+		Server:   opts.Server,
+		ServerCA: opts.ServerCA,
+		Labels:   whitelist.HostLabels(),
+	}
+	if err := client.Enroll(opts.Token, opts.Group); err != nil {
+		return err
+	}
+	fmt.Printf("Enrolled as %s", client.AgentID)
+	if client.Group != "" {
+		fmt.Printf(" in group %s", client.Group)
+	}
+	fmt.Printf(", run 'cert-manage agent run' to apply its policy\n")
+	return nil
+}
+
+func AgentRunForApp(app string, opts AgentOptions) error {
+	s, err := store.ForApp(app)
+	if err != nil {
+		return err
+	}
+	return agentRun(s, app, opts)
+}
+
+func AgentRunForPlatform(opts AgentOptions) error {
+	return agentRun(store.Platform(), runtime.GOOS, opts)
+}
+
+// agentRun checks in with the policy server every interval until
+// cert-manage is interrupted, see agentCheckIn
+func agentRun(s store.Store, name string, opts AgentOptions) error {
+	dir, err := agentDir(opts)
+	if err != nil {
+		return err
+	}
+	client, err := agent.Load(dir)
+	if err != nil {
+		return err
+	}
+	client.Labels = whitelist.HostLabels()
+	for {
+		interval, err := agentCheckIn(client, s, name, opts.Version)
+		if opts.Once {
+			return err
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "agent: %v\n", err)
+		}
+		if opts.Interval > 0 {
+			interval = opts.Interval
+		}
+		if debug {
+			fmt.Printf("cmd: next agent check in after %v\n", interval)
+		}
+		select {
+		case <-time.After(interval):
+		case <-interrupt.Context().Done():
+			return nil
+		}
+	}
+}
+
+// agentCheckIn fetches the agent's policy and applies it to s if it isn't
+// already, then reports what s trusts. The interval the server asked for is
+// returned.
+func agentCheckIn(client *agent.Client, s store.Store, name, version string) (time.Duration, error) {
+	interval := defaultAgentInterval
+
+	policy, err := client.FetchPolicy()
+	if err == nil {
+		if policy.Interval > 0 {
+			interval = time.Duration(policy.Interval) * time.Second
+		}
+		if policy.Cached {
+			fmt.Printf("Policy server unreachable, using cached policy %s\n", policy.Version)
+		}
+		err = agentApply(client, s, name, policy)
+	}
+
+	if rerr := client.ReportState(agentState(s, name, version)); rerr != nil && err == nil {
+		err = rerr
+	}
+	return interval, err
+}
+
+// agentApply applies policy's whitelist to s and sends the result, nothing
+// is done if it was the last whitelist applied and s hasn't changed since.
+func agentApply(client *agent.Client, s store.Store, name string, policy *agent.FetchPolicyResponse) error {
+	path := filepath.Join(client.Dir, "whitelist.json")
+	if err := ioutil.WriteFile(path, policy.Whitelist, file.TempFilePermissions); err != nil {
+		return err
+	}
+	wh, err := loadWhitelist(path, "")
+	if err != nil {
+		return fmt.Errorf("policy %s: %v", policy.Version, err)
+	}
+	applied, err := whitelistApplied(s, name, wh, false)
+	if err != nil || applied {
+		return err
+	}
+
+	// the first policy applied is backed up from, so restore undoes it
+	latest, err := s.GetLatestBackup()
+	if err == nil && latest == "" {
+		err = s.Backup()
+	}
+	if err == nil {
+		err = applyWhitelist(s, name, wh, WhitelistOptions{})
+	}
+
+	now := time.Now()
+	res := &agent.ApplyResultRequest{
+		Version: policy.Version,
+		Store:   name,
+		Success: err == nil,
+		Applied: &now,
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	if serr := client.ApplyResult(res); serr != nil {
+		fmt.Fprintf(os.Stderr, "agent: sending result: %v\n", serr)
+	}
+	return err
+}
+
+// agentState returns what s trusts and the last whitelist applied to it
+func agentState(s store.Store, name, version string) *agent.ReportStateRequest {
+	st := agent.StoreState{Name: name}
+	certs, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	if err = warnPartial(err); err != nil {
+		st.Error = err.Error()
+	} else {
+		st.Fingerprints = store.Fingerprints(certs)
+	}
+	if rec, err := store.GetState(name); err == nil && rec != nil {
+		st.Whitelist = rec.Whitelist
+		st.Applied = &rec.Applied
+	}
+
+	hostname, _ := os.Hostname()
+	return &agent.ReportStateRequest{
+		Hostname: hostname,
+		OS:       runtime.GOOS,
+		Version:  version,
+		Stores:   []agent.StoreState{st},
+	}
+}
+
+func agentDir(opts AgentOptions) (string, error) {
+	if opts.Dir != "" {
+		return opts.Dir, nil
+	}
+	dir, err := store.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "agent"), nil
+}
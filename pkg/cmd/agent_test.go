@@ -0,0 +1,144 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/agent"
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+// testPolicyServer hands every agent the same whitelist
+type testPolicyServer struct {
+	ca        *agent.CA
+	whitelist []byte
+
+	mu      sync.Mutex
+	reports []*agent.ReportStateRequest
+	results []*agent.ApplyResultRequest
+}
+
+func (s *testPolicyServer) Enroll(req *agent.EnrollRequest) (*agent.EnrollResponse, error) {
+	cert, err := s.ca.Sign(req.CSR, "agent-1")
+	if err != nil {
+		return nil, err
+	}
+	return &agent.EnrollResponse{AgentID: "agent-1", Certificates: [][]byte{cert}}, nil
+}
+
+func (s *testPolicyServer) ReportState(_ string, req *agent.ReportStateRequest) (*agent.ReportStateResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reports = append(s.reports, req)
+	return &agent.ReportStateResponse{}, nil
+}
+
+func (s *testPolicyServer) FetchPolicy(_ string, req *agent.FetchPolicyRequest) (*agent.FetchPolicyResponse, error) {
+	return &agent.FetchPolicyResponse{Version: "1", Whitelist: s.whitelist, Interval: 30}, nil
+}
+
+func (s *testPolicyServer) ApplyResult(_ string, req *agent.ApplyResultRequest) (*agent.ApplyResultResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = append(s.results, req)
+	return &agent.ApplyResultResponse{}, nil
+}
+
+func TestCmdAgent__checkIn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wh := whitelist.FromCertificates(certs[:2])
+	whBytes, err := json.Marshal(wh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := testca.NewRoot("agents", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := &testPolicyServer{ca: &agent.CA{Certificate: root.Certificate, Key: root.Key}, whitelist: whBytes}
+	srv := httptest.NewUnstartedServer(agent.NewHandler(svc))
+	srv.TLS = agent.ServerTLSConfig(tls.Certificate{}, root.Certificate)
+	srv.TLS.Certificates = nil
+	srv.StartTLS()
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	serverCA := filepath.Join(dir, "server.pem")
+	if err := ioutil.WriteFile(serverCA, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	opts := AgentOptions{Dir: filepath.Join(dir, "agent"), Server: srv.URL, ServerCA: serverCA, Token: "token"}
+	if err := AgentEnroll(opts); err != nil {
+		t.Fatal(err)
+	}
+	client, err := agent.Load(opts.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the policy is applied, backed up from first, and reported
+	s := store.MemoryStore(certs)
+	interval, err := agentCheckIn(client, s, "agent-test", "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interval.Seconds() != 30 {
+		t.Errorf("got %v", interval)
+	}
+	if after, _ := s.List(nil); len(after) != 2 {
+		t.Errorf("expected whitelist to be applied, got %d certificates", len(after))
+	}
+	if latest, _ := s.GetLatestBackup(); latest == "" {
+		t.Error("expected a backup")
+	}
+	if len(svc.results) != 1 || !svc.results[0].Success || svc.results[0].Store != "agent-test" {
+		t.Errorf("got %#v", svc.results)
+	}
+	if len(svc.reports) != 1 || len(svc.reports[0].Stores[0].Fingerprints) != 2 || svc.reports[0].Stores[0].Whitelist != wh.Hash() {
+		t.Errorf("got %#v", svc.reports)
+	}
+
+	// an applied policy is left alone, only the state is reported
+	if _, err := agentCheckIn(client, s, "agent-test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if len(svc.results) != 1 || len(svc.reports) != 2 {
+		t.Errorf("got %d results and %d reports", len(svc.results), len(svc.reports))
+	}
+}
@@ -0,0 +1,401 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+)
+
+const (
+	archiveManifest = "manifest.json"
+	archiveStores   = "stores"
+
+	// platformStoreName is used in archives for the platform's store
+	platformStoreName = "platform"
+)
+
+// manifest describes each store backed up in an archive
+type manifest struct {
+	Created  time.Time       `json:"created"`
+	Hostname string          `json:"hostname"`
+	Stores   []manifestStore `json:"stores"`
+}
+
+type manifestStore struct {
+	// Name is "platform" or an app name
+	Name string `json:"name"`
+
+	// Backup is the path of the store's backup within the archive
+	Backup string `json:"backup"`
+
+	Stamp store.BackupStamp `json:"stamp"`
+}
+
+// archiveStore is a store, by name, which can be included in an archive
+type archiveStore struct {
+	name string
+	s    store.Store
+}
+
+// detectedStores returns the platform store and each app store which can be
+// modified on this machine.
+func detectedStores() []archiveStore {
+	out := []archiveStore{{platformStoreName, store.Platform()}}
+	apps := store.GetApps()
+	for i := range apps {
+		s, err := store.ForApp(apps[i])
+		if err != nil {
+			continue
+		}
+		if info := s.GetInfo(); info == nil || !info.Writable {
+			continue
+		}
+		out = append(out, archiveStore{apps[i], s})
+	}
+	return out
+}
+
+// BackupAll takes a backup of every detected store and bundles them into a
+// gzip'd tar archive at `out`, which is restored with RestoreFromArchive.
+func BackupAll(out string) error {
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	n, err := writeArchive(f, detectedStores())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(out)
+		return err
+	}
+	fmt.Printf("Backed up %d store(s) into %s\n", n, out)
+	return nil
+}
+
+// writeArchive backs up each store and writes their backups, along with a
+// manifest, to w. The number of stores included is returned.
+func writeArchive(w io.Writer, stores []archiveStore) (int, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	hostname, _ := os.Hostname()
+	m := manifest{
+		Created:  time.Now().UTC(),
+		Hostname: hostname,
+	}
+	seen := make(map[string]bool)
+	for i := range stores {
+		name, s := stores[i].name, stores[i].s
+		if err := s.Backup(); err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: skipping %s, error taking backup: %v\n", name, err)
+			continue
+		}
+		latest, err := s.GetLatestBackup()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: skipping %s, error finding backup: %v\n", name, err)
+			continue
+		}
+		if latest == "" || seen[latest] { // e.g. chrome uses the platform store on darwin
+			continue
+		}
+		seen[latest] = true
+
+		stamp, err := store.GetBackupStamp(latest)
+		if err != nil {
+			return 0, err
+		}
+		where := path.Join(archiveStores, name, filepath.Base(latest))
+		if err := addToArchive(tw, latest, where); err != nil {
+			return 0, fmt.Errorf("error adding %s backup to archive: %v", name, err)
+		}
+		m.Stores = append(m.Stores, manifestStore{
+			Name:   name,
+			Backup: where,
+			Stamp:  *stamp,
+		})
+	}
+	if len(m.Stores) == 0 {
+		return 0, errors.New("no stores were backed up")
+	}
+
+	bs, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	hdr := &tar.Header{
+		Name:    archiveManifest,
+		Mode:    0600,
+		Size:    int64(len(bs)),
+		ModTime: m.Created,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return 0, err
+	}
+	if _, err := tw.Write(bs); err != nil {
+		return 0, err
+	}
+	if err := tw.Close(); err != nil {
+		return 0, err
+	}
+	return len(m.Stores), gz.Close()
+}
+
+// addToArchive writes the file, or each file under a directory, at `src`
+// into the archive under `dst`.
+func addToArchive(tw *tar.Writer, src, dst string) error {
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join(dst, filepath.ToSlash(rel))
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// RestoreFromArchive restores each store in an archive made by BackupAll.
+// Stores which aren't found on this machine are skipped.
+func RestoreFromArchive(where string, opts RestoreOptions) error {
+	dir, err := ioutil.TempDir("", "cert-manage-archive")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	m, err := extractArchive(where, dir)
+	if err != nil {
+		return err
+	}
+
+	stores := make([]archiveStore, 0, len(m.Stores))
+	backups := make([]string, 0, len(m.Stores))
+	for i := range m.Stores {
+		entry := m.Stores[i]
+		if entry.Stamp.Format > store.BackupFormat {
+			return fmt.Errorf("%s backup is format %d (from cert-manage %s), but this version only understands up to format %d, upgrade cert-manage to restore it", entry.Name, entry.Stamp.Format, entry.Stamp.Version, store.BackupFormat)
+		}
+		s, err := archiveStoreFor(entry.Name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: skipping %s: %v\n", entry.Name, err)
+			continue
+		}
+		backup := filepath.Join(dir, filepath.FromSlash(entry.Backup))
+		if err := store.SetBackupStamp(backup, entry.Stamp); err != nil {
+			return err
+		}
+		if opts.Adapt && entry.Name == platformStoreName {
+			if err := adaptBackup(os.Stderr, backup, m.Hostname); err != nil {
+				return err
+			}
+		}
+		stores = append(stores, archiveStore{entry.Name, s})
+		backups = append(backups, backup)
+	}
+
+	if opts.Diff {
+		if err := archiveDiff(os.Stdout, stores, backups, opts.Format); err != nil {
+			return err
+		}
+	}
+	if !opts.Yes && !store.DryRun() {
+		added, removed := 0, 0
+		for i := range stores {
+			a, r, err := backupChanges(stores[i].s, backups[i])
+			if err != nil {
+				return fmt.Errorf("%s: %v", stores[i].name, err)
+			}
+			added, removed = added+len(a), removed+len(r)
+		}
+		summary := restoreSummary("", "certificate", added, removed)
+		summary = append([]string{fmt.Sprintf("Restoring %d store(s) from %s", len(stores), where)}, summary...)
+		if err := confirmRestore(os.Stdin, os.Stderr, summary); err != nil {
+			return err
+		}
+	}
+	for i := range stores {
+		if err := stores[i].s.Restore(backups[i]); err != nil {
+			return fmt.Errorf("error restoring %s: %v", stores[i].name, err)
+		}
+	}
+	if !(opts.Diff && strings.EqualFold(opts.Format, "json")) {
+		fmt.Printf("Restored %d store(s) from %s\n", len(stores), where)
+	}
+	return nil
+}
+
+// adaptBackup rewrites the platform backup extracted at `backup` for the
+// current user and prints the keychains which moved.
+func adaptBackup(w io.Writer, backup, hostname string) error {
+	changes, err := store.AdaptBackup(backup)
+	if err != nil {
+		return fmt.Errorf("error adapting backup: %v", err)
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	from := "another user"
+	if hostname != "" {
+		from = hostname
+	}
+	fmt.Fprintf(w, "Adapting backup from %s for this user\n", from)
+	for i := range changes {
+		fmt.Fprintf(w, "  %s\n", changes[i])
+	}
+	return nil
+}
+
+func archiveStoreFor(name string) (store.Store, error) {
+	if name == platformStoreName {
+		return store.Platform(), nil
+	}
+	return store.ForApp(name)
+}
+
+// archiveDiff writes the changes restoring each store would make, as a
+// table per store or a json object keyed by store name.
+func archiveDiff(w io.Writer, stores []archiveStore, backups []string, format string) error {
+	diffs := make(map[string]diffJSON)
+	for i := range stores {
+		added, removed, err := backupChanges(stores[i].s, backups[i])
+		if err != nil {
+			return fmt.Errorf("%s: %v", stores[i].name, err)
+		}
+		if strings.EqualFold(format, "json") {
+			diffs[stores[i].name] = newDiffJSON(added, removed)
+			continue
+		}
+		fmt.Fprintf(w, "%s\n", stores[i].name)
+		if err := writeDiffTable(w, added, removed); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+	}
+	if strings.EqualFold(format, "json") {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diffs)
+	}
+	return nil
+}
+
+// extractArchive writes each file of the archive at `where` under dir and
+// returns its manifest.
+func extractArchive(where, dir string) (*manifest, error) {
+	f, err := os.Open(where)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s isn't a backup archive: %v", where, err)
+	}
+	defer gz.Close()
+
+	var m *manifest
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", where, err)
+		}
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("archive entry %q is outside of the archive", hdr.Name)
+		}
+
+		if name == archiveManifest {
+			m = &manifest{}
+			if err := json.NewDecoder(tr).Decode(m); err != nil {
+				return nil, fmt.Errorf("error reading archive manifest: %v", err)
+			}
+			continue
+		}
+
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(dst, file.TempDirPermissions); err != nil {
+				return nil, err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := os.MkdirAll(filepath.Dir(dst), file.TempDirPermissions); err != nil {
+				return nil, err
+			}
+			out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, file.TempFilePermissions)
+			if err != nil {
+				return nil, err
+			}
+			_, err = io.Copy(out, tr)
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if m == nil {
+		return nil, fmt.Errorf("%s doesn't have a manifest, was it made with 'backup -all'?", where)
+	}
+	for i := range m.Stores {
+		b := path.Clean(m.Stores[i].Backup)
+		if path.IsAbs(b) || b == ".." || strings.HasPrefix(b, "../") {
+			return nil, fmt.Errorf("archive backup %q is outside of the archive", m.Stores[i].Backup)
+		}
+	}
+	return m, nil
+}
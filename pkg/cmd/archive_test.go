@@ -0,0 +1,168 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+)
+
+func TestCmdArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bundle := filepath.Join(dir, "bundle.pem")
+	if err := file.CopyFile("../../testdata/lots.crt", bundle); err != nil {
+		t.Fatal(err)
+	}
+	certs, err := certutil.FromFile(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "file:" + bundle
+	s, err := store.ForApp(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive := filepath.Join(dir, "backup.tar.gz")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := writeArchive(f, []archiveStore{{name, s}})
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("archived %d stores", n)
+	}
+	if latest, _ := s.GetLatestBackup(); latest != "" {
+		defer os.RemoveAll(filepath.Dir(latest))
+	}
+
+	m, err := extractArchive(archive, filepath.Join(dir, "extracted"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Stores) != 1 || m.Stores[0].Name != name || m.Stores[0].Stamp.Format != store.BackupFormat {
+		t.Fatalf("got %#v", m)
+	}
+	extracted, err := certutil.FromFile(filepath.Join(dir, "extracted", filepath.FromSlash(m.Stores[0].Backup)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extracted) != len(certs) {
+		t.Errorf("got %d certs, expected %d", len(extracted), len(certs))
+	}
+
+	// change the bundle, then restore it from the archive
+	if err := certutil.ToFile(bundle, certs[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := RestoreFromArchive(archive, RestoreOptions{Yes: true}); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := certutil.FromFile(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != len(certs) {
+		t.Errorf("got %d certs after restore, expected %d", len(restored), len(certs))
+	}
+}
+
+func TestCmdArchive__unsafe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	body := []byte("bad")
+	if err := tw.WriteHeader(&tar.Header{Name: "../../escape", Mode: 0600, Size: int64(len(body))}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write(body)
+	tw.Close()
+	gz.Close()
+
+	archive := filepath.Join(dir, "bad.tar.gz")
+	if err := ioutil.WriteFile(archive, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := extractArchive(archive, filepath.Join(dir, "out")); err == nil {
+		t.Error("expected error")
+	}
+
+	// not an archive
+	if _, err := extractArchive("../../testdata/lots.crt", dir); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestCmdArchive__adapt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	manifest := `{"home": "/Users/someone-else", "keychains": [
+  {"name": "System", "path": "/Library/Keychains/System.keychain", "dir": "System.keychain"},
+  {"name": "login", "path": "/Users/someone-else/Library/Keychains/login.keychain-db", "dir": "login.keychain-db"}
+]}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "manifest.json"), []byte(manifest), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := adaptBackup(&buf, dir, "old-laptop"); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "Adapting backup from old-laptop") || !strings.Contains(out, "login: /Users/someone-else/Library/Keychains/login.keychain-db -> "+file.HomeDir()) {
+		t.Errorf("got %q", out)
+	}
+	if strings.Contains(out, "System") {
+		t.Errorf("System keychain shouldn't move: %q", out)
+	}
+
+	// nothing left to adapt, and backups of other stores are left alone
+	buf.Reset()
+	if err := adaptBackup(&buf, dir, "old-laptop"); err != nil || buf.Len() != 0 {
+		t.Errorf("got %q, err=%v", buf.String(), err)
+	}
+	if err := adaptBackup(&buf, "../../testdata/lots.crt", ""); err != nil || buf.Len() != 0 {
+		t.Errorf("got %q, err=%v", buf.String(), err)
+	}
+}
@@ -0,0 +1,401 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"text/tabwriter"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/crlset"
+	"github.com/adamdecaf/cert-manage/pkg/crtsh"
+	"github.com/adamdecaf/cert-manage/pkg/events"
+	"github.com/adamdecaf/cert-manage/pkg/metrics"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+var (
+	// auditExpiringWithin is how soon a certificate expires before we warn about it
+	auditExpiringWithin = 90 * 24 * time.Hour
+
+	// auditMinRSABits and auditMinECBits are the smallest keys not reported by -weak
+	auditMinRSABits = 2048
+	auditMinECBits  = 256
+
+	// weakSignatureAlgorithms use a hash with known collision attacks
+	weakSignatureAlgorithms = map[x509.SignatureAlgorithm]bool{
+		x509.MD2WithRSA:    true,
+		x509.MD5WithRSA:    true,
+		x509.SHA1WithRSA:   true,
+		x509.DSAWithSHA1:   true,
+		x509.ECDSAWithSHA1: true,
+	}
+)
+
+// AuditOptions changes which problems are looked for
+type AuditOptions struct {
+	// Weak also reports small keys and weak signature algorithms
+	Weak bool
+
+	// Blacklist is where to write a blacklist of weak roots, if non-empty
+	Blacklist string
+
+	// Issuance adds how many certificates each root issued in the last 12 months
+	Issuance bool
+
+	// CRLSet is the path of a Chrome CRLSet to check certificates against,
+	// "download" fetches the current one and "none" skips the check. When
+	// empty the CRLSet Chrome last downloaded is used, if Chrome is installed.
+	CRLSet string
+
+	// Certdata is Mozilla's certdata.txt (or "download") to report roots past
+	// their distrust-after date from, see LoadDistrustAfter
+	Certdata string
+
+	// Whitelist is checked for entries which have expired, or will soon
+	Whitelist string
+}
+
+// finding is a problem the audit found with a certificate
+type finding struct {
+	cert    *x509.Certificate
+	problem string
+}
+
+func AuditForApp(app string, opts AuditOptions) error {
+	if isGPG(app) {
+		return auditGPGKeys(os.Stdout, opts)
+	}
+	s, err := store.ForApp(app)
+	if err != nil {
+		return err
+	}
+	return audit(os.Stdout, s, app, opts)
+}
+
+func AuditForPlatform(opts AuditOptions) error {
+	return audit(os.Stdout, store.Platform(), runtime.GOOS, opts)
+}
+
+func audit(w io.Writer, s store.Store, name string, opts AuditOptions) error {
+	certs, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	err = warnPartial(err)
+	if err != nil {
+		return err
+	}
+	set, err := loadCRLSet(opts.CRLSet)
+	if err != nil {
+		return err
+	}
+	findings := auditCertificates(certs, time.Now())
+	if set != nil {
+		if set.Expired(time.Now()) {
+			fmt.Fprintf(w, "WARNING: Chrome CRLSet %d expired on %s\n", set.Sequence, timeutil.Date(set.NotAfter))
+		}
+		findings = append(findings, auditCRLSet(set, certs)...)
+	}
+	distrustAfter, err := LoadDistrustAfter(opts.Certdata)
+	if err != nil {
+		return err
+	}
+	findings = append(findings, auditDistrustAfter(distrustAfter, certs, time.Now())...)
+	if opts.Whitelist != "" {
+		wh, err := loadWhitelist(opts.Whitelist, "")
+		if err != nil {
+			return err
+		}
+		findings = append(findings, auditWhitelist(w, wh, certs, time.Now())...)
+	}
+	if opts.Weak {
+		weak := auditWeakCertificates(certs)
+		findings = append(findings, weak...)
+		if opts.Blacklist != "" {
+			if err := writeWeakBlacklist(opts.Blacklist, weak); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "Wrote blacklist of %d weak certificates to %s\n", len(weakRoots(weak)), opts.Blacklist)
+		}
+	}
+	metrics.Add(metrics.Violations, len(findings))
+	for i := range findings {
+		events.Emit(events.Event{
+			Action:      events.Finding,
+			Store:       name,
+			Certificate: findings[i].cert,
+			Reason:      findings[i].problem,
+		})
+	}
+	if len(findings) == 0 {
+		fmt.Fprintf(w, "No problems found in %d certificates\n", len(certs))
+		return nil
+	}
+
+	var issuance map[string]int
+	if opts.Issuance {
+		issuance, err = crtsh.Issuance(weakRoots(findings), time.Now().Add(-1*issuanceWindow))
+		if err != nil {
+			return err
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	header := "Problem\tSubject\tSHA256 Fingerprint\tNot After"
+	if opts.Issuance {
+		header += "\tIssued (12mo)"
+	}
+	fmt.Fprintln(tw, header)
+	for i := range findings {
+		c := findings[i].cert
+		fp := certutil.GetHexSHA256Fingerprint(*c)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s", findings[i].problem, certutil.StringifyPKIXName(c.Subject), fp[:16], timeutil.Date(c.NotAfter))
+		if opts.Issuance {
+			if n, ok := issuance[fp]; ok {
+				fmt.Fprintf(tw, "\t%d", n)
+			} else {
+				fmt.Fprint(tw, "\t-")
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+func auditCertificates(certs []*x509.Certificate, now time.Time) []finding {
+	var out []finding
+	for i := range certs {
+		c := certs[i]
+		switch {
+		case whitelist.IsBlacklisted(c):
+			out = append(out, finding{c, "blacklisted"})
+		case now.After(c.NotAfter):
+			out = append(out, finding{c, "expired"})
+		case now.Before(c.NotBefore):
+			out = append(out, finding{c, "not yet valid"})
+		case now.Add(auditExpiringWithin).After(c.NotAfter):
+			out = append(out, finding{c, "expiring soon"})
+		}
+	}
+	return out
+}
+
+// auditWhitelist warns about whitelist entries which have expired or expire
+// soon, and reports certificates only an expired entry kept. Those will be
+// removed the next time the whitelist is applied.
+func auditWhitelist(w io.Writer, wh whitelist.Whitelist, certs []*x509.Certificate, now time.Time) []finding {
+	for i := range wh.Entries {
+		e := wh.Entries[i]
+		at, err := e.ExpiresAt()
+		if err != nil || at.IsZero() {
+			continue
+		}
+		switch {
+		case e.Expired(now):
+			fmt.Fprintf(w, "WARNING: whitelist entry for %s expired on %s\n", describeEntry(e), e.Expires)
+		case now.Add(auditExpiringWithin).After(at):
+			fmt.Fprintf(w, "WARNING: whitelist entry for %s expires on %s\n", describeEntry(e), e.Expires)
+		}
+	}
+
+	expired := wh.ExpiredEntries(now)
+	var out []finding
+	for i := range certs {
+		if wh.Matches(certs[i]) {
+			continue
+		}
+		for j := range expired {
+			if expired[j].Matches(certs[i]) {
+				out = append(out, finding{certs[i], "whitelist entry expired"})
+				break
+			}
+		}
+	}
+	return out
+}
+
+// describeEntry names a whitelist entry by its first fingerprint or key
+func describeEntry(e whitelist.Entry) string {
+	items := append(append([]string(nil), e.Fingerprints...), e.Keys...)
+	if len(items) == 0 {
+		return "nothing"
+	}
+	desc := items[0]
+	if len(desc) > 16 {
+		desc = desc[:16]
+	}
+	if len(items) > 1 {
+		desc += fmt.Sprintf(" (and %d more)", len(items)-1)
+	}
+	if a := e.Annotation(); a != "" {
+		desc += " [" + a + "]"
+	}
+	return desc
+}
+
+// loadCRLSet returns the CRLSet described by AuditOptions.CRLSet, or nil
+// if there isn't one to check against.
+func loadCRLSet(where string) (*crlset.CRLSet, error) {
+	switch where {
+	case "none":
+		return nil, nil
+	case "download":
+		return crlset.Download()
+	case "":
+		where = crlset.Find()
+		if where == "" {
+			return nil, nil
+		}
+		set, err := crlset.Load(where)
+		if err != nil {
+			// Chrome's own copy being unreadable shouldn't fail the audit
+			fmt.Fprintf(os.Stderr, "WARNING: skipped Chrome CRLSet %s: %v\n", where, err)
+			return nil, nil
+		}
+		return set, nil
+	}
+	return crlset.Load(where)
+}
+
+// revocations is what Chrome's CRLSet knows about a certificate
+type revocations interface {
+	Blocked(c *x509.Certificate) bool
+	Revoked(c, issuer *x509.Certificate) bool
+}
+
+// auditCRLSet reports certificates which Chrome refuses to trust even
+// though they're in the store, because their key is blocked or their
+// issuer revoked them.
+func auditCRLSet(set revocations, certs []*x509.Certificate) []finding {
+	var out []finding
+	for i := range certs {
+		c := certs[i]
+		if set.Blocked(c) {
+			out = append(out, finding{c, "blocked by Chrome CRLSet"})
+			continue
+		}
+		issuer := c
+		if !isSelfSigned(c) {
+			issuer = findIssuer(c, certs)
+		}
+		if set.Revoked(c, issuer) {
+			out = append(out, finding{c, "revoked by Chrome CRLSet"})
+		}
+	}
+	return out
+}
+
+// auditWeakCertificates reports roots with small keys or weak signatures.
+//
+// The signature on a root isn't checked when it's used, so a root's own
+// signature is ignored. Instead any certificate in `certs` it has issued
+// with a weak signature (e.g. a SHA-1 intermediate) is reported against
+// the issuing root.
+func auditWeakCertificates(certs []*x509.Certificate) []finding {
+	var out []finding
+	for i := range certs {
+		c := certs[i]
+		if problem := weakKey(c); problem != "" {
+			out = append(out, finding{c, problem})
+		}
+		if isSelfSigned(c) || !weakSignatureAlgorithms[c.SignatureAlgorithm] {
+			continue
+		}
+		issuer := findIssuer(c, certs)
+		if issuer == nil {
+			out = append(out, finding{c, fmt.Sprintf("%s signature", c.SignatureAlgorithm)})
+			continue
+		}
+		out = append(out, finding{issuer, fmt.Sprintf("issued %s signed %s", c.SignatureAlgorithm, certutil.StringifyPKIXName(c.Subject))})
+	}
+	return out
+}
+
+// weakKey returns a description of why a certificate's public key is weak,
+// or an empty string.
+func weakKey(c *x509.Certificate) string {
+	switch k := c.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < auditMinRSABits {
+			return fmt.Sprintf("RSA %d bit key", k.N.BitLen())
+		}
+	case *ecdsa.PublicKey:
+		if size := k.Curve.Params().BitSize; size < auditMinECBits {
+			return fmt.Sprintf("ECDSA %d bit key", size)
+		}
+	case *dsa.PublicKey:
+		return fmt.Sprintf("DSA %d bit key", k.P.BitLen())
+	}
+	return ""
+}
+
+// isSelfSigned checks names rather than the signature, which newer
+// versions of Go refuse to verify for SHA-1.
+func isSelfSigned(c *x509.Certificate) bool {
+	return bytes.Equal(c.RawIssuer, c.RawSubject)
+}
+
+// findIssuer returns the certificate in `certs` which issued c, if any
+func findIssuer(c *x509.Certificate, certs []*x509.Certificate) *x509.Certificate {
+	for i := range certs {
+		if certs[i] != c && issuedBy(c, certs[i]) {
+			return certs[i]
+		}
+	}
+	return nil
+}
+
+// issuedBy checks names and key identifiers, like isSelfSigned, rather than
+// the signature.
+func issuedBy(c, issuer *x509.Certificate) bool {
+	if !bytes.Equal(c.RawIssuer, issuer.RawSubject) {
+		return false
+	}
+	if len(c.AuthorityKeyId) > 0 && len(issuer.SubjectKeyId) > 0 && !bytes.Equal(c.AuthorityKeyId, issuer.SubjectKeyId) {
+		return false
+	}
+	return true
+}
+
+// weakRoots returns the unique certificates from findings
+func weakRoots(findings []finding) []*x509.Certificate {
+	pool := certutil.Pool{}
+	for i := range findings {
+		pool.Add(findings[i].cert)
+	}
+	return pool.GetCertificates()
+}
+
+// writeWeakBlacklist writes the certificates of findings as a blacklist,
+// which can be applied with `cert-manage blacklist -file <path>`
+func writeWeakBlacklist(path string, findings []finding) error {
+	certs := weakRoots(findings)
+	bl := whitelist.Whitelist{}
+	for i := range certs {
+		bl.Fingerprints = append(bl.Fingerprints, certutil.GetHexSHA256Fingerprint(*certs[i]))
+	}
+	return bl.ToFile(path)
+}
@@ -0,0 +1,285 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+func TestCmdAudit__certificates(t *testing.T) {
+	t.Parallel()
+
+	certs, err := certutil.FromFile("../../testdata/example.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := certs[0]
+
+	cases := map[time.Time]string{
+		cert.NotBefore.Add(-1 * time.Hour): "not yet valid",
+		cert.NotBefore.Add(24 * time.Hour): "",
+		cert.NotAfter.Add(-24 * time.Hour): "expiring soon",
+		cert.NotAfter.Add(24 * time.Hour):  "expired",
+	}
+	for when, problem := range cases {
+		findings := auditCertificates(certs, when)
+		if problem == "" {
+			if len(findings) != 0 {
+				t.Errorf("%v: expected no findings, got %v", when, findings)
+			}
+			continue
+		}
+		if len(findings) != 1 || findings[0].problem != problem {
+			t.Errorf("%v: expected %q, got %v", when, problem, findings)
+		}
+	}
+}
+
+func rsaKey(bits int) *rsa.PublicKey {
+	return &rsa.PublicKey{
+		N: new(big.Int).Lsh(big.NewInt(1), uint(bits-1)),
+		E: 65537,
+	}
+}
+
+func TestCmdAudit__weak(t *testing.T) {
+	t.Parallel()
+
+	root := &x509.Certificate{
+		Raw:                []byte("root"),
+		RawSubject:         []byte("root"),
+		RawIssuer:          []byte("root"),
+		SubjectKeyId:       []byte{1},
+		PublicKey:          rsaKey(4096),
+		SignatureAlgorithm: x509.SHA1WithRSA, // ignored on roots
+	}
+	ca, err := testca.NewRoot("Small Root CA", &testca.Options{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	small := ca.Certificate
+	curve := &x509.Certificate{
+		Raw:                []byte("curve"),
+		RawSubject:         []byte("curve"),
+		RawIssuer:          []byte("curve"),
+		PublicKey:          &ecdsa.PublicKey{Curve: elliptic.P224()},
+		SignatureAlgorithm: x509.ECDSAWithSHA256,
+	}
+	intermediate := &x509.Certificate{
+		Raw:                []byte("intermediate"),
+		RawSubject:         []byte("intermediate"),
+		RawIssuer:          []byte("root"),
+		AuthorityKeyId:     []byte{1},
+		PublicKey:          rsaKey(2048),
+		SignatureAlgorithm: x509.SHA1WithRSA,
+	}
+	fine := &x509.Certificate{
+		Raw:                []byte("fine"),
+		RawSubject:         []byte("fine"),
+		RawIssuer:          []byte("fine"),
+		PublicKey:          &ecdsa.PublicKey{Curve: elliptic.P384()},
+		SignatureAlgorithm: x509.ECDSAWithSHA384,
+	}
+
+	findings := auditWeakCertificates([]*x509.Certificate{root, small, curve, intermediate, fine})
+	expected := map[*x509.Certificate]string{
+		small: "RSA 1024 bit key",
+		curve: "ECDSA 224 bit key",
+		root:  "issued SHA1-RSA signed ",
+	}
+	if len(findings) != len(expected) {
+		t.Fatalf("got %d findings: %v", len(findings), findings)
+	}
+	for i := range findings {
+		if problem, ok := expected[findings[i].cert]; !ok || findings[i].problem != problem {
+			t.Errorf("unexpected finding %q for %s", findings[i].problem, findings[i].cert.Raw)
+		}
+	}
+
+	// without its root the intermediate is reported
+	findings = auditWeakCertificates([]*x509.Certificate{intermediate})
+	if len(findings) != 1 || findings[0].cert != intermediate || findings[0].problem != "SHA1-RSA signature" {
+		t.Errorf("got %v", findings)
+	}
+}
+
+func TestCmdAudit__weakBlacklist(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "cert-manage-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same certificate twice is only written once
+	findings := []finding{{certs[0], "a"}, {certs[0], "b"}, {certs[1], "c"}}
+
+	path := filepath.Join(dir, "weak.yaml")
+	if err := writeWeakBlacklist(path, findings); err != nil {
+		t.Fatal(err)
+	}
+	bl, err := whitelist.FromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bl.Fingerprints) != 2 {
+		t.Errorf("got %d fingerprints", len(bl.Fingerprints))
+	}
+	if !bl.Matches(certs[0]) || !bl.Matches(certs[1]) {
+		t.Error("expected blacklist to match weak certificates")
+	}
+}
+
+// fakeCRLSet blocks and revokes certificates by their Raw bytes
+type fakeCRLSet struct {
+	blocked map[string]bool
+	revoked map[string]string // cert -> issuer
+}
+
+func (s fakeCRLSet) Blocked(c *x509.Certificate) bool {
+	return s.blocked[string(c.Raw)]
+}
+
+func (s fakeCRLSet) Revoked(c, issuer *x509.Certificate) bool {
+	return issuer != nil && s.revoked[string(c.Raw)] == string(issuer.Raw)
+}
+
+func TestCmdAudit__crlset(t *testing.T) {
+	t.Parallel()
+
+	root := &x509.Certificate{
+		Raw:        []byte("root"),
+		RawSubject: []byte("root"),
+		RawIssuer:  []byte("root"),
+	}
+	blocked := &x509.Certificate{
+		Raw:        []byte("blocked"),
+		RawSubject: []byte("blocked"),
+		RawIssuer:  []byte("blocked"),
+	}
+	intermediate := &x509.Certificate{
+		Raw:        []byte("intermediate"),
+		RawSubject: []byte("intermediate"),
+		RawIssuer:  []byte("root"),
+	}
+	set := fakeCRLSet{
+		blocked: map[string]bool{"blocked": true},
+		revoked: map[string]string{"intermediate": "root"},
+	}
+
+	findings := auditCRLSet(set, []*x509.Certificate{root, blocked, intermediate})
+	if len(findings) != 2 {
+		t.Fatalf("got %d findings: %v", len(findings), findings)
+	}
+	if findings[0].cert != blocked || findings[0].problem != "blocked by Chrome CRLSet" {
+		t.Errorf("got %v", findings[0])
+	}
+	if findings[1].cert != intermediate || findings[1].problem != "revoked by Chrome CRLSet" {
+		t.Errorf("got %v", findings[1])
+	}
+
+	// without its issuer the intermediate can't be checked
+	if findings := auditCRLSet(set, []*x509.Certificate{intermediate}); len(findings) != 0 {
+		t.Errorf("got %v", findings)
+	}
+}
+
+func TestCmdAudit__distrustAfter(t *testing.T) {
+	t.Parallel()
+
+	certs, err := certutil.FromFile("../../testdata/example.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	when := time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC)
+	dates := map[string]time.Time{
+		certutil.GetHexSHA256Fingerprint(*certs[0]): when,
+	}
+
+	if findings := auditDistrustAfter(dates, certs, when.Add(-24*time.Hour)); len(findings) != 0 {
+		t.Errorf("got %v", findings)
+	}
+	findings := auditDistrustAfter(dates, certs, when.Add(24*time.Hour))
+	if len(findings) != 1 || findings[0].problem != "distrusted since 2019-12-01" {
+		t.Errorf("got %v", findings)
+	}
+}
+
+func TestCmdAudit__embeddedDistrustAfter(t *testing.T) {
+	// the built-in snapshot is from a PEM bundle, without distrust-after dates
+	if _, err := LoadDistrustAfter("embedded"); err == nil || !strings.Contains(err.Error(), "no distrust-after dates") {
+		t.Errorf("expected error, got %v", err)
+	}
+}
+
+func TestCmdAudit__whitelistExpiry(t *testing.T) {
+	t.Parallel()
+
+	temp, err := testca.NewRoot("Vendor Root CA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := testca.NewRoot("Kept Root CA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs := []*x509.Certificate{temp.Certificate, kept.Certificate}
+	wh := whitelist.Whitelist{
+		Fingerprints: []string{certutil.GetHexSHA256Fingerprint(*kept.Certificate)},
+		Entries: []whitelist.Entry{
+			{Fingerprints: []string{certutil.GetHexSHA256Fingerprint(*temp.Certificate)}, Expires: "2025-12-31"},
+			{Fingerprints: []string{certutil.GetHexSHA256Fingerprint(*kept.Certificate)}, Expires: "2025-01-31"},
+		},
+	}
+
+	// expiring soon is only a warning
+	var buf bytes.Buffer
+	if findings := auditWhitelist(&buf, wh, certs, time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)); len(findings) != 0 {
+		t.Errorf("got %v", findings)
+	}
+	if out := buf.String(); !strings.Contains(out, "expires on 2025-12-31") || !strings.Contains(out, "expired on 2025-01-31") {
+		t.Errorf("got %q", out)
+	}
+
+	// certificates only an expired entry kept are reported
+	buf.Reset()
+	findings := auditWhitelist(&buf, wh, certs, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	if len(findings) != 1 || findings[0].cert != temp.Certificate || findings[0].problem != "whitelist entry expired" {
+		t.Errorf("got %v", findings)
+	}
+	if !strings.Contains(buf.String(), "expired on 2025-12-31") {
+		t.Errorf("got %q", buf.String())
+	}
+}
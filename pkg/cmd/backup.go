@@ -21,6 +21,12 @@ import (
 )
 
 func BackupForApp(app string) error {
+	if isGPG(app) {
+		return backupGPG()
+	}
+	if isSSH(app) {
+		return backupSSH()
+	}
 	s, err := store.ForApp(app)
 	if err != nil {
 		return err
@@ -0,0 +1,84 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"runtime"
+
+	"github.com/adamdecaf/cert-manage/pkg/events"
+	"github.com/adamdecaf/cert-manage/pkg/metrics"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+func BlacklistForApp(app, path, profile string) error {
+	s, err := store.ForApp(app)
+	if err != nil {
+		return err
+	}
+	return blacklist(s, app, path, profile)
+}
+
+func BlacklistForPlatform(path, profile string) error {
+	return blacklist(store.Platform(), runtime.GOOS, path, profile)
+}
+
+// blacklist removes trust from each certificate matching the blacklist.
+// Blacklists are read in the same format as whitelists.
+func blacklist(s store.Store, name, path, profile string) error {
+	bl, err := loadWhitelist(path, profile)
+	if err != nil {
+		return err
+	}
+
+	// check for a backup
+	latest, err := s.GetLatestBackup()
+	if err != nil {
+		return fmt.Errorf("can't get latest %s backup err=%v", name, err)
+	}
+	if latest == "" {
+		return fmt.Errorf("no %s backup found", name)
+	}
+
+	// keep every certificate which isn't blacklisted
+	certs, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	if err != nil {
+		return err
+	}
+	var kept, removed []*x509.Certificate
+	for i := range certs {
+		if bl.Matches(certs[i]) {
+			removed = append(removed, certs[i])
+		} else {
+			kept = append(kept, certs[i])
+		}
+	}
+
+	err = s.Remove(whitelist.FromCertificates(kept))
+	if err != nil {
+		return err
+	}
+	if !store.DryRun() {
+		metrics.Add(metrics.CertificatesRemoved, len(removed))
+		events.EmitEach(events.Removed, name, "blacklisted", removed)
+	}
+
+	fmt.Println("Blacklist completed successfully")
+	return nil
+}
@@ -0,0 +1,191 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+)
+
+var (
+	// calendarReminder is how long before an expiration its event alerts
+	calendarReminder = "-P30D"
+
+	icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+)
+
+// expiringRoot is a certificate and the stores trusting it
+type expiringRoot struct {
+	cert   *x509.Certificate
+	stores []string
+}
+
+// ExportCalendarForApp writes an iCalendar file with an event for each
+// upcoming expiration of a certificate trusted by app.
+func ExportCalendarForApp(app, where string) error {
+	s, err := store.ForApp(app)
+	if err != nil {
+		return err
+	}
+	roots := make(map[string]*expiringRoot)
+	if err := addExpiringRoots(roots, app, s); err != nil {
+		return err
+	}
+	return writeCalendarFile(where, roots)
+}
+
+// ExportCalendarForPlatform writes an iCalendar file with an event for each
+// upcoming expiration of a certificate trusted by the platform or any
+// installed app.
+func ExportCalendarForPlatform(where string) error {
+	roots := make(map[string]*expiringRoot)
+	if err := addExpiringRoots(roots, runtime.GOOS, store.Platform()); err != nil {
+		return err
+	}
+	apps := append(store.GetApps(), store.GetSandboxedApps()...)
+	for i := range apps {
+		s, err := store.ForApp(apps[i])
+		if err != nil {
+			continue
+		}
+		// apps which aren't installed fail to list
+		if err := addExpiringRoots(roots, apps[i], s); err != nil && debug {
+			fmt.Printf("cmd: skipping %s for calendar: %v\n", apps[i], err)
+		}
+	}
+	return writeCalendarFile(where, roots)
+}
+
+func addExpiringRoots(roots map[string]*expiringRoot, name string, s store.Store) error {
+	certs, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	if err = warnPartial(err); err != nil {
+		return err
+	}
+	for i := range certs {
+		fp := certutil.GetHexSHA256Fingerprint(*certs[i])
+		if r, ok := roots[fp]; ok {
+			r.stores = append(r.stores, name)
+			continue
+		}
+		roots[fp] = &expiringRoot{
+			cert:   certs[i],
+			stores: []string{name},
+		}
+	}
+	return nil
+}
+
+func writeCalendarFile(where string, roots map[string]*expiringRoot) error {
+	var buf bytes.Buffer
+	n, err := writeCalendar(&buf, roots, time.Now())
+	if err != nil {
+		return err
+	}
+	fd, err := os.OpenFile(where, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, file.TempFilePermissions)
+	if err != nil {
+		return err
+	}
+	if _, err := fd.Write(buf.Bytes()); err != nil {
+		fd.Close()
+		return err
+	}
+	if err := fd.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d upcoming expirations to %s\n", n, where)
+	return nil
+}
+
+// writeCalendar writes an iCalendar (RFC 5545) with an all day event, and a
+// reminder, for each certificate expiring after now. The number of events
+// is returned.
+func writeCalendar(w io.Writer, roots map[string]*expiringRoot, now time.Time) (int, error) {
+	var upcoming []*expiringRoot
+	for _, r := range roots {
+		if r.cert.NotAfter.After(now) {
+			upcoming = append(upcoming, r)
+		}
+	}
+	sort.Slice(upcoming, func(i, j int) bool {
+		return upcoming[i].cert.NotAfter.Before(upcoming[j].cert.NotAfter)
+	})
+
+	var lines []string
+	lines = append(lines, "BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//cert-manage//expirations//EN", "CALSCALE:GREGORIAN")
+	stamp := now.UTC().Format("20060102T150405Z")
+	for i := range upcoming {
+		c := upcoming[i].cert
+		fp := certutil.GetHexSHA256Fingerprint(*c)
+		name := certutil.StringifyPKIXName(c.Subject)
+		day := c.NotAfter.UTC()
+		desc := fmt.Sprintf("%s expires %s.\nSHA256: %s\nTrusted by: %s", name, day.Format(time.RFC3339), fp, strings.Join(upcoming[i].stores, ", "))
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:%s@cert-manage", fp),
+			"DTSTAMP:"+stamp,
+			"DTSTART;VALUE=DATE:"+day.Format("20060102"),
+			"DTEND;VALUE=DATE:"+day.AddDate(0, 0, 1).Format("20060102"),
+			"SUMMARY:"+icsEscaper.Replace("Certificate expires: "+name),
+			"DESCRIPTION:"+icsEscaper.Replace(desc),
+			"BEGIN:VALARM",
+			"ACTION:DISPLAY",
+			"DESCRIPTION:"+icsEscaper.Replace(name+" expires soon"),
+			"TRIGGER:"+calendarReminder,
+			"END:VALARM",
+			"END:VEVENT",
+		)
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	for i := range lines {
+		if _, err := io.WriteString(w, foldICSLine(lines[i])+"\r\n"); err != nil {
+			return 0, err
+		}
+	}
+	return len(upcoming), nil
+}
+
+// foldICSLine splits lines longer than 75 octets, continuation lines start
+// with a space. UTF-8 sequences aren't split.
+func foldICSLine(line string) string {
+	if len(line) <= 75 {
+		return line
+	}
+	var buf bytes.Buffer
+	width := 0
+	for _, r := range line {
+		n := len(string(r))
+		if width+n > 75 {
+			buf.WriteString("\r\n ")
+			width = 1
+		}
+		buf.WriteRune(r)
+		width += n
+	}
+	return buf.String()
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+)
+
+func TestCmdCalendar__write(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := make(map[string]*expiringRoot)
+	if err := addExpiringRoots(roots, "darwin", store.MemoryStore(certs)); err != nil {
+		t.Fatal(err)
+	}
+	if err := addExpiringRoots(roots, "firefox", store.MemoryStore(certs[:1])); err != nil {
+		t.Fatal(err)
+	}
+
+	// only certificates expiring after 'now' are written
+	now := certs[0].NotAfter.Add(-1 * time.Hour)
+	expected := 0
+	for i := range certs {
+		if certs[i].NotAfter.After(now) {
+			expected++
+		}
+	}
+
+	var buf bytes.Buffer
+	n, err := writeCalendar(&buf, roots, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != expected {
+		t.Errorf("got %d events, expected %d", n, expected)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "BEGIN:VCALENDAR\r\n") || !strings.HasSuffix(out, "END:VCALENDAR\r\n") {
+		t.Errorf("got %q", out)
+	}
+	if strings.Count(out, "BEGIN:VEVENT") != expected {
+		t.Errorf("got %d events", strings.Count(out, "BEGIN:VEVENT"))
+	}
+	if !strings.Contains(out, "DTSTART;VALUE=DATE:"+certs[0].NotAfter.UTC().Format("20060102")) {
+		t.Error("missing first certificate's expiration")
+	}
+	// unfold and check both stores are listed
+	if !strings.Contains(strings.Replace(out, "\r\n ", "", -1), `Trusted by: darwin\, firefox`) {
+		t.Errorf("missing stores in %q", out)
+	}
+	for _, line := range strings.Split(out, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line longer than 75 octets: %q", line)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+// orphanedIntermediates returns the whitelisted certificates of a store which
+// aren't self-signed and only chain to certificates the whitelist removes.
+// Other tools (e.g. chain builders) get confused by these leftovers.
+//
+// Intermediates without an issuer in the store aren't returned, their issuer
+// is trusted elsewhere. Issuers already removed (e.g. by an earlier whitelist)
+// are given as `distrusted`, they're only in the store's backup.
+func orphanedIntermediates(certs, distrusted []*x509.Certificate, wh whitelist.Whitelist) []*x509.Certificate {
+	all := append(append([]*x509.Certificate{}, certs...), distrusted...)
+	kept := wh.MatchEach(all)
+	for i := len(certs); i < len(all); i++ {
+		kept[i] = false
+	}
+
+	// issuers[i] is the index of each certificate which issued certs[i]
+	issuers := make([][]int, len(certs))
+	for i := range certs {
+		if isSelfSigned(certs[i]) {
+			continue
+		}
+		for j := range all {
+			if i != j && issuedBy(certs[i], all[j]) {
+				issuers[i] = append(issuers[i], j)
+			}
+		}
+	}
+
+	// Removing an intermediate can orphan what it issued, so repeat until
+	// nothing changes.
+	var out []*x509.Certificate
+	for changed := true; changed; {
+		changed = false
+		for i := range certs {
+			if !kept[i] || len(issuers[i]) == 0 {
+				continue
+			}
+			orphaned := true
+			for _, j := range issuers[i] {
+				if kept[j] {
+					orphaned = false
+					break
+				}
+			}
+			if orphaned {
+				kept[i] = false
+				out = append(out, certs[i])
+				changed = true
+			}
+		}
+	}
+	return out
+}
+
+// distrustedSince returns the certificates in s's latest backup which s no
+// longer trusts
+func distrustedSince(s store.Store, trusted []*x509.Certificate) ([]*x509.Certificate, error) {
+	backup, err := store.ListBackup(s, "")
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]bool, len(trusted))
+	for i := range trusted {
+		current[certutil.GetHexSHA256Fingerprint(*trusted[i])] = true
+	}
+	var out []*x509.Certificate
+	for i := range backup {
+		if !current[certutil.GetHexSHA256Fingerprint(*backup[i])] {
+			out = append(out, backup[i])
+		}
+	}
+	return out, nil
+}
+
+// cascadeWhitelist returns wh narrowed to the certificates it keeps, minus
+// orphans, so applying it removes them as well.
+func cascadeWhitelist(certs []*x509.Certificate, wh whitelist.Whitelist, orphans []*x509.Certificate) whitelist.Whitelist {
+	removed := make(map[string]bool, len(orphans))
+	for i := range orphans {
+		removed[certutil.GetHexSHA256Fingerprint(*orphans[i])] = true
+	}
+	out := whitelist.Whitelist{
+		Usages: wh.Usages,
+	}
+	matches := wh.MatchEach(certs)
+	for i := range certs {
+		fp := certutil.GetHexSHA256Fingerprint(*certs[i])
+		if matches[i] && !removed[fp] {
+			out.Fingerprints = append(out.Fingerprints, fp)
+		}
+	}
+	return out
+}
+
+func printOrphans(w io.Writer, orphans []*x509.Certificate, cascade bool) {
+	if cascade {
+		fmt.Fprintf(w, "Removing %d intermediate(s) which only chain to removed roots:\n", len(orphans))
+	} else {
+		fmt.Fprintf(w, "Warning: %d intermediate(s) only chain to removed roots and are left behind (use -cascade to remove them):\n", len(orphans))
+	}
+	for i := range orphans {
+		fp := certutil.GetHexSHA256Fingerprint(*orphans[i])
+		fmt.Fprintf(w, "  %s (%s) issued by %s\n", certutil.StringifyPKIXName(orphans[i].Subject), fp[:16], certutil.StringifyPKIXName(orphans[i].Issuer))
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+func TestCmdCascade__orphanedIntermediates(t *testing.T) {
+	removed, err := testca.NewHierarchy("removed.example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested, err := removed.Intermediate.NewIntermediate("Nested Intermediate", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := testca.NewHierarchy("kept.example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := testca.NewHierarchy("other.example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certs := []*x509.Certificate{
+		removed.Root.Certificate,
+		removed.Intermediate.Certificate,
+		nested.Certificate,
+		kept.Root.Certificate,
+		kept.Intermediate.Certificate,
+		other.Intermediate.Certificate, // its root isn't in the store
+	}
+	wh := whitelist.FromCertificates(certs[1:])
+
+	orphans := orphanedIntermediates(certs, nil, wh)
+	if len(orphans) != 2 || orphans[0] != removed.Intermediate.Certificate || orphans[1] != nested.Certificate {
+		t.Fatalf("got %d orphans", len(orphans))
+	}
+
+	var buf bytes.Buffer
+	printOrphans(&buf, orphans, false)
+	if !strings.Contains(buf.String(), "use -cascade") || !strings.Contains(buf.String(), "Nested Intermediate") {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+
+	// without -cascade the orphans are kept
+	opts := WhitelistOptions{Force: true}
+	s := store.MemoryStore(certs)
+	if err := s.Backup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyWhitelist(s, "cascade-test", wh, opts); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := s.List(nil); len(after) != 5 {
+		t.Errorf("got %d certificates", len(after))
+	}
+
+	// -cascade after a plain run isn't "already applied"
+	if err := applyWhitelist(s, "cascade-test", wh, WhitelistOptions{Cascade: true}); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := s.List(nil); len(after) != 3 {
+		t.Errorf("got %d certificates after -cascade", len(after))
+	}
+
+	// with -cascade they're removed too
+	opts.Cascade = true
+	s = store.MemoryStore(certs)
+	if err := s.Backup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyWhitelist(s, "cascade-test", wh, opts); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := s.List(nil)
+	if len(after) != 3 {
+		t.Errorf("got %d certificates", len(after))
+	}
+	for i := range after {
+		if after[i].Equal(nested.Certificate) || after[i].Equal(removed.Intermediate.Certificate) {
+			t.Errorf("%s wasn't removed", after[i].Subject.CommonName)
+		}
+	}
+}
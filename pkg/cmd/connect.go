@@ -29,6 +29,7 @@ func ConnectWithPlatformStore(uri *url.URL) error {
 	certs, err := st.List(&store.ListOptions{
 		Trusted: true,
 	})
+	err = warnPartial(err)
 	if err != nil {
 		return fmt.Errorf("problem getting certs: %v", err)
 	}
@@ -43,6 +44,7 @@ func ConnectWithAppStore(uri *url.URL, app string) error {
 	certs, err := st.List(&store.ListOptions{
 		Trusted: true,
 	})
+	err = warnPartial(err)
 	if err != nil {
 		return fmt.Errorf("problem getting certs for %q: %v", app, err)
 	}
@@ -61,14 +63,7 @@ func connect(uri *url.URL, roots []*x509.Certificate) error {
 		pool.AddCert(roots[i])
 	}
 
-	client := httputil.New()
-	tr, ok := client.Transport.(*http.Transport)
-	if ok {
-		tr.TLSClientConfig.RootCAs = pool
-	}
-	client.Transport = tr
-
-	resp, err := client.Do(req)
+	resp, err := httputil.WithRoots(pool).Do(req)
 	if err != nil {
 		return fmt.Errorf("problem with HEAD to %s: %v", uri.String(), err)
 	}
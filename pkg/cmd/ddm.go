@@ -0,0 +1,147 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+const (
+	// ddmCertificates and ddmDeclarations are the directories of a ddm
+	// export, the certificates are served from -url for devices to download.
+	ddmCertificates = "certificates"
+	ddmDeclarations = "declarations"
+
+	ddmIdentifier = "com.github.adamdecaf.cert-manage"
+)
+
+// declaration is an Apple declarative device management declaration
+type declaration struct {
+	Type        string      `json:"Type"`
+	Identifier  string      `json:"Identifier"`
+	ServerToken string      `json:"ServerToken"`
+	Payload     interface{} `json:"Payload"`
+}
+
+// newDeclaration fills in a ServerToken which changes with the payload, so
+// devices notice updates
+func newDeclaration(typ, id string, payload interface{}) (declaration, error) {
+	bs, err := json.Marshal(payload)
+	if err != nil {
+		return declaration{}, err
+	}
+	sum := sha256.Sum256(bs)
+	return declaration{
+		Type:        typ,
+		Identifier:  id,
+		ServerToken: hex.EncodeToString(sum[:8]),
+		Payload:     payload,
+	}, nil
+}
+
+// writeDDM writes an asset and configuration declaration installing each
+// certificate, and an activation of them all. Certificates are written as DER
+// under dir/certificates, which has to be served from `baseURL`.
+func writeDDM(dir, baseURL string, certs []*x509.Certificate) error {
+	if err := clearDDM(dir); err != nil {
+		return err
+	}
+	for _, sub := range []string{ddmCertificates, ddmDeclarations} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return err
+		}
+	}
+
+	var configurations []string
+	for i := range certs {
+		fp := certutil.GetHexSHA256Fingerprint(*certs[i])
+		name := fp + ".cer"
+		if err := ioutil.WriteFile(filepath.Join(dir, ddmCertificates, name), certs[i].Raw, 0644); err != nil {
+			return err
+		}
+
+		asset, err := newDeclaration("com.apple.asset.credential.certificate", ddmIdentifier+".asset."+fp[:16], map[string]interface{}{
+			"Reference": map[string]interface{}{
+				"DataURL":      strings.TrimSuffix(baseURL, "/") + "/" + name,
+				"ContentType":  "application/pkix-cert",
+				"Size":         len(certs[i].Raw),
+				"Hash-SHA-256": fp,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		config, err := newDeclaration("com.apple.configuration.security.certificate", ddmIdentifier+".certificate."+fp[:16], map[string]interface{}{
+			"CredentialAssetReference": asset.Identifier,
+		})
+		if err != nil {
+			return err
+		}
+		for _, d := range []declaration{asset, config} {
+			if err := writeDeclaration(dir, d); err != nil {
+				return err
+			}
+		}
+		configurations = append(configurations, config.Identifier)
+	}
+
+	activation, err := newDeclaration("com.apple.activation.simple", ddmIdentifier+".activation", map[string]interface{}{
+		"StandardConfigurations": configurations,
+	})
+	if err != nil {
+		return err
+	}
+	return writeDeclaration(dir, activation)
+}
+
+func writeDeclaration(dir string, d declaration) error {
+	bs, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := strings.TrimPrefix(d.Identifier, ddmIdentifier+".") + ".json"
+	return ioutil.WriteFile(filepath.Join(dir, ddmDeclarations, name), append(bs, '\n'), 0644)
+}
+
+// clearDDM removes a previous export so certificates no longer matched
+// aren't still declared. Other non-empty directories are refused.
+func clearDDM(dir string) error {
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) || (err == nil && len(infos) == 0) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(dir, ddmDeclarations, "activation.json")); err != nil {
+		return fmt.Errorf("%s isn't empty and wasn't written by cert-manage", dir)
+	}
+	for _, sub := range []string{ddmCertificates, ddmDeclarations} {
+		if err := os.RemoveAll(filepath.Join(dir, sub)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+func TestCmdDDM__writeDDM(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "cert-manage-ddm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := writeDDM(dir, "https://mdm.example.com/certs/", certs[:2]); err != nil {
+		t.Fatal(err)
+	}
+	fp := certutil.GetHexSHA256Fingerprint(*certs[0])
+	if _, err := os.Stat(filepath.Join(dir, ddmCertificates, fp+".cer")); err != nil {
+		t.Error(err)
+	}
+
+	var asset struct {
+		Type    string
+		Payload struct {
+			Reference map[string]interface{}
+		}
+	}
+	readJSON(t, filepath.Join(dir, ddmDeclarations, "asset."+fp[:16]+".json"), &asset)
+	if asset.Type != "com.apple.asset.credential.certificate" || asset.Payload.Reference["DataURL"] != "https://mdm.example.com/certs/"+fp+".cer" {
+		t.Errorf("got %#v", asset)
+	}
+
+	var activation struct {
+		Payload struct {
+			StandardConfigurations []string
+		}
+	}
+	readJSON(t, filepath.Join(dir, ddmDeclarations, "activation.json"), &activation)
+	if n := len(activation.Payload.StandardConfigurations); n != 2 {
+		t.Errorf("got %d configurations", n)
+	}
+
+	// exporting again only declares what's still matched
+	if err := writeDDM(dir, "https://mdm.example.com/certs", certs[2:3]); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := ioutil.ReadDir(filepath.Join(dir, ddmDeclarations))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 3 {
+		t.Errorf("got %d declarations", len(infos))
+	}
+
+	// other directories aren't touched
+	if err := writeDDM(filepath.Join(dir, ddmDeclarations), "https://mdm.example.com", certs); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func readJSON(t *testing.T, path string, v interface{}) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(bs, v); err != nil {
+		t.Fatal(err)
+	}
+}
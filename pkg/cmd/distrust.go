@@ -0,0 +1,71 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/fetch"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
+)
+
+// LoadDistrustAfter returns Mozilla's distrust-after date of each root, keyed
+// by SHA256 fingerprint, from a certdata.txt file. "download" fetches the
+// current certdata.txt, "embedded" reads the snapshot built into cert-manage
+// and an empty path returns nil.
+func LoadDistrustAfter(where string) (map[string]time.Time, error) {
+	switch where {
+	case "":
+		return nil, nil
+	case "download":
+		res, err := fetch.Fetch("nss")
+		if err != nil {
+			return nil, fmt.Errorf("fetching nss: %v", err)
+		}
+		return res.DistrustAfter, nil
+	case "embedded":
+		res, err := fetch.Snapshot()
+		if err != nil {
+			return nil, err
+		}
+		if len(res.DistrustAfter) == 0 {
+			// snapshots built from a PEM bundle can't carry the dates
+			return nil, fmt.Errorf("the embedded snapshot (%s) has no distrust-after dates, use -certdata download or a certdata.txt file", res.URL)
+		}
+		return res.DistrustAfter, nil
+	}
+	bs, err := ioutil.ReadFile(where)
+	if err != nil {
+		return nil, err
+	}
+	return fetch.ReadDistrustAfter(bs)
+}
+
+// auditDistrustAfter reports roots whose distrust-after date has passed,
+// Firefox no longer trusts TLS certificates they issue.
+func auditDistrustAfter(dates map[string]time.Time, certs []*x509.Certificate, now time.Time) []finding {
+	var out []finding
+	for i := range certs {
+		when, ok := dates[certutil.GetHexSHA256Fingerprint(*certs[i])]
+		if ok && now.After(when) {
+			out = append(out, finding{certs[i], "distrusted since " + timeutil.Date(when)})
+		}
+	}
+	return out
+}
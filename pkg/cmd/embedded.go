@@ -0,0 +1,169 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/fetch"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
+	"github.com/adamdecaf/cert-manage/pkg/ui"
+)
+
+// EmbeddedOptions changes the snapshot of Mozilla's roots used by cert-manage
+type EmbeddedOptions struct {
+	// Refresh replaces the snapshot with Mozilla's latest certdata.txt, or
+	// the certdata.txt at From (e.g. copied onto an air-gapped machine)
+	Refresh bool
+	From    string
+
+	// Reset goes back to the snapshot built into cert-manage
+	Reset bool
+
+	// Out writes a whitelist of the snapshot's roots
+	Out string
+}
+
+// Embedded lists the snapshot of Mozilla's roots, which is built into
+// cert-manage and used when verifying chains (gen-whitelist, simulate)
+// and by 'fetch embedded'.
+func Embedded(opts EmbeddedOptions, cfg *ui.Config) error {
+	switch {
+	case opts.Reset:
+		if err := fetch.ResetSnapshot(); err != nil {
+			return err
+		}
+		res, err := fetch.Embedded()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Using the built-in snapshot of %d roots from %s\n", len(res.Certificates), res.URL)
+		return nil
+	case opts.Refresh:
+		before, _ := fetch.Snapshot()
+		res, err := refreshSnapshot(opts.From)
+		if err != nil {
+			return err
+		}
+		if err := fetch.SaveSnapshot(res); err != nil {
+			return fmt.Errorf("error saving snapshot: %v", err)
+		}
+		fmt.Printf("Saved %d roots from %s (sha256 %s)\n", len(res.Certificates), res.URL, res.SHA256)
+		if before != nil {
+			added, removed := snapshotChanges(before.Certificates, res.Certificates)
+			fmt.Printf("  %d root(s) added and %d removed since the previous snapshot\n", added, removed)
+		}
+		return nil
+	}
+
+	res, err := fetch.Snapshot()
+	if err != nil {
+		return err
+	}
+	if opts.Out == "" && !strings.EqualFold(cfg.Format, "json") {
+		fmt.Println(describeSnapshot(res))
+	}
+	return Fetch([]string{"embedded"}, opts.Out, cfg)
+}
+
+// refreshSnapshot downloads Mozilla's certdata.txt, or reads it from a
+// local path. Gzip'd files are read too.
+func refreshSnapshot(from string) (*fetch.Result, error) {
+	if from == "" {
+		return fetch.Fetch("nss")
+	}
+	bs, err := ioutil.ReadFile(from)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(from, ".gz") {
+		r, err := gzip.NewReader(bytes.NewReader(bs))
+		if err != nil {
+			return nil, err
+		}
+		bs, err = ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fetch.NewSnapshot(bs, from, time.Now())
+}
+
+// describeSnapshot says where the snapshot is from and whether it's built-in
+func describeSnapshot(res *fetch.Result) string {
+	kind := "Refreshed"
+	if embedded, err := fetch.Embedded(); err == nil && embedded.SHA256 == res.SHA256 {
+		kind = "Built-in"
+	}
+	return fmt.Sprintf("%s snapshot of %d roots from %s, retrieved %s (sha256 %s)", kind, len(res.Certificates), res.URL, timeutil.Date(res.Retrieved), res.SHA256)
+}
+
+// snapshotChanges counts the roots added and removed between snapshots
+func snapshotChanges(before, after []*x509.Certificate) (int, int) {
+	prev := make(map[string]bool, len(before))
+	for i := range before {
+		prev[certutil.GetHexSHA256Fingerprint(*before[i])] = true
+	}
+	added := 0
+	for i := range after {
+		fp := certutil.GetHexSHA256Fingerprint(*after[i])
+		if prev[fp] {
+			delete(prev, fp)
+			continue
+		}
+		added++
+	}
+	return added, len(prev)
+}
+
+// verifyRoots returns the platform's roots along with the snapshot of
+// Mozilla's, so chains still verify after a whitelist has removed their
+// root from the platform. It's nil, meaning the platform verifies, when
+// the platform's roots can't be read.
+func verifyRoots() *x509.CertPool {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		return nil
+	}
+	if res, err := fetch.Snapshot(); err == nil {
+		for i := range res.Certificates {
+			pool.AddCert(res.Certificates[i])
+		}
+	}
+	return pool
+}
+
+// withSnapshotRoots adds the snapshot of Mozilla's roots to roots, so sites
+// anchored by a root a whitelist already removed are still checked.
+func withSnapshotRoots(roots []*x509.Certificate) []*x509.Certificate {
+	res, err := fetch.Snapshot()
+	if err != nil {
+		if debug {
+			fmt.Printf("cmd: unable to read Mozilla snapshot: %v\n", err)
+		}
+		return roots
+	}
+	pool := certutil.Pool{}
+	pool.AddCertificates(roots)
+	pool.AddCertificates(res.Certificates)
+	return pool.GetCertificates()
+}
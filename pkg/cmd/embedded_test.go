@@ -0,0 +1,80 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/fetch"
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+	"github.com/adamdecaf/cert-manage/pkg/ui"
+)
+
+func TestCmdEmbedded__refresh(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-embedded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	orig := fetch.SnapshotDir
+	fetch.SnapshotDir = dir
+	defer func() { fetch.SnapshotDir = orig }()
+
+	if err := Embedded(EmbeddedOptions{Refresh: true, From: "../../testdata/certdata.txt.gz"}, &ui.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	res, err := fetch.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.URL != "../../testdata/certdata.txt.gz" || len(res.Certificates) != 133 {
+		t.Errorf("got %d certificates from %s", len(res.Certificates), res.URL)
+	}
+
+	if err := Embedded(EmbeddedOptions{Reset: true}, &ui.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir + "/snapshot.json"); !os.IsNotExist(err) {
+		t.Errorf("expected refreshed snapshot to be removed, err=%v", err)
+	}
+
+	if err := Embedded(EmbeddedOptions{Refresh: true, From: "../../testdata/missing.txt"}, &ui.Config{}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestCmdEmbedded__changes(t *testing.T) {
+	roots, err := testca.NewRoots("Snapshot Root", 3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, removed := snapshotChanges(roots[:2], roots[1:])
+	if added != 1 || removed != 1 {
+		t.Errorf("added=%d removed=%d", added, removed)
+	}
+
+	embedded, err := fetch.Embedded()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := fetch.SnapshotDir
+	fetch.SnapshotDir = ""
+	defer func() { fetch.SnapshotDir = orig }()
+	if all := withSnapshotRoots(roots[:1]); len(all) != len(embedded.Certificates)+1 {
+		t.Errorf("got %d roots", len(all))
+	}
+}
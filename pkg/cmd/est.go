@@ -0,0 +1,128 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/fetch"
+	"github.com/adamdecaf/cert-manage/pkg/ui"
+)
+
+// FetchESTOptions describes the enterprise CA certificates are read from
+type FetchESTOptions struct {
+	// URL is the EST server (or label), or the SCEP endpoint
+	URL string
+
+	// SCEP uses a SCEP GetCACert request rather than EST /cacerts
+	SCEP bool
+
+	// Out is where a whitelist of the certificates is written, if given
+	Out string
+
+	// Stores are the app names (or "platform") the roots are added to,
+	// when empty the certificates are only listed.
+	Stores []string
+
+	// Fingerprint is the SHA256 fingerprint the CA's root must have,
+	// without it the roots found are shown for confirmation.
+	Fingerprint string
+
+	// Yes skips confirming roots without Fingerprint
+	Yes bool
+}
+
+// FetchEST reads the CA certificates of an enterprise CA over EST or SCEP.
+// They're listed (or written as a whitelist), unless stores are given in
+// which case the CA's roots are added to each.
+func FetchEST(opts FetchESTOptions, cfg *ui.Config) error {
+	source := "est:" + opts.URL
+	if opts.SCEP {
+		source = "scep:" + opts.URL
+	}
+	if len(opts.Stores) == 0 {
+		return Fetch([]string{source}, opts.Out, cfg)
+	}
+
+	targets, err := trustTargets(opts.Stores)
+	if err != nil {
+		return err
+	}
+	res, err := fetch.Fetch(source)
+	if err != nil {
+		return fmt.Errorf("fetching %s: %v", opts.URL, err)
+	}
+	if err := trustEnterprise(os.Stdin, os.Stdout, res, opts, targets); err != nil {
+		return err
+	}
+	if opts.Out != "" {
+		wh, _ := mergeFetchResults([]*fetch.Result{res}, time.Now())
+		if err := wh.ToFile(opts.Out); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote whitelist with %d fingerprints to %s\n", len(wh.Fingerprints), opts.Out)
+	}
+	return nil
+}
+
+// trustEnterprise adds the roots of what an EST or SCEP server returned to
+// each target. Intermediate and RA certificates are left out.
+func trustEnterprise(in io.Reader, out io.Writer, res *fetch.Result, opts FetchESTOptions, targets []trustTarget) error {
+	var roots []*x509.Certificate
+	for i := range res.Certificates {
+		if res.Certificates[i].IsCA && isSelfSigned(res.Certificates[i]) {
+			roots = append(roots, res.Certificates[i])
+		}
+	}
+	if len(roots) == 0 {
+		return fmt.Errorf("%s returned no root certificates", res.URL)
+	}
+
+	if want := normalizeFingerprint(opts.Fingerprint); want != "" {
+		roots = rootsWithFingerprint(roots, want)
+		if len(roots) == 0 {
+			return fmt.Errorf("%s doesn't serve a root with fingerprint %s", res.URL, want)
+		}
+	} else if !opts.Yes {
+		summary := []string{fmt.Sprintf("%s returned %d root(s):", res.URL, len(roots))}
+		for i := range roots {
+			summary = append(summary, fmt.Sprintf("  %s  %s", certutil.GetHexSHA256Fingerprint(*roots[i]), certutil.StringifyPKIXName(roots[i].Subject)))
+		}
+		summary = append(summary, "Compare these with the fingerprint published by the CA's operators, or give -fingerprint")
+		if err := confirmRestore(in, out, summary); err != nil {
+			if err == errRestoreCancelled {
+				return errors.New("fetch-est cancelled")
+			}
+			return err
+		}
+	}
+
+	for i := range targets {
+		if err := targets[i].writable(); err != nil {
+			return err
+		}
+		if err := targets[i].s.Add(roots); err != nil {
+			return fmt.Errorf("adding roots to %s: %v", targets[i].name, err)
+		}
+		fmt.Fprintf(out, "Added %d root(s) from %s to %s\n", len(roots), res.URL, targets[i].name)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/fetch"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+)
+
+func TestCmdFetchEST__trust(t *testing.T) {
+	h, err := testca.NewHierarchy("est.corp", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := h.Root.Certificate
+	res := &fetch.Result{
+		Source:       "est",
+		URL:          "https://est.corp/.well-known/est/cacerts",
+		Certificates: []*x509.Certificate{h.Intermediate.Certificate, root},
+	}
+
+	trust := func(opts FetchESTOptions, answer string) ([]*x509.Certificate, error) {
+		s := store.MemoryStore(nil)
+		var out bytes.Buffer
+		err := trustEnterprise(strings.NewReader(answer), &out, res, opts, []trustTarget{{"memory", s}})
+		certs, _ := s.List(&store.ListOptions{Trusted: true})
+		return certs, err
+	}
+
+	// roots are confirmed before they're added
+	if certs, err := trust(FetchESTOptions{}, "n\n"); err == nil || len(certs) != 0 {
+		t.Fatalf("got %d certs, err=%v", len(certs), err)
+	}
+	certs, err := trust(FetchESTOptions{}, "y\n")
+	if err != nil || len(certs) != 1 || !certs[0].Equal(root) {
+		t.Fatalf("got %d certs, err=%v", len(certs), err)
+	}
+
+	// a fingerprint skips confirming, and has to match
+	fp := certutil.GetHexSHA256Fingerprint(*root)
+	certs, err = trust(FetchESTOptions{Fingerprint: strings.ToUpper(fp)}, "")
+	if err != nil || len(certs) != 1 || !certs[0].Equal(root) {
+		t.Fatalf("got %d certs, err=%v", len(certs), err)
+	}
+	other := certutil.GetHexSHA256Fingerprint(*h.Intermediate.Certificate)
+	if certs, err := trust(FetchESTOptions{Fingerprint: other}, ""); err == nil || len(certs) != 0 {
+		t.Fatalf("got %d certs, err=%v", len(certs), err)
+	}
+
+	// without a root nothing is added
+	res.Certificates = res.Certificates[:1]
+	if _, err := trust(FetchESTOptions{Yes: true}, ""); err == nil {
+		t.Fatal("expected an error without roots")
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/gpo"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+)
+
+// ExportOptions picks which certificates are exported and how
+type ExportOptions struct {
+	// Blacklist or Whitelist only export certificates matching them
+	Blacklist string
+	Whitelist string
+
+	// Format writes a directory rather than a file: "capath" for OpenSSL's
+	// -CApath or "ddm" for Apple declarative device management
+	Format string
+
+	// URL is where the certificates of a "ddm" export are served from
+	URL string
+}
+
+func ExportForApp(app, where string, opts ExportOptions) error {
+	s, err := store.ForApp(app)
+	if err != nil {
+		return err
+	}
+	return export(s, where, opts)
+}
+
+func ExportForPlatform(where string, opts ExportOptions) error {
+	return export(store.Platform(), where, opts)
+}
+
+// export writes the trusted certificates of a store to where, only those
+// matching the blacklist or whitelist of opts if given.
+//
+// Files ending in .sst or .pol are written for distributing through Group
+// Policy (the Disallowed store), .p12 and .pfx files as PKCS#12 (prompting
+// for a password) and everything else is written as PEM.
+func export(s store.Store, where string, opts ExportOptions) error {
+	certs, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	err = warnPartial(err)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range []string{opts.Blacklist, opts.Whitelist} {
+		if path == "" {
+			continue
+		}
+		wh, err := loadWhitelist(path, "")
+		if err != nil {
+			return err
+		}
+		var matched []*x509.Certificate
+		for i := range certs {
+			if wh.Matches(certs[i]) {
+				matched = append(matched, certs[i])
+			}
+		}
+		certs = matched
+	}
+
+	switch opts.Format {
+	case "capath":
+		if err := writeCAPath(where, certs); err != nil {
+			return err
+		}
+		fmt.Printf("Exported %d certificates to %s, use it with SSL_CERT_DIR=%s or %s\n", len(certs), where, where, filepath.Join(where, capathConfig))
+		return nil
+	case "ddm":
+		if err := writeDDM(where, opts.URL, certs); err != nil {
+			return err
+		}
+		fmt.Printf("Exported %d certificate declarations to %s, serve %s at %s\n", len(certs), where, filepath.Join(where, ddmCertificates), opts.URL)
+		return nil
+	}
+	if err := writeExport(where, certs); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d certificates to %s\n", len(certs), where)
+	return nil
+}
+
+func writeExport(where string, certs []*x509.Certificate) error {
+	ext := strings.ToLower(filepath.Ext(where))
+	for _, f := range gpo.Formats() {
+		if ext == "."+f {
+			fd, err := os.OpenFile(where, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, file.TempFilePermissions)
+			if err != nil {
+				return err
+			}
+			if err := gpo.Write(fd, f, certs); err != nil {
+				fd.Close()
+				return err
+			}
+			return fd.Close()
+		}
+	}
+	if isPKCS12File(where) {
+		return writePKCS12(where, certs)
+	}
+	return certutil.ToFile(where, certs)
+}
+
+const (
+	// capathConfig is the openssl.cnf snippet written into a capath
+	// directory, it also marks directories we can safely rewrite.
+	capathConfig = "openssl.cnf"
+	capathMarker = "# Written by cert-manage"
+)
+
+// writeCAPath writes each certificate to dir with the hash symlinks OpenSSL
+// looks them up by (like c_rehash), and an openssl.cnf pointing at dir.
+// Only empty directories, or ones written by a previous export, are used.
+func writeCAPath(dir string, certs []*x509.Certificate) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if err := clearCAPath(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// certificates are public, so readable by the apps using them
+	for i := range certs {
+		name := certutil.GetHexSHA256Fingerprint(*certs[i])[:16] + ".pem"
+		bs := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certs[i].Raw})
+		if err := ioutil.WriteFile(filepath.Join(dir, name), bs, 0644); err != nil {
+			return err
+		}
+	}
+	if err := certutil.Rehash(dir); err != nil {
+		return err
+	}
+
+	cnf := fmt.Sprintf(`%s, trust the certificates in this directory.
+#
+# Use it as OPENSSL_CONF, or copy the sections into openssl.cnf. VerifyCAPath
+# adds this directory for applications using OpenSSL's system defaults, set
+# SSL_CERT_DIR to it (and unset SSL_CERT_FILE) to trust only these certificates.
+openssl_conf = cert_manage_init
+
+[cert_manage_init]
+ssl_conf = cert_manage_ssl
+
+[cert_manage_ssl]
+system_default = cert_manage_system_default
+
+[cert_manage_system_default]
+VerifyCAPath = %s
+`, capathMarker, dir)
+	return ioutil.WriteFile(filepath.Join(dir, capathConfig), []byte(cnf), 0644)
+}
+
+// clearCAPath removes the certificates and links of a previous export so
+// certificates no longer matched don't linger.
+func clearCAPath(dir string) error {
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) || (err == nil && len(infos) == 0) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	bs, err := ioutil.ReadFile(filepath.Join(dir, capathConfig))
+	if err != nil || !bytes.HasPrefix(bs, []byte(capathMarker)) {
+		return fmt.Errorf("%s isn't empty and wasn't written by cert-manage", dir)
+	}
+	for i := range infos {
+		if infos[i].IsDir() {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, infos[i].Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+)
+
+func TestCmdExport__writeExport(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/example.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "cert-manage-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// PEM
+	where := filepath.Join(dir, "certs.pem")
+	if err := writeExport(where, certs); err != nil {
+		t.Fatal(err)
+	}
+	read, err := certutil.FromFile(where)
+	if err != nil || len(read) != 1 {
+		t.Errorf("got %d certs, err=%v", len(read), err)
+	}
+
+	// Group Policy
+	for _, name := range []string{"disallowed.sst", "Registry.POL"} {
+		where = filepath.Join(dir, name)
+		if err := writeExport(where, certs); err != nil {
+			t.Fatal(err)
+		}
+		bs, err := ioutil.ReadFile(where)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bs) < 8 || (string(bs[4:8]) != "CERT" && string(bs[:4]) != "PReg") {
+			t.Errorf("%s: unexpected header %q", name, bs[:8])
+		}
+	}
+}
+
+func TestCmdExport__writeCAPath(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent, err := ioutil.TempDir("", "cert-manage-capath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parent)
+	dir := filepath.Join(parent, "certs")
+
+	if err := writeCAPath(dir, certs[:2]); err != nil {
+		t.Fatal(err)
+	}
+	for i := range certs[:2] {
+		hash, err := certutil.SubjectHash(certs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		read, err := certutil.FromFile(filepath.Join(dir, fmt.Sprintf("%08x.0", hash)))
+		if err != nil || len(read) != 1 {
+			t.Errorf("cert %d: got %d certs, err=%v", i, len(read), err)
+		}
+	}
+	bs, err := ioutil.ReadFile(filepath.Join(dir, capathConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bs), "VerifyCAPath = "+dir) {
+		t.Errorf("got %s", bs)
+	}
+
+	// exporting again drops certificates no longer matched
+	if err := writeCAPath(dir, certs[2:3]); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 3 { // certificate, link and openssl.cnf
+		t.Errorf("got %d files", len(infos))
+	}
+
+	// directories we didn't write aren't touched
+	if err := ioutil.WriteFile(filepath.Join(parent, "other"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCAPath(parent, certs); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestCmdExport__variants(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "cert-manage-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bundle := filepath.Join(dir, "bundle.pem")
+	if err := certutil.ToFile(bundle, certs[:3]); err != nil {
+		t.Fatal(err)
+	}
+	s, err := store.ForApp("file:" + bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// certs[1] is only kept by a variant every host matches
+	wl := filepath.Join(dir, "whitelist.yaml")
+	body := fmt.Sprintf("variants:\n  - selector: \"!cert-manage-test\"\n    fingerprints:\n      - %s\n", certutil.GetHexSHA256Fingerprint(*certs[1]))
+	if err := ioutil.WriteFile(wl, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	where := filepath.Join(dir, "out.pem")
+	if err := export(s, where, ExportOptions{Whitelist: wl}); err != nil {
+		t.Fatal(err)
+	}
+	read, err := certutil.FromFile(where)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 1 || !read[0].Equal(certs[1]) {
+		t.Errorf("got %d certs", len(read))
+	}
+}
+
+func TestCmdExport__policies(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "cert-manage-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bundle := filepath.Join(dir, "bundle.pem")
+	if err := certutil.ToFile(bundle, certs[:3]); err != nil {
+		t.Fatal(err)
+	}
+	s, err := store.ForApp("file:" + bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// certs[2] is only kept by a named policy
+	wl := filepath.Join(dir, "whitelist.yaml")
+	body := fmt.Sprintf("policies:\n  web:\n    fingerprints:\n      - %s\n", certutil.GetHexSHA256Fingerprint(*certs[2]))
+	if err := ioutil.WriteFile(wl, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	where := filepath.Join(dir, "out.pem")
+	if err := export(s, where, ExportOptions{Whitelist: wl}); err != nil {
+		t.Fatal(err)
+	}
+	read, err := certutil.FromFile(where)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 1 || !read[0].Equal(certs[2]) {
+		t.Errorf("got %d certs", len(read))
+	}
+
+	// list -whitelist loads the whitelist the same way
+	wh, err := LoadWhitelist(wl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !wh.Matches(certs[2]) || wh.Matches(certs[0]) {
+		t.Error("expected only the policy's certificate to match")
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/store"
+)
+
+var (
+	// factNameCleaner replaces what can't be used in a fact name, e.g. the
+	// ':' of "snap:firefox"
+	factNameCleaner = regexp.MustCompile(`[^a-z0-9_]+`)
+)
+
+// Facts are written for configuration management tools, e.g. Puppet's
+// facter (external facts) or a Chef ohai plugin.
+type Facts struct {
+	Version string                `json:"version"`
+	Stores  map[string]StoreFacts `json:"stores"`
+}
+
+// StoreFacts describe one certificate store
+type StoreFacts struct {
+	Certificates int `json:"certificates"`
+
+	// Whitelist is the hash of the last whitelist applied, see whitelist.Hash()
+	Whitelist        string     `json:"whitelist,omitempty"`
+	WhitelistApplied *time.Time `json:"whitelist_applied,omitempty"`
+
+	LastBackup *time.Time `json:"last_backup,omitempty"`
+}
+
+// WriteFacts prints facts about the platform and each installed app as
+// key=value lines (format "keyvalue") or JSON.
+func WriteFacts(version, format string) error {
+	f := Facts{
+		Version: version,
+		Stores:  make(map[string]StoreFacts),
+	}
+	f.Stores[runtime.GOOS] = storeFacts(runtime.GOOS, store.Platform())
+	apps := append(store.GetApps(), store.GetSandboxedApps()...)
+	for i := range apps {
+		s, err := store.ForApp(apps[i])
+		if err != nil {
+			continue
+		}
+		// apps which aren't installed fail to list or have no certificates
+		sf := storeFacts(apps[i], s)
+		if sf.Certificates == 0 {
+			continue
+		}
+		f.Stores[apps[i]] = sf
+	}
+	return writeFacts(os.Stdout, f, format)
+}
+
+func storeFacts(name string, s store.Store) StoreFacts {
+	var sf StoreFacts
+	certs, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	if _, ok := store.IsPartial(err); err == nil || ok {
+		sf.Certificates = len(certs)
+	}
+	if st, err := store.GetState(name); err == nil && st != nil {
+		sf.Whitelist = st.Whitelist
+		applied := st.Applied.UTC()
+		sf.WhitelistApplied = &applied
+	}
+	sf.LastBackup = lastBackup(s)
+	return sf
+}
+
+// lastBackup returns when the latest backup was taken, from its stamp or
+// the backup's modification time for older backups.
+func lastBackup(s store.Store) *time.Time {
+	latest, err := s.GetLatestBackup()
+	if err != nil || latest == "" {
+		return nil
+	}
+	var when time.Time
+	if st, err := store.GetBackupStamp(latest); err == nil && st != nil && !st.Created.IsZero() {
+		when = st.Created
+	} else if fi, err := os.Stat(latest); err == nil {
+		when = fi.ModTime()
+	} else {
+		return nil
+	}
+	when = when.UTC()
+	return &when
+}
+
+func writeFacts(w io.Writer, f Facts, format string) error {
+	switch format {
+	case "json":
+		bs, err := json.MarshalIndent(map[string]Facts{"cert_manage": f}, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", bs)
+		return err
+
+	case "keyvalue":
+		names := make([]string, 0, len(f.Stores))
+		for name := range f.Stores {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Fprintf(w, "cert_manage_version=%s\n", f.Version)
+		for _, name := range names {
+			sf := f.Stores[name]
+			prefix := "cert_manage_" + factName(name)
+			fmt.Fprintf(w, "%s_certificates=%d\n", prefix, sf.Certificates)
+			if sf.Whitelist != "" {
+				fmt.Fprintf(w, "%s_whitelist=%s\n", prefix, sf.Whitelist)
+				fmt.Fprintf(w, "%s_whitelist_applied=%s\n", prefix, sf.WhitelistApplied.Format(time.RFC3339))
+			}
+			if sf.LastBackup != nil {
+				fmt.Fprintf(w, "%s_last_backup=%s\n", prefix, sf.LastBackup.Format(time.RFC3339))
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown facts format %q, options: keyvalue, json", format)
+}
+
+func factName(name string) string {
+	return factNameCleaner.ReplaceAllString(strings.ToLower(name), "_")
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+)
+
+func TestCmdFacts(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf := storeFacts("facts-test-memory", store.MemoryStore(certs))
+	if sf.Certificates != len(certs) || sf.LastBackup != nil {
+		t.Errorf("got %#v", sf)
+	}
+
+	applied := time.Date(2018, time.March, 1, 12, 0, 0, 0, time.UTC)
+	backup := applied.Add(-1 * time.Hour)
+	f := Facts{
+		Version: "0.2.0",
+		Stores: map[string]StoreFacts{
+			"linux":        {Certificates: 140, Whitelist: "abc", WhitelistApplied: &applied, LastBackup: &backup},
+			"snap:firefox": {Certificates: 3},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeFacts(&buf, f, "keyvalue"); err != nil {
+		t.Fatal(err)
+	}
+	expected := `cert_manage_version=0.2.0
+cert_manage_linux_certificates=140
+cert_manage_linux_whitelist=abc
+cert_manage_linux_whitelist_applied=2018-03-01T12:00:00Z
+cert_manage_linux_last_backup=2018-03-01T11:00:00Z
+cert_manage_snap_firefox_certificates=3
+`
+	if buf.String() != expected {
+		t.Errorf("got:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := writeFacts(&buf, f, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]Facts
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["cert_manage"].Stores["linux"].Certificates != 140 || !strings.Contains(buf.String(), `"last_backup": "2018-03-01T11:00:00Z"`) {
+		t.Errorf("got:\n%s", buf.String())
+	}
+	if strings.Contains(buf.String(), `"snap:firefox": {
+      "certificates": 3,`) {
+		t.Errorf("empty fields should be left out:\n%s", buf.String())
+	}
+
+	if err := writeFacts(&buf, f, "yaml"); err == nil {
+		t.Error("expected error")
+	}
+}
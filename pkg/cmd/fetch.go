@@ -0,0 +1,147 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/fetch"
+	"github.com/adamdecaf/cert-manage/pkg/ui"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+// Fetch downloads the roots included in each root program of `sources`. If
+// `out` is given a whitelist of every fetched fingerprint is written there,
+// otherwise the certificates are listed according to the ui/format options.
+// With '-format json' each fingerprint is written with where it came from.
+func Fetch(sources []string, out string, cfg *ui.Config) error {
+	var results []*fetch.Result
+	for i := range sources {
+		res, err := fetch.Fetch(sources[i])
+		if err != nil {
+			return fmt.Errorf("fetching %s: %v", sources[i], err)
+		}
+		results = append(results, res)
+	}
+
+	if out != "" {
+		wh, distrusted := mergeFetchResults(results, time.Now())
+		if err := wh.ToFile(out); err != nil {
+			return err
+		}
+		if distrusted > 0 {
+			fmt.Printf("Left out %d roots past their distrust-after date\n", distrusted)
+		}
+		fmt.Printf("Wrote whitelist with %d fingerprints to %s\n", len(wh.Fingerprints), out)
+		return nil
+	}
+	if strings.EqualFold(cfg.Format, "json") {
+		return writeFetchJSON(os.Stdout, results)
+	}
+
+	for i := range results {
+		if len(results[i].Certificates) == 0 {
+			// Only fingerprints are published by this source
+			fmt.Printf("%s: %d fingerprints from %s (sha256 %s)\n", results[i].Source, len(results[i].Fingerprints), results[i].URL, results[i].SHA256)
+			if results[i].Signer != "" {
+				fmt.Printf("Signed by %s\n", results[i].Signer)
+			}
+			for j := range results[i].Fingerprints {
+				fmt.Println(results[i].Fingerprints[j])
+			}
+			continue
+		}
+		cfg.DistrustAfter = results[i].DistrustAfter
+		if err := ui.ListCertificates(results[i].Certificates, cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchRecord is a fetched fingerprint and where it came from
+type fetchRecord struct {
+	Fingerprint string    `json:"fingerprint"`
+	Subject     string    `json:"subject,omitempty"`
+	Source      string    `json:"source"`
+	URL         string    `json:"url"`
+	Retrieved   time.Time `json:"retrieved"`
+	SHA256      string    `json:"bundleSHA256"`
+	Signer      string    `json:"signer,omitempty"`
+}
+
+func writeFetchJSON(w io.Writer, results []*fetch.Result) error {
+	var records []fetchRecord
+	for i := range results {
+		res := results[i]
+		subjects := make(map[string]string)
+		for j := range res.Certificates {
+			subjects[certutil.GetHexSHA256Fingerprint(*res.Certificates[j])] = certutil.StringifyPKIXName(res.Certificates[j].Subject)
+		}
+		for _, fp := range res.Fingerprints {
+			records = append(records, fetchRecord{
+				Fingerprint: fp,
+				Subject:     subjects[fp],
+				Source:      res.Source,
+				URL:         res.URL,
+				Retrieved:   res.Retrieved,
+				SHA256:      res.SHA256,
+				Signer:      res.Signer,
+			})
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+// mergeFetchResults creates a whitelist of each unique fingerprint, recording
+// the provenance of each source. Roots past their distrust-after date (as of
+// now) are left out and counted.
+func mergeFetchResults(results []*fetch.Result, now time.Time) (whitelist.Whitelist, int) {
+	seen := make(map[string]bool)
+	distrusted := make(map[string]bool)
+	for i := range results {
+		for fp, when := range results[i].DistrustAfter {
+			if now.After(when) {
+				distrusted[fp] = true
+			}
+		}
+	}
+	wh := whitelist.Whitelist{}
+	for i := range results {
+		wh.Provenance = append(wh.Provenance, whitelist.Provenance{
+			Source:       results[i].Source,
+			URL:          results[i].URL,
+			Retrieved:    results[i].Retrieved.Format(time.RFC3339),
+			SHA256:       results[i].SHA256,
+			Signer:       results[i].Signer,
+			Fingerprints: results[i].Fingerprints,
+		})
+		for _, fp := range results[i].Fingerprints {
+			if !seen[fp] && !distrusted[fp] {
+				seen[fp] = true
+				wh.Fingerprints = append(wh.Fingerprints, fp)
+			}
+		}
+	}
+	return wh, len(distrusted)
+}
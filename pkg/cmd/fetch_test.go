@@ -0,0 +1,76 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/fetch"
+)
+
+func TestFetch__provenance(t *testing.T) {
+	when := time.Date(2018, 3, 4, 5, 6, 7, 0, time.UTC)
+	results := []*fetch.Result{
+		{
+			Source:       "nss",
+			Fingerprints: []string{"aa", "bb", "dd"},
+			DistrustAfter: map[string]time.Time{
+				"dd": when.Add(-24 * time.Hour),
+				"bb": when.Add(24 * time.Hour),
+			},
+			URL:       "https://example.com/certdata.txt",
+			Retrieved: when,
+			SHA256:    "1234",
+		},
+		{
+			Source:       "apple",
+			Fingerprints: []string{"bb", "cc"},
+			URL:          "https://example.com/apple",
+			Retrieved:    when,
+			SHA256:       "5678",
+		},
+	}
+
+	// dd is past its distrust-after date, but bb isn't yet
+	wh, distrusted := mergeFetchResults(results, when)
+	if len(wh.Fingerprints) != 3 || distrusted != 1 {
+		t.Errorf("got %v (%d distrusted)", wh.Fingerprints, distrusted)
+	}
+	if len(wh.Provenance) != 2 {
+		t.Fatalf("got %#v", wh.Provenance)
+	}
+	p := wh.Provenance[1]
+	if p.Source != "apple" || p.URL != "https://example.com/apple" || p.SHA256 != "5678" || p.Retrieved != "2018-03-04T05:06:07Z" || len(p.Fingerprints) != 2 {
+		t.Errorf("got %#v", p)
+	}
+
+	var buf bytes.Buffer
+	if err := writeFetchJSON(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	var records []fetchRecord
+	if err := json.Unmarshal(buf.Bytes(), &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("got %d records", len(records))
+	}
+	if r := records[3]; r.Fingerprint != "bb" || r.Source != "apple" || r.SHA256 != "5678" || !r.Retrieved.Equal(when) {
+		t.Errorf("got %#v", r)
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/adamdecaf/cert-manage/pkg/httputil"
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
+)
+
+var (
+	// fleetSSH and fleetSCP are the ssh(1) and scp(1) programs used, so
+	// ~/.ssh/config, agents and known_hosts all work as they do for the user
+	fleetSSH = "ssh"
+	fleetSCP = "scp"
+
+	// fleetSSHOptions never prompt, a host needing a password fails instead
+	// of blocking every other host.
+	fleetSSHOptions = []string{"-o", "BatchMode=yes"}
+)
+
+// FleetOptions configures running cert-manage on many hosts
+type FleetOptions struct {
+	// Binary is copied to and ran on each host, defaults to this executable.
+	// Hosts with another OS or architecture need a binary built for them.
+	Binary string
+
+	// Parallel is how many hosts are ran at once
+	Parallel int
+}
+
+// fleetHost is an ssh destination from the inventory
+type fleetHost struct {
+	user string // optional, includes the trailing @
+	host string
+	port string
+}
+
+// dest is the [user@]host given to ssh
+func (h fleetHost) dest() string {
+	return h.user + h.host
+}
+
+// scpDest is the [user@]host:dir given to scp, which needs IPv6
+// addresses in brackets
+func (h fleetHost) scpDest(dir string) string {
+	host := h.host
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return h.user + host + ":" + dir
+}
+
+func (h fleetHost) String() string {
+	if h.port != "" {
+		return h.user + net.JoinHostPort(h.host, h.port)
+	}
+	return h.dest()
+}
+
+// fleetResult is the outcome of running cert-manage on one host
+type fleetResult struct {
+	host   fleetHost
+	output string
+	err    error
+}
+
+// Fleet copies cert-manage (and any local files given in args) to each host
+// in the inventory over ssh, runs `cert-manage <args>` and prints a summary
+// of every host once they're all done.
+func Fleet(inventory string, args []string, opts FleetOptions) error {
+	if len(args) == 0 {
+		return errors.New("no command given to run on hosts")
+	}
+	if err := httputil.CheckOnline("fleet"); err != nil {
+		return err
+	}
+	fd, err := os.Open(inventory)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	hosts, err := readInventory(fd)
+	if err != nil {
+		return err
+	}
+	if len(hosts) == 0 {
+		return fmt.Errorf("no hosts found in %s", inventory)
+	}
+
+	if opts.Binary == "" {
+		opts.Binary, err = os.Executable()
+		if err != nil {
+			return err
+		}
+	}
+	files, remoteArgs, err := fleetFiles(args)
+	if err != nil {
+		return err
+	}
+	files = append([]string{opts.Binary}, files...)
+
+	results := runFleet(hosts, files, remoteArgs, opts.Parallel)
+	if err := writeFleetResults(os.Stdout, results); err != nil {
+		return err
+	}
+	failed := 0
+	for i := range results {
+		if results[i].err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d hosts failed", failed, len(results))
+	}
+	return nil
+}
+
+// readInventory reads an ssh destination, [user@]host[:port], from each
+// line of r. IPv6 addresses with a port are written in brackets, e.g.
+// root@[2001:db8::1]:2222. Blank lines and lines starting with # are ignored.
+func readInventory(r io.Reader) ([]fleetHost, error) {
+	var out []fleetHost
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		out = append(out, parseFleetHost(strings.Fields(line)[0]))
+	}
+	return out, scanner.Err()
+}
+
+func parseFleetHost(s string) fleetHost {
+	h := fleetHost{}
+	if idx := strings.LastIndex(s, "@"); idx >= 0 {
+		h.user, s = s[:idx+1], s[idx+1:]
+	}
+	if host, port, err := net.SplitHostPort(s); err == nil {
+		h.host, h.port = host, port
+		return h
+	}
+	// no port, which is also the case for a bare IPv6 address
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		s = s[1 : len(s)-1]
+	}
+	h.host = s
+	return h
+}
+
+// fleetFiles finds the arguments which are local files (e.g. -file wl.json
+// or -file=wl.json), returning them and args referring to them by name
+// relative to the remote working directory.
+func fleetFiles(args []string) ([]string, []string, error) {
+	var files []string
+	names := make(map[string]bool)
+	out := make([]string, len(args))
+	for i := range args {
+		out[i] = args[i]
+		if i == 0 {
+			continue // sub-command
+		}
+		prefix, value := "", args[i]
+		if strings.HasPrefix(value, "-") {
+			idx := strings.Index(value, "=")
+			if idx < 0 {
+				continue
+			}
+			prefix, value = value[:idx+1], value[idx+1:]
+		}
+		if fi, err := os.Stat(value); err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		name := filepath.Base(value)
+		if names[name] {
+			return nil, nil, fmt.Errorf("more than one file named %s given", name)
+		}
+		names[name] = true
+		files = append(files, value)
+		out[i] = prefix + name
+	}
+	return files, out, nil
+}
+
+func runFleet(hosts []fleetHost, files []string, args []string, parallel int) []fleetResult {
+	if parallel < 1 {
+		parallel = 1
+	}
+	results := make([]fleetResult, len(hosts))
+
+	var wg sync.WaitGroup
+	work := make(chan int)
+	for n := 0; n < parallel; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				results[i] = runOnHost(hosts[i], files, args)
+			}
+		}()
+	}
+	for i := range hosts {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	return results
+}
+
+// runOnHost copies files into a temporary directory on the host, runs the
+// first file (cert-manage) from that directory with args and removes it.
+func runOnHost(host fleetHost, files []string, args []string) fleetResult {
+	res := fleetResult{host: host}
+
+	out, err := ssh(host, "mktemp -d /tmp/cert-manage.XXXXXX")
+	if err != nil {
+		res.output, res.err = out, fmt.Errorf("creating temp dir: %v", err)
+		return res
+	}
+	dir := strings.TrimSpace(out)
+	if !strings.HasPrefix(dir, "/tmp/cert-manage.") {
+		res.output, res.err = out, errors.New("unexpected output creating temp dir")
+		return res
+	}
+
+	scpArgs := append([]string{"-q"}, fleetSSHOptions...)
+	if host.port != "" {
+		scpArgs = append(scpArgs, "-P", host.port)
+	}
+	scpArgs = append(scpArgs, "--")
+	scpArgs = append(scpArgs, files...)
+	scpArgs = append(scpArgs, host.scpDest(dir+"/"))
+	if out, err := combinedOutput(interrupt.Command(fleetSCP, scpArgs...)); err != nil {
+		ssh(host, "rm -rf "+shellQuote(dir))
+		res.output, res.err = out, fmt.Errorf("copying files: %v", err)
+		return res
+	}
+
+	bin := path.Join(dir, filepath.Base(files[0]))
+	quoted := make([]string, len(args))
+	for i := range args {
+		quoted[i] = shellQuote(args[i])
+	}
+	script := fmt.Sprintf("cd %s && chmod +x %s && %s %s; rc=$?; cd / && rm -rf %s; exit $rc",
+		shellQuote(dir), shellQuote(bin), shellQuote(bin), strings.Join(quoted, " "), shellQuote(dir))
+	res.output, res.err = ssh(host, script)
+	return res
+}
+
+func ssh(host fleetHost, command string) (string, error) {
+	args := append([]string{}, fleetSSHOptions...)
+	if host.port != "" {
+		args = append(args, "-p", host.port)
+	}
+	// -- keeps a host starting with "-" from being read as an option
+	args = append(args, "--", host.dest(), command)
+	return combinedOutput(interrupt.Command(fleetSSH, args...))
+}
+
+func combinedOutput(cmd *exec.Cmd) (string, error) {
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	err := cmd.Run()
+	return buf.String(), err
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// writeFleetResults prints a line per host and then the full output of
+// each host which failed.
+func writeFleetResults(w io.Writer, results []fleetResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(tw, "Host\tResult\tOutput")
+	for i := range results {
+		result := "ok"
+		if results[i].err != nil {
+			result = "FAILED: " + results[i].err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", results[i].host, result, lastLine(results[i].output))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for i := range results {
+		if results[i].err != nil && strings.TrimSpace(results[i].output) != "" {
+			fmt.Fprintf(w, "\n==> %s <==\n%s\n", results[i].host, strings.TrimRight(results[i].output, "\n"))
+		}
+	}
+	return nil
+}
+
+// lastLine returns the last non-empty line of s
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
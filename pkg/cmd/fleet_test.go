@@ -0,0 +1,166 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeSSH runs commands locally, failing for the host "down"
+var fakeSSH = `#!/bin/sh
+while [ "$1" = "-o" ] || [ "$1" = "-p" ]; do shift 2; done
+[ "$1" = "--" ] && shift
+host="$1"; shift
+if [ "$host" = "down" ]; then echo "ssh: connect to host down port 22: Connection refused" >&2; exit 255; fi
+export FLEET_HOST="$host"
+exec sh -c "$*"
+`
+
+// fakeSCP copies files locally, ignoring the host of the destination
+var fakeSCP = `#!/bin/sh
+while [ "$1" = "-q" ] || [ "$1" = "-o" ] || [ "$1" = "-P" ]; do
+  if [ "$1" = "-q" ]; then shift; else shift 2; fi
+done
+[ "$1" = "--" ] && shift
+for last; do :; done
+dest="${last#*:}"
+while [ $# -gt 1 ]; do cp "$1" "$dest"; shift; done
+`
+
+// fakeCertManage prints its arguments and the whitelist given, failing on "bad"
+var fakeCertManage = `#!/bin/sh
+echo "$FLEET_HOST: $*"
+cat wl.json
+if [ "$FLEET_HOST" = "bad" ]; then echo "ERROR: whitelist failed"; exit 1; fi
+`
+
+func TestCmdFleet(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ssh is a shell script")
+	}
+
+	dir, err := ioutil.TempDir("", "cert-manage-fleet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, body string) string {
+		where := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(where, []byte(body), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return where
+	}
+	origSSH, origSCP := fleetSSH, fleetSCP
+	defer func() { fleetSSH, fleetSCP = origSSH, origSCP }()
+	fleetSSH, fleetSCP = write("ssh", fakeSSH), write("scp", fakeSCP)
+
+	bin := write("cert-manage-linux-amd64", fakeCertManage)
+	wl := write("wl.json", "{}\n")
+
+	hosts, err := readInventory(strings.NewReader("# web\nroot@good:2222\nbad\n\ndown extra\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 3 || hosts[0].dest() != "root@good" || hosts[0].port != "2222" || hosts[2].dest() != "down" {
+		t.Fatalf("got %#v", hosts)
+	}
+
+	files, args, err := fleetFiles([]string{"whitelist", "-file", wl, "-dry-run"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != wl || strings.Join(args, " ") != "whitelist -file wl.json -dry-run" {
+		t.Fatalf("files=%v args=%v", files, args)
+	}
+
+	results := runFleet(hosts, append([]string{bin}, files...), args, 2)
+	if results[0].err != nil || !strings.Contains(results[0].output, "root@good: whitelist -file wl.json -dry-run\n{}") {
+		t.Errorf("good: err=%v output=%q", results[0].err, results[0].output)
+	}
+	if results[1].err == nil || !strings.Contains(results[1].output, "whitelist failed") {
+		t.Errorf("bad: err=%v output=%q", results[1].err, results[1].output)
+	}
+	if results[2].err == nil || !strings.Contains(results[2].err.Error(), "creating temp dir") {
+		t.Errorf("down: err=%v", results[2].err)
+	}
+
+	// temp directories are cleaned up
+	if matches, _ := filepath.Glob("/tmp/cert-manage.*"); len(matches) > 0 {
+		for i := range matches {
+			if fi, err := os.Stat(filepath.Join(matches[i], filepath.Base(bin))); err == nil && fi.Mode().IsRegular() {
+				t.Errorf("%s wasn't removed", matches[i])
+			}
+		}
+	}
+}
+
+func TestCmdFleet__fleetFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-fleet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := filepath.Join(dir, "a", "wl.json")
+	b := filepath.Join(dir, "b", "wl.json")
+	for _, where := range []string{a, b} {
+		os.MkdirAll(filepath.Dir(where), 0755)
+		if err := ioutil.WriteFile(where, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, args, err := fleetFiles([]string{"whitelist", "-file=" + a, "-app", "java"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(args, " ") != "whitelist -file=wl.json -app java" {
+		t.Errorf("got %v", args)
+	}
+	if _, _, err := fleetFiles([]string{"restore", "-file", a, "-from", b}); err == nil {
+		t.Error("expected error for duplicate names")
+	}
+}
+
+func TestCmdFleet__readInventoryIPv6(t *testing.T) {
+	hosts, err := readInventory(strings.NewReader("root@[2001:db8::1]:2222\n2001:db8::2\n[2001:db8::3]\nweb:22\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 4 {
+		t.Fatalf("got %#v", hosts)
+	}
+	cases := []struct {
+		dest, port, scp, str string
+	}{
+		{"root@2001:db8::1", "2222", "root@[2001:db8::1]:/tmp/", "root@[2001:db8::1]:2222"},
+		{"2001:db8::2", "", "[2001:db8::2]:/tmp/", "2001:db8::2"},
+		{"2001:db8::3", "", "[2001:db8::3]:/tmp/", "2001:db8::3"},
+		{"web", "22", "web:/tmp/", "web:22"},
+	}
+	for i := range cases {
+		h := hosts[i]
+		if h.dest() != cases[i].dest || h.port != cases[i].port || h.scpDest("/tmp/") != cases[i].scp || h.String() != cases[i].str {
+			t.Errorf("%d: got %#v", i, h)
+		}
+	}
+}
@@ -109,7 +109,7 @@ func GenerateWhitelist(output string, from, file string) error {
 	}
 
 	// Generate whitelist and write to file
-	authorities, err := gen.FindCAs(accum, nil)
+	authorities, err := gen.FindCAs(accum, verifyRoots())
 	if err != nil {
 		return err
 	}
@@ -149,6 +149,35 @@ func GenerateWhitelist(output string, from, file string) error {
 	return wh.ToFile(output)
 }
 
+// GenerateWhitelistFromBackup writes a whitelist of every certificate trusted
+// by a backup (see store.ReadBackup), capturing the current state as policy.
+func GenerateWhitelistFromBackup(where, output string) error {
+	certs, err := store.ReadBackup(where)
+	if err != nil {
+		return err
+	}
+	return writeCertificatesWhitelist(certs, output)
+}
+
+// GenerateWhitelistFromStdin writes a whitelist of the PEM or DER
+// certificates read from stdin, e.g. a chain from openssl s_client.
+func GenerateWhitelistFromStdin(output string) error {
+	certs, err := readCertificates(stdinPath)
+	if err != nil {
+		return err
+	}
+	return writeCertificatesWhitelist(certs, output)
+}
+
+func writeCertificatesWhitelist(certs []*x509.Certificate, output string) error {
+	wh := whitelist.FromCertificates(certs)
+	if err := wh.ToFile(output); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote whitelist with %d fingerprints to %s\n", len(wh.Fingerprints), output)
+	return nil
+}
+
 func getChoices(from, file string) []string {
 	if !strings.Contains(from, "file") && file != "" {
 		if from != "" {
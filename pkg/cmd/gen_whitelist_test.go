@@ -16,11 +16,17 @@ package cmd
 
 import (
 	"errors"
+	"io/ioutil"
 	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"sync"
 	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
 )
 
 func TestGenWhitelist_getChoices(t *testing.T) {
@@ -95,3 +101,24 @@ func TestGenWhitelist_accumulateUrls(t *testing.T) {
 		}
 	}
 }
+
+func TestGenWhitelist_fromBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-gen-whitelist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "whitelist.json")
+	if err := GenerateWhitelistFromBackup("../../testdata/lots.crt", out); err != nil {
+		t.Fatal(err)
+	}
+	wh, err := whitelist.FromFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, _ := certutil.FromFile("../../testdata/lots.crt")
+	if len(wh.Fingerprints) != len(certs) || !wh.MatchesAll(certs) {
+		t.Errorf("got %v", wh.Fingerprints)
+	}
+}
@@ -0,0 +1,319 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/gpg"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
+	"github.com/adamdecaf/cert-manage/pkg/ui"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+// isGPG returns true if app is the GnuPG keyring, which holds keys rather
+// than certificates and so isn't a store.Store
+func isGPG(app string) bool {
+	return strings.EqualFold(app, "gpg")
+}
+
+func gpgBackupDir() (string, error) {
+	dir, err := store.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gpg"), nil
+}
+
+// gpgKey is how a key is written with -format json
+type gpgKey struct {
+	Fingerprint string   `json:"fingerprint"`
+	UserIDs     []string `json:"userIds"`
+	Algorithm   string   `json:"algorithm"`
+	Bits        int      `json:"bits,omitempty"`
+	Curve       string   `json:"curve,omitempty"`
+	Created     string   `json:"created"`
+	Expires     string   `json:"expires,omitempty"`
+	OwnerTrust  string   `json:"ownerTrust"`
+	Revoked     bool     `json:"revoked"`
+	Secret      bool     `json:"secret"`
+}
+
+// trustedGPGKeys returns the keys in the keyring with marginal, full or
+// ultimate ownertrust
+func trustedGPGKeys() ([]gpg.Key, error) {
+	keys, err := gpg.List()
+	if err != nil {
+		return nil, err
+	}
+	var out []gpg.Key
+	for i := range keys {
+		if keys[i].Trusted() {
+			out = append(out, keys[i])
+		}
+	}
+	return out, nil
+}
+
+func listGPGKeys(w io.Writer, cfg *ui.Config) error {
+	keys, err := trustedGPGKeys()
+	if err != nil {
+		return err
+	}
+	if cfg.Count {
+		fmt.Fprintln(w, len(keys))
+		return nil
+	}
+	if strings.EqualFold(cfg.Format, "json") {
+		return writeGPGKeysJSON(w, keys)
+	}
+	return writeGPGKeysTable(w, keys)
+}
+
+func writeGPGKeysJSON(w io.Writer, keys []gpg.Key) error {
+	out := make([]gpgKey, len(keys))
+	for i, k := range keys {
+		out[i] = gpgKey{
+			Fingerprint: k.Fingerprint,
+			UserIDs:     k.UserIDs,
+			Algorithm:   k.Algorithm,
+			Bits:        k.Bits,
+			Curve:       k.Curve,
+			Created:     k.Created.Format(time.RFC3339),
+			OwnerTrust:  k.OwnerTrust.String(),
+			Revoked:     k.Revoked,
+			Secret:      k.Secret,
+		}
+		if !k.Expires.IsZero() {
+			out[i].Expires = k.Expires.Format(time.RFC3339)
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func writeGPGKeysTable(w io.Writer, keys []gpg.Key) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(tw, "User ID\tFingerprint\tTrust\tAlgorithm\tCreated\tExpires")
+	for _, k := range keys {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", k.Name(), k.Fingerprint, k.OwnerTrust, gpgAlgorithm(k), timeutil.Date(k.Created), gpgExpires(k))
+	}
+	return tw.Flush()
+}
+
+func gpgAlgorithm(k gpg.Key) string {
+	if k.Curve != "" {
+		return fmt.Sprintf("%s %s", k.Algorithm, k.Curve)
+	}
+	return fmt.Sprintf("%s %d", k.Algorithm, k.Bits)
+}
+
+func gpgExpires(k gpg.Key) string {
+	if k.Expires.IsZero() {
+		return "never"
+	}
+	return timeutil.Date(k.Expires)
+}
+
+// auditGPGKeys reports trusted keys which are revoked, expired or expiring
+// soon. Ultimate trust is reported on keys whose secret key isn't in the
+// keyring, as only the user's own keys should have it. With opts.Weak small
+// RSA keys and DSA or ElGamal keys are also reported.
+func auditGPGKeys(w io.Writer, opts AuditOptions) error {
+	keys, err := trustedGPGKeys()
+	if err != nil {
+		return err
+	}
+	findings := gpgFindings(keys, opts.Weak, time.Now())
+	if len(findings) == 0 {
+		fmt.Fprintf(w, "No problems found in %d keys\n", len(keys))
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(tw, "Problem\tUser ID\tFingerprint\tExpires")
+	for i := range findings {
+		k := findings[i].key
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", findings[i].problem, k.Name(), k.Fingerprint, gpgExpires(k))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Found %d problems in %d keys\n", len(findings), len(keys))
+	return nil
+}
+
+type gpgFinding struct {
+	key     gpg.Key
+	problem string
+}
+
+func gpgFindings(keys []gpg.Key, weak bool, now time.Time) []gpgFinding {
+	var out []gpgFinding
+	for _, k := range keys {
+		switch {
+		case k.Revoked:
+			out = append(out, gpgFinding{k, "Revoked"})
+		case !k.Expires.IsZero() && k.Expires.Before(now):
+			out = append(out, gpgFinding{k, "Expired"})
+		case !k.Expires.IsZero() && k.Expires.Before(now.Add(auditExpiringWithin)):
+			out = append(out, gpgFinding{k, "Expiring soon"})
+		}
+		if k.OwnerTrust == gpg.TrustUltimate && !k.Secret {
+			out = append(out, gpgFinding{k, "Ultimate trust without secret key"})
+		}
+		if weak {
+			switch {
+			case k.Algorithm == "DSA" || k.Algorithm == "ElGamal":
+				out = append(out, gpgFinding{k, "Weak key (" + k.Algorithm + ")"})
+			case k.Algorithm == "RSA" && k.Bits < auditMinRSABits:
+				out = append(out, gpgFinding{k, fmt.Sprintf("Weak key (RSA %d)", k.Bits)})
+			}
+		}
+	}
+	return out
+}
+
+func backupGPG() error {
+	if store.DryRun() {
+		fmt.Println("Would backup gpg ownertrust")
+		return nil
+	}
+	dir, err := gpgBackupDir()
+	if err != nil {
+		return err
+	}
+	if _, err := gpg.Backup(dir); err != nil {
+		return err
+	}
+	fmt.Println("Backup completed successfully")
+	return nil
+}
+
+// whitelistGPG removes ownertrust from each trusted key not in
+// wh.GPGKeys. The user's own keys, whose secret key is in the keyring, are
+// kept.
+func whitelistGPG(w io.Writer, wh whitelist.Whitelist) error {
+	dir, err := gpgBackupDir()
+	if err != nil {
+		return err
+	}
+	latest, err := gpg.LatestBackup(dir)
+	if err != nil {
+		return fmt.Errorf("can't get latest gpg backup err=%v", err)
+	}
+	if latest == "" {
+		return errors.New("no gpg backup found")
+	}
+
+	keys, err := trustedGPGKeys()
+	if err != nil {
+		return err
+	}
+	removed, removedFps := gpgKeysToRemove(keys, wh)
+	if store.DryRun() {
+		fmt.Fprintf(w, "Would remove trust from %d of %d key(s) in gpg:\n", len(removed), len(keys))
+		for _, k := range removed {
+			fmt.Fprintf(w, "  %s  %s\n", k.Fingerprint, k.Name())
+		}
+		return nil
+	}
+	if err := gpg.Distrust(removedFps); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "Whitelist completed successfully")
+	return nil
+}
+
+func gpgKeysToRemove(keys []gpg.Key, wh whitelist.Whitelist) ([]gpg.Key, []string) {
+	var removed []gpg.Key
+	var fps []string
+	for _, k := range keys {
+		if k.Secret || wh.MatchesGPGKey(k.Fingerprint) {
+			continue
+		}
+		removed = append(removed, k)
+		fps = append(fps, k.Fingerprint)
+	}
+	return removed, fps
+}
+
+// restoreGPG sets the ownertrust of each key back to a backup, the latest
+// if path is empty
+func restoreGPG(path string, opts RestoreOptions) error {
+	if path == "" {
+		dir, err := gpgBackupDir()
+		if err != nil {
+			return err
+		}
+		path, err = gpg.LatestBackup(dir)
+		if err != nil {
+			return err
+		}
+		if path == "" {
+			return errors.New("no gpg backup found")
+		}
+	}
+	if store.DryRun() {
+		fmt.Printf("Would restore gpg from %s\n", path)
+		return nil
+	}
+	if !opts.Yes {
+		added, removed, err := gpgBackupChanges(path)
+		if err != nil {
+			return err
+		}
+		if err := confirmRestore(os.Stdin, os.Stderr, restoreSummary(path, "key", added, removed)); err != nil {
+			return err
+		}
+	}
+	if err := gpg.Restore(path); err != nil {
+		return err
+	}
+	fmt.Println("Restore completed successfully")
+	return nil
+}
+
+// gpgBackupChanges returns how many keys restoring from `path` trusts again
+// and how many lose their trust
+func gpgBackupChanges(path string) (added, removed int, err error) {
+	backup, err := gpg.ReadBackup(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	keys, err := gpg.List()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, k := range keys {
+		was := gpg.Key{OwnerTrust: backup[k.Fingerprint]}
+		switch {
+		case was.Trusted() && !k.Trusted():
+			added++
+		case !was.Trusted() && k.Trusted():
+			removed++
+		}
+	}
+	return added, removed, nil
+}
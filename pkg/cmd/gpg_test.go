@@ -0,0 +1,91 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/gpg"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+func TestGPG__findings(t *testing.T) {
+	now := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+	keys := []gpg.Key{
+		{Fingerprint: "AA", OwnerTrust: gpg.TrustFull, Algorithm: "EdDSA", Curve: "ed25519"},
+		{Fingerprint: "BB", OwnerTrust: gpg.TrustFull, Algorithm: "RSA", Bits: 1024, Expires: now.Add(-24 * time.Hour)},
+		{Fingerprint: "CC", OwnerTrust: gpg.TrustUltimate, Algorithm: "DSA", Bits: 2048, Expires: now.Add(24 * time.Hour)},
+		{Fingerprint: "DD", OwnerTrust: gpg.TrustMarginal, Algorithm: "RSA", Bits: 4096, Revoked: true},
+	}
+	var problems []string
+	for _, f := range gpgFindings(keys, true, now) {
+		problems = append(problems, f.key.Fingerprint+" "+f.problem)
+	}
+	expected := []string{
+		"BB Expired",
+		"BB Weak key (RSA 1024)",
+		"CC Expiring soon",
+		"CC Ultimate trust without secret key",
+		"CC Weak key (DSA)",
+		"DD Revoked",
+	}
+	if strings.Join(problems, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got %q", problems)
+	}
+	if n := len(gpgFindings(keys, false, now)); n != 4 {
+		t.Errorf("got %d findings without -weak", n)
+	}
+}
+
+func TestGPG__keysToRemove(t *testing.T) {
+	keys := []gpg.Key{
+		{Fingerprint: "A11980C69070F1AE554C141086F4BA95D493C339", OwnerTrust: gpg.TrustFull},
+		{Fingerprint: "315EB93D39E6BDA97A180355888CAC93A3072F11", OwnerTrust: gpg.TrustFull},
+		{Fingerprint: "0000000000000000000000001A2B3C4D5E6F7081", OwnerTrust: gpg.TrustUltimate, Secret: true},
+	}
+	wh := whitelist.Whitelist{
+		GPGKeys: []string{"a119 80c6 9070 f1ae 554c  1410 86f4 ba95 d493 c339"},
+	}
+	removed, fps := gpgKeysToRemove(keys, wh)
+	if len(removed) != 1 || len(fps) != 1 || fps[0] != "315EB93D39E6BDA97A180355888CAC93A3072F11" {
+		t.Errorf("got %v", fps)
+	}
+}
+
+func TestGPG__writeTable(t *testing.T) {
+	keys := []gpg.Key{
+		{
+			Fingerprint: "A11980C69070F1AE554C141086F4BA95D493C339",
+			UserIDs:     []string{"Alice <a@example.com>"},
+			OwnerTrust:  gpg.TrustFull,
+			Algorithm:   "RSA",
+			Bits:        4096,
+			Created:     time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	var buf bytes.Buffer
+	if err := writeGPGKeysTable(&buf, keys); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, s := range []string{"Alice <a@example.com>", "A11980C69070F1AE554C141086F4BA95D493C339", "full", "RSA 4096", "2018-01-02", "never"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("missing %q in\n%s", s, out)
+		}
+	}
+}
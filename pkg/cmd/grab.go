@@ -0,0 +1,310 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/httputil"
+)
+
+var (
+	// grabTimeout bounds the connection, STARTTLS negotiation and handshake
+	grabTimeout = 10 * time.Second
+
+	// starttlsProtocols upgrade a plaintext connection to TLS, keyed by the
+	// name given to -starttls
+	starttlsProtocols = map[string]starttlsProtocol{
+		"ftp":      {port: "21", upgrade: starttlsFTP},
+		"imap":     {port: "143", upgrade: starttlsIMAP},
+		"pop3":     {port: "110", upgrade: starttlsPOP3},
+		"postgres": {port: "5432", upgrade: starttlsPostgres},
+		"smtp":     {port: "25", upgrade: starttlsSMTP},
+	}
+)
+
+type starttlsProtocol struct {
+	port    string // used when the address has no port
+	upgrade func(conn net.Conn) error
+}
+
+// GetStartTLSProtocols returns the protocols supported by -starttls
+func GetStartTLSProtocols() []string {
+	var out []string
+	for name := range starttlsProtocols {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// GrabOptions control how a server's chain is grabbed
+type GrabOptions struct {
+	// ServerName is sent as SNI instead of the host of the address
+	ServerName string
+
+	// StartTLS negotiates TLS from a plaintext protocol, e.g. smtp
+	StartTLS string
+
+	// Out is where to save the chain, otherwise it's written to stdout
+	Out string
+}
+
+// Grab connects to addr and writes the chain the server presented, leaf
+// first. The chain isn't required to verify, but whether it does against
+// the platform's roots is reported.
+//
+// Without opts.Out the chain is written as PEM to stdout, so it can be piped
+// into 'show -', 'add -' or 'gen-whitelist -from -'.
+func Grab(addr string, opts GrabOptions) error {
+	chain, host, err := grabChain(addr, opts)
+	if err != nil {
+		return err
+	}
+	verr := verifyGrabbed(chain, host)
+
+	if opts.Out == "" {
+		return writeGrabbed(os.Stdout, chain, verr)
+	}
+	if err := writeExport(opts.Out, chain); err != nil {
+		return err
+	}
+	for i := range chain {
+		fmt.Printf("%d %s\n", i, certutil.StringifyPKIXName(chain[i].Subject))
+	}
+	if verr != nil {
+		fmt.Printf("Warning: chain doesn't verify: %v\n", verr)
+	}
+	fmt.Printf("Saved %d certificates from %s to %s\n", len(chain), addr, opts.Out)
+	return nil
+}
+
+// grabChain returns the certificates presented by the server at addr and
+// the server name they were requested for.
+func grabChain(addr string, opts GrabOptions) ([]*x509.Certificate, string, error) {
+	var proto *starttlsProtocol
+	if opts.StartTLS != "" {
+		p, ok := starttlsProtocols[strings.ToLower(opts.StartTLS)]
+		if !ok {
+			return nil, "", fmt.Errorf("unknown -starttls protocol %q (options: %s)", opts.StartTLS, strings.Join(GetStartTLSProtocols(), ", "))
+		}
+		proto = &p
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+		port := "443"
+		if proto != nil {
+			port = proto.port
+		}
+		addr = net.JoinHostPort(addr, port)
+	}
+	if opts.ServerName != "" {
+		host = opts.ServerName
+	}
+
+	if err := httputil.CheckOnline("connecting to " + addr); err != nil {
+		return nil, "", err
+	}
+	conn, err := net.DialTimeout("tcp", addr, grabTimeout)
+	if err != nil {
+		return nil, "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(grabTimeout))
+
+	if proto != nil {
+		if err := proto.upgrade(conn); err != nil {
+			return nil, "", fmt.Errorf("%s STARTTLS with %s failed: %v", opts.StartTLS, addr, err)
+		}
+	}
+
+	// The chain is wanted whether or not it verifies, it's checked after.
+	tconn := tls.Client(conn, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true,
+	})
+	if err := tconn.Handshake(); err != nil {
+		return nil, "", fmt.Errorf("TLS handshake with %s failed: %v", addr, err)
+	}
+	chain := tconn.ConnectionState().PeerCertificates
+	if len(chain) == 0 {
+		return nil, "", fmt.Errorf("%s presented no certificates", addr)
+	}
+	if debug {
+		fmt.Printf("cmd: grabbed %d certificates from %s\n", len(chain), addr)
+	}
+	return chain, host, nil
+}
+
+// verifyGrabbed checks chain against the platform's roots and that it's
+// valid for host.
+func verifyGrabbed(chain []*x509.Certificate, host string) error {
+	intermediates := x509.NewCertPool()
+	for i := 1; i < len(chain); i++ {
+		intermediates.AddCert(chain[i])
+	}
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+// writeGrabbed writes chain as PEM, each certificate is preceded by comment
+// lines with its subject and issuer (like 'openssl s_client -showcerts').
+// PEM decoders skip these lines.
+func writeGrabbed(w io.Writer, chain []*x509.Certificate, verr error) error {
+	for i := range chain {
+		fmt.Fprintf(w, "# %d s:%s\n", i, certutil.StringifyPKIXName(chain[i].Subject))
+		fmt.Fprintf(w, "#   i:%s\n", certutil.StringifyPKIXName(chain[i].Issuer))
+		err := pem.Encode(w, &pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: chain[i].Raw,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if verr != nil {
+		fmt.Fprintf(w, "# chain doesn't verify: %s\n", strings.Replace(verr.Error(), "\n", " ", -1))
+	}
+	return nil
+}
+
+// readReply reads a (possibly multi-line) reply, as used by smtp and ftp,
+// and checks it has the expected code.
+func readReply(r *bufio.Reader, code string) error {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if !strings.HasPrefix(line, code) {
+			return fmt.Errorf("unexpected reply %q", line)
+		}
+		// "250-" continues a reply and "250 " ends it
+		if len(line) == len(code) || line[len(code)] != '-' {
+			return nil
+		}
+	}
+}
+
+// readUntil reads lines until one starts with prefix, which is returned
+func readUntil(r *bufio.Reader, prefix string) (string, error) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimRight(line, "\r\n"), nil
+		}
+	}
+}
+
+// starttlsSMTP upgrades SMTP, RFC 3207
+func starttlsSMTP(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	if err := readReply(r, "220"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "EHLO cert-manage\r\n"); err != nil {
+		return err
+	}
+	if err := readReply(r, "250"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "STARTTLS\r\n"); err != nil {
+		return err
+	}
+	return readReply(r, "220")
+}
+
+// starttlsFTP upgrades FTP, RFC 4217
+func starttlsFTP(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	if err := readReply(r, "220"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "AUTH TLS\r\n"); err != nil {
+		return err
+	}
+	return readReply(r, "234")
+}
+
+// starttlsIMAP upgrades IMAP, RFC 2595
+func starttlsIMAP(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	if _, err := readUntil(r, "* OK"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "a1 STARTTLS\r\n"); err != nil {
+		return err
+	}
+	line, err := readUntil(r, "a1 ")
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "a1 OK") {
+		return fmt.Errorf("unexpected reply %q", line)
+	}
+	return nil
+}
+
+// starttlsPOP3 upgrades POP3, RFC 2595
+func starttlsPOP3(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	if err := readReply(r, "+OK"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "STLS\r\n"); err != nil {
+		return err
+	}
+	return readReply(r, "+OK")
+}
+
+// starttlsPostgres sends an SSLRequest, the server answers 'S' if it
+// supports TLS.
+func starttlsPostgres(conn net.Conn) error {
+	req := make([]byte, 8)
+	binary.BigEndian.PutUint32(req[0:4], 8)
+	binary.BigEndian.PutUint32(req[4:8], 80877103)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	resp := make([]byte, 1)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return err
+	}
+	if resp[0] != 'S' {
+		return fmt.Errorf("server doesn't support TLS (replied %q)", resp[0])
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+)
+
+// grabServer accepts one connection, runs greet (the plaintext side of a
+// STARTTLS protocol) and then a TLS handshake presenting h's chain.
+func grabServer(t *testing.T, h *testca.Hierarchy, greet func(rw *bufio.ReadWriter)) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := tls.Certificate{
+		Certificate: [][]byte{h.Leaf.Raw, h.Intermediate.Certificate.Raw},
+		PrivateKey:  h.LeafKey,
+	}
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if greet != nil {
+			greet(bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)))
+		}
+		tconn := tls.Server(conn, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+		})
+		tconn.Handshake()
+		io.Copy(ioutil.Discard, tconn)
+	}()
+	return ln.Addr().String()
+}
+
+func TestGrab__tls(t *testing.T) {
+	h, err := testca.NewHierarchy("grab.example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := grabServer(t, h, nil)
+
+	chain, host, err := grabChain(addr, GrabOptions{ServerName: "grab.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host != "grab.example.com" {
+		t.Errorf("got host %q", host)
+	}
+	if len(chain) != 2 || !chain[0].Equal(h.Leaf) || !chain[1].Equal(h.Intermediate.Certificate) {
+		t.Fatalf("got %d certs", len(chain))
+	}
+
+	// the test root isn't trusted, but the chain is still written
+	verr := verifyGrabbed(chain, host)
+	if verr == nil {
+		t.Fatal("expected verify error")
+	}
+	var buf bytes.Buffer
+	if err := writeGrabbed(&buf, chain, verr); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "# 0 s:") || !strings.Contains(buf.String(), "# chain doesn't verify") {
+		t.Errorf("got %s", buf.String())
+	}
+	certs, err := certutil.Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 {
+		t.Errorf("decoded %d certs", len(certs))
+	}
+}
+
+func TestGrab__starttls(t *testing.T) {
+	h, err := testca.NewHierarchy("mail.example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]func(rw *bufio.ReadWriter){
+		"smtp": func(rw *bufio.ReadWriter) {
+			rw.WriteString("220 mail.example.com ESMTP\r\n")
+			rw.Flush()
+			rw.ReadString('\n') // EHLO
+			rw.WriteString("250-mail.example.com\r\n250-PIPELINING\r\n250 STARTTLS\r\n")
+			rw.Flush()
+			rw.ReadString('\n') // STARTTLS
+			rw.WriteString("220 Go ahead\r\n")
+			rw.Flush()
+		},
+		"imap": func(rw *bufio.ReadWriter) {
+			rw.WriteString("* OK [CAPABILITY IMAP4rev1 STARTTLS] ready\r\n")
+			rw.Flush()
+			line, _ := rw.ReadString('\n')
+			tag := strings.Fields(line)[0]
+			rw.WriteString(tag + " OK Begin TLS negotiation now\r\n")
+			rw.Flush()
+		},
+		"pop3": func(rw *bufio.ReadWriter) {
+			rw.WriteString("+OK POP3 ready\r\n")
+			rw.Flush()
+			rw.ReadString('\n') // STLS
+			rw.WriteString("+OK Begin TLS negotiation\r\n")
+			rw.Flush()
+		},
+		"ftp": func(rw *bufio.ReadWriter) {
+			rw.WriteString("220-Welcome\r\n220 FTP ready\r\n")
+			rw.Flush()
+			rw.ReadString('\n') // AUTH TLS
+			rw.WriteString("234 AUTH TLS successful\r\n")
+			rw.Flush()
+		},
+		"postgres": func(rw *bufio.ReadWriter) {
+			io.ReadFull(rw, make([]byte, 8)) // SSLRequest
+			rw.WriteString("S")
+			rw.Flush()
+		},
+	}
+	for proto, greet := range cases {
+		addr := grabServer(t, h, greet)
+		chain, _, err := grabChain(addr, GrabOptions{
+			ServerName: "mail.example.com",
+			StartTLS:   proto,
+		})
+		if err != nil {
+			t.Errorf("%s: %v", proto, err)
+			continue
+		}
+		if len(chain) != 2 || !chain[0].Equal(h.Leaf) {
+			t.Errorf("%s: got %d certs", proto, len(chain))
+		}
+	}
+}
+
+func TestGrab__starttlsRefused(t *testing.T) {
+	h, err := testca.NewHierarchy("mail.example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := grabServer(t, h, func(rw *bufio.ReadWriter) {
+		rw.WriteString("220 mail.example.com ESMTP\r\n")
+		rw.Flush()
+		rw.ReadString('\n')
+		rw.WriteString("250 mail.example.com\r\n")
+		rw.Flush()
+		rw.ReadString('\n')
+		rw.WriteString("454 TLS not available\r\n")
+		rw.Flush()
+	})
+	_, _, err = grabChain(addr, GrabOptions{StartTLS: "smtp"})
+	if err == nil || !strings.Contains(err.Error(), "454 TLS not available") {
+		t.Errorf("got %v", err)
+	}
+
+	if _, _, err := grabChain(addr, GrabOptions{StartTLS: "gopher"}); err == nil || !strings.Contains(err.Error(), "unknown -starttls") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestGrab__out(t *testing.T) {
+	h, err := testca.NewHierarchy("grab.example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := grabServer(t, h, nil)
+	dir, err := ioutil.TempDir("", "cert-manage-grab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "chain.pem")
+	if err := Grab(addr, GrabOptions{ServerName: "grab.example.com", Out: out}); err != nil {
+		t.Fatal(err)
+	}
+	certs, err := certutil.FromFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 {
+		t.Errorf("got %d certs", len(certs))
+	}
+}
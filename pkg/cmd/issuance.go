@@ -0,0 +1,42 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/x509"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/crtsh"
+	"github.com/adamdecaf/cert-manage/pkg/ui"
+)
+
+var (
+	// issuanceWindow is how far back issued certificates are counted
+	issuanceWindow = 365 * 24 * time.Hour
+)
+
+// addIssuance looks up how many certificates each root has issued recently,
+// if it's been asked for with -issuance.
+func addIssuance(certs []*x509.Certificate, cfg *ui.Config) error {
+	if cfg.Issuance == nil {
+		return nil
+	}
+	issuance, err := crtsh.Issuance(certs, time.Now().Add(-1*issuanceWindow))
+	if err != nil {
+		return err
+	}
+	cfg.Issuance = issuance
+	return nil
+}
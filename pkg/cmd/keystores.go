@@ -0,0 +1,226 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+// keystoreResult is the outcome of whitelisting one java keystore
+type keystoreResult struct {
+	path string
+
+	before, after int
+
+	// unchanged is set when the whitelist was already applied
+	unchanged bool
+
+	err error
+}
+
+// WhitelistJavaKeystores finds every java keystore under roots (or the
+// default java install locations) and applies a whitelist to each of them,
+// `parallel` at a time. Each keystore is backed up first.
+//
+// A table of each keystore's result is printed once they're all done.
+func WhitelistJavaKeystores(whpath, profile string, roots []string, parallel int, force bool) error {
+	wh, err := loadWhitelist(whpath, profile)
+	if err != nil {
+		return err
+	}
+	paths, err := store.FindJavaKeystores(roots)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no java keystores found")
+	}
+
+	// keep -dry-run output readable
+	if store.DryRun() {
+		parallel = 1
+	}
+	results := whitelistKeystores(paths, wh, parallel, force)
+	if err := writeKeystoreResults(os.Stdout, results); err != nil {
+		return err
+	}
+
+	failed := 0
+	for i := range results {
+		if results[i].err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("whitelist failed for %d of %d keystores", failed, len(results))
+	}
+	return nil
+}
+
+// whitelistKeystores applies wh to each keystore, results are returned in
+// the same order as paths.
+func whitelistKeystores(paths []string, wh whitelist.Whitelist, parallel int, force bool) []keystoreResult {
+	if parallel < 1 {
+		parallel = 1
+	}
+	results := make([]keystoreResult, len(paths))
+
+	var wg sync.WaitGroup
+	work := make(chan int)
+	for n := 0; n < parallel; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				if interrupt.Interrupted() {
+					results[i] = keystoreResult{path: paths[i], err: interrupt.ErrInterrupted}
+					continue
+				}
+				results[i] = whitelistKeystore(paths[i], wh, force)
+			}
+		}()
+	}
+	for i := range paths {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	return results
+}
+
+func whitelistKeystore(path string, wh whitelist.Whitelist, force bool) keystoreResult {
+	res := keystoreResult{path: path}
+	name := "java:" + path
+	s, err := store.ForApp(name)
+	if err != nil {
+		res.err = err
+		return res
+	}
+
+	before, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	if err != nil {
+		res.err = err
+		return res
+	}
+	res.before, res.after = len(before), len(before)
+
+	if !force {
+		applied, err := whitelistApplied(s, name, wh, false)
+		if err != nil {
+			res.err = err
+			return res
+		}
+		if applied {
+			res.unchanged = true
+			return res
+		}
+	}
+
+	if err := s.Backup(); err != nil {
+		res.err = fmt.Errorf("error taking backup: %v", err)
+		return res
+	}
+	if err := s.Remove(wh); err != nil {
+		res.err = err
+		return res
+	}
+	if store.DryRun() {
+		return res
+	}
+
+	after, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	if err != nil {
+		res.err = err
+		return res
+	}
+	res.after = len(after)
+	res.err = recordWhitelist(s, name, wh, false)
+	return res
+}
+
+// ListJavaInstalls prints every java install found under roots (or the
+// default locations, including SDKMAN, jlink runtimes and container
+// images) with its keystore and how many certificates the keystore trusts.
+func ListJavaInstalls(roots []string) error {
+	installs, err := store.FindJavaInstalls(roots)
+	if err != nil {
+		return err
+	}
+	if len(installs) == 0 {
+		return fmt.Errorf("no java installs found")
+	}
+	counts := make(map[string]string)
+	for i := range installs {
+		kpath := installs[i].Keystore
+		if _, ok := counts[kpath]; ok {
+			continue
+		}
+		certs, err := store.JavaKeystore(kpath).List(&store.ListOptions{
+			Trusted: true,
+		})
+		if err != nil {
+			counts[kpath] = fmt.Sprintf("error: %v", err)
+			continue
+		}
+		counts[kpath] = fmt.Sprintf("%d", len(certs))
+	}
+	return writeJavaInstalls(os.Stdout, installs, counts)
+}
+
+func writeJavaInstalls(w io.Writer, installs []store.JavaInstall, counts map[string]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(tw, "Keystore\tCertificates\tHome\tVendor\tVersion\tSource")
+	for i := range installs {
+		in := installs[i]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", in.Keystore, counts[in.Keystore], in.Home, orDash(in.Vendor), orDash(in.Version), in.Source)
+	}
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func writeKeystoreResults(w io.Writer, results []keystoreResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(tw, "Keystore\tBefore\tRemoved\tResult")
+	for i := range results {
+		r := results[i]
+		result := "whitelisted"
+		switch {
+		case r.err != nil:
+			result = fmt.Sprintf("error: %v", r.err)
+		case r.unchanged:
+			result = "already applied"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", r.path, r.before, r.before-r.after, result)
+	}
+	return tw.Flush()
+}
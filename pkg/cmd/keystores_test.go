@@ -0,0 +1,90 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+func TestCmdKeystores__whitelist(t *testing.T) {
+	paths := []string{"/missing/a/cacerts", "/missing/b/cacerts", "/missing/c/cacerts"}
+	results := whitelistKeystores(paths, whitelist.Whitelist{}, 2, true)
+	if len(results) != len(paths) {
+		t.Fatalf("got %d results", len(results))
+	}
+	for i := range results {
+		if results[i].path != paths[i] {
+			t.Errorf("result %d is for %s", i, results[i].path)
+		}
+		if results[i].err == nil {
+			t.Errorf("expected error for %s", results[i].path)
+		}
+	}
+}
+
+func TestCmdKeystores__results(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeKeystoreResults(&buf, []keystoreResult{
+		{path: "/opt/jdk8/cacerts", before: 150, after: 40},
+		{path: "/opt/jdk11/cacerts", before: 40, after: 40, unchanged: true},
+		{path: "/opt/jdk12/cacerts", err: errors.New("permission denied")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %q", buf.String())
+	}
+	if !strings.Contains(lines[1], "110") || !strings.HasSuffix(lines[1], "whitelisted") {
+		t.Errorf("got %q", lines[1])
+	}
+	if !strings.HasSuffix(lines[2], "already applied") {
+		t.Errorf("got %q", lines[2])
+	}
+	if !strings.HasSuffix(lines[3], "error: permission denied") {
+		t.Errorf("got %q", lines[3])
+	}
+}
+
+func TestCmdKeystores__javaInstalls(t *testing.T) {
+	installs := []store.JavaInstall{
+		{Home: "/usr/lib/jvm/java-11", Keystore: "/etc/ssl/certs/java/cacerts", Vendor: "Debian", Version: "11.0.16", Source: "system"},
+		{Home: "/usr/lib/jvm/java-17", Keystore: "/etc/ssl/certs/java/cacerts", Source: "system"},
+	}
+	counts := map[string]string{
+		"/etc/ssl/certs/java/cacerts": "140",
+	}
+	var buf bytes.Buffer
+	if err := writeJavaInstalls(&buf, installs, counts); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %s", buf.String())
+	}
+	if fields := strings.Fields(lines[1]); strings.Join(fields, " ") != "/etc/ssl/certs/java/cacerts 140 /usr/lib/jvm/java-11 Debian 11.0.16 system" {
+		t.Errorf("got %q", lines[1])
+	}
+	if fields := strings.Fields(lines[2]); strings.Join(fields, " ") != "/etc/ssl/certs/java/cacerts 140 /usr/lib/jvm/java-17 - - system" {
+		t.Errorf("got %q", lines[2])
+	}
+}
@@ -15,13 +15,17 @@
 package cmd
 
 import (
+	"crypto/x509"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"runtime"
 
 	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/cosign"
+	"github.com/adamdecaf/cert-manage/pkg/fetch"
 	"github.com/adamdecaf/cert-manage/pkg/httputil"
 	"github.com/adamdecaf/cert-manage/pkg/store"
 	"github.com/adamdecaf/cert-manage/pkg/ui"
@@ -29,6 +33,12 @@ import (
 
 var (
 	maxDownloadSize int64 = 10 * 1024 * 1024 // bytes
+
+	// platformRootPrograms is the root program each platform's vendor ships roots from
+	platformRootPrograms = map[string]string{
+		"darwin":  "apple",
+		"windows": "microsoft",
+	}
 )
 
 // ListCertsFromFile finds certificates at the given filepath
@@ -40,8 +50,10 @@ func ListCertsFromFile(where string, cfg *ui.Config) error {
 	}
 	certs, err := certutil.Decode(bs)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return err
+	}
+	if err := addIssuance(certs, cfg); err != nil {
+		return err
 	}
 	return ui.ListCertificates(certs, cfg)
 }
@@ -56,27 +68,30 @@ func ListCertsFromURL(where string, cfg *ui.Config) (err error) {
 	req.Close = true
 
 	resp, err := httputil.New().Do(req)
+	if err != nil {
+		return err
+	}
 	defer func() {
-		if resp.Body != nil {
-			err = resp.Body.Close()
+		if cerr := resp.Body.Close(); err == nil {
+			err = cerr
 		}
 	}()
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
 
 	// read out certs
 	r := io.LimitReader(resp.Body, maxDownloadSize)
 	bs, err := ioutil.ReadAll(r)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return err
+	}
+	if err := cosign.VerifyDownload(where, bs); err != nil {
+		return err
 	}
 	certs, err := certutil.Decode(bs)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return err
+	}
+	if err := addIssuance(certs, cfg); err != nil {
+		return err
 	}
 	return ui.ListCertificates(certs, cfg)
 }
@@ -89,39 +104,87 @@ func ListCertsForPlatform(cfg *ui.Config) error {
 	certificates, err := st.List(&store.ListOptions{
 		Trusted: true,
 	})
+	err = warnPartial(err)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return err
+	}
+	if err := addIssuance(certificates, cfg); err != nil {
+		return err
 	}
 	meta := createMeta(st)
 	return ui.ListCertificatesWithMeta(meta, certificates, cfg)
 }
 
+// ListAddedCertsForPlatform lists the trusted certificates which aren't part of
+// the platform vendor's root program. These were added by an admin, user or
+// software like a corporate proxy (or malware) intercepting TLS.
+func ListAddedCertsForPlatform(cfg *ui.Config) error {
+	program, ok := platformRootPrograms[runtime.GOOS]
+	if !ok {
+		return fmt.Errorf("-added-only isn't supported on %s", runtime.GOOS)
+	}
+	res, err := fetch.Fetch(program)
+	if err != nil {
+		return fmt.Errorf("fetching %s: %v", program, err)
+	}
+
+	st := store.Platform()
+	certificates, err := st.List(&store.ListOptions{
+		Trusted: true,
+	})
+	if err = warnPartial(err); err != nil {
+		return err
+	}
+	added := notInRootProgram(certificates, res.Fingerprints)
+	if err := addIssuance(added, cfg); err != nil {
+		return err
+	}
+	meta := createMeta(st)
+	return ui.ListCertificatesWithMeta(meta, added, cfg)
+}
+
+// notInRootProgram returns the certificates whose fingerprint isn't in fingerprints
+func notInRootProgram(certs []*x509.Certificate, fingerprints []string) []*x509.Certificate {
+	program := make(map[string]bool, len(fingerprints))
+	for i := range fingerprints {
+		program[fingerprints[i]] = true
+	}
+	var out []*x509.Certificate
+	for i := range certs {
+		if !program[certutil.GetHexSHA256Fingerprint(*certs[i])] {
+			out = append(out, certs[i])
+		}
+	}
+	return out
+}
+
 // ListCertsForApp finds certs for the given app.
 // The supported applications are listed in the readme. This includes
 // non-traditional applications like NSS.
 func ListCertsForApp(app string, cfg *ui.Config) error {
+	if isGPG(app) {
+		return listGPGKeys(os.Stdout, cfg)
+	}
+	if isSSH(app) {
+		return listSSHCAs(os.Stdout, cfg)
+	}
 	st, err := store.ForApp(app)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return err
 	}
 
 	certificates, err := st.List(&store.ListOptions{
 		Trusted: true,
 	})
+	err = warnPartial(err)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-
-	// Break if we had some error
-	if err != nil {
-		fmt.Printf("error finding certificates for application %s\n", err)
-		os.Exit(1)
+		return err
 	}
 
 	// Output the certificates
+	if err := addIssuance(certificates, cfg); err != nil {
+		return err
+	}
 	meta := createMeta(st)
 	return ui.ListCertificatesWithMeta(meta, certificates, cfg)
 }
@@ -133,3 +196,17 @@ func createMeta(st store.Store) ui.Meta {
 		Version: info.Version,
 	}
 }
+
+// warnPartial prints each path of a store which couldn't be read and returns
+// nil, as the certificates from the other paths are still usable. Other errors
+// are returned as-is.
+func warnPartial(err error) error {
+	perr, ok := store.IsPartial(err)
+	if !ok {
+		return err
+	}
+	for i := range perr.Errors {
+		fmt.Fprintf(os.Stderr, "WARNING: skipped %s: %v\n", perr.Errors[i].Path, perr.Errors[i].Err)
+	}
+	return nil
+}
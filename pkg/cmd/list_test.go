@@ -23,6 +23,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
 	"github.com/adamdecaf/cert-manage/pkg/ui"
 )
 
@@ -69,3 +70,21 @@ func TestCmdList__url(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestCmdList__notInRootProgram(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := []string{
+		certutil.GetHexSHA256Fingerprint(*certs[0]),
+		certutil.GetHexSHA256Fingerprint(*certs[2]),
+	}
+	added := notInRootProgram(certs, program)
+	if len(added) != len(certs)-2 {
+		t.Fatalf("got %d", len(added))
+	}
+	if added[0] != certs[1] {
+		t.Errorf("got %s", added[0].Subject.CommonName)
+	}
+}
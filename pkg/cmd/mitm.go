@@ -0,0 +1,147 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/fetch"
+	"github.com/adamdecaf/cert-manage/pkg/httputil"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+)
+
+var (
+	// mitmHosts are well-known sites checked when no hosts are given, TLS
+	// interception appliances rarely exempt all of them.
+	mitmHosts = []string{
+		"www.google.com",
+		"www.mozilla.org",
+		"github.com",
+		"www.microsoft.com",
+		"www.apple.com",
+		"www.wikipedia.org",
+	}
+)
+
+func DetectMITMForPlatform(hosts []string) error {
+	certs, err := store.Platform().List(&store.ListOptions{
+		Trusted: true,
+	})
+	if err = warnPartial(err); err != nil {
+		return err
+	}
+	return detectMITMWithRoots(hosts, certs, runtime.GOOS)
+}
+
+func DetectMITMForApp(app string, hosts []string) error {
+	s, err := store.ForApp(app)
+	if err != nil {
+		return err
+	}
+	certs, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	if err = warnPartial(err); err != nil {
+		return err
+	}
+	return detectMITMWithRoots(hosts, certs, app)
+}
+
+// detectMITMWithRoots fetches the public root programs (NSS and the
+// platform's own) and checks hosts against them. With -offline the snapshot
+// of NSS built into cert-manage is used instead.
+func detectMITMWithRoots(hosts []string, roots []*x509.Certificate, name string) error {
+	sources := []string{"nss"}
+	if httputil.Offline {
+		sources = []string{"embedded"}
+	}
+	if program, ok := platformRootPrograms[runtime.GOOS]; ok {
+		sources = append(sources, program)
+	}
+	public := make(map[string]bool)
+	for i := range sources {
+		res, err := fetch.Fetch(sources[i])
+		if err != nil {
+			return fmt.Errorf("fetching %s: %v", sources[i], err)
+		}
+		for _, fp := range res.Fingerprints {
+			public[fp] = true
+		}
+	}
+	if len(hosts) == 0 {
+		hosts = mitmHosts
+	}
+	return detectMITM(os.Stdout, hosts, roots, public, name)
+}
+
+// detectMITM connects to each host trusting roots and reports hosts whose
+// chain ends at a root which isn't in public (SHA256 fingerprints of publicly
+// trusted roots). Those connections are intercepted by whoever installed the
+// root, e.g. a TLS inspecting proxy or antivirus.
+func detectMITM(w io.Writer, hosts []string, roots []*x509.Certificate, public map[string]bool, name string) error {
+	pool := x509.NewCertPool()
+	for i := range roots {
+		pool.AddCert(roots[i])
+	}
+
+	intercepted := make(map[string][]string) // root fingerprint -> hosts
+	var interceptors []*x509.Certificate
+	failures := 0
+	for i := range hosts {
+		addr := hosts[i]
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "443")
+		}
+		chain, err := verifiedChain(addr, pool)
+		if err != nil {
+			// an appliance whose root isn't in this store fails here
+			fmt.Fprintf(w, "FAILED %s: %v\n", hosts[i], err)
+			failures++
+			continue
+		}
+		root := chain[len(chain)-1]
+		fp := certutil.GetHexSHA256Fingerprint(*root)
+		if public[fp] {
+			fmt.Fprintf(w, "OK %s (%s)\n", hosts[i], certutil.StringifyPKIXName(root.Subject))
+			continue
+		}
+		fmt.Fprintf(w, "INTERCEPTED %s by %s (%s)\n", hosts[i], certutil.StringifyPKIXName(root.Subject), fp[:16])
+		if _, ok := intercepted[fp]; !ok {
+			interceptors = append(interceptors, root)
+		}
+		intercepted[fp] = append(intercepted[fp], hosts[i])
+	}
+
+	if len(interceptors) > 0 {
+		var names []string
+		for i := range interceptors {
+			fp := certutil.GetHexSHA256Fingerprint(*interceptors[i])
+			names = append(names, fmt.Sprintf("%s (%s, %d hosts)", certutil.StringifyPKIXName(interceptors[i].Subject), fp[:16], len(intercepted[fp])))
+		}
+		return fmt.Errorf("TLS from %s is intercepted by locally installed root(s): %s", name, strings.Join(names, ", "))
+	}
+	if failures == len(hosts) {
+		return fmt.Errorf("unable to verify any of %d hosts", len(hosts))
+	}
+	fmt.Fprintf(w, "No interception found from %s\n", name)
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+func TestCmdMITM__detect(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+	root := srv.Certificate()
+	fp := certutil.GetHexSHA256Fingerprint(*root)
+
+	lots, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := append(lots, root)
+
+	// the server's root is publicly trusted
+	var buf bytes.Buffer
+	if err := detectMITM(&buf, []string{host}, roots, map[string]bool{fp: true}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "OK "+host) {
+		t.Errorf("got %s", buf.String())
+	}
+
+	// not public, so it's an interceptor
+	buf.Reset()
+	err = detectMITM(&buf, []string{host}, roots, map[string]bool{}, "test")
+	if err == nil || !strings.Contains(err.Error(), fp[:16]+", 1 hosts") {
+		t.Errorf("got %v", err)
+	}
+	if !strings.Contains(buf.String(), "INTERCEPTED "+host) {
+		t.Errorf("got %s", buf.String())
+	}
+
+	// without the root nothing verifies
+	buf.Reset()
+	err = detectMITM(&buf, []string{host}, lots, map[string]bool{fp: true}, "test")
+	if err == nil || !strings.Contains(buf.String(), "FAILED "+host) {
+		t.Errorf("got %v, %s", err, buf.String())
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
+	"github.com/adamdecaf/cert-manage/pkg/observe"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+// ObserveOptions configures the 'observe' proxy
+type ObserveOptions struct {
+	// Listen is the address the proxy accepts connections on
+	Listen string
+
+	// Duration stops observing after a period, otherwise Ctrl-C does
+	Duration time.Duration
+
+	// Whitelist is compared against the roots observed, if non-empty
+	Whitelist string
+
+	// Out is where to write a whitelist of the observed roots, if non-empty
+	Out string
+}
+
+func ObserveForApp(app string, opts ObserveOptions) error {
+	s, err := store.ForApp(app)
+	if err != nil {
+		return err
+	}
+	return observeStore(s, opts)
+}
+
+func ObserveForPlatform(opts ObserveOptions) error {
+	return observeStore(store.Platform(), opts)
+}
+
+func observeStore(s store.Store, opts ObserveOptions) error {
+	certs, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	err = warnPartial(err)
+	if err != nil {
+		return err
+	}
+
+	var wh *whitelist.Whitelist
+	if opts.Whitelist != "" {
+		w, err := loadWhitelist(opts.Whitelist, "")
+		if err != nil {
+			return err
+		}
+		wh = &w
+	}
+
+	ln, err := net.Listen("tcp", opts.Listen)
+	if err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	go func() {
+		var timeout <-chan time.Time
+		if opts.Duration > 0 {
+			timeout = time.After(opts.Duration)
+		}
+		select {
+		case <-interrupt.Context().Done():
+		case <-timeout:
+		}
+		close(stop)
+	}()
+	return observeUntil(os.Stdout, ln, observe.New(certs), certs, wh, opts.Out, stop)
+}
+
+// observeUntil proxies connections accepted on ln until stop is closed,
+// then reports which roots were used.
+func observeUntil(w io.Writer, ln net.Listener, o *observe.Observer, certs []*x509.Certificate, wh *whitelist.Whitelist, out string, stop <-chan struct{}) error {
+	srv := &http.Server{
+		Handler: o,
+	}
+	go srv.Serve(ln)
+
+	fmt.Fprintf(w, "Recording TLS connections proxied through %s, press Ctrl-C to stop\n", ln.Addr())
+	fmt.Fprintf(w, "Point clients at it, e.g. HTTPS_PROXY=http://%s\n", ln.Addr())
+	<-stop
+	srv.Close()
+
+	roots := o.Roots()
+	if err := writeObservedRoots(w, roots, o.Unknown()); err != nil {
+		return err
+	}
+	if wh != nil {
+		writeWhitelistSuggestions(w, roots, certs, *wh)
+	}
+	if out != "" && len(roots) > 0 {
+		var used []*x509.Certificate
+		for i := range roots {
+			used = append(used, roots[i].Certificate)
+		}
+		if err := whitelist.FromCertificates(used).ToFile(out); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Wrote whitelist of %d observed roots to %s\n", len(used), out)
+	}
+	return nil
+}
+
+func writeObservedRoots(w io.Writer, roots []observe.Root, unknown []string) error {
+	if len(roots) == 0 {
+		fmt.Fprintln(w, "No TLS connections to trusted roots were observed")
+	} else {
+		tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+		fmt.Fprintln(tw, "CA\tFingerprint\tConnections\tExample Hosts")
+		for i := range roots {
+			hosts := roots[i].Hosts
+			if len(hosts) > exampleDNSNamesLength {
+				hosts = hosts[:exampleDNSNamesLength]
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n",
+				certutil.StringifyPKIXName(roots[i].Certificate.Subject),
+				roots[i].Fingerprint[:16],
+				roots[i].Connections,
+				strings.Join(hosts, ", "),
+			)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(unknown) > 0 {
+		fmt.Fprintf(w, "WARNING: no trusted root found for %d hosts: %s\n", len(unknown), strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// writeWhitelistSuggestions prints observed roots the whitelist is missing
+// and whitelisted roots in the store which weren't used.
+func writeWhitelistSuggestions(w io.Writer, roots []observe.Root, certs []*x509.Certificate, wh whitelist.Whitelist) {
+	used := make(map[string]bool)
+	var add []*x509.Certificate
+	for i := range roots {
+		used[roots[i].Fingerprint] = true
+		if !wh.Matches(roots[i].Certificate) {
+			add = append(add, roots[i].Certificate)
+		}
+	}
+	var remove []*x509.Certificate
+	for i := range certs {
+		if wh.Matches(certs[i]) && !used[certutil.GetHexSHA256Fingerprint(*certs[i])] {
+			remove = append(remove, certs[i])
+		}
+	}
+
+	if len(add) > 0 {
+		fmt.Fprintln(w, "\nUsed but not whitelisted, consider adding:")
+		writeCertLines(w, add)
+	}
+	if len(remove) > 0 {
+		fmt.Fprintln(w, "\nWhitelisted but not used, consider removing:")
+		writeCertLines(w, remove)
+	}
+	if len(add) == 0 && len(remove) == 0 {
+		fmt.Fprintln(w, "\nThe whitelist matches the observed roots")
+	}
+}
+
+func writeCertLines(w io.Writer, certs []*x509.Certificate) {
+	for i := range certs {
+		fp := certutil.GetHexSHA256Fingerprint(*certs[i])
+		fmt.Fprintf(w, "  %s  %s\n", fp[:16], certutil.StringifyPKIXName(certs[i].Subject))
+	}
+}
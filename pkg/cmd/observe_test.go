@@ -0,0 +1,111 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/observe"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+func TestCmdObserve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-observe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// the store has an unused root, which the whitelist includes
+	lots, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs := []*x509.Certificate{srv.Certificate(), lots[0]}
+	wh := whitelist.FromCertificates(lots[:1])
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := observe.New(certs)
+	stop := make(chan struct{})
+	var buf bytes.Buffer
+	out := filepath.Join(dir, "observed.yaml")
+	errs := make(chan error, 1)
+	go func() {
+		errs <- observeUntil(&buf, ln, o, certs, &wh, out, stop)
+	}()
+
+	proxyURL, _ := url.Parse("http://" + ln.Addr().String())
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyURL(proxyURL),
+			TLSClientConfig: &tls.Config{
+				RootCAs: pool,
+			},
+		},
+	}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	for i := 0; i < 100 && len(o.Roots()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(stop)
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	output := buf.String()
+	fp := certutil.GetHexSHA256Fingerprint(*srv.Certificate())
+	if !strings.Contains(output, fp[:16]+" 1") || !strings.Contains(output, "127.0.0.1") {
+		t.Errorf("observed root missing:\n%s", output)
+	}
+	if !strings.Contains(output, "consider adding:\n  "+fp[:16]) {
+		t.Errorf("expected addition:\n%s", output)
+	}
+	if !strings.Contains(output, "consider removing:\n  "+certutil.GetHexSHA256Fingerprint(*lots[0])[:16]) {
+		t.Errorf("expected removal:\n%s", output)
+	}
+
+	written, err := whitelist.FromFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !written.Matches(srv.Certificate()) || written.Matches(lots[0]) {
+		t.Errorf("unexpected whitelist %#v", written)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/httputil"
+	"github.com/adamdecaf/cert-manage/pkg/pins"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+)
+
+var (
+	pinDialTimeout = 10 * time.Second
+)
+
+func PinsForApp(app, hostsPath, format, out string) error {
+	s, err := store.ForApp(app)
+	if err != nil {
+		return err
+	}
+	certs, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	err = warnPartial(err)
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	for i := range certs {
+		pool.AddCert(certs[i])
+	}
+	return generatePins(pool, hostsPath, format, out)
+}
+
+// PinsForPlatform verifies chains with the platform's roots, through Go's
+// crypto/x509 rather than listing the store.
+func PinsForPlatform(hostsPath, format, out string) error {
+	return generatePins(nil, hostsPath, format, out)
+}
+
+func generatePins(roots *x509.CertPool, hostsPath, format, out string) error {
+	hosts, err := readHostsFile(hostsPath)
+	if err != nil {
+		return err
+	}
+
+	var sets []pins.HostPins
+	for i := range hosts {
+		host, _, _ := net.SplitHostPort(hosts[i])
+		chain, err := verifiedChain(hosts[i], roots)
+		if err != nil {
+			return fmt.Errorf("unable to get chain for %s: %v", host, err)
+		}
+		sets = append(sets, pins.FromChain(host, chain))
+	}
+
+	var w io.Writer = os.Stdout
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return pins.Write(w, format, sets)
+}
+
+// readHosts reads a host:port on each line of r. Lines can be a hostname,
+// host:port or URL, and lines starting with # are ignored.
+func readHosts(r io.Reader) ([]string, error) {
+	var out []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.Contains(line, "://") {
+			u, err := url.Parse(line)
+			if err != nil {
+				return nil, fmt.Errorf("invalid host %q: %v", line, err)
+			}
+			line = u.Host
+		}
+		if _, _, err := net.SplitHostPort(line); err != nil {
+			line = net.JoinHostPort(line, "443")
+		}
+		out = append(out, line)
+	}
+	return out, scanner.Err()
+}
+
+// verifiedChain connects to addr and returns the first chain which verified,
+// leaf first and ending with the root.
+func verifiedChain(addr string, roots *x509.CertPool) ([]*x509.Certificate, error) {
+	if err := httputil.CheckOnline("connecting to " + addr); err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{
+		Timeout: pinDialTimeout,
+	}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{
+		RootCAs: roots,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	chains := conn.ConnectionState().VerifiedChains
+	if len(chains) == 0 {
+		return nil, fmt.Errorf("no verified chains")
+	}
+	return chains[0], nil
+}
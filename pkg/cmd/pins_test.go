@@ -0,0 +1,42 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCmdPins__readHosts(t *testing.T) {
+	in := `# comment
+example.com
+
+example.com:8443
+https://www.example.com/path
+`
+	hosts, err := readHosts(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"example.com:443", "example.com:8443", "www.example.com:443"}
+	if len(hosts) != len(expected) {
+		t.Fatalf("got %v", hosts)
+	}
+	for i := range expected {
+		if hosts[i] != expected[i] {
+			t.Errorf("got %q, expected %q", hosts[i], expected[i])
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+)
+
+// readPassword asks for the password of a PKCS#12 file, it's replaced in tests
+var readPassword = promptPassword
+
+func isPKCS12File(where string) bool {
+	ext := strings.ToLower(filepath.Ext(where))
+	return ext == ".p12" || ext == ".pfx"
+}
+
+// readPKCS12 returns the certificates of a PKCS#12 file. Files without a
+// password are read without prompting for one.
+func readPKCS12(where string, bs []byte) ([]*x509.Certificate, error) {
+	certs, err := certutil.DecodePKCS12Certificates(bs, "")
+	if err != certutil.ErrPKCS12Password {
+		return certs, err
+	}
+	pass, err := readPassword(fmt.Sprintf("Password for %s: ", filepath.Base(where)))
+	if err != nil {
+		return nil, err
+	}
+	certs, err = certutil.DecodePKCS12Certificates(bs, pass)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", where, err)
+	}
+	return certs, nil
+}
+
+// writePKCS12 writes certs to where as a PKCS#12 file, protected by the
+// password asked for (which can be empty).
+func writePKCS12(where string, certs []*x509.Certificate) error {
+	prompt := fmt.Sprintf("Password for %s (empty for none): ", filepath.Base(where))
+	pass, err := readPassword(prompt)
+	if err != nil {
+		return err
+	}
+	if pass != "" && isTerminal(os.Stdin) {
+		again, err := readPassword("Confirm password: ")
+		if err != nil {
+			return err
+		}
+		if again != pass {
+			return errors.New("passwords don't match")
+		}
+	}
+	bs, err := certutil.EncodePKCS12(certs, pass)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(where, bs, file.TempFilePermissions)
+}
+
+// promptPassword reads a line from stdin, without echoing it when stdin is a
+// terminal. Passwords can also be piped in for scripts.
+func promptPassword(prompt string) (string, error) {
+	if !isTerminal(os.Stdin) {
+		return readLine(os.Stdin)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	restore := disableEcho(os.Stdin)
+	pass, err := readLine(os.Stdin)
+	restore()
+	fmt.Fprintln(os.Stderr)
+	return pass, err
+}
+
+// readLine reads up to a newline one byte at a time, so nothing past the line
+// is consumed from r.
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("error reading password: %v", err)
+		}
+	}
+	return strings.TrimRight(string(line), "\r"), nil
+}
+
+func isTerminal(f *os.File) bool {
+	s, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return s.Mode()&os.ModeCharDevice != 0
+}
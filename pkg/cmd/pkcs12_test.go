@@ -0,0 +1,100 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+func TestCmdPKCS12__roundTrip(t *testing.T) {
+	defer func(f func(string) (string, error)) { readPassword = f }(readPassword)
+	prompts := 0
+	readPassword = func(prompt string) (string, error) {
+		if !strings.HasPrefix(prompt, "Confirm") { // only asked on terminals
+			prompts++
+		}
+		return "secret", nil
+	}
+
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "cert-manage-pkcs12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	where := filepath.Join(dir, "roots.P12")
+	if !isPKCS12File(where) || isPKCS12File(filepath.Join(dir, "roots.pem")) {
+		t.Fatal("unexpected isPKCS12File")
+	}
+	if err := writeExport(where, certs); err != nil {
+		t.Fatal(err)
+	}
+	bs, err := ioutil.ReadFile(where)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := readPKCS12(where, bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != len(certs) {
+		t.Errorf("got %d certificates", len(read))
+	}
+	if prompts != 2 {
+		t.Errorf("prompted %d times", prompts)
+	}
+
+	// no password, no prompt
+	bs, err = certutil.EncodePKCS12(certs, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readPKCS12(where, bs); err != nil || prompts != 2 {
+		t.Errorf("prompts=%d err=%v", prompts, err)
+	}
+
+	// wrong password
+	readPassword = func(string) (string, error) { return "wrong", nil }
+	if _, err := readPKCS12("cert.pfx", bs[:0]); err == nil {
+		t.Error("expected error")
+	}
+	bs, _ = ioutil.ReadFile("../../testdata/cert.pfx")
+	if _, err := readPKCS12("cert.pfx", bs); err == nil || !strings.Contains(err.Error(), "incorrect password") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCmdPKCS12__readLine(t *testing.T) {
+	r := strings.NewReader("pass\r\nnext\n")
+	if line, err := readLine(r); err != nil || line != "pass" {
+		t.Errorf("line=%q err=%v", line, err)
+	}
+	if line, err := readLine(r); err != nil || line != "next" {
+		t.Errorf("line=%q err=%v", line, err)
+	}
+	if line, err := readLine(r); err != nil || line != "" {
+		t.Errorf("line=%q err=%v", line, err)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
+)
+
+// PlistDiff prints the certificates whose trust settings differ between two
+// darwin trust settings exports, as a table or json
+func PlistDiff(a, b, format string) error {
+	before, err := ioutil.ReadFile(a)
+	if err != nil {
+		return err
+	}
+	after, err := ioutil.ReadFile(b)
+	if err != nil {
+		return err
+	}
+	changes, err := store.DiffTrustSettings(before, after)
+	if err != nil {
+		return fmt.Errorf("reading trust settings: %v", err)
+	}
+	if strings.EqualFold(format, "json") {
+		return writePlistDiffJSON(os.Stdout, changes)
+	}
+	return writePlistDiffTable(os.Stdout, changes)
+}
+
+type plistChange struct {
+	Change      string     `json:"change"`
+	Fingerprint string     `json:"sha1Fingerprint"`
+	Issuer      string     `json:"issuer"`
+	Serial      string     `json:"serial"`
+	Before      string     `json:"before,omitempty"`
+	After       string     `json:"after,omitempty"`
+	Modified    *time.Time `json:"modified,omitempty"`
+}
+
+func writePlistDiffJSON(w io.Writer, changes []store.TrustSettingsChange) error {
+	out := make([]plistChange, len(changes))
+	for i, c := range changes {
+		out[i] = plistChange{
+			Change:      c.Change,
+			Fingerprint: c.Fingerprint,
+			Issuer:      c.Issuer,
+			Serial:      c.Serial,
+			Before:      c.Before,
+			After:       c.After,
+		}
+		if !c.Modified.IsZero() {
+			out[i].Modified = &changes[i].Modified
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func writePlistDiffTable(w io.Writer, changes []store.TrustSettingsChange) error {
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "No trust settings changed")
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(tw, "Change\tIssuer\tSHA1 Fingerprint\tBefore\tAfter\tModified")
+	for _, c := range changes {
+		fp := c.Fingerprint
+		if len(fp) > 16 {
+			fp = fp[:16]
+		}
+		modified := "-"
+		if !c.Modified.IsZero() {
+			modified = timeutil.Date(c.Modified)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", c.Change, orDash(c.Issuer), fp, orDash(c.Before), orDash(c.After), modified)
+	}
+	return tw.Flush()
+}
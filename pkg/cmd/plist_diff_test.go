@@ -0,0 +1,45 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/store"
+)
+
+func TestPlistDiff__table(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writePlistDiffTable(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "No trust settings changed") {
+		t.Errorf("got %q", buf.String())
+	}
+
+	buf.Reset()
+	changes := []store.TrustSettingsChange{
+		{Fingerprint: "0D445C165344C1827E1D20AB25F40163D8BE79A5", Issuer: "Test Root", Change: "removed", Before: "sslServer: Never Trust"},
+	}
+	if err := writePlistDiffTable(&buf, changes); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], "0D445C165344C182 sslServer: Never Trust -") {
+		t.Errorf("got\n%s", buf.String())
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+)
+
+// NewProfile returns a Profile writing pprof data into the directory
+// where, which is created if needed. Nothing is profiled if where is empty.
+func NewProfile(where string) (*Profile, error) {
+	if where == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(where, 0700); err != nil {
+		return nil, fmt.Errorf("error creating profile dir, err=%v", err)
+	}
+	fd, err := os.Create(filepath.Join(where, "cpu.pprof"))
+	if err != nil {
+		return nil, fmt.Errorf("error creating cpu profile, err=%v", err)
+	}
+	return &Profile{
+		dir: where,
+		cpu: fd,
+	}, nil
+}
+
+// Profile records a CPU profile while cert-manage runs and the heap once
+// it's finished, for reports of slow or memory hungry runs. They're read
+// with 'go tool pprof'.
+type Profile struct {
+	dir string
+	cpu *os.File
+}
+
+func (p *Profile) Start() error {
+	if p == nil {
+		return nil
+	}
+	return pprof.StartCPUProfile(p.cpu)
+}
+
+// Stop finishes the CPU profile and writes heap.pprof
+func (p *Profile) Stop() error {
+	if p == nil {
+		return nil
+	}
+	pprof.StopCPUProfile()
+	if err := p.cpu.Close(); err != nil {
+		return err
+	}
+
+	fd, err := os.Create(filepath.Join(p.dir, "heap.pprof"))
+	if err != nil {
+		return fmt.Errorf("error creating heap profile, err=%v", err)
+	}
+	runtime.GC() // up to date statistics
+	if err := pprof.WriteHeapProfile(fd); err != nil {
+		fd.Close()
+		return err
+	}
+	if debug {
+		fmt.Printf("cmd: wrote cpu.pprof and heap.pprof to %s\n", p.dir)
+	}
+	return fd.Close()
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/events"
+	"github.com/adamdecaf/cert-manage/pkg/metrics"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+func PruneForApp(app string, before time.Time) error {
+	s, err := store.ForApp(app)
+	if err != nil {
+		return err
+	}
+	return prune(s, app, before)
+}
+
+func PruneForPlatform(before time.Time) error {
+	return prune(store.Platform(), runtime.GOOS, before)
+}
+
+// prune removes trust from each certificate which expired before `before`,
+// a backup is taken first.
+func prune(s store.Store, name string, before time.Time) error {
+	certs, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	if err != nil {
+		return err
+	}
+	expired, kept := expiredCertificates(certs, before)
+	if len(expired) == 0 {
+		fmt.Printf("No certificates expired before %s\n", timeutil.Date(before))
+		return nil
+	}
+
+	if err := s.Backup(); err != nil {
+		return fmt.Errorf("error taking %s backup before pruning: %v", name, err)
+	}
+
+	for i := range expired {
+		fmt.Printf("Removing %s (%s), expired %s\n", expired[i].Subject.CommonName, certutil.GetHexSHA256Fingerprint(*expired[i])[:16], timeutil.Date(expired[i].NotAfter))
+	}
+	if err := s.Remove(whitelist.FromCertificates(kept)); err != nil {
+		return err
+	}
+
+	if !store.DryRun() {
+		metrics.Add(metrics.CertificatesRemoved, len(expired))
+		events.EmitEach(events.Removed, name, "expired", expired)
+	}
+	fmt.Printf("Pruned %d expired certificates\n", len(expired))
+	return nil
+}
+
+// expiredCertificates splits certs into those which expired before `before` and the rest
+func expiredCertificates(certs []*x509.Certificate, before time.Time) (expired, kept []*x509.Certificate) {
+	for i := range certs {
+		if certs[i].NotAfter.Before(before) {
+			expired = append(expired, certs[i])
+		} else {
+			kept = append(kept, certs[i])
+		}
+	}
+	return expired, kept
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+)
+
+func TestCmdPrune__expiredCertificates(t *testing.T) {
+	t.Parallel()
+
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing expired before the first cert was valid
+	expired, kept := expiredCertificates(certs, time.Date(1990, time.January, 1, 0, 0, 0, 0, time.UTC))
+	if len(expired) != 0 || len(kept) != len(certs) {
+		t.Errorf("got %d expired and %d kept", len(expired), len(kept))
+	}
+
+	// everything has expired after the latest NotAfter
+	var latest time.Time
+	for i := range certs {
+		if certs[i].NotAfter.After(latest) {
+			latest = certs[i].NotAfter
+		}
+	}
+	expired, kept = expiredCertificates(certs, latest.Add(time.Second))
+	if len(expired) != len(certs) || len(kept) != 0 {
+		t.Errorf("got %d expired and %d kept", len(expired), len(kept))
+	}
+
+	// split on a certificate's expiry
+	expired, kept = expiredCertificates(certs, certs[0].NotAfter)
+	if len(expired)+len(kept) != len(certs) {
+		t.Errorf("got %d expired and %d kept from %d", len(expired), len(kept), len(certs))
+	}
+	for i := range expired {
+		if !expired[i].NotAfter.Before(certs[0].NotAfter) {
+			t.Errorf("%s isn't expired", expired[i].Subject)
+		}
+	}
+}
+
+func TestCmdPrune(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := store.MemoryStore(certs)
+
+	before := certs[0].NotAfter
+	expired, kept := expiredCertificates(certs, before)
+	if err := prune(s, "memory", before); err != nil {
+		t.Fatal(err)
+	}
+
+	found, _ := s.List(nil)
+	if len(found) != len(kept) {
+		t.Errorf("got %d certs, expected %d", len(found), len(kept))
+	}
+	if len(expired) > 0 {
+		if latest, _ := s.GetLatestBackup(); latest == "" {
+			t.Error("expected a backup before pruning")
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+// stdinPath is given instead of a file to read certificates from stdin, so
+// cert-manage can be used in pipelines (e.g. after openssl s_client)
+const stdinPath = "-"
+
+// stdin is read for stdinPath, it's replaced in tests
+var stdin io.Reader = os.Stdin
+
+// readCertificates decodes the certificates (PEM, DER, NSS certdata or
+// PKCS#12) of a file, or stdin for stdinPath.
+func readCertificates(where string) ([]*x509.Certificate, error) {
+	var bs []byte
+	var err error
+	if where == stdinPath {
+		where = "stdin"
+		bs, err = ioutil.ReadAll(io.LimitReader(stdin, maxDownloadSize))
+	} else {
+		bs, err = ioutil.ReadFile(where)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if isPKCS12File(where) {
+		return readPKCS12(where, bs)
+	}
+	certs, err := certutil.Decode(bs)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in %s", where)
+	}
+	return certs, nil
+}
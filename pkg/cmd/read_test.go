@@ -0,0 +1,91 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+func TestCmdRead__stdin(t *testing.T) {
+	defer func(r io.Reader) { stdin = r }(stdin)
+
+	pem, err := ioutil.ReadFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := certutil.ParsePEM(pem)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// openssl s_client prints other text around the chain
+	stdin = strings.NewReader("CONNECTED(00000003)\n---\nCertificate chain\n" + string(pem) + "---\nServer certificate\n")
+	read, err := readCertificates(stdinPath)
+	if err != nil || len(read) != len(certs) {
+		t.Errorf("got %d certificates, err=%v", len(read), err)
+	}
+
+	// DER
+	var der []byte
+	for i := range certs {
+		der = append(der, certs[i].Raw...)
+	}
+	stdin = bytes.NewReader(der)
+	read, err = readCertificates(stdinPath)
+	if err != nil || len(read) != len(certs) {
+		t.Errorf("got %d certificates, err=%v", len(read), err)
+	}
+
+	stdin = strings.NewReader("nothing here")
+	if _, err := readCertificates(stdinPath); err == nil || !strings.Contains(err.Error(), "stdin") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCmdRead__genWhitelistFromStdin(t *testing.T) {
+	defer func(r io.Reader) { stdin = r }(stdin)
+
+	dir, err := ioutil.TempDir("", "cert-manage-stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pem, err := ioutil.ReadFile("../../testdata/example.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin = bytes.NewReader(pem)
+	output := filepath.Join(dir, "whitelist.yaml")
+	if err := GenerateWhitelistFromStdin(output); err != nil {
+		t.Fatal(err)
+	}
+	wh, err := whitelist.FromFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wh.Fingerprints) != 1 || wh.Fingerprints[0] != "05a6db389391df92e0be93fdfa4db1e3cf53903918b8d9d85a9c396cb55df030" {
+		t.Errorf("got %v", wh.Fingerprints)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
+)
+
+var (
+	// packageLogs are searched for updates which could have reinstalled
+	// certificates, missing logs are skipped.
+	packageLogs = []string{
+		"/var/log/dpkg.log",    // Debian/Ubuntu
+		"/var/log/dnf.rpm.log", // Fedora/RHEL
+		"/var/log/install.log", // macOS
+	}
+
+	// packageNames are matched (case-insensitive) against package log lines
+	packageNames = []string{"ca-certificates", "ca_root_nss", "nss", "openjdk", "firefox", "security update"}
+
+	// packageLogTimeLayouts are how the logs above start each line
+	packageLogTimeLayouts = []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05"}
+)
+
+func ReconcileForApp(app string) error {
+	s, err := store.ForApp(app)
+	if err != nil {
+		return err
+	}
+	return reconcile(s, app)
+}
+
+func ReconcileForPlatform() error {
+	return reconcile(store.Platform(), runtime.GOOS)
+}
+
+// reconcile applies the last whitelist applied to s again if certificates it
+// removed have come back, e.g. from an OS or package update, or certificates
+// it kept are no longer allowed, e.g. once their entry expires. It reports which
+// came back alongside package updates since the whitelist was applied.
+func reconcile(s store.Store, name string) error {
+	st, err := store.GetState(name)
+	if err != nil {
+		return err
+	}
+	if st == nil || st.Rules == nil {
+		return fmt.Errorf("no whitelist applied to %s has been recorded, run whitelist first", name)
+	}
+
+	certs, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	if err = warnPartial(err); err != nil {
+		return err
+	}
+	back, gone := reinstated(certs, st), lapsed(certs, st)
+	if len(back) == 0 && len(gone) == 0 {
+		fmt.Printf("No removed certificates have come back to %s since %s\n", name, timeutil.Time(st.Applied))
+		return nil
+	}
+
+	if len(back) > 0 {
+		fmt.Printf("%d certificate(s) came back to %s since the whitelist was applied at %s\n", len(back), name, timeutil.Time(st.Applied))
+		for i := range back {
+			fmt.Printf("  %s (%s)\n", certutil.StringifyPKIXName(back[i].Subject), certutil.GetHexSHA256Fingerprint(*back[i])[:16])
+		}
+	}
+	if len(gone) > 0 {
+		fmt.Printf("%d certificate(s) in %s are no longer whitelisted, e.g. their entry expired\n", len(gone), name)
+		for i := range gone {
+			fmt.Printf("  %s (%s)\n", certutil.StringifyPKIXName(gone[i].Subject), certutil.GetHexSHA256Fingerprint(*gone[i])[:16])
+		}
+	}
+	if updates := packageUpdates(packageLogs, st.Applied); len(updates) > 0 {
+		fmt.Println("Package updates since then:")
+		for i := range updates {
+			fmt.Printf("  %s\n", updates[i])
+		}
+	}
+
+	// take a fresh backup so restore doesn't bring back the old state
+	if err := s.Backup(); err != nil {
+		return fmt.Errorf("error taking %s backup before reconciling: %v", name, err)
+	}
+	return applyWhitelist(s, name, *st.Rules, WhitelistOptions{Force: true, Cascade: st.Cascade})
+}
+
+// reinstated returns the certificates which weren't trusted after st was
+// applied and which its whitelist doesn't allow.
+func reinstated(certs []*x509.Certificate, st *store.State) []*x509.Certificate {
+	applied := make(map[string]bool, len(st.Fingerprints))
+	for i := range st.Fingerprints {
+		applied[st.Fingerprints[i]] = true
+	}
+
+	var out []*x509.Certificate
+	for i := range certs {
+		if applied[certutil.GetHexSHA256Fingerprint(*certs[i])] {
+			continue
+		}
+		if st.Rules != nil && st.Rules.Matches(certs[i]) {
+			continue // new, but allowed
+		}
+		out = append(out, certs[i])
+	}
+	return out
+}
+
+// lapsed returns the certificates which were trusted after st was applied but
+// which its whitelist no longer allows, e.g. because their entry has expired.
+func lapsed(certs []*x509.Certificate, st *store.State) []*x509.Certificate {
+	applied := make(map[string]bool, len(st.Fingerprints))
+	for i := range st.Fingerprints {
+		applied[st.Fingerprints[i]] = true
+	}
+
+	var out []*x509.Certificate
+	for i := range certs {
+		if !applied[certutil.GetHexSHA256Fingerprint(*certs[i])] {
+			continue // see reinstated
+		}
+		if st.Rules != nil && !st.Rules.Matches(certs[i]) {
+			out = append(out, certs[i])
+		}
+	}
+	return out
+}
+
+// packageUpdates returns lines from package manager logs, logged after
+// since, mentioning a package which ships certificates.
+func packageUpdates(logs []string, since time.Time) []string {
+	var out []string
+	for i := range logs {
+		fd, err := os.Open(logs[i])
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(fd)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			when, ok := packageLogTime(line)
+			if !ok || when.Before(since) || !mentionsPackage(line) {
+				continue
+			}
+			out = append(out, line)
+		}
+		fd.Close()
+	}
+	sort.Strings(out)
+	return out
+}
+
+func packageLogTime(line string) (time.Time, bool) {
+	for i := range packageLogTimeLayouts {
+		n := len(packageLogTimeLayouts[i])
+		if len(line) < n {
+			continue
+		}
+		if t, err := time.ParseInLocation(packageLogTimeLayouts[i], line[:n], time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func mentionsPackage(line string) bool {
+	line = strings.ToLower(line)
+	for i := range packageNames {
+		if strings.Contains(line, packageNames[i]) {
+			return true
+		}
+	}
+	return false
+}
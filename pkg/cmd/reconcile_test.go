@@ -0,0 +1,136 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+func TestCmdReconcile__reinstated(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only certs[0] was left, certs[1] is allowed by the whitelist
+	wh := whitelist.FromCertificates(certs[:2])
+	st := &store.State{
+		Fingerprints: store.Fingerprints(certs[:1]),
+		Rules:        &wh,
+	}
+	back := reinstated(certs, st)
+	if len(back) != len(certs)-2 {
+		t.Fatalf("got %d", len(back))
+	}
+	if back[0] != certs[2] {
+		t.Errorf("got %s", back[0].Subject.CommonName)
+	}
+	if v := reinstated(certs[:1], st); len(v) != 0 {
+		t.Errorf("got %d", len(v))
+	}
+}
+
+func TestCmdReconcile__lapsed(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// certs[1] was kept by an entry which has since expired
+	wh := whitelist.FromCertificates(certs[:1])
+	wh.Entries = []whitelist.Entry{{
+		Fingerprints: []string{certutil.GetHexSHA256Fingerprint(*certs[1])},
+		Expires:      "2001-01-01",
+	}}
+	st := &store.State{
+		Fingerprints: store.Fingerprints(certs[:2]),
+		Rules:        &wh,
+		Applied:      time.Date(2000, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+	gone := lapsed(certs[:2], st)
+	if len(gone) != 1 || gone[0] != certs[1] {
+		t.Fatalf("got %d", len(gone))
+	}
+	if v := reinstated(certs[:2], st); len(v) != 0 {
+		t.Errorf("got %d", len(v))
+	}
+
+	// applying the same whitelist again isn't a no-op once the entry expires
+	st.Whitelist = wh.Hash()
+	st.Certificates = store.HashCertificates(certs[:2])
+	if stateCurrent(st, certs[:2], wh, false, time.Now()) {
+		t.Error("expected expired entry to make the state stale")
+	}
+
+	// entries which expired before the whitelist was applied are already gone
+	applied := &store.State{
+		Whitelist:    wh.Hash(),
+		Certificates: store.HashCertificates(certs[:1]),
+		Applied:      time.Date(2002, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if !stateCurrent(applied, certs[:1], wh, false, time.Now()) {
+		t.Error("expected state to be current")
+	}
+
+	// still current before the entry expires
+	wh.Entries[0].Expires = "2999-12-31"
+	st.Whitelist = wh.Hash()
+	if !stateCurrent(st, certs[:2], wh, false, time.Now()) {
+		t.Error("expected state to be current")
+	}
+	if stateCurrent(st, certs[:2], wh, true, time.Now()) {
+		t.Error("expected -cascade to make the state stale")
+	}
+}
+
+func TestCmdReconcile__packageUpdates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-reconcile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dpkg := filepath.Join(dir, "dpkg.log")
+	err = ioutil.WriteFile(dpkg, []byte(`2018-03-01 10:11:12 upgrade ca-certificates:all 20170717 20180409
+2018-04-02 09:00:00 upgrade ca-certificates:all 20180409 20190110
+2018-04-02 09:00:01 upgrade vim:amd64 2:8.0 2:8.1
+not a log line
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dnf := filepath.Join(dir, "dnf.rpm.log")
+	err = ioutil.WriteFile(dnf, []byte("2018-04-03T08:00:00Z SUBDEBUG Upgrade: nss-3.36.0-1.fc27.x86_64\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	since := time.Date(2018, time.April, 1, 0, 0, 0, 0, time.Local)
+	updates := packageUpdates([]string{dpkg, dnf, filepath.Join(dir, "missing.log")}, since)
+	if len(updates) != 2 {
+		t.Fatalf("got %v", updates)
+	}
+	if updates[0] != "2018-04-02 09:00:00 upgrade ca-certificates:all 20180409 20190110" {
+		t.Errorf("got %s", updates[0])
+	}
+}
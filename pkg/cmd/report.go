@@ -0,0 +1,100 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/ui"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+// Report writes an HTML report of the platform and every app store found to
+// `out`. If a whitelist or profile is given each store is checked against it.
+func Report(out, whpath, profile string) error {
+	r := ui.Report{
+		Generated:      time.Now(),
+		ExpiringWithin: auditExpiringWithin,
+	}
+	r.Hostname, _ = os.Hostname()
+
+	var wh *whitelist.Whitelist
+	if whpath != "" || profile != "" {
+		w, err := loadWhitelist(whpath, profile)
+		if err != nil {
+			return err
+		}
+		wh = &w
+		r.Whitelist = whpath
+		if profile != "" {
+			r.Whitelist = "profile " + profile
+		}
+	}
+
+	r.Stores = append(r.Stores, reportStore(runtime.GOOS, store.Platform(), wh))
+	apps := append(store.GetApps(), store.GetSandboxedApps()...)
+	for i := range apps {
+		s, err := store.ForApp(apps[i])
+		if err != nil {
+			continue
+		}
+		// apps which aren't installed fail to list or have no certificates
+		rs := reportStore(apps[i], s, wh)
+		if rs.Err != nil || len(rs.Certificates) == 0 {
+			continue
+		}
+		r.Stores = append(r.Stores, rs)
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := ui.WriteReport(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote report of %d stores to %s\n", len(r.Stores), out)
+	return nil
+}
+
+func reportStore(name string, s store.Store, wh *whitelist.Whitelist) ui.ReportStore {
+	rs := ui.ReportStore{
+		Name: name,
+	}
+	certs, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	rs.Err = warnPartial(err)
+	if rs.Err != nil {
+		return rs
+	}
+	rs.Certificates = certs
+	if wh != nil {
+		for i := range certs {
+			if !wh.Matches(certs[i]) {
+				rs.NonCompliant = append(rs.NonCompliant, certs[i])
+			}
+		}
+	}
+	return rs
+}
@@ -15,27 +15,247 @@
 package cmd
 
 import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
 	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
 )
 
-func RestoreForApp(app, path string) error {
+// RestoreOptions changes what's shown before restoring
+type RestoreOptions struct {
+	// Diff prints the certificates restoring would add and remove
+	Diff bool
+
+	// Format of the diff, "json" or a table otherwise
+	Format string
+
+	// Yes restores without showing a summary and asking to continue
+	Yes bool
+
+	// Adapt restores an archive taken as another user, or on another
+	// machine, into the current user's keychains (darwin)
+	Adapt bool
+}
+
+// errRestoreCancelled is returned when a restore isn't confirmed
+var errRestoreCancelled = errors.New("restore cancelled, pass -y to restore without confirming")
+
+func RestoreForApp(app, path string, opts RestoreOptions) error {
+	if isGPG(app) {
+		return restoreGPG(path, opts)
+	}
+	if isSSH(app) {
+		return restoreSSH(path, opts)
+	}
 	s, err := store.ForApp(app)
 	if err != nil {
 		return err
 	}
-	err = s.Restore(path)
-	if err == nil {
+	return restore(s, path, opts)
+}
+
+func RestoreForPlatform(path string, opts RestoreOptions) error {
+	return restore(store.Platform(), path, opts)
+}
+
+func restore(s store.Store, path string, opts RestoreOptions) error {
+	if opts.Diff {
+		if err := restoreDiff(os.Stdout, s, path, opts.Format); err != nil {
+			return err
+		}
+	}
+	if !opts.Yes && !store.DryRun() {
+		added, removed, err := backupChanges(s, path)
+		if err != nil {
+			return err
+		}
+		if err := confirmRestore(os.Stdin, os.Stderr, restoreSummary(backupPath(s, path), "certificate", len(added), len(removed))); err != nil {
+			return err
+		}
+	}
+	err := s.Restore(path)
+	// keep stdout parsable when the diff is json
+	if err == nil && !(opts.Diff && strings.EqualFold(opts.Format, "json")) {
 		fmt.Println("Restore completed successfully")
 	}
 	return err
 }
 
-func RestoreForPlatform(path string) error {
-	err := store.Platform().Restore(path)
-	if err == nil {
-		fmt.Println("Restore completed successfully")
+// backupPath returns `path`, or the latest backup of s if it's empty
+func backupPath(s store.Store, path string) string {
+	if path == "" {
+		path, _ = s.GetLatestBackup()
 	}
-	return err
+	return path
+}
+
+// restoreSummary describes restoring from `where`, which trusts `added`
+// certificates (or keys) again and removes trust from `removed` ones.
+func restoreSummary(where, noun string, added, removed int) []string {
+	var lines []string
+	if where != "" {
+		line := "Restoring from " + where
+		if taken := backupTime(where); !taken.IsZero() {
+			days := int(time.Since(taken).Hours() / 24)
+			line += fmt.Sprintf(", taken %s (%d days ago)", timeutil.Date(taken), days)
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines,
+		fmt.Sprintf("  %d %s(s) will be trusted again", added, noun),
+		fmt.Sprintf("  %d currently trusted %s(s) will lose trust", removed, noun),
+	)
+	return lines
+}
+
+// backupTime returns when a backup was taken, from its stamp or otherwise
+// its modification time
+func backupTime(where string) time.Time {
+	if st, err := store.GetBackupStamp(where); err == nil && st != nil && !st.Created.IsZero() {
+		return st.Created
+	}
+	if fi, err := os.Stat(where); err == nil {
+		return fi.ModTime()
+	}
+	return time.Time{}
+}
+
+// confirmRestore prints the summary and reads an answer from in, only "y"
+// or "yes" continue. Answers can be piped in when in isn't a terminal.
+func confirmRestore(in io.Reader, out io.Writer, summary []string) error {
+	for i := range summary {
+		fmt.Fprintln(out, summary[i])
+	}
+	fmt.Fprint(out, "Continue? [y/N] ")
+	answer, err := readLine(in)
+	if f, ok := in.(*os.File); ok && !isTerminal(f) {
+		fmt.Fprintln(out)
+	}
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return errRestoreCancelled
+}
+
+// restoreDiff writes the changes restoring from `path` would make
+func restoreDiff(w io.Writer, s store.Store, path, format string) error {
+	added, removed, err := backupChanges(s, path)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(format, "json") {
+		return writeDiffJSON(w, added, removed)
+	}
+	return writeDiffTable(w, added, removed)
+}
+
+// backupChanges returns the certificates restoring from `path` would add and remove
+func backupChanges(s store.Store, path string) (added, removed []*x509.Certificate, err error) {
+	backup, err := store.ListBackup(s, path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read backup: %v", err)
+	}
+	current, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	err = warnPartial(err)
+	if err != nil {
+		return nil, nil, err
+	}
+	added, removed = diffCertificates(current, backup)
+	return added, removed, nil
+}
+
+// diffCertificates returns the certificates in `to` which aren't in `from`
+// (added) and those in `from` which aren't in `to` (removed).
+func diffCertificates(from, to []*x509.Certificate) (added, removed []*x509.Certificate) {
+	fromFps := make(map[string]bool)
+	for i := range from {
+		fromFps[certutil.GetHexSHA256Fingerprint(*from[i])] = true
+	}
+	toFps := make(map[string]bool)
+	for i := range to {
+		fp := certutil.GetHexSHA256Fingerprint(*to[i])
+		toFps[fp] = true
+		if !fromFps[fp] {
+			added = append(added, to[i])
+		}
+	}
+	for i := range from {
+		if !toFps[certutil.GetHexSHA256Fingerprint(*from[i])] {
+			removed = append(removed, from[i])
+		}
+	}
+	certutil.Sort(added)
+	certutil.Sort(removed)
+	return added, removed
+}
+
+type diffCertificate struct {
+	Subject     string    `json:"subject"`
+	Fingerprint string    `json:"fingerprint"`
+	NotAfter    time.Time `json:"notAfter"`
+}
+
+func toDiffCertificates(certs []*x509.Certificate) []diffCertificate {
+	out := make([]diffCertificate, len(certs))
+	for i := range certs {
+		out[i] = diffCertificate{
+			Subject:     certutil.StringifyPKIXName(certs[i].Subject),
+			Fingerprint: certutil.GetHexSHA256Fingerprint(*certs[i]),
+			NotAfter:    certs[i].NotAfter,
+		}
+	}
+	return out
+}
+
+type diffJSON struct {
+	Added   []diffCertificate `json:"added"`
+	Removed []diffCertificate `json:"removed"`
+}
+
+func newDiffJSON(added, removed []*x509.Certificate) diffJSON {
+	return diffJSON{
+		Added:   toDiffCertificates(added),
+		Removed: toDiffCertificates(removed),
+	}
+}
+
+func writeDiffJSON(w io.Writer, added, removed []*x509.Certificate) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(newDiffJSON(added, removed))
+}
+
+func writeDiffTable(w io.Writer, added, removed []*x509.Certificate) error {
+	if len(added) == 0 && len(removed) == 0 {
+		fmt.Fprintln(w, "Restore doesn't change any certificates")
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(tw, "Change\tSubject\tSHA256 Fingerprint\tNot After")
+	for _, d := range []struct {
+		change string
+		certs  []*x509.Certificate
+	}{{"added", added}, {"removed", removed}} {
+		for i := range d.certs {
+			c := d.certs[i]
+			fp := certutil.GetHexSHA256Fingerprint(*c)
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", d.change, certutil.StringifyPKIXName(c.Subject), fp[:16], timeutil.Date(c.NotAfter))
+		}
+	}
+	return tw.Flush()
 }
@@ -0,0 +1,106 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+func TestCmdRestore__diff(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// restoring certs[1:] over certs[:3]
+	added, removed := diffCertificates(certs[:3], certs[1:])
+	if len(added) != len(certs)-3 || len(removed) != 1 {
+		t.Fatalf("added=%d removed=%d", len(added), len(removed))
+	}
+	if removed[0] != certs[0] {
+		t.Errorf("removed %s", removed[0].Subject)
+	}
+
+	var buf bytes.Buffer
+	if err := writeDiffJSON(&buf, added, removed); err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Added   []diffCertificate `json:"added"`
+		Removed []diffCertificate `json:"removed"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Added) != len(added) || len(out.Removed) != 1 {
+		t.Errorf("got %#v", out)
+	}
+	if out.Removed[0].Fingerprint != certutil.GetHexSHA256Fingerprint(*certs[0]) {
+		t.Errorf("got %q", out.Removed[0].Fingerprint)
+	}
+
+	buf.Reset()
+	if err := writeDiffTable(&buf, added, removed); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != len(certs)-1 {
+		t.Errorf("got %d lines: %q", n, buf.String())
+	}
+
+	// no changes
+	added, removed = diffCertificates(certs, certs)
+	if len(added) != 0 || len(removed) != 0 {
+		t.Errorf("added=%d removed=%d", len(added), len(removed))
+	}
+}
+
+func TestCmdRestore__confirm(t *testing.T) {
+	summary := restoreSummary("", "certificate", 12, 3)
+	if len(summary) != 2 || !strings.Contains(summary[0], "12 certificate(s) will be trusted again") || !strings.Contains(summary[1], "3 currently trusted") {
+		t.Errorf("got %q", summary)
+	}
+
+	cases := map[string]error{
+		"y\n":   nil,
+		"YES\n": nil,
+		"n\n":   errRestoreCancelled,
+		"\n":    errRestoreCancelled,
+		"":      errRestoreCancelled,
+	}
+	for answer, expected := range cases {
+		var out bytes.Buffer
+		if err := confirmRestore(strings.NewReader(answer), &out, summary); err != expected {
+			t.Errorf("%q: got %v", answer, err)
+		}
+		if !strings.Contains(out.String(), "12 certificate(s)") || !strings.Contains(out.String(), "Continue? [y/N]") {
+			t.Errorf("%q: got %q", answer, out.String())
+		}
+	}
+}
+
+func TestCmdRestore__backupAge(t *testing.T) {
+	summary := restoreSummary("../../testdata/lots.crt", "key", 1, 0)
+	if len(summary) != 3 || !strings.HasPrefix(summary[0], "Restoring from ../../testdata/lots.crt, taken ") || !strings.Contains(summary[0], "days ago)") {
+		t.Errorf("got %q", summary)
+	}
+	if !strings.Contains(summary[1], "1 key(s)") {
+		t.Errorf("got %q", summary[1])
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/agent"
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
+	"github.com/adamdecaf/cert-manage/pkg/policyserver"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+)
+
+// readHeaderTimeout limits how long clients can take sending a request's
+// headers, so slow clients can't hold connections open
+const readHeaderTimeout = 10 * time.Second
+
+// ServerOptions configures 'server'
+type ServerOptions struct {
+	// Dir holds the group whitelists, agents and CA, defaults to server/ in
+	// cert-manage's state directory
+	Dir string
+
+	// Listen is the address agents connect to, Dashboard is where the
+	// dashboard is served (over plain HTTP, so keep it local or behind a
+	// proxy) and disabled when empty
+	Listen    string
+	Dashboard string
+
+	// Token is the secret agents enroll with
+	Token string
+
+	// Hostnames are included in the certificate the server issues itself,
+	// unless Cert and Key (PEM files) are given to serve instead
+	Hostnames []string
+	Cert      string
+	Key       string
+
+	// Interval is how often agents are asked to check in
+	Interval time.Duration
+}
+
+// Server runs a policy server for cert-manage agents until cert-manage is
+// interrupted, see package policyserver.
+func Server(opts ServerOptions) error {
+	dir := opts.Dir
+	if dir == "" {
+		parent, err := store.StateDir()
+		if err != nil {
+			return err
+		}
+		dir = filepath.Join(parent, "server")
+	}
+	s, err := policyserver.Open(dir, opts.Token)
+	if err != nil {
+		return err
+	}
+	if opts.Interval > 0 {
+		s.Interval = opts.Interval
+	}
+	cert, err := serverCertificate(s, opts)
+	if err != nil {
+		return err
+	}
+	groups, err := s.Groups()
+	if err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		fmt.Printf("No groups yet, add whitelists as %s\n", filepath.Join(dir, "groups", "<group>.yaml"))
+	}
+
+	ln, err := net.Listen("tcp", opts.Listen)
+	if err != nil {
+		return err
+	}
+	agents := &http.Server{
+		Handler:           agent.NewHandler(s),
+		TLSConfig:         agent.ServerTLSConfig(cert, s.CA()),
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+	errs := make(chan error, 2)
+	go func() { errs <- agents.Serve(tls.NewListener(ln, agents.TLSConfig)) }()
+	fmt.Printf("Serving agents on %s (groups: %s)\n", ln.Addr(), strings.Join(groups, ", "))
+	if opts.Cert == "" {
+		fmt.Printf("Agents enroll with -server-ca %s\n", s.CACertificate())
+	}
+
+	var dashboard *http.Server
+	if opts.Dashboard != "" {
+		dln, err := net.Listen("tcp", opts.Dashboard)
+		if err != nil {
+			agents.Close()
+			return err
+		}
+		dashboard = &http.Server{
+			Handler:           s.Dashboard(),
+			ReadHeaderTimeout: readHeaderTimeout,
+		}
+		go func() { errs <- dashboard.Serve(dln) }()
+		fmt.Printf("Dashboard on http://%s/\n", dln.Addr())
+	}
+
+	select {
+	case <-interrupt.Context().Done():
+		err = nil
+	case err = <-errs:
+	}
+	agents.Close()
+	if dashboard != nil {
+		dashboard.Close()
+	}
+	return err
+}
+
+// serverCertificate returns the certificate agents are served with
+func serverCertificate(s *policyserver.Server, opts ServerOptions) (tls.Certificate, error) {
+	if opts.Cert != "" || opts.Key != "" {
+		if opts.Cert == "" || opts.Key == "" {
+			return tls.Certificate{}, errors.New("both a certificate and key are needed")
+		}
+		return tls.LoadX509KeyPair(opts.Cert, opts.Key)
+	}
+	hosts := opts.Hostnames
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1"}
+		if hostname, _ := os.Hostname(); hostname != "" {
+			hosts = append([]string{hostname}, hosts...)
+		}
+	}
+	return s.ServerCertificate(hosts)
+}
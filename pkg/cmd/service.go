@@ -0,0 +1,139 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	// serviceSchedules maps -schedule to schtasks' /SC values
+	serviceSchedules = map[string]string{
+		"hourly": "HOURLY",
+		"daily":  "DAILY",
+		"weekly": "WEEKLY",
+	}
+)
+
+// ServiceOptions configures the scheduled task created by InstallService
+type ServiceOptions struct {
+	// Name of the task, "cert-manage" by default
+	Name string
+
+	// Schedule is how often the task runs: hourly, daily or weekly
+	Schedule string
+
+	// Log is where the output of each run is appended
+	Log string
+
+	// Remove deletes the task instead
+	Remove bool
+}
+
+// InstallService creates a scheduled task which runs `cert-manage <args>`
+// periodically, e.g. to audit or re-apply a whitelist. Only windows is
+// supported.
+func InstallService(args []string, opts ServiceOptions) error {
+	if opts.Name == "" {
+		opts.Name = "cert-manage"
+	}
+	if opts.Remove {
+		return removeService(opts.Name)
+	}
+	if len(args) == 0 {
+		return errors.New("no command given to run")
+	}
+	if _, ok := serviceSchedules[opts.Schedule]; !ok {
+		return fmt.Errorf("unknown schedule %q, options: %s", opts.Schedule, strings.Join(scheduleNames(), ", "))
+	}
+	args, err := absFileArgs(args)
+	if err != nil {
+		return err
+	}
+	return installService(args, opts)
+}
+
+func scheduleNames() []string {
+	var out []string
+	for k := range serviceSchedules {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// absFileArgs makes the local files in args (e.g. -file wl.json) absolute,
+// as scheduled tasks don't run from the current directory.
+func absFileArgs(args []string) ([]string, error) {
+	out := make([]string, len(args))
+	for i := range args {
+		out[i] = args[i]
+		if i == 0 {
+			continue // sub-command
+		}
+		prefix, value := "", args[i]
+		if strings.HasPrefix(value, "-") {
+			idx := strings.Index(value, "=")
+			if idx < 0 {
+				continue
+			}
+			prefix, value = value[:idx+1], value[idx+1:]
+		}
+		if _, err := os.Stat(value); err != nil {
+			continue
+		}
+		abs, err := filepath.Abs(value)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = prefix + abs
+	}
+	return out, nil
+}
+
+// taskCommand is what the scheduled task runs (schtasks' /TR), cmd.exe is
+// used to append output to the log.
+func taskCommand(exe string, args []string, log string) string {
+	parts := []string{windowsQuote(exe)}
+	for i := range args {
+		parts = append(parts, windowsQuote(args[i]))
+	}
+	return fmt.Sprintf(`cmd.exe /c "%s >> %s 2>&1"`, strings.Join(parts, " "), windowsQuote(log))
+}
+
+// schtasksCreateArgs creates (or replaces) a task ran as SYSTEM
+func schtasksCreateArgs(name, schedule, command string) []string {
+	return []string{
+		"/Create", "/F",
+		"/TN", name,
+		"/TR", command,
+		"/SC", serviceSchedules[schedule],
+		"/RU", "SYSTEM",
+		"/RL", "HIGHEST",
+	}
+}
+
+// windowsQuote quotes s for cmd.exe if it contains spaces or quotes
+func windowsQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"&|<>^") {
+		return s
+	}
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
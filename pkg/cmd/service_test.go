@@ -0,0 +1,72 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCmdService__taskCommand(t *testing.T) {
+	cmd := taskCommand(`C:\Program Files\cert-manage\cert-manage.exe`, []string{"whitelist", "-file", `C:\wl.json`}, `C:\ProgramData\cert-manage\cert-manage.log`)
+	expected := `cmd.exe /c ""C:\Program Files\cert-manage\cert-manage.exe" whitelist -file C:\wl.json >> C:\ProgramData\cert-manage\cert-manage.log 2>&1"`
+	if cmd != expected {
+		t.Errorf("got %s", cmd)
+	}
+
+	args := schtasksCreateArgs("cert-manage", "daily", cmd)
+	if strings.Join(args[:4], " ") != "/Create /F /TN cert-manage" || args[5] != cmd || args[7] != "DAILY" {
+		t.Errorf("got %v", args)
+	}
+}
+
+func TestCmdService__absFileArgs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wl := filepath.Join(dir, "wl.json")
+	if err := ioutil.WriteFile(wl, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	args, err := absFileArgs([]string{"whitelist", "-file", "wl.json", "-app=java", "-profile=x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	abs, _ := filepath.Abs("wl.json")
+	if args[2] != abs || args[3] != "-app=java" {
+		t.Errorf("got %v", args)
+	}
+}
+
+func TestCmdService__options(t *testing.T) {
+	if err := InstallService(nil, ServiceOptions{Schedule: "daily"}); err == nil {
+		t.Error("expected error")
+	}
+	if err := InstallService([]string{"audit"}, ServiceOptions{Schedule: "yearly"}); err == nil || !strings.Contains(err.Error(), "daily, hourly, weekly") {
+		t.Errorf("got %v", err)
+	}
+}
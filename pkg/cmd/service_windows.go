@@ -0,0 +1,55 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build windows
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
+)
+
+func installService(args []string, opts ServiceOptions) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if opts.Log == "" {
+		opts.Log = filepath.Join(os.Getenv("ProgramData"), "cert-manage", opts.Name+".log")
+	}
+	if err := os.MkdirAll(filepath.Dir(opts.Log), 0755); err != nil {
+		return err
+	}
+
+	out, err := interrupt.Command("schtasks", schtasksCreateArgs(opts.Name, opts.Schedule, taskCommand(exe, args, opts.Log))...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error creating scheduled task %s: %v\n%s", opts.Name, err, strings.TrimSpace(string(out)))
+	}
+	fmt.Printf("Created scheduled task %s to run '%s' %s, output is written to %s\n", opts.Name, strings.Join(args, " "), opts.Schedule, opts.Log)
+	return nil
+}
+
+func removeService(name string) error {
+	out, err := interrupt.Command("schtasks", "/Delete", "/F", "/TN", name).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error removing scheduled task %s: %v\n%s", name, err, strings.TrimSpace(string(out)))
+	}
+	fmt.Printf("Removed scheduled task %s\n", name)
+	return nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/ui"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+// ShowOptions changes what's shown with each certificate
+type ShowOptions struct {
+	// Whitelist explains whether (and why) this whitelist keeps the
+	// certificate, including the owner and reason of its entries
+	Whitelist string
+
+	// FingerprintAlgo limits the fingerprints shown to one algorithm, see
+	// ui.GetFingerprintAlgos
+	FingerprintAlgo string
+}
+
+// ShowCertFromFile prints the details of each certificate in a file, or
+// stdin when where is "-". If `prefix` is non-empty only the certificate
+// matching it is shown.
+func ShowCertFromFile(where, prefix string, opts ShowOptions) error {
+	certs, err := readCertificates(where)
+	if err != nil {
+		return err
+	}
+	if prefix == "" {
+		wh, err := showWhitelist(opts)
+		if err != nil {
+			return err
+		}
+		for i := range certs {
+			if err := ui.ShowCertificate(os.Stdout, certs[i], opts.FingerprintAlgo); err != nil {
+				return err
+			}
+			if wh != nil {
+				explainWhitelist(os.Stdout, *wh, certs[i], time.Now())
+			}
+		}
+		return nil
+	}
+	return showCert(certs, prefix, opts)
+}
+
+// ShowCertForPlatform prints the details of a certificate in the platform
+// store whose fingerprint starts with `prefix`.
+func ShowCertForPlatform(prefix string, opts ShowOptions) error {
+	certs, err := store.Platform().List(&store.ListOptions{
+		Trusted: true,
+	})
+	err = warnPartial(err)
+	if err != nil {
+		return err
+	}
+	return showCert(certs, prefix, opts)
+}
+
+// ShowCertForApp prints the details of a certificate in an app's store
+// whose fingerprint starts with `prefix`.
+func ShowCertForApp(app, prefix string, opts ShowOptions) error {
+	st, err := store.ForApp(app)
+	if err != nil {
+		return err
+	}
+	certs, err := st.List(&store.ListOptions{
+		Trusted: true,
+	})
+	err = warnPartial(err)
+	if err != nil {
+		return err
+	}
+	return showCert(certs, prefix, opts)
+}
+
+func showCert(certs []*x509.Certificate, prefix string, opts ShowOptions) error {
+	cert, err := findByFingerprint(certs, prefix)
+	if err != nil {
+		return err
+	}
+	wh, err := showWhitelist(opts)
+	if err != nil {
+		return err
+	}
+	if err := ui.ShowCertificate(os.Stdout, cert, opts.FingerprintAlgo); err != nil {
+		return err
+	}
+	if wh != nil {
+		explainWhitelist(os.Stdout, *wh, cert, time.Now())
+	}
+	return nil
+}
+
+// showWhitelist reads ShowOptions.Whitelist, or returns nil if it's empty
+func showWhitelist(opts ShowOptions) (*whitelist.Whitelist, error) {
+	if opts.Whitelist == "" {
+		return nil, nil
+	}
+	wh, err := loadWhitelist(opts.Whitelist, "")
+	if err != nil {
+		return nil, err
+	}
+	return &wh, nil
+}
+
+// explainWhitelist writes whether the whitelist keeps a certificate, and
+// each entry which includes it with its annotations and expiry
+func explainWhitelist(w io.Writer, wh whitelist.Whitelist, cert *x509.Certificate, now time.Time) {
+	fmt.Fprintf(w, "Whitelist\n")
+	switch {
+	case whitelist.IsBlacklisted(cert):
+		fmt.Fprintf(w, "  Removed: blacklisted\n")
+	case wh.Matches(cert):
+		fmt.Fprintf(w, "  Kept\n")
+	default:
+		fmt.Fprintf(w, "  Removed: not matched\n")
+	}
+	entries := wh.EntriesFor(cert)
+	for i := range entries {
+		desc := entries[i].Annotation()
+		if desc == "" {
+			desc = "no annotations"
+		}
+		switch {
+		case entries[i].Expired(now):
+			desc += ", expired on " + entries[i].Expires
+		case entries[i].Expires != "":
+			desc += ", expires on " + entries[i].Expires
+		}
+		fmt.Fprintf(w, "  Entry: %s\n", desc)
+	}
+}
+
+// findByFingerprint returns the only certificate whose SHA256 (or SHA1)
+// fingerprint starts with `prefix`.
+func findByFingerprint(certs []*x509.Certificate, prefix string) (*x509.Certificate, error) {
+	prefix = strings.ToLower(strings.Replace(prefix, ":", "", -1))
+	if prefix == "" {
+		return nil, errors.New("no fingerprint given")
+	}
+
+	var found []*x509.Certificate
+	for i := range certs {
+		if strings.HasPrefix(certutil.GetHexSHA256Fingerprint(*certs[i]), prefix) ||
+			strings.HasPrefix(certutil.GetHexSHA1Fingerprint(*certs[i]), prefix) {
+			found = append(found, certs[i])
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("no certificate found matching %s", prefix)
+	case 1:
+		return found[0], nil
+	}
+	return nil, fmt.Errorf("fingerprint %s matches %d certificates, use a longer prefix", prefix, len(found))
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+func TestCmdShow__file(t *testing.T) {
+	t.Parallel()
+
+	if err := ShowCertFromFile("../../testdata/example.crt", "", ShowOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ShowCertFromFile("../../testdata/example.crt", "05:A6:DB", ShowOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ShowCertFromFile("../../testdata/example.crt", "ffff", ShowOptions{}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestCmdShow__findByFingerprint(t *testing.T) {
+	t.Parallel()
+
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := certutil.GetHexSHA256Fingerprint(*certs[0])
+
+	cert, err := findByFingerprint(certs, fp[:16])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert != certs[0] {
+		t.Errorf("found wrong cert: %s", cert.Subject)
+	}
+
+	// sha1 prefixes work too
+	cert, err = findByFingerprint(certs, certutil.GetHexSHA1Fingerprint(*certs[0]))
+	if err != nil || cert != certs[0] {
+		t.Errorf("cert=%v err=%v", cert, err)
+	}
+
+	// duplicates are ambiguous
+	if _, err := findByFingerprint(append(certs, certs[0]), fp); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := findByFingerprint(certs, ""); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestCmdShow__explainWhitelist(t *testing.T) {
+	t.Parallel()
+
+	certs, err := certutil.FromFile("../../testdata/example.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := certutil.GetHexSHA256Fingerprint(*certs[0])
+	entry := whitelist.Entry{Fingerprints: []string{fp}, Expires: "2999-12-31", Owner: "payments", Ticket: "SEC-42"}
+
+	var buf bytes.Buffer
+	explainWhitelist(&buf, whitelist.Whitelist{Entries: []whitelist.Entry{entry}}, certs[0], time.Now())
+	if out := buf.String(); !strings.Contains(out, "Kept") || !strings.Contains(out, "Entry: owner: payments, ticket: SEC-42, expires on 2999-12-31") {
+		t.Errorf("got %q", out)
+	}
+
+	// an expired entry no longer keeps the certificate
+	entry.Expires = "2019-12-31"
+	buf.Reset()
+	explainWhitelist(&buf, whitelist.Whitelist{Entries: []whitelist.Entry{entry}}, certs[0], time.Now())
+	if out := buf.String(); !strings.Contains(out, "Removed: not matched") || !strings.Contains(out, "expired on 2019-12-31") {
+		t.Errorf("got %q", out)
+	}
+}
@@ -0,0 +1,459 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/httputil"
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
+	"github.com/adamdecaf/cert-manage/pkg/progress"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+var (
+	// TopSitesURL is the ranked list of popular sites simulated against by
+	// default, the Tranco list (https://tranco-list.eu/) in "rank,domain" form.
+	TopSitesURL = "https://tranco-list.eu/top-1m.csv.zip"
+
+	// anchorCacheTTL is how long the roots found for a site are reused
+	// before it's probed again
+	anchorCacheTTL = 7 * 24 * time.Hour
+
+	simulateWorkers = 25
+
+	// simulateExamples is how many broken sites are shown for each root
+	simulateExamples = 3
+
+	// probeSite returns the chain a site serves on port 443
+	probeSite = func(host string) ([]*x509.Certificate, error) {
+		chain, _, err := grabChain(host, GrabOptions{})
+		return chain, err
+	}
+)
+
+// SimulateOptions configures a whitelist simulation against popular sites
+type SimulateOptions struct {
+	// Whitelist is a path to the whitelist simulated, or Profile a built-in one
+	Whitelist string
+	Profile   string
+
+	// Sites is a path or URL of a "rank,domain" list, TopSitesURL is used
+	// when empty. Zip and gzip compressed lists are read.
+	Sites string
+
+	// TopSites is how many of the highest ranked sites are checked
+	TopSites int
+
+	// Refresh probes every site again rather than using cached roots
+	Refresh bool
+}
+
+// topSite is a domain and its popularity ranking, 1 being the most popular
+type topSite struct {
+	rank int
+	host string
+}
+
+// siteAnchor is the cached result of probing a site, the SHA256
+// fingerprints of each root its chain verifies to.
+type siteAnchor struct {
+	Roots   []string  `json:"roots"`
+	Checked time.Time `json:"checked"`
+}
+
+// brokenRoot is a root not matched by the whitelist and the sites which
+// would no longer verify without it
+type brokenRoot struct {
+	cert  *x509.Certificate
+	sites []topSite
+}
+
+type simulation struct {
+	checked, skipped, broken int
+
+	// Sites are weighted by 1/rank to approximate how traffic falls off
+	// down a popularity ranking.
+	weight, brokenWeight float64
+
+	roots []*brokenRoot
+}
+
+// Simulate reports what share of popular sites would fail to verify if only
+// the roots matched by opts.Whitelist were trusted by the platform.
+//
+// Each site's roots are found by connecting to it and building its chains
+// to the platform's trusted roots and the snapshot of Mozilla's roots. Results are cached for a week, sites
+// which can't be reached or don't verify today are skipped.
+func Simulate(opts SimulateOptions) error {
+	if opts.TopSites <= 0 {
+		return errors.New("-top-sites needs to be greater than zero")
+	}
+	if opts.Sites == "" {
+		opts.Sites = TopSitesURL
+	}
+	wh, err := loadWhitelist(opts.Whitelist, opts.Profile)
+	if err != nil {
+		return err
+	}
+	sites, err := loadTopSites(opts.Sites, opts.TopSites)
+	if err != nil {
+		return err
+	}
+	roots, err := store.Platform().List(&store.ListOptions{
+		Trusted: true,
+	})
+	if err = warnPartial(err); err != nil {
+		return err
+	}
+	roots = withSnapshotRoots(roots)
+
+	cachePath := ""
+	if dir, err := store.StateDir(); err == nil {
+		cachePath = filepath.Join(dir, "site-anchors.json")
+	}
+	cache := readAnchorCache(cachePath)
+	if opts.Refresh {
+		cache = make(map[string]*siteAnchor)
+	}
+
+	res := simulate(sites, roots, wh, cache, time.Now())
+	if err := writeAnchorCache(cachePath, cache); err != nil && debug {
+		fmt.Printf("cmd: unable to cache site roots: %v\n", err)
+	}
+	return writeSimulation(os.Stdout, res)
+}
+
+func simulate(sites []topSite, roots []*x509.Certificate, wh whitelist.Whitelist, cache map[string]*siteAnchor, now time.Time) simulation {
+	pool := x509.NewCertPool()
+	byFingerprint := make(map[string]*x509.Certificate, len(roots))
+	for i := range roots {
+		pool.AddCert(roots[i])
+		byFingerprint[certutil.GetHexSHA256Fingerprint(*roots[i])] = roots[i]
+	}
+
+	var mu sync.Mutex
+	anchors := make([][]*x509.Certificate, len(sites))
+
+	bar := progress.New("Checking sites", len(sites))
+	workers := make(chan struct{}, simulateWorkers)
+	var wg sync.WaitGroup
+	for i := range sites {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			host := sites[i].host
+
+			mu.Lock()
+			cached := cache[host]
+			mu.Unlock()
+			if found := cachedAnchors(cached, byFingerprint, now); found != nil {
+				anchors[i] = found
+				bar.Increment()
+				return
+			}
+
+			// sites left after an interrupt, or without cached results
+			// when offline, are reported as skipped
+			if interrupt.Interrupted() || httputil.Offline {
+				bar.Increment()
+				return
+			}
+			found, err := probeAnchors(host, pool)
+			bar.Increment()
+			if err != nil {
+				if debug {
+					fmt.Printf("cmd: simulate: skipping %s: %v\n", host, err)
+				}
+				return
+			}
+			anchors[i] = found
+
+			entry := &siteAnchor{Checked: now}
+			for j := range found {
+				entry.Roots = append(entry.Roots, certutil.GetHexSHA256Fingerprint(*found[j]))
+			}
+			mu.Lock()
+			cache[host] = entry
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	bar.Done()
+
+	var res simulation
+	broken := make(map[*x509.Certificate]*brokenRoot)
+	for i := range sites {
+		if len(anchors[i]) == 0 {
+			res.skipped++
+			continue
+		}
+		weight := 1 / float64(sites[i].rank)
+		res.checked++
+		res.weight += weight
+
+		// Cross-signed roots give a site more than one chain, it only
+		// breaks if none of them are kept.
+		kept := false
+		for j := range anchors[i] {
+			if wh.Matches(anchors[i][j]) {
+				kept = true
+				break
+			}
+		}
+		if kept {
+			continue
+		}
+		res.broken++
+		res.brokenWeight += weight
+
+		root := anchors[i][0]
+		if broken[root] == nil {
+			broken[root] = &brokenRoot{cert: root}
+			res.roots = append(res.roots, broken[root])
+		}
+		broken[root].sites = append(broken[root].sites, sites[i])
+	}
+	sort.SliceStable(res.roots, func(i, j int) bool {
+		return len(res.roots[i].sites) > len(res.roots[j].sites)
+	})
+	return res
+}
+
+// cachedAnchors returns the roots previously found for a site, nil is
+// returned if they're stale or no longer trusted.
+func cachedAnchors(entry *siteAnchor, byFingerprint map[string]*x509.Certificate, now time.Time) []*x509.Certificate {
+	if entry == nil || len(entry.Roots) == 0 || now.Sub(entry.Checked) > anchorCacheTTL {
+		return nil
+	}
+	var out []*x509.Certificate
+	for i := range entry.Roots {
+		c, ok := byFingerprint[entry.Roots[i]]
+		if !ok {
+			return nil
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// probeAnchors connects to host (or www.host if that fails) and returns the
+// distinct roots its chain verifies to.
+func probeAnchors(host string, pool *x509.CertPool) ([]*x509.Certificate, error) {
+	chain, err := probeSite(host)
+	if err != nil && !strings.HasPrefix(host, "www.") {
+		host = "www." + host
+		chain, err = probeSite(host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no certificates presented")
+	}
+	intermediates := x509.NewCertPool()
+	for i := 1; i < len(chain); i++ {
+		intermediates.AddCert(chain[i])
+	}
+	chains, err := chain[0].Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Intermediates: intermediates,
+		Roots:         pool,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out []*x509.Certificate
+	seen := make(map[*x509.Certificate]bool)
+	for i := range chains {
+		root := chains[i][len(chains[i])-1]
+		if !seen[root] {
+			seen[root] = true
+			out = append(out, root)
+		}
+	}
+	return out, nil
+}
+
+func writeSimulation(w io.Writer, res simulation) error {
+	if res.checked == 0 {
+		return fmt.Errorf("none of the %d sites could be checked", res.skipped)
+	}
+	fmt.Fprintf(w, "%d of %d sites (%.1f%%) would break, about %.1f%% of their traffic\n",
+		res.broken, res.checked, 100*float64(res.broken)/float64(res.checked), 100*res.brokenWeight/res.weight)
+	if res.skipped > 0 {
+		fmt.Fprintf(w, "%d sites couldn't be reached or don't verify today and were skipped\n", res.skipped)
+	}
+	if len(res.roots) == 0 {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(tw, "\nRoot\tFingerprint\tSites\tExamples")
+	for i := range res.roots {
+		r := res.roots[i]
+		var examples []string
+		for j := 0; j < len(r.sites) && j < simulateExamples; j++ {
+			examples = append(examples, r.sites[j].host)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n",
+			certutil.StringifyPKIXName(r.cert.Subject),
+			certutil.GetHexSHA256Fingerprint(*r.cert)[:16],
+			len(r.sites),
+			strings.Join(examples, ", "),
+		)
+	}
+	return tw.Flush()
+}
+
+// loadTopSites reads the n highest ranked sites from a path or URL
+func loadTopSites(where string, n int) ([]topSite, error) {
+	var bs []byte
+	var err error
+	if strings.HasPrefix(where, "http://") || strings.HasPrefix(where, "https://") {
+		bs, err = downloadTopSites(where)
+	} else {
+		bs, err = ioutil.ReadFile(where)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r, err := decompressTopSites(bs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", where, err)
+	}
+	sites := readTopSites(r, n)
+	if len(sites) == 0 {
+		return nil, fmt.Errorf("no sites found in %s", where)
+	}
+	return sites, nil
+}
+
+func downloadTopSites(u string) ([]byte, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httputil.New().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %s", u, resp.Status)
+	}
+	bar := progress.NewBytes("Downloading "+u, resp.ContentLength)
+	defer bar.Done()
+	return ioutil.ReadAll(progress.Reader(io.LimitReader(resp.Body, maxDownloadSize), bar))
+}
+
+// decompressTopSites unwraps a zip (reading its first file) or gzip list,
+// other input is returned as-is
+func decompressTopSites(bs []byte) (io.Reader, error) {
+	switch {
+	case bytes.HasPrefix(bs, []byte("PK\x03\x04")):
+		zr, err := zip.NewReader(bytes.NewReader(bs), int64(len(bs)))
+		if err != nil {
+			return nil, err
+		}
+		if len(zr.File) == 0 {
+			return nil, errors.New("empty zip file")
+		}
+		return zr.File[0].Open()
+	case bytes.HasPrefix(bs, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(bytes.NewReader(bs))
+	}
+	return bytes.NewReader(bs), nil
+}
+
+// readTopSites parses "rank,domain" lines, as published by Tranco, Alexa
+// and Cisco Umbrella. A list of just domains is ranked by line.
+func readTopSites(r io.Reader, n int) []topSite {
+	var out []topSite
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() && len(out) < n {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		site := topSite{rank: len(out) + 1, host: line}
+		if idx := strings.Index(line, ","); idx > 0 {
+			if rank, err := strconv.Atoi(strings.TrimSpace(line[:idx])); err == nil && rank > 0 {
+				site.rank = rank
+			}
+			site.host = strings.TrimSpace(line[idx+1:])
+		}
+		site.host = strings.ToLower(site.host)
+		if site.host == "" || strings.ContainsAny(site.host, " /") {
+			continue
+		}
+		out = append(out, site)
+	}
+	return out
+}
+
+func readAnchorCache(path string) map[string]*siteAnchor {
+	cache := make(map[string]*siteAnchor)
+	if path == "" {
+		return cache
+	}
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	if err := json.Unmarshal(bs, &cache); err != nil {
+		if debug {
+			fmt.Printf("cmd: ignoring corrupt %s: %v\n", path, err)
+		}
+		return make(map[string]*siteAnchor)
+	}
+	return cache
+}
+
+func writeAnchorCache(path string, cache map[string]*siteAnchor) error {
+	if path == "" {
+		return nil
+	}
+	bs, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bs, file.TempFilePermissions)
+}
@@ -0,0 +1,155 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"math"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+func TestCmdSimulate__readTopSites(t *testing.T) {
+	in := "# top sites\n1,Google.com\n2, youtube.com\n\n5,not a host\n7,facebook.com\n"
+	sites := readTopSites(strings.NewReader(in), 10)
+	expected := []topSite{{1, "google.com"}, {2, "youtube.com"}, {7, "facebook.com"}}
+	if len(sites) != len(expected) {
+		t.Fatalf("got %v", sites)
+	}
+	for i := range expected {
+		if sites[i] != expected[i] {
+			t.Errorf("%d: got %v, expected %v", i, sites[i], expected[i])
+		}
+	}
+
+	// plain domains are ranked by line, only n are read
+	sites = readTopSites(strings.NewReader("a.com\nb.com\nc.com\n"), 2)
+	if len(sites) != 2 || sites[1] != (topSite{2, "b.com"}) {
+		t.Errorf("got %v", sites)
+	}
+}
+
+func TestCmdSimulate__decompress(t *testing.T) {
+	list := "1,example.com\n"
+
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	w, err := zw.Create("top-1m.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(list))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var gzipped bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	gw.Write([]byte(list))
+	gw.Close()
+
+	for _, bs := range [][]byte{zipped.Bytes(), gzipped.Bytes(), []byte(list)} {
+		r, err := decompressTopSites(bs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != list {
+			t.Errorf("got %q", out)
+		}
+	}
+}
+
+func TestCmdSimulate__simulate(t *testing.T) {
+	kept, err := testca.NewRoot("Kept Root CA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := testca.NewRoot("Removed Root CA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chains := make(map[string][]*x509.Certificate)
+	for host, ca := range map[string]*testca.CA{"a.com": kept, "b.com": removed, "www.c.com": removed} {
+		leaf, _, err := ca.NewLeaf(host, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chains[host] = []*x509.Certificate{leaf}
+	}
+
+	orig := probeSite
+	defer func() { probeSite = orig }()
+	var probes int32
+	probeSite = func(host string) ([]*x509.Certificate, error) {
+		atomic.AddInt32(&probes, 1)
+		if chain, ok := chains[host]; ok {
+			return chain, nil
+		}
+		return nil, errors.New("connection refused")
+	}
+
+	sites := []topSite{{1, "a.com"}, {2, "b.com"}, {3, "c.com"}, {4, "d.com"}}
+	roots := []*x509.Certificate{kept.Certificate, removed.Certificate}
+	wh := whitelist.FromCertificates([]*x509.Certificate{kept.Certificate})
+	cache := make(map[string]*siteAnchor)
+	now := time.Now()
+
+	check := func(res simulation) {
+		t.Helper()
+		if res.checked != 3 || res.skipped != 1 || res.broken != 2 {
+			t.Errorf("checked=%d skipped=%d broken=%d", res.checked, res.skipped, res.broken)
+		}
+		share := res.brokenWeight / res.weight
+		if expected := (1.0/2 + 1.0/3) / (1 + 1.0/2 + 1.0/3); math.Abs(share-expected) > 1e-9 {
+			t.Errorf("got traffic share %f, expected %f", share, expected)
+		}
+		if len(res.roots) != 1 || res.roots[0].cert != removed.Certificate || len(res.roots[0].sites) != 2 {
+			t.Errorf("got %v", res.roots)
+		}
+	}
+	check(simulate(sites, roots, wh, cache, now))
+	if len(cache) != 3 || cache["d.com"] != nil {
+		t.Errorf("cache: %v", cache)
+	}
+
+	// cached roots are used, only the unreachable site is probed again
+	atomic.StoreInt32(&probes, 0)
+	check(simulate(sites, roots, wh, cache, now.Add(time.Hour)))
+	if probes != 2 {
+		t.Errorf("got %d probes", probes)
+	}
+
+	var buf bytes.Buffer
+	if err := writeSimulation(&buf, simulate(sites, roots, wh, cache, now)); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "2 of 3 sites (66.7%) would break") || !strings.Contains(out, "b.com, c.com") {
+		t.Errorf("got:\n%s", out)
+	}
+}
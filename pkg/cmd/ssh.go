@@ -0,0 +1,215 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/adamdecaf/cert-manage/pkg/sshca"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/ui"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+// isSSH returns true if app is OpenSSH's trusted CAs, which are keys
+// rather than certificates and so aren't a store.Store
+func isSSH(app string) bool {
+	return strings.EqualFold(app, "ssh")
+}
+
+func sshBackupDir() (string, error) {
+	dir, err := store.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ssh"), nil
+}
+
+// sshKey is how a CA key is written with -format json
+type sshKey struct {
+	Kind        string `json:"kind"`
+	Type        string `json:"type"`
+	Fingerprint string `json:"fingerprint"`
+	Bits        int    `json:"bits,omitempty"`
+	Comment     string `json:"comment,omitempty"`
+	Hosts       string `json:"hosts,omitempty"`
+	Path        string `json:"path"`
+	Line        int    `json:"line"`
+}
+
+func listSSHCAs(w io.Writer, cfg *ui.Config) error {
+	keys, err := sshca.List()
+	if err != nil {
+		return err
+	}
+	if cfg.Count {
+		fmt.Fprintln(w, len(keys))
+		return nil
+	}
+	if strings.EqualFold(cfg.Format, "json") {
+		out := make([]sshKey, len(keys))
+		for i, k := range keys {
+			out[i] = sshKey(k)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+	return writeSSHCAsTable(w, keys)
+}
+
+func writeSSHCAsTable(w io.Writer, keys []sshca.Key) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(tw, "Kind\tFingerprint\tType\tBits\tHosts\tComment\tFile")
+	for _, k := range keys {
+		hosts := k.Hosts
+		if hosts == "" {
+			hosts = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s:%d\n", k.Kind, k.Fingerprint, k.Type, k.Bits, hosts, k.Comment, k.Path, k.Line)
+	}
+	return tw.Flush()
+}
+
+func backupSSH() error {
+	if store.DryRun() {
+		fmt.Println("Would backup ssh CAs")
+		return nil
+	}
+	dir, err := sshBackupDir()
+	if err != nil {
+		return err
+	}
+	if _, err := sshca.Backup(dir); err != nil {
+		return err
+	}
+	fmt.Println("Backup completed successfully")
+	return nil
+}
+
+// whitelistSSH removes each trusted CA key not in wh.SSHKeys
+func whitelistSSH(w io.Writer, wh whitelist.Whitelist) error {
+	dir, err := sshBackupDir()
+	if err != nil {
+		return err
+	}
+	latest, err := sshca.LatestBackup(dir)
+	if err != nil {
+		return fmt.Errorf("can't get latest ssh backup err=%v", err)
+	}
+	if latest == "" {
+		return errors.New("no ssh backup found")
+	}
+
+	keep := func(k sshca.Key) bool {
+		return wh.MatchesSSHKey(k.Fingerprint)
+	}
+	if store.DryRun() {
+		keys, err := sshca.List()
+		if err != nil {
+			return err
+		}
+		var removed []sshca.Key
+		for _, k := range keys {
+			if !keep(k) {
+				removed = append(removed, k)
+			}
+		}
+		fmt.Fprintf(w, "Would remove trust from %d of %d key(s) in ssh:\n", len(removed), len(keys))
+		for _, k := range removed {
+			fmt.Fprintf(w, "  %s  %s:%d\n", k.Fingerprint, k.Path, k.Line)
+		}
+		return nil
+	}
+	if err := sshca.Remove(keep); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "Whitelist completed successfully")
+	return nil
+}
+
+// restoreSSH copies back the files of a backup, the latest if path is empty
+func restoreSSH(path string, opts RestoreOptions) error {
+	if path == "" {
+		dir, err := sshBackupDir()
+		if err != nil {
+			return err
+		}
+		path, err = sshca.LatestBackup(dir)
+		if err != nil {
+			return err
+		}
+		if path == "" {
+			return errors.New("no ssh backup found")
+		}
+	}
+	if store.DryRun() {
+		fmt.Printf("Would restore ssh from %s\n", path)
+		return nil
+	}
+	if !opts.Yes {
+		added, removed, err := sshBackupChanges(path)
+		if err != nil {
+			return err
+		}
+		if err := confirmRestore(os.Stdin, os.Stderr, restoreSummary(path, "key", added, removed)); err != nil {
+			return err
+		}
+	}
+	if err := sshca.Restore(path); err != nil {
+		return err
+	}
+	fmt.Println("Restore completed successfully")
+	return nil
+}
+
+// sshBackupChanges returns how many CA keys restoring from `path` adds back
+// and how many it removes, keys are compared per file
+func sshBackupChanges(path string) (added, removed int, err error) {
+	backup, err := sshca.ListBackup(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	current, err := sshca.List()
+	if err != nil {
+		return 0, 0, err
+	}
+	id := func(k sshca.Key) string {
+		return k.Path + " " + k.Fingerprint
+	}
+	before, after := make(map[string]bool), make(map[string]bool)
+	for _, k := range current {
+		before[id(k)] = true
+	}
+	for _, k := range backup {
+		after[id(k)] = true
+		if !before[id(k)] {
+			added++
+		}
+	}
+	for k := range before {
+		if !after[k] {
+			removed++
+		}
+	}
+	return added, removed, nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/sshca"
+)
+
+func TestSSH__writeTable(t *testing.T) {
+	keys := []sshca.Key{
+		{Kind: sshca.HostCA, Type: "ssh-ed25519", Fingerprint: "SHA256:IbZNb1n2XzGLUCfB0ywgo5AsXEoa6xUMNZniU0N4tQs", Bits: 256, Hosts: "*.example.com", Path: "/etc/ssh/ssh_known_hosts", Line: 3},
+		{Kind: sshca.UserCA, Type: "ssh-rsa", Fingerprint: "SHA256:1jBzuiOouBvM1efIPCik9+Tp3V2xUbS8MfB0+brblCE", Bits: 4096, Comment: "user-ca", Path: "/etc/ssh/user_ca.pub", Line: 1},
+	}
+	var buf bytes.Buffer
+	if err := writeSSHCAsTable(&buf, keys); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got\n%s", buf.String())
+	}
+	if !strings.Contains(lines[1], "*.example.com") || !strings.Contains(lines[1], "/etc/ssh/ssh_known_hosts:3") {
+		t.Errorf("got %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "user ") || !strings.Contains(lines[2], " - ") || !strings.Contains(lines[2], "user-ca") {
+		t.Errorf("got %q", lines[2])
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+// storeStats summarizes the certificates in a store
+type storeStats struct {
+	total   int
+	expired int
+
+	keys      map[string]int
+	countries map[string]int
+
+	oldest, newest *x509.Certificate
+
+	sha1Signed int
+
+	// whitelisted is only set when a whitelist was given
+	whitelisted *int
+}
+
+// StatsForApp summarizes the certificates trusted by app. If whpath or
+// profile is given whitelist coverage is included.
+func StatsForApp(app, whpath, profile string) error {
+	s, err := store.ForApp(app)
+	if err != nil {
+		return err
+	}
+	return stats(os.Stdout, s, whpath, profile)
+}
+
+// StatsForPlatform summarizes the certificates trusted by the platform. If
+// whpath or profile is given whitelist coverage is included.
+func StatsForPlatform(whpath, profile string) error {
+	return stats(os.Stdout, store.Platform(), whpath, profile)
+}
+
+func stats(w io.Writer, s store.Store, whpath, profile string) error {
+	var wh *whitelist.Whitelist
+	if whpath != "" || profile != "" {
+		loaded, err := loadWhitelist(whpath, profile)
+		if err != nil {
+			return err
+		}
+		wh = &loaded
+	}
+	certs, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	if err = warnPartial(err); err != nil {
+		return err
+	}
+	return writeStats(w, computeStats(certs, wh, time.Now()))
+}
+
+func computeStats(certs []*x509.Certificate, wh *whitelist.Whitelist, now time.Time) storeStats {
+	st := storeStats{
+		total:     len(certs),
+		keys:      make(map[string]int),
+		countries: make(map[string]int),
+	}
+	if wh != nil {
+		st.whitelisted = new(int)
+	}
+	for i := range certs {
+		c := certs[i]
+		if now.After(c.NotAfter) {
+			st.expired++
+		}
+		st.keys[describeKey(c)]++
+
+		country := "-"
+		if len(c.Subject.Country) > 0 && c.Subject.Country[0] != "" {
+			country = c.Subject.Country[0]
+		}
+		st.countries[country]++
+
+		if st.oldest == nil || c.NotAfter.Before(st.oldest.NotAfter) {
+			st.oldest = c
+		}
+		if st.newest == nil || c.NotAfter.After(st.newest.NotAfter) {
+			st.newest = c
+		}
+		switch c.SignatureAlgorithm {
+		case x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+			st.sha1Signed++
+		}
+		if wh != nil && wh.Matches(c) {
+			*st.whitelisted++
+		}
+	}
+	return st
+}
+
+// describeKey renders a certificate's public key as e.g. "RSA 2048"
+func describeKey(c *x509.Certificate) string {
+	algo := certutil.StringifyPubKeyAlgo(c.PublicKeyAlgorithm)
+	if size := certutil.PublicKeySize(*c); size > 0 {
+		return fmt.Sprintf("%s %d", algo, size)
+	}
+	return algo
+}
+
+func writeStats(w io.Writer, st storeStats) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(tw, "Certificates\t%d\n", st.total)
+	fmt.Fprintf(tw, "Expired\t%d\n", st.expired)
+	fmt.Fprintf(tw, "SHA-1 signed\t%d\n", st.sha1Signed)
+	if st.oldest != nil {
+		fmt.Fprintf(tw, "Oldest expiry\t%s\t%s\n", timeutil.Date(st.oldest.NotAfter), certutil.StringifyPKIXName(st.oldest.Subject))
+		fmt.Fprintf(tw, "Newest expiry\t%s\t%s\n", timeutil.Date(st.newest.NotAfter), certutil.StringifyPKIXName(st.newest.Subject))
+	}
+	if st.whitelisted != nil {
+		pct := 0.0
+		if st.total > 0 {
+			pct = 100 * float64(*st.whitelisted) / float64(st.total)
+		}
+		fmt.Fprintf(tw, "Whitelist coverage\t%.1f%% (%d of %d)\n", pct, *st.whitelisted, st.total)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if err := writeCounts(w, "Key", st.keys); err != nil {
+		return err
+	}
+	return writeCounts(w, "Country", st.countries)
+}
+
+// writeCounts writes a table of counts, largest first
+func writeCounts(w io.Writer, heading string, counts map[string]int) error {
+	if len(counts) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(counts))
+	for k := range counts {
+		names = append(names, k)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(tw, "\n%s\tCount\n", heading)
+	for i := range names {
+		fmt.Fprintf(tw, "%s\t%d\n", names[i], counts[names[i]])
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+func TestCmdStats__compute(t *testing.T) {
+	now := time.Now()
+	old, err := testca.NewRoot("Old Root CA", &testca.Options{
+		Country:   "US",
+		RSABits:   1024,
+		NotBefore: now.AddDate(-2, 0, 0),
+		NotAfter:  now.AddDate(0, 0, -1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	long, err := testca.NewRoot("Long Root CA", &testca.Options{
+		Country:  "DE",
+		NotAfter: now.AddDate(20, 0, 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := testca.NewRoot("Plain Root CA", &testca.Options{Country: "US"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha1 := &x509.Certificate{
+		Raw:                []byte("sha1"),
+		PublicKeyAlgorithm: x509.RSA,
+		SignatureAlgorithm: x509.SHA1WithRSA,
+		NotAfter:           now.AddDate(1, 0, 0),
+	}
+
+	certs := []*x509.Certificate{old.Certificate, long.Certificate, plain.Certificate, sha1}
+	wh := whitelist.FromCertificates([]*x509.Certificate{long.Certificate, plain.Certificate})
+	st := computeStats(certs, &wh, now)
+
+	if st.total != 4 || st.expired != 1 || st.sha1Signed != 1 {
+		t.Errorf("got total=%d expired=%d sha1=%d", st.total, st.expired, st.sha1Signed)
+	}
+	if st.keys["RSA 1024"] != 1 || st.keys["ECDSA 256"] != 2 || st.keys["RSA"] != 1 {
+		t.Errorf("keys: %v", st.keys)
+	}
+	if st.countries["US"] != 2 || st.countries["DE"] != 1 || st.countries["-"] != 1 {
+		t.Errorf("countries: %v", st.countries)
+	}
+	if st.oldest != old.Certificate || st.newest != long.Certificate {
+		t.Errorf("oldest=%v newest=%v", st.oldest.Subject, st.newest.Subject)
+	}
+	if st.whitelisted == nil || *st.whitelisted != 2 {
+		t.Errorf("whitelisted: %v", st.whitelisted)
+	}
+
+	var buf bytes.Buffer
+	if err := writeStats(&buf, st); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"Certificates       4", "Expired            1", "SHA-1 signed       1", "Whitelist coverage 50.0% (2 of 4)", "Long Root CA", "\nKey       Count\nECDSA 256 2\n", "\nCountry Count\nUS      2\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestCmdStats__noWhitelist(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := computeStats(certs, nil, time.Now())
+	if st.total != len(certs) || st.whitelisted != nil {
+		t.Errorf("got %d certificates, whitelisted=%v", st.total, st.whitelisted)
+	}
+
+	var buf bytes.Buffer
+	if err := writeStats(&buf, st); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "Whitelist coverage") {
+		t.Errorf("unexpected coverage:\n%s", buf.String())
+	}
+}
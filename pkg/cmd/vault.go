@@ -0,0 +1,189 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/vault"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+var (
+	// vaultSyncFile records which CAs were added to each store from Vault,
+	// in the cert-manage directory
+	vaultSyncFile = "vault-sync.json"
+)
+
+// TrustVaultOptions describes which Vault PKI mounts are synced where
+type TrustVaultOptions struct {
+	// Mounts are the PKI secrets engines read, e.g. pki and pki_int
+	Mounts []string
+
+	// Stores are the app names (or "platform") the CAs are added to
+	Stores []string
+
+	// Out is where to write a whitelist of the CAs, if non-empty
+	Out string
+}
+
+// TrustVault adds the CA certificates of Vault PKI mounts to each store, with
+// the server read from VAULT_ADDR (see vault.FromEnv).
+//
+// CAs added by an earlier run which Vault no longer serves (e.g. after a root
+// rotation) are removed, so running this on a schedule keeps stores in sync.
+func TrustVault(opts TrustVaultOptions) error {
+	client, err := vault.FromEnv()
+	if err != nil {
+		return err
+	}
+	targets, err := trustTargets(opts.Stores)
+	if err != nil {
+		return err
+	}
+	syncPath := ""
+	if dir, err := store.StateDir(); err == nil {
+		syncPath = filepath.Join(dir, vaultSyncFile)
+	}
+	return trustVault(os.Stdout, client, opts, targets, syncPath)
+}
+
+func trustVault(w io.Writer, client *vault.Client, opts TrustVaultOptions, targets []trustTarget, syncPath string) error {
+	pool := certutil.Pool{}
+	for i := range opts.Mounts {
+		certs, err := client.CACertificates(opts.Mounts[i])
+		if err != nil {
+			return fmt.Errorf("reading %s from %s: %v", opts.Mounts[i], client.Addr, err)
+		}
+		pool.AddCertificates(certs)
+	}
+	cas := pool.GetCertificates()
+
+	if opts.Out != "" {
+		if err := whitelist.FromCertificates(cas).ToFile(opts.Out); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Wrote whitelist with %d fingerprints to %s\n", len(cas), opts.Out)
+	}
+
+	synced := readVaultSync(syncPath)
+	current := make(map[string]bool)
+	for i := range cas {
+		current[certutil.GetHexSHA256Fingerprint(*cas[i])] = true
+	}
+	for i := range targets {
+		if err := targets[i].writable(); err != nil {
+			return err
+		}
+		if err := targets[i].s.Add(cas); err != nil {
+			return fmt.Errorf("adding CAs to %s: %v", targets[i].name, err)
+		}
+
+		key := client.Addr + " " + targets[i].name
+		removed, err := removeStale(targets[i].s, synced[key], current)
+		if err != nil {
+			return fmt.Errorf("removing old CAs from %s: %v", targets[i].name, err)
+		}
+		fmt.Fprintf(w, "Synced %d CAs from %s to %s", len(cas), client.Addr, targets[i].name)
+		if removed > 0 {
+			fmt.Fprintf(w, ", removing %d Vault no longer has", removed)
+		}
+		fmt.Fprintln(w)
+
+		synced[key] = make([]string, 0, len(current))
+		for fp := range current {
+			synced[key] = append(synced[key], fp)
+		}
+		sort.Strings(synced[key])
+	}
+	if store.DryRun() {
+		return nil
+	}
+	return writeVaultSync(syncPath, synced)
+}
+
+// removeStale removes the certificates previously synced to s which aren't
+// current anymore, returning how many were
+func removeStale(s store.Store, previous []string, current map[string]bool) (int, error) {
+	stale := make(map[string]bool)
+	for i := range previous {
+		if !current[previous[i]] {
+			stale[previous[i]] = true
+		}
+	}
+	if len(stale) == 0 {
+		return 0, nil
+	}
+	certs, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	if err = warnPartial(err); err != nil {
+		return 0, err
+	}
+	var keep []*x509.Certificate
+	removed := 0
+	for i := range certs {
+		if stale[certutil.GetHexSHA256Fingerprint(*certs[i])] {
+			removed++
+			continue
+		}
+		keep = append(keep, certs[i])
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, s.Remove(whitelist.FromCertificates(keep))
+}
+
+// readVaultSync returns the fingerprints synced from Vault, keyed by the
+// Vault address and store name
+func readVaultSync(path string) map[string][]string {
+	synced := make(map[string][]string)
+	if path == "" {
+		return synced
+	}
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return synced
+	}
+	if err := json.Unmarshal(bs, &synced); err != nil {
+		if debug {
+			fmt.Printf("cmd: ignoring corrupt %s: %v\n", path, err)
+		}
+		return make(map[string][]string)
+	}
+	return synced
+}
+
+func writeVaultSync(path string, synced map[string][]string) error {
+	if path == "" {
+		return nil
+	}
+	bs, err := json.MarshalIndent(synced, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bs, file.TempFilePermissions)
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+	"github.com/adamdecaf/cert-manage/pkg/vault"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+func TestCmdTrustVault(t *testing.T) {
+	old, err := testca.NewRoot("Vault Root", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := testca.NewRoot("Vault Root 2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := testca.NewRoot("Other Root", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := old.Certificate
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/pki/ca/pem" {
+			pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "cert-manage-vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := store.MemoryStore([]*x509.Certificate{other.Certificate})
+	opts := TrustVaultOptions{Mounts: []string{"pki"}, Out: filepath.Join(dir, "vault.yaml")}
+	client := &vault.Client{Addr: srv.URL}
+	sync := func() []*x509.Certificate {
+		var buf bytes.Buffer
+		if err := trustVault(&buf, client, opts, []trustTarget{{"memory", s}}, filepath.Join(dir, vaultSyncFile)); err != nil {
+			t.Fatal(err)
+		}
+		certs, _ := s.List(&store.ListOptions{Trusted: true})
+		return certs
+	}
+
+	if certs := sync(); len(certs) != 2 {
+		t.Fatalf("got %d certificates", len(certs))
+	}
+	wh, err := whitelist.FromFile(opts.Out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !wh.Matches(root) || wh.Matches(other.Certificate) {
+		t.Errorf("got %#v", wh)
+	}
+
+	// the old root is removed after rotating, but not what Vault didn't add
+	root = rotated.Certificate
+	certs := sync()
+	if len(certs) != 2 {
+		t.Fatalf("got %d certificates", len(certs))
+	}
+	for i := range certs {
+		if certs[i].Equal(old.Certificate) {
+			t.Error("expected the old root to be removed")
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+// readHostsFile reads the hosts in path, see readHosts for the format
+func readHostsFile(path string) ([]string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	hosts, err := readHosts(fd)
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts found in %s", path)
+	}
+	return hosts, nil
+}
+
+// hostFailure is a host which didn't verify
+type hostFailure struct {
+	host string
+	err  error
+}
+
+// verifyHosts connects to each host trusting only roots, returning the
+// hosts which failed to verify.
+func verifyHosts(hosts []string, roots []*x509.Certificate) []hostFailure {
+	pool := x509.NewCertPool()
+	for i := range roots {
+		pool.AddCert(roots[i])
+	}
+	var failed []hostFailure
+	for i := range hosts {
+		if _, err := verifiedChain(hosts[i], pool); err != nil {
+			failed = append(failed, hostFailure{hosts[i], err})
+		}
+	}
+	return failed
+}
+
+// verifyWhitelist checks hosts verify against what s trusts after wh was
+// applied, restoring `backup` if any fail. In dry-run mode the store hasn't
+// changed so hosts are checked against what wh would leave trusted.
+func verifyWhitelist(s store.Store, name string, wh whitelist.Whitelist, hosts []string, backup string) error {
+	certs, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	err = warnPartial(err)
+	if err != nil {
+		return err
+	}
+	if store.DryRun() {
+		var kept []*x509.Certificate
+		for i := range certs {
+			if wh.Matches(certs[i]) {
+				kept = append(kept, certs[i])
+			}
+		}
+		certs = kept
+	}
+
+	failed := verifyHosts(hosts, certs)
+	if len(failed) == 0 {
+		fmt.Printf("Verified %d hosts\n", len(hosts))
+		return nil
+	}
+	for i := range failed {
+		fmt.Printf("FAILED %s: %v\n", failed[i].host, failed[i].err)
+	}
+	if store.DryRun() {
+		return fmt.Errorf("%d of %d hosts would fail to verify after applying the whitelist", len(failed), len(hosts))
+	}
+	if err := s.Restore(backup); err != nil {
+		return fmt.Errorf("%d of %d hosts failed to verify and restoring %s from %s failed: %v", len(failed), len(hosts), name, backup, err)
+	}
+	return fmt.Errorf("%d of %d hosts failed to verify, restored %s from %s", len(failed), len(hosts), name, backup)
+}
@@ -0,0 +1,88 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+func TestCmdWhitelist__verifyHosts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	hosts := filepath.Join(dir, "hosts.txt")
+	if err := ioutil.WriteFile(hosts, []byte("# critical\n"+srv.URL+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lots, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs := append([]*x509.Certificate{srv.Certificate()}, lots[:2]...)
+	opts := WhitelistOptions{
+		Force:       true,
+		VerifyHosts: hosts,
+	}
+
+	// removing the server's root fails verification and is rolled back
+	s := store.MemoryStore(certs)
+	if err := s.Backup(); err != nil {
+		t.Fatal(err)
+	}
+	err = applyWhitelist(s, "verify-hosts-test", whitelist.FromCertificates(lots[:1]), opts)
+	if err == nil || !strings.Contains(err.Error(), "1 of 1 hosts failed to verify, restored") {
+		t.Fatalf("expected rollback, got %v", err)
+	}
+	if after, _ := s.List(nil); len(after) != 3 {
+		t.Errorf("expected store to be restored, got %d certificates", len(after))
+	}
+
+	// keeping it verifies
+	err = applyWhitelist(s, "verify-hosts-test", whitelist.FromCertificates(certs[:2]), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := s.List(nil); len(after) != 2 {
+		t.Errorf("expected whitelist to be applied, got %d certificates", len(after))
+	}
+
+	// an empty hosts file is refused before anything changes
+	if err := ioutil.WriteFile(hosts, []byte("# nothing\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyWhitelist(s, "verify-hosts-test", whitelist.FromCertificates(lots[:1]), opts); err == nil {
+		t.Error("expected error")
+	}
+	if after, _ := s.List(nil); len(after) != 2 {
+		t.Errorf("store shouldn't have changed, got %d certificates", len(after))
+	}
+}
@@ -15,70 +15,241 @@
 package cmd
 
 import (
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"os"
 	"runtime"
+	"time"
 
+	"github.com/adamdecaf/cert-manage/pkg/events"
+	"github.com/adamdecaf/cert-manage/pkg/metrics"
 	"github.com/adamdecaf/cert-manage/pkg/store"
 	"github.com/adamdecaf/cert-manage/pkg/whitelist"
 )
 
-func WhitelistForApp(app, whpath string) error {
+// WhitelistOptions changes how a whitelist is applied
+type WhitelistOptions struct {
+	// Force applies the whitelist even if it was already applied
+	Force bool
+
+	// VerifyHosts is a file of hosts (see readHosts) which must verify
+	// after the whitelist is applied, otherwise the store is restored
+	// from the backup taken before.
+	VerifyHosts string
+
+	// Cascade also removes intermediates which only chain to removed
+	// certificates, otherwise they're warned about.
+	Cascade bool
+
+	// Policies are the names of the whitelist's policies to apply, every
+	// policy is applied when empty.
+	Policies []string
+}
+
+func WhitelistForApp(app, whpath, profile string, opts WhitelistOptions) error {
 	// load whitelist
-	wh, err := whitelist.FromFile(whpath)
+	wh, err := loadPolicies(whpath, profile, opts.Policies)
 	if err != nil {
 		return err
 	}
+	if isGPG(app) {
+		return whitelistGPG(os.Stdout, wh)
+	}
+	if isSSH(app) {
+		return whitelistSSH(os.Stdout, wh)
+	}
 
 	// diff
 	s, err := store.ForApp(app)
 	if err != nil {
 		return err
 	}
+	return applyWhitelist(s, app, wh, opts)
+}
+
+func WhitelistForPlatform(whpath, profile string, opts WhitelistOptions) error {
+	// load whitelist
+	wh, err := loadPolicies(whpath, profile, opts.Policies)
+	if err != nil {
+		return err
+	}
+	return applyWhitelist(store.Platform(), runtime.GOOS, wh, opts)
+}
 
+// applyWhitelist removes trust from each certificate in s not matching wh.
+//
+// The whitelist and resulting certificates are recorded for the store so
+// applying the same whitelist again is skipped, unless `force` is set or
+// the store has changed since.
+//
+// With VerifyHosts each host is connected to afterwards, trusting only what
+// the store still trusts, and the latest backup is restored if any fail.
+//
+// Intermediates left without a trusted issuer are warned about, or removed
+// with Cascade.
+func applyWhitelist(s store.Store, name string, wh whitelist.Whitelist, opts WhitelistOptions) error {
 	// check for a backup
 	latest, err := s.GetLatestBackup()
 	if err != nil {
-		return fmt.Errorf("can't get latest %s backup err=%v", app, err)
+		return fmt.Errorf("can't get latest %s backup err=%v", name, err)
 	}
 	if latest == "" {
-		return fmt.Errorf("no backup for %s found", app)
+		return fmt.Errorf("no %s backup found", name)
+	}
+
+	var hosts []string
+	if opts.VerifyHosts != "" {
+		hosts, err = readHostsFile(opts.VerifyHosts)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !opts.Force {
+		applied, err := whitelistApplied(s, name, wh, opts.Cascade)
+		if err != nil {
+			return err
+		}
+		if applied {
+			fmt.Println("Whitelist already applied, nothing changed (use -force to apply again)")
+			return nil
+		}
+	}
+
+	// check for intermediates left behind
+	effective := wh
+	certs, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	if err = warnPartial(err); err != nil {
+		return err
+	}
+	distrusted, err := distrustedSince(s, certs)
+	if err != nil && debug {
+		fmt.Printf("cmd: unable to read %s backup for removed issuers: %v\n", name, err)
+	}
+	if orphans := orphanedIntermediates(certs, distrusted, wh); len(orphans) > 0 {
+		printOrphans(os.Stdout, orphans, opts.Cascade)
+		if opts.Cascade {
+			effective = cascadeWhitelist(certs, wh, orphans)
+		}
 	}
 
 	// perform whitelist
-	err = s.Remove(wh)
+	err = s.Remove(effective)
 	if err != nil {
 		return err
 	}
+	if len(hosts) > 0 {
+		if err := verifyWhitelist(s, name, effective, hosts, latest); err != nil {
+			return err
+		}
+	}
+	if !store.DryRun() {
+		if err := recordWhitelist(s, name, wh, opts.Cascade); err != nil {
+			return err
+		}
+		var removed []*x509.Certificate
+		for i, matched := range effective.MatchEach(certs) {
+			if !matched {
+				removed = append(removed, certs[i])
+			}
+		}
+		metrics.Add(metrics.CertificatesRemoved, len(removed))
+		events.EmitEach(events.Removed, name, "not whitelisted", removed)
+	}
 
 	fmt.Println("Whitelist completed successfully")
 	return nil
 }
 
-func WhitelistForPlatform(whpath string) error {
-	// load whitelist
-	wh, err := whitelist.FromFile(whpath)
+// whitelistApplied returns true if wh was the last whitelist applied to s (with
+// the same cascade option) and the trusted certificates haven't changed since.
+func whitelistApplied(s store.Store, name string, wh whitelist.Whitelist, cascade bool) (bool, error) {
+	st, err := store.GetState(name)
+	if err != nil || st == nil {
+		return false, err
+	}
+	certs, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
 	if err != nil {
-		return err
+		return false, err
 	}
+	return stateCurrent(st, certs, wh, cascade, time.Now()), nil
+}
 
-	// diff
-	s := store.Platform()
-
-	// check for backup
-	latest, err := s.GetLatestBackup()
-	if err != nil {
-		return fmt.Errorf("can't get latest backup for %s err=%v", runtime.GOOS, err)
+// stateCurrent returns true if applying wh again wouldn't change certs. An
+// entry's expiry doesn't change the whitelist's hash, so the state is stale
+// once an entry expires after it was applied or a trusted certificate stops
+// matching.
+func stateCurrent(st *store.State, certs []*x509.Certificate, wh whitelist.Whitelist, cascade bool, now time.Time) bool {
+	if st.Whitelist != wh.Hash() || st.Cascade != cascade {
+		return false
 	}
-	if latest == "" {
-		return fmt.Errorf("no %s backup found", runtime.GOOS)
+	if st.Certificates != store.HashCertificates(certs) {
+		return false
+	}
+	expired := wh.ExpiredEntries(now)
+	for i := range expired {
+		if at, err := expired[i].ExpiresAt(); err == nil && at.After(st.Applied) {
+			return false
+		}
+	}
+	for _, matched := range wh.MatchEach(certs) {
+		if !matched {
+			return false
+		}
 	}
+	return true
+}
 
-	// perform whitelist
-	err = s.Remove(wh)
+func recordWhitelist(s store.Store, name string, wh whitelist.Whitelist, cascade bool) error {
+	certs, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	err = warnPartial(err)
 	if err != nil {
 		return err
 	}
+	return store.SaveState(name, store.State{
+		Whitelist:    wh.Hash(),
+		Certificates: store.HashCertificates(certs),
+		Fingerprints: store.Fingerprints(certs),
+		Rules:        &wh,
+		Cascade:      cascade,
+		Applied:      time.Now(),
+	})
+}
 
-	fmt.Println("Whitelist completed successfully")
-	return nil
+// LoadWhitelist reads a whitelist file the way the whitelist command applies
+// it, with this host's variants and every policy merged in
+func LoadWhitelist(path string) (whitelist.Whitelist, error) {
+	return loadWhitelist(path, "")
+}
+
+// loadWhitelist reads the whitelist at whpath, or the built-in profile if given,
+// with every policy it defines applied
+func loadWhitelist(whpath, profile string) (whitelist.Whitelist, error) {
+	return loadPolicies(whpath, profile, nil)
+}
+
+// loadPolicies is loadWhitelist with only the named policies applied. The
+// variants selected by this host's labels are merged in first.
+func loadPolicies(whpath, profile string, policies []string) (whitelist.Whitelist, error) {
+	if whpath != "" && profile != "" {
+		return whitelist.Whitelist{}, errors.New("only one of -file or -profile can be given")
+	}
+	var wh whitelist.Whitelist
+	var err error
+	if profile != "" {
+		wh, err = whitelist.FromProfile(profile)
+	} else {
+		wh, err = whitelist.FromFile(whpath)
+	}
+	if err != nil {
+		return wh, err
+	}
+	return wh.ForLabels(whitelist.HostLabels()).ForPolicies(policies)
 }
@@ -0,0 +1,308 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+var (
+	// editPageSize is how many certificates the editor shows at once
+	editPageSize = 20
+
+	editHelp = "[#, #-#] toggle  /<text> search  n/p page  k/r keep/remove shown  w save  q quit"
+)
+
+// EditWhitelistForPlatform edits the whitelist at path against the
+// platform's certificates, see editWhitelist
+func EditWhitelistForPlatform(path string) error {
+	return editWhitelist(os.Stdin, os.Stdout, store.Platform(), path)
+}
+
+// EditWhitelistForApp edits the whitelist at path against an app's certificates
+func EditWhitelistForApp(app, path string) error {
+	s, err := store.ForApp(app)
+	if err != nil {
+		return err
+	}
+	return editWhitelist(os.Stdin, os.Stdout, s, path)
+}
+
+// whitelistEditor lists a store's certificates, showing which a whitelist
+// keeps, and toggles them by adding or removing their fingerprint
+type whitelistEditor struct {
+	in  *bufio.Reader
+	out io.Writer
+	tty bool
+
+	path     string
+	own      whitelist.Whitelist
+	extended whitelist.Whitelist
+
+	certs []*x509.Certificate
+	kept  []bool
+
+	// shown are the indexes of certs matching filter
+	filter string
+	shown  []int
+	page   int
+
+	dirty    bool
+	quitting bool
+	message  string
+}
+
+// editWhitelist runs the editor until it's quit. Only the whitelist's own
+// items are changed and written, whitelists it extends are left as-is.
+func editWhitelist(in io.Reader, out io.Writer, s store.Store, path string) error {
+	certs, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	err = warnPartial(err)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(certs, func(i, j int) bool {
+		return strings.ToLower(certutil.StringifyPKIXName(certs[i].Subject)) < strings.ToLower(certutil.StringifyPKIXName(certs[j].Subject))
+	})
+	own, extended, err := whitelist.ReadExtended(path)
+	if err != nil {
+		return err
+	}
+
+	e := &whitelistEditor{
+		in:       bufio.NewReader(in),
+		out:      out,
+		path:     path,
+		own:      own,
+		extended: extended,
+		certs:    certs,
+	}
+	if f, ok := in.(*os.File); ok {
+		e.tty = isTerminal(f)
+	}
+	if err := e.update(); err != nil {
+		return err
+	}
+	e.search("")
+	return e.run()
+}
+
+func (e *whitelistEditor) run() error {
+	for {
+		e.draw()
+		line, err := e.in.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		done, cmdErr := e.handle(strings.TrimSpace(line))
+		if cmdErr != nil {
+			return cmdErr
+		}
+		if done {
+			return nil
+		}
+		if err == io.EOF {
+			if e.dirty {
+				fmt.Fprintln(e.out, "Unsaved changes were discarded")
+			}
+			return nil
+		}
+	}
+}
+
+// update recomputes which certificates the whitelist keeps
+func (e *whitelistEditor) update() error {
+	wh, err := e.own.Extending(e.extended).ForLabels(whitelist.HostLabels()).ForPolicies(nil)
+	if err != nil {
+		return err
+	}
+	e.kept = wh.MatchEach(e.certs)
+	return nil
+}
+
+// search shows the certificates whose subject or fingerprint contains text
+func (e *whitelistEditor) search(text string) {
+	e.filter, e.page, e.shown = text, 0, nil
+	text = strings.ToLower(text)
+	for i := range e.certs {
+		name := strings.ToLower(certutil.StringifyPKIXName(e.certs[i].Subject))
+		if text == "" || strings.Contains(name, text) || strings.HasPrefix(certutil.GetHexSHA256Fingerprint(*e.certs[i]), text) {
+			e.shown = append(e.shown, i)
+		}
+	}
+}
+
+func (e *whitelistEditor) pages() int {
+	return (len(e.shown) + editPageSize - 1) / editPageSize
+}
+
+// handle runs a command, returning true when the editor should exit
+func (e *whitelistEditor) handle(line string) (bool, error) {
+	e.message = ""
+	if line == "q" {
+		if e.dirty && !e.quitting {
+			e.quitting = true
+			e.message = "There are unsaved changes, q again to discard them or w to save"
+			return false, nil
+		}
+		return true, nil
+	}
+	e.quitting = false
+
+	switch {
+	case line == "":
+	case line == "w":
+		if err := e.own.Save(e.path); err != nil {
+			return false, err
+		}
+		e.dirty = false
+		e.message = fmt.Sprintf("Wrote %s", e.path)
+	case line == "n":
+		if e.page+1 < e.pages() {
+			e.page++
+		}
+	case line == "p":
+		if e.page > 0 {
+			e.page--
+		}
+	case strings.HasPrefix(line, "/"):
+		e.search(strings.TrimSpace(line[1:]))
+	case line == "k" || line == "r":
+		for _, i := range e.shown {
+			if e.kept[i] != (line == "k") {
+				if err := e.toggle(i); err != nil {
+					return false, err
+				}
+			}
+		}
+	case line == "?" || line == "h":
+		e.message = editHelp
+	default:
+		rows, err := parseRows(line, len(e.shown))
+		if err != nil {
+			e.message = err.Error()
+			return false, nil
+		}
+		for _, r := range rows {
+			if err := e.toggle(e.shown[r]); err != nil {
+				return false, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// toggle keeps (or removes) a certificate by adding (or removing) its
+// fingerprint from the whitelist
+func (e *whitelistEditor) toggle(i int) error {
+	c := e.certs[i]
+	fp := certutil.GetHexSHA256Fingerprint(*c)
+	was := e.kept[i]
+	if was {
+		e.own.RemoveFingerprint(fp)
+	} else {
+		e.own.AddFingerprint(fp)
+	}
+	if err := e.update(); err != nil {
+		return err
+	}
+	e.dirty = true
+	if e.kept[i] == was {
+		name := certutil.StringifyPKIXName(c.Subject)
+		switch {
+		case !was:
+			e.message = fmt.Sprintf("%s is blacklisted, or excluded by country, and can't be kept", name)
+		default:
+			e.message = fmt.Sprintf("%s is kept by another item (e.g. its key, country or an extended whitelist)", name)
+		}
+	}
+	return nil
+}
+
+// parseRows reads the row numbers (1-based, e.g. "3", "3-7" or "1,4") of a
+// page with n rows as 0-based indexes
+func parseRows(line string, n int) ([]int, error) {
+	var out []int
+	for _, part := range strings.Split(line, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(part), "-", 2)
+		from, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return nil, fmt.Errorf("unknown command %q, %s", line, editHelp)
+		}
+		to := from
+		if len(bounds) == 2 {
+			if to, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil {
+				return nil, fmt.Errorf("unknown command %q, %s", line, editHelp)
+			}
+		}
+		if from < 1 || to > n || from > to {
+			return nil, fmt.Errorf("rows are numbered 1 to %d", n)
+		}
+		for r := from; r <= to; r++ {
+			out = append(out, r-1)
+		}
+	}
+	return out, nil
+}
+
+func (e *whitelistEditor) draw() {
+	if e.tty {
+		fmt.Fprint(e.out, "\033[H\033[2J") // clear the screen
+	}
+	count := 0
+	for i := range e.kept {
+		if e.kept[i] {
+			count++
+		}
+	}
+	changed := ""
+	if e.dirty {
+		changed = " (unsaved)"
+	}
+	fmt.Fprintf(e.out, "%s%s: keeps %d of %d certificates, %d would be removed\n", e.path, changed, count, len(e.certs), len(e.certs)-count)
+	if e.filter != "" {
+		fmt.Fprintf(e.out, "Showing %d matching %q\n", len(e.shown), e.filter)
+	}
+
+	start := e.page * editPageSize
+	for r := start; r < len(e.shown) && r < start+editPageSize; r++ {
+		i := e.shown[r]
+		mark := " "
+		if e.kept[i] {
+			mark = "x"
+		}
+		fmt.Fprintf(e.out, "%4d [%s] %s  %s  %s\n", r+1, mark, certutil.GetHexSHA256Fingerprint(*e.certs[i])[:16], timeutil.Date(e.certs[i].NotAfter), certutil.StringifyPKIXName(e.certs[i].Subject))
+	}
+	if pages := e.pages(); pages > 1 {
+		fmt.Fprintf(e.out, "Page %d of %d\n", e.page+1, pages)
+	}
+	if e.message != "" {
+		fmt.Fprintln(e.out, e.message)
+	}
+	fmt.Fprintf(e.out, "%s\n> ", editHelp)
+}
@@ -0,0 +1,116 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+func TestCmdWhitelist__edit(t *testing.T) {
+	var certs []*x509.Certificate
+	for _, name := range []string{"Charlie Root CA", "Alpha Root CA", "Bravo Root CA"} {
+		ca, err := testca.NewRoot(name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs = append(certs, ca.Certificate)
+	}
+	fp := func(i int) string { return certutil.GetHexSHA256Fingerprint(*certs[i]) }
+
+	dir, err := ioutil.TempDir("", "cert-manage-edit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "wh.json")
+	if err := ioutil.WriteFile(path, []byte(`{"Fingerprints": ["`+fp(0)+`"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	edit := func(input string) string {
+		var out bytes.Buffer
+		if err := editWhitelist(strings.NewReader(input), &out, store.MemoryStore(certs), path); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+
+	// rows are sorted by subject, Charlie starts out kept
+	out := edit("q\n")
+	if !strings.Contains(out, "keeps 1 of 3 certificates, 2 would be removed") {
+		t.Errorf("got %q", out)
+	}
+	if i, j := strings.Index(out, "Alpha"), strings.Index(out, "Charlie"); i < 0 || i > j {
+		t.Errorf("rows aren't sorted: %q", out)
+	}
+
+	// search for Bravo and keep it, remove Charlie (row 3) and save
+	out = edit("/bravo\n1\n/\n3\nw\nq\n")
+	if !strings.Contains(out, "Showing 1 matching \"bravo\"") || !strings.Contains(out, "keeps 2 of 3") || !strings.Contains(out, "Wrote "+path) {
+		t.Errorf("got %q", out)
+	}
+	wh, err := whitelist.FromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(wh.Fingerprints, []string{fp(2)}) {
+		t.Errorf("got %v", wh.Fingerprints)
+	}
+	if bs, _ := ioutil.ReadFile(path); !bytes.HasPrefix(bs, []byte("{")) {
+		t.Errorf("expected JSON, got %s", bs)
+	}
+
+	// quitting with unsaved changes asks first, and nothing is written
+	out = edit("k\nq\nq\n")
+	if !strings.Contains(out, "keeps 3 of 3") || !strings.Contains(out, "unsaved changes") {
+		t.Errorf("got %q", out)
+	}
+	if wh, _ = whitelist.FromFile(path); len(wh.Fingerprints) != 1 {
+		t.Errorf("got %v", wh.Fingerprints)
+	}
+
+	// certificates kept by other items can't be removed by fingerprint
+	wh = whitelist.Whitelist{Keys: []string{certutil.GetBase64SPKISHA256Fingerprint(*certs[1])}}
+	if err := wh.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if out = edit("1\n"); !strings.Contains(out, "is kept by another item") {
+		t.Errorf("got %q", out)
+	}
+}
+
+func TestCmdWhitelist__parseRows(t *testing.T) {
+	rows, err := parseRows("1, 3-4", 5)
+	if err != nil || !reflect.DeepEqual(rows, []int{0, 2, 3}) {
+		t.Errorf("got %v, err=%v", rows, err)
+	}
+	for _, bad := range []string{"0", "6", "4-2", "x", "1-y"} {
+		if _, err := parseRows(bad, 5); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
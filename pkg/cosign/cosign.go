@@ -0,0 +1,353 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cosign verifies artifacts signed with sigstore's cosign
+// (`cosign sign-blob`), either against a public key or keyless.
+//
+// Key based signatures are the base64 encoded signature cosign writes with
+// --output-signature, served next to the artifact as <url>.sig. Keyless
+// signatures are read from the bundle written with --bundle (<url>.bundle),
+// which holds the signature, the short lived Fulcio certificate it was made
+// with and the Rekor transparency log entry recording when it was made.
+package cosign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+var (
+	// oidIssuer and oidIssuerV2 hold the OIDC issuer which authenticated the
+	// signer of a Fulcio certificate, the first as a raw string and the
+	// second as a DER UTF8String
+	oidIssuer   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	oidIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+
+	// ErrNoSignature is returned when an artifact has no signature to verify
+	ErrNoSignature = errors.New("cosign: no signature found")
+)
+
+// Policy is who artifacts must be signed by. Key is a PEM encoded public key
+// for key based signatures, otherwise signatures are verified keyless: the
+// Fulcio certificate must chain to Roots, be issued to Identity (an email
+// or URI) after authenticating with Issuer, and be logged in Rekor (whose
+// public key is RekorKey) while it was valid.
+type Policy struct {
+	Key string
+
+	Identity string
+	Issuer   string
+	Roots    string
+	RekorKey string
+}
+
+// Empty is true when nothing needs to be verified
+func (p Policy) Empty() bool {
+	return p.Key == "" && p.Identity == "" && p.Issuer == "" && p.Roots == "" && p.RekorKey == ""
+}
+
+// Keyless is true when signatures are verified against Fulcio certificates
+func (p Policy) Keyless() bool {
+	return !p.Empty() && p.Key == ""
+}
+
+// check returns an error when a keyless policy is missing what's needed
+func (p Policy) check() error {
+	if !p.Keyless() {
+		return nil
+	}
+	var missing []string
+	if p.Identity == "" {
+		missing = append(missing, "identity")
+	}
+	if p.Issuer == "" {
+		missing = append(missing, "issuer")
+	}
+	if p.Roots == "" {
+		missing = append(missing, "roots")
+	}
+	if p.RekorKey == "" {
+		missing = append(missing, "rekor key")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("cosign: keyless verification needs a public key, or the %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Bundle is what `cosign sign-blob --bundle` writes
+type Bundle struct {
+	Base64Signature string       `json:"base64Signature"`
+	Cert            string       `json:"cert,omitempty"`
+	RekorBundle     *RekorBundle `json:"rekorBundle,omitempty"`
+}
+
+// RekorBundle is a Rekor log entry and the log's signature over it, the
+// signed entry timestamp (SET)
+type RekorBundle struct {
+	SignedEntryTimestamp string       `json:"SignedEntryTimestamp"`
+	Payload              RekorPayload `json:"Payload"`
+}
+
+// RekorPayload is a Rekor log entry. Fields are in the order of Rekor's
+// canonical JSON, which the SET is computed over.
+type RekorPayload struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+}
+
+// hashedRekord is the body of a Rekor entry for a signed blob
+type hashedRekord struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		Data struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+		Signature struct {
+			Content string `json:"content"`
+		} `json:"signature"`
+	} `json:"spec"`
+}
+
+// Verify checks sig, a base64 signature or a bundle, is a valid signature
+// of artifact under the policy. Keyless policies need a bundle.
+func (p Policy) Verify(artifact, sig []byte) error {
+	if p.Empty() {
+		return nil
+	}
+	if err := p.check(); err != nil {
+		return err
+	}
+	sig = bytes.TrimSpace(sig)
+	if len(sig) == 0 {
+		return ErrNoSignature
+	}
+
+	var bundle *Bundle
+	if sig[0] == '{' {
+		bundle = &Bundle{}
+		if err := json.Unmarshal(sig, bundle); err != nil {
+			return fmt.Errorf("cosign: reading bundle: %v", err)
+		}
+		sig = []byte(bundle.Base64Signature)
+	}
+	raw, err := base64.StdEncoding.DecodeString(string(sig))
+	if err != nil {
+		return fmt.Errorf("cosign: reading signature: %v", err)
+	}
+
+	if !p.Keyless() {
+		pub, err := readPublicKey(p.Key)
+		if err != nil {
+			return err
+		}
+		return verifySignature(pub, artifact, raw)
+	}
+	if bundle == nil {
+		return errors.New("cosign: keyless verification needs a bundle (cosign sign-blob --bundle)")
+	}
+	return p.verifyKeyless(artifact, raw, bundle)
+}
+
+func (p Policy) verifyKeyless(artifact, sig []byte, bundle *Bundle) error {
+	if bundle.Cert == "" {
+		return errors.New("cosign: bundle has no certificate")
+	}
+	if bundle.RekorBundle == nil {
+		return errors.New("cosign: bundle has no transparency log entry")
+	}
+	certPEM, err := base64.StdEncoding.DecodeString(bundle.Cert)
+	if err != nil {
+		return fmt.Errorf("cosign: reading certificate: %v", err)
+	}
+	certs, err := certutil.ParsePEM(certPEM)
+	if err != nil || len(certs) == 0 {
+		return fmt.Errorf("cosign: reading certificate: %v", err)
+	}
+	leaf := certs[0]
+
+	// The log entry proves when the signature was made, the certificate is
+	// only valid for a few minutes around then.
+	rekorKey, err := readPublicKey(p.RekorKey)
+	if err != nil {
+		return err
+	}
+	if err := verifyRekorBundle(rekorKey, bundle, artifact); err != nil {
+		return err
+	}
+	signed := time.Unix(bundle.RekorBundle.Payload.IntegratedTime, 0)
+
+	roots, err := certutil.FromFile(p.Roots)
+	if err != nil {
+		return fmt.Errorf("cosign: reading roots: %v", err)
+	}
+	opts := x509.VerifyOptions{
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   signed,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	for i := range roots {
+		if bytes.Equal(roots[i].RawIssuer, roots[i].RawSubject) {
+			opts.Roots.AddCert(roots[i])
+		} else {
+			opts.Intermediates.AddCert(roots[i])
+		}
+	}
+	for i := range certs[1:] {
+		opts.Intermediates.AddCert(certs[1+i])
+	}
+	if _, err := leaf.Verify(opts); err != nil {
+		return fmt.Errorf("cosign: certificate isn't trusted: %v", err)
+	}
+
+	if !hasIdentity(leaf, p.Identity) {
+		return fmt.Errorf("cosign: signed by %s, expected %s", strings.Join(identities(leaf), ", "), p.Identity)
+	}
+	if issuer := certIssuer(leaf); issuer != p.Issuer {
+		return fmt.Errorf("cosign: signer authenticated with %q, expected %q", issuer, p.Issuer)
+	}
+	return verifySignature(leaf.PublicKey, artifact, sig)
+}
+
+// verifyRekorBundle checks Rekor signed the log entry and that it records
+// this signature of artifact
+func verifyRekorBundle(key crypto.PublicKey, bundle *Bundle, artifact []byte) error {
+	rb := bundle.RekorBundle
+	canonical, err := json.Marshal(rb.Payload)
+	if err != nil {
+		return err
+	}
+	set, err := base64.StdEncoding.DecodeString(rb.SignedEntryTimestamp)
+	if err != nil {
+		return fmt.Errorf("cosign: reading signed entry timestamp: %v", err)
+	}
+	if err := verifySignature(key, canonical, set); err != nil {
+		return fmt.Errorf("cosign: transparency log entry isn't signed by Rekor: %v", err)
+	}
+
+	body, err := base64.StdEncoding.DecodeString(rb.Payload.Body)
+	if err != nil {
+		return fmt.Errorf("cosign: reading transparency log entry: %v", err)
+	}
+	var entry hashedRekord
+	if err := json.Unmarshal(body, &entry); err != nil {
+		return fmt.Errorf("cosign: reading transparency log entry: %v", err)
+	}
+	sum := sha256.Sum256(artifact)
+	if !strings.EqualFold(entry.Spec.Data.Hash.Value, hex.EncodeToString(sum[:])) {
+		return errors.New("cosign: transparency log entry is for another artifact")
+	}
+	if entry.Spec.Signature.Content != bundle.Base64Signature {
+		return errors.New("cosign: transparency log entry is for another signature")
+	}
+	return nil
+}
+
+// verifySignature checks sig is the signature of data's SHA256 by pub
+func verifySignature(pub crypto.PublicKey, data, sig []byte) error {
+	sum := sha256.Sum256(data)
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		var es struct {
+			R, S *big.Int
+		}
+		if rest, err := asn1.Unmarshal(sig, &es); err != nil || len(rest) > 0 {
+			return errors.New("cosign: invalid signature")
+		}
+		if !ecdsa.Verify(k, sum[:], es.R, es.S) {
+			return errors.New("cosign: invalid signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig); err != nil {
+			return errors.New("cosign: invalid signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("cosign: unsupported public key %T", pub)
+}
+
+// readPublicKey reads a PEM encoded public key, as written by
+// `cosign generate-key-pair` (cosign.pub)
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cosign: reading public key: %v", err)
+	}
+	block, _ := pem.Decode(bs)
+	if block == nil {
+		return nil, fmt.Errorf("cosign: no PEM public key found in %s", path)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cosign: reading public key: %v", err)
+	}
+	return pub, nil
+}
+
+func identities(cert *x509.Certificate) []string {
+	out := append([]string(nil), cert.EmailAddresses...)
+	for i := range cert.URIs {
+		out = append(out, cert.URIs[i].String())
+	}
+	return out
+}
+
+func hasIdentity(cert *x509.Certificate, identity string) bool {
+	for _, id := range identities(cert) {
+		if id == identity {
+			return true
+		}
+	}
+	return false
+}
+
+// certIssuer returns the OIDC issuer recorded in a Fulcio certificate
+func certIssuer(cert *x509.Certificate) string {
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidIssuerV2):
+			var s string
+			if _, err := asn1.UnmarshalWithParams(ext.Value, &s, "utf8"); err == nil {
+				return s
+			}
+		case ext.Id.Equal(oidIssuer):
+			return string(ext.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,302 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cosign
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var artifact = []byte("fingerprints:\n- 05a6db389391df92e0be93fdfa4db1e3cf53903918b8d9d85a9c396cb55df030\n")
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, data []byte) string {
+	sum := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, key, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+func writePublicKey(t *testing.T, dir, name string, key *ecdsa.PrivateKey) string {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCosign__key(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-cosign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := newKey(t)
+	p := Policy{Key: writePublicKey(t, dir, "cosign.pub", key)}
+	sig := sign(t, key, artifact)
+
+	if err := p.Verify(artifact, []byte(sig+"\n")); err != nil {
+		t.Errorf("signature: %v", err)
+	}
+	bundle, _ := json.Marshal(Bundle{Base64Signature: sig})
+	if err := p.Verify(artifact, bundle); err != nil {
+		t.Errorf("bundle: %v", err)
+	}
+
+	if err := p.Verify([]byte("other"), []byte(sig)); err == nil {
+		t.Error("expected error for another artifact")
+	}
+	if err := p.Verify(artifact, []byte(sign(t, newKey(t), artifact))); err == nil {
+		t.Error("expected error for another key")
+	}
+	if err := p.Verify(artifact, nil); err != ErrNoSignature {
+		t.Errorf("got %v", err)
+	}
+	if err := (Policy{}).Verify(artifact, nil); err != nil {
+		t.Errorf("empty policy: %v", err)
+	}
+}
+
+type keyless struct {
+	roots    string
+	rekorKey string
+	rekor    *ecdsa.PrivateKey
+	leafKey  *ecdsa.PrivateKey
+	certPEM  []byte
+	issued   time.Time
+}
+
+// newKeyless creates a Fulcio like root and a certificate issued to
+// someone@example.com, the certificate is valid for ten minutes in 2020
+func newKeyless(t *testing.T, dir string) *keyless {
+	issued := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	rootKey := newKey(t)
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sigstore", Organization: []string{"sigstore.dev"}},
+		NotBefore:             issued.AddDate(-1, 0, 0),
+		NotAfter:              issued.AddDate(10, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTmpl, rootTmpl, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := x509.ParseCertificate(rootDER)
+
+	issuer, _ := asn1.MarshalWithParams("https://accounts.example.com", "utf8")
+	leafKey := newKey(t)
+	leafTmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		NotBefore:       issued,
+		NotAfter:        issued.Add(10 * time.Minute),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		EmailAddresses:  []string{"someone@example.com"},
+		ExtraExtensions: []pkix.Extension{{Id: oidIssuerV2, Value: issuer}},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTmpl, root, &leafKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := filepath.Join(dir, "fulcio.pem")
+	if err := ioutil.WriteFile(roots, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rekor := newKey(t)
+	return &keyless{
+		roots:    roots,
+		rekorKey: writePublicKey(t, dir, "rekor.pub", rekor),
+		rekor:    rekor,
+		leafKey:  leafKey,
+		certPEM:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}),
+		issued:   issued,
+	}
+}
+
+func (k *keyless) policy() Policy {
+	return Policy{
+		Identity: "someone@example.com",
+		Issuer:   "https://accounts.example.com",
+		Roots:    k.roots,
+		RekorKey: k.rekorKey,
+	}
+}
+
+// bundle signs data and logs the signature at integrated
+func (k *keyless) bundle(t *testing.T, data []byte, integrated time.Time) []byte {
+	sig := sign(t, k.leafKey, data)
+	sum := sha256.Sum256(data)
+	body := fmt.Sprintf(`{"apiVersion":"0.0.1","kind":"hashedrekord","spec":{"data":{"hash":{"algorithm":"sha256","value":"%s"}},"signature":{"content":"%s"}}}`, hex.EncodeToString(sum[:]), sig)
+	payload := RekorPayload{
+		Body:           base64.StdEncoding.EncodeToString([]byte(body)),
+		IntegratedTime: integrated.Unix(),
+		LogID:          "c0d23d6ad406973f9559f3ba2d1ca01f84147d8ffc5b8445c224f98b9591801d",
+		LogIndex:       42,
+	}
+	canonical, _ := json.Marshal(payload)
+	bs, err := json.Marshal(Bundle{
+		Base64Signature: sig,
+		Cert:            base64.StdEncoding.EncodeToString(k.certPEM),
+		RekorBundle: &RekorBundle{
+			SignedEntryTimestamp: sign(t, k.rekor, canonical),
+			Payload:              payload,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bs
+}
+
+func TestCosign__keyless(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-cosign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	k := newKeyless(t, dir)
+	p := k.policy()
+
+	bundle := k.bundle(t, artifact, k.issued.Add(time.Minute))
+	if err := p.Verify(artifact, bundle); err != nil {
+		t.Fatal(err)
+	}
+
+	// someone else, or another issuer
+	other := p
+	other.Identity = "attacker@example.com"
+	if err := other.Verify(artifact, bundle); err == nil || !strings.Contains(err.Error(), "someone@example.com") {
+		t.Errorf("got %v", err)
+	}
+	other = p
+	other.Issuer = "https://token.actions.githubusercontent.com"
+	if err := other.Verify(artifact, bundle); err == nil {
+		t.Error("expected error for another issuer")
+	}
+
+	// logged after the certificate expired
+	if err := p.Verify(artifact, k.bundle(t, artifact, k.issued.Add(time.Hour))); err == nil {
+		t.Error("expected error for an expired certificate")
+	}
+
+	// the log entry is for another artifact
+	if err := p.Verify([]byte("other"), bundle); err == nil {
+		t.Error("expected error for another artifact")
+	}
+
+	// the entry wasn't signed by Rekor
+	var b Bundle
+	json.Unmarshal(bundle, &b)
+	b.RekorBundle.Payload.IntegratedTime++
+	tampered, _ := json.Marshal(b)
+	if err := p.Verify(artifact, tampered); err == nil {
+		t.Error("expected error for a tampered log entry")
+	}
+
+	// keyless signatures need a bundle and everything to check it with
+	if err := p.Verify(artifact, []byte(b.Base64Signature)); err == nil {
+		t.Error("expected error without a bundle")
+	}
+	other = p
+	other.RekorKey = ""
+	if err := other.Verify(artifact, bundle); err == nil || !strings.Contains(err.Error(), "rekor key") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestCosign__verifyDownload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-cosign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := newKey(t)
+	files := map[string]string{
+		"/whitelist.yaml":     string(artifact),
+		"/whitelist.yaml.sig": sign(t, key, artifact),
+		"/unsigned.yaml":      string(artifact),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	orig := Required
+	defer func() { Required = orig }()
+
+	Required = Policy{}
+	if err := VerifyDownload(srv.URL+"/unsigned.yaml", artifact); err != nil {
+		t.Errorf("nothing required: %v", err)
+	}
+
+	Required = Policy{Key: writePublicKey(t, dir, "cosign.pub", key)}
+	if err := VerifyDownload(srv.URL+"/whitelist.yaml?ref=main", artifact); err != nil {
+		t.Error(err)
+	}
+	if err := VerifyDownload(srv.URL+"/whitelist.yaml", []byte("changed")); err == nil {
+		t.Error("expected error for a changed whitelist")
+	}
+	err = VerifyDownload(srv.URL+"/unsigned.yaml", artifact)
+	if err == nil || !strings.Contains(err.Error(), "unsigned.yaml.sig or ") {
+		t.Errorf("got %v", err)
+	}
+}
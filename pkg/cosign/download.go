@@ -0,0 +1,105 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cosign
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/httputil"
+)
+
+var (
+	// Required is the policy downloaded whitelists and certificate bundles
+	// are verified with, set from the -cosign-* flags. Downloads aren't
+	// verified when it's empty.
+	Required Policy
+
+	maxSignatureSize int64 = 1024 * 1024 // bytes
+
+	errNotFound = errors.New("not found")
+)
+
+// VerifyDownload checks the signature of an artifact downloaded from u
+// against Required. The signature is read from <u>.sig or <u>.bundle,
+// keyless signatures need the bundle.
+func VerifyDownload(u string, artifact []byte) error {
+	if Required.Empty() {
+		return nil
+	}
+	if err := Required.check(); err != nil {
+		return err
+	}
+	suffixes := []string{".sig", ".bundle"}
+	if Required.Keyless() {
+		suffixes = []string{".bundle"}
+	}
+	var tried []string
+	for _, suffix := range suffixes {
+		where, err := signatureURL(u, suffix)
+		if err != nil {
+			return err
+		}
+		tried = append(tried, where)
+		sig, err := download(where)
+		if err == errNotFound {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("cosign: %v", err)
+		}
+		if err := Required.Verify(artifact, sig); err != nil {
+			return fmt.Errorf("%s: %v", u, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s: %v at %s", u, ErrNoSignature, strings.Join(tried, " or "))
+}
+
+// signatureURL returns where cosign's signature of u is served, the path
+// of u with suffix added
+func signatureURL(u, suffix string) (string, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	parsed.Path += suffix
+	return parsed.String(), nil
+}
+
+func download(u string) ([]byte, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Close = true
+	resp, err := httputil.New().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return ioutil.ReadAll(io.LimitReader(resp.Body, maxSignatureSize))
+	case http.StatusNotFound:
+		return nil, errNotFound
+	}
+	return nil, fmt.Errorf("GET %s returned %s", u, resp.Status)
+}
@@ -0,0 +1,170 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crlset reads Chrome's CRLSet, the list of blocked keys and revoked
+// certificates Chrome's component updater pushes outside of OS updates.
+//
+// Docs:
+//  - https://dev.chromium.org/Home/chromium-security/crlsets
+//  - https://github.com/agl/crlset-tools
+package crlset
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// CRLSet is a parsed Chrome CRLSet
+type CRLSet struct {
+	// Sequence increases with each CRLSet Google publishes
+	Sequence int
+
+	// NotAfter is when Chrome stops using the CRLSet, zero if unset
+	NotAfter time.Time
+
+	// blocked holds the base64 SHA256 hashes of SPKIs Chrome refuses to
+	// trust in any position of a chain
+	blocked map[string]bool
+
+	// revoked holds serials (hex, leading zeros dropped) keyed by the
+	// base64 SHA256 hash of the issuer's SPKI
+	revoked map[string]map[string]bool
+}
+
+// header is the JSON which starts a CRLSet, only the fields we read are included
+type header struct {
+	ContentType  string
+	Sequence     int
+	NumParents   int
+	BlockedSPKIs []string
+	NotAfter     int64
+}
+
+// Load reads a CRLSet from disk
+func Load(path string) (*CRLSet, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(bs)
+}
+
+// Parse reads a CRLSet, which is a little-endian uint16 length followed by a
+// JSON header. After the header is each parent (issuer), stored as the
+// SHA256 hash of its SPKI, a uint32 count of revoked serials and then each
+// serial prefixed by its uint8 length.
+func Parse(bs []byte) (*CRLSet, error) {
+	if len(bs) < 2 {
+		return nil, errors.New("crlset: too short")
+	}
+	n := int(binary.LittleEndian.Uint16(bs))
+	bs = bs[2:]
+	if len(bs) < n {
+		return nil, errors.New("crlset: truncated header")
+	}
+	var h header
+	if err := json.Unmarshal(bs[:n], &h); err != nil {
+		return nil, fmt.Errorf("crlset: invalid header: %v", err)
+	}
+	if h.ContentType != "" && h.ContentType != "CRLSet" {
+		return nil, fmt.Errorf("crlset: unexpected content type %q", h.ContentType)
+	}
+	bs = bs[n:]
+
+	set := &CRLSet{
+		Sequence: h.Sequence,
+		blocked:  make(map[string]bool),
+		revoked:  make(map[string]map[string]bool),
+	}
+	if h.NotAfter > 0 {
+		set.NotAfter = time.Unix(h.NotAfter, 0)
+	}
+	for i := range h.BlockedSPKIs {
+		set.blocked[h.BlockedSPKIs[i]] = true
+	}
+
+	for len(bs) > 0 {
+		if len(bs) < sha256.Size+4 {
+			return nil, errors.New("crlset: truncated parent")
+		}
+		parent := base64.StdEncoding.EncodeToString(bs[:sha256.Size])
+		count := binary.LittleEndian.Uint32(bs[sha256.Size:])
+		bs = bs[sha256.Size+4:]
+
+		serials := make(map[string]bool)
+		for j := uint32(0); j < count; j++ {
+			if len(bs) < 1 || len(bs) < 1+int(bs[0]) {
+				return nil, errors.New("crlset: truncated serial")
+			}
+			serials[serialKey(bs[1:1+int(bs[0])])] = true
+			bs = bs[1+int(bs[0]):]
+		}
+		set.revoked[parent] = serials
+	}
+	if h.NumParents > 0 && len(set.revoked) != h.NumParents {
+		return nil, fmt.Errorf("crlset: expected %d parents, found %d", h.NumParents, len(set.revoked))
+	}
+	return set, nil
+}
+
+// Expired returns true if Chrome would no longer use the CRLSet at `now`
+func (s *CRLSet) Expired(now time.Time) bool {
+	return !s.NotAfter.IsZero() && now.After(s.NotAfter)
+}
+
+// Blocked returns true if c's public key is blocked
+func (s *CRLSet) Blocked(c *x509.Certificate) bool {
+	return s.blocked[spkiHash(c)]
+}
+
+// Revoked returns true if c is revoked by its issuer
+func (s *CRLSet) Revoked(c, issuer *x509.Certificate) bool {
+	if c.SerialNumber == nil || issuer == nil {
+		return false
+	}
+	serials, ok := s.revoked[spkiHash(issuer)]
+	if !ok {
+		return false
+	}
+	return serials[serialKey(c.SerialNumber.Bytes())]
+}
+
+// Len returns how many keys are blocked and serials revoked
+func (s *CRLSet) Len() int {
+	n := len(s.blocked)
+	for _, serials := range s.revoked {
+		n += len(serials)
+	}
+	return n
+}
+
+func spkiHash(c *x509.Certificate) string {
+	sum := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// serialKey drops leading zeros, which DER encoding adds to keep a serial
+// positive but big.Int.Bytes() doesn't return.
+func serialKey(bs []byte) string {
+	return hex.EncodeToString(bytes.TrimLeft(bs, "\x00"))
+}
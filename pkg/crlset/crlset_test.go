@@ -0,0 +1,206 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crlset
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+)
+
+// encode writes a CRLSet blocking `blocked` and revoking the serials of
+// `revoked` under their issuer.
+func encode(t *testing.T, blocked []*x509.Certificate, issuer *x509.Certificate, revoked []*x509.Certificate) []byte {
+	t.Helper()
+	h := header{
+		ContentType: "CRLSet",
+		Sequence:    42,
+		NotAfter:    time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC).Unix(),
+	}
+	for i := range blocked {
+		h.BlockedSPKIs = append(h.BlockedSPKIs, spkiHash(blocked[i]))
+	}
+	if issuer != nil {
+		h.NumParents = 1
+	}
+	js, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint16(len(js)))
+	buf.Write(js)
+	if issuer != nil {
+		sum := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+		buf.Write(sum[:])
+		binary.Write(&buf, binary.LittleEndian, uint32(len(revoked)))
+		for i := range revoked {
+			// DER keeps serials positive with a leading zero
+			serial := append([]byte{0}, revoked[i].SerialNumber.Bytes()...)
+			buf.WriteByte(byte(len(serial)))
+			buf.Write(serial)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestCRLSet__Parse(t *testing.T) {
+	h, err := testca.NewHierarchy("example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, inter := h.Root.Certificate, h.Intermediate.Certificate
+	other, err := testca.NewRoot("Other Root", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := Parse(encode(t, []*x509.Certificate{other.Certificate}, root, []*x509.Certificate{inter}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Sequence != 42 || set.Len() != 2 {
+		t.Errorf("sequence=%d len=%d", set.Sequence, set.Len())
+	}
+	if set.Expired(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("shouldn't be expired")
+	}
+	if !set.Expired(time.Date(2031, time.January, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("expected to be expired")
+	}
+
+	if !set.Blocked(other.Certificate) || set.Blocked(root) {
+		t.Error("unexpected blocked keys")
+	}
+	if !set.Revoked(inter, root) {
+		t.Error("expected intermediate to be revoked")
+	}
+	if set.Revoked(root, root) || set.Revoked(inter, other.Certificate) || set.Revoked(inter, nil) {
+		t.Error("unexpected revocation")
+	}
+
+	// truncated
+	bs := encode(t, nil, root, []*x509.Certificate{inter})
+	if _, err := Parse(bs[:len(bs)-2]); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := Parse([]byte{0xff}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestCRLSet__find(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crlset-find")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	chrome, chromium := filepath.Join(dir, "chrome"), filepath.Join(dir, "chromium")
+	if where := find([]string{chrome, chromium}); where != "" {
+		t.Errorf("found %s", where)
+	}
+	for _, v := range []string{"5000", "6000", "10"} {
+		where := filepath.Join(chromium, "CertificateRevocation", v)
+		if err := os.MkdirAll(where, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(where, "crl-set"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a newer version which hasn't been written yet
+	os.MkdirAll(filepath.Join(chromium, "CertificateRevocation", "7000"), 0755)
+
+	where := find([]string{chrome, chromium})
+	if expected := filepath.Join(chromium, "CertificateRevocation", "6000", "crl-set"); where != expected {
+		t.Errorf("got %s, expected %s", where, expected)
+	}
+}
+
+func TestCRLSet__Download(t *testing.T) {
+	h, err := testca.NewHierarchy("example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl := encode(t, []*x509.Certificate{h.Intermediate.Certificate}, nil, nil)
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	w, err := zw.Create("crl-set")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(crl)
+	zw.Close()
+
+	// CRX3 with an (unread) 4 byte header
+	var crx bytes.Buffer
+	crx.WriteString("Cr24")
+	binary.Write(&crx, binary.LittleEndian, uint32(3))
+	binary.Write(&crx, binary.LittleEndian, uint32(4))
+	crx.WriteString("head")
+	crx.Write(archive.Bytes())
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/update":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><gupdate protocol="2.0"><app appid="hfnkpimlhhgieaddgfemjhofmfblmnib" status="ok"><updatecheck codebase="%s/redirect" status="ok" version="6000"/></app></gupdate>`, srv.URL)
+		case "/redirect":
+			http.Redirect(w, r, "/crx", http.StatusFound)
+		case "/crx":
+			w.Write(crx.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	orig := UpdateURL
+	UpdateURL = srv.URL + "/update"
+	defer func() { UpdateURL = orig }()
+
+	set, err := Download()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !set.Blocked(h.Intermediate.Certificate) {
+		t.Error("expected intermediate to be blocked")
+	}
+}
+
+func TestCRLSet__extractCRX(t *testing.T) {
+	if _, err := extractCRX([]byte("PK\x03\x04")); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := extractCRX([]byte("Cr24\x02\x00\x00\x00\xff\x00\x00\x00\x00\x00\x00\x00")); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crlset
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/adamdecaf/cert-manage/pkg/httputil"
+	"github.com/adamdecaf/cert-manage/pkg/progress"
+)
+
+var (
+	// UpdateURL is the component updater check for the CRLSet extension
+	// (hfnkpimlhhgieaddgfemjhofmfblmnib), which returns where the latest
+	// CRX is served from.
+	UpdateURL = "https://clients2.google.com/service/update2/crx?x=id%3Dhfnkpimlhhgieaddgfemjhofmfblmnib%26v%3D%26uc&acceptformat=crx2,crx3"
+
+	maxDownloadSize int64 = 10 * 1024 * 1024 // bytes
+)
+
+// updateResponse is the component updater's reply, only the fields we
+// read are included.
+type updateResponse struct {
+	Apps []struct {
+		UpdateCheck struct {
+			Status   string `xml:"status,attr"`
+			Codebase string `xml:"codebase,attr"`
+			Version  string `xml:"version,attr"`
+		} `xml:"updatecheck"`
+	} `xml:"app"`
+}
+
+// Download fetches and parses the current CRLSet from Google
+func Download() (*CRLSet, error) {
+	bs, err := get(UpdateURL)
+	if err != nil {
+		return nil, err
+	}
+	var resp updateResponse
+	if err := xml.Unmarshal(bs, &resp); err != nil {
+		return nil, fmt.Errorf("crlset: invalid update response: %v", err)
+	}
+	if len(resp.Apps) == 0 || resp.Apps[0].UpdateCheck.Codebase == "" {
+		return nil, errors.New("crlset: no CRLSet offered by the component updater")
+	}
+
+	crx, err := get(resp.Apps[0].UpdateCheck.Codebase)
+	if err != nil {
+		return nil, err
+	}
+	bs, err = extractCRX(crx)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(bs)
+}
+
+func get(u string) ([]byte, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	// The CRX is served through redirects, which httputil.Client doesn't follow
+	client := *httputil.New()
+	client.CheckRedirect = nil
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %s", u, resp.Status)
+	}
+
+	bar := progress.NewBytes("Downloading CRLSet", resp.ContentLength)
+	defer bar.Done()
+	return ioutil.ReadAll(progress.Reader(io.LimitReader(resp.Body, maxDownloadSize), bar))
+}
+
+// extractCRX returns the crl-set file from a CRX, which is a zip archive
+// after a "Cr24" header. Version 2 headers hold a public key and signature,
+// version 3 headers a protobuf, neither of which we read.
+func extractCRX(bs []byte) ([]byte, error) {
+	if len(bs) < 12 || string(bs[:4]) != "Cr24" {
+		return nil, errors.New("crlset: not a CRX file")
+	}
+	var skip int
+	switch v := binary.LittleEndian.Uint32(bs[4:]); v {
+	case 2:
+		if len(bs) < 16 {
+			return nil, errors.New("crlset: truncated CRX header")
+		}
+		skip = 16 + int(binary.LittleEndian.Uint32(bs[8:])) + int(binary.LittleEndian.Uint32(bs[12:]))
+	case 3:
+		skip = 12 + int(binary.LittleEndian.Uint32(bs[8:]))
+	default:
+		return nil, fmt.Errorf("crlset: unsupported CRX version %d", v)
+	}
+	if skip > len(bs) {
+		return nil, errors.New("crlset: truncated CRX header")
+	}
+
+	archive := bs[skip:]
+	r, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, fmt.Errorf("crlset: invalid CRX archive: %v", err)
+	}
+	for _, f := range r.File {
+		if f.Name != "crl-set" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return ioutil.ReadAll(io.LimitReader(rc, maxDownloadSize))
+	}
+	return nil, errors.New("crlset: no crl-set in CRX")
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crlset
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"github.com/adamdecaf/cert-manage/pkg/file"
+)
+
+// Find returns the path of the CRLSet Chrome (or Chromium) last downloaded,
+// or an empty string if neither is installed.
+func Find() string {
+	return find(userDataDirs())
+}
+
+// userDataDirs returns Chrome and Chromium's user data directories
+func userDataDirs() []string {
+	home := file.HomeDir()
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{
+			filepath.Join(home, "Library/Application Support/Google/Chrome"),
+			filepath.Join(home, "Library/Application Support/Chromium"),
+		}
+	case "windows":
+		local := os.Getenv("LOCALAPPDATA")
+		if local == "" {
+			local = filepath.Join(home, "AppData", "Local")
+		}
+		return []string{
+			filepath.Join(local, "Google", "Chrome", "User Data"),
+			filepath.Join(local, "Chromium", "User Data"),
+		}
+	}
+	return []string{
+		filepath.Join(home, ".config/google-chrome"),
+		filepath.Join(home, ".config/chromium"),
+	}
+}
+
+// find looks for CertificateRevocation/<version>/crl-set in each directory,
+// returning the highest version found in the first directory having one.
+func find(dirs []string) string {
+	for i := range dirs {
+		fis, err := ioutil.ReadDir(filepath.Join(dirs[i], "CertificateRevocation"))
+		if err != nil {
+			continue
+		}
+		best, found := -1, ""
+		for j := range fis {
+			v, err := strconv.Atoi(fis[j].Name())
+			if err != nil || !fis[j].IsDir() || v <= best {
+				continue
+			}
+			where := filepath.Join(dirs[i], "CertificateRevocation", fis[j].Name(), "crl-set")
+			if file.Exists(where) {
+				best, found = v, where
+			}
+		}
+		if found != "" {
+			return found
+		}
+	}
+	return ""
+}
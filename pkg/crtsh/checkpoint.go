@@ -0,0 +1,72 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crtsh
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/file"
+)
+
+// checkpoint is what's been looked up in a run against a CT server. Counts
+// are only reused for the same server and the same day of `since`.
+type checkpoint struct {
+	URL    string         `json:"url"`
+	Since  string         `json:"since"`
+	Counts map[string]int `json:"counts"`
+}
+
+func readCheckpoint(path, u string, since time.Time) *checkpoint {
+	cp := &checkpoint{
+		URL:    u,
+		Since:  since.UTC().Format("2006-01-02"),
+		Counts: make(map[string]int),
+	}
+	if path == "" {
+		return cp
+	}
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cp
+	}
+	var saved checkpoint
+	if err := json.Unmarshal(bs, &saved); err != nil || saved.URL != cp.URL || saved.Since != cp.Since {
+		return cp
+	}
+	for k, v := range saved.Counts {
+		cp.Counts[k] = v
+	}
+	return cp
+}
+
+// write saves the checkpoint, replacing the file so a partial write can't
+// be read back
+func (cp *checkpoint) write(path string) error {
+	if path == "" {
+		return nil
+	}
+	bs, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, bs, file.TempFilePermissions); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
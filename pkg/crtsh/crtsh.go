@@ -0,0 +1,250 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crtsh looks up how many certificates a root has issued, using
+// crt.sh or a local Certificate Transparency mirror serving the same API.
+package crtsh
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/httputil"
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
+	"github.com/adamdecaf/cert-manage/pkg/progress"
+)
+
+var (
+	// URL is the crt.sh instance queried, a local mirror can be used instead
+	URL = "https://crt.sh/"
+
+	// timeLayout is how crt.sh formats not_before
+	timeLayout = "2006-01-02T15:04:05"
+
+	maxResponseSize int64 = 100 * 1024 * 1024 // bytes
+
+	// Interval is the least time between requests to each CT server, crt.sh
+	// is a shared service so lookups are spaced out
+	Interval = time.Second
+
+	// Checkpoint is a file where each root's count is saved as it's looked
+	// up, so an interrupted run resumes where it stopped. Empty disables it.
+	Checkpoint = ""
+
+	// maxRetries is how often a request is retried when the server asks us
+	// to slow down, maxBackoff caps how long we wait each time
+	maxRetries = 3
+	maxBackoff = time.Minute
+
+	limiters   = make(map[string]*limiter)
+	limitersMu sync.Mutex
+
+	debug = os.Getenv("DEBUG") != ""
+)
+
+// entry is a certificate returned by crt.sh with output=json, only the
+// fields we read are included.
+type entry struct {
+	IssuerCAID int    `json:"issuer_ca_id"`
+	NotBefore  string `json:"not_before"`
+}
+
+// Issuance returns how many unexpired certificates each of certs directly
+// issued after `since`, keyed by the SHA256 fingerprint of the issuer.
+//
+// Roots which can't be found in the CT logs are left out of the result. An
+// error is only returned if no lookup succeeded.
+func Issuance(certs []*x509.Certificate, since time.Time) (map[string]int, error) {
+	out := make(map[string]int)
+	var lastErr error
+
+	cp := readCheckpoint(Checkpoint, URL, since)
+
+	bar := progress.New("Querying "+URL, len(certs))
+	defer bar.Done()
+	for i := range certs {
+		if interrupt.Interrupted() {
+			lastErr = interrupt.ErrInterrupted
+			break
+		}
+		fp := certutil.GetHexSHA256Fingerprint(*certs[i])
+		if n, ok := cp.Counts[fp]; ok {
+			bar.Increment()
+			out[fp] = n
+			continue
+		}
+		n, err := issuedBy(fp, since)
+		bar.Increment()
+		if err != nil {
+			if debug {
+				fmt.Printf("crtsh: %s: %v\n", fp, err)
+			}
+			lastErr = err
+			continue
+		}
+		out[fp] = n
+		cp.Counts[fp] = n
+		if err := cp.write(Checkpoint); err != nil && debug {
+			fmt.Printf("crtsh: writing checkpoint: %v\n", err)
+		}
+	}
+	if len(out) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return out, nil
+}
+
+// issuedBy finds the CA ID of the certificate with the given fingerprint and
+// counts the certificates it issued after `since`.
+func issuedBy(fingerprint string, since time.Time) (int, error) {
+	// A root is self-signed, so its issuer is itself
+	certs, err := query(url.Values{"q": []string{fingerprint}})
+	if err != nil {
+		return 0, err
+	}
+	if len(certs) == 0 {
+		return 0, fmt.Errorf("certificate not found in CT logs")
+	}
+	caid := certs[0].IssuerCAID
+
+	issued, err := query(url.Values{
+		"Identity": []string{"%"},
+		"iCAID":    []string{strconv.Itoa(caid)},
+		"exclude":  []string{"expired"},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return countSince(issued, since), nil
+}
+
+func countSince(certs []entry, since time.Time) int {
+	n := 0
+	for i := range certs {
+		t, err := time.Parse(timeLayout, certs[i].NotBefore)
+		if err == nil && t.After(since) {
+			n++
+		}
+	}
+	return n
+}
+
+func query(params url.Values) ([]entry, error) {
+	params.Set("output", "json")
+	u := URL + "?" + params.Encode()
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	var resp *http.Response
+	for attempt := 0; ; attempt++ {
+		if err := limiterFor(req.URL.Host).wait(); err != nil {
+			return nil, err
+		}
+		resp, err = httputil.New().Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if !slowDown(resp.StatusCode) || attempt >= maxRetries {
+			break
+		}
+		resp.Body.Close()
+		if err := sleep(backoff(resp.Header.Get("Retry-After"), attempt)); err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %s", u, resp.Status)
+	}
+
+	var certs []entry
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&certs); err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", u, err)
+	}
+	return certs, nil
+}
+
+// limiter spaces out requests to a CT server by Interval
+type limiter struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+func limiterFor(host string) *limiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	l, ok := limiters[host]
+	if !ok {
+		l = &limiter{}
+		limiters[host] = l
+	}
+	return l
+}
+
+// wait blocks until the next request can be made
+func (l *limiter) wait() error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	d := l.next.Sub(now)
+	l.next = l.next.Add(Interval)
+	l.mu.Unlock()
+	return sleep(d)
+}
+
+// slowDown returns true for responses asking clients to back off
+func slowDown(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// backoff is how long to wait before retrying, the server's Retry-After
+// (in seconds) is used when given, otherwise the wait doubles each attempt.
+func backoff(retryAfter string, attempt int) time.Duration {
+	d := Interval << uint(attempt+1)
+	if secs, err := strconv.Atoi(retryAfter); err == nil && secs >= 0 {
+		d = time.Duration(secs) * time.Second
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
+// sleep waits for d, returning early if cert-manage is interrupted
+func sleep(d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-interrupt.Context().Done():
+		return interrupt.ErrInterrupted
+	}
+}
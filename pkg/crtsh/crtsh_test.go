@@ -0,0 +1,176 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crtsh
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+func TestCrtsh__Issuance(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	known := certutil.GetHexSHA256Fingerprint(*certs[0])
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") != "json" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		switch {
+		case r.URL.Query().Get("q") == known:
+			fmt.Fprint(w, `[{"issuer_ca_id": 42, "not_before": "2010-01-01T00:00:00"}]`)
+		case r.URL.Query().Get("q") != "":
+			fmt.Fprint(w, `[]`)
+		case r.URL.Query().Get("iCAID") == "42":
+			fmt.Fprint(w, `[{"issuer_ca_id": 42, "not_before": "2017-06-01T00:00:00"},
+{"issuer_ca_id": 42, "not_before": "2018-02-01T00:00:00"},
+{"issuer_ca_id": 42, "not_before": "2018-03-01T12:00:00"}]`)
+		default:
+			http.Error(w, "unexpected", http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	orig, origInterval := URL, Interval
+	URL, Interval = srv.URL+"/", 0
+	defer func() { URL, Interval = orig, origInterval }()
+
+	since := time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)
+	issuance, err := Issuance(certs[:2], since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issuance) != 1 || issuance[known] != 2 {
+		t.Errorf("got %v", issuance)
+	}
+
+	// nothing found
+	_, err = Issuance(certs[1:2], since)
+	if err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestCrtsh__checkpoint(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	known := certutil.GetHexSHA256Fingerprint(*certs[0])
+
+	dir, err := ioutil.TempDir("", "crtsh-checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case r.URL.Query().Get("q") == known:
+			fmt.Fprint(w, `[{"issuer_ca_id": 42, "not_before": "2010-01-01T00:00:00"}]`)
+		case r.URL.Query().Get("iCAID") == "42":
+			fmt.Fprint(w, `[{"issuer_ca_id": 42, "not_before": "2018-02-01T00:00:00"}]`)
+		default:
+			http.Error(w, "unexpected", http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	orig, origInterval, origCheckpoint := URL, Interval, Checkpoint
+	URL, Interval, Checkpoint = srv.URL+"/", 0, filepath.Join(dir, "checkpoint.json")
+	defer func() { URL, Interval, Checkpoint = orig, origInterval, origCheckpoint }()
+
+	since := time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := Issuance(certs[:1], since); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Errorf("got %d requests", requests)
+	}
+
+	// resumed from the checkpoint
+	issuance, err := Issuance(certs[:1], since.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 || issuance[known] != 1 {
+		t.Errorf("got %d requests and %v", requests, issuance)
+	}
+
+	// a different window looks everything up again
+	if _, err := Issuance(certs[:1], since.AddDate(0, 0, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 4 {
+		t.Errorf("got %d requests", requests)
+	}
+}
+
+func TestCrtsh__rateLimit(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		times = append(times, time.Now())
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	}))
+	defer srv.Close()
+
+	orig, origInterval := URL, Interval
+	URL, Interval = srv.URL+"/", 50*time.Millisecond
+	defer func() { URL, Interval = orig, origInterval }()
+
+	for i := 0; i < 2; i++ {
+		if _, err := query(map[string][]string{"q": {"a"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(times) != 3 {
+		t.Fatalf("got %d requests", len(times))
+	}
+	for i := 1; i < len(times); i++ {
+		if d := times[i].Sub(times[i-1]); d < 40*time.Millisecond {
+			t.Errorf("request %d was %v after the previous", i, d)
+		}
+	}
+
+	if d := backoff("", 1); d != 4*Interval {
+		t.Errorf("got %v", d)
+	}
+	if d := backoff("3600", 0); d != maxBackoff {
+		t.Errorf("got %v", d)
+	}
+}
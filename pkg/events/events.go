@@ -0,0 +1,228 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package events writes security events about trust stores, such as a
+// certificate's trust being removed or an audit finding, in the Common Event
+// Format (CEF) or Log Event Extended Format (LEEF) read by SIEMs like Splunk
+// and QRadar.
+//
+// https://www.microfocus.com/documentation/arcsight/arcsight-smartconnectors/pdfdoc/common-event-format-v25/common-event-format-v25.pdf
+// https://www.ibm.com/docs/en/dsm?topic=leef-overview
+package events
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/output"
+)
+
+// Formats events are written in
+const (
+	CEF  = "cef"
+	LEEF = "leef"
+)
+
+// Actions events describe
+const (
+	// Removed is a certificate's trust being removed from a store
+	Removed = "removed"
+
+	// Finding is a problem an audit found with a trusted certificate
+	Finding = "finding"
+)
+
+const vendor = "cert-manage"
+
+var (
+	// Version is the version of cert-manage reported in each event
+	Version = ""
+
+	mu       sync.Mutex
+	dest     io.WriteCloser
+	format   string
+	hostname string
+	now      = time.Now
+)
+
+// GetFormats returns the names of formats events can be written in
+func GetFormats() []string {
+	return []string{CEF, LEEF}
+}
+
+// Event is something which happened to a certificate in a store
+type Event struct {
+	Action      string
+	Store       string // the app name or platform (e.g. linux)
+	Certificate *x509.Certificate
+	Reason      string // why, e.g. "not whitelisted" or an audit's problem
+}
+
+// Open starts writing events in format (CEF or LEEF) to where, which is
+// anything output.Open accepts: a file (appended to), syslog or - for stdout.
+func Open(where, f string) error {
+	f = strings.ToLower(f)
+	if f != CEF && f != LEEF {
+		return fmt.Errorf("unknown event format %q (options: %s)", f, strings.Join(GetFormats(), ", "))
+	}
+	w, err := output.Open(where)
+	if err != nil {
+		return fmt.Errorf("unable to open events %s: %v", where, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	dest, format = w, f
+	hostname, _ = os.Hostname()
+	return nil
+}
+
+// Close stops writing events
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if dest == nil {
+		return nil
+	}
+	err := dest.Close()
+	dest = nil
+	return err
+}
+
+// Emit writes ev, unless Open hasn't been called
+func Emit(ev Event) {
+	mu.Lock()
+	defer mu.Unlock()
+	if dest == nil {
+		return
+	}
+	var line string
+	if format == LEEF {
+		line = formatLEEF(ev, now())
+	} else {
+		line = formatCEF(ev, now())
+	}
+	if _, err := io.WriteString(dest, line+"\n"); err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: writing event: %v\n", err)
+	}
+}
+
+// EmitEach writes an event for each certificate in certs
+func EmitEach(action, store, reason string, certs []*x509.Certificate) {
+	for i := range certs {
+		Emit(Event{
+			Action:      action,
+			Store:       store,
+			Certificate: certs[i],
+			Reason:      reason,
+		})
+	}
+}
+
+// describe returns the event's id, name, severity (0-10) and attributes
+func describe(ev Event) (string, string, int, map[string]string) {
+	attrs := map[string]string{
+		"store":  ev.Store,
+		"reason": ev.Reason,
+	}
+	if c := ev.Certificate; c != nil {
+		attrs["sha256"] = certutil.GetHexSHA256Fingerprint(*c)
+		attrs["subject"] = certutil.StringifyPKIXName(c.Subject)
+		attrs["issuer"] = certutil.StringifyPKIXName(c.Issuer)
+		attrs["notAfter"] = c.NotAfter.UTC().Format(time.RFC3339)
+	}
+	switch ev.Action {
+	case Removed:
+		return "trust-removed", "Certificate trust removed", 5, attrs
+	case Finding:
+		return "audit-finding", "Trusted certificate audit finding", 7, attrs
+	}
+	return ev.Action, ev.Action, 3, attrs
+}
+
+// formatCEF returns ev as a CEF:0 line. Attributes without a CEF key are
+// written as labeled custom strings (cs1..cs6).
+func formatCEF(ev Event, when time.Time) string {
+	id, name, severity, attrs := describe(ev)
+
+	var ext []string
+	add := func(k, v string) {
+		if v != "" {
+			ext = append(ext, k+"="+cefValue(v))
+		}
+	}
+	add("rt", fmt.Sprintf("%d", when.UnixNano()/int64(time.Millisecond)))
+	add("act", ev.Action)
+	add("dvchost", hostname)
+	add("msg", attrs["reason"])
+	for i, k := range []string{"store", "sha256", "subject", "issuer", "notAfter"} {
+		if attrs[k] != "" {
+			add(fmt.Sprintf("cs%dLabel", i+1), k)
+			add(fmt.Sprintf("cs%d", i+1), attrs[k])
+		}
+	}
+	header := []string{"CEF:0", vendor, vendor, Version, id, name, fmt.Sprintf("%d", severity)}
+	for i := 1; i < len(header); i++ {
+		header[i] = cefHeader(header[i])
+	}
+	return strings.Join(header, "|") + "|" + strings.Join(ext, " ")
+}
+
+// formatLEEF returns ev as a LEEF:1.0 line, with tab separated attributes
+func formatLEEF(ev Event, when time.Time) string {
+	id, _, severity, attrs := describe(ev)
+	attrs["devTime"] = when.UTC().Format("Jan 02 2006 15:04:05.000 MST")
+	attrs["devTimeFormat"] = "MMM dd yyyy HH:mm:ss.SSS z"
+	attrs["cat"] = ev.Action
+	attrs["sev"] = fmt.Sprintf("%d", severity)
+	attrs["identHostName"] = hostname
+
+	var keys []string
+	for k, v := range attrs {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var ext []string
+	for _, k := range keys {
+		ext = append(ext, k+"="+leefValue(attrs[k]))
+	}
+	header := []string{"LEEF:1.0", vendor, vendor, Version, id}
+	for i := 1; i < len(header); i++ {
+		header[i] = leefValue(strings.Replace(header[i], "|", " ", -1))
+	}
+	return strings.Join(header, "|") + "|" + strings.Join(ext, "\t")
+}
+
+// cefHeader escapes pipes and backslashes in a CEF header field
+func cefHeader(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "|", `\|`, "\r", " ", "\n", " ").Replace(s)
+}
+
+// cefValue escapes equal signs, backslashes and newlines in a CEF extension
+func cefValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "=", `\=`, "\r", `\r`, "\n", `\n`).Replace(s)
+}
+
+// leefValue removes the tabs and newlines LEEF uses as delimiters
+func leefValue(s string) string {
+	return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,128 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+)
+
+func TestEvents__CEF(t *testing.T) {
+	root, err := testca.NewRoot("Pipe|Root=CA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostname = "host1"
+	Version = "1.0"
+	when := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	line := formatCEF(Event{Action: Removed, Store: "java", Certificate: root.Certificate, Reason: "not whitelisted"}, when)
+	if !strings.HasPrefix(line, "CEF:0|cert-manage|cert-manage|1.0|trust-removed|Certificate trust removed|5|") {
+		t.Errorf("got %s", line)
+	}
+	for _, part := range []string{
+		"rt=1514862245000",
+		"act=removed",
+		"dvchost=host1",
+		"msg=not whitelisted",
+		"cs1Label=store cs1=java",
+		`Pipe|Root\=CA`,
+	} {
+		if !strings.Contains(line, part) {
+			t.Errorf("missing %q in %s", part, line)
+		}
+	}
+}
+
+func TestEvents__LEEF(t *testing.T) {
+	root, err := testca.NewRoot("Tab\tRoot", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostname = "host1"
+	Version = "1.0"
+	when := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	line := formatLEEF(Event{Action: Finding, Store: "linux", Certificate: root.Certificate, Reason: "expired"}, when)
+	if !strings.HasPrefix(line, "LEEF:1.0|cert-manage|cert-manage|1.0|audit-finding|") {
+		t.Errorf("got %s", line)
+	}
+	attrs := make(map[string]string)
+	for _, kv := range strings.Split(strings.SplitN(line, "|", 6)[5], "\t") {
+		parts := strings.SplitN(kv, "=", 2)
+		attrs[parts[0]] = parts[1]
+	}
+	ans := map[string]string{
+		"cat":           "finding",
+		"sev":           "7",
+		"store":         "linux",
+		"reason":        "expired",
+		"identHostName": "host1",
+		"devTime":       "Jan 02 2018 03:04:05.000 UTC",
+	}
+	for k, v := range ans {
+		if attrs[k] != v {
+			t.Errorf("%s: got %q, expected %q", k, attrs[k], v)
+		}
+	}
+	if !strings.Contains(attrs["subject"], "Tab Root") {
+		t.Errorf("subject: %q", attrs["subject"])
+	}
+}
+
+func TestEvents__Emit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root, err := testca.NewRoot("Root", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// not opened, so nothing is written
+	Emit(Event{Action: Removed})
+
+	where := filepath.Join(dir, "events.log")
+	if err := Open(where, "LEEF"); err != nil {
+		t.Fatal(err)
+	}
+	EmitEach(Removed, "java", "expired", []*x509.Certificate{root.Certificate, root.Certificate})
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+	Emit(Event{Action: Removed})
+
+	bs, err := ioutil.ReadFile(where)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(bs)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "LEEF:1.0|") {
+		t.Errorf("got %q", lines)
+	}
+
+	if err := Open(where, "xml"); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package exectest replaces external tools (e.g. security, keytool or
+// certutil) with recorded output in tests, so store tests run on machines
+// without the tools installed.
+//
+// Commands created through the interrupt package are re-ran as the test
+// binary, which prints the matching Response, so test packages using this
+// need a TestMain calling Main.
+package exectest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
+)
+
+// responseFlag is given to the test binary, followed by the path of the
+// Response it prints
+const responseFlag = "-exectest.response="
+
+// Response is the output of a faked command
+type Response struct {
+	// Name is the command's file name, without a directory or .exe
+	Name string
+
+	// Args must each be given to the command, in order. Other arguments
+	// (e.g. keytool's -J flags) are ignored.
+	Args []string
+
+	Stdout string
+	Stderr string
+
+	// Fixture is a file whose contents are printed after Stdout
+	Fixture string
+
+	ExitCode int
+}
+
+func (r Response) matches(name string, args []string) bool {
+	name = strings.TrimSuffix(filepath.Base(name), ".exe")
+	if r.Name != name {
+		return false
+	}
+	i := 0
+	for j := 0; i < len(r.Args) && j < len(args); j++ {
+		if r.Args[i] == args[j] {
+			i++
+		}
+	}
+	return i == len(r.Args)
+}
+
+// Fake holds the responses of faked commands, each command without a
+// response fails as if it wasn't installed.
+type Fake struct {
+	dir  string
+	path string
+
+	mu        sync.Mutex
+	responses []Response
+	calls     [][]string
+	n         int
+}
+
+// Install fakes every command until Close is called. The directory shims
+// are written into (see Path) is added to PATH.
+func Install() (*Fake, error) {
+	dir, err := ioutil.TempDir("", "cert-manage-exectest")
+	if err != nil {
+		return nil, err
+	}
+	f := &Fake{
+		dir:  dir,
+		path: os.Getenv("PATH"),
+	}
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+f.path)
+	interrupt.CommandContext = f.command
+	return f, nil
+}
+
+// Close stops faking commands
+func (f *Fake) Close() error {
+	interrupt.CommandContext = exec.CommandContext
+	os.Setenv("PATH", f.path)
+	return os.RemoveAll(f.dir)
+}
+
+// Add fakes a command, responses added later are matched first.
+func (f *Fake) Add(r Response) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = append([]Response{r}, f.responses...)
+}
+
+// Path returns an executable shim for name, which is also found on PATH,
+// for code checking a tool is installed before running it.
+func (f *Fake) Path(name string) (string, error) {
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	where := filepath.Join(f.dir, name)
+	return where, ioutil.WriteFile(where, []byte("#!/bin/sh\nexit 127\n"), 0755)
+}
+
+// Calls returns the name and arguments of each command ran, in order
+func (f *Fake) Calls() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]string{}, f.calls...)
+}
+
+func (f *Fake) command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, append([]string{name}, args...))
+	resp := Response{
+		Stderr:   fmt.Sprintf("exectest: no response for %s %s\n", name, strings.Join(args, " ")),
+		ExitCode: 127,
+	}
+	for i := range f.responses {
+		if f.responses[i].matches(name, args) {
+			resp = f.responses[i]
+			break
+		}
+	}
+
+	// fixtures are relative to the test, not where the command runs
+	if resp.Fixture != "" && !filepath.IsAbs(resp.Fixture) {
+		if abs, err := filepath.Abs(resp.Fixture); err == nil {
+			resp.Fixture = abs
+		}
+	}
+	f.n++
+	where := filepath.Join(f.dir, fmt.Sprintf("response-%d.json", f.n))
+	bs, err := json.Marshal(resp)
+	if err == nil {
+		err = ioutil.WriteFile(where, bs, 0600)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("exectest: writing response: %v", err))
+	}
+	return exec.CommandContext(ctx, os.Args[0], responseFlag+where)
+}
+
+// Main runs the tests, or prints a Response when the test binary is ran as
+// a faked command.
+func Main(m *testing.M) {
+	if len(os.Args) == 2 && strings.HasPrefix(os.Args[1], responseFlag) {
+		os.Exit(respond(strings.TrimPrefix(os.Args[1], responseFlag)))
+	}
+	os.Exit(m.Run())
+}
+
+func respond(where string) int {
+	bs, err := ioutil.ReadFile(where)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "exectest: %v\n", err)
+		return 127
+	}
+	var resp Response
+	if err := json.Unmarshal(bs, &resp); err != nil {
+		fmt.Fprintf(os.Stderr, "exectest: %v\n", err)
+		return 127
+	}
+	os.Stdout.WriteString(resp.Stdout)
+	if resp.Fixture != "" {
+		bs, err := ioutil.ReadFile(resp.Fixture)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "exectest: %v\n", err)
+			return 127
+		}
+		os.Stdout.Write(bs)
+	}
+	os.Stderr.WriteString(resp.Stderr)
+	return resp.ExitCode
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exectest
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
+)
+
+func TestMain(m *testing.M) {
+	Main(m)
+}
+
+func TestExectest(t *testing.T) {
+	fake, err := Install()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fake.Close()
+
+	fake.Add(Response{Name: "keytool", Args: []string{"-list", "-keystore"}, Stdout: "listed\n"})
+	fake.Add(Response{Name: "keytool", Args: []string{"-delete"}, Stderr: "denied\n", ExitCode: 1})
+
+	out, err := interrupt.Command("/usr/bin/keytool", "-list", "-J-Duser.language=en", "-keystore", "cacerts").Output()
+	if err != nil || string(out) != "listed\n" {
+		t.Errorf("got %q, err=%v", out, err)
+	}
+	out, err = interrupt.Command("keytool.exe", "-delete", "-alias", "a").CombinedOutput()
+	if e, ok := err.(*exec.ExitError); !ok || e.Success() || string(out) != "denied\n" {
+		t.Errorf("got %q, err=%v", out, err)
+	}
+	out, err = interrupt.Command("security", "find-certificate").CombinedOutput()
+	if err == nil {
+		t.Errorf("expected error, got %q", out)
+	}
+
+	// args are matched in order
+	if (Response{Name: "keytool", Args: []string{"-keystore", "-list"}}).matches("keytool", []string{"-list", "-keystore"}) {
+		t.Error("expected no match")
+	}
+
+	if calls := fake.Calls(); len(calls) != 3 || calls[2][0] != "security" {
+		t.Errorf("got %q", calls)
+	}
+
+	// shims are found on PATH
+	bin, err := fake.Path("security")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found, err := exec.LookPath("security"); err != nil || found != bin {
+		t.Errorf("got %q, err=%v", found, err)
+	}
+}
@@ -0,0 +1,321 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+var (
+	// AuthRootURL is Microsoft's signed certificate trust list (authroot.stl)
+	// of the roots Windows trusts, packed in a cabinet file
+	AuthRootURL = "https://ctldl.windowsupdate.com/msdownload/update/v3/static/trustedr/en/authrootstl.cab"
+
+	// CTL entry properties, see CERT_*_PROP_ID in wincrypt.h
+	oidAuthRootSHA256     = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 11, 98}
+	oidDisallowedFiletime = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 11, 104}
+)
+
+func fetchAuthRoot() (*Result, error) {
+	return fetchFrom(AuthRootURL, readAuthRoot)
+}
+
+// readAuthRoot extracts authroot.stl from a cabinet file, checks its
+// signature and reads the SHA256 fingerprint of each root which isn't
+// disabled.
+func readAuthRoot(cab []byte) (*Result, error) {
+	stl, err := extractCabinet(cab, "authroot.stl")
+	if err != nil {
+		return nil, err
+	}
+	sd, err := parseSignedData(stl)
+	if err != nil {
+		return nil, fmt.Errorf("reading authroot.stl: %v", err)
+	}
+
+	res := &Result{
+		Source: "authroot",
+	}
+	signer, err := verifySignedData(sd)
+	if err != nil {
+		return nil, fmt.Errorf("verifying authroot.stl signature: %v", err)
+	}
+	if signer != nil {
+		res.Signer = certutil.StringifyPKIXName(signer.Subject)
+	}
+
+	res.Fingerprints, err = readCTL(sd.content)
+	if err != nil {
+		return nil, fmt.Errorf("reading authroot.stl: %v", err)
+	}
+	if len(res.Fingerprints) == 0 {
+		return nil, errors.New("no certificates found in authroot.stl")
+	}
+	return res, nil
+}
+
+// readCTL returns the SHA256 fingerprints of the trusted subjects in a
+// CertificateTrustList. The fields before trustedSubjects are mostly
+// optional, so it's found as the second SEQUENCE after ctlThisUpdate.
+func readCTL(ctl asn1.RawValue) ([]string, error) {
+	fields, err := children(ctl.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	var subjects *asn1.RawValue
+	seenTime, sequences := false, 0
+	for i := range fields {
+		f := fields[i]
+		if f.Class != asn1.ClassUniversal {
+			continue
+		}
+		switch {
+		case f.Tag == asn1.TagUTCTime || f.Tag == asn1.TagGeneralizedTime:
+			seenTime = true
+		case f.Tag == asn1.TagSequence && seenTime:
+			sequences++
+			if sequences == 2 {
+				subjects = &fields[i]
+			}
+		}
+	}
+	if subjects == nil {
+		return nil, errors.New("CTL has no trusted subjects")
+	}
+
+	entries, err := children(subjects.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for i := range entries {
+		fp, disabled, err := readCTLEntry(entries[i])
+		if err != nil {
+			return nil, err
+		}
+		if fp != "" && !disabled {
+			out = append(out, fp)
+		}
+	}
+	return out, nil
+}
+
+// readCTLEntry reads a TrustedSubject ::= SEQUENCE { subjectIdentifier,
+// subjectAttributes SET OF Attribute OPTIONAL }. Only entries with a SHA256
+// property have a fingerprint returned.
+func readCTLEntry(entry asn1.RawValue) (string, bool, error) {
+	parts, err := children(entry.Bytes)
+	if err != nil {
+		return "", false, err
+	}
+	if len(parts) < 2 {
+		return "", false, nil
+	}
+	attrs, err := children(parts[1].Bytes)
+	if err != nil {
+		return "", false, err
+	}
+	fp, disabled := "", false
+	for i := range attrs {
+		attr, err := children(attrs[i].Bytes)
+		if err != nil || len(attr) != 2 {
+			continue
+		}
+		var oid asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(attr[0].FullBytes, &oid); err != nil {
+			continue
+		}
+		switch {
+		case oid.Equal(oidAuthRootSHA256):
+			values, err := children(attr[1].Bytes)
+			if err == nil && len(values) == 1 && len(values[0].Bytes) == 32 {
+				fp = hex.EncodeToString(values[0].Bytes)
+			}
+		case oid.Equal(oidDisallowedFiletime):
+			disabled = true
+		}
+	}
+	return fp, disabled, nil
+}
+
+// extractCabinet returns the file `name` from a Microsoft cabinet (.cab),
+// files stored uncompressed or with MSZIP are supported.
+func extractCabinet(cab []byte, name string) ([]byte, error) {
+	r := bytes.NewReader(cab)
+	var hdr struct {
+		Signature [4]byte
+		_         uint32
+		Size      uint32
+		_         uint32
+		FilesAt   uint32
+		_         uint32
+		Version   uint16
+		Folders   uint16
+		Files     uint16
+		Flags     uint16
+		_         uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("reading cabinet header: %v", err)
+	}
+	if string(hdr.Signature[:]) != "MSCF" {
+		return nil, errors.New("not a cabinet file")
+	}
+	if hdr.Flags&0x3 != 0 {
+		return nil, errors.New("cabinets spanning multiple files aren't supported")
+	}
+	var folderReserve, dataReserve uint8
+	if hdr.Flags&0x4 != 0 {
+		var reserve struct {
+			Header uint16
+			Folder uint8
+			Data   uint8
+		}
+		if err := binary.Read(r, binary.LittleEndian, &reserve); err != nil {
+			return nil, err
+		}
+		folderReserve, dataReserve = reserve.Folder, reserve.Data
+		if _, err := r.Seek(int64(reserve.Header), io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+
+	type folder struct {
+		DataAt   uint32
+		Blocks   uint16
+		Compress uint16
+	}
+	folders := make([]folder, hdr.Folders)
+	for i := range folders {
+		if err := binary.Read(r, binary.LittleEndian, &folders[i]); err != nil {
+			return nil, err
+		}
+		if _, err := r.Seek(int64(folderReserve), io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := r.Seek(int64(hdr.FilesAt), io.SeekStart); err != nil {
+		return nil, err
+	}
+	for i := 0; i < int(hdr.Files); i++ {
+		var f struct {
+			Size   uint32
+			Offset uint32
+			Folder uint16
+			_      [3]uint16
+		}
+		if err := binary.Read(r, binary.LittleEndian, &f); err != nil {
+			return nil, err
+		}
+		fname, err := readCString(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(fname, name) {
+			continue
+		}
+		if int(f.Folder) >= len(folders) {
+			return nil, fmt.Errorf("cabinet file %s has an invalid folder", fname)
+		}
+		fo := folders[f.Folder]
+		data, err := readCabinetFolder(cab, int64(fo.DataAt), int(fo.Blocks), fo.Compress, dataReserve)
+		if err != nil {
+			return nil, err
+		}
+		end := uint64(f.Offset) + uint64(f.Size)
+		if end > uint64(len(data)) {
+			return nil, fmt.Errorf("cabinet file %s is truncated", fname)
+		}
+		return data[f.Offset:end], nil
+	}
+	return nil, fmt.Errorf("%s not found in cabinet", name)
+}
+
+// readCabinetFolder decompresses each data block of a folder. MSZIP blocks
+// are deflate streams, prefixed with "CK", using the previous block as their
+// dictionary.
+func readCabinetFolder(cab []byte, at int64, blocks int, compress uint16, reserve uint8) ([]byte, error) {
+	r := bytes.NewReader(cab)
+	if _, err := r.Seek(at, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var out, prev []byte
+	for i := 0; i < blocks; i++ {
+		var block struct {
+			Checksum     uint32
+			Size         uint16
+			Uncompressed uint16
+		}
+		if err := binary.Read(r, binary.LittleEndian, &block); err != nil {
+			return nil, err
+		}
+		if _, err := r.Seek(int64(reserve), io.SeekCurrent); err != nil {
+			return nil, err
+		}
+		bs := make([]byte, block.Size)
+		if _, err := io.ReadFull(r, bs); err != nil {
+			return nil, err
+		}
+
+		switch compress & 0xf {
+		case 0: // none
+			prev = bs
+		case 1: // MSZIP
+			if !bytes.HasPrefix(bs, []byte("CK")) {
+				return nil, errors.New("invalid MSZIP block in cabinet")
+			}
+			fr := flate.NewReaderDict(bytes.NewReader(bs[2:]), prev)
+			inflated, err := ioutil.ReadAll(io.LimitReader(fr, int64(block.Uncompressed)))
+			fr.Close()
+			if err != nil {
+				return nil, err
+			}
+			prev = inflated
+		default:
+			return nil, fmt.Errorf("unsupported cabinet compression %d", compress&0xf)
+		}
+		if len(prev) != int(block.Uncompressed) {
+			return nil, errors.New("cabinet data block has the wrong size")
+		}
+		out = append(out, prev...)
+	}
+	return out, nil
+}
+
+func readCString(r io.ByteReader) (string, error) {
+	var buf bytes.Buffer
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b == 0 {
+			return buf.String(), nil
+		}
+		buf.WriteByte(b)
+	}
+}
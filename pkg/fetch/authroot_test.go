@@ -0,0 +1,293 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+)
+
+var (
+	oidCTL       = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 1}
+	oidSHA256    = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA1      = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidECDSA     = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidContentTy = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+
+	ctlSigning = &testca.Options{
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+)
+
+// der encodes an ASN.1 element from its already encoded children
+func der(class, tag int, children ...[]byte) []byte {
+	bs, err := asn1.Marshal(asn1.RawValue{
+		Class:      class,
+		Tag:        tag,
+		IsCompound: true,
+		Bytes:      bytes.Join(children, nil),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return bs
+}
+
+func seq(children ...[]byte) []byte {
+	return der(asn1.ClassUniversal, asn1.TagSequence, children...)
+}
+
+func set(children ...[]byte) []byte {
+	return der(asn1.ClassUniversal, asn1.TagSet, children...)
+}
+
+func marshal(v interface{}) []byte {
+	bs, err := asn1.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return bs
+}
+
+// ctlEntry is a trusted subject with a SHA256 property, which is disabled
+// if `disabled` is set
+func ctlEntry(fp [32]byte, disabled bool) []byte {
+	attrs := [][]byte{
+		seq(marshal(oidAuthRootSHA256), set(marshal(fp[:]))),
+	}
+	if disabled {
+		attrs = append(attrs, seq(marshal(oidDisallowedFiletime), set(marshal(make([]byte, 8)))))
+	}
+	return seq(marshal(make([]byte, 20)), set(attrs...))
+}
+
+func testCTL(entries ...[]byte) []byte {
+	return seq(
+		seq(marshal(asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 1})), // subjectUsage
+		marshal([]byte("test")),   // listIdentifier
+		marshal(7),                // sequenceNumber
+		marshal(time.Now().UTC()), // ctlThisUpdate
+		seq(marshal(oidSHA1)),     // subjectAlgorithm
+		seq(entries...),           // trustedSubjects
+	)
+}
+
+// signCTL wraps a CTL in a PKCS#7 SignedData signed by `key`
+func signCTL(t *testing.T, ctl []byte, signer *x509.Certificate, key crypto.Signer) []byte {
+	var content asn1.RawValue
+	if _, err := asn1.Unmarshal(ctl, &content); err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(content.Bytes)
+	attrs := [][]byte{
+		seq(marshal(oidContentTy), set(marshal(oidCTL))),
+		seq(marshal(oidMessageDigest), set(marshal(digest[:]))),
+	}
+	signed := sha256.Sum256(set(attrs...))
+	sig, err := key.Sign(rand.Reader, signed[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signerInfo := seq(
+		marshal(1),
+		seq(signer.RawIssuer, marshal(signer.SerialNumber)),
+		seq(marshal(oidSHA256)),
+		der(asn1.ClassContextSpecific, 0, attrs...),
+		seq(marshal(oidECDSA)),
+		marshal(sig),
+	)
+	sd := seq(
+		marshal(1),
+		set(seq(marshal(oidSHA256))),
+		seq(marshal(oidCTL), der(asn1.ClassContextSpecific, 0, ctl)),
+		der(asn1.ClassContextSpecific, 0, signer.Raw),
+		set(signerInfo),
+	)
+	return seq(marshal(oidSignedData), der(asn1.ClassContextSpecific, 0, sd))
+}
+
+// testCabinet packs a single file into a cabinet, compressed with MSZIP
+// unless `stored` is set
+func testCabinet(t *testing.T, name string, data []byte, stored bool) []byte {
+	block := data
+	compress := uint16(0)
+	if !stored {
+		var buf bytes.Buffer
+		buf.WriteString("CK")
+		w, _ := flate.NewWriter(&buf, flate.BestCompression)
+		w.Write(data)
+		w.Close()
+		block = buf.Bytes()
+		compress = 1
+	}
+
+	filesAt := 36 + 8
+	dataAt := filesAt + 16 + len(name) + 1
+	var buf bytes.Buffer
+	write := func(v interface{}) {
+		if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf.WriteString("MSCF")
+	write([]uint32{0, uint32(dataAt + 8 + len(block)), 0, uint32(filesAt), 0})
+	write([]uint16{0x0103, 1, 1, 0, 0, 0})
+	write(uint32(dataAt))
+	write([]uint16{1, compress})
+	write([]uint32{uint32(len(data)), 0})
+	write([]uint16{0, 0, 0, 0})
+	buf.WriteString(name + "\x00")
+	write(uint32(0))
+	write([]uint16{uint16(len(block)), uint16(len(data))})
+	buf.Write(block)
+	return buf.Bytes()
+}
+
+func TestFetch__authRoot(t *testing.T) {
+	root, err := testca.NewRoot("Test Trust List Root", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, key, err := root.NewLeaf("ctl.example.com", ctlSigning)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enabled, disabled := sha256.Sum256([]byte("enabled")), sha256.Sum256([]byte("disabled"))
+	ctl := testCTL(ctlEntry(enabled, false), ctlEntry(disabled, true))
+	cab := testCabinet(t, "authroot.stl", signCTL(t, ctl, signer, key), false)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(cab)
+	}))
+	defer srv.Close()
+
+	origURL, origSigners := AuthRootURL, Signers
+	defer func() {
+		AuthRootURL, Signers, SkipVerify = origURL, origSigners, false
+	}()
+	AuthRootURL = srv.URL
+	Signers = x509.NewCertPool()
+	Signers.AddCert(root.Certificate)
+
+	res, err := Fetch("authroot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Fingerprints) != 1 || res.Fingerprints[0] != hex.EncodeToString(enabled[:]) {
+		t.Errorf("got %v", res.Fingerprints)
+	}
+	if !strings.Contains(res.Signer, "ctl.example.com") || res.URL != srv.URL {
+		t.Errorf("got Signer=%q URL=%q", res.Signer, res.URL)
+	}
+
+	// signed for TLS rather than trust lists
+	tls, tlsKey, err := root.NewLeaf("www.example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readAuthRoot(testCabinet(t, "authroot.stl", signCTL(t, ctl, tls, tlsKey), false)); err == nil || !strings.Contains(err.Error(), "isn't allowed to sign") {
+		t.Errorf("expected usage error, got %v", err)
+	}
+
+	// only Microsoft's roots are trusted by default
+	Signers = nil
+	if _, err := readAuthRoot(cab); err == nil || !strings.Contains(err.Error(), "-skip-verify") {
+		t.Errorf("expected verification error, got %v", err)
+	}
+
+	// signed by someone else
+	other, err := testca.NewRoot("Other Root", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Signers = x509.NewCertPool()
+	Signers.AddCert(other.Certificate)
+	if _, err := readAuthRoot(cab); err == nil || !strings.Contains(err.Error(), "-skip-verify") {
+		t.Errorf("expected verification error, got %v", err)
+	}
+	SkipVerify = true
+	res, err = readAuthRoot(cab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Signer != "" || len(res.Fingerprints) != 1 {
+		t.Errorf("got Signer=%q and %v", res.Signer, res.Fingerprints)
+	}
+}
+
+func TestFetch__authRootTampered(t *testing.T) {
+	root, err := testca.NewRoot("Test Trust List Root", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, key, err := root.NewLeaf("ctl.example.com", ctlSigning)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := Signers
+	defer func() { Signers = orig }()
+	Signers = x509.NewCertPool()
+	Signers.AddCert(root.Certificate)
+
+	fp := sha256.Sum256([]byte("enabled"))
+	stl := signCTL(t, testCTL(ctlEntry(fp, false)), signer, key)
+
+	// swap the fingerprint after signing
+	other := sha256.Sum256([]byte("other"))
+	tampered := bytes.Replace(stl, fp[:], other[:], 1)
+	if _, err := readAuthRoot(testCabinet(t, "authroot.stl", tampered, true)); err == nil || !strings.Contains(err.Error(), "digest") {
+		t.Errorf("expected digest error, got %v", err)
+	}
+
+	// and unsigned
+	if _, err := readAuthRoot(testCabinet(t, "authroot.stl", testCTL(ctlEntry(fp, false)), true)); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestFetch__extractCabinet(t *testing.T) {
+	data := bytes.Repeat([]byte("cert-manage "), 100)
+	for _, stored := range []bool{true, false} {
+		cab := testCabinet(t, "file.txt", data, stored)
+		out, err := extractCabinet(cab, "FILE.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Errorf("stored=%v: got %q", stored, out)
+		}
+		if _, err := extractCabinet(cab, "other.txt"); err == nil {
+			t.Error("expected error")
+		}
+	}
+	if _, err := extractCabinet([]byte("PK\x03\x04"), "file.txt"); err == nil {
+		t.Error("expected error")
+	}
+}
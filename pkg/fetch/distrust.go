@@ -0,0 +1,101 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReadDistrustAfter returns the CKA_NSS_SERVER_DISTRUST_AFTER date of each
+// root in Mozilla's certdata.txt which has one, keyed by the root's SHA256
+// fingerprint. TLS certificates issued by the root after that date aren't
+// trusted by Firefox, even though the root is still included.
+func ReadDistrustAfter(bs []byte) (map[string]time.Time, error) {
+	out := make(map[string]time.Time)
+
+	var der []byte
+	var after time.Time
+	certificate := false
+	done := func() {
+		if certificate && len(der) > 0 && !after.IsZero() {
+			sum := sha256.Sum256(der)
+			out[hex.EncodeToString(sum[:])] = after
+		}
+		der, after, certificate = nil, time.Time{}, false
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(bs))
+	s.Buffer(make([]byte, 0, 64*1024), len(bs)+1)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		switch {
+		case fields[0] == "CKA_CLASS":
+			done()
+			certificate = fields[len(fields)-1] == "CKO_CERTIFICATE"
+
+		case fields[0] == "CKA_VALUE" && fields[1] == "MULTILINE_OCTAL":
+			v, err := readMultilineOctal(s)
+			if err != nil {
+				return nil, err
+			}
+			der = v
+
+		case fields[0] == "CKA_NSS_SERVER_DISTRUST_AFTER" && fields[1] == "MULTILINE_OCTAL":
+			v, err := readMultilineOctal(s)
+			if err != nil {
+				return nil, err
+			}
+			// The date is an ASN.1 UTCTime, e.g. 191201000000Z
+			when, err := time.Parse("060102150405Z", string(v))
+			if err != nil {
+				return nil, fmt.Errorf("reading CKA_NSS_SERVER_DISTRUST_AFTER: %v", err)
+			}
+			after = when
+		}
+	}
+	done()
+	return out, s.Err()
+}
+
+// readMultilineOctal reads the lines of escaped octal bytes (e.g. \060\202)
+// up to the next END
+func readMultilineOctal(s *bufio.Scanner) ([]byte, error) {
+	var out []byte
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "END" {
+			return out, nil
+		}
+		for _, part := range strings.Split(line, "\\")[1:] {
+			b, err := strconv.ParseUint(part, 8, 8)
+			if err != nil {
+				return nil, fmt.Errorf("reading octal %q: %v", part, err)
+			}
+			out = append(out, byte(b))
+		}
+	}
+	return nil, errors.New("MULTILINE_OCTAL without an END")
+}
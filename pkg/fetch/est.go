@@ -0,0 +1,117 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/httputil"
+)
+
+// FetchEST reads the CA certificates of an EST server (RFC 7030) from its
+// /cacerts endpoint. u is either the server, e.g. https://est.corp, or the
+// path of an EST label like https://est.corp/.well-known/est/label.
+func FetchEST(u string) (*Result, error) {
+	endpoint, err := estCACertsURL(u)
+	if err != nil {
+		return nil, err
+	}
+	return fetchEnterprise(endpoint, "est", readEST)
+}
+
+// FetchSCEP reads the CA certificates of a SCEP server (RFC 8894) with a
+// GetCACert request, u is the SCEP endpoint, e.g. https://scep.corp/scep
+func FetchSCEP(u string) (*Result, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	q := parsed.Query()
+	q.Set("operation", "GetCACert")
+	q.Set("message", "ca")
+	parsed.RawQuery = q.Encode()
+	return fetchEnterprise(parsed.String(), "scep", readSCEP)
+}
+
+// estCACertsURL returns where an EST server's CA certificates are served
+func estCACertsURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		return "", fmt.Errorf("%s isn't an http(s) URL", raw)
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	switch {
+	case path == "":
+		path = "/.well-known/est/cacerts"
+	case strings.HasSuffix(path, "/cacerts"):
+	case strings.Contains(path, "/.well-known/est"):
+		path += "/cacerts"
+	}
+	u.Path = path
+	return u.String(), nil
+}
+
+func fetchEnterprise(u, source string, read func([]byte) ([]*x509.Certificate, error)) (*Result, error) {
+	client := httputil.New()
+	if Bootstrap {
+		client = httputil.Unverified()
+	}
+	bs, err := downloadWith(client, u)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := read(bs)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", u, err)
+	}
+	res := &Result{
+		Source:       source,
+		Certificates: certs,
+	}
+	for i := range certs {
+		res.Fingerprints = append(res.Fingerprints, certutil.GetHexSHA256Fingerprint(*certs[i]))
+	}
+	return res.downloaded(u, bs, time.Now()), nil
+}
+
+// readEST decodes a /cacerts response, which is a base64 encoded certs-only
+// PKCS#7 message. Some servers skip the base64 encoding.
+func readEST(bs []byte) ([]*x509.Certificate, error) {
+	der, err := base64.StdEncoding.DecodeString(string(bytes.Join(bytes.Fields(bs), nil)))
+	if err != nil {
+		der = bs
+	}
+	return parseCertsOnly(der)
+}
+
+// readSCEP decodes a GetCACert response, which is either the CA's DER encoded
+// certificate or a certs-only PKCS#7 message of the CA (and RA) certificates.
+// Which one is given by the Content-Type, but the DER is enough to tell.
+func readSCEP(bs []byte) ([]*x509.Certificate, error) {
+	if cert, err := x509.ParseCertificate(bs); err == nil {
+		return []*x509.Certificate{cert}, nil
+	}
+	return parseCertsOnly(bs)
+}
@@ -0,0 +1,174 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+)
+
+// certsOnly encodes certificates as a degenerate, "certs-only", PKCS#7 message
+func certsOnly(certs ...*x509.Certificate) []byte {
+	var raw [][]byte
+	for i := range certs {
+		raw = append(raw, certs[i].Raw)
+	}
+	sd := seq(
+		marshal(1),
+		set(),
+		seq(marshal(asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1})),
+		der(asn1.ClassContextSpecific, 0, raw...),
+		set(),
+	)
+	return seq(marshal(oidSignedData), der(asn1.ClassContextSpecific, 0, sd))
+}
+
+func TestFetch__estCACertsURL(t *testing.T) {
+	cases := map[string]string{
+		"https://est.corp":                            "https://est.corp/.well-known/est/cacerts",
+		"https://est.corp/":                           "https://est.corp/.well-known/est/cacerts",
+		"https://est.corp/.well-known/est":            "https://est.corp/.well-known/est/cacerts",
+		"https://est.corp:8443/.well-known/est/corp/": "https://est.corp:8443/.well-known/est/corp/cacerts",
+		"https://est.corp/.well-known/est/cacerts":    "https://est.corp/.well-known/est/cacerts",
+	}
+	for in, want := range cases {
+		got, err := estCACertsURL(in)
+		if err != nil || got != want {
+			t.Errorf("%s: got %s, want %s (err=%v)", in, got, want, err)
+		}
+	}
+	if _, err := estCACertsURL("est.corp"); err == nil {
+		t.Error("expected an error without a scheme")
+	}
+}
+
+func TestFetch__EST(t *testing.T) {
+	h, err := testca.NewHierarchy("est.corp", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := base64.StdEncoding.EncodeToString(certsOnly(h.Root.Certificate, h.Intermediate.Certificate))
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/est/cacerts" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pkcs7-mime")
+		w.Header().Set("Content-Transfer-Encoding", "base64")
+		// servers wrap the base64 encoding
+		for i := 0; i < len(body); i += 64 {
+			end := i + 64
+			if end > len(body) {
+				end = len(body)
+			}
+			w.Write([]byte(body[i:end] + "\r\n"))
+		}
+	}))
+	defer srv.Close()
+
+	defer func() { Bootstrap = false }()
+
+	// the server's certificate isn't trusted
+	if _, err := Fetch("est:" + srv.URL); err == nil {
+		t.Fatal("expected a TLS error without Bootstrap")
+	}
+
+	Bootstrap = true
+	res, err := Fetch("est:" + srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Source != "est" || res.URL != srv.URL+"/.well-known/est/cacerts" || res.SHA256 == "" {
+		t.Errorf("unexpected result: %#v", res)
+	}
+	if len(res.Certificates) != 2 || !res.Certificates[0].Equal(h.Root.Certificate) || !res.Certificates[1].Equal(h.Intermediate.Certificate) {
+		t.Fatalf("got %d certificates", len(res.Certificates))
+	}
+	if len(res.Fingerprints) != 2 {
+		t.Errorf("got %d fingerprints", len(res.Fingerprints))
+	}
+}
+
+func TestFetch__SCEP(t *testing.T) {
+	h, err := testca.NewHierarchy("scep.corp", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("operation") != "GetCACert" {
+			http.Error(w, "bad operation", http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Path {
+		case "/ca":
+			w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+			w.Write(h.Root.Certificate.Raw)
+		case "/ra":
+			w.Header().Set("Content-Type", "application/x-x509-ca-ra-cert")
+			w.Write(certsOnly(h.Intermediate.Certificate, h.Root.Certificate, h.Leaf))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	res, err := Fetch("scep:" + srv.URL + "/ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Source != "scep" || len(res.Certificates) != 1 || !res.Certificates[0].Equal(h.Root.Certificate) {
+		t.Errorf("got %d certificates from %s", len(res.Certificates), res.Source)
+	}
+
+	res, err = FetchSCEP(srv.URL + "/ra")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Certificates) != 3 {
+		t.Errorf("got %d certificates", len(res.Certificates))
+	}
+
+	if _, err := FetchSCEP(srv.URL + "/missing"); err == nil {
+		t.Error("expected an error")
+	}
+	if _, err := Fetch("scep"); err == nil {
+		t.Error("expected an error without a URL")
+	}
+}
+
+func TestFetch__parseCertsOnly(t *testing.T) {
+	if _, err := parseCertsOnly(certsOnly()); err == nil {
+		t.Error("expected an error without certificates")
+	}
+	if _, err := readEST([]byte("not base64 or DER")); err == nil {
+		t.Error("expected an error")
+	}
+	// raw DER is accepted as well as base64
+	root, err := testca.NewRoot("Raw", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := readEST(certsOnly(root.Certificate))
+	if err != nil || len(certs) != 1 {
+		t.Errorf("got %d certs, err=%v", len(certs), err)
+	}
+}
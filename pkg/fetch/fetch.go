@@ -0,0 +1,320 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fetch downloads the root certificates included by public root programs
+package fetch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/httputil"
+	"github.com/adamdecaf/cert-manage/pkg/progress"
+)
+
+var (
+	// NSSURL is where Mozilla's certdata.txt is downloaded from
+	NSSURL = "https://hg.mozilla.org/mozilla-central/raw-file/tip/security/nss/lib/ckfw/builtins/certdata.txt"
+
+	// MicrosoftURL is the CCADB report of CA certificates included in Microsoft's root program
+	MicrosoftURL = "https://ccadb-public.secure.force.com/microsoft/IncludedCACertificateReportForMSFTCSV"
+
+	// AppleURL lists the roots trusted by Apple's operating systems
+	AppleURL = "https://support.apple.com/en-us/HT213464"
+
+	// appleFingerprint matches the SHA-256 fingerprints on AppleURL, which are
+	// written as space separated bytes
+	appleFingerprint = regexp.MustCompile(`(?:[0-9A-Fa-f]{2}[ :]){31}[0-9A-Fa-f]{2}`)
+
+	maxDownloadSize int64 = 25 * 1024 * 1024 // bytes
+
+	// Signers are the roots trusted to sign root program bundles (e.g.
+	// authroot.stl), Microsoft's code signing roots are used when nil.
+	Signers *x509.CertPool
+
+	// SkipVerify accepts signed bundles whose signature can't be verified
+	SkipVerify bool
+
+	// Bootstrap reads from EST and SCEP servers without verifying their TLS
+	// certificate, as the CA they're serving often isn't trusted yet. What's
+	// read then needs checking out-of-band, e.g. by fingerprint.
+	Bootstrap bool
+
+	sources = map[string]func() (*Result, error){
+		"apple":     fetchApple,
+		"authroot":  fetchAuthRoot,
+		"embedded":  fetchEmbedded,
+		"nss":       fetchNSS,
+		"microsoft": fetchMicrosoft,
+	}
+)
+
+// Result holds what was downloaded from a root program. Some sources only
+// publish fingerprints, in which case Certificates is empty.
+type Result struct {
+	Source       string
+	Certificates []*x509.Certificate
+
+	// SHA256 fingerprints, hex encoded
+	Fingerprints []string
+
+	// DistrustAfter holds the date after which TLS certificates issued by
+	// a root aren't trusted, keyed by SHA256 fingerprint. Only NSS publishes
+	// this, see ReadDistrustAfter.
+	DistrustAfter map[string]time.Time
+
+	// Where, and when, the root program was downloaded from along with the
+	// hex encoded SHA256 of what was downloaded.
+	URL       string
+	Retrieved time.Time
+	SHA256    string
+
+	// Signer is who signed the bundle, it's empty for sources published
+	// without a signature (which rely on TLS) or when SkipVerify was needed.
+	Signer string
+}
+
+// downloaded records where the result was read from
+func (r *Result) downloaded(u string, bs []byte, when time.Time) *Result {
+	sum := sha256.Sum256(bs)
+	r.URL = u
+	r.Retrieved = when.UTC()
+	r.SHA256 = hex.EncodeToString(sum[:])
+	return r
+}
+
+// Sources returns the root programs which can be fetched
+func Sources() []string {
+	out := []string{"java"}
+	for k := range sources {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Fetch downloads the roots included in a given root program. Java takes an
+// optional version, e.g. java:17, otherwise the local keystore is read.
+// Enterprise CAs are read with est:<url> or scep:<url>.
+func Fetch(name string) (*Result, error) {
+	parts := strings.SplitN(name, ":", 2)
+	switch strings.ToLower(parts[0]) {
+	case "java":
+		if len(parts) == 1 {
+			return fetchLocalJava()
+		}
+		return fetchJava(strings.ToLower(parts[1]))
+	case "est", "scep":
+		if len(parts) == 1 {
+			return nil, fmt.Errorf("%s needs a server URL, e.g. %s:https://ca.example.com", parts[0], parts[0])
+		}
+		if strings.EqualFold(parts[0], "est") {
+			return FetchEST(parts[1])
+		}
+		return FetchSCEP(parts[1])
+	}
+	fn, ok := sources[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown source %q, options: %s", name, strings.Join(Sources(), ", "))
+	}
+	return fn()
+}
+
+// fetchFrom downloads u and reads it with `read`, recording the provenance
+// of the result
+func fetchFrom(u string, read func([]byte) (*Result, error)) (*Result, error) {
+	bs, err := download(u)
+	if err != nil {
+		return nil, err
+	}
+	res, err := read(bs)
+	if err != nil {
+		return nil, err
+	}
+	return res.downloaded(u, bs, time.Now()), nil
+}
+
+// verifySignedData checks the signature of a bundle against Signers. If it
+// isn't valid the bundle is refused, unless SkipVerify is set.
+func verifySignedData(sd *signedData) (*x509.Certificate, error) {
+	roots := Signers
+	if roots == nil {
+		roots = microsoftRoots()
+	}
+	signer, err := sd.verify(roots)
+	if err != nil {
+		if SkipVerify {
+			fmt.Fprintf(os.Stderr, "WARNING: %v, accepting it because of -skip-verify\n", err)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%v (use -skip-verify to accept it anyway)", err)
+	}
+	return signer, nil
+}
+
+func get(u string) (*http.Response, error) {
+	return getWith(httputil.New(), u)
+}
+
+func getWith(client *http.Client, u string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s returned %s", u, resp.Status)
+	}
+	return resp, nil
+}
+
+func download(u string) ([]byte, error) {
+	return downloadWith(httputil.New(), u)
+}
+
+func downloadWith(client *http.Client, u string) ([]byte, error) {
+	resp, err := getWith(client, u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bar := progress.NewBytes("Downloading "+u, resp.ContentLength)
+	defer bar.Done()
+	return ioutil.ReadAll(progress.Reader(io.LimitReader(resp.Body, maxDownloadSize), bar))
+}
+
+func fetchNSS() (*Result, error) {
+	return fetchFrom(NSSURL, readNSS)
+}
+
+func readNSS(bs []byte) (*Result, error) {
+	certs, err := certutil.Decode(bs)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found in certdata.txt")
+	}
+	distrustAfter, err := ReadDistrustAfter(bs)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{
+		Source:        "nss",
+		Certificates:  certs,
+		DistrustAfter: distrustAfter,
+	}
+	for i := range certs {
+		res.Fingerprints = append(res.Fingerprints, certutil.GetHexSHA256Fingerprint(*certs[i]))
+	}
+	return res, nil
+}
+
+func fetchMicrosoft() (*Result, error) {
+	return fetchFrom(MicrosoftURL, func(bs []byte) (*Result, error) {
+		return readMicrosoft(bytes.NewReader(bs))
+	})
+}
+
+// readMicrosoft parses the CCADB report, keeping roots with a status of "Included"
+func readMicrosoft(r io.Reader) (*Result, error) {
+	rdr := csv.NewReader(r)
+	rdr.FieldsPerRecord = -1
+
+	header, err := rdr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading microsoft report header: %v", err)
+	}
+	fpIdx, statusIdx := -1, -1
+	for i := range header {
+		switch strings.TrimSpace(header[i]) {
+		case "SHA-256 Fingerprint":
+			fpIdx = i
+		case "Microsoft Status":
+			statusIdx = i
+		}
+	}
+	if fpIdx < 0 {
+		return nil, errors.New("microsoft report is missing a SHA-256 Fingerprint column")
+	}
+
+	res := &Result{
+		Source: "microsoft",
+	}
+	for {
+		record, err := rdr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if fpIdx >= len(record) {
+			continue
+		}
+		if statusIdx >= 0 && statusIdx < len(record) && !strings.EqualFold(strings.TrimSpace(record[statusIdx]), "Included") {
+			continue
+		}
+		fp := strings.ToLower(strings.Replace(strings.TrimSpace(record[fpIdx]), ":", "", -1))
+		if fp != "" {
+			res.Fingerprints = append(res.Fingerprints, fp)
+		}
+	}
+	if len(res.Fingerprints) == 0 {
+		return nil, errors.New("no certificates found in microsoft report")
+	}
+	return res, nil
+}
+
+func fetchApple() (*Result, error) {
+	return fetchFrom(AppleURL, readApple)
+}
+
+// readApple finds each SHA-256 fingerprint in Apple's list of trusted roots
+func readApple(bs []byte) (*Result, error) {
+	res := &Result{
+		Source: "apple",
+	}
+	seen := make(map[string]bool)
+	for _, m := range appleFingerprint.FindAll(bs, -1) {
+		fp := strings.ToLower(strings.NewReplacer(" ", "", ":", "").Replace(string(m)))
+		if !seen[fp] {
+			seen[fp] = true
+			res.Fingerprints = append(res.Fingerprints, fp)
+		}
+	}
+	if len(res.Fingerprints) == 0 {
+		return nil, errors.New("no certificates found in apple's list")
+	}
+	return res, nil
+}
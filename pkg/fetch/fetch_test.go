@@ -0,0 +1,181 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+const microsoftReport = `"CA Owner","CA Common Name or Certificate Name","SHA-256 Fingerprint","Microsoft Status"
+"Example","Example Root","AB:CD:EF:01","Included"
+"Example","Example Disabled","12:34:56:78","Disabled"
+"Other","Other Root","9f8e7d6c","Included"
+`
+
+func TestFetch__Sources(t *testing.T) {
+	s := Sources()
+	if len(s) != 6 || s[0] != "apple" || s[1] != "authroot" || s[2] != "embedded" || s[3] != "java" || s[4] != "microsoft" || s[5] != "nss" {
+		t.Errorf("got %v", s)
+	}
+	if _, err := Fetch("other"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestFetch__readMicrosoft(t *testing.T) {
+	res, err := readMicrosoft(strings.NewReader(microsoftReport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Fingerprints) != 2 {
+		t.Fatalf("got %v", res.Fingerprints)
+	}
+	if res.Fingerprints[0] != "abcdef01" || res.Fingerprints[1] != "9f8e7d6c" {
+		t.Errorf("got %v", res.Fingerprints)
+	}
+
+	// missing fingerprint column
+	_, err = readMicrosoft(strings.NewReader("a,b,c\n1,2,3\n"))
+	if err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestFetch__readApple(t *testing.T) {
+	page := `<table><tr><td>Apple Root CA</td>
+<td>B0 B1 73 0E CB C7 FF 45 05 14 2C 49 F1 29 5E 6E DA 6B CA ED 7E 2C 68 C5 BE 91 B5 A1 10 01 F0 24</td></tr>
+<tr><td>Apple Root CA</td><td>B0 B1 73 0E CB C7 FF 45 05 14 2C 49 F1 29 5E 6E DA 6B CA ED 7E 2C 68 C5 BE 91 B5 A1 10 01 F0 24</td></tr>
+<tr><td>Serial</td><td>02 34 56</td></tr></table>`
+	res, err := readApple([]byte(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Fingerprints) != 1 || res.Fingerprints[0] != "b0b1730ecbc7ff4505142c49f1295e6eda6bcaed7e2c68c5be91b5a11001f024" {
+		t.Errorf("got %v", res.Fingerprints)
+	}
+
+	if _, err := readApple([]byte("<html></html>")); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestFetch__NSS(t *testing.T) {
+	fd, err := os.Open("../../testdata/certdata.txt.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	r, err := gzip.NewReader(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bs)
+	}))
+	defer srv.Close()
+
+	orig := NSSURL
+	NSSURL = srv.URL
+	defer func() { NSSURL = orig }()
+
+	res, err := Fetch("nss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Certificates) == 0 || len(res.Certificates) != len(res.Fingerprints) {
+		t.Errorf("got %d certificates and %d fingerprints", len(res.Certificates), len(res.Fingerprints))
+	}
+
+	// provenance
+	sum := sha256.Sum256(bs)
+	if res.URL != srv.URL || res.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("got URL=%s SHA256=%s", res.URL, res.SHA256)
+	}
+	if res.Retrieved.IsZero() || time.Since(res.Retrieved) > time.Minute {
+		t.Errorf("got Retrieved=%v", res.Retrieved)
+	}
+}
+
+func TestFetch__badStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	orig := MicrosoftURL
+	MicrosoftURL = srv.URL
+	defer func() { MicrosoftURL = orig }()
+
+	_, err := Fetch("microsoft")
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected 404 error, got %v", err)
+	}
+}
+
+func TestFetch__distrustAfter(t *testing.T) {
+	fd, err := os.Open("../../testdata/certdata.txt.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	r, err := gzip.NewReader(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// distrust the first root for TLS after 2019-12-01
+	var octal bytes.Buffer
+	for _, b := range []byte("191201000000Z") {
+		fmt.Fprintf(&octal, "\\%03o", b)
+	}
+	policy := []byte("CKA_NSS_MOZILLA_CA_POLICY CK_BBOOL CK_TRUE\n")
+	idx := bytes.Index(bs, policy) + len(policy)
+	distrust := "CKA_NSS_SERVER_DISTRUST_AFTER MULTILINE_OCTAL\n" + octal.String() + "\nEND\nCKA_NSS_EMAIL_DISTRUST_AFTER CK_BBOOL CK_FALSE\n"
+	bs = append(bs[:idx:idx], append([]byte(distrust), bs[idx:]...)...)
+
+	res, err := readNSS(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.DistrustAfter) != 1 {
+		t.Fatalf("got %v", res.DistrustAfter)
+	}
+	fp := certutil.GetHexSHA256Fingerprint(*res.Certificates[0])
+	if when := res.DistrustAfter[fp]; !when.Equal(time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %v", res.DistrustAfter)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/progress"
+	"github.com/adamdecaf/cert-manage/pkg/store"
+)
+
+var (
+	// JavaCacertsURLs lists the directory of OpenJDK's cacerts sources for
+	// each release, one PEM file per root.
+	JavaCacertsURLs = map[string]string{
+		"8":  "https://api.github.com/repos/openjdk/jdk8u/contents/jdk/make/data/cacerts",
+		"11": "https://api.github.com/repos/openjdk/jdk11u/contents/make/data/cacerts",
+		"17": "https://api.github.com/repos/openjdk/jdk17u/contents/src/java.base/share/data/cacerts",
+		"21": "https://api.github.com/repos/openjdk/jdk21u/contents/src/java.base/share/data/cacerts",
+	}
+)
+
+// JavaVersions returns the OpenJDK releases whose cacerts can be fetched
+func JavaVersions() []string {
+	var out []string
+	for k := range JavaCacertsURLs {
+		out = append(out, k)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if len(out[i]) != len(out[j]) {
+			return len(out[i]) < len(out[j])
+		}
+		return out[i] < out[j]
+	})
+	return out
+}
+
+// fetchJava downloads each root in the cacerts source of an OpenJDK release.
+// The Result's SHA256 covers every file, in name order.
+func fetchJava(version string) (*Result, error) {
+	version = strings.TrimPrefix(strings.TrimPrefix(version, "1."), "jdk")
+	u, ok := JavaCacertsURLs[version]
+	if !ok {
+		return nil, fmt.Errorf("unknown java version %q, options: %s", version, strings.Join(JavaVersions(), ", "))
+	}
+	bs, err := download(u)
+	if err != nil {
+		return nil, err
+	}
+	var listing []struct {
+		Name        string `json:"name"`
+		Type        string `json:"type"`
+		DownloadURL string `json:"download_url"`
+	}
+	if err := json.Unmarshal(bs, &listing); err != nil {
+		return nil, fmt.Errorf("reading java %s cacerts listing: %v", version, err)
+	}
+	sort.Slice(listing, func(i, j int) bool { return listing[i].Name < listing[j].Name })
+
+	var all bytes.Buffer
+	bar := progress.New(fmt.Sprintf("Downloading OpenJDK %s cacerts", version), len(listing))
+	defer bar.Done()
+	for i := range listing {
+		bar.Increment()
+		if listing[i].Type != "file" || strings.HasPrefix(listing[i].Name, "README") {
+			continue
+		}
+		resp, err := get(listing[i].DownloadURL)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(&all, io.LimitReader(resp.Body, maxDownloadSize))
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		all.WriteByte('\n')
+	}
+
+	res, err := readCertificates("java:"+version, all.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return res.downloaded(u, all.Bytes(), time.Now()), nil
+}
+
+// fetchLocalJava reads the keystore of the java install on this machine
+func fetchLocalJava() (*Result, error) {
+	s := store.JavaStore()
+	certs, err := s.List(&store.ListOptions{
+		Trusted: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	kpath := s.GetInfo().Location
+	bs, err := ioutil.ReadFile(kpath)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{
+		Source:       "java",
+		Certificates: certs,
+	}
+	for i := range certs {
+		res.Fingerprints = append(res.Fingerprints, certutil.GetHexSHA256Fingerprint(*certs[i]))
+	}
+	return res.downloaded("file://"+kpath, bs, time.Now()), nil
+}
+
+func readCertificates(source string, bs []byte) (*Result, error) {
+	certs, err := certutil.Decode(bs)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found in " + source)
+	}
+	res := &Result{
+		Source:       source,
+		Certificates: certs,
+	}
+	for i := range certs {
+		res.Fingerprints = append(res.Fingerprints, certutil.GetHexSHA256Fingerprint(*certs[i]))
+	}
+	return res, nil
+}
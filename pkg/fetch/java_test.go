@@ -0,0 +1,76 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+)
+
+func TestFetch__java(t *testing.T) {
+	a, err := testca.NewRoot("Java Root A", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := testca.NewRoot("Java Root B", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	mux.HandleFunc("/cacerts", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]map[string]string{
+			{"name": "rootb", "type": "file", "download_url": srv.URL + "/rootb"},
+			{"name": "README", "type": "file", "download_url": srv.URL + "/README"},
+			{"name": "roota", "type": "file", "download_url": srv.URL + "/roota"},
+		})
+	})
+	for name, ca := range map[string]*testca.CA{"/roota": a, "/rootb": b} {
+		ca := ca
+		mux.HandleFunc(name, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("Owner: " + ca.Certificate.Subject.CommonName + "\n"))
+			pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate.Raw})
+		})
+	}
+
+	orig := JavaCacertsURLs["17"]
+	JavaCacertsURLs["17"] = srv.URL + "/cacerts"
+	defer func() { JavaCacertsURLs["17"] = orig }()
+
+	res, err := Fetch("java:17")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Source != "java:17" || res.URL != srv.URL+"/cacerts" || res.SHA256 == "" {
+		t.Errorf("got %#v", res)
+	}
+	// files are read in name order
+	if len(res.Fingerprints) != 2 || res.Fingerprints[0] != certutil.GetHexSHA256Fingerprint(*a.Certificate) {
+		t.Errorf("got %v", res.Fingerprints)
+	}
+
+	if _, err := Fetch("java:7"); err == nil || !strings.Contains(err.Error(), "8, 11, 17, 21") {
+		t.Errorf("expected unknown version, got %v", err)
+	}
+}
@@ -0,0 +1,356 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+
+	// register the hashes signatures can use
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	// oidCTLSigning is Microsoft's szOID_KP_CTL_USAGE_SIGNING
+	oidCTLSigning = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 3, 1}
+
+	digestAlgorithms = map[string]crypto.Hash{
+		"1.3.14.3.2.26":          crypto.SHA1,
+		"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+		"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+		"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+	}
+)
+
+// signedData is the content of a PKCS#7 (RFC 2315) SignedData message
+type signedData struct {
+	// content is the DER encoding of what was signed
+	content asn1.RawValue
+
+	certificates []*x509.Certificate
+	signers      []signerInfo
+}
+
+type signerInfo struct {
+	issuer []byte
+	serial *big.Int
+	digest crypto.Hash
+
+	// attributes is the raw [0] IMPLICIT authenticatedAttributes
+	attributes *asn1.RawValue
+	signature  []byte
+}
+
+// elements returns the children of a DER encoded SEQUENCE or SET
+func elements(der []byte) ([]asn1.RawValue, error) {
+	var outer asn1.RawValue
+	rest, err := asn1.Unmarshal(der, &outer)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("trailing data after ASN.1 element")
+	}
+	if !outer.IsCompound {
+		return nil, fmt.Errorf("expected an ASN.1 SEQUENCE or SET, found tag %d", outer.Tag)
+	}
+	return children(outer.Bytes)
+}
+
+func children(bs []byte) ([]asn1.RawValue, error) {
+	var out []asn1.RawValue
+	for len(bs) > 0 {
+		var rv asn1.RawValue
+		rest, err := asn1.Unmarshal(bs, &rv)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rv)
+		bs = rest
+	}
+	return out, nil
+}
+
+func isContext(rv asn1.RawValue, tag int) bool {
+	return rv.Class == asn1.ClassContextSpecific && rv.Tag == tag
+}
+
+// parseSignedData reads a DER encoded ContentInfo holding a SignedData
+func parseSignedData(der []byte) (*signedData, error) {
+	info, err := elements(der)
+	if err != nil {
+		return nil, err
+	}
+	var ct asn1.ObjectIdentifier
+	if len(info) != 2 || !isContext(info[1], 0) {
+		return nil, errors.New("malformed PKCS#7 ContentInfo")
+	}
+	if _, err := asn1.Unmarshal(info[0].FullBytes, &ct); err != nil || !ct.Equal(oidSignedData) {
+		return nil, errors.New("PKCS#7 content isn't SignedData")
+	}
+
+	// SignedData ::= SEQUENCE { version, digestAlgorithms, contentInfo,
+	//   certificates [0] IMPLICIT OPTIONAL, crls [1] IMPLICIT OPTIONAL, signerInfos }
+	fields, err := elements(info[1].Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) < 4 {
+		return nil, errors.New("malformed PKCS#7 SignedData")
+	}
+	sd := &signedData{}
+
+	inner, err := elements(fields[2].FullBytes)
+	if err != nil {
+		return nil, err
+	}
+	// "certs-only" messages (e.g. from EST or SCEP) carry no content
+	switch {
+	case len(inner) == 2 && isContext(inner[1], 0):
+		if _, err := asn1.Unmarshal(inner[1].Bytes, &sd.content); err != nil {
+			return nil, err
+		}
+	case len(inner) != 1:
+		return nil, errors.New("malformed PKCS#7 SignedData content")
+	}
+
+	for _, f := range fields[3 : len(fields)-1] {
+		if isContext(f, 0) {
+			sd.certificates, err = x509.ParseCertificates(f.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("reading PKCS#7 certificates: %v", err)
+			}
+		}
+	}
+
+	infos, err := elements(fields[len(fields)-1].FullBytes)
+	if err != nil {
+		return nil, err
+	}
+	for i := range infos {
+		si, err := parseSignerInfo(infos[i].FullBytes)
+		if err != nil {
+			return nil, err
+		}
+		sd.signers = append(sd.signers, *si)
+	}
+	return sd, nil
+}
+
+// parseCertsOnly returns the certificates of a DER encoded "certs-only"
+// PKCS#7 message, which is SignedData without content or signers
+func parseCertsOnly(der []byte) ([]*x509.Certificate, error) {
+	sd, err := parseSignedData(der)
+	if err != nil {
+		return nil, err
+	}
+	if len(sd.certificates) == 0 {
+		return nil, errors.New("PKCS#7 message has no certificates")
+	}
+	return sd.certificates, nil
+}
+
+// parseSignerInfo reads a SignerInfo ::= SEQUENCE { version,
+// issuerAndSerialNumber, digestAlgorithm, authenticatedAttributes [0]
+// IMPLICIT OPTIONAL, digestEncryptionAlgorithm, encryptedDigest,
+// unauthenticatedAttributes [1] IMPLICIT OPTIONAL }
+func parseSignerInfo(der []byte) (*signerInfo, error) {
+	fields, err := elements(der)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) < 5 {
+		return nil, errors.New("malformed PKCS#7 SignerInfo")
+	}
+	si := &signerInfo{}
+
+	sid, err := elements(fields[1].FullBytes)
+	if err != nil || len(sid) != 2 {
+		return nil, errors.New("PKCS#7 signer isn't identified by issuer and serial number")
+	}
+	si.issuer = sid[0].FullBytes
+	if _, err := asn1.Unmarshal(sid[1].FullBytes, &si.serial); err != nil {
+		return nil, err
+	}
+
+	alg, err := elements(fields[2].FullBytes)
+	if err != nil || len(alg) == 0 {
+		return nil, errors.New("malformed PKCS#7 digest algorithm")
+	}
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(alg[0].FullBytes, &oid); err != nil {
+		return nil, err
+	}
+	h, ok := digestAlgorithms[oid.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported PKCS#7 digest algorithm %s", oid)
+	}
+	si.digest = h
+
+	rest := fields[3:]
+	if isContext(rest[0], 0) {
+		si.attributes = &rest[0]
+		rest = rest[1:]
+	}
+	if len(rest) < 2 {
+		return nil, errors.New("PKCS#7 SignerInfo has no signature")
+	}
+	if _, err := asn1.Unmarshal(rest[1].FullBytes, &si.signature); err != nil {
+		return nil, err
+	}
+	return si, nil
+}
+
+// verify checks each signature over the content and that each signer chains
+// to `roots`. The signing certificate of the first signer is returned.
+func (sd *signedData) verify(roots *x509.CertPool) (*x509.Certificate, error) {
+	if len(sd.signers) == 0 {
+		return nil, errors.New("PKCS#7 content isn't signed")
+	}
+	intermediates := x509.NewCertPool()
+	for i := range sd.certificates {
+		intermediates.AddCert(sd.certificates[i])
+	}
+
+	var first *x509.Certificate
+	for _, si := range sd.signers {
+		cert := sd.signerCertificate(si)
+		if cert == nil {
+			return nil, errors.New("PKCS#7 signing certificate not included")
+		}
+		if err := si.verify(cert, sd.content); err != nil {
+			return nil, err
+		}
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !canSignCTL(cert) {
+			return nil, fmt.Errorf("PKCS#7 signer %s isn't allowed to sign trust lists or code", certutil.StringifyPKIXName(cert.Subject))
+		}
+		if first == nil {
+			first = cert
+		}
+	}
+	return first, nil
+}
+
+// canSignCTL returns true if cert has the CTL signing or code signing
+// extended key usage. The chain's usages aren't checked, as Microsoft's
+// intermediates don't all list them.
+func canSignCTL(cert *x509.Certificate) bool {
+	for _, u := range cert.ExtKeyUsage {
+		if u == x509.ExtKeyUsageCodeSigning {
+			return true
+		}
+	}
+	for _, u := range cert.UnknownExtKeyUsage {
+		if u.Equal(oidCTLSigning) {
+			return true
+		}
+	}
+	return false
+}
+
+func (sd *signedData) signerCertificate(si signerInfo) *x509.Certificate {
+	for _, c := range sd.certificates {
+		if bytes.Equal(c.RawIssuer, si.issuer) && c.SerialNumber.Cmp(si.serial) == 0 {
+			return c
+		}
+	}
+	return nil
+}
+
+func (si signerInfo) verify(cert *x509.Certificate, content asn1.RawValue) error {
+	algo, err := signatureAlgorithm(cert.PublicKeyAlgorithm, si.digest)
+	if err != nil {
+		return err
+	}
+	if si.attributes == nil {
+		// without attributes the content itself is signed
+		return cert.CheckSignature(algo, content.Bytes, si.signature)
+	}
+
+	// The messageDigest attribute covers the content octets, but not the
+	// tag and length, of the content.
+	attrs, err := children(si.attributes.Bytes)
+	if err != nil {
+		return err
+	}
+	var expected []byte
+	for i := range attrs {
+		attr, err := elements(attrs[i].FullBytes)
+		if err != nil || len(attr) != 2 {
+			continue
+		}
+		var oid asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(attr[0].FullBytes, &oid); err != nil || !oid.Equal(oidMessageDigest) {
+			continue
+		}
+		values, err := children(attr[1].Bytes)
+		if err == nil && len(values) == 1 {
+			expected = values[0].Bytes
+		}
+	}
+	if expected == nil {
+		return errors.New("PKCS#7 signer has no messageDigest attribute")
+	}
+	h := si.digest.New()
+	h.Write(content.Bytes)
+	if !bytes.Equal(h.Sum(nil), expected) {
+		return errors.New("PKCS#7 content doesn't match its signed digest")
+	}
+
+	// The attributes are signed as a SET rather than their implicit tag
+	signed := append([]byte{0x31}, si.attributes.FullBytes[1:]...)
+	return cert.CheckSignature(algo, signed, si.signature)
+}
+
+func signatureAlgorithm(key x509.PublicKeyAlgorithm, h crypto.Hash) (x509.SignatureAlgorithm, error) {
+	algos := map[x509.PublicKeyAlgorithm]map[crypto.Hash]x509.SignatureAlgorithm{
+		x509.RSA: {
+			crypto.SHA1:   x509.SHA1WithRSA,
+			crypto.SHA256: x509.SHA256WithRSA,
+			crypto.SHA384: x509.SHA384WithRSA,
+			crypto.SHA512: x509.SHA512WithRSA,
+		},
+		x509.ECDSA: {
+			crypto.SHA1:   x509.ECDSAWithSHA1,
+			crypto.SHA256: x509.ECDSAWithSHA256,
+			crypto.SHA384: x509.ECDSAWithSHA384,
+			crypto.SHA512: x509.ECDSAWithSHA512,
+		},
+	}
+	if algo, ok := algos[key][h]; ok {
+		return algo, nil
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported PKCS#7 signature with %v key", key)
+}
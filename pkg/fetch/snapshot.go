@@ -0,0 +1,164 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+)
+
+const snapshotFile = "snapshot.json"
+
+var (
+	// SnapshotDir holds a snapshot saved by 'embedded -refresh', which is
+	// used over the one built into cert-manage. Only the built-in snapshot
+	// is used when it's empty.
+	SnapshotDir = ""
+
+	embeddedOnce   sync.Once
+	embeddedResult *Result
+	embeddedErr    error
+)
+
+// snapshot is how Mozilla's roots are stored, both in the binary
+// (snapshot_data.go) and when refreshed
+type snapshot struct {
+	URL           string               `json:"url"`
+	Retrieved     time.Time            `json:"retrieved"`
+	SHA256        string               `json:"sha256"`
+	DistrustAfter map[string]time.Time `json:"distrustAfter,omitempty"`
+	Certificates  [][]byte             `json:"certificates"`
+}
+
+// NewSnapshot reads Mozilla's certdata.txt, recording where (and when) it
+// came from, to be saved with MarshalSnapshot.
+func NewSnapshot(certdata []byte, source string, when time.Time) (*Result, error) {
+	res, err := readNSS(certdata)
+	if err != nil {
+		return nil, err
+	}
+	return res.downloaded(source, certdata, when), nil
+}
+
+// MarshalSnapshot encodes the roots of an nss Result, which are read back
+// with Embedded or Snapshot.
+func MarshalSnapshot(res *Result) ([]byte, error) {
+	if res == nil || len(res.Certificates) == 0 {
+		return nil, errors.New("snapshot has no certificates")
+	}
+	s := snapshot{
+		URL:           res.URL,
+		Retrieved:     res.Retrieved.UTC(),
+		SHA256:        res.SHA256,
+		DistrustAfter: res.DistrustAfter,
+	}
+	for i := range res.Certificates {
+		s.Certificates = append(s.Certificates, res.Certificates[i].Raw)
+	}
+	return json.MarshalIndent(s, "", "  ")
+}
+
+func unmarshalSnapshot(bs []byte) (*Result, error) {
+	var s snapshot
+	if err := json.Unmarshal(bs, &s); err != nil {
+		return nil, fmt.Errorf("reading snapshot: %v", err)
+	}
+	res := &Result{
+		Source:        "nss",
+		DistrustAfter: s.DistrustAfter,
+		URL:           s.URL,
+		Retrieved:     s.Retrieved,
+		SHA256:        s.SHA256,
+	}
+	for i := range s.Certificates {
+		cert, err := x509.ParseCertificate(s.Certificates[i])
+		if err != nil {
+			return nil, fmt.Errorf("reading snapshot certificate %d: %v", i, err)
+		}
+		res.Certificates = append(res.Certificates, cert)
+		res.Fingerprints = append(res.Fingerprints, certutil.GetHexSHA256Fingerprint(*cert))
+	}
+	if len(res.Certificates) == 0 {
+		return nil, errors.New("snapshot has no certificates")
+	}
+	return res, nil
+}
+
+// Embedded returns the snapshot of Mozilla's roots built into cert-manage,
+// so they're available offline right after install. It's regenerated with
+// 'make snapshot' before each release.
+func Embedded() (*Result, error) {
+	embeddedOnce.Do(func() {
+		embeddedResult, embeddedErr = unmarshalSnapshot([]byte(embeddedSnapshot))
+	})
+	return embeddedResult, embeddedErr
+}
+
+// Snapshot returns the snapshot saved in SnapshotDir by 'embedded -refresh',
+// or the built-in snapshot when there isn't one.
+func Snapshot() (*Result, error) {
+	if SnapshotDir != "" {
+		bs, err := ioutil.ReadFile(filepath.Join(SnapshotDir, snapshotFile))
+		if err == nil {
+			return unmarshalSnapshot(bs)
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return Embedded()
+}
+
+// SaveSnapshot writes res into SnapshotDir, where it's used over the
+// built-in snapshot.
+func SaveSnapshot(res *Result) error {
+	if SnapshotDir == "" {
+		return errors.New("no directory to save the snapshot in")
+	}
+	bs, err := MarshalSnapshot(res)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(SnapshotDir, file.TempDirPermissions); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(SnapshotDir, snapshotFile), bs, file.TempFilePermissions)
+}
+
+// ResetSnapshot removes a refreshed snapshot, so the built-in one is used
+func ResetSnapshot() error {
+	if SnapshotDir == "" {
+		return nil
+	}
+	err := os.Remove(filepath.Join(SnapshotDir, snapshotFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func fetchEmbedded() (*Result, error) {
+	return Snapshot()
+}
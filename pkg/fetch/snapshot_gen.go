@@ -0,0 +1,157 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build ignore
+
+// Generates snapshot_data.go.
+//
+// The snapshot is Mozilla's roots (certdata.txt) built into cert-manage, so
+// commands which need a baseline of trusted roots work offline right after
+// install. The latest certdata.txt is downloaded, or a local certdata.txt
+// (or certdata.txt.gz, or a PEM bundle built from it like certifi's
+// cacert.pem) can be given as the first argument to pin a release. Local
+// files need -source, the URL they were published at, and -published, the
+// date of that release, which are recorded in the snapshot. PEM bundles
+// don't carry distrust-after dates.
+//
+// Snapshots with expired roots are refused, so test fixtures aren't shipped.
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/fetch"
+	"github.com/adamdecaf/cert-manage/pkg/httputil"
+)
+
+var (
+	outputFilename = "pkg/fetch/snapshot_data.go"
+
+	flagSource    = flag.String("source", "", "URL a local certdata.txt (or PEM bundle) was published at")
+	flagPublished = flag.String("published", "", "Date (YYYY-MM-DD) a local certdata.txt (or PEM bundle) was published")
+)
+
+func main() {
+	flag.Parse()
+
+	certdata, source, err := getCertdata()
+	if err != nil {
+		log.Fatalf("error getting certdata.txt, err=%v", err)
+	}
+	now, retrieved := time.Now(), time.Now()
+	if flag.Arg(0) != "" {
+		retrieved, err = time.Parse("2006-01-02", *flagPublished)
+		if err != nil {
+			log.Fatalf("-published must be the YYYY-MM-DD date %s was released, err=%v", flag.Arg(0), err)
+		}
+	}
+	res, err := fetch.NewSnapshot(certdata, source, retrieved)
+	if err != nil {
+		log.Fatalf("error reading certdata.txt, err=%v", err)
+	}
+	var expired []string
+	for _, c := range res.Certificates {
+		if now.After(c.NotAfter) {
+			expired = append(expired, c.Subject.CommonName)
+		}
+	}
+	if len(expired) > 0 {
+		log.Fatalf("refusing snapshot with %d expired roots (%s), is %s current?", len(expired), strings.Join(expired, ", "), source)
+	}
+	bs, err := fetch.MarshalSnapshot(res)
+	if err != nil {
+		log.Fatalf("error encoding snapshot, err=%v", err)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Generated from %s (sha256 %s) by snapshot_gen.go, any modifications will be overwritten
+package fetch
+
+// embeddedSnapshot holds %d roots, see Embedded
+const embeddedSnapshot = %s
+`, res.URL, res.SHA256, len(res.Certificates), "`"+string(bs)+"`")
+
+	// format source code and write to snapshot_data.go
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("error formatting output code, err=%v", err)
+	}
+	if err := ioutil.WriteFile(outputFilename, out, 0644); err != nil {
+		log.Fatalf("error writing file, err=%v", err)
+	}
+	fmt.Printf("Wrote %d roots to %s\n", len(res.Certificates), outputFilename)
+}
+
+// getCertdata returns certdata.txt and where it was read from
+func getCertdata() ([]byte, string, error) {
+	if path := flag.Arg(0); path != "" {
+		if !strings.HasPrefix(*flagSource, "https://") {
+			return nil, "", fmt.Errorf("-source must be the https URL %s was published at", path)
+		}
+		bs, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, "", err
+		}
+		if strings.HasSuffix(path, ".gz") {
+			r, err := gzip.NewReader(bytes.NewReader(bs))
+			if err != nil {
+				return nil, "", err
+			}
+			bs, err = ioutil.ReadAll(r)
+			if err != nil {
+				return nil, "", err
+			}
+		}
+		return bs, *flagSource, nil
+	}
+
+	req, err := http.NewRequest("GET", fetch.NSSURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Close = true
+	resp, err := httputil.New().Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("got %s from %s", resp.Status, fetch.NSSURL)
+	}
+	bs, err := ioutil.ReadAll(resp.Body)
+	return bs, fetch.NSSURL, err
+}
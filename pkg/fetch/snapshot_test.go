@@ -0,0 +1,114 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetch__embedded(t *testing.T) {
+	res, err := Embedded()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Certificates) == 0 || len(res.Certificates) != len(res.Fingerprints) {
+		t.Fatalf("got %d certificates and %d fingerprints", len(res.Certificates), len(res.Fingerprints))
+	}
+	if res.Source != "nss" || res.URL == "" || res.SHA256 == "" || res.Retrieved.IsZero() {
+		t.Errorf("got %#v", res)
+	}
+	if !strings.HasPrefix(res.URL, "https://") {
+		t.Errorf("embedded snapshot should record where it was published, got %s", res.URL)
+	}
+
+	// without a refreshed snapshot the embedded one is used
+	orig := SnapshotDir
+	SnapshotDir = ""
+	defer func() { SnapshotDir = orig }()
+	other, err := Fetch("embedded")
+	if err != nil || other.SHA256 != res.SHA256 {
+		t.Errorf("got %v, err=%v", other, err)
+	}
+}
+
+func TestFetch__snapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	orig := SnapshotDir
+	SnapshotDir = dir
+	defer func() { SnapshotDir = orig }()
+
+	fd, err := os.Open("../../testdata/certdata.txt.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	r, err := gzip.NewReader(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	when := time.Date(2018, 4, 1, 0, 0, 0, 0, time.UTC)
+	res, err := NewSnapshot(bs, "certdata.txt", when)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// keep a few roots so it's different from the embedded snapshot
+	res.Certificates = res.Certificates[:3]
+	if err := SaveSnapshot(res); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Certificates) != 3 || snap.URL != "certdata.txt" || !snap.Retrieved.Equal(when) || snap.SHA256 != res.SHA256 {
+		t.Errorf("got %#v", snap)
+	}
+	if len(snap.DistrustAfter) != len(res.DistrustAfter) {
+		t.Errorf("got %d distrust-after dates, expected %d", len(snap.DistrustAfter), len(res.DistrustAfter))
+	}
+
+	// back to the embedded snapshot
+	if err := ResetSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ResetSnapshot(); err != nil {
+		t.Errorf("removing twice: %v", err)
+	}
+	snap, err = Snapshot()
+	if err != nil || len(snap.Certificates) == 3 {
+		t.Errorf("got %d certificates, err=%v", len(snap.Certificates), err)
+	}
+
+	if _, err := MarshalSnapshot(&Result{}); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := unmarshalSnapshot([]byte("{}")); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,396 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gpg reads and changes the ownertrust of keys in a GnuPG keyring.
+//
+// Ownertrust is how much a key is trusted to certify other keys, so keys
+// with marginal, full or ultimate ownertrust are the keyring's trust
+// anchors. Removing trust sets a key's ownertrust to undefined, the key
+// itself stays in the keyring.
+//
+// Docs:
+//  - https://github.com/gpg/gnupg/blob/master/doc/DETAILS
+package gpg
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
+)
+
+var (
+	// Command is the gpg binary which is run, e.g. gpg2 on older systems
+	Command = "gpg"
+
+	// algorithms are the OpenPGP public key algorithm ids, RFC 4880 9.1
+	algorithms = map[int]string{
+		1:  "RSA",
+		2:  "RSA",
+		3:  "RSA",
+		16: "ElGamal",
+		17: "DSA",
+		18: "ECDH",
+		19: "ECDSA",
+		22: "EdDSA",
+	}
+)
+
+// Trust is a key's ownertrust, as listed by gpg --with-colons
+type Trust string
+
+const (
+	TrustUnknown   Trust = "-"
+	TrustUndefined Trust = "q"
+	TrustNever     Trust = "n"
+	TrustMarginal  Trust = "m"
+	TrustFull      Trust = "f"
+	TrustUltimate  Trust = "u"
+)
+
+// String returns a readable name for the trust level
+func (t Trust) String() string {
+	switch t {
+	case TrustUndefined:
+		return "undefined"
+	case TrustNever:
+		return "never"
+	case TrustMarginal:
+		return "marginal"
+	case TrustFull:
+		return "full"
+	case TrustUltimate:
+		return "ultimate"
+	}
+	return "unknown"
+}
+
+// Key is a primary public key in the keyring
+type Key struct {
+	Fingerprint string
+	UserIDs     []string
+
+	Algorithm string
+	Bits      int
+	Curve     string
+
+	Created time.Time
+	Expires time.Time // zero if the key doesn't expire
+
+	OwnerTrust Trust
+	Revoked    bool
+
+	// Secret is set if the keyring also has the secret key, which makes it
+	// one of the user's own keys
+	Secret bool
+}
+
+// Trusted returns true if the key is trusted to certify other keys
+func (k Key) Trusted() bool {
+	return k.OwnerTrust == TrustMarginal || k.OwnerTrust == TrustFull || k.OwnerTrust == TrustUltimate
+}
+
+// Name returns the key's primary user id, or its fingerprint
+func (k Key) Name() string {
+	if len(k.UserIDs) > 0 {
+		return k.UserIDs[0]
+	}
+	return k.Fingerprint
+}
+
+// Version returns the version of gpg, or an empty string if it can't be found
+func Version() string {
+	out, err := interrupt.Command(Command, "--version").Output()
+	if err != nil {
+		return ""
+	}
+	// gpg (GnuPG) 2.2.40
+	line := strings.SplitN(string(out), "\n", 2)[0]
+	if idx := strings.LastIndex(line, " "); idx > 0 {
+		return strings.TrimSpace(line[idx+1:])
+	}
+	return ""
+}
+
+// Home returns the directory of the keyring gpg uses
+func Home() string {
+	if home := os.Getenv("GNUPGHOME"); home != "" {
+		return home
+	}
+	return filepath.Join(file.HomeDir(), ".gnupg")
+}
+
+// List returns every primary key in the keyring, sorted by fingerprint
+func List() ([]Key, error) {
+	out, err := run(nil, "--with-colons", "--fixed-list-mode", "--fingerprint", "--list-keys")
+	if err != nil {
+		return nil, err
+	}
+	keys, err := parseKeys(out)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err = run(nil, "--with-colons", "--fixed-list-mode", "--fingerprint", "--list-secret-keys")
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := parseKeys(out)
+	if err != nil {
+		return nil, err
+	}
+	secret := make(map[string]bool)
+	for i := range secrets {
+		secret[secrets[i].Fingerprint] = true
+	}
+	for i := range keys {
+		keys[i].Secret = secret[keys[i].Fingerprint]
+	}
+	return keys, nil
+}
+
+// parseKeys reads the primary keys from gpg --with-colons --fixed-list-mode
+// --fingerprint output. Subkeys are skipped.
+func parseKeys(out []byte) ([]Key, error) {
+	var keys []Key
+	var current *Key
+	inPrimary := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 10 {
+			continue
+		}
+		switch fields[0] {
+		case "pub", "sec":
+			keys = append(keys, Key{})
+			current = &keys[len(keys)-1]
+			inPrimary = true
+
+			current.Revoked = fields[1] == "r"
+			current.Bits, _ = strconv.Atoi(fields[2])
+			if algo, err := strconv.Atoi(fields[3]); err == nil {
+				current.Algorithm = algorithms[algo]
+				if current.Algorithm == "" {
+					current.Algorithm = fields[3]
+				}
+			}
+			current.Created = parseTime(fields[5])
+			current.Expires = parseTime(fields[6])
+			current.OwnerTrust = Trust(fields[8])
+			if current.OwnerTrust == "" {
+				current.OwnerTrust = TrustUnknown
+			}
+			if len(fields) > 16 {
+				current.Curve = fields[16]
+			}
+
+		case "sub", "ssb":
+			inPrimary = false
+
+		case "fpr":
+			if current != nil && inPrimary && current.Fingerprint == "" {
+				current.Fingerprint = strings.ToUpper(fields[9])
+			}
+
+		case "uid":
+			if current != nil && fields[1] != "r" {
+				current.UserIDs = append(current.UserIDs, unescape(fields[9]))
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		if keys[i].Fingerprint == "" {
+			return nil, errors.New("gpg: key listed without a fingerprint")
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Fingerprint < keys[j].Fingerprint })
+	return keys, nil
+}
+
+// parseTime reads a field which is either seconds since the epoch or an
+// ISO 8601 timestamp (e.g. 20180101T000000)
+func parseTime(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(n, 0).UTC()
+	}
+	t, _ := time.Parse("20060102T150405", s)
+	return t
+}
+
+// unescape decodes the C style escapes (e.g. \x3a for ':') in user ids
+func unescape(s string) string {
+	if !strings.Contains(s, `\x`) {
+		return s
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && s[i+1] == 'x' {
+			if b, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+				buf.WriteByte(byte(b))
+				i += 3
+				continue
+			}
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String()
+}
+
+// Distrust sets the ownertrust of each key to undefined
+func Distrust(fingerprints []string) error {
+	if len(fingerprints) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	for i := range fingerprints {
+		fmt.Fprintf(&buf, "%s:2:\n", fingerprints[i])
+	}
+	_, err := run(&buf, "--import-ownertrust")
+	return err
+}
+
+// Backup writes the ownertrust of every key to a new file in dir and
+// returns its path
+func Backup(dir string) (string, error) {
+	out, err := run(nil, "--export-ownertrust")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, file.TempDirPermissions); err != nil {
+		return "", err
+	}
+	where := filepath.Join(dir, "ownertrust-"+timeutil.Stamp(time.Now())+".txt")
+	if err := ioutil.WriteFile(where, out, file.TempFilePermissions); err != nil {
+		return "", err
+	}
+	return where, nil
+}
+
+// LatestBackup returns the newest backup in dir, or an empty string if
+// there are none
+func LatestBackup(dir string) (string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	file.SortFileInfos(fis)
+	for i := len(fis) - 1; i >= 0; i-- {
+		if strings.HasPrefix(fis[i].Name(), "ownertrust-") {
+			return filepath.Join(dir, fis[i].Name()), nil
+		}
+	}
+	return "", nil
+}
+
+// ReadBackup returns the ownertrust of each key in a backup, keyed by
+// fingerprint. Keys with undefined trust aren't included.
+func ReadBackup(path string) (map[string]Trust, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]Trust)
+	scanner := bufio.NewScanner(bytes.NewReader(bs))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, ":")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("gpg: invalid ownertrust line %q in %s", line, path)
+		}
+		n, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("gpg: invalid ownertrust line %q in %s", line, path)
+		}
+		// see TRUST_* in gnupg's g10/trustdb.h
+		switch n & 0xf {
+		case 3:
+			out[strings.ToUpper(parts[0])] = TrustNever
+		case 4:
+			out[strings.ToUpper(parts[0])] = TrustMarginal
+		case 5:
+			out[strings.ToUpper(parts[0])] = TrustFull
+		case 6:
+			out[strings.ToUpper(parts[0])] = TrustUltimate
+		}
+	}
+	return out, scanner.Err()
+}
+
+// Restore sets the ownertrust of every key back to what it was in a backup.
+// Keys trusted since the backup was taken have their trust removed.
+func Restore(path string) error {
+	backup, err := ReadBackup(path)
+	if err != nil {
+		return err
+	}
+	keys, err := List()
+	if err != nil {
+		return err
+	}
+	var added []string
+	for i := range keys {
+		if _, ok := backup[keys[i].Fingerprint]; !ok && keys[i].Trusted() {
+			added = append(added, keys[i].Fingerprint)
+		}
+	}
+	if err := Distrust(added); err != nil {
+		return err
+	}
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	_, err = run(bytes.NewReader(bs), "--import-ownertrust")
+	return err
+}
+
+// run executes gpg in batch mode, so it never prompts, and returns stdout
+func run(stdin io.Reader, args ...string) ([]byte, error) {
+	cmd := interrupt.Command(Command, append([]string{"--batch", "--no-tty"}, args...)...)
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("gpg %s: %v: %s", args[len(args)-1], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
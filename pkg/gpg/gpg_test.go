@@ -0,0 +1,149 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gpg
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+const listing = `tru::1:1792064605:1828352605:3:1:5
+pub:u:255:22:86F4BA95D493C339:1792064604:1855136604::u:::scSC:::+::ed25519:::0:
+fpr:::::::::A11980C69070F1AE554C141086F4BA95D493C339:
+uid:u::::1792064604::5B36ED4C1E2F3A6BA6E46A0A5C7D42E7C0D7D5C5::Alice \x3a Example <a@example.com>::::::::::0:
+sub:u:255:18:1A2B3C4D5E6F7081:1792064604::::::e:::+::cv25519::
+fpr:::::::::0000000000000000000000001A2B3C4D5E6F7081:
+pub:r:1024:17:888CAC93A3072F11:1500000000:::f:::scSC::::::23::0:
+fpr:::::::::315eb93d39e6bda97a180355888cac93a3072f11:
+uid:r::::1500000000::2B04BA33277BBFC7E200B0DA7189AB79177D1A68::Old <old@example.com>::::::::::0:
+uid:-::::1500000000::2B04BA33277BBFC7E200B0DA7189AB79177D1A69::Bob <b@example.com>::::::::::0:
+`
+
+func TestGPG__parseKeys(t *testing.T) {
+	keys, err := parseKeys([]byte(listing))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("got %d keys", len(keys))
+	}
+
+	bob, alice := keys[0], keys[1]
+	if bob.Fingerprint != "315EB93D39E6BDA97A180355888CAC93A3072F11" || !bob.Revoked || bob.OwnerTrust != TrustFull {
+		t.Errorf("got %#v", bob)
+	}
+	if bob.Algorithm != "DSA" || bob.Bits != 1024 || !bob.Expires.IsZero() {
+		t.Errorf("got %#v", bob)
+	}
+	if len(bob.UserIDs) != 1 || bob.Name() != "Bob <b@example.com>" {
+		t.Errorf("revoked uid kept: %v", bob.UserIDs)
+	}
+
+	if alice.Fingerprint != "A11980C69070F1AE554C141086F4BA95D493C339" {
+		t.Errorf("subkey fingerprint used: %s", alice.Fingerprint)
+	}
+	if alice.Algorithm != "EdDSA" || alice.Curve != "ed25519" || alice.OwnerTrust != TrustUltimate || !alice.Trusted() {
+		t.Errorf("got %#v", alice)
+	}
+	if alice.Name() != "Alice : Example <a@example.com>" {
+		t.Errorf("got %q", alice.Name())
+	}
+	if alice.Created.Unix() != 1792064604 || alice.Expires.Unix() != 1855136604 {
+		t.Errorf("created=%v expires=%v", alice.Created, alice.Expires)
+	}
+}
+
+func TestGPG__ReadBackup(t *testing.T) {
+	fd, err := ioutil.TempFile("", "cert-manage-ownertrust")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fd.Name())
+	fd.WriteString("# List of assigned trustvalues\nA11980C69070F1AE554C141086F4BA95D493C339:6:\n315eb93d39e6bda97a180355888cac93a3072f11:2:\n")
+	fd.Close()
+
+	trust, err := ReadBackup(fd.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trust) != 1 || trust["A11980C69070F1AE554C141086F4BA95D493C339"] != TrustUltimate {
+		t.Errorf("got %v", trust)
+	}
+}
+
+// TestGPG__keyring distrusts, backs up and restores keys in a new keyring
+func TestGPG__keyring(t *testing.T) {
+	if _, err := exec.LookPath(Command); err != nil {
+		t.Skip("gpg isn't installed")
+	}
+	home, err := ioutil.TempDir("", "cert-manage-gnupg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	orig := os.Getenv("GNUPGHOME")
+	defer os.Setenv("GNUPGHOME", orig)
+	os.Setenv("GNUPGHOME", home)
+
+	for _, uid := range []string{"Alice <a@example.com>", "Bob <b@example.com>"} {
+		if _, err := run(nil, "--passphrase", "", "--quick-gen-key", uid, "ed25519", "sign", "1y"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || !keys[0].Secret || keys[0].OwnerTrust != TrustUltimate {
+		t.Fatalf("got %#v", keys)
+	}
+
+	backups, err := ioutil.TempDir("", "cert-manage-gpg-backups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(backups)
+	where, err := Backup(backups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest, err := LatestBackup(backups); err != nil || latest != where {
+		t.Fatalf("latest=%q err=%v", latest, err)
+	}
+
+	if err := Distrust([]string{keys[1].Fingerprint}); err != nil {
+		t.Fatal(err)
+	}
+	after, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after[1].OwnerTrust != TrustUndefined || after[0].OwnerTrust != TrustUltimate {
+		t.Errorf("got %s and %s", after[0].OwnerTrust, after[1].OwnerTrust)
+	}
+
+	if err := Restore(where); err != nil {
+		t.Fatal(err)
+	}
+	after, err = List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after[1].OwnerTrust != TrustUltimate {
+		t.Errorf("got %s", after[1].OwnerTrust)
+	}
+}
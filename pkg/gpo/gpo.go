@@ -0,0 +1,142 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gpo writes certificates in formats Windows admins can distribute
+// through Active Directory Group Policy: serialized certificate stores (.sst)
+// and registry policy files (Registry.pol) for the Disallowed store.
+package gpo
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// From wincrypt.h and the serialized store format
+const (
+	sstMagic = 0x54524543 // "CERT"
+
+	x509ASNEncoding = 1
+
+	certSHA1HashPropID = 3
+	fileElementCert    = 32
+
+	regBinary = 3
+)
+
+var (
+	// DisallowedKey is the policy registry key Windows reads distrusted certificates from,
+	// each certificate is a sub-key named after its uppercase SHA1 fingerprint.
+	DisallowedKey = `Software\Policies\Microsoft\SystemCertificates\Disallowed\Certificates`
+)
+
+// Formats returns the file extensions we can write
+func Formats() []string {
+	return []string{"pol", "sst"}
+}
+
+// Write encodes certs into w according to format (pol or sst)
+func Write(w io.Writer, format string, certs []*x509.Certificate) error {
+	switch strings.ToLower(strings.TrimPrefix(format, ".")) {
+	case "pol":
+		return WritePol(w, certs)
+	case "sst":
+		return WriteSST(w, certs)
+	}
+	return fmt.Errorf("unknown format %q, options: %s", format, strings.Join(Formats(), ", "))
+}
+
+// WriteSST writes a serialized certificate store, which can be imported into
+// the Disallowed store with `certutil -addstore Disallowed <file>` or through
+// Group Policy's "Untrusted Certificates".
+func WriteSST(w io.Writer, certs []*x509.Certificate) error {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(0))
+	binary.Write(&buf, binary.LittleEndian, uint32(sstMagic))
+	for i := range certs {
+		buf.Write(serializeCert(certs[i]))
+	}
+	// end of store
+	writeElement(&buf, 0, nil)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WritePol writes a Registry.pol file which adds each certificate to the
+// Disallowed store of machines the Group Policy Object applies to.
+//
+// Format: https://msdn.microsoft.com/en-us/library/aa374407(v=vs.85).aspx
+func WritePol(w io.Writer, certs []*x509.Certificate) error {
+	var buf bytes.Buffer
+	buf.WriteString("PReg")
+	binary.Write(&buf, binary.LittleEndian, uint32(1))
+	for i := range certs {
+		key := DisallowedKey + `\` + fingerprint(certs[i])
+		writePolEntry(&buf, key, "Blob", regBinary, serializeCert(certs[i]))
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// serializeCert encodes a certificate the way CertSerializeCertificateStoreElement does,
+// properties first and the certificate last.
+func serializeCert(cert *x509.Certificate) []byte {
+	var buf bytes.Buffer
+	sum := sha1.Sum(cert.Raw)
+	writeElement(&buf, certSHA1HashPropID, sum[:])
+	writeElement(&buf, fileElementCert, cert.Raw)
+	return buf.Bytes()
+}
+
+func writeElement(buf *bytes.Buffer, id uint32, value []byte) {
+	encoding := uint32(x509ASNEncoding)
+	if id == 0 {
+		encoding = 0
+	}
+	binary.Write(buf, binary.LittleEndian, id)
+	binary.Write(buf, binary.LittleEndian, encoding)
+	binary.Write(buf, binary.LittleEndian, uint32(len(value)))
+	buf.Write(value)
+}
+
+// writePolEntry writes: [key;value;type;size;data] with UTF-16LE strings and delimiters
+func writePolEntry(buf *bytes.Buffer, key, value string, typ uint32, data []byte) {
+	writeUTF16(buf, "[")
+	writeUTF16(buf, key+"\x00")
+	writeUTF16(buf, ";")
+	writeUTF16(buf, value+"\x00")
+	writeUTF16(buf, ";")
+	binary.Write(buf, binary.LittleEndian, typ)
+	writeUTF16(buf, ";")
+	binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+	writeUTF16(buf, ";")
+	buf.Write(data)
+	writeUTF16(buf, "]")
+}
+
+func writeUTF16(buf *bytes.Buffer, s string) {
+	for _, r := range utf16.Encode([]rune(s)) {
+		binary.Write(buf, binary.LittleEndian, r)
+	}
+}
+
+func fingerprint(cert *x509.Certificate) string {
+	return fmt.Sprintf("%X", sha1.Sum(cert.Raw))
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gpo
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+func readCerts(t *testing.T) []*x509.Certificate {
+	t.Helper()
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) < 2 {
+		t.Fatalf("only read %d certs", len(certs))
+	}
+	return certs[:2]
+}
+
+func TestGPO__WriteSST(t *testing.T) {
+	certs := readCerts(t)
+
+	var buf bytes.Buffer
+	if err := WriteSST(&buf, certs); err != nil {
+		t.Fatal(err)
+	}
+	bs := buf.Bytes()
+	if binary.LittleEndian.Uint32(bs[4:8]) != sstMagic {
+		t.Fatalf("bad header: %x", bs[:8])
+	}
+
+	// read back each element
+	var found [][]byte
+	r := bytes.NewReader(bs[8:])
+	for {
+		var hdr [3]uint32
+		if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr[0] == 0 {
+			break
+		}
+		value := make([]byte, hdr[2])
+		r.Read(value)
+		if hdr[0] == fileElementCert {
+			found = append(found, value)
+		}
+	}
+	if r.Len() != 0 {
+		t.Errorf("%d bytes after end element", r.Len())
+	}
+	if len(found) != len(certs) {
+		t.Fatalf("got %d certs", len(found))
+	}
+	for i := range certs {
+		if !bytes.Equal(found[i], certs[i].Raw) {
+			t.Errorf("cert %d doesn't match", i)
+		}
+	}
+}
+
+func TestGPO__WritePol(t *testing.T) {
+	certs := readCerts(t)
+
+	var buf bytes.Buffer
+	if err := Write(&buf, ".pol", certs); err != nil {
+		t.Fatal(err)
+	}
+	bs := buf.Bytes()
+	if string(bs[:4]) != "PReg" || binary.LittleEndian.Uint32(bs[4:8]) != 1 {
+		t.Fatalf("bad header: %x", bs[:8])
+	}
+
+	// The first entry should start with our key
+	key := `[Software\Policies\Microsoft\SystemCertificates\Disallowed\Certificates\` + fingerprint(certs[0])
+	u := utf16.Encode([]rune(key))
+	expected := make([]byte, len(u)*2)
+	for i := range u {
+		binary.LittleEndian.PutUint16(expected[i*2:], u[i])
+	}
+	if !bytes.HasPrefix(bs[8:], expected) {
+		t.Errorf("unexpected first entry: %q", bs[8:8+len(expected)])
+	}
+	if !bytes.Contains(bs, certs[1].Raw) {
+		t.Error("expected second certificate")
+	}
+
+	if err := Write(&buf, "other", certs); err == nil {
+		t.Error("expected error")
+	}
+}
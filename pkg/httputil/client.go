@@ -15,41 +15,114 @@
 package httputil
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
 )
 
 var (
 	// Client is an http.Client with many of the fields set as non-default
 	// values. This is done for the typical usecases of cert-manage.
 	//
+	// Requests are cancelled if cert-manage is interrupted.
+	//
 	// See: https://blog.cloudflare.com/the-complete-guide-to-golang-net-http-timeouts/
-	Client = &http.Client{
+	Client = newClient(newTransport())
+
+	// Offline forbids network access, requests (and callers checking
+	// CheckOnline) fail with ErrOffline
+	Offline = false
+
+	// ErrOffline is returned for network access while Offline is set
+	ErrOffline = errors.New("network access is disabled by -offline")
+)
+
+// CheckOnline returns an error naming `what` needed the network if Offline
+// is set.
+func CheckOnline(what string) error {
+	if Offline {
+		return fmt.Errorf("%s: %v", what, ErrOffline)
+	}
+	return nil
+}
+
+func New() *http.Client {
+	return Client
+}
+
+// WithRoots returns a new client like Client which only trusts roots
+func WithRoots(roots *x509.CertPool) *http.Client {
+	tr := newTransport()
+	tr.TLSClientConfig.RootCAs = roots
+	return newClient(tr)
+}
+
+// WithClientCertificate returns a new client like Client which presents
+// cert to servers asking for one, and trusts roots (or the system's when nil)
+func WithClientCertificate(roots *x509.CertPool, cert tls.Certificate) *http.Client {
+	tr := newTransport()
+	tr.TLSClientConfig.RootCAs = roots
+	tr.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	return newClient(tr)
+}
+
+// Unverified returns a new client like Client which doesn't verify servers,
+// what it downloads has to be checked some other way (e.g. by fingerprint).
+func Unverified() *http.Client {
+	tr := newTransport()
+	tr.TLSClientConfig.InsecureSkipVerify = true
+	return newClient(tr)
+}
+
+func newClient(tr *http.Transport) *http.Client {
+	return &http.Client{
 		// Never follow redirects, return body
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
 		},
-		Transport: &http.Transport{
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-				DualStack: true,
-			}).DialContext,
-			TLSClientConfig: &tls.Config{
-				MinVersion: tls.VersionTLS12,
-				MaxVersion: tls.VersionTLS12,
-			},
-			TLSHandshakeTimeout:   1 * time.Minute,
-			IdleConnTimeout:       1 * time.Minute,
-			ResponseHeaderTimeout: 1 * time.Minute,
-			ExpectContinueTimeout: 1 * time.Minute,
+		Transport: interruptible{tr},
+		Timeout:   30 * time.Second,
+	}
+}
+
+func newTransport() *http.Transport {
+	return &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			DualStack: true,
+		}).DialContext,
+		TLSClientConfig: &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			MaxVersion: tls.VersionTLS12,
 		},
-		Timeout: 30 * time.Second,
+		TLSHandshakeTimeout:   1 * time.Minute,
+		IdleConnTimeout:       1 * time.Minute,
+		ResponseHeaderTimeout: 1 * time.Minute,
+		ExpectContinueTimeout: 1 * time.Minute,
 	}
-)
+}
 
-func New() *http.Client {
-	return Client
+// interruptible cancels requests, including reading their response body,
+// once cert-manage is interrupted. Requests given their own context keep it.
+// No requests are made when Offline is set.
+type interruptible struct {
+	tr http.RoundTripper
+}
+
+func (i interruptible) RoundTrip(r *http.Request) (*http.Response, error) {
+	if err := CheckOnline(r.Method + " " + r.URL.String()); err != nil {
+		return nil, err
+	}
+	if r.Context() == context.Background() {
+		r = r.WithContext(interrupt.Context())
+	}
+	return i.tr.RoundTrip(r)
 }
@@ -0,0 +1,55 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHttputil__Offline(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+
+	Offline = true
+	defer func() { Offline = false }()
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	_, err := New().Do(req)
+	if err == nil || !strings.Contains(err.Error(), "-offline") {
+		t.Errorf("expected offline error, got %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("got %d requests", requests)
+	}
+	if err := CheckOnline("test"); err == nil {
+		t.Error("expected error")
+	}
+
+	Offline = false
+	resp, err := New().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if requests != 1 {
+		t.Errorf("got %d requests", requests)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package interrupt stops external commands and network requests which run
+// too long or when cert-manage is interrupted (e.g. with Ctrl-C), so callers
+// can report what was done rather than hang.
+package interrupt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	// Timeout is how long an external command can run before it's killed
+	Timeout = 5 * time.Minute
+
+	// ErrInterrupted is returned for work skipped after an interrupt
+	ErrInterrupted = errors.New("interrupted")
+
+	ctx, cancel = context.WithCancel(context.Background())
+
+	notifyOnce sync.Once
+
+	// exit is replaced in tests
+	exit = os.Exit
+
+	// CommandContext creates each command, tests replace it to run fakes of
+	// external tools (see package exectest)
+	CommandContext = exec.CommandContext
+)
+
+// Context is cancelled once cert-manage has been interrupted
+func Context() context.Context {
+	return ctx
+}
+
+// Interrupted returns true once cert-manage has been interrupted
+func Interrupted() bool {
+	return ctx.Err() != nil
+}
+
+// Notify cancels Context on the first SIGINT or SIGTERM, which kills running
+// commands and stops requests. A second signal exits immediately.
+func Notify() {
+	notifyOnce.Do(func() {
+		sig := make(chan os.Signal, 2)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sig
+			fmt.Fprintln(os.Stderr, "Interrupted, stopping (interrupt again to exit now)")
+			cancel()
+			<-sig
+			exit(130)
+		}()
+	})
+}
+
+// Command returns an *exec.Cmd which is killed if it runs longer than
+// Timeout or cert-manage is interrupted.
+func Command(name string, args ...string) *exec.Cmd {
+	return CommandTimeout(Timeout, name, args...)
+}
+
+// CommandTimeout is Command with its own timeout, zero only kills the
+// command when cert-manage is interrupted.
+func CommandTimeout(d time.Duration, name string, args ...string) *exec.Cmd {
+	if d <= 0 {
+		return CommandContext(ctx, name, args...)
+	}
+	// The context is released once the timeout fires, even if the command
+	// finished long before.
+	c, stop := context.WithCancel(ctx)
+	time.AfterFunc(d, stop)
+	return CommandContext(c, name, args...)
+}
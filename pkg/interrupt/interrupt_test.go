@@ -0,0 +1,43 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interrupt
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestInterrupt__CommandTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sleep isn't available on windows")
+	}
+	start := time.Now()
+	err := CommandTimeout(100*time.Millisecond, "sleep", "10").Run()
+	if err == nil {
+		t.Fatal("expected sleep to be killed")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("sleep ran for %v", d)
+	}
+
+	// no timeout, runs to completion
+	if err := CommandTimeout(0, "true").Run(); err != nil {
+		t.Fatal(err)
+	}
+	if Interrupted() {
+		t.Error("shouldn't be interrupted")
+	}
+}
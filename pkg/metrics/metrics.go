@@ -0,0 +1,209 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics records the results of a run (e.g. how many certificates
+// were removed) and pushes them to a Prometheus Pushgateway or statsd when
+// cert-manage exits. One-shot runs from cron are gone before a scraper could
+// see them, so their results have to be pushed.
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/httputil"
+)
+
+// Results recorded by commands
+const (
+	// CertificatesRemoved is how many certificates had their trust removed
+	CertificatesRemoved = "certificates_removed"
+
+	// Violations is how many problems (e.g. expired or non-compliant
+	// certificates) were found
+	Violations = "violations"
+)
+
+var (
+	// Job is the Pushgateway job and statsd prefix metrics are pushed under
+	Job = "cert-manage"
+
+	mu      sync.Mutex
+	results = make(map[string]float64)
+)
+
+// Add adds v to the result called name
+func Add(name string, v int) {
+	mu.Lock()
+	defer mu.Unlock()
+	results[name] += float64(v)
+}
+
+// Reset forgets every result added
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	results = make(map[string]float64)
+}
+
+// Run describes the run of a sub-command whose results are pushed
+type Run struct {
+	Command  string
+	Store    string // the app name or platform (e.g. linux)
+	Duration time.Duration
+	Success  bool
+}
+
+// Push sends the run and the results added to dest, a Pushgateway's URL
+// (http or https) or statsd://host:port (over UDP).
+func Push(dest string, run Run) error {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return pushGateway(u, run, snapshot())
+	case "statsd", "udp":
+		return pushStatsd(u.Host, run, snapshot())
+	}
+	return fmt.Errorf("unknown metrics destination %q, expected http(s):// or statsd://", dest)
+}
+
+// snapshot returns the results added, with every known result included
+func snapshot() map[string]float64 {
+	mu.Lock()
+	defer mu.Unlock()
+	out := map[string]float64{
+		CertificatesRemoved: 0,
+		Violations:          0,
+	}
+	for k, v := range results {
+		out[k] = v
+	}
+	return out
+}
+
+// pushGateway replaces the metrics grouped under the job, this host and the
+// command, so runs of other commands on the host (e.g. audit and whitelist
+// from cron) don't replace each other.
+//
+// https://github.com/prometheus/pushgateway#api
+func pushGateway(u *url.URL, run Run, values map[string]float64) error {
+	if !strings.Contains(u.Path, "/metrics/job/") {
+		hostname, _ := os.Hostname()
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/metrics/job/" + url.PathEscape(Job)
+		if hostname != "" {
+			u.Path += "/instance/" + url.PathEscape(hostname)
+		}
+		u.Path += "/command/" + url.PathEscape(run.Command)
+	}
+
+	var buf bytes.Buffer
+	labels := fmt.Sprintf(`{store="%s"}`, escapeLabel(run.Store))
+	gauge := func(name, help string, v float64) {
+		name = metricName(name)
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s gauge\n%s%s %v\n", name, help, name, name, labels, v)
+	}
+	for _, name := range sortedKeys(values) {
+		gauge(name, "Result of the last run", values[name])
+	}
+	gauge("run_duration_seconds", "How long the last run took", run.Duration.Seconds())
+	gauge("run_success", "1 if the last run succeeded, otherwise 0", boolValue(run.Success))
+	gauge("run_timestamp_seconds", "When the last run finished", float64(time.Now().Unix()))
+
+	req, err := http.NewRequest("PUT", u.String(), &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := httputil.New().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("pushgateway returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// pushStatsd sends counters for the results, a timer for the duration and a
+// gauge of success under <job>.<command>.
+func pushStatsd(addr string, run Run, values map[string]float64) error {
+	if addr == "" {
+		return errors.New("no statsd address given")
+	}
+	if err := httputil.CheckOnline("statsd " + addr); err != nil {
+		return err
+	}
+	prefix := statsdName(Job) + "." + statsdName(run.Command)
+
+	var buf bytes.Buffer
+	for _, name := range sortedKeys(values) {
+		fmt.Fprintf(&buf, "%s.%s:%v|c\n", prefix, name, values[name])
+	}
+	fmt.Fprintf(&buf, "%s.duration:%d|ms\n", prefix, run.Duration/time.Millisecond)
+	fmt.Fprintf(&buf, "%s.success:%v|g\n", prefix, boolValue(run.Success))
+
+	conn, err := net.DialTimeout("udp", addr, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write(buf.Bytes())
+	return err
+}
+
+// metricName returns name as a Prometheus metric, prefixed with the job
+func metricName(name string) string {
+	return strings.Replace(Job, "-", "_", -1) + "_" + name
+}
+
+// statsdName replaces characters statsd treats as separators
+func statsdName(s string) string {
+	return strings.NewReplacer("-", "_", ".", "_", ":", "_", "|", "_", "@", "_").Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	var out []string
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,114 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics__pushgateway(t *testing.T) {
+	defer Reset()
+	Add(CertificatesRemoved, 3)
+	Add(CertificatesRemoved, 2)
+
+	var path, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			t.Errorf("got %s", r.Method)
+		}
+		bs, _ := ioutil.ReadAll(r.Body)
+		path, body = r.URL.Path, string(bs)
+	}))
+	defer srv.Close()
+
+	run := Run{Command: "whitelist", Store: "java", Duration: 1500 * time.Millisecond, Success: true}
+	if err := Push(srv.URL, run); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(path, "/metrics/job/cert-manage/") || !strings.HasSuffix(path, "/command/whitelist") {
+		t.Errorf("got path %s", path)
+	}
+	for _, line := range []string{
+		`cert_manage_certificates_removed{store="java"} 5`,
+		`cert_manage_violations{store="java"} 0`,
+		`cert_manage_run_duration_seconds{store="java"} 1.5`,
+		`cert_manage_run_success{store="java"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in\n%s", line, body)
+		}
+	}
+
+	// a grouping key given is used as-is
+	if err := Push(srv.URL+"/metrics/job/nightly", run); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/metrics/job/nightly" {
+		t.Errorf("got path %s", path)
+	}
+}
+
+func TestMetrics__pushgatewayError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad metrics", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	err := Push(srv.URL, Run{Command: "prune"})
+	if err == nil || !strings.Contains(err.Error(), "bad metrics") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestMetrics__statsd(t *testing.T) {
+	defer Reset()
+	Add(Violations, 4)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	run := Run{Command: "audit", Store: "linux", Duration: 250 * time.Millisecond}
+	if err := Push("statsd://"+conn.LocalAddr().String(), run); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ans := "cert_manage.audit.certificates_removed:0|c\n" +
+		"cert_manage.audit.violations:4|c\n" +
+		"cert_manage.audit.duration:250|ms\n" +
+		"cert_manage.audit.success:0|g\n"
+	if got := string(buf[:n]); got != ans {
+		t.Errorf("got\n%s", got)
+	}
+}
+
+func TestMetrics__unknown(t *testing.T) {
+	if err := Push("ftp://example.com", Run{}); err == nil {
+		t.Error("expected error")
+	}
+}
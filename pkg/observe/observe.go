@@ -0,0 +1,309 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package observe is an HTTP proxy which records the root CAs terminating
+// the TLS connections tunneled through it. Connections aren't intercepted,
+// certificates are read from the handshake as it passes through the tunnel.
+package observe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/httputil"
+)
+
+var (
+	debug = os.Getenv("DEBUG") != ""
+
+	dialTimeout = 10 * time.Second
+)
+
+// Root is a CA which the observed TLS connections chained to
+type Root struct {
+	Certificate *x509.Certificate
+	Fingerprint string
+
+	// Connections counts the tunnels which chained to this root
+	Connections int
+
+	// Hosts are the server names seen, sorted
+	Hosts []string
+}
+
+// Observer is an http.Handler proxying CONNECT tunnels (and plain HTTP
+// requests) while recording which root each TLS server chains to.
+type Observer struct {
+	roots *x509.CertPool
+
+	// lookup retrieves a server's chain when it couldn't be read from the
+	// tunnel, which is the case for TLS 1.3 as certificates are encrypted.
+	lookup func(addr, serverName string) ([]*x509.Certificate, error)
+
+	mu      sync.Mutex
+	hosts   map[string]string // server name -> root fingerprint, empty if unknown
+	seen    map[string]*Root
+	unknown map[string]int
+}
+
+// New returns an Observer which verifies chains against roots
+func New(roots []*x509.Certificate) *Observer {
+	pool := x509.NewCertPool()
+	for i := range roots {
+		pool.AddCert(roots[i])
+	}
+	return &Observer{
+		roots:   pool,
+		lookup:  lookupChain,
+		hosts:   make(map[string]string),
+		seen:    make(map[string]*Root),
+		unknown: make(map[string]int),
+	}
+}
+
+// Roots returns the roots observed, most used first
+func (o *Observer) Roots() []Root {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var out []Root
+	for _, r := range o.seen {
+		root := *r
+		root.Hosts = append([]string(nil), r.Hosts...)
+		sort.Strings(root.Hosts)
+		out = append(out, root)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Connections == out[j].Connections {
+			return out[i].Fingerprint < out[j].Fingerprint
+		}
+		return out[i].Connections > out[j].Connections
+	})
+	return out
+}
+
+// Unknown returns the server names which didn't chain to a trusted root
+func (o *Observer) Unknown() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var out []string
+	for host := range o.unknown {
+		out = append(out, host)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (o *Observer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		o.tunnel(w, r)
+		return
+	}
+	o.forward(w, r)
+}
+
+// tunnel connects the client to r.Host, reading the server name from the
+// client's ClientHello and the certificates from the server's handshake.
+func (o *Observer) tunnel(w http.ResponseWriter, r *http.Request) {
+	if err := httputil.CheckOnline("connecting to " + r.Host); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	upstream, err := net.DialTimeout("tcp", r.Host, dialTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buf, err := hj.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	defer client.Close()
+	defer upstream.Close()
+
+	if _, err := io.WriteString(client, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		return
+	}
+
+	serverName := readSNI(buf.Reader)
+	if serverName == "" {
+		serverName = hostname(r.Host)
+	}
+	sniff := newCertSniffer()
+	go func() {
+		<-sniff.done
+		o.record(r.Host, serverName, sniff.certs)
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(upstream, buf.Reader)
+		closeWrite(upstream)
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(io.MultiWriter(client, sniff), upstream)
+		closeWrite(client)
+	}()
+	wg.Wait()
+	sniff.finish()
+}
+
+// forward proxies a plain HTTP request, which isn't recorded
+func (o *Observer) forward(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Host == "" {
+		http.Error(w, "cert-manage observe is a proxy", http.StatusBadRequest)
+		return
+	}
+	r.RequestURI = ""
+	r.Header.Del("Proxy-Connection")
+	resp, err := http.DefaultTransport.RoundTrip(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for k, vs := range resp.Header {
+		for i := range vs {
+			w.Header().Add(k, vs[i])
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// record finds the root of a server's chain, which is only done the first
+// time a server name is seen.
+func (o *Observer) record(addr, serverName string, chain []*x509.Certificate) {
+	o.mu.Lock()
+	fp, known := o.hosts[serverName]
+	o.mu.Unlock()
+
+	var root *x509.Certificate
+	if !known {
+		if len(chain) == 0 {
+			var err error
+			chain, err = o.lookup(addr, serverName)
+			if err != nil && debug {
+				fmt.Printf("observe: unable to get chain for %s: %v\n", serverName, err)
+			}
+		}
+		root = o.findRoot(serverName, chain)
+		if root != nil {
+			fp = certutil.GetHexSHA256Fingerprint(*root)
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.hosts[serverName] = fp
+	if fp == "" {
+		o.unknown[serverName]++
+		return
+	}
+	r, ok := o.seen[fp]
+	if !ok {
+		r = &Root{
+			Certificate: root,
+			Fingerprint: fp,
+		}
+		o.seen[fp] = r
+	}
+	r.Connections++
+	for i := range r.Hosts {
+		if r.Hosts[i] == serverName {
+			return
+		}
+	}
+	r.Hosts = append(r.Hosts, serverName)
+}
+
+// findRoot verifies chain (leaf first) for serverName
+func (o *Observer) findRoot(serverName string, chain []*x509.Certificate) *x509.Certificate {
+	if len(chain) == 0 {
+		return nil
+	}
+	intermediates := x509.NewCertPool()
+	for i := range chain[1:] {
+		intermediates.AddCert(chain[i+1])
+	}
+	chains, err := chain[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Intermediates: intermediates,
+		Roots:         o.roots,
+	})
+	if err != nil {
+		if debug {
+			fmt.Printf("observe: no trusted chain for %s: %v\n", serverName, err)
+		}
+		return nil
+	}
+	return chains[0][len(chains[0])-1]
+}
+
+// lookupChain connects to addr for the certificates it serves, which are
+// verified by findRoot.
+func lookupChain(addr, serverName string) ([]*x509.Certificate, error) {
+	if err := httputil.CheckOnline("connecting to " + addr); err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{
+		Timeout: dialTimeout,
+	}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates, nil
+}
+
+func hostname(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return strings.ToLower(addr)
+	}
+	return strings.ToLower(host)
+}
+
+func closeWrite(c net.Conn) {
+	if tc, ok := c.(*net.TCPConn); ok {
+		tc.CloseWrite()
+		return
+	}
+	c.Close()
+}
@@ -0,0 +1,129 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observe
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestObserve__clientHelloSNI(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		tls.Client(client, &tls.Config{ServerName: "Example.com"}).Handshake()
+		client.Close()
+	}()
+
+	if name := readSNI(bufio.NewReaderSize(server, maxRecordSize)); name != "example.com" {
+		t.Errorf("got %q", name)
+	}
+
+	if name := clientHelloSNI([]byte{1, 0, 0, 2, 3, 3}); name != "" {
+		t.Errorf("got %q", name)
+	}
+}
+
+// get makes a request to srv through the observer and waits for it to be recorded
+func get(t *testing.T, o *Observer, srv *httptest.Server, maxVersion uint16) {
+	t.Helper()
+
+	proxy := httptest.NewServer(o)
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyURL(proxyURL),
+			TLSClientConfig: &tls.Config{
+				RootCAs:    pool,
+				MaxVersion: maxVersion,
+			},
+		},
+	}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	client.Transport.(*http.Transport).CloseIdleConnections()
+
+	for i := 0; i < 100; i++ {
+		if len(o.Roots()) > 0 || len(o.Unknown()) > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("connection wasn't recorded")
+}
+
+func TestObserve__tunnel(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// TLS 1.2 certificates are read from the tunnel
+	o := New([]*x509.Certificate{srv.Certificate()})
+	o.lookup = func(addr, serverName string) ([]*x509.Certificate, error) {
+		t.Errorf("unexpected lookup of %s", addr)
+		return nil, nil
+	}
+	get(t, o, srv, tls.VersionTLS12)
+
+	roots := o.Roots()
+	if len(roots) != 1 || roots[0].Connections != 1 {
+		t.Fatalf("got %#v", roots)
+	}
+	if !roots[0].Certificate.Equal(srv.Certificate()) {
+		t.Error("unexpected root")
+	}
+	if len(roots[0].Hosts) != 1 || roots[0].Hosts[0] != "127.0.0.1" {
+		t.Errorf("got hosts %v", roots[0].Hosts)
+	}
+}
+
+func TestObserve__lookup(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// TLS 1.3 encrypts certificates, so the server is connected to
+	o := New([]*x509.Certificate{srv.Certificate()})
+	get(t, o, srv, 0)
+	if roots := o.Roots(); len(roots) != 1 || !roots[0].Certificate.Equal(srv.Certificate()) {
+		t.Errorf("got %#v", roots)
+	}
+}
+
+func TestObserve__unknown(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	o := New(nil)
+	get(t, o, srv, tls.VersionTLS12)
+	if roots := o.Roots(); len(roots) != 0 {
+		t.Errorf("got %#v", roots)
+	}
+	if hosts := o.Unknown(); len(hosts) != 1 || hosts[0] != "127.0.0.1" {
+		t.Errorf("got %v", hosts)
+	}
+}
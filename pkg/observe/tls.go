@@ -0,0 +1,222 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observe
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/binary"
+	"strings"
+	"sync"
+)
+
+const (
+	recordHandshake = 22
+
+	handshakeClientHello = 1
+	handshakeCertificate = 11
+
+	extensionServerName = 0
+
+	// maxRecordSize is the largest TLS record, including its header
+	maxRecordSize = 5 + 16384 + 2048
+)
+
+// readSNI returns the server name from the ClientHello at the start of r,
+// without consuming it. An empty string is returned if there isn't one.
+func readSNI(r *bufio.Reader) string {
+	hdr, err := r.Peek(5)
+	if err != nil || hdr[0] != recordHandshake {
+		return ""
+	}
+	rec, err := r.Peek(5 + int(binary.BigEndian.Uint16(hdr[3:])))
+	if err != nil {
+		return ""
+	}
+	return clientHelloSNI(rec[5:])
+}
+
+// clientHelloSNI reads the server_name extension of a ClientHello
+//
+// https://tools.ietf.org/html/rfc5246#section-7.4.1.2
+// https://tools.ietf.org/html/rfc6066#section-3
+func clientHelloSNI(msg []byte) string {
+	if len(msg) < 4 || msg[0] != handshakeClientHello {
+		return ""
+	}
+	b := msg[4:]
+
+	// version, random
+	if len(b) < 2+32 {
+		return ""
+	}
+	b = b[2+32:]
+
+	// session id, cipher suites and compression methods
+	for _, size := range []int{1, 2, 1} {
+		n, rest, ok := readVector(b, size)
+		if !ok {
+			return ""
+		}
+		b = rest[n:]
+	}
+
+	n, b, ok := readVector(b, 2)
+	if !ok {
+		return ""
+	}
+	exts := b[:n]
+	for len(exts) >= 4 {
+		typ := binary.BigEndian.Uint16(exts)
+		n, rest, ok := readVector(exts[2:], 2)
+		if !ok {
+			return ""
+		}
+		body := rest[:n]
+		exts = rest[n:]
+		if typ != extensionServerName {
+			continue
+		}
+
+		// server_name_list
+		n, body, ok = readVector(body, 2)
+		if !ok {
+			return ""
+		}
+		names := body[:n]
+		for len(names) >= 3 {
+			nameType := names[0]
+			n, rest, ok := readVector(names[1:], 2)
+			if !ok {
+				return ""
+			}
+			if nameType == 0 { // host_name
+				return strings.ToLower(string(rest[:n]))
+			}
+			names = rest[n:]
+		}
+	}
+	return ""
+}
+
+// readVector reads a length prefix of size bytes, returning the length and
+// the bytes following the prefix. ok is false if b is too short.
+func readVector(b []byte, size int) (n int, rest []byte, ok bool) {
+	if len(b) < size {
+		return 0, nil, false
+	}
+	for i := 0; i < size; i++ {
+		n = n<<8 | int(b[i])
+	}
+	if len(b)-size < n {
+		return 0, nil, false
+	}
+	return n, b[size:], true
+}
+
+// certSniffer is written the bytes a server sends and reads its Certificate
+// message. TLS 1.3 encrypts certificates, so once anything but a handshake
+// record is seen the sniffer gives up.
+type certSniffer struct {
+	buf       []byte // unparsed records
+	handshake []byte // unparsed handshake messages
+
+	// certs are read once done is closed
+	certs []*x509.Certificate
+
+	finished bool
+	once     sync.Once
+	done     chan struct{}
+}
+
+func newCertSniffer() *certSniffer {
+	return &certSniffer{
+		done: make(chan struct{}),
+	}
+}
+
+// Write never fails so the tunnel isn't affected
+func (s *certSniffer) Write(p []byte) (int, error) {
+	if s.finished {
+		return len(p), nil
+	}
+	s.buf = append(s.buf, p...)
+	for !s.finished && len(s.buf) >= 5 {
+		n := int(binary.BigEndian.Uint16(s.buf[3:]))
+		if len(s.buf) < 5+n {
+			break
+		}
+		if s.buf[0] != recordHandshake {
+			s.finish()
+			break
+		}
+		s.handshake = append(s.handshake, s.buf[5:5+n]...)
+		s.buf = s.buf[5+n:]
+		s.readHandshake()
+	}
+	if len(s.buf) > maxRecordSize || len(s.handshake) > 1<<20 {
+		s.finish()
+	}
+	return len(p), nil
+}
+
+func (s *certSniffer) readHandshake() {
+	for !s.finished && len(s.handshake) >= 4 {
+		typ := s.handshake[0]
+		n, rest, ok := readVector(s.handshake[1:], 3)
+		if !ok {
+			return // wait for the rest of the message
+		}
+		s.handshake = rest[n:]
+		if typ == handshakeCertificate {
+			s.certs = parseCertificates(rest[:n])
+			s.finish()
+		}
+	}
+}
+
+// finish stops reading and releases anyone waiting on done
+func (s *certSniffer) finish() {
+	s.finished = true
+	s.buf, s.handshake = nil, nil
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+// parseCertificates reads a TLS 1.2 Certificate message
+//
+// https://tools.ietf.org/html/rfc5246#section-7.4.2
+func parseCertificates(msg []byte) []*x509.Certificate {
+	n, rest, ok := readVector(msg, 3)
+	if !ok {
+		return nil
+	}
+	list := rest[:n]
+	var out []*x509.Certificate
+	for len(list) > 0 {
+		n, rest, ok := readVector(list, 3)
+		if !ok {
+			return nil
+		}
+		cert, err := x509.ParseCertificate(rest[:n])
+		if err != nil {
+			return nil
+		}
+		out = append(out, cert)
+		list = rest[n:]
+	}
+	return out
+}
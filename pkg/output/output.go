@@ -0,0 +1,121 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package output opens where cert-manage writes its results and errors,
+// which is stdout, a file or syslog (read by journald on systemd hosts) so
+// fleets of machines can be logged centrally.
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/file"
+)
+
+const (
+	// Stdout is given to write output as normal
+	Stdout = "-"
+
+	// Syslog is given to write each line of output as a syslog message
+	Syslog = "syslog"
+)
+
+// Open returns a writer for where, which is Stdout, Syslog or a file path.
+// Files are appended to, so repeated runs build up a log.
+func Open(where string) (io.WriteCloser, error) {
+	switch strings.ToLower(where) {
+	case "", Stdout:
+		return nopCloser{os.Stdout}, nil
+	case Syslog:
+		return newSyslog()
+	}
+	return os.OpenFile(where, os.O_CREATE|os.O_APPEND|os.O_WRONLY, file.TempFilePermissions)
+}
+
+// Redirect sends everything written to os.Stdout and os.Stderr to where
+// until the returned func is called, which restores them.
+func Redirect(where string) (func() error, error) {
+	if where == "" || where == Stdout {
+		return func() error { return nil }, nil
+	}
+	dest, err := Open(where)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open output %s: %v", where, err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		dest.Close()
+		return nil, err
+	}
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = w, w
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(dest, r)
+		done <- err
+	}()
+	return func() error {
+		os.Stdout, os.Stderr = stdout, stderr
+		w.Close()
+		err := <-done
+		r.Close()
+		if cerr := dest.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// lineWriter calls emit with each complete line written, without its line
+// ending. A trailing partial line is emitted on Close.
+type lineWriter struct {
+	buf  bytes.Buffer
+	emit func(line string) error
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		idx := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if idx < 0 {
+			return len(p), nil
+		}
+		line := strings.TrimRight(string(w.buf.Next(idx+1)), "\r\n")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if err := w.emit(line); err != nil {
+			return len(p), err
+		}
+	}
+}
+
+func (w *lineWriter) flush() error {
+	if line := strings.TrimSpace(w.buf.String()); line != "" {
+		w.buf.Reset()
+		return w.emit(line)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutput__Redirect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	where := filepath.Join(dir, "out.log")
+
+	// files are appended to
+	for i := 0; i < 2; i++ {
+		restore, err := Redirect(where)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Printf("run %d\n", i)
+		fmt.Fprintf(os.Stderr, "WARNING: run %d\n", i)
+		if err := restore(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bs, err := ioutil.ReadFile(where)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := string(bs); v != "run 0\nWARNING: run 0\nrun 1\nWARNING: run 1\n" {
+		t.Errorf("got %q", v)
+	}
+
+	if _, err := Redirect(filepath.Join(dir, "missing", "out.log")); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestOutput__lineWriter(t *testing.T) {
+	var lines []string
+	w := &lineWriter{
+		emit: func(line string) error {
+			lines = append(lines, line)
+			return nil
+		},
+	}
+	fmt.Fprint(w, "first\r\nsec")
+	fmt.Fprint(w, "ond\n\n")
+	fmt.Fprint(w, "partial")
+	if err := w.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if v := strings.Join(lines, "|"); v != "first|second|partial" {
+		t.Errorf("got %q", v)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !windows
+
+package output
+
+import (
+	"io"
+	"log/syslog"
+	"strings"
+)
+
+// syslogWriter logs each line as a message tagged cert-manage, lines
+// starting with ERROR or WARNING are logged at those severities.
+type syslogWriter struct {
+	lineWriter
+	w *syslog.Writer
+}
+
+func newSyslog() (io.WriteCloser, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_USER, "cert-manage")
+	if err != nil {
+		return nil, err
+	}
+	s := &syslogWriter{w: w}
+	s.emit = func(line string) error {
+		switch {
+		case strings.HasPrefix(line, "ERROR"):
+			return w.Err(line)
+		case strings.HasPrefix(line, "WARNING"):
+			return w.Warning(line)
+		}
+		return w.Info(line)
+	}
+	return s, nil
+}
+
+func (s *syslogWriter) Close() error {
+	err := s.flush()
+	if cerr := s.w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
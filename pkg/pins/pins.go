@@ -0,0 +1,167 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pins writes SPKI pin sets for hosts in the formats used by
+// Android's network_security_config, HPKP headers and Go code.
+package pins
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+var (
+	// hpkpMaxAge is the max-age used in Public-Key-Pins headers, 60 days
+	hpkpMaxAge = 60 * 24 * time.Hour
+
+	writers = map[string]func(io.Writer, []HostPins) error{
+		"android": WriteAndroid,
+		"go":      WriteGo,
+		"hpkp":    WriteHPKP,
+	}
+)
+
+// Pin is the base64 SHA256 hash of a certificate's SubjectPublicKeyInfo
+type Pin struct {
+	SPKI    string
+	Subject string
+}
+
+// HostPins is the pin set for a host. Pins are ordered from the issuing
+// intermediate to the root, every pin after the first is a backup pin.
+type HostPins struct {
+	Host string
+	Pins []Pin
+
+	// Expires is when the first pinned certificate expires
+	Expires time.Time
+}
+
+// FromChain creates the pin set for host given a verified chain, leaf first.
+// The leaf isn't pinned as it's replaced far more often than its CA's.
+func FromChain(host string, chain []*x509.Certificate) HostPins {
+	hp := HostPins{
+		Host: host,
+	}
+	if len(chain) > 1 {
+		chain = chain[1:]
+	}
+	seen := make(map[string]bool)
+	for i := range chain {
+		spki := certutil.GetBase64SPKISHA256Fingerprint(*chain[i])
+		if seen[spki] {
+			continue
+		}
+		seen[spki] = true
+		hp.Pins = append(hp.Pins, Pin{
+			SPKI:    spki,
+			Subject: certutil.StringifyPKIXName(chain[i].Subject),
+		})
+		if hp.Expires.IsZero() || chain[i].NotAfter.Before(hp.Expires) {
+			hp.Expires = chain[i].NotAfter
+		}
+	}
+	return hp
+}
+
+// Formats returns the names of the pin set formats which can be written
+func Formats() []string {
+	var out []string
+	for k := range writers {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Write outputs the pin sets of hosts in the given format
+func Write(w io.Writer, format string, hosts []HostPins) error {
+	fn, ok := writers[strings.ToLower(format)]
+	if !ok {
+		return fmt.Errorf("unknown pin format %q, options: %s", format, strings.Join(Formats(), ", "))
+	}
+	return fn(w, hosts)
+}
+
+// WriteAndroid writes a network_security_config.xml, see
+// https://developer.android.com/training/articles/security-config#CertificatePinning
+func WriteAndroid(w io.Writer, hosts []HostPins) error {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString("<network-security-config>\n")
+	for i := range hosts {
+		buf.WriteString("  <domain-config>\n")
+		fmt.Fprintf(&buf, "    <domain includeSubdomains=\"false\">%s</domain>\n", escape(hosts[i].Host))
+		if hosts[i].Expires.IsZero() {
+			buf.WriteString("    <pin-set>\n")
+		} else {
+			fmt.Fprintf(&buf, "    <pin-set expiration=\"%s\">\n", hosts[i].Expires.Format("2006-01-02"))
+		}
+		for j := range hosts[i].Pins {
+			pin := hosts[i].Pins[j]
+			fmt.Fprintf(&buf, "      <!-- %s -->\n", strings.Replace(pin.Subject, "--", "- -", -1))
+			fmt.Fprintf(&buf, "      <pin digest=\"SHA-256\">%s</pin>\n", pin.SPKI)
+		}
+		buf.WriteString("    </pin-set>\n")
+		buf.WriteString("  </domain-config>\n")
+	}
+	buf.WriteString("</network-security-config>\n")
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func escape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// WriteHPKP writes a Public-Key-Pins header for each host
+func WriteHPKP(w io.Writer, hosts []HostPins) error {
+	for i := range hosts {
+		var parts []string
+		for j := range hosts[i].Pins {
+			parts = append(parts, fmt.Sprintf("pin-sha256=%q", hosts[i].Pins[j].SPKI))
+		}
+		parts = append(parts, fmt.Sprintf("max-age=%d", int(hpkpMaxAge.Seconds())))
+		if _, err := fmt.Fprintf(w, "# %s\nPublic-Key-Pins: %s\n", hosts[i].Host, strings.Join(parts, "; ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteGo writes a Go map of host to pins, which can be checked against
+// tls.ConnectionState's VerifiedChains.
+func WriteGo(w io.Writer, hosts []HostPins) error {
+	fmt.Fprintln(w, "// Generated by cert-manage pins, SPKI SHA256 hashes encoded in base64")
+	fmt.Fprintln(w, "var pins = map[string][]string{")
+	for i := range hosts {
+		fmt.Fprintf(w, "\t%q: {\n", hosts[i].Host)
+		for j := range hosts[i].Pins {
+			fmt.Fprintf(w, "\t\t%q, // %s\n", hosts[i].Pins[j].SPKI, hosts[i].Pins[j].Subject)
+		}
+		fmt.Fprintln(w, "\t},")
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
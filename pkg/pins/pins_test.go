@@ -0,0 +1,106 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pins
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+func testPins(t *testing.T) []HostPins {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []HostPins{FromChain("example.com", certs[:3])}
+}
+
+func TestPins__FromChain(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the leaf isn't pinned
+	hp := FromChain("example.com", certs[:3])
+	if len(hp.Pins) != 2 {
+		t.Fatalf("got %d pins", len(hp.Pins))
+	}
+	if hp.Pins[0].SPKI != certutil.GetBase64SPKISHA256Fingerprint(*certs[1]) {
+		t.Errorf("got %v", hp.Pins[0])
+	}
+	if hp.Expires.IsZero() {
+		t.Error("expected expiration")
+	}
+
+	// self-signed leaf
+	hp = FromChain("example.com", certs[:1])
+	if len(hp.Pins) != 1 {
+		t.Errorf("got %d pins", len(hp.Pins))
+	}
+}
+
+func TestPins__Write(t *testing.T) {
+	hosts := testPins(t)
+	if err := Write(&bytes.Buffer{}, "other", hosts); err == nil {
+		t.Error("expected error")
+	}
+
+	// android
+	var buf bytes.Buffer
+	if err := Write(&buf, "android", hosts); err != nil {
+		t.Fatal(err)
+	}
+	var cfg struct {
+		Domains []struct {
+			Domain string   `xml:"domain"`
+			Pins   []string `xml:"pin-set>pin"`
+		} `xml:"domain-config"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Domains) != 1 || cfg.Domains[0].Domain != "example.com" {
+		t.Fatalf("got %#v", cfg)
+	}
+	if n := len(cfg.Domains[0].Pins); n != 2 {
+		t.Errorf("got %d pins", n)
+	}
+	if v := cfg.Domains[0].Pins[0]; v != hosts[0].Pins[0].SPKI {
+		t.Errorf("got %q", v)
+	}
+
+	// hpkp
+	buf.Reset()
+	if err := Write(&buf, "HPKP", hosts); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(buf.String(), "pin-sha256=") != 2 || !strings.Contains(buf.String(), "max-age=5184000") {
+		t.Errorf("got %q", buf.String())
+	}
+
+	// go
+	buf.Reset()
+	if err := Write(&buf, "go", hosts); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"example.com": {`) || !strings.Contains(buf.String(), hosts[0].Pins[1].SPKI) {
+		t.Errorf("got %q", buf.String())
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policyserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/agent"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+)
+
+const (
+	caCertFile = "ca.crt"
+	caKeyFile  = "ca.key"
+)
+
+var (
+	caLifetime     = 10 * 365 * 24 * time.Hour
+	servedLifetime = 90 * 24 * time.Hour
+
+	serialLimit = new(big.Int).Lsh(big.NewInt(1), 128)
+)
+
+// ServerCertificate issues a certificate for hosts (names or IPs) from the
+// server's CA, for serving agents who trust the CA with -server-ca.
+func (s *Server) ServerCertificate(hosts []string) (tls.Certificate, error) {
+	if len(hosts) == 0 {
+		return tls.Certificate{}, errors.New("no hostnames given for the server's certificate")
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tmpl, err := newTemplate(hosts[0], servedLifetime)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for i := range hosts {
+		if ip := net.ParseIP(hosts[i]); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, hosts[i])
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, s.ca.Certificate, key.Public(), s.ca.Key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der, s.ca.Certificate.Raw},
+		PrivateKey:  key,
+	}, nil
+}
+
+// CA returns the certificate agents are issued by
+func (s *Server) CA() *x509.Certificate {
+	return s.ca.Certificate
+}
+
+// loadCA reads the CA in dir, creating it if missing
+func loadCA(dir string) (*agent.CA, error) {
+	certPath, keyPath := filepath.Join(dir, caCertFile), filepath.Join(dir, caKeyFile)
+	if _, err := os.Stat(certPath); os.IsNotExist(err) {
+		if err := createCA(certPath, keyPath); err != nil {
+			return nil, fmt.Errorf("creating CA: %v", err)
+		}
+	}
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA: %v", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("CA key must be ECDSA")
+	}
+	return &agent.CA{Certificate: cert, Key: key}, nil
+}
+
+func createCA(certPath, keyPath string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	hostname, _ := os.Hostname()
+	tmpl, err := newTemplate("cert-manage agents "+hostname, caLifetime)
+	if err != nil {
+		return err
+	}
+	tmpl.IsCA = true
+	tmpl.BasicConstraintsValid = true
+	tmpl.MaxPathLenZero = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), file.TempFilePermissions)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+func newTemplate(name string, lifetime time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, serialLimit)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     now.Add(lifetime),
+	}, nil
+}
@@ -0,0 +1,212 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policyserver
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
+)
+
+// An agent's compliance with its group's whitelist
+const (
+	StatusCompliant = "compliant"
+	StatusPending   = "pending" // the current whitelist hasn't been applied yet
+	StatusFailed    = "failed"  // applying the current whitelist failed
+	StatusStale     = "stale"   // hasn't checked in for three intervals
+)
+
+// GroupStatus is the compliance of a group's agents
+type GroupStatus struct {
+	Name string `json:"name"`
+
+	// Version is the hash of the group's whitelist, see FetchPolicyResponse.
+	// Agents with labels selecting its variants are given other versions.
+	Version string `json:"version,omitempty"`
+
+	// Error is set if the group's whitelist can't be read
+	Error string `json:"error,omitempty"`
+
+	Agents []AgentStatus  `json:"agents"`
+	Counts map[string]int `json:"counts"`
+}
+
+// AgentStatus is an agent and its compliance
+type AgentStatus struct {
+	Agent
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Status returns the compliance of every group and its agents at now
+func (s *Server) Status(now time.Time) ([]GroupStatus, error) {
+	groups, err := s.Groups()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*GroupStatus)
+	var out []*GroupStatus
+	add := func(name string) *GroupStatus {
+		g := &GroupStatus{Name: name, Counts: make(map[string]int)}
+		if wh, err := s.Policy(name, nil); err != nil {
+			g.Error = err.Error()
+		} else {
+			g.Version = wh.Hash()
+		}
+		byName[name] = g
+		out = append(out, g)
+		return g
+	}
+	for i := range groups {
+		add(groups[i])
+	}
+
+	agents := s.Agents()
+	for i := range agents {
+		g, ok := byName[agents[i].Group]
+		if !ok {
+			g = add(agents[i].Group) // whitelist was removed
+		}
+		st := s.agentStatus(agents[i], now)
+		g.Agents = append(g.Agents, st)
+		g.Counts[st.Status]++
+	}
+
+	res := make([]GroupStatus, len(out))
+	for i := range out {
+		res[i] = *out[i]
+	}
+	return res, nil
+}
+
+func (s *Server) agentStatus(a Agent, now time.Time) AgentStatus {
+	st := AgentStatus{Agent: a}
+	var version string
+	if wh, err := s.Policy(a.Group, a.Labels); err == nil {
+		version = wh.Hash()
+	}
+	if now.Sub(a.LastSeen) > 3*s.Interval {
+		st.Status = StatusStale
+		st.Detail = "last seen " + timeutil.Time(a.LastSeen)
+		return st
+	}
+	if r := a.LastResult; r != nil && r.Version == version && !r.Success {
+		st.Status = StatusFailed
+		st.Detail = r.Error
+		return st
+	}
+	if len(a.Stores) == 0 || version == "" {
+		st.Status = StatusPending
+		return st
+	}
+	for i := range a.Stores {
+		if a.Stores[i].Error != "" {
+			st.Status = StatusFailed
+			st.Detail = a.Stores[i].Name + ": " + a.Stores[i].Error
+			return st
+		}
+		if a.Stores[i].Whitelist != version {
+			st.Status = StatusPending
+			st.Detail = a.Stores[i].Name + " hasn't applied the current whitelist"
+			return st
+		}
+	}
+	st.Status = StatusCompliant
+	return st
+}
+
+// Dashboard serves the compliance of the fleet as HTML on / and as JSON on
+// /status.json
+func (s *Server) Dashboard() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status.json", func(w http.ResponseWriter, r *http.Request) {
+		groups, err := s.Status(time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(groups)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		now := time.Now()
+		groups, err := s.Status(now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		dashboardTemplate.Execute(w, struct {
+			Generated string
+			Groups    []GroupStatus
+		}{
+			Generated: timeutil.Time(now),
+			Groups:    groups,
+		})
+	})
+	return mux
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"time": timeutil.Time,
+	"short": func(s string) string {
+		if len(s) > 16 {
+			return s[:16]
+		}
+		return s
+	},
+}).Parse(`<!doctype html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>cert-manage fleet</title>
+  <style>
+  body { font-family: sans-serif; margin: 2em; }
+  table { border-collapse: collapse; margin-bottom: 1em; }
+  th, td { border: 1px solid #CCC; padding: 4px 8px; text-align: left; }
+  th { background: #EEE; }
+  td.fp { font-family: monospace; }
+  .error, .failed { color: #A00; }
+  .compliant { color: #070; }
+  .pending, .stale { color: #A60; }
+  </style>
+</head>
+<body>
+<h1>Fleet compliance</h1>
+<p>Generated {{.Generated}}</p>
+
+<h2>Summary</h2>
+<table>
+<tr><th>Group</th><th>Whitelist</th><th>Agents</th><th>Compliant</th><th>Pending</th><th>Failed</th><th>Stale</th></tr>
+{{range .Groups}}<tr><td><a href="#{{.Name}}">{{.Name}}</a></td>{{if .Error}}<td class="error">{{.Error}}</td>{{else}}<td class="fp">{{short .Version}}</td>{{end}}<td>{{len .Agents}}</td><td>{{index .Counts "compliant"}}</td><td>{{index .Counts "pending"}}</td><td>{{index .Counts "failed"}}</td><td>{{index .Counts "stale"}}</td></tr>
+{{end}}</table>
+
+{{range .Groups}}{{if .Agents}}
+<h2 id="{{.Name}}">{{.Name}}</h2>
+<table>
+<tr><th>Host</th><th>Agent</th><th>OS</th><th>Version</th><th>Last seen</th><th>Status</th></tr>
+{{range .Agents}}<tr><td>{{.Hostname}}</td><td>{{.ID}}</td><td>{{.OS}}</td><td>{{.Version}}</td><td>{{time .LastSeen}}</td><td class="{{.Status}}">{{.Status}}{{if .Detail}}: {{.Detail}}{{end}}</td></tr>
+{{end}}</table>
+{{end}}{{end}}
+</body>
+</html>
+`))
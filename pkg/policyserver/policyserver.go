@@ -0,0 +1,350 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policyserver is a reference policy server for cert-manage agents
+// (see package agent). It serves a whitelist per group of agents from a
+// directory and records what each agent's stores trust, which its dashboard
+// shows as the compliance of the fleet.
+package policyserver
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/agent"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+var (
+	// DefaultGroup is the group agents enroll in when they don't ask for one
+	DefaultGroup = "default"
+
+	// DefaultInterval is how often agents are asked to check in
+	DefaultInterval = 15 * time.Minute
+
+	// groupExtensions are the whitelist files read from groups/, in order
+	groupExtensions = []string{".yaml", ".yml", ".json"}
+
+	groupName = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+)
+
+// Server stores per-group whitelists and agent state in Dir:
+//
+//   groups/<group>.yaml  the whitelist of each group (or .yml, .json)
+//   agents.json          every enrolled agent and what it last reported
+//   ca.crt, ca.key       the CA agent certificates are issued by
+type Server struct {
+	Dir string
+
+	// Token is the secret agents enroll with
+	Token string
+
+	// Interval is how often agents are asked to check in, agents which
+	// haven't in three intervals are shown as stale
+	Interval time.Duration
+
+	ca *agent.CA
+
+	mu     sync.Mutex
+	agents map[string]*Agent
+}
+
+// Agent is an enrolled agent and what it last reported
+type Agent struct {
+	ID       string `json:"id"`
+	Group    string `json:"group"`
+	Hostname string `json:"hostname"`
+	OS       string `json:"os"`
+	Version  string `json:"version,omitempty"`
+
+	// Labels are the host's, which select whitelist variants
+	Labels whitelist.Labels `json:"labels,omitempty"`
+
+	Enrolled time.Time `json:"enrolled"`
+	LastSeen time.Time `json:"lastSeen"`
+
+	Stores     []agent.StoreState        `json:"stores,omitempty"`
+	LastResult *agent.ApplyResultRequest `json:"lastResult,omitempty"`
+}
+
+// Open returns the Server kept in dir, creating the directory and its CA if
+// they're missing.
+func Open(dir, token string) (*Server, error) {
+	if token == "" {
+		return nil, errors.New("no enrollment token given")
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "groups"), file.TempDirPermissions); err != nil {
+		return nil, err
+	}
+	ca, err := loadCA(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		Dir:      dir,
+		Token:    token,
+		Interval: DefaultInterval,
+		ca:       ca,
+		agents:   make(map[string]*Agent),
+	}
+	bs, err := ioutil.ReadFile(filepath.Join(dir, "agents.json"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(bs) > 0 {
+		if err := json.Unmarshal(bs, &s.agents); err != nil {
+			return nil, fmt.Errorf("reading agents.json: %v", err)
+		}
+	}
+	return s, nil
+}
+
+// CACertificate returns the PEM file agents verify the server with (when
+// it serves a certificate from ServerCertificate)
+func (s *Server) CACertificate() string {
+	return filepath.Join(s.Dir, caCertFile)
+}
+
+// Groups returns the name of every group with a whitelist, sorted
+func (s *Server) Groups() ([]string, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(s.Dir, "groups"))
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var out []string
+	for i := range infos {
+		ext := filepath.Ext(infos[i].Name())
+		name := strings.TrimSuffix(infos[i].Name(), ext)
+		if infos[i].IsDir() || !isGroupExtension(ext) || seen[name] {
+			continue
+		}
+		seen[name] = true
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// Policy returns the whitelist of group for a host with labels, with the
+// variants they select and its policies applied as the agent applies it, so
+// its Hash() is what agents report once applied.
+func (s *Server) Policy(group string, labels whitelist.Labels) (whitelist.Whitelist, error) {
+	if !groupName.MatchString(group) {
+		return whitelist.Whitelist{}, fmt.Errorf("invalid group %q", group)
+	}
+	for _, ext := range groupExtensions {
+		path := filepath.Join(s.Dir, "groups", group+ext)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		wh, err := whitelist.FromFile(path)
+		if err != nil {
+			return wh, fmt.Errorf("group %s: %v", group, err)
+		}
+		return wh.ForLabels(labels).ForPolicies(nil)
+	}
+	return whitelist.Whitelist{}, fmt.Errorf("unknown group %q", group)
+}
+
+// Agents returns every enrolled agent, sorted by group and hostname
+func (s *Server) Agents() []Agent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]Agent, 0, len(s.agents))
+	for _, a := range s.agents {
+		out = append(out, *a)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Group == out[j].Group {
+			return out[i].Hostname < out[j].Hostname
+		}
+		return out[i].Group < out[j].Group
+	})
+	return out
+}
+
+func (s *Server) Enroll(req *agent.EnrollRequest) (*agent.EnrollResponse, error) {
+	if subtle.ConstantTimeCompare([]byte(req.Token), []byte(s.Token)) != 1 {
+		return nil, agent.ErrPermissionDenied
+	}
+	group := req.Group
+	if group == "" {
+		group = DefaultGroup
+	}
+	if _, err := s.Policy(group, req.Labels); err != nil {
+		return nil, err
+	}
+	id, err := newAgentID(req.Hostname)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := s.ca.Sign(req.CSR, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// re-enrolling a host replaces it
+	for k, a := range s.agents {
+		if a.Hostname == req.Hostname && a.Group == group {
+			delete(s.agents, k)
+		}
+	}
+	now := time.Now()
+	s.agents[id] = &Agent{
+		ID:       id,
+		Group:    group,
+		Hostname: req.Hostname,
+		OS:       req.OS,
+		Labels:   req.Labels,
+		Enrolled: now,
+		LastSeen: now,
+	}
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return &agent.EnrollResponse{
+		AgentID:      id,
+		Group:        group,
+		Certificates: [][]byte{cert, s.ca.Certificate.Raw},
+	}, nil
+}
+
+func (s *Server) ReportState(id string, req *agent.ReportStateRequest) (*agent.ReportStateResponse, error) {
+	err := s.update(id, func(a *Agent) {
+		if req.Hostname != "" {
+			a.Hostname = req.Hostname
+		}
+		if req.OS != "" {
+			a.OS = req.OS
+		}
+		a.Version = req.Version
+		a.Stores = req.Stores
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &agent.ReportStateResponse{}, nil
+}
+
+func (s *Server) FetchPolicy(id string, req *agent.FetchPolicyRequest) (*agent.FetchPolicyResponse, error) {
+	var group string
+	var labels whitelist.Labels
+	err := s.update(id, func(a *Agent) {
+		if req.Labels != nil {
+			a.Labels = req.Labels
+		}
+		group, labels = a.Group, a.Labels
+	})
+	if err != nil {
+		return nil, err
+	}
+	wh, err := s.Policy(group, labels)
+	if err != nil {
+		return nil, err
+	}
+	resp := &agent.FetchPolicyResponse{
+		Group:    group,
+		Version:  wh.Hash(),
+		Interval: int32(s.Interval / time.Second),
+	}
+	if req.Version == resp.Version {
+		resp.NotModified = true
+		return resp, nil
+	}
+	resp.Whitelist, err = json.Marshal(wh)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *Server) ApplyResult(id string, req *agent.ApplyResultRequest) (*agent.ApplyResultResponse, error) {
+	if err := s.update(id, func(a *Agent) { a.LastResult = req }); err != nil {
+		return nil, err
+	}
+	return &agent.ApplyResultResponse{}, nil
+}
+
+// update calls fn with the agent id and saves it, agents which aren't
+// enrolled (e.g. removed from agents.json) are refused.
+func (s *Server) update(id string, fn func(a *Agent)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.agents[id]
+	if !ok {
+		return agent.ErrPermissionDenied
+	}
+	fn(a)
+	a.LastSeen = time.Now()
+	return s.save()
+}
+
+// save writes agents.json, s.mu must be held
+func (s *Server) save() error {
+	bs, err := json.MarshalIndent(s.agents, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.Dir, "agents.json")
+	if err := ioutil.WriteFile(path+".tmp", bs, file.TempFilePermissions); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// newAgentID returns an ID for hostname which is unique across re-enrollments
+func newAgentID(hostname string) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.' {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(hostname))
+	if name == "" {
+		name = "agent"
+	}
+	return name + "-" + hex.EncodeToString(suffix), nil
+}
+
+func isGroupExtension(ext string) bool {
+	for i := range groupExtensions {
+		if ext == groupExtensions[i] {
+			return true
+		}
+	}
+	return false
+}
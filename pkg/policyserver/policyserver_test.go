@@ -0,0 +1,238 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policyserver
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/agent"
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+func TestPolicyServer__fleet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-policyserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Open(filepath.Join(dir, "server"), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(s.Dir, "groups", "servers.yaml"), []byte("fingerprints:\n  - 00112233\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := s.ServerCertificate([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(agent.NewHandler(s))
+	srv.TLS = agent.ServerTLSConfig(cert, s.CA())
+	srv.StartTLS()
+	defer srv.Close()
+
+	client := &agent.Client{
+		Dir:      filepath.Join(dir, "agent"),
+		Server:   srv.URL,
+		ServerCA: s.CACertificate(),
+	}
+	if err := client.Enroll("secret", "databases"); err == nil || !strings.Contains(err.Error(), "unknown group") {
+		t.Errorf("expected unknown group, got %v", err)
+	}
+	if err := client.Enroll("secret", "servers"); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := client.FetchPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wh whitelist.Whitelist
+	if err := json.Unmarshal(policy.Whitelist, &wh); err != nil {
+		t.Fatal(err)
+	}
+	if len(wh.Fingerprints) != 1 || policy.Version != wh.Hash() || policy.Interval != int32(DefaultInterval/time.Second) {
+		t.Errorf("got %#v", policy)
+	}
+
+	status := func() AgentStatus {
+		groups, err := s.Status(time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(groups) != 1 || len(groups[0].Agents) != 1 {
+			t.Fatalf("got %#v", groups)
+		}
+		return groups[0].Agents[0]
+	}
+	if st := status(); st.Status != StatusPending {
+		t.Errorf("got %#v", st)
+	}
+
+	// failing to apply the current policy
+	if err := client.ApplyResult(&agent.ApplyResultRequest{Version: policy.Version, Store: "linux", Error: "boom"}); err != nil {
+		t.Fatal(err)
+	}
+	if st := status(); st.Status != StatusFailed || st.Detail != "boom" {
+		t.Errorf("got %#v", st)
+	}
+
+	// applied
+	if err := client.ApplyResult(&agent.ApplyResultRequest{Version: policy.Version, Store: "linux", Success: true}); err != nil {
+		t.Fatal(err)
+	}
+	err = client.ReportState(&agent.ReportStateRequest{
+		Hostname: "web-1",
+		Version:  "dev",
+		Stores:   []agent.StoreState{{Name: "linux", Whitelist: policy.Version}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := status(); st.Status != StatusCompliant || st.Hostname != "web-1" {
+		t.Errorf("got %#v", st)
+	}
+
+	// state survives a restart, and quiet agents go stale
+	s, err = Open(s.Dir, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, err := s.Status(time.Now().Add(4 * DefaultInterval))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := groups[0].Agents[0]; st.Status != StatusStale || groups[0].Counts[StatusStale] != 1 {
+		t.Errorf("got %#v", st)
+	}
+
+	// dashboard
+	w := httptest.NewRecorder()
+	s.Dashboard().ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "web-1") {
+		t.Errorf("got %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	s.Dashboard().ServeHTTP(w, httptest.NewRequest("GET", "/status.json", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"compliant"`) {
+		t.Errorf("got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPolicyServer__labels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-policyserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := "fingerprints:\n  - base\nvariants:\n  - selector: role=ci\n    fingerprints:\n      - ci\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "groups", "default.yaml"), []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+	root, err := testca.NewRoot("agents", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, key, err := root.NewLeaf("host", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s.Enroll(&agent.EnrollRequest{Token: "secret", Hostname: "runner", CSR: csr, Labels: map[string]string{"role": "ci"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := s.FetchPolicy(resp.AgentID, &agent.FetchPolicyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wh whitelist.Whitelist
+	if err := json.Unmarshal(policy.Whitelist, &wh); err != nil {
+		t.Fatal(err)
+	}
+	if len(wh.Fingerprints) != 2 || len(wh.Variants) != 0 {
+		t.Errorf("got %#v", wh)
+	}
+
+	// the agent is compliant with its variant, not the group's base
+	s.ReportState(resp.AgentID, &agent.ReportStateRequest{Stores: []agent.StoreState{{Name: "linux", Whitelist: policy.Version}}})
+	groups, err := s.Status(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groups[0].Version == policy.Version || groups[0].Agents[0].Status != StatusCompliant {
+		t.Errorf("got %#v", groups[0])
+	}
+
+	// labels changed, the base whitelist is sent
+	policy, err = s.FetchPolicy(resp.AgentID, &agent.FetchPolicyRequest{Version: policy.Version, Labels: map[string]string{"role": "web"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.NotModified || policy.Version != groups[0].Version {
+		t.Errorf("got %#v", policy)
+	}
+}
+
+func TestPolicyServer__enroll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-policyserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := Open(dir, ""); err == nil {
+		t.Error("expected error without a token")
+	}
+	s, err := Open(dir, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Enroll(&agent.EnrollRequest{Token: "wrong"}); err != agent.ErrPermissionDenied {
+		t.Errorf("got %v", err)
+	}
+	if _, err := s.FetchPolicy("unknown", &agent.FetchPolicyRequest{}); err != agent.ErrPermissionDenied {
+		t.Errorf("got %v", err)
+	}
+	if _, err := s.Policy("../etc", nil); err == nil {
+		t.Error("expected error")
+	}
+	if id, _ := newAgentID("Web 1.example.com"); !strings.HasPrefix(id, "web-1.example.com-") {
+		t.Errorf("got %s", id)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package privilege
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
+)
+
+var (
+	debug = os.Getenv("DEBUG") != ""
+
+	// ErrSkipped is returned when an operation required escalated privileges,
+	// but escalation has been disabled (e.g. with -no-sudo).
+	ErrSkipped = errors.New("operation skipped, requires escalated privileges")
+
+	mu       sync.Mutex // protects disabled and skipped
+	disabled bool
+	skipped  []string
+
+	// isRoot is overridden in tests
+	isRoot = func() bool {
+		return os.Getuid() == 0
+	}
+)
+
+// Disable prevents any future escalation of privileges. Operations which need
+// escalation will return ErrSkipped and are recorded for Skipped().
+func Disable() {
+	mu.Lock()
+	defer mu.Unlock()
+	disabled = true
+}
+
+// Skipped returns a description of each operation which wasn't ran because
+// escalation was disabled.
+func Skipped() []string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	out := make([]string, len(skipped))
+	copy(out, skipped)
+	return out
+}
+
+// Command returns an *exec.Cmd which will run `name` with elevated privileges.
+//
+// If we're already running as root (or on windows) the command is returned as-is.
+// Otherwise the platform's escalation method is used: sudo from a terminal, osascript
+// authorization on darwin and polkit (pkexec) on linux when there's no terminal.
+func Command(name string, args ...string) (*exec.Cmd, error) {
+	if runtime.GOOS == "windows" || isRoot() {
+		return interrupt.Command(name, args...), nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if disabled {
+		skipped = append(skipped, strings.Join(append([]string{name}, args...), " "))
+		return nil, ErrSkipped
+	}
+	return escalate(name, args), nil
+}
+
+// CommandFor returns an *exec.Cmd which can modify `path`, only escalating if
+// the current user is unable to write to `path` already.
+func CommandFor(path string, name string, args ...string) (*exec.Cmd, error) {
+	if !NeedsEscalation(path) {
+		return interrupt.Command(name, args...), nil
+	}
+	return Command(name, args...)
+}
+
+func escalate(name string, args []string) *exec.Cmd {
+	interactive := isTerminal(os.Stdin)
+	switch runtime.GOOS {
+	case "darwin":
+		if !interactive {
+			return osascript(name, args)
+		}
+	case "linux":
+		if !interactive {
+			if bin, err := exec.LookPath("pkexec"); err == nil {
+				// pkexec requires an absolute path to the program
+				if full, err := exec.LookPath(name); err == nil {
+					name = full
+				}
+				return debugCmd(interrupt.Command(bin, append([]string{name}, args...)...))
+			}
+		}
+	}
+	return debugCmd(interrupt.Command("sudo", append([]string{name}, args...)...))
+}
+
+// osascript asks the user for authorization through the standard darwin
+// dialog, which is used when we aren't attached to a terminal for sudo.
+func osascript(name string, args []string) *exec.Cmd {
+	script := fmt.Sprintf(`do shell script "%s" with administrator privileges`, appleScriptEscape(shellJoin(name, args)))
+	return debugCmd(interrupt.Command("osascript", "-e", script))
+}
+
+func shellJoin(name string, args []string) string {
+	parts := make([]string, len(args)+1)
+	parts[0] = shellQuote(name)
+	for i := range args {
+		parts[i+1] = shellQuote(args[i])
+	}
+	return strings.Join(parts, " ")
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func appleScriptEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return r.Replace(s)
+}
+
+func isTerminal(f *os.File) bool {
+	s, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return s.Mode()&os.ModeCharDevice != 0
+}
+
+func debugCmd(cmd *exec.Cmd) *exec.Cmd {
+	if debug {
+		fmt.Printf("privilege: escalating with %q\n", strings.Join(cmd.Args, " "))
+	}
+	return cmd
+}
@@ -0,0 +1,97 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package privilege
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPrivilege__command(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no escalation on windows")
+	}
+
+	orig := isRoot
+	defer func() {
+		isRoot = orig
+	}()
+
+	// already root, so don't escalate
+	isRoot = func() bool { return true }
+	cmd, err := Command("ls", "-l")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmd.Args) != 2 || cmd.Args[0] != "ls" {
+		t.Errorf("got %q", cmd.Args)
+	}
+
+	// non-root, we should escalate
+	isRoot = func() bool { return false }
+	cmd, err = Command("ls", "-l")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmd.Args) <= 2 {
+		t.Errorf("expected escalation, got %q", cmd.Args)
+	}
+
+	// disabled, we should record the skipped operation
+	Disable()
+	defer func() {
+		disabled = false
+		skipped = nil
+	}()
+	cmd, err = Command("ls", "-l")
+	if err != ErrSkipped || cmd != nil {
+		t.Errorf("expected ErrSkipped, got cmd=%v err=%v", cmd, err)
+	}
+	if ss := Skipped(); len(ss) != 1 || ss[0] != "ls -l" {
+		t.Errorf("got %q", ss)
+	}
+}
+
+func TestPrivilege__osascript(t *testing.T) {
+	cmd := osascript("/usr/bin/security", []string{"add-trusted-cert", `it's "quoted"`})
+	if len(cmd.Args) != 3 {
+		t.Fatalf("got %q", cmd.Args)
+	}
+	script := cmd.Args[2]
+	if !strings.HasPrefix(script, `do shell script "'/usr/bin/security' 'add-trusted-cert'`) {
+		t.Errorf("got %q", script)
+	}
+	if !strings.Contains(script, `'it'\\''s \"quoted\"'`) {
+		t.Errorf("got %q", script)
+	}
+	if !strings.HasSuffix(script, "with administrator privileges") {
+		t.Errorf("got %q", script)
+	}
+}
+
+func TestPrivilege__shellQuote(t *testing.T) {
+	cases := map[string]string{
+		"":      "''",
+		"a b":   "'a b'",
+		"it's":  `'it'\''s'`,
+		"/path": "'/path'",
+	}
+	for in, out := range cases {
+		if v := shellQuote(in); v != out {
+			t.Errorf("shellQuote(%q) = %q, expected %q", in, v, out)
+		}
+	}
+}
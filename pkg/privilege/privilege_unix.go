@@ -0,0 +1,37 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build darwin linux
+
+package privilege
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+const writeOK = 0x2 // W_OK from unistd.h
+
+// NeedsEscalation returns true if the current user can't write to `path`.
+// If `path` doesn't exist its parent directory is checked instead.
+func NeedsEscalation(path string) bool {
+	if isRoot() {
+		return false
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		path = filepath.Dir(path)
+	}
+	return syscall.Access(path, writeOK) != nil
+}
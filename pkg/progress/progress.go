@@ -0,0 +1,174 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package progress reports the progress of long running operations. On a
+// terminal a bar (or spinner, when the total is unknown) is redrawn in place,
+// otherwise a log line is written periodically.
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// How often a terminal is redrawn and log lines are written
+	redrawInterval = 100 * time.Millisecond
+	logInterval    = 10 * time.Second
+
+	barWidth = 30
+	spinner  = []string{"|", "/", "-", "\\"}
+)
+
+// Bar tracks the progress of an operation with an optional total. A zero
+// (or negative) total shows a spinner on terminals.
+type Bar struct {
+	w     io.Writer
+	tty   bool
+	label string
+	bytes bool
+
+	mu      sync.Mutex
+	total   int64
+	current int64
+	frame   int
+	last    time.Time
+	started time.Time
+}
+
+// New returns a Bar counting items, written to stderr
+func New(label string, total int) *Bar {
+	return newBar(os.Stderr, isTerminal(os.Stderr), label, int64(total), false)
+}
+
+// NewBytes returns a Bar counting bytes, written to stderr
+func NewBytes(label string, total int64) *Bar {
+	return newBar(os.Stderr, isTerminal(os.Stderr), label, total, true)
+}
+
+func newBar(w io.Writer, tty bool, label string, total int64, bytes bool) *Bar {
+	now := time.Now()
+	return &Bar{
+		w:       w,
+		tty:     tty,
+		label:   label,
+		bytes:   bytes,
+		total:   total,
+		started: now,
+		last:    now,
+	}
+}
+
+// Add records n more items (or bytes) as completed
+func (b *Bar) Add(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.current += n
+	interval := logInterval
+	if b.tty {
+		interval = redrawInterval
+	}
+	if time.Since(b.last) < interval {
+		return
+	}
+	b.last = time.Now()
+	b.write()
+}
+
+// Increment records one more item as completed
+func (b *Bar) Increment() {
+	b.Add(1)
+}
+
+// Done writes the final state of the Bar. On a terminal nothing is written
+// for operations which finished before the first redraw.
+func (b *Bar) Done() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tty {
+		if b.last.Equal(b.started) {
+			return
+		}
+		b.write()
+		fmt.Fprintln(b.w)
+		return
+	}
+	if !b.last.Equal(b.started) {
+		b.write()
+	}
+}
+
+func (b *Bar) write() {
+	count := b.format(b.current)
+	if b.total > 0 {
+		count = fmt.Sprintf("%s/%s", count, b.format(b.total))
+	}
+	if !b.tty {
+		fmt.Fprintf(b.w, "%s: %s\n", b.label, count)
+		return
+	}
+	if b.total <= 0 {
+		b.frame = (b.frame + 1) % len(spinner)
+		fmt.Fprintf(b.w, "\r%s %s %s", b.label, spinner[b.frame], count)
+		return
+	}
+	filled := int(int64(barWidth) * b.current / b.total)
+	if filled > barWidth {
+		filled = barWidth
+	}
+	fmt.Fprintf(b.w, "\r%s [%s%s] %s", b.label, strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled), count)
+}
+
+func (b *Bar) format(n int64) string {
+	if !b.bytes {
+		return fmt.Sprintf("%d", n)
+	}
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// Reader wraps r, recording each read on b
+func Reader(r io.Reader, b *Bar) io.Reader {
+	return &reader{r: r, b: b}
+}
+
+type reader struct {
+	r io.Reader
+	b *Bar
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.b.Add(int64(n))
+	return n, err
+}
+
+func isTerminal(f *os.File) bool {
+	s, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return s.Mode()&os.ModeCharDevice != 0
+}
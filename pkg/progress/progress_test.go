@@ -0,0 +1,74 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package progress
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgress__tty(t *testing.T) {
+	redrawInterval = 0
+	defer func() { redrawInterval = 100 * time.Millisecond }()
+
+	var buf bytes.Buffer
+	b := newBar(&buf, true, "removing", 4, false)
+	b.Increment()
+	b.Increment()
+	if !strings.HasSuffix(buf.String(), "\rremoving [===============               ] 2/4") {
+		t.Errorf("got %q", buf.String())
+	}
+	b.Add(2)
+	b.Done()
+	if !strings.HasSuffix(buf.String(), "] 4/4\n") {
+		t.Errorf("got %q", buf.String())
+	}
+
+	// spinner without a total
+	buf.Reset()
+	b = newBar(&buf, true, "reading", 0, false)
+	b.Increment()
+	if buf.String() != "\rreading / 1" {
+		t.Errorf("got %q", buf.String())
+	}
+}
+
+func TestProgress__log(t *testing.T) {
+	var buf bytes.Buffer
+	b := newBar(&buf, false, "fetch", 2<<20, true)
+	b.Increment()
+	if buf.Len() != 0 {
+		t.Errorf("expected no output before logInterval, got %q", buf.String())
+	}
+
+	// nothing is written for quick operations
+	b.Done()
+	if buf.Len() != 0 {
+		t.Errorf("got %q", buf.String())
+	}
+
+	logInterval = 0
+	defer func() { logInterval = 10 * time.Second }()
+	r := Reader(strings.NewReader(strings.Repeat("a", 2048)), b)
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "fetch: 2.0KB/2.0MB\n") {
+		t.Errorf("got %q", buf.String())
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sshca
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
+)
+
+const manifestName = "manifest.json"
+
+// manifest records where each file in a backup was copied from, keyed by
+// its name in the backup directory
+type manifest struct {
+	Files map[string]File `json:"files"`
+}
+
+// Backup copies each of Files() into a new directory under dir and
+// returns its path
+func Backup(dir string) (string, error) {
+	where := filepath.Join(dir, timeutil.Stamp(time.Now()))
+	if err := os.MkdirAll(where, file.TempDirPermissions); err != nil {
+		return "", err
+	}
+	m := manifest{
+		Files: make(map[string]File),
+	}
+	for i, f := range Files() {
+		name := fmt.Sprintf("%d-%s", i, filepath.Base(f.Path))
+		if err := file.CopyFile(f.Path, filepath.Join(where, name)); err != nil {
+			return "", err
+		}
+		m.Files[name] = f
+	}
+	bs, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(where, manifestName), bs, file.TempFilePermissions); err != nil {
+		return "", err
+	}
+	return where, nil
+}
+
+// LatestBackup returns the newest backup in dir, or an empty string if
+// there are none
+func LatestBackup(dir string) (string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	file.SortFileInfos(fis)
+	for i := len(fis) - 1; i >= 0; i-- {
+		where := filepath.Join(dir, fis[i].Name())
+		if fis[i].IsDir() && file.Exists(filepath.Join(where, manifestName)) {
+			return where, nil
+		}
+	}
+	return "", nil
+}
+
+func readManifest(where string) (*manifest, []string, error) {
+	bs, err := ioutil.ReadFile(filepath.Join(where, manifestName))
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading ssh backup: %v", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(bs, &m); err != nil {
+		return nil, nil, fmt.Errorf("reading ssh backup: %v", err)
+	}
+	var names []string
+	for name := range m.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &m, names, nil
+}
+
+// ListBackup returns the CA keys trusted in a backup, with the paths they
+// were backed up from
+func ListBackup(where string) ([]Key, error) {
+	m, names, err := readManifest(where)
+	if err != nil {
+		return nil, err
+	}
+	var out []Key
+	for _, name := range names {
+		keys, err := readFile(m.Files[name], filepath.Join(where, name))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, keys...)
+	}
+	return out, nil
+}
+
+// Restore copies each file in a backup back to where it was taken from
+func Restore(where string) error {
+	m, names, err := readManifest(where)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, name := range names {
+		f := m.Files[name]
+		bs, err := ioutil.ReadFile(filepath.Join(where, name))
+		if err == nil {
+			err = writeFile(f.Path, bs)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", f.Path, err))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, ", "))
+	}
+	return nil
+}
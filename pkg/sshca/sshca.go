@@ -0,0 +1,333 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sshca reads and changes the certificate authorities OpenSSH
+// trusts: @cert-authority lines in known_hosts files, whose keys sign host
+// certificates, and sshd's TrustedUserCAKeys file, whose keys sign user
+// certificates.
+//
+// Docs:
+//  - https://man.openbsd.org/sshd.8#SSH_KNOWN_HOSTS_FILE_FORMAT
+//  - https://man.openbsd.org/sshd_config#TrustedUserCAKeys
+package sshca
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/file"
+)
+
+var (
+	// KnownHostsFiles are read for @cert-authority lines, a leading ~ is
+	// the user's home directory
+	KnownHostsFiles = []string{
+		"~/.ssh/known_hosts",
+		"/etc/ssh/ssh_known_hosts",
+	}
+
+	// SSHDConfig is read for the TrustedUserCAKeys file
+	SSHDConfig = "/etc/ssh/sshd_config"
+)
+
+const (
+	// HostCA keys sign host certificates, they're trusted in known_hosts
+	HostCA = "host"
+
+	// UserCA keys sign user certificates, they're trusted by sshd
+	UserCA = "user"
+)
+
+// File is a file holding trusted CA keys
+type File struct {
+	Path string
+	Kind string // HostCA or UserCA
+}
+
+// Key is a trusted CA public key
+type Key struct {
+	Kind string // HostCA or UserCA
+
+	// Type is the key's algorithm, e.g. ssh-ed25519
+	Type string
+
+	// Fingerprint is the SHA256 fingerprint, as ssh-keygen -l prints it
+	Fingerprint string
+
+	Bits    int
+	Comment string
+
+	// Hosts are the host patterns a HostCA is trusted for
+	Hosts string
+
+	Path string
+	Line int
+}
+
+// Files returns each file in KnownHostsFiles, and the TrustedUserCAKeys
+// file of sshd, which exists
+func Files() []File {
+	var out []File
+	for i := range KnownHostsFiles {
+		path := expandHome(KnownHostsFiles[i])
+		if file.Exists(path) {
+			out = append(out, File{Path: path, Kind: HostCA})
+		}
+	}
+	if path := trustedUserCAKeys(SSHDConfig); path != "" && file.Exists(path) {
+		out = append(out, File{Path: path, Kind: UserCA})
+	}
+	return out
+}
+
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		return filepath.Join(file.HomeDir(), path[2:])
+	}
+	return path
+}
+
+// trustedUserCAKeys returns the TrustedUserCAKeys path in an sshd_config,
+// the first value given is used like sshd does. Paths with %-tokens aren't
+// supported.
+func trustedUserCAKeys(config string) string {
+	bs, err := ioutil.ReadFile(config)
+	if err != nil {
+		return ""
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(bs))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "TrustedUserCAKeys") {
+			continue
+		}
+		path := strings.Trim(fields[1], `"`)
+		if strings.EqualFold(path, "none") || strings.Contains(path, "%") {
+			return ""
+		}
+		return expandHome(path)
+	}
+	return ""
+}
+
+// List returns the CA keys trusted in each of Files()
+func List() ([]Key, error) {
+	var out []Key
+	for _, f := range Files() {
+		keys, err := readFile(f, f.Path)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, keys...)
+	}
+	return out, nil
+}
+
+// readFile returns the CA keys in `path`, which holds the contents of f
+func readFile(f File, path string) ([]Key, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var out []Key
+	lines := strings.Split(string(bs), "\n")
+	for i := range lines {
+		k, ok := parseLine(f, lines[i])
+		if ok {
+			k.Line = i + 1
+			out = append(out, k)
+		}
+	}
+	return out, nil
+}
+
+// parseLine reads a CA key from a line of f. Lines which aren't CA keys,
+// or can't be parsed, return false.
+func parseLine(f File, line string) (Key, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return Key{}, false
+	}
+	k := Key{
+		Kind: f.Kind,
+		Path: f.Path,
+	}
+	if f.Kind == HostCA {
+		// @cert-authority <hosts> <type> <key> [comment]
+		if len(fields) < 4 || fields[0] != "@cert-authority" {
+			return Key{}, false
+		}
+		k.Hosts = fields[1]
+		fields = fields[2:]
+	}
+	if len(fields) < 2 {
+		return Key{}, false
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return Key{}, false
+	}
+	k.Type = fields[0]
+	k.Fingerprint = Fingerprint(blob)
+	k.Bits = keyBits(blob)
+	k.Comment = strings.Join(fields[2:], " ")
+	return k, true
+}
+
+// Fingerprint returns the SHA256 fingerprint of a public key blob, as
+// ssh-keygen -l prints it
+func Fingerprint(blob []byte) string {
+	sum := sha256.Sum256(blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// keyBits returns the size of a public key blob (RFC 4253 6.6), or zero if
+// it isn't known
+func keyBits(blob []byte) int {
+	fields := readStrings(blob)
+	if len(fields) == 0 {
+		return 0
+	}
+	switch string(fields[0]) {
+	case "ssh-rsa":
+		// string "ssh-rsa", mpint e, mpint n
+		if len(fields) == 3 {
+			return mpintBits(fields[2])
+		}
+	case "ssh-dss":
+		// string "ssh-dss", mpint p, q, g, y
+		if len(fields) == 5 {
+			return mpintBits(fields[1])
+		}
+	case "ssh-ed25519", "sk-ssh-ed25519@openssh.com":
+		return 256
+	case "ecdsa-sha2-nistp256", "sk-ecdsa-sha2-nistp256@openssh.com":
+		return 256
+	case "ecdsa-sha2-nistp384":
+		return 384
+	case "ecdsa-sha2-nistp521":
+		return 521
+	}
+	return 0
+}
+
+// readStrings splits an SSH wire encoded blob into its length prefixed fields
+func readStrings(blob []byte) [][]byte {
+	var out [][]byte
+	for len(blob) >= 4 {
+		n := binary.BigEndian.Uint32(blob)
+		blob = blob[4:]
+		if uint64(n) > uint64(len(blob)) {
+			return nil
+		}
+		out = append(out, blob[:n])
+		blob = blob[n:]
+	}
+	return out
+}
+
+func mpintBits(bs []byte) int {
+	for len(bs) > 0 && bs[0] == 0 {
+		bs = bs[1:]
+	}
+	if len(bs) == 0 {
+		return 0
+	}
+	bits := (len(bs) - 1) * 8
+	for b := bs[0]; b > 0; b >>= 1 {
+		bits++
+	}
+	return bits
+}
+
+// Remove drops each CA key which keep returns false for from Files(), other
+// lines are left as-is. Files which can't be written are returned in the
+// error after the others are changed.
+func Remove(keep func(Key) bool) error {
+	var failed []string
+	for _, f := range Files() {
+		if err := removeFrom(f, keep); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", f.Path, err))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func removeFrom(f File, keep func(Key) bool) error {
+	bs, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(bs), "\n")
+	out := lines[:0]
+	removed := 0
+	for i := range lines {
+		if k, ok := parseLine(f, lines[i]); ok {
+			k.Line = i + 1
+			if !keep(k) {
+				removed++
+				continue
+			}
+		}
+		out = append(out, lines[i])
+	}
+	if removed == 0 {
+		return nil
+	}
+	return writeFile(f.Path, []byte(strings.Join(out, "\n")))
+}
+
+// writeFile replaces the contents of path, keeping its permissions. System
+// files (e.g. /etc/ssh/ssh_known_hosts) are copied into place with
+// escalated privileges.
+func writeFile(path string, bs []byte) error {
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	err := ioutil.WriteFile(path, bs, mode)
+	if err == nil || !os.IsPermission(err) {
+		return err
+	}
+	fd, err := ioutil.TempFile("", "cert-manage-sshca")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fd.Name())
+	if _, err := fd.Write(bs); err != nil {
+		fd.Close()
+		return err
+	}
+	if err := fd.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(fd.Name(), mode); err != nil {
+		return err
+	}
+	return file.SudoCopyFile(fd.Name(), path)
+}
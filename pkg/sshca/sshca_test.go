@@ -0,0 +1,139 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sshca
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	hostCA  = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGrxjjvKoaaQfNadnkN4ou3UK1kw0kRFi3I5G0xLYY8b host-ca"
+	hostFP  = "SHA256:IbZNb1n2XzGLUCfB0ywgo5AsXEoa6xUMNZniU0N4tQs"
+	userCA  = "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAAAgQDTss6xRvzlgUQQ4I0BsqS/qAduQaV0Pazqodtlj0a8BsIyLYogfhESDoBWpkDAQzDQ6BlwA02otLxEX94R+fDlNDNKr2ZRcSguHVyFrYEJxB4IS20W+eZy/76XKXX8xKuMJTocFS73EzDPjV5lE5dyX7SzYTnPsHigptbYxiGSXw== user-ca"
+	userFP  = "SHA256:1jBzuiOouBvM1efIPCik9+Tp3V2xUbS8MfB0+brblCE"
+	hostKey = "server.example.com ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGrxjjvKoaaQfNadnkN4ou3UK1kw0kRFi3I5G0xLYY8b"
+)
+
+// setup writes a known_hosts with two CAs and a host key, and an
+// sshd_config pointing at a TrustedUserCAKeys file with one CA
+func setup(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "cert-manage-sshca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"known_hosts": strings.Join([]string{"# comment", "@cert-authority *.example.com " + hostCA, hostKey, "@cert-authority * " + userCA, ""}, "\n"),
+		"user_ca.pub": userCA + "\n",
+		"sshd_config": "Port 22\ntrustedusercakeys " + filepath.Join(dir, "user_ca.pub") + "\n",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	origHosts, origConfig := KnownHostsFiles, SSHDConfig
+	KnownHostsFiles = []string{filepath.Join(dir, "known_hosts"), filepath.Join(dir, "missing")}
+	SSHDConfig = filepath.Join(dir, "sshd_config")
+	return dir, func() {
+		KnownHostsFiles, SSHDConfig = origHosts, origConfig
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSSHCA__List(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	keys, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 3 {
+		t.Fatalf("got %#v", keys)
+	}
+	k := keys[0]
+	if k.Kind != HostCA || k.Fingerprint != hostFP || k.Type != "ssh-ed25519" || k.Bits != 256 || k.Hosts != "*.example.com" || k.Comment != "host-ca" || k.Line != 2 {
+		t.Errorf("got %#v", k)
+	}
+	if k := keys[1]; k.Fingerprint != userFP || k.Bits != 1024 || k.Line != 4 {
+		t.Errorf("got %#v", k)
+	}
+	if k := keys[2]; k.Kind != UserCA || k.Fingerprint != userFP || k.Path != filepath.Join(dir, "user_ca.pub") {
+		t.Errorf("got %#v", k)
+	}
+}
+
+func TestSSHCA__trustedUserCAKeys(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	if path := trustedUserCAKeys(filepath.Join(dir, "missing")); path != "" {
+		t.Errorf("got %q", path)
+	}
+	for _, v := range []string{"none", "/etc/ssh/%u.pub"} {
+		if err := ioutil.WriteFile(SSHDConfig, []byte("TrustedUserCAKeys "+v+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if path := trustedUserCAKeys(SSHDConfig); path != "" {
+			t.Errorf("%s: got %q", v, path)
+		}
+	}
+	if n := len(Files()); n != 1 {
+		t.Errorf("got %d files in %s", n, dir)
+	}
+}
+
+func TestSSHCA__RemoveAndRestore(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	backups := filepath.Join(dir, "backups")
+	where, err := Backup(backups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest, err := LatestBackup(backups); err != nil || latest != where {
+		t.Fatalf("latest=%q err=%v", latest, err)
+	}
+
+	err = Remove(func(k Key) bool {
+		return k.Fingerprint == hostFP
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].Fingerprint != hostFP {
+		t.Errorf("got %#v", keys)
+	}
+	bs, _ := ioutil.ReadFile(filepath.Join(dir, "known_hosts"))
+	if !strings.Contains(string(bs), "# comment\n") || !strings.Contains(string(bs), hostKey) {
+		t.Errorf("other lines changed:\n%s", bs)
+	}
+
+	if err := Restore(where); err != nil {
+		t.Fatal(err)
+	}
+	if keys, err := List(); err != nil || len(keys) != 3 {
+		t.Errorf("got %d keys, err=%v", len(keys), err)
+	}
+}
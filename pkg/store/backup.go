@@ -0,0 +1,224 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+// backupLister is implemented by stores whose backups aren't a file (or
+// directory) of certificates, or whose Restore trusts more than the backup.
+type backupLister interface {
+	listBackup(where string) ([]*x509.Certificate, error)
+}
+
+// ListBackup returns the certificates which would be trusted after restoring
+// from `where`, or the latest backup if `where` is empty.
+func ListBackup(s Store, where string) ([]*x509.Certificate, error) {
+	s = unwrap(s)
+	if where == "" {
+		latest, err := s.GetLatestBackup()
+		if err != nil {
+			return nil, err
+		}
+		if latest == "" {
+			return nil, errors.New("no backup found")
+		}
+		where = latest
+	}
+	if _, ok := s.(memoryStore); !ok {
+		if err := prepareBackup(where); err != nil {
+			return nil, err
+		}
+	}
+	if l, ok := s.(backupLister); ok {
+		return l.listBackup(where)
+	}
+	return readBackupCertificates(where)
+}
+
+// readBackupCertificates decodes every certificate in a backup file, or in
+// each file under a backup directory.
+func readBackupCertificates(where string) ([]*x509.Certificate, error) {
+	pool := certutil.Pool{}
+	err := filepath.Walk(where, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		bs, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		certs, err := certutil.Decode(bs)
+		if err != nil {
+			if debug {
+				fmt.Printf("store: skipping %s in backup, err=%v\n", path, err)
+			}
+			return nil
+		}
+		pool.AddCertificates(certs)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	certs := pool.GetCertificates()
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("unable to read certificates from backup %s", where)
+	}
+	return certs, nil
+}
+
+// ReadBackup returns the certificates trusted by a backup file, whichever store
+// it was taken from. Directories of certificates, tar archives (optionally
+// gzipped), java keystores and darwin trust settings plists are read.
+func ReadBackup(where string) ([]*x509.Certificate, error) {
+	fi, err := os.Stat(where)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return readBackupCertificates(where)
+	}
+	bs, err := ioutil.ReadFile(where)
+	if err != nil {
+		return nil, err
+	}
+
+	head := bs
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	switch {
+	case isGzip(bs) || isTar(bs):
+		return readTarCertificates(where, bs)
+	case isKeystore(where, bs):
+		certs, err := keystoreCertificates(where)
+		if err != nil {
+			return nil, fmt.Errorf("error reading keystore %s: %v", where, err)
+		}
+		return certs, nil
+	case bytes.Contains(head, []byte("<plist")):
+		return readTrustSettingsBackup(bs)
+	}
+	return readBackupCertificates(where)
+}
+
+func isGzip(bs []byte) bool {
+	return len(bs) > 2 && bs[0] == 0x1f && bs[1] == 0x8b
+}
+
+func isTar(bs []byte) bool {
+	return len(bs) > 262 && string(bs[257:262]) == "ustar"
+}
+
+// isKeystore checks for the magic numbers of JKS and JCEKS keystores, PKCS#12
+// keystores can't be told apart from other DER so they're found by name.
+func isKeystore(where string, bs []byte) bool {
+	if len(bs) > 4 {
+		magic := bs[:4]
+		if bytes.Equal(magic, []byte{0xfe, 0xed, 0xfe, 0xed}) || bytes.Equal(magic, []byte{0xce, 0xce, 0xce, 0xce}) {
+			return true
+		}
+	}
+	name := strings.ToLower(filepath.Base(where))
+	return name == "cacerts" || strings.HasSuffix(name, ".jks") || strings.HasSuffix(name, ".keystore")
+}
+
+// readTarCertificates decodes every certificate in each file of a tar archive
+func readTarCertificates(where string, bs []byte) ([]*x509.Certificate, error) {
+	var r io.Reader = bytes.NewReader(bs)
+	if isGzip(bs) {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	pool := certutil.Pool{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", where, err)
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		bs, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		certs, err := certutil.Decode(bs)
+		if err != nil {
+			if debug {
+				fmt.Printf("store: skipping %s in %s, err=%v\n", hdr.Name, where, err)
+			}
+			continue
+		}
+		pool.AddCertificates(certs)
+	}
+	certs := pool.GetCertificates()
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("unable to read certificates from backup %s", where)
+	}
+	return certs, nil
+}
+
+// readTrustSettingsBackup returns the installed certificates which aren't
+// denied by a `security trust-settings-export` plist. The plist only holds
+// SHA1 fingerprints, so this only works on darwin where Apple's roots are.
+func readTrustSettingsBackup(bs []byte) ([]*x509.Certificate, error) {
+	if runtime.GOOS != "darwin" {
+		return nil, errors.New("trust settings plists can only be read on darwin")
+	}
+	settings, err := parseTrustSettings(bs)
+	if err != nil {
+		return nil, err
+	}
+
+	installed, err := platform().List(&ListOptions{
+		Trusted:   true,
+		Untrusted: true,
+	})
+	if _, ok := IsPartial(err); err != nil && !ok {
+		return nil, err
+	}
+	var out []*x509.Certificate
+	for i := range installed {
+		if !settings.denies(installed[i]) {
+			out = append(out, installed[i])
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+func TestStore__ListBackup(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a backup directory with certificates split across files
+	dir, err := ioutil.TempDir("", "cert-manage-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := certutil.ToFile(filepath.Join(dir, "a.crt"), certs[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := certutil.ToFile(filepath.Join(dir, "sub", "b.crt"), certs[1:4]); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a cert"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := dryRunStore{underlying: listStore{}}
+	found, err := ListBackup(s, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 4 {
+		t.Errorf("got %d certificates", len(found))
+	}
+
+	// single file
+	found, err = ListBackup(s, filepath.Join(dir, "a.crt"))
+	if err != nil || len(found) != 2 {
+		t.Errorf("got %d certificates, err=%v", len(found), err)
+	}
+
+	// emptyStore has no backups
+	if _, err := ListBackup(s, ""); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := ListBackup(s, filepath.Join(dir, "README")); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestStore__ReadBackup(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "cert-manage-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a gzipped tar of a pem dir, one certificate per file
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "certs/", Typeflag: tar.TypeDir, Mode: 0755})
+	for i := range certs {
+		var pem bytes.Buffer
+		pem.WriteString("-----BEGIN CERTIFICATE-----\n")
+		pem.WriteString(base64.StdEncoding.EncodeToString(certs[i].Raw))
+		pem.WriteString("\n-----END CERTIFICATE-----\n")
+		tw.WriteHeader(&tar.Header{Name: fmt.Sprintf("certs/%d.crt", i), Mode: 0644, Size: int64(pem.Len()), Typeflag: tar.TypeReg})
+		tw.Write(pem.Bytes())
+	}
+	tw.Close()
+	gz.Close()
+	archive := filepath.Join(dir, "certs.tar.gz")
+	if err := ioutil.WriteFile(archive, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadBackup(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != len(certs) {
+		t.Errorf("got %d certificates from tar", len(read))
+	}
+
+	// directories and plain files
+	if read, err := ReadBackup(filepath.Join("..", "..", "testdata", "lots.crt")); err != nil || len(read) != len(certs) {
+		t.Errorf("got %d certificates, err=%v", len(read), err)
+	}
+	if err := certutil.ToFile(filepath.Join(dir, "a.crt"), certs[:2]); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(archive)
+	if read, err := ReadBackup(dir); err != nil || len(read) != 2 {
+		t.Errorf("got %d certificates, err=%v", len(read), err)
+	}
+
+	if !isKeystore("/usr/lib/jvm/jre/lib/security/cacerts", nil) || !isKeystore("x", []byte{0xfe, 0xed, 0xfe, 0xed, 0x00}) || isKeystore("a.crt", []byte("-----BEGIN")) {
+		t.Error("unexpected keystore detection")
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+// benchCertificates is how many certificates each benchmarked store has,
+// far more than any real store, so slow paths stand out.
+const benchCertificates = 10000
+
+var (
+	benchOnce  sync.Once
+	benchCerts []*x509.Certificate
+	benchErr   error
+
+	// budgets are the slowest each benchmark can be, per operation, before
+	// TestStore__performanceBudget fails. They're loose enough for slow CI
+	// machines and only checked when BUDGET is set.
+	budgets = map[string]time.Duration{
+		"memory/list":   50 * time.Millisecond,
+		"memory/keep":   2 * time.Second,
+		"memory/remove": 2 * time.Second,
+		"file/list":     5 * time.Second,
+		"file/keep":     5 * time.Second,
+		"file/remove":   10 * time.Second,
+		"jks/list":      5 * time.Second,
+		"jks/keep":      5 * time.Second,
+		"jks/remove":    10 * time.Second,
+	}
+)
+
+// benchStore returns the synthetic certificates and a whitelist keeping
+// every other one.
+func benchStore(tb testing.TB) ([]*x509.Certificate, whitelist.Whitelist) {
+	benchOnce.Do(func() {
+		benchCerts, benchErr = testca.NewRoots("Benchmark Root", benchCertificates, nil)
+	})
+	if benchErr != nil {
+		tb.Fatal(benchErr)
+	}
+	wh := whitelist.Whitelist{}
+	for i := 0; i < len(benchCerts); i += 2 {
+		wh.Fingerprints = append(wh.Fingerprints, certutil.GetHexSHA256Fingerprint(*benchCerts[i]))
+	}
+	return benchCerts, wh
+}
+
+func benchFile(tb testing.TB, certs []*x509.Certificate) (fileStore, func()) {
+	dir, err := ioutil.TempDir("", "cert-manage-bench")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	s := fileStore{path: filepath.Join(dir, "bundle.pem")}
+	if err := certutil.ToFile(s.path, certs); err != nil {
+		tb.Fatal(err)
+	}
+	return s, func() { os.RemoveAll(dir) }
+}
+
+func benchKeystore(tb testing.TB, certs []*x509.Certificate) []byte {
+	ks := &javaKeystore{magic: jksMagic, version: jksDefaultVersion}
+	for i := range certs {
+		ks.entries = append(ks.entries, keystoreEntry{
+			alias:   certs[i].Subject.CommonName,
+			created: time.Now(),
+			cert:    certs[i],
+		})
+	}
+	bs, err := ks.marshal(defaultKeystorePassword)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return bs
+}
+
+// storeBenchmarks measures listing certificates, deciding which are kept by
+// a whitelist (as -dry-run does) and removing the others for each backend
+// which runs without the platform's tools.
+var storeBenchmarks = map[string]func(*testing.B){
+	"memory/list": func(b *testing.B) {
+		certs, _ := benchStore(b)
+		s := newMemoryStore(certs)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			s.List(nil)
+		}
+	},
+	"memory/keep": func(b *testing.B) {
+		certs, wh := benchStore(b)
+		s := newMemoryStore(certs)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			listed, _ := s.List(nil)
+			wh.MatchEach(listed)
+		}
+	},
+	"memory/remove": func(b *testing.B) {
+		certs, wh := benchStore(b)
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			s := newMemoryStore(certs)
+			b.StartTimer()
+			if err := s.Remove(wh); err != nil {
+				b.Fatal(err)
+			}
+		}
+	},
+	"file/list": func(b *testing.B) {
+		certs, _ := benchStore(b)
+		s, cleanup := benchFile(b, certs)
+		defer cleanup()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := s.List(nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	},
+	"file/keep": func(b *testing.B) {
+		certs, wh := benchStore(b)
+		s, cleanup := benchFile(b, certs)
+		defer cleanup()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			listed, err := s.List(nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			wh.MatchEach(listed)
+		}
+	},
+	"file/remove": func(b *testing.B) {
+		certs, wh := benchStore(b)
+		s, cleanup := benchFile(b, nil)
+		defer cleanup()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			if err := certutil.ToFile(s.path, certs); err != nil {
+				b.Fatal(err)
+			}
+			b.StartTimer()
+			if err := s.Remove(wh); err != nil {
+				b.Fatal(err)
+			}
+		}
+	},
+	"jks/list": func(b *testing.B) {
+		certs, _ := benchStore(b)
+		bs := benchKeystore(b, certs)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			ks, err := parseKeystore(bs, defaultKeystorePassword)
+			if err != nil {
+				b.Fatal(err)
+			}
+			ks.certificates()
+		}
+	},
+	"jks/keep": func(b *testing.B) {
+		certs, wh := benchStore(b)
+		bs := benchKeystore(b, certs)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			ks, err := parseKeystore(bs, defaultKeystorePassword)
+			if err != nil {
+				b.Fatal(err)
+			}
+			wh.MatchEach(ks.certificates())
+		}
+	},
+	"jks/remove": func(b *testing.B) {
+		certs, wh := benchStore(b)
+		bs := benchKeystore(b, certs)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			ks, err := parseKeystore(bs, defaultKeystorePassword)
+			if err != nil {
+				b.Fatal(err)
+			}
+			ks.remove(wh)
+			if _, err := ks.marshal(defaultKeystorePassword); err != nil {
+				b.Fatal(err)
+			}
+		}
+	},
+}
+
+func BenchmarkStore__memoryList(b *testing.B)   { storeBenchmarks["memory/list"](b) }
+func BenchmarkStore__memoryKeep(b *testing.B)   { storeBenchmarks["memory/keep"](b) }
+func BenchmarkStore__memoryRemove(b *testing.B) { storeBenchmarks["memory/remove"](b) }
+func BenchmarkStore__fileList(b *testing.B)     { storeBenchmarks["file/list"](b) }
+func BenchmarkStore__fileKeep(b *testing.B)     { storeBenchmarks["file/keep"](b) }
+func BenchmarkStore__fileRemove(b *testing.B)   { storeBenchmarks["file/remove"](b) }
+func BenchmarkStore__jksList(b *testing.B)      { storeBenchmarks["jks/list"](b) }
+func BenchmarkStore__jksKeep(b *testing.B)      { storeBenchmarks["jks/keep"](b) }
+func BenchmarkStore__jksRemove(b *testing.B)    { storeBenchmarks["jks/remove"](b) }
+
+// TestStore__performanceBudget fails when a benchmark is slower than its
+// budget, e.g. 'BUDGET=yes go test ./pkg/store -run performanceBudget'
+func TestStore__performanceBudget(t *testing.T) {
+	if os.Getenv("BUDGET") == "" {
+		t.Skip("BUDGET isn't set")
+	}
+	for name, bench := range storeBenchmarks {
+		res := testing.Benchmark(bench)
+		took := time.Duration(res.NsPerOp())
+		if debug {
+			t.Logf("%s: %v/op", name, took)
+		}
+		if budget := budgets[name]; took > budget {
+			t.Errorf("%s took %v, over its budget of %v", name, took, budget)
+		}
+	}
+}
@@ -16,12 +16,12 @@ package store
 
 import (
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
 
 	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
 )
 
 var (
@@ -57,10 +57,17 @@ type chromeStore struct {
 }
 
 func (s chromeStore) GetInfo() *Info {
-	return &Info{
-		Name:    "Chrome",
-		Version: chromeVersion(),
+	info := &Info{}
+	if underlying := s.Store.GetInfo(); underlying != nil {
+		*info = *underlying
 	}
+	info.Name = "Chrome"
+	info.Version = s.Version()
+	return info
+}
+
+func (s chromeStore) Version() string {
+	return chromeVersion()
 }
 
 func chromeVersion() string {
@@ -68,7 +75,7 @@ func chromeVersion() string {
 		path := chromeBinaryPaths[i]
 		if file.Exists(path) {
 			// returns "Google Chrome 63.0.3239.132"
-			out, err := exec.Command(path, "--version").CombinedOutput()
+			out, err := interrupt.Command(path, "--version").CombinedOutput()
 			if err == nil && len(out) > 0 {
 				ver := string(out)
 
@@ -17,17 +17,24 @@
 package store
 
 import (
+	"bytes"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/adamdecaf/cert-manage/pkg/certutil"
 	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
+	"github.com/adamdecaf/cert-manage/pkg/privilege"
+	"github.com/adamdecaf/cert-manage/pkg/progress"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
 	"github.com/adamdecaf/cert-manage/pkg/whitelist"
 )
 
@@ -58,6 +65,11 @@ var (
 
 	// Folder under ~/Library/cert-manage/ to put backups
 	darwinBackupDir = "darwin"
+
+	// unlockedKeychains holds each keychain we've unlocked, so users are only
+	// prompted once per keychain.
+	unlockedKeychains = make(map[string]bool)
+	unlockMu          sync.Mutex
 )
 
 // Docs
@@ -92,61 +104,160 @@ func (s darwinStore) Add(certs []*x509.Certificate) error {
 			return fmt.Errorf("Add: error writing cert %s to tempfile %s, err=%v", certs[i].Subject, path, err)
 		}
 
-		// add cert to keychain
-		resultType := "unspecified"
-		if certs[i].IsCA {
-			resultType = "trustAsRoot"
+		// The system scope adds to the System keychain with admin trust
+		// settings, otherwise the user's login keychain is used.
+		keychain := loginKeychain
+		if scope == ScopeSystem {
+			keychain = systemKeychain
+		}
+		if err := addTrustedCert(keychain, path, certs[i]); err != nil {
+			return fmt.Errorf("Add: %v", err)
 		}
+	}
+	return nil
+}
 
-		cmd := exec.Command("security", "add-trusted-cert", "-r", resultType, "-p", "ssl", "-k", loginKeychain, path)
-		out, err := cmd.CombinedOutput()
-		if err != nil && debug {
-			fmt.Printf("Command ran: %q\n", strings.Join(cmd.Args, " "))
-			fmt.Printf("Output was: %s\n", string(out))
+// addTrustedCert adds the certificate in path to keychain, certificates
+// added to the System keychain get admin trust settings.
+func addTrustedCert(keychain, path string, cert *x509.Certificate) error {
+	resultType := "unspecified"
+	if cert.IsCA {
+		resultType = "trustAsRoot"
+	}
+	admin := keychain == systemKeychain
+	args := []string{"add-trusted-cert"}
+	if admin {
+		args = append(args, "-d")
+	}
+	args = append(args, "-r", resultType, "-p", "ssl", "-k", keychain, path)
+
+	if err := unlockKeychain(keychain); err != nil {
+		return err
+	}
+	cmd := interrupt.Command("security", args...)
+	if admin {
+		var err error
+		cmd, err = privilege.Command("/usr/bin/security", args...)
+		if err == privilege.ErrSkipped {
+			return nil
+		}
+		if err != nil {
+			return err
 		}
 	}
+	out, err := cmd.CombinedOutput()
+	if err != nil && debug {
+		fmt.Printf("Command ran: %q\n", strings.Join(cmd.Args, " "))
+		fmt.Printf("Output was: %s\n", string(out))
+	}
 	return nil
 }
 
 func (s darwinStore) Backup() error {
 	// setup (and create) backup (parent) dir
-	parent, err := getCertManageDir(fmt.Sprintf("%s/%d", darwinBackupDir, time.Now().Unix()))
+	parent, err := getCertManageDir(darwinBackupDir + "/" + timeutil.Stamp(time.Now()))
 	if err != nil {
 		return fmt.Errorf("Backup: error getting cert-manage dir, err=%v", err)
 	}
 
-	// Backup the certificates from the login keychain and export each into a separate file
+	// Backup the certificates from each keychain and export each into a separate file
 	// The backup format looks like this: darwin/$time/$keychain-name/$fingerprint.crt
-	// Files are PEM encoded x509 certificates.
-	if _, err := os.Stat(loginKeychain); os.IsNotExist(err) {
-		if debug {
-			fmt.Printf("store/darwin: Backup: skipping login keychain as it's missing")
+	// Files are PEM encoded x509 certificates. manifest.json lists the keychains, so
+	// they can be restored on their own, along with the trust settings of each domain.
+	m := &keychainManifest{Home: file.HomeDir()}
+	for _, path := range backupKeychains() {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if debug {
+				fmt.Printf("store/darwin: Backup: skipping %s as it's missing\n", path)
+			}
+			continue
+		}
+		certs, err := readInstalledCerts(path)
+		if err != nil {
+			return fmt.Errorf("Backup: error reading installed certs from %s, err=%v", path, err)
+		}
+		k := m.add(path)
+		k.Certificates = len(certs)
+		dir, err := getCertManageDir(filepath.Join(parent, k.Dir))
+		if err != nil {
+			return fmt.Errorf("Backup: error getting cert-manage dir, err=%v", err)
+		}
+
+		// Write each certificate to the underlying fs
+		for i := range certs {
+			fp := certutil.GetHexSHA256Fingerprint(*certs[i])
+			where := filepath.Join(dir, fmt.Sprintf("%s.crt", fp))
+
+			err = certutil.ToFile(where, certs[i:i+1]) // avoid creating a new slice
+			if err != nil {
+				return fmt.Errorf("Backup: error writing cert %s to temp file %s, err=%v", certs[i].Subject, where, err)
+			}
+		}
+
+		// Trust settings belong to a domain rather than a keychain, the admin
+		// domain is saved with the System keychain and the user's with login.
+		if path == systemKeychain || path == loginKeychain {
+			admin := path == systemKeychain
+			bs, err := exportTrustSettings(admin)
+			if err != nil {
+				return fmt.Errorf("Backup: %v", err)
+			}
+			if bs != nil {
+				k.TrustSettings = "user.plist"
+				if admin {
+					k.TrustSettings = "admin.plist"
+				}
+				if err := ioutil.WriteFile(filepath.Join(parent, k.TrustSettings), bs, file.TempFilePermissions); err != nil {
+					return fmt.Errorf("Backup: error writing trust settings, err=%v", err)
+				}
+			}
 		}
-		return nil
 	}
+	return writeKeychainManifest(parent, m)
+}
 
-	_, fname := filepath.Split(loginKeychain)
-	certs, err := readInstalledCerts(loginKeychain)
-	if err != nil {
-		return fmt.Errorf("Backup: error reading installed certs from %s, err=%v", loginKeychain, err)
+// backupKeychains returns the keychains in scope which are backed up, these
+// are the System keychain, login keychain and any others in the user's
+// search list. Apple's roots can't be modified, so they're not included.
+func backupKeychains() []string {
+	var out []string
+	if inScope(ScopeSystem) {
+		out = append(out, systemKeychain)
 	}
-	dir, err := getCertManageDir(filepath.Join(parent, fname))
-	if err != nil {
-		return fmt.Errorf("Backup: error getting cert-manage dir, err=%v", err)
+	if inScope(ScopeUser) {
+		out = append(out, loginKeychain)
+		out = append(out, searchListKeychains()...)
 	}
+	return out
+}
 
-	// Write each certificate to the underlying fs
-	for i := range certs {
-		fp := certutil.GetHexSHA256Fingerprint(*certs[i])
-		where := filepath.Join(dir, fmt.Sprintf("%s.crt", fp))
-
-		err = certutil.ToFile(where, certs[i:i+1]) // avoid creating a new slice
-		if err != nil {
-			return fmt.Errorf("Backup: error writing cert %s to temp file %s, err=%v", certs[i].Subject, where, err)
+// searchListKeychains returns the user's keychains from `security list-keychains`
+// other than the login and System keychains.
+func searchListKeychains() []string {
+	out, err := commandC("/usr/bin/security", "list-keychains", "-d", "user").CombinedOutput()
+	if err != nil {
+		if debug {
+			fmt.Printf("store/darwin: error listing keychains: %v: %s\n", err, strings.TrimSpace(string(out)))
 		}
+		return nil
 	}
+	return parseKeychainList(out)
+}
 
-	return nil
+func parseKeychainList(out []byte) []string {
+	var paths []string
+	for _, line := range strings.Split(string(out), "\n") {
+		path := strings.Trim(strings.TrimSpace(line), `"`)
+		if path == "" {
+			continue
+		}
+		switch keychainName(path) {
+		case keychainName(loginKeychain), keychainName(systemKeychain), keychainName(systemRootCertificates):
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths
 }
 
 func (s darwinStore) GetLatestBackup() (string, error) {
@@ -157,17 +268,43 @@ func (s darwinStore) GetLatestBackup() (string, error) {
 	return getLatestBackup(dir)
 }
 
+// listBackup returns the certificates of each keychain restored from a
+// backup along with Apple's system roots, as Restore trusts both.
+func (s darwinStore) listBackup(where string) ([]*x509.Certificate, error) {
+	dir, keychains, err := s.restoreTargets(where)
+	if err != nil {
+		return nil, err
+	}
+	pool := certutil.Pool{}
+	if restoresSystemTrust(keychains) {
+		roots, err := readInstalledCerts(systemRootCertificates)
+		if err != nil {
+			return nil, err
+		}
+		pool.AddCertificates(roots)
+	}
+	for i := range keychains {
+		certs, err := readBackupCertificates(filepath.Join(dir, keychains[i].Dir))
+		if err == nil {
+			pool.AddCertificates(certs)
+		}
+	}
+	return pool.GetCertificates(), nil
+}
+
 func (s darwinStore) GetInfo() *Info {
 	return &Info{
-		Name:    "Darwin (OSX)",
-		Version: s.version(),
+		Name:     "Darwin (OSX)",
+		Version:  s.Version(),
+		Location: strings.Join(keychainsInScope(), ", "),
+		Writable: true,
 	}
 }
 
-// Show OS version
+// Version shows the OS version
 // From: https://superuser.com/questions/75166/how-to-find-out-mac-os-x-version-from-terminal
-func (s darwinStore) version() string {
-	out, err := exec.Command("sw_vers", "-productVersion").CombinedOutput()
+func (s darwinStore) Version() string {
+	out, err := interrupt.Command("sw_vers", "-productVersion").CombinedOutput()
 	if err != nil {
 		return ""
 	}
@@ -175,19 +312,43 @@ func (s darwinStore) version() string {
 }
 
 func (s darwinStore) List(opts *ListOptions) ([]*x509.Certificate, error) {
-	// Grab certs from all keychains which are readable
-	installed, err := readInstalledCerts(systemRootCertificates, systemKeychain, loginKeychain)
-	if err != nil {
+	// Grab certs from all keychains which are readable, keychains which fail are
+	// reported after the readable ones are checked.
+	installed, err := readInstalledCerts(keychainsInScope()...)
+	perr, partial := IsPartial(err)
+	if err != nil && !partial {
 		return nil, err
 	}
 
+	// Smart cards and tokens provide certificates outside of the keychain
+	// files, these belong to the user's session.
+	if inScope(ScopeUser) {
+		if tokens := findTokenCertificates(); len(tokens) > 0 {
+			if debug {
+				fmt.Printf("store/darwin: found %d certificates from smart cards\n", len(tokens))
+			}
+			installed = certutil.Dedup(append(installed, tokens...))
+		}
+	}
+
 	// If there's a trust policy verify it, otherwise don't bother.
 	pool := certutil.Pool{}
+	bar := progress.New("Checking keychain trust", len(installed))
+	defer bar.Done()
 	for i := range installed {
+		bar.Increment()
 		// Unlike Go, we don't really have a performance concern that pushes us towards grabbing a
 		// plist file from 'security' and parsing it. We can shell out to 'security verify-cert'
 		// and encur the time penality.
 		trusted := certTrustedWithSystem(installed[i])
+		if interrupt.Interrupted() {
+			// verify-cert was killed, the trust of what's left is unknown
+			if perr == nil {
+				perr = &PartialError{}
+			}
+			perr.add("security verify-cert", fmt.Errorf("%v after checking %d of %d certificates", interrupt.ErrInterrupted, i, len(installed)))
+			break
+		}
 		if trusted {
 			if opts.Trusted {
 				pool.Add(installed[i])
@@ -202,143 +363,268 @@ func (s darwinStore) List(opts *ListOptions) ([]*x509.Certificate, error) {
 			fmt.Printf("store/darwin: %s trust status after verify-cert: %v\n", certutil.GetHexSHA256Fingerprint(*installed[i]), trusted)
 		}
 	}
-	return pool.GetCertificates(), nil
+	return pool.GetCertificates(), perr.orNil()
 }
 
-// certTrustedWithSystem calls out to `verify-cert` of the `security` cli tool to check
-// if a certificate is still trusted, this comes about when a custom policy has been
-// applied typically by the user or System.
-func certTrustedWithSystem(cert *x509.Certificate) bool {
-	if cert == nil {
-		return false
+// keychainsInScope returns the keychains used for the selected scope. The
+// login keychain is the user's, the others are system wide.
+func keychainsInScope() []string {
+	var out []string
+	if inScope(ScopeSystem) {
+		out = append(out, systemRootCertificates, systemKeychain)
 	}
-	tmp, err := ioutil.TempFile("", "verify-cert")
-	if err != nil {
-		if debug {
-			fmt.Printf("store/darwin: error creating temp file for verify-cert: err=%v\n", err)
-		}
-		return false
+	if inScope(ScopeUser) {
+		out = append(out, loginKeychain)
 	}
-	defer os.Remove(tmp.Name())
+	return out
+}
 
-	// write pem block somewhere and shell out
-	err = certutil.ToFile(tmp.Name(), []*x509.Certificate{cert})
-	if err != nil {
-		if debug {
-			fmt.Printf("store/darwin: error writing cert to tempfile, err=%v\n", err)
+// readInstalledCerts pulls certificates from each keychain at paths. This will
+// return certificates, but not their trust status.
+//
+// Each path is read on its own, if some fail (e.g. a locked keychain) the
+// certificates from the others are returned along with a *PartialError.
+func readInstalledCerts(paths ...string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	read := 0
+	perr := &PartialError{}
+	for _, p := range paths {
+		if err := unlockKeychain(p); err != nil {
+			perr.add(p, err)
+			continue
 		}
-		return false
+		found, err := findCertificates(p)
+		if err != nil {
+			perr.add(p, err)
+			continue
+		}
+		read++
+		certs = append(certs, found...)
 	}
-
-	// We don't specify -k systemKeychain to use the default search path, it's what apps would do.
-	cmd := exec.Command("/usr/bin/security", "verify-cert", "-p", "ssl", "-c", tmp.Name())
-	out, err := cmd.CombinedOutput()
-	if err != nil && debug {
-		fmt.Printf("Command ran: %q\n", strings.Join(cmd.Args, " "))
-		fmt.Printf("Output was: %s\n", string(out))
+	if read == 0 && len(perr.Errors) > 0 {
+		return nil, perr.Errors[0].Err
 	}
-	return err == nil
+
+	// the same certificate is often in several keychains
+	res := certutil.Dedup(certs)
+
+	return res, perr.orNil()
 }
 
-// readInstalledCerts pulls certificates from the `security` cli tool that's
-// installed. This will return certificates, but not their trust status.
-func readInstalledCerts(paths ...string) ([]*x509.Certificate, error) {
-	args := []string{"find-certificate", "-a", "-p"}
-	args = append(args, paths...)
-	cmd := exec.Command("/usr/bin/security", args...)
+// unlockKeychain runs `security unlock-keychain` on a keychain if UnlockKeychains
+// was called. Without a password `security` prompts the user on the terminal.
+//
+// SystemRootCertificates.keychain is never locked, so it's skipped.
+func unlockKeychain(path string) error {
+	unlockMu.Lock()
+	defer unlockMu.Unlock()
+	if !keychainUnlock || path == systemRootCertificates || unlockedKeychains[path] {
+		return nil
+	}
 
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		if debug {
-			fmt.Printf("Command ran: %q\n", strings.Join(cmd.Args, " "))
-			fmt.Printf("Output was: %s\n", string(out))
+	var stderr bytes.Buffer
+	var cmd *exec.Cmd
+	if keychainPassword != "" {
+		// security -i reads the command from stdin, keeping the password
+		// out of our arguments. It exits zero even if the command failed,
+		// which is only seen as a message on stderr.
+		cmd = interrupt.Command("/usr/bin/security", "-i")
+		cmd.Stdin = strings.NewReader(unlockKeychainInput(path, keychainPassword))
+		cmd.Stderr = &stderr
+	} else {
+		if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+			return fmt.Errorf("unable to prompt for the password of %s, use -keychain-password-stdin", path)
 		}
-		return nil, err
+		fmt.Printf("Unlocking %s\n", path)
+		cmd = interrupt.Command("/usr/bin/security", "unlock-keychain", path)
+		cmd.Stdin = os.Stdin
+		cmd.Stderr = os.Stderr
 	}
+	err := cmd.Run()
+	if msg := strings.TrimSpace(stderr.String()); err == nil && msg != "" {
+		err = errors.New(msg)
+	}
+	if err != nil {
+		return fmt.Errorf("error unlocking keychain %s, err=%v", path, err)
+	}
+	if debug {
+		fmt.Printf("store/darwin: unlocked %s\n", path)
+	}
+	unlockedKeychains[path] = true
+	return nil
+}
 
-	certs, err := certutil.ParsePEM(out)
+// Remove works to mark certificates not whitelisted as 'Never Trust' in the System keychain.
+// This effectively disables the certificate unless the user's login keychain has overrides.
+// With the user scope they're marked in the login keychain instead.
+func (s darwinStore) Remove(wh whitelist.Whitelist) error {
+	// We just want to read the system roots and remove trust in those not whitelisted
+	roots, err := readInstalledCerts(systemRootCertificates)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("Remove: error reading certs from %s, err=%v", systemRootCertificates, err)
 	}
 
-	var res []*x509.Certificate
-	for _, c := range certs {
-		if c == nil {
-			continue
+	// The user scope only distrusts roots for the current user, in their
+	// login keychain, rather than for everyone in the System keychain.
+	deny, keychain := denyTrust, systemKeychain
+	if scope == ScopeUser {
+		deny, keychain = denyUserTrust, loginKeychain
+	}
+	if err := unlockKeychain(keychain); err != nil {
+		return fmt.Errorf("Remove: %v", err)
+	}
+
+	// Roots which smart card certificates chain to are kept, otherwise
+	// logging in or authenticating with the card silently breaks.
+	var smartCards map[string]bool
+	if !keychainSmartCards {
+		if tokens := findTokenCertificates(); len(tokens) > 0 {
+			others, _ := readInstalledCerts(systemKeychain, loginKeychain)
+			candidates := append(append(others, roots...), tokens...)
+			smartCards = smartCardAnchors(tokens, candidates)
 		}
-		add := true
-		sig := certutil.GetHexSHA256Fingerprint(*c)
-		for i := range res {
-			if res[i] == nil {
+	}
+
+	perr := &PartialError{}
+	matches := wh.MatchEach(roots)
+	bar := progress.New("Applying whitelist", len(roots))
+	defer bar.Done()
+	for i := range roots {
+		if interrupt.Interrupted() {
+			perr.add(keychain, fmt.Errorf("%v after applying the whitelist to %d of %d roots", interrupt.ErrInterrupted, i, len(roots)))
+			break
+		}
+		bar.Increment()
+		var policies []string
+		if matches[i] {
+			// Root CA is whitelisted, but it might only be kept for some usages
+			usages := wh.AllowedUsages(roots[i])
+			if usages == nil {
 				continue
 			}
-			if sig == certutil.GetHexSHA256Fingerprint(*res[i]) {
-				add = false
-				break
+			policies = darwinDeniedPolicies(usages)
+			if len(policies) == 0 {
+				continue
 			}
+		} else {
+			// Root CA isn't part of our whitelist, so we need to remove trust for
+			// it in the system keychain
+			policies = []string{"ssl"}
 		}
-		if add {
-			res = append(res, c)
+		if smartCards[certutil.GetHexSHA256Fingerprint(*roots[i])] {
+			fmt.Printf("Keeping trust in %s, a smart card certificate chains to it (use -include-smartcards to remove it)\n", certutil.StringifyPKIXName(roots[i].Subject))
+			continue
+		}
+
+		// mark the certificate as 'Never Trust'
+		err := deny(roots[i], policies)
+		if err == privilege.ErrSkipped {
+			continue // reported after we're done
+		}
+		if err != nil {
+			perr.add(certutil.GetHexSHA256Fingerprint(*roots[i]), fmt.Errorf("error marking cert %s as 'Never Trust' in %s, err=%v", roots[i].Subject, keychain, err))
 		}
 	}
 
-	return res, nil
+	return perr.orNil()
 }
 
-// Remove works to mark certificates not whitelisted as 'Never Trust' in the System keychain.
-// This effectively disables the certificate unless the user's login keychain has overrides.
-func (s darwinStore) Remove(wh whitelist.Whitelist) error {
-	// We just want to read the system roots and remove trust in those not whitelisted
-	roots, err := readInstalledCerts(systemRootCertificates)
-	if err != nil {
-		return fmt.Errorf("Remove: error reading certs from %s, err=%v", systemRootCertificates, err)
-	}
+// darwinPolicies maps Extended Key Usages onto trust setting policies
+// accepted by `security add-trusted-cert -p`
+var darwinPolicies = []struct {
+	usage  x509.ExtKeyUsage
+	policy string
+}{
+	{x509.ExtKeyUsageServerAuth, "ssl"},
+	{x509.ExtKeyUsageEmailProtection, "smime"},
+	{x509.ExtKeyUsageCodeSigning, "codeSign"},
+	{x509.ExtKeyUsageTimeStamping, "timestamping"},
+}
 
-	// prep a temp file we can re-use
+// denyTrustWithSecurity adds cert to the System keychain with 'Never Trust' for
+// each policy by calling `security add-trusted-cert`, escalating privileges if needed.
+func denyTrustWithSecurity(cert *x509.Certificate, policies []string) error {
+	return securityDenyTrust(cert, policies, true)
+}
+
+// denyUserTrust marks cert as 'Never Trust' for each policy in the user's trust
+// settings and login keychain, which only affects the current user.
+func denyUserTrust(cert *x509.Certificate, policies []string) error {
+	return securityDenyTrust(cert, policies, false)
+}
+
+func securityDenyTrust(cert *x509.Certificate, policies []string, admin bool) error {
 	tmp, err := ioutil.TempFile("", "cert-manage-darwin-remove")
 	if err != nil {
-		return fmt.Errorf("Remove: error creating temp dir, err=%v", err)
+		return fmt.Errorf("error creating temp file, err=%v", err)
 	}
 	defer os.Remove(tmp.Name())
+	if err := certutil.ToFile(tmp.Name(), []*x509.Certificate{cert}); err != nil {
+		return fmt.Errorf("error writing to temp file %s, err=%v", tmp.Name(), err)
+	}
 
-	for i := range roots {
-		if !wh.Matches(roots[i]) {
-			// Root CA isn't part of our whitelist, so we need to remove trust for
-			// it in the system keychain
-			err = certutil.ToFile(tmp.Name(), roots[i:i+1]) // avoid new slice
-			if err != nil {
-				return fmt.Errorf("error writing to temp file %s, err=%v", tmp.Name(), err)
-			}
+	keychain, args := loginKeychain, []string{"add-trusted-cert"}
+	if admin {
+		keychain = systemKeychain
+		args = append(args, "-d")
+	}
+	args = append(args, "-r", "deny")
+	for _, p := range policies {
+		args = append(args, "-p", p)
+	}
+	args = append(args, "-k", keychain, tmp.Name())
 
-			// mark the certificate as 'Never Trust' in the system keychain
-			cmd := exec.Command("sudo", "/usr/bin/security", "add-trusted-cert", "-d", "-r", "deny", "-p", "ssl", "-k", systemKeychain, tmp.Name())
-			out, err := cmd.CombinedOutput()
-			if err != nil {
-				if debug {
-					output := string(out)
-					fmt.Printf("ERROR: during removing darwin certs, error=%v\n", err)
-					fmt.Printf("  Command ran: %q\n", strings.Join(cmd.Args, " "))
-					fmt.Printf("  Output was: %s\n", output)
-				}
-				return fmt.Errorf("error marking cert %s as 'Never Trust' in system keychain, err=%v", roots[i].Subject, err)
-			}
+	cmd := interrupt.Command("/usr/bin/security", args...)
+	if admin {
+		cmd, err = privilege.Command("/usr/bin/security", args...)
+		if err != nil {
+			return err
 		}
 	}
+	out, err := cmd.CombinedOutput()
+	if err != nil && debug {
+		fmt.Printf("ERROR: during removing darwin certs, error=%v\n", err)
+		fmt.Printf("  Command ran: %q\n", strings.Join(cmd.Args, " "))
+		fmt.Printf("  Output was: %s\n", string(out))
+	}
+	return err
+}
 
-	return nil
+// darwinDeniedPolicies returns the trust setting policies which should be
+// denied to only keep trust for the given Extended Key Usages
+func darwinDeniedPolicies(usages []x509.ExtKeyUsage) []string {
+	var out []string
+	for i := range darwinPolicies {
+		if !whitelist.HasUsage(usages, darwinPolicies[i].usage) {
+			out = append(out, darwinPolicies[i].policy)
+		}
+	}
+	return out
 }
 
 // defaultCertTrustPolicy removes any extra trust policies from a cert and
 // deletes it from the System keychain, which we use as an override.
 func defaultCertTrustPolicy(certPath string, cert *x509.Certificate) error {
 	// -r unspecified removes 'Always Trust' or 'Never Trust' from entry
-	cmd := exec.Command("sudo", "security", "add-trusted-cert", "-d", "-r", "unspecified", "-k", systemKeychain, certPath)
+	cmd, err := privilege.Command("security", "add-trusted-cert", "-d", "-r", "unspecified", "-k", systemKeychain, certPath)
+	if err == privilege.ErrSkipped {
+		return nil // reported after we're done
+	}
+	if err != nil {
+		return fmt.Errorf("Remove: error removing 'Never Trust' from cert %s, err=%v", cert.Subject, err)
+	}
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("Remove: error removing 'Never Trust' from cert %s, err=%v", cert.Subject, err)
 	}
 
 	fp := certutil.GetHexSHA1Fingerprint(*cert)
-	cmd = exec.Command("sudo", "security", "delete-certificate", "-Z", fp, systemKeychain)
+	cmd, err = privilege.Command("security", "delete-certificate", "-Z", fp, systemKeychain)
+	if err == privilege.ErrSkipped {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Remove: error deleting cert %s from keychain, err=%v", cert.Subject, err)
+	}
 	if out, err := cmd.CombinedOutput(); err != nil {
 		if strings.Contains(string(out), "Unable to delete certificate matching") {
 			return nil // cert didn't exist
@@ -416,7 +702,83 @@ func getAppleRootCertificates() []*appleRoot {
 // Afterwords, the login keychain is restored from its most recent backup.
 //
 // TODO(adam): `where` needs to be a directory with properly exported certs from keychain files
-func (s darwinStore) Restore(where string) error {
+// restore trusts Apple's roots again and adds the certificates of a login
+// keychain backup, the latest if `where` is empty. See Restore which rolls
+// back a restore that fails part way.
+func (s darwinStore) restore(where string) error {
+	dir, keychains, err := s.restoreTargets(where)
+	if err != nil {
+		return fmt.Errorf("Restore: %v", err)
+	}
+	if restoresSystemTrust(keychains) {
+		if err := restoreAppleRoots(); err != nil {
+			return err
+		}
+	}
+
+	// Restore each keychain, then the trust settings saved with it
+	for i := range keychains {
+		k := keychains[i]
+		if err := restoreKeychain(k.Path, filepath.Join(dir, k.Dir)); err != nil {
+			return err
+		}
+	}
+	for i := range keychains {
+		k := keychains[i]
+		if k.TrustSettings == "" {
+			continue
+		}
+		if err := importTrustSettings(filepath.Join(dir, k.TrustSettings), k.Path == systemKeychain); err != nil {
+			return fmt.Errorf("Restore: %v", err)
+		}
+	}
+	return nil
+}
+
+// restoreTargets returns the backup directory and the keychains in it which
+// are restored. Backups without a manifest only hold the login keychain.
+func (s darwinStore) restoreTargets(where string) (string, []keychainBackup, error) {
+	dir := where
+	if dir == "" {
+		var err error
+		dir, err = s.GetLatestBackup()
+		if err != nil {
+			return "", nil, fmt.Errorf("error getting latest backup, err=%v", err)
+		}
+		if dir == "" {
+			return "", nil, errors.New("no backup found")
+		}
+	}
+	if debug {
+		fmt.Printf("store/darwin: Found backup dir at %s\n", dir)
+	}
+	m, err := readKeychainManifest(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	if m == nil {
+		m = &keychainManifest{}
+		m.add(loginKeychain)
+	}
+	keychains, err := m.selected(keychainRestore)
+	return dir, keychains, err
+}
+
+// restoresSystemTrust is true when Apple's roots are brought back, which is
+// every full restore and those of the System keychain.
+func restoresSystemTrust(keychains []keychainBackup) bool {
+	if keychainRestore == "" {
+		return true
+	}
+	for i := range keychains {
+		if keychains[i].Path == systemKeychain {
+			return true
+		}
+	}
+	return false
+}
+
+func restoreAppleRoots() error {
 	// Grab apple provided system root, this is our baseline
 	roots, err := readInstalledCerts(systemRootCertificates)
 	if err != nil {
@@ -436,7 +798,7 @@ func (s darwinStore) Restore(where string) error {
 			return fmt.Errorf("Restore: error writing cert %s to temp dir %s, err=%v", roots[i].Subject, tmp.Name(), err)
 		}
 
-		cmd := exec.Command("security", "verify-cert", "-p", "ssl", "-k", systemKeychain, "-c", tmp.Name())
+		cmd := commandC("security", "verify-cert", "-p", "ssl", "-k", systemKeychain, "-c", tmp.Name())
 		out, err := cmd.CombinedOutput()
 		outStr := string(out)
 		if err != nil {
@@ -477,22 +839,20 @@ func (s darwinStore) Restore(where string) error {
 		}
 	}
 
-	// Restore the login.keychain
-	//
-	// Grab the filenames under our backup directory (e.g. login.keychain/$sha1.crt), read the cert
-	// and verify it's matching the sha1 filename and compare against the already installed certs.
-	dir, err := s.GetLatestBackup()
-	if err != nil {
-		return fmt.Errorf("Restore: error getting latest backup, err=%v", err)
-	}
-	dir = filepath.Join(dir, "login.keychain")
-	if debug {
-		fmt.Printf("store/darwin: Found backup dir at %s\n", dir)
-	}
+	return nil
+}
 
-	alreadyInstalled, err := readInstalledCerts(loginKeychain)
+// restoreKeychain adds the certificates backed up in dir to keychain.
+//
+// Grab the filenames under our backup directory (e.g. login.keychain/$sha256.crt), read the cert
+// and verify it's matching the sha256 filename and compare against the already installed certs.
+func restoreKeychain(keychain, dir string) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil // the keychain had no certificates
+	}
+	alreadyInstalled, err := readInstalledCerts(keychain)
 	if err != nil {
-		return fmt.Errorf("Restore: error getting login keychain certs, err=%v", err)
+		return fmt.Errorf("Restore: error getting %s certs, err=%v", keychain, err)
 	}
 	var alreadyInstalledFingerprints []string
 	for i := range alreadyInstalled {
@@ -506,7 +866,7 @@ func (s darwinStore) Restore(where string) error {
 	}
 	for i := range certfiles {
 		// For each cert file, grab the certs and find the one that matches the filename hash
-		_, fp := filepath.Split(certfiles[i].Name())
+		fp := strings.TrimSuffix(certfiles[i].Name(), filepath.Ext(certfiles[i].Name()))
 		certs, err := certutil.FromFile(filepath.Join(dir, certfiles[i].Name()))
 		if err != nil && !os.IsNotExist(err) {
 			return fmt.Errorf("Restore: error reading certs from %s, err=%v", certfiles[i].Name(), err)
@@ -527,9 +887,9 @@ func (s darwinStore) Restore(where string) error {
 					}
 				}
 				if shouldAdd {
-					err = s.Add(certs[j : j+1])
+					err = addTrustedCert(keychain, filepath.Join(dir, certfiles[i].Name()), certs[j])
 					if err != nil {
-						return fmt.Errorf("Restore: error adding cert %s to login keychain, err=%v", certs[j].Subject, err)
+						return fmt.Errorf("Restore: error adding cert %s to %s, err=%v", certs[j].Subject, keychain, err)
 					}
 				}
 			}
@@ -0,0 +1,324 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build darwin,cgo,nativekeychain
+
+package store
+
+/*
+#cgo LDFLAGS: -framework CoreFoundation -framework Security
+
+#include <stdlib.h>
+#include <CoreFoundation/CoreFoundation.h>
+#include <Security/Security.h>
+
+// Policy bits passed to cm_deny_trust, these match darwinPolicies
+#define CM_POLICY_SSL          1
+#define CM_POLICY_SMIME        2
+#define CM_POLICY_CODESIGN     4
+#define CM_POLICY_TIMESTAMPING 8
+
+// cm_copy_certificates copies the DER encoding of every certificate in the keychain
+// at path into out. out is NULL if the keychain has no certificates.
+static OSStatus cm_copy_certificates(const char *path, CFArrayRef *out) {
+	*out = NULL;
+
+	SecKeychainRef kc = NULL;
+	OSStatus st = SecKeychainOpen(path, &kc);
+	if (st != errSecSuccess) {
+		return st;
+	}
+
+	const void *kcs[] = { kc };
+	CFArrayRef search = CFArrayCreate(NULL, kcs, 1, &kCFTypeArrayCallBacks);
+	const void *keys[] = { kSecClass, kSecMatchLimit, kSecReturnData, kSecMatchSearchList };
+	const void *values[] = { kSecClassCertificate, kSecMatchLimitAll, kCFBooleanTrue, search };
+	CFDictionaryRef query = CFDictionaryCreate(NULL, keys, values, 4, &kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+
+	CFTypeRef result = NULL;
+	st = SecItemCopyMatching(query, &result);
+	CFRelease(query);
+	CFRelease(search);
+	CFRelease(kc);
+
+	if (st == errSecItemNotFound) {
+		return errSecSuccess;
+	}
+	if (st == errSecSuccess) {
+		*out = (CFArrayRef)result;
+	}
+	return st;
+}
+
+// cm_copy_token_certificates copies the DER encoding of every certificate provided
+// by a smart card or token (CryptoTokenKit), these live in the token access group
+// rather than a keychain file. out is NULL if there are none.
+static OSStatus cm_copy_token_certificates(CFArrayRef *out) {
+	*out = NULL;
+
+	const void *keys[] = { kSecClass, kSecMatchLimit, kSecReturnData, kSecAttrAccessGroup };
+	const void *values[] = { kSecClassCertificate, kSecMatchLimitAll, kCFBooleanTrue, kSecAttrAccessGroupToken };
+	CFDictionaryRef query = CFDictionaryCreate(NULL, keys, values, 4, &kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+
+	CFTypeRef result = NULL;
+	OSStatus st = SecItemCopyMatching(query, &result);
+	CFRelease(query);
+
+	if (st == errSecItemNotFound) {
+		return errSecSuccess;
+	}
+	if (st == errSecSuccess) {
+		*out = (CFArrayRef)result;
+	}
+	return st;
+}
+
+static CFIndex cm_array_count(CFArrayRef arr) {
+	return arr == NULL ? 0 : CFArrayGetCount(arr);
+}
+
+static void cm_array_data(CFArrayRef arr, CFIndex i, const UInt8 **bytes, CFIndex *length) {
+	CFDataRef data = (CFDataRef)CFArrayGetValueAtIndex(arr, i);
+	*bytes = CFDataGetBytePtr(data);
+	*length = CFDataGetLength(data);
+}
+
+static void cm_array_release(CFArrayRef arr) {
+	if (arr != NULL) {
+		CFRelease(arr);
+	}
+}
+
+static SecCertificateRef cm_certificate(const UInt8 *der, CFIndex length) {
+	CFDataRef data = CFDataCreate(NULL, der, length);
+	if (data == NULL) {
+		return NULL;
+	}
+	SecCertificateRef cert = SecCertificateCreateWithData(NULL, data);
+	CFRelease(data);
+	return cert;
+}
+
+// cm_trusted_ssl evaluates a certificate with the SSL policy against the default
+// keychain search list, this is what 'security verify-cert -p ssl' does.
+static int cm_trusted_ssl(const UInt8 *der, CFIndex length) {
+	SecCertificateRef cert = cm_certificate(der, length);
+	if (cert == NULL) {
+		return 0;
+	}
+	SecPolicyRef policy = SecPolicyCreateSSL(true, NULL);
+	SecTrustRef trust = NULL;
+	OSStatus st = SecTrustCreateWithCertificates(cert, policy, &trust);
+	CFRelease(policy);
+	CFRelease(cert);
+	if (st != errSecSuccess) {
+		return 0;
+	}
+
+	SecTrustResultType result = kSecTrustResultInvalid;
+	st = SecTrustEvaluate(trust, &result);
+	CFRelease(trust);
+	if (st != errSecSuccess) {
+		return 0;
+	}
+	return result == kSecTrustResultUnspecified || result == kSecTrustResultProceed;
+}
+
+static SecPolicyRef cm_policy(int p) {
+	switch (p) {
+	case CM_POLICY_SSL:
+		return SecPolicyCreateSSL(true, NULL);
+	case CM_POLICY_SMIME:
+		return SecPolicyCreateWithProperties(kSecPolicyAppleSMIME, NULL);
+	case CM_POLICY_CODESIGN:
+		return SecPolicyCreateWithProperties(kSecPolicyAppleCodeSigning, NULL);
+	case CM_POLICY_TIMESTAMPING:
+		return SecPolicyCreateWithProperties(kSecPolicyAppleTimeStamping, NULL);
+	}
+	return NULL;
+}
+
+// cm_deny_trust adds a certificate to the keychain at path and sets 'Never Trust'
+// in the admin trust settings domain for each policy, like 'security add-trusted-cert -d -r deny'
+static OSStatus cm_deny_trust(const UInt8 *der, CFIndex length, const char *path, int policies) {
+	SecCertificateRef cert = cm_certificate(der, length);
+	if (cert == NULL) {
+		return errSecDecode;
+	}
+
+	SecKeychainRef kc = NULL;
+	OSStatus st = SecKeychainOpen(path, &kc);
+	if (st == errSecSuccess) {
+		st = SecCertificateAddToKeychain(cert, kc);
+		CFRelease(kc);
+	}
+	if (st != errSecSuccess && st != errSecDuplicateItem) {
+		CFRelease(cert);
+		return st;
+	}
+
+	int deny = kSecTrustSettingsResultDeny;
+	CFNumberRef result = CFNumberCreate(NULL, kCFNumberIntType, &deny);
+	CFMutableArrayRef settings = CFArrayCreateMutable(NULL, 0, &kCFTypeArrayCallBacks);
+	for (int p = CM_POLICY_SSL; p <= CM_POLICY_TIMESTAMPING; p <<= 1) {
+		if ((policies & p) == 0) {
+			continue;
+		}
+		SecPolicyRef policy = cm_policy(p);
+		if (policy == NULL) {
+			continue;
+		}
+		const void *keys[] = { kSecTrustSettingsPolicy, kSecTrustSettingsResult };
+		const void *values[] = { policy, result };
+		CFDictionaryRef setting = CFDictionaryCreate(NULL, keys, values, 2, &kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+		CFArrayAppendValue(settings, setting);
+		CFRelease(setting);
+		CFRelease(policy);
+	}
+	CFRelease(result);
+
+	st = SecTrustSettingsSetTrustSettings(cert, kSecTrustSettingsDomainAdmin, settings);
+	CFRelease(settings);
+	CFRelease(cert);
+	return st;
+}
+
+// cm_error_message returns a malloc'd description of st, or NULL
+static char *cm_error_message(OSStatus st) {
+	CFStringRef msg = SecCopyErrorMessageString(st, NULL);
+	if (msg == NULL) {
+		return NULL;
+	}
+	CFIndex size = CFStringGetMaximumSizeForEncoding(CFStringGetLength(msg), kCFStringEncodingUTF8) + 1;
+	char *buf = malloc(size);
+	if (buf != NULL && !CFStringGetCString(msg, buf, size, kCFStringEncodingUTF8)) {
+		free(buf);
+		buf = NULL;
+	}
+	CFRelease(msg);
+	return buf;
+}
+*/
+import "C"
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"unsafe"
+)
+
+// This file uses the Security.framework directly for Keychain access instead of
+// calling out to the `security` cli tool. This avoids an exec per certificate and
+// depending on output formats which change across macOS versions.
+//
+// Build with: CGO_ENABLED=1 go build -tags nativekeychain
+
+var nativePolicies = map[string]C.int{
+	"ssl":          C.CM_POLICY_SSL,
+	"smime":        C.CM_POLICY_SMIME,
+	"codeSign":     C.CM_POLICY_CODESIGN,
+	"timestamping": C.CM_POLICY_TIMESTAMPING,
+}
+
+// findCertificates returns every certificate in the keychain at path
+func findCertificates(path string) ([]*x509.Certificate, error) {
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+
+	var arr C.CFArrayRef
+	if st := C.cm_copy_certificates(cpath, &arr); st != C.errSecSuccess {
+		return nil, osStatusError("SecItemCopyMatching", st)
+	}
+	defer C.cm_array_release(arr)
+	return parseCertificateArray(arr, path), nil
+}
+
+// findTokenCertificates returns the certificates provided by inserted smart
+// cards and tokens, failures return no certificates.
+func findTokenCertificates() []*x509.Certificate {
+	var arr C.CFArrayRef
+	if st := C.cm_copy_token_certificates(&arr); st != C.errSecSuccess {
+		if debug {
+			fmt.Printf("store/darwin: %v\n", osStatusError("SecItemCopyMatching", st))
+		}
+		return nil
+	}
+	defer C.cm_array_release(arr)
+	return parseCertificateArray(arr, "smart cards")
+}
+
+// parseCertificateArray parses each DER encoded certificate in arr, source
+// is only used in debug output
+func parseCertificateArray(arr C.CFArrayRef, source string) []*x509.Certificate {
+	var certs []*x509.Certificate
+	n := C.cm_array_count(arr)
+	for i := C.CFIndex(0); i < n; i++ {
+		var bytes *C.UInt8
+		var length C.CFIndex
+		C.cm_array_data(arr, i, &bytes, &length)
+
+		cert, err := x509.ParseCertificate(C.GoBytes(unsafe.Pointer(bytes), C.int(length)))
+		if err != nil {
+			if debug {
+				fmt.Printf("store/darwin: skipping unparsable certificate in %s, err=%v\n", source, err)
+			}
+			continue
+		}
+		certs = append(certs, cert)
+	}
+	return certs
+}
+
+// certTrustedWithSystem evaluates a certificate for SSL using the default keychain
+// search list, this checks any custom trust policy applied by the user or System.
+func certTrustedWithSystem(cert *x509.Certificate) bool {
+	if cert == nil || len(cert.Raw) == 0 {
+		return false
+	}
+	return C.cm_trusted_ssl((*C.UInt8)(unsafe.Pointer(&cert.Raw[0])), C.CFIndex(len(cert.Raw))) == 1
+}
+
+// denyTrust marks cert as 'Never Trust' for each policy in the System keychain.
+//
+// Modifying the System keychain and admin trust settings requires root, so
+// otherwise we fall back to `security` which escalates privileges.
+func denyTrust(cert *x509.Certificate, policies []string) error {
+	if os.Getuid() != 0 {
+		return denyTrustWithSecurity(cert, policies)
+	}
+
+	var bits C.int
+	for _, p := range policies {
+		bits |= nativePolicies[p]
+	}
+
+	cpath := C.CString(systemKeychain)
+	defer C.free(unsafe.Pointer(cpath))
+
+	st := C.cm_deny_trust((*C.UInt8)(unsafe.Pointer(&cert.Raw[0])), C.CFIndex(len(cert.Raw)), cpath, bits)
+	if st != C.errSecSuccess {
+		return osStatusError("SecTrustSettingsSetTrustSettings", st)
+	}
+	return nil
+}
+
+func osStatusError(op string, st C.OSStatus) error {
+	msg := C.cm_error_message(st)
+	if msg == nil {
+		return fmt.Errorf("%s: OSStatus %d", op, int(st))
+	}
+	defer C.free(unsafe.Pointer(msg))
+	return fmt.Errorf("%s: %s (OSStatus %d)", op, C.GoString(msg), int(st))
+}
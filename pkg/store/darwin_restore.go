@@ -0,0 +1,310 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build darwin
+
+package store
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/privilege"
+)
+
+// Restore brings back Apple's roots and each keychain from a backup, or only
+// the keychain given to RestoreKeychain.
+//
+// The admin and user trust settings along with the certificates of each
+// keychain being restored are saved first. Afterwards the trust settings are exported
+// again and compared against what the restore should have done, if any step
+// failed (e.g. only some trust settings were changed) the saved state is put
+// back rather than leaving the system part way restored.
+func (s darwinStore) Restore(where string) error {
+	_, keychains, err := s.restoreTargets(where)
+	if err != nil {
+		return fmt.Errorf("Restore: %v", err)
+	}
+	snap, err := snapshotTrust(keychains)
+	if err != nil {
+		return fmt.Errorf("Restore: error saving trust settings before restoring, err=%v", err)
+	}
+	defer snap.cleanup()
+
+	err = s.restore(where)
+	if err == nil {
+		err = s.verifyRestore(where)
+	}
+	if err != nil {
+		if rerr := snap.rollback(); rerr != nil {
+			return fmt.Errorf("%v (rolling back also failed: %v)", err, rerr)
+		}
+		return fmt.Errorf("%v (rolled back to the trust settings before restoring)", err)
+	}
+	return nil
+}
+
+// verifyRestore checks none of Apple's roots are still denied, unless they
+// were denied in the backup, and each certificate of the restored keychains
+// was added.
+func (s darwinStore) verifyRestore(where string) error {
+	if len(privilege.Skipped()) > 0 {
+		return nil // nothing was changed, so there's nothing to check
+	}
+	dir, keychains, err := s.restoreTargets(where)
+	if err != nil {
+		return fmt.Errorf("Restore: %v", err)
+	}
+	if restoresSystemTrust(keychains) {
+		if err := verifyAppleRoots(dir, keychains); err != nil {
+			return err
+		}
+	}
+
+	for i := range keychains {
+		k := keychains[i]
+		backup, err := readBackupCertificates(filepath.Join(dir, k.Dir))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		installed, err := readInstalledCerts(k.Path)
+		if err != nil {
+			return fmt.Errorf("Restore: error reading %s to verify, err=%v", k.Path, err)
+		}
+		missing := missingFingerprints(backup, installed)
+		if len(missing) > 0 {
+			return fmt.Errorf("Restore: %d certificate(s) from the backup weren't added to %s", len(missing), k.Path)
+		}
+	}
+	return nil
+}
+
+// verifyAppleRoots checks none of Apple's roots are denied, other than those
+// denied by the admin trust settings in the backup.
+func verifyAppleRoots(dir string, keychains []keychainBackup) error {
+	expected := make(trustSettings)
+	for i := range keychains {
+		if keychains[i].Path != systemKeychain || keychains[i].TrustSettings == "" {
+			continue
+		}
+		bs, err := ioutil.ReadFile(filepath.Join(dir, keychains[i].TrustSettings))
+		if err != nil {
+			return fmt.Errorf("Restore: error reading backup trust settings, err=%v", err)
+		}
+		expected, err = parseTrustSettings(bs)
+		if err != nil {
+			return fmt.Errorf("Restore: error reading backup trust settings, err=%v", err)
+		}
+	}
+
+	bs, err := exportTrustSettings(true)
+	if err != nil {
+		return fmt.Errorf("Restore: error exporting trust settings to verify, err=%v", err)
+	}
+	denied := make(trustSettings)
+	if bs != nil {
+		denied, err = parseTrustSettings(bs)
+		if err != nil {
+			return fmt.Errorf("Restore: error reading exported trust settings, err=%v", err)
+		}
+	}
+	roots, err := readInstalledCerts(systemRootCertificates)
+	if err != nil {
+		return fmt.Errorf("Restore: error reading certs from %s, err=%v", systemRootCertificates, err)
+	}
+	var still []string
+	for i := range roots {
+		if denied.denies(roots[i]) && !expected.denies(roots[i]) {
+			still = append(still, roots[i].Subject.CommonName)
+		}
+	}
+	if len(still) > 0 {
+		return fmt.Errorf("Restore: %d root(s) are still denied after restoring: %s", len(still), strings.Join(still, ", "))
+	}
+	return nil
+}
+
+// missingFingerprints returns the sha256 fingerprints of want which aren't in have
+func missingFingerprints(want, have []*x509.Certificate) []string {
+	found := make(map[string]bool)
+	for i := range have {
+		found[certutil.GetHexSHA256Fingerprint(*have[i])] = true
+	}
+	var out []string
+	for i := range want {
+		fp := certutil.GetHexSHA256Fingerprint(*want[i])
+		if !found[fp] {
+			out = append(out, fp)
+		}
+	}
+	return out
+}
+
+// trustSnapshot holds the trust settings and keychain contents from before
+// a restore.
+type trustSnapshot struct {
+	dir string
+
+	// exported trust settings plists
+	admin string
+	user  string
+
+	// sha256 fingerprints in each keychain, by path
+	keychains map[string]map[string]bool
+}
+
+func snapshotTrust(keychains []keychainBackup) (*trustSnapshot, error) {
+	dir, err := ioutil.TempDir("", "cert-manage-restore")
+	if err != nil {
+		return nil, err
+	}
+	snap := &trustSnapshot{
+		dir:       dir,
+		admin:     filepath.Join(dir, "admin.plist"),
+		user:      filepath.Join(dir, "user.plist"),
+		keychains: make(map[string]map[string]bool),
+	}
+	for path, admin := range map[string]bool{snap.admin: true, snap.user: false} {
+		bs, err := exportTrustSettings(admin)
+		if err != nil {
+			snap.cleanup()
+			return nil, err
+		}
+		if bs == nil {
+			bs = []byte(emptyTrustSettings)
+		}
+		if err := ioutil.WriteFile(path, bs, 0600); err != nil {
+			snap.cleanup()
+			return nil, err
+		}
+	}
+
+	for i := range keychains {
+		path := keychains[i].Path
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		certs, err := readInstalledCerts(path)
+		if err != nil {
+			snap.cleanup()
+			return nil, err
+		}
+		fps := make(map[string]bool)
+		for j := range certs {
+			fps[certutil.GetHexSHA256Fingerprint(*certs[j])] = true
+		}
+		snap.keychains[path] = fps
+	}
+	return snap, nil
+}
+
+// rollback imports the saved trust settings and deletes certificates added
+// to each keychain since the snapshot.
+func (t *trustSnapshot) rollback() error {
+	if debug {
+		fmt.Println("store/darwin: rolling back trust settings")
+	}
+	if err := importTrustSettings(t.admin, true); err != nil {
+		return err
+	}
+	if err := importTrustSettings(t.user, false); err != nil {
+		return err
+	}
+
+	for path, before := range t.keychains {
+		certs, err := readInstalledCerts(path)
+		if err != nil {
+			return err
+		}
+		for i := range certs {
+			if before[certutil.GetHexSHA256Fingerprint(*certs[i])] {
+				continue
+			}
+			fp := certutil.GetHexSHA1Fingerprint(*certs[i])
+			cmd := commandC("/usr/bin/security", "delete-certificate", "-Z", fp, path)
+			if path == systemKeychain {
+				cmd, err = privilege.Command("/usr/bin/security", "delete-certificate", "-Z", fp, path)
+				if err == privilege.ErrSkipped {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if out, err := cmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("error removing %s from %s: %v: %s", certs[i].Subject, path, err, strings.TrimSpace(string(out)))
+			}
+		}
+	}
+	return nil
+}
+
+// importTrustSettings replaces the admin (or user) trust settings with those
+// of a plist exported by `security trust-settings-export`.
+func importTrustSettings(path string, admin bool) error {
+	if !admin {
+		if out, err := commandC("/usr/bin/security", "trust-settings-import", path).CombinedOutput(); err != nil {
+			return fmt.Errorf("error importing user trust settings: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	cmd, err := privilege.Command("/usr/bin/security", "trust-settings-import", "-d", path)
+	if err == privilege.ErrSkipped {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error importing admin trust settings: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (t *trustSnapshot) cleanup() {
+	os.RemoveAll(t.dir)
+}
+
+// exportTrustSettings returns the admin (or user) trust settings plist, which
+// is nil when the domain doesn't have any trust settings.
+func exportTrustSettings(admin bool) ([]byte, error) {
+	tmp, err := ioutil.TempFile("", "cert-manage-trust-settings")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	args := []string{"trust-settings-export"}
+	if admin {
+		args = append(args, "-d")
+	}
+	args = append(args, tmp.Name())
+	out, err := commandC("/usr/bin/security", args...).CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(out), "No Trust Settings were found") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error exporting trust settings: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return ioutil.ReadFile(tmp.Name())
+}
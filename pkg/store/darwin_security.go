@@ -0,0 +1,122 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build darwin
+// +build !cgo !nativekeychain
+
+package store
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+// This file calls out to the `security` cli tool for Keychain access, which is
+// the default. Building with `-tags nativekeychain` (and cgo) uses the
+// Security.framework instead, see darwin_native.go
+
+// findCertificates returns every certificate in the keychain at path
+func findCertificates(path string) ([]*x509.Certificate, error) {
+	cmd := commandC("/usr/bin/security", "find-certificate", "-a", "-p", path)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if debug {
+			fmt.Printf("Command ran: %q\n", strings.Join(cmd.Args, " "))
+			fmt.Printf("Output was: %s\n", string(out))
+		}
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return certutil.ParsePEM(out)
+}
+
+// findTokenCertificates returns the certificates provided by inserted smart
+// cards and tokens. They're exported by 'security export-smartcard', which
+// older macOS releases don't have, so failures return no certificates.
+func findTokenCertificates() []*x509.Certificate {
+	dir, err := ioutil.TempDir("", "cert-manage-smartcard")
+	if err != nil {
+		return nil
+	}
+	defer os.RemoveAll(dir)
+
+	cmd := commandC("/usr/bin/security", "export-smartcard", "-t", "certs", "-e", dir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if debug {
+			fmt.Printf("Command ran: %q\n", strings.Join(cmd.Args, " "))
+			fmt.Printf("Output was: %s\n", string(out))
+		}
+		return nil
+	}
+
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var certs []*x509.Certificate
+	for i := range fis {
+		bs, err := ioutil.ReadFile(filepath.Join(dir, fis[i].Name()))
+		if err != nil {
+			continue
+		}
+		found, _ := certutil.Decode(bs)
+		certs = append(certs, found...)
+	}
+	return certs
+}
+
+// certTrustedWithSystem calls out to `verify-cert` of the `security` cli tool to check
+// if a certificate is still trusted, this comes about when a custom policy has been
+// applied typically by the user or System.
+func certTrustedWithSystem(cert *x509.Certificate) bool {
+	if cert == nil {
+		return false
+	}
+	tmp, err := ioutil.TempFile("", "verify-cert")
+	if err != nil {
+		if debug {
+			fmt.Printf("store/darwin: error creating temp file for verify-cert: err=%v\n", err)
+		}
+		return false
+	}
+	defer os.Remove(tmp.Name())
+
+	// write pem block somewhere and shell out
+	err = certutil.ToFile(tmp.Name(), []*x509.Certificate{cert})
+	if err != nil {
+		if debug {
+			fmt.Printf("store/darwin: error writing cert to tempfile, err=%v\n", err)
+		}
+		return false
+	}
+
+	// We don't specify -k systemKeychain to use the default search path, it's what apps would do.
+	cmd := commandC("/usr/bin/security", "verify-cert", "-p", "ssl", "-c", tmp.Name())
+	out, err := cmd.CombinedOutput()
+	if err != nil && debug {
+		fmt.Printf("Command ran: %q\n", strings.Join(cmd.Args, " "))
+		fmt.Printf("Output was: %s\n", string(out))
+	}
+	return err == nil
+}
+
+// denyTrust marks cert as 'Never Trust' for each policy in the System keychain
+func denyTrust(cert *x509.Certificate, policies []string) error {
+	return denyTrustWithSecurity(cert, policies)
+}
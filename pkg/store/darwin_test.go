@@ -27,6 +27,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
 	"github.com/adamdecaf/cert-manage/pkg/file"
 )
 
@@ -147,3 +148,40 @@ func TestStoreDarwin__info(t *testing.T) {
 		t.Error("blank Version")
 	}
 }
+
+func TestStoreDarwin__deniedPolicies(t *testing.T) {
+	policies := darwinDeniedPolicies([]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth})
+	if strings.Join(policies, ",") != "smime,codeSign,timestamping" {
+		t.Errorf("got %q", policies)
+	}
+	if v := darwinDeniedPolicies(nil); len(v) != 4 {
+		t.Errorf("got %q", v)
+	}
+}
+
+func TestStoreDarwin__missingFingerprints(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := missingFingerprints(certs[:3], certs[1:])
+	if len(missing) != 1 || missing[0] != certutil.GetHexSHA256Fingerprint(*certs[0]) {
+		t.Errorf("got %q", missing)
+	}
+	if v := missingFingerprints(certs, certs); len(v) != 0 {
+		t.Errorf("got %q", v)
+	}
+}
+
+func TestStoreDarwin__exportTrustSettings(t *testing.T) {
+	bs, err := exportTrustSettings(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bs == nil {
+		t.Skip("no admin trust settings")
+	}
+	if _, err := parseTrustSettings(bs); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+var (
+	dryRun = false
+)
+
+// EnableDryRun makes every Store returned from Platform() and ForApp() print
+// the changes it would make instead of modifying anything.
+func EnableDryRun() {
+	dryRun = true
+}
+
+// DryRun returns true if stores are only printing the changes they would make
+func DryRun() bool {
+	return dryRun
+}
+
+func wrapDryRun(s Store) Store {
+	if dryRun {
+		return dryRunStore{
+			underlying: s,
+			out:        os.Stdout,
+		}
+	}
+	return s
+}
+
+// dryRunStore wraps a Store, read-only methods are passed through and
+// methods which would modify the store print what they would do.
+type dryRunStore struct {
+	underlying Store
+	out        io.Writer
+}
+
+func (s dryRunStore) name() string {
+	if info := s.underlying.GetInfo(); info != nil {
+		return info.Name
+	}
+	return "store"
+}
+
+func (s dryRunStore) GetInfo() *Info {
+	return s.underlying.GetInfo()
+}
+
+func (s dryRunStore) Version() string {
+	return s.underlying.Version()
+}
+
+func (s dryRunStore) List(opts *ListOptions) ([]*x509.Certificate, error) {
+	return s.underlying.List(opts)
+}
+
+func (s dryRunStore) Add(certs []*x509.Certificate) error {
+	fmt.Fprintf(s.out, "Would add %d certificate(s) to %s:\n", len(certs), s.name())
+	s.print(certs)
+	return nil
+}
+
+func (s dryRunStore) Remove(wh whitelist.Whitelist) error {
+	certs, err := s.underlying.List(&ListOptions{
+		Trusted: true,
+	})
+	if err != nil {
+		return err
+	}
+	var removed []*x509.Certificate
+	matches := wh.MatchEach(certs)
+	for i := range certs {
+		if !matches[i] {
+			removed = append(removed, certs[i])
+		}
+	}
+	fmt.Fprintf(s.out, "Would remove trust from %d of %d certificate(s) in %s:\n", len(removed), len(certs), s.name())
+	s.print(removed)
+	return nil
+}
+
+func (s dryRunStore) Backup() error {
+	fmt.Fprintf(s.out, "Would backup %s\n", s.name())
+	return nil
+}
+
+func (s dryRunStore) GetLatestBackup() (string, error) {
+	return s.underlying.GetLatestBackup()
+}
+
+func (s dryRunStore) Restore(where string) error {
+	if where == "" {
+		latest, err := s.underlying.GetLatestBackup()
+		if err != nil {
+			return err
+		}
+		where = latest
+	}
+	fmt.Fprintf(s.out, "Would restore %s from %s\n", s.name(), where)
+	return nil
+}
+
+func (s dryRunStore) print(certs []*x509.Certificate) {
+	for i := range certs {
+		fp := certutil.GetHexSHA256Fingerprint(*certs[i])
+		fmt.Fprintf(s.out, "  %s  %s\n", fp[:16], certutil.StringifyPKIXName(certs[i].Subject))
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"bytes"
+	"crypto/x509"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+// listStore is a Store which only lists the given certificates
+type listStore struct {
+	emptyStore
+	certs []*x509.Certificate
+}
+
+func (s listStore) List(_ *ListOptions) ([]*x509.Certificate, error) {
+	return s.certs, nil
+}
+
+func TestStore__dryRun(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	s := dryRunStore{
+		underlying: listStore{certs: certs},
+		out:        &buf,
+	}
+
+	// Remove should only print the certificates it would distrust
+	wh := whitelist.FromCertificates(certs[1:])
+	if err := s.Remove(wh); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "Would remove trust from 1 of") {
+		t.Errorf("got %q", buf.String())
+	}
+	fp := certutil.GetHexSHA256Fingerprint(*certs[0])
+	if !strings.Contains(buf.String(), fp[:16]) {
+		t.Errorf("expected %s in %q", fp[:16], buf.String())
+	}
+
+	buf.Reset()
+	if err := s.Add(certs[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "Would add 2 certificate(s)") {
+		t.Errorf("got %q", buf.String())
+	}
+}
@@ -40,6 +40,9 @@ func (s emptyStore) GetInfo() *Info {
 		Name: "Empty",
 	}
 }
+func (s emptyStore) Version() string {
+	return ""
+}
 func (s emptyStore) List(_ *ListOptions) ([]*x509.Certificate, error) {
 	s.printNotce()
 	return nil, nil
@@ -0,0 +1,28 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+var (
+	// enterpriseStores is set by IncludeEnterpriseStores
+	enterpriseStores = false
+)
+
+// IncludeEnterpriseStores lets the windows store also whitelist the
+// intermediate CA store and the NTAuth store, which lists the CAs trusted
+// to issue smart card and domain logon certificates. Only the root stores
+// are modified by default. Other platforms ignore this.
+func IncludeEnterpriseStores() {
+	enterpriseStores = true
+}
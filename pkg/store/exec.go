@@ -0,0 +1,104 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
+)
+
+var (
+	// localeEnv is added to the environment of tools whose output is
+	// parsed, so their messages aren't translated
+	localeEnv = []string{"LC_ALL=C", "LANG=C"}
+
+	// keytoolLocaleArgs make keytool (which ignores LC_ALL) print English
+	// messages in UTF-8, otherwise non-ASCII aliases are printed as '?'.
+	// Java 19 and newer read stdout.encoding, older releases sun.stdout.encoding
+	keytoolLocaleArgs = []string{
+		"-J-Duser.language=en",
+		"-J-Duser.country=US",
+		"-J-Dfile.encoding=UTF-8",
+		"-J-Dsun.stdout.encoding=UTF-8",
+		"-J-Dstdout.encoding=UTF-8",
+	}
+)
+
+// commandC is exec.Command running in the C locale, for tools whose output
+// is parsed.
+func commandC(name string, args ...string) *exec.Cmd {
+	cmd := interrupt.Command(name, args...)
+	cmd.Env = append(os.Environ(), localeEnv...)
+	return cmd
+}
+
+// parseRegQuery reads the values of 'reg query <key>', which are printed as
+// "    <name>    <type>    <data>". Value names and types aren't translated,
+// unlike the output of tools such as systeminfo.
+func parseRegQuery(out []byte) map[string]string {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, " ") {
+			continue // blank lines and the key's path
+		}
+		fields := strings.SplitN(strings.TrimSpace(line), "    ", 3)
+		if len(fields) != 3 || !strings.HasPrefix(fields[1], "REG_") {
+			continue
+		}
+		data := strings.TrimSpace(fields[2])
+		if fields[1] == "REG_DWORD" && strings.HasPrefix(data, "0x") {
+			if n, err := strconv.ParseUint(data[2:], 16, 32); err == nil {
+				data = strconv.FormatUint(n, 10)
+			}
+		}
+		values[fields[0]] = data
+	}
+	return values
+}
+
+// windowsVersionInfo returns the product name and version (major.minor.build)
+// from the values of HKLM\SOFTWARE\Microsoft\Windows NT\CurrentVersion.
+// Windows 10 and newer have the major and minor version as DWORDs, older
+// releases as CurrentVersion.
+func windowsVersionInfo(values map[string]string) (string, string) {
+	name := values["ProductName"]
+	if name == "" {
+		name = "Windows"
+	}
+	version := values["CurrentVersion"]
+	if major, ok := values["CurrentMajorVersionNumber"]; ok {
+		version = major + "." + values["CurrentMinorVersionNumber"]
+	}
+	build := values["CurrentBuildNumber"]
+	if build == "" {
+		build = values["CurrentBuild"]
+	}
+	if version != "" && build != "" {
+		version += "." + build
+	}
+	// Windows 11 kept the ProductName of Windows 10
+	if n, err := strconv.Atoi(build); err == nil && n >= 22000 {
+		name = strings.Replace(name, "Windows 10", "Windows 11", 1)
+	}
+	return name, version
+}
@@ -0,0 +1,114 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/exectest"
+)
+
+func TestStore__windowsVersionInfo(t *testing.T) {
+	cases := []struct {
+		fixture, name, version string
+	}{
+		{"reg-query-win7.txt", "Windows 7 Professional", "6.1.7601"},
+		{"reg-query-win10.txt", "Windows 10 Pro", "10.0.19045"},
+		{"reg-query-win11.txt", "Windows 11 Enterprise", "10.0.22631"},
+	}
+	for _, tc := range cases {
+		out, err := ioutil.ReadFile(filepath.Join("../../testdata/exec", tc.fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		name, version := windowsVersionInfo(parseRegQuery(out))
+		if name != tc.name || version != tc.version {
+			t.Errorf("%s: got %q %q", tc.fixture, name, version)
+		}
+	}
+
+	if name, version := windowsVersionInfo(parseRegQuery(nil)); name != "Windows" || version != "" {
+		t.Errorf("got %q %q", name, version)
+	}
+}
+
+func TestStore__commandC(t *testing.T) {
+	cmd := commandC("true")
+	found := 0
+	for i := range cmd.Env {
+		if cmd.Env[i] == "LC_ALL=C" || cmd.Env[i] == "LANG=C" {
+			found++
+		}
+	}
+	if found != 2 {
+		t.Errorf("got %q", cmd.Env)
+	}
+}
+
+func TestStore__fakeOpenSSLVersion(t *testing.T) {
+	fake, err := exectest.Install()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fake.Close()
+
+	fake.Add(exectest.Response{Name: "openssl", Args: []string{"version"}, Stdout: "LibreSSL 2.2.7\n"})
+	name, version := opensslStore{}.nameAndVersion()
+	if name != "LibreSSL" || version != "2.2.7" {
+		t.Errorf("got %q %q", name, version)
+	}
+
+	// not installed
+	fake.Add(exectest.Response{Name: "openssl", ExitCode: 127})
+	if name, version := (opensslStore{}).nameAndVersion(); name != "OpenSSL" || version != "" {
+		t.Errorf("got %q %q", name, version)
+	}
+}
+
+func TestStore__fakeCertutil(t *testing.T) {
+	fake, err := exectest.Install()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fake.Close()
+
+	bin, err := fake.Path("certutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.Add(exectest.Response{Name: "certutil", Args: []string{"-L", "-d"}, Fixture: "../../testdata/exec/certutil-list-nss3.txt"})
+	fake.Add(exectest.Response{Name: "certutil", Args: []string{"-L", "-a", "-n"}, Fixture: "../../testdata/example.crt"})
+
+	dir, err := ioutil.TempDir("", "cert-manage-certutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := crtutil{execPaths: []string{bin}}.listCertsFromDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 5 || items[2].nick != "Corporate Proxy Root" || len(items[2].certs) != 1 {
+		t.Fatalf("got %v", items)
+	}
+
+	// certutil -L, then -L -a -n for each nickname
+	calls := fake.Calls()
+	if len(calls) != 6 || !strings.HasSuffix(calls[3][len(calls[3])-1], "Corporate Proxy Root") {
+		t.Errorf("got %q", calls)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+// fileStore manages an arbitrary PEM bundle on disk, addressed with
+// `-app file:/path/to/bundle.pem`.
+//
+// The bundle is read into a memoryStore for each operation and written back
+// afterwards. Backups are copies of the bundle under ~/.cert-manage/file/.
+type fileStore struct {
+	path string
+}
+
+// fileStoreFor returns a Store for apps named like "file:<path>"
+func fileStoreFor(app string) (Store, bool) {
+	if !strings.HasPrefix(strings.ToLower(app), "file:") || len(app) == len("file:") {
+		return nil, false
+	}
+	path, err := filepath.Abs(app[len("file:"):])
+	if err != nil {
+		return nil, false
+	}
+	return fileStore{path: path}, true
+}
+
+func (s fileStore) GetInfo() *Info {
+	return &Info{
+		Name:     "File",
+		Location: s.path,
+		Writable: true,
+	}
+}
+
+func (s fileStore) Version() string {
+	return ""
+}
+
+func (s fileStore) load() (memoryStore, error) {
+	bs, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return memoryStore{}, err
+	}
+	certs, err := certutil.Decode(bs)
+	if err != nil {
+		return memoryStore{}, fmt.Errorf("error reading %s: %v", s.path, err)
+	}
+	return newMemoryStore(certs), nil
+}
+
+func (s fileStore) save(m memoryStore) error {
+	certs, err := m.List(nil)
+	if err != nil {
+		return err
+	}
+	return certutil.ToFile(s.path, certs)
+}
+
+func (s fileStore) List(opts *ListOptions) ([]*x509.Certificate, error) {
+	m, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return m.List(opts)
+}
+
+func (s fileStore) Add(certs []*x509.Certificate) error {
+	m := newMemoryStore(nil)
+	if file.Exists(s.path) {
+		loaded, err := s.load()
+		if err != nil {
+			return err
+		}
+		m = loaded
+	}
+	if err := m.Add(certs); err != nil {
+		return err
+	}
+	return s.save(m)
+}
+
+func (s fileStore) Remove(wh whitelist.Whitelist) error {
+	m, err := s.load()
+	if err != nil {
+		return err
+	}
+	if err := m.Remove(wh); err != nil {
+		return err
+	}
+	return s.save(m)
+}
+
+// backupDir is unique to each bundle's path
+func (s fileStore) backupDir() (string, error) {
+	sum := sha256.Sum256([]byte(s.path))
+	return getCertManageDir(filepath.Join("file", hex.EncodeToString(sum[:])[:16]))
+}
+
+func (s fileStore) Backup() error {
+	dir, err := s.backupDir()
+	if err != nil {
+		return err
+	}
+	return file.CopyFile(s.path, filepath.Join(dir, timeutil.Stamp(time.Now())+".pem"))
+}
+
+func (s fileStore) GetLatestBackup() (string, error) {
+	dir, err := s.backupDir()
+	if err != nil {
+		return "", err
+	}
+	return getLatestBackup(dir)
+}
+
+func (s fileStore) Restore(where string) error {
+	if where == "" {
+		latest, err := s.GetLatestBackup()
+		if err != nil {
+			return err
+		}
+		if latest == "" {
+			return fmt.Errorf("no backup of %s found", s.path)
+		}
+		where = latest
+	}
+	return file.CopyFile(where, s.path)
+}
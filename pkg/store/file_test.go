@@ -0,0 +1,92 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+func TestStoreFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	where := filepath.Join(dir, "bundle.pem")
+	if err := file.CopyFile("../../testdata/lots.crt", where); err != nil {
+		t.Fatal(err)
+	}
+	s, err := ForApp("file:" + where)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.GetInfo().Location != where {
+		t.Errorf("got %q", s.GetInfo().Location)
+	}
+
+	certs, err := s.List(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) < 2 {
+		t.Fatalf("only found %d certs", len(certs))
+	}
+
+	if err := s.Backup(); err != nil {
+		t.Fatal(err)
+	}
+	latest, err := s.GetLatestBackup()
+	if err != nil || latest == "" {
+		t.Fatalf("latest=%q err=%v", latest, err)
+	}
+	defer os.RemoveAll(filepath.Dir(latest))
+
+	// the bundle on disk is rewritten
+	if err := s.Remove(whitelist.FromCertificates(certs[:1])); err != nil {
+		t.Fatal(err)
+	}
+	onDisk, err := certutil.FromFile(where)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(onDisk) != 1 {
+		t.Errorf("got %d certs", len(onDisk))
+	}
+
+	if err := s.Restore(""); err != nil {
+		t.Fatal(err)
+	}
+	restored, _ := s.List(nil)
+	if len(restored) != len(certs) {
+		t.Errorf("got %d certs, expected %d", len(restored), len(certs))
+	}
+}
+
+func TestStoreFile__forApp(t *testing.T) {
+	if _, ok := fileStoreFor("file:"); ok {
+		t.Error("expected no store without a path")
+	}
+	if _, ok := fileStoreFor("snap:hello"); ok {
+		t.Error("expected no store")
+	}
+}
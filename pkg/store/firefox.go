@@ -15,11 +15,11 @@
 package store
 
 import (
-	"os/exec"
 	"path/filepath"
 	"strings"
 
 	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
 )
 
 var (
@@ -52,7 +52,7 @@ func firefoxVersion() string {
 		path := firefoxBinaryPaths[i]
 		if file.Exists(path) {
 			// returns "Mozilla Firefox 57.0.3"
-			out, err := exec.Command(path, "-v").CombinedOutput()
+			out, err := interrupt.Command(path, "-v").CombinedOutput()
 			if err == nil && len(out) > 0 {
 				r := strings.NewReplacer("Mozilla Firefox", "")
 				return strings.TrimSpace(r.Replace(string(out)))
@@ -0,0 +1,257 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+// BackupFormat is the format of backups written by this version of
+// cert-manage. It's increased whenever the layout of a store's backup
+// changes, along with a migration in backupMigrations.
+const BackupFormat = 2
+
+var (
+	// version of cert-manage, recorded in each backup's stamp
+	version = "unknown"
+
+	// backupMigrations upgrade a backup from the format of their key to the
+	// next format. Each migration runs in order until a backup is current.
+	backupMigrations = map[int]func(where string) error{
+		// Backups made before stamping share the same layout as format 2
+		1: func(string) error { return nil },
+	}
+)
+
+// SetVersion sets the version of cert-manage which is stamped on backups
+func SetVersion(v string) {
+	version = v
+}
+
+// BackupStamp records which format a backup was written in and the
+// version of cert-manage which wrote it.
+type BackupStamp struct {
+	Format  int       `json:"format"`
+	Version string    `json:"version"`
+	Created time.Time `json:"created"`
+}
+
+// GetBackupStamp returns the stamp of a backup. Backups made before stamps
+// were added are returned as format 1.
+func GetBackupStamp(where string) (*BackupStamp, error) {
+	path, err := backupStampFile()
+	if err != nil {
+		return nil, err
+	}
+	return readBackupStamp(path, where)
+}
+
+// SetBackupStamp records the stamp of a backup, e.g. one extracted from an
+// archive made on another machine.
+func SetBackupStamp(where string, st BackupStamp) error {
+	path, err := backupStampFile()
+	if err != nil {
+		return err
+	}
+	return writeBackupStamp(path, where, st)
+}
+
+// stampBackup records the current format and version against a backup
+func stampBackup(where string) error {
+	path, err := backupStampFile()
+	if err != nil {
+		return err
+	}
+	return writeBackupStamp(path, where, BackupStamp{
+		Format:  BackupFormat,
+		Version: version,
+		Created: time.Now().UTC(),
+	})
+}
+
+// prepareBackup migrates a backup to the current format, backups from a
+// newer version of cert-manage are rejected.
+func prepareBackup(where string) error {
+	path, err := backupStampFile()
+	if err != nil {
+		return err
+	}
+	return migrateBackup(path, where)
+}
+
+func migrateBackup(path, where string) error {
+	stamp, err := readBackupStamp(path, where)
+	if err != nil {
+		return err
+	}
+	if stamp.Format > BackupFormat {
+		return fmt.Errorf("backup %s is format %d (from cert-manage %s), but cert-manage %s only understands up to format %d, upgrade cert-manage to restore it", where, stamp.Format, stamp.Version, version, BackupFormat)
+	}
+	if stamp.Format == BackupFormat {
+		return nil
+	}
+	for format := stamp.Format; format < BackupFormat; format++ {
+		migrate, ok := backupMigrations[format]
+		if !ok {
+			return fmt.Errorf("no migration for backup %s from format %d", where, format)
+		}
+		if debug {
+			fmt.Printf("store: migrating backup %s from format %d\n", where, format)
+		}
+		if err := migrate(where); err != nil {
+			return fmt.Errorf("error migrating backup %s from format %d: %v", where, format, err)
+		}
+	}
+	stamp.Format = BackupFormat
+	return writeBackupStamp(path, where, *stamp)
+}
+
+// backupStampFile returns where the stamps of every backup are kept
+func backupStampFile() (string, error) {
+	parent, err := getCertManageParentDir()
+	if err != nil {
+		return "", err
+	}
+	if parent == "" {
+		return "", errors.New("unable to find home directory for backup stamps")
+	}
+	return filepath.Join(parent, "backups.json"), nil
+}
+
+func readBackupStamps(path string) (map[string]BackupStamp, error) {
+	stamps := make(map[string]BackupStamp)
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return stamps, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(bs, &stamps); err != nil {
+		return nil, fmt.Errorf("error reading backup stamps from %s: %v", path, err)
+	}
+	return stamps, nil
+}
+
+func readBackupStamp(path, where string) (*BackupStamp, error) {
+	stamps, err := readBackupStamps(path)
+	if err != nil {
+		return nil, err
+	}
+	st, ok := stamps[backupKey(where)]
+	if !ok {
+		return &BackupStamp{Format: 1}, nil
+	}
+	return &st, nil
+}
+
+func writeBackupStamp(path, where string, st BackupStamp) error {
+	stamps, err := readBackupStamps(path)
+	if err != nil {
+		return err
+	}
+	stamps[backupKey(where)] = st
+
+	// drop backups which have been deleted
+	for k := range stamps {
+		if filepath.IsAbs(k) && !file.Exists(k) {
+			delete(stamps, k)
+		}
+	}
+
+	bs, err := json.MarshalIndent(stamps, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bs, file.TempFilePermissions)
+}
+
+func backupKey(where string) string {
+	if abs, err := filepath.Abs(where); err == nil {
+		return abs
+	}
+	return where
+}
+
+func wrapVersioned(s Store) Store {
+	return versionedStore{s}
+}
+
+// versionedStore stamps each backup a Store takes and migrates (or rejects)
+// backups before they're restored.
+type versionedStore struct {
+	underlying Store
+}
+
+func (s versionedStore) GetInfo() *Info {
+	return s.underlying.GetInfo()
+}
+
+func (s versionedStore) Version() string {
+	return s.underlying.Version()
+}
+
+func (s versionedStore) List(opts *ListOptions) ([]*x509.Certificate, error) {
+	return s.underlying.List(opts)
+}
+
+func (s versionedStore) Add(certs []*x509.Certificate) error {
+	return s.underlying.Add(certs)
+}
+
+func (s versionedStore) Remove(wh whitelist.Whitelist) error {
+	return s.underlying.Remove(wh)
+}
+
+func (s versionedStore) Backup() error {
+	if err := s.underlying.Backup(); err != nil {
+		return err
+	}
+	latest, err := s.underlying.GetLatestBackup()
+	if err != nil || latest == "" {
+		return err
+	}
+	return stampBackup(latest)
+}
+
+func (s versionedStore) GetLatestBackup() (string, error) {
+	return s.underlying.GetLatestBackup()
+}
+
+func (s versionedStore) Restore(where string) error {
+	if where == "" {
+		latest, err := s.underlying.GetLatestBackup()
+		if err != nil {
+			return err
+		}
+		where = latest
+	}
+	if where != "" {
+		if err := prepareBackup(where); err != nil {
+			return err
+		}
+	}
+	return s.underlying.Restore(where)
+}
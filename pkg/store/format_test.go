@@ -0,0 +1,137 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoreFormat__stamps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-format")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "backups.json")
+	backup := filepath.Join(dir, "backup-1")
+	if err := ioutil.WriteFile(backup, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// unstamped backups are format 1
+	stamp, err := readBackupStamp(path, backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stamp.Format != 1 {
+		t.Errorf("got %#v", stamp)
+	}
+
+	if err := writeBackupStamp(path, backup, BackupStamp{Format: BackupFormat, Version: "1.2.3", Created: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	stamp, err = readBackupStamp(path, backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stamp.Format != BackupFormat || stamp.Version != "1.2.3" {
+		t.Errorf("got %#v", stamp)
+	}
+
+	// stamps of deleted backups are dropped
+	if err := os.Remove(backup); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(dir, "backup-2")
+	if err := writeBackupStamp(path, other, BackupStamp{Format: BackupFormat}); err != nil {
+		t.Fatal(err)
+	}
+	stamps, err := readBackupStamps(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stamps) != 0 {
+		t.Errorf("got %#v", stamps)
+	}
+}
+
+func TestStoreFormat__migrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-format")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "backups.json")
+	backup := filepath.Join(dir, "backup")
+	if err := ioutil.WriteFile(backup, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// legacy backups are migrated up to the current format
+	var ran []string
+	orig := backupMigrations[1]
+	backupMigrations[1] = func(where string) error {
+		ran = append(ran, where)
+		return nil
+	}
+	defer func() { backupMigrations[1] = orig }()
+
+	if err := migrateBackup(path, backup); err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 1 || ran[0] != backup {
+		t.Errorf("got %q", ran)
+	}
+	stamp, _ := readBackupStamp(path, backup)
+	if stamp.Format != BackupFormat {
+		t.Errorf("got %#v", stamp)
+	}
+
+	// current backups aren't migrated again
+	if err := migrateBackup(path, backup); err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 1 {
+		t.Errorf("got %q", ran)
+	}
+
+	// failed migrations leave the stamp alone
+	legacy := filepath.Join(dir, "legacy")
+	if err := ioutil.WriteFile(legacy, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	backupMigrations[1] = func(string) error { return errors.New("bad") }
+	if err := migrateBackup(path, legacy); err == nil {
+		t.Error("expected error")
+	}
+	if stamp, _ := readBackupStamp(path, legacy); stamp.Format != 1 {
+		t.Errorf("got %#v", stamp)
+	}
+
+	// backups from the future are rejected
+	if err := writeBackupStamp(path, backup, BackupStamp{Format: BackupFormat + 1, Version: "9.9.9"}); err != nil {
+		t.Fatal(err)
+	}
+	err = migrateBackup(path, backup)
+	if err == nil || !strings.Contains(err.Error(), "upgrade cert-manage") {
+		t.Errorf("got %v", err)
+	}
+}
@@ -17,29 +17,37 @@ package store
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
-	"runtime"
 	"strings"
 	"time"
 
 	"github.com/adamdecaf/cert-manage/pkg/certutil"
 	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/privilege"
+	"github.com/adamdecaf/cert-manage/pkg/progress"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
 	"github.com/adamdecaf/cert-manage/pkg/whitelist"
 )
 
 var (
-	defaultKeystorePassword = "changeit"
-	javaCertManageDir       = "java"
+	defaultKeystorePassword    = "changeit"
+	javaCertManageDir          = "java"
+	javaKeystoresCertManageDir = "java-keystores"
 )
 
-type javaStore struct{}
+type javaStore struct {
+	// kpath is a specific keystore to use, otherwise the keystore of the
+	// java install on PATH (or JAVA_HOME) is used.
+	kpath string
+}
 
 // JavaStore returns an implementation of Store for Java certificate stores
 //
@@ -50,7 +58,55 @@ func JavaStore() Store {
 	return javaStore{}
 }
 
+// JavaKeystore returns a Store for the keystore at kpath, e.g. one found
+// with FindJavaKeystores.
+func JavaKeystore(kpath string) Store {
+	return javaStore{
+		kpath: kpath,
+	}
+}
+
+// javaKeystoreFor returns a Store for apps named like "java:<path to keystore>"
+func javaKeystoreFor(app string) (Store, bool) {
+	if !strings.HasPrefix(strings.ToLower(app), "java:") || len(app) == len("java:") {
+		return nil, false
+	}
+	kpath, err := filepath.Abs(app[len("java:"):])
+	if err != nil {
+		return nil, false
+	}
+	return JavaKeystore(kpath), true
+}
+
+func (s javaStore) keystorePath() (string, error) {
+	if s.kpath != "" {
+		return s.kpath, nil
+	}
+	return ktool.getKeystorePath()
+}
+
+// backupDir returns where backups are kept, keystores given by path are
+// kept apart from the default keystore's backups.
+func (s javaStore) backupDir() (string, error) {
+	if s.kpath == "" {
+		return getCertManageDir(javaCertManageDir)
+	}
+	sum := sha256.Sum256([]byte(s.kpath))
+	return getCertManageDir(filepath.Join(javaKeystoresCertManageDir, hex.EncodeToString(sum[:])[:16]))
+}
+
 func (s javaStore) Add(certs []*x509.Certificate) error {
+	kpath, err := s.keystorePath()
+	if err != nil {
+		return err
+	}
+	if ks := nativeKeystore(kpath); ks != nil && ks.writable() {
+		for i := range certs {
+			ks.add(javaAlias(certs[i]), certs[i])
+		}
+		return writeKeystore(kpath, ks)
+	}
+
 	dir, err := ioutil.TempDir("", "cert-manage-java-add")
 	if err != nil {
 		return err
@@ -66,9 +122,7 @@ func (s javaStore) Add(certs []*x509.Certificate) error {
 			return err
 		}
 
-		// this replace is too simplistic
-		alias := strings.Replace(certutil.StringifyPKIXName(certs[i].Subject), " ", "_", -1)
-		err = ktool.addCertificate(path, alias)
+		err = ktool.addCertificate(kpath, path, javaAlias(certs[i]))
 		if err != nil {
 			return err
 		}
@@ -77,44 +131,72 @@ func (s javaStore) Add(certs []*x509.Certificate) error {
 }
 
 func (s javaStore) Backup() error {
-	kpath, err := ktool.getKeystorePath()
+	kpath, err := s.keystorePath()
 	if err != nil {
 		return err
 	}
-	dir, err := getCertManageDir(javaCertManageDir)
+	dir, err := s.backupDir()
 	if err != nil {
 		return err
 	}
 
 	// Rename the file as is
 	_, filename := filepath.Split(kpath)
-	dst := filepath.Join(dir, fmt.Sprintf("%s-%d.bck", filename, time.Now().Unix()))
+	dst := filepath.Join(dir, filename+"-"+timeutil.Stamp(time.Now())+".bck")
 
 	return file.CopyFile(kpath, dst)
 }
 
 func (s javaStore) GetLatestBackup() (string, error) {
-	dir, err := getCertManageDir(javaCertManageDir)
+	dir, err := s.backupDir()
 	if err != nil {
 		return "", fmt.Errorf("GetLatestBackup: error reading java backup directory, err=%v", err)
 	}
 	return getLatestBackup(dir)
 }
 
+// listBackup reads the certificates of a backed up keystore
+func (s javaStore) listBackup(where string) ([]*x509.Certificate, error) {
+	return keystoreCertificates(where)
+}
+
 func (s javaStore) GetInfo() *Info {
+	kpath, _ := s.keystorePath()
 	return &Info{
-		Name:    "Java",
-		Version: s.version(),
+		Name:     "Java",
+		Version:  s.Version(),
+		Location: kpath,
+		Writable: true,
 	}
 }
 
-func (s javaStore) version() string {
-	out, err := exec.Command("java", "-version").CombinedOutput()
+// Version reads JAVA_VERSION from the release file of the keystore's java
+// install, falling back to the java.version property of the java on PATH.
+func (s javaStore) Version() string {
+	if kpath, err := s.keystorePath(); err == nil {
+		if v := readJavaRelease(filepath.Join(javaHomeOf(kpath), "release"))["JAVA_VERSION"]; v != "" {
+			return v
+		}
+	}
+	out, err := commandC("java", "-XshowSettings:properties", "-version").CombinedOutput()
 	if err != nil {
 		return ""
 	}
+	return parseJavaVersion(out)
+}
 
-	// e.g. java version "1.8.0_152"
+// parseJavaVersion returns the java.version property printed by
+// `java -XshowSettings:properties -version`, or the quoted version of
+// `java -version` (e.g. java version "1.8.0_152") for JVMs without
+// -XshowSettings.
+func parseJavaVersion(out []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "=", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) == "java.version" {
+			return strings.TrimSpace(parts[1])
+		}
+	}
 	r := regexp.MustCompile(`"([\d\._]+)"`)
 	m := r.FindString(string(out))
 	return strings.Replace(m, `"`, "", -1)
@@ -124,31 +206,59 @@ func (s javaStore) version() string {
 //
 // Note: keytool does not offer the ability to "untrust" a certificate
 func (s javaStore) List(_ *ListOptions) ([]*x509.Certificate, error) {
-	return ktool.getCertificates()
+	kpath, err := s.keystorePath()
+	if err != nil {
+		return nil, err
+	}
+	return keystoreCertificates(kpath)
 }
 
 func (s javaStore) Remove(wh whitelist.Whitelist) error {
-	kpath, err := ktool.getKeystorePath()
+	kpath, err := s.keystorePath()
 	if err != nil {
 		return err
 	}
+	if ks := nativeKeystore(kpath); ks != nil && ks.writable() {
+		removed := ks.remove(wh)
+		if len(removed) == 0 {
+			return nil
+		}
+		if debug {
+			fmt.Printf("store/java: deleting %s from %s\n", strings.Join(removed, ", "), kpath)
+		}
+		return writeKeystore(kpath, ks)
+	}
 
-	certs, err := ktool.getCertificates()
+	certs, err := ktool.getCertificates(kpath)
 	if err != nil {
 		return err
 	}
 
-	shortCerts, err := ktool.getShortCerts()
+	shortCerts, err := ktool.getShortCerts(kpath)
 	if err != nil {
 		return err
 	}
+	// every short cert is compared against each certificate's fingerprints
+	certutil.PrecomputeFingerprints(certs)
 
 	// Map of short cert aliases we've already deleted
 	// Used to cleanup debug logging
 	deleted := make(map[string]bool)
 
-	// compare against all listed certs
+	// Aliases which couldn't be deleted, reported after the others are processed
+	perr := &PartialError{}
+
+	// compare against all listed certs, keystores given by path are often
+	// whitelisted in parallel so they don't show progress.
+	var bar *progress.Bar
+	if s.kpath == "" {
+		bar = progress.New("Applying whitelist", len(shortCerts))
+		defer bar.Done()
+	}
 	for i := range shortCerts {
+		if bar != nil {
+			bar.Increment()
+		}
 		if !shortCerts[i].hasFingerprints() {
 			return fmt.Errorf("No fingerprints found for certificate %s", shortCerts[i])
 		}
@@ -161,7 +271,8 @@ func (s javaStore) Remove(wh whitelist.Whitelist) error {
 				if !wh.Matches(certs[j]) {
 					err = ktool.deleteCertificate(kpath, shortCerts[i].alias)
 					if err != nil {
-						return err
+						perr.add(fmt.Sprintf("%s (%s)", kpath, shortCerts[i].alias), err)
+						break
 					}
 					deleted[shortCerts[i].alias] = true
 					if debug {
@@ -179,17 +290,21 @@ func (s javaStore) Remove(wh whitelist.Whitelist) error {
 		}
 	}
 
-	return nil
+	return perr.orNil()
 }
 
 func (s javaStore) Restore(where string) error {
-	src, err := s.GetLatestBackup()
-	if err != nil {
-		return err
+	src := where
+	if src == "" {
+		latest, err := s.GetLatestBackup()
+		if err != nil {
+			return err
+		}
+		src = latest
 	}
 
 	// Get destination path
-	dst, err := ktool.getKeystorePath()
+	dst, err := s.keystorePath()
 	if err != nil {
 		return err
 	}
@@ -199,6 +314,33 @@ func (s javaStore) Restore(where string) error {
 	return file.SudoCopyFile(src, dst)
 }
 
+// javaAlias returns the alias certificates are added under
+func javaAlias(cert *x509.Certificate) string {
+	// this replace is too simplistic
+	return strings.Replace(certutil.StringifyPKIXName(cert.Subject), " ", "_", -1)
+}
+
+// nativeKeystore reads the keystore at kpath without keytool, nil is returned
+// (and keytool used instead) if its format isn't supported.
+func nativeKeystore(kpath string) *javaKeystore {
+	ks, err := readKeystore(kpath)
+	if err != nil {
+		if debug {
+			fmt.Printf("store/java: using keytool for %s: %v\n", kpath, err)
+		}
+		return nil
+	}
+	return ks
+}
+
+// keystoreCertificates returns the trusted certificates of the keystore at kpath
+func keystoreCertificates(kpath string) ([]*x509.Certificate, error) {
+	if ks := nativeKeystore(kpath); ks != nil {
+		return ks.certificates(), nil
+	}
+	return ktool.getCertificates(kpath)
+}
+
 type keytool struct {
 	// JAVA_HOME env variable
 	javahome string
@@ -216,12 +358,7 @@ type keytool struct {
 // It follows this command:
 //
 // keytool -importcert -keystore $JAVA_HOME/jre/lib/security/cacerts -storepass .. -file .. -alias ..
-func (k keytool) addCertificate(where string, alias string) error {
-	kpath, err := k.getKeystorePath()
-	if err != nil {
-		return err
-	}
-
+func (k keytool) addCertificate(kpath, where, alias string) error {
 	args := append([]string{
 		"-importcert",
 		"-keystore", kpath,
@@ -229,16 +366,15 @@ func (k keytool) addCertificate(where string, alias string) error {
 		"-file", where,
 		"-alias", alias,
 		"-noprompt",
-	})
-	cmd := exec.Command("keytool", args...)
+	}, keytoolLocaleArgs...)
+	cmd := commandC("keytool", args...)
 
 	var stdout bytes.Buffer
 	cmd.Stdout = &stdout
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
-	err = cmd.Run()
-	if err != nil {
+	if err := cmd.Run(); err != nil {
 		if debug {
 			fmt.Printf("Command was: %s\n", strings.Join(cmd.Args, " "))
 			fmt.Printf("Stdout:\n%s\n", stdout.String())
@@ -337,26 +473,23 @@ func (k keytool) getKeystorePath() (string, error) {
 	return kpath, nil
 }
 
-func (k keytool) getShortCertsRaw(extraArgs ...string) ([]byte, error) {
+// listKeystore runs `keytool -list` against the keystore at kpath
+func (k keytool) listKeystore(kpath string, extraArgs ...string) ([]byte, error) {
 	// `keytool` gets installed onto PATH, so no need to search for it
-	kpath, err := k.getKeystorePath()
-	if err != nil {
-		return nil, err
-	}
-
 	args := append([]string{
 		"-list",
 		"-storepass", defaultKeystorePassword,
 		"-keystore", kpath,
-	}, extraArgs...)
-	cmd := exec.Command("keytool", args...)
+	}, keytoolLocaleArgs...)
+	args = append(args, extraArgs...)
+	cmd := commandC("keytool", args...)
 
 	var stdout bytes.Buffer
 	cmd.Stdout = &stdout
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
-	err = cmd.Run()
+	err := cmd.Run()
 	if err != nil {
 		if debug {
 			fmt.Printf("Command was: %s\n", strings.Join(cmd.Args, " "))
@@ -368,8 +501,8 @@ func (k keytool) getShortCertsRaw(extraArgs ...string) ([]byte, error) {
 	return stdout.Bytes(), nil
 }
 
-func (k keytool) getCertificates() ([]*x509.Certificate, error) {
-	out, err := k.getShortCertsRaw("-rfc")
+func (k keytool) getCertificates(kpath string) ([]*x509.Certificate, error) {
+	out, err := k.listKeystore(kpath, "-rfc")
 	if err != nil {
 		return nil, err
 	}
@@ -415,6 +548,13 @@ func (c *cert) String() string {
 	return fmt.Sprintf("%s, but no fingerprints", c.alias)
 }
 
+// keytoolFingerprint matches the fingerprint line after each entry of
+// `keytool -list`, whose label is translated:
+//
+// Certificate fingerprint (SHA1): B3:EA:C4:47:76:C9:C8:1C:EA:F2:9D:95:B6:CC:A0:08:1B:67:EC:9D
+// Zertifikat-Fingerprint (SHA-256): 9A:CF:AB:7E:43:C8:D8:80:D0:6B:26:2A:94:DE:EE:E4:B4:65:99:89:C3:D0:CA:F1:9B:AF:64:05:E4:1A:B7:DF
+var keytoolFingerprint = regexp.MustCompile(`\((SHA-?1|SHA-?256)\)\s*:\s*((?:[0-9A-Fa-f]{2}:)+[0-9A-Fa-f]{2})\s*$`)
+
 // $ keytool -list -keystore <path> -storepass <pass>
 // Keystore type: JKS
 // Keystore provider: SUN
@@ -423,12 +563,17 @@ func (c *cert) String() string {
 //
 // verisignclass2g2ca [jdk], Aug 25, 2016, trustedCertEntry,
 // Certificate fingerprint (SHA1): B3:EA:C4:47:76:C9:C8:1C:EA:F2:9D:95:B6:CC:A0:08:1B:67:EC:9D
-func (k keytool) getShortCerts() ([]*cert, error) {
-	out, err := k.getShortCertsRaw()
+func (k keytool) getShortCerts(kpath string) ([]*cert, error) {
+	out, err := k.listKeystore(kpath)
 	if err != nil {
 		return nil, err
 	}
+	return parseKeytoolList(out)
+}
 
+// parseKeytoolList reads the alias and fingerprint of each entry printed by
+// `keytool -list`. Only the format is relied on, not the (translated) labels.
+func parseKeytoolList(out []byte) ([]*cert, error) {
 	res := make([]*cert, 0)
 	r := bufio.NewScanner(bytes.NewReader(out))
 	var prev, curr string
@@ -436,41 +581,35 @@ func (k keytool) getShortCerts() ([]*cert, error) {
 		prev = curr     // $alias [info....]
 		curr = r.Text() // Certificate fingerprint ...
 
-		// Do we have a cert?
-		if strings.HasPrefix(curr, "Certificate fingerprint") {
-			item := &cert{
-				// verisignclass2g2ca [jdk], Aug 25, 2016, trustedCertEntry,
-				alias: strings.TrimSpace(strings.Split(prev, ",")[0]),
-			}
-
-			// Java 9 changes the fingerprint algorithm to SHA-256, which is identified inline
-			// Certificate fingerprint (SHA1): B3:EA:C4:47:76:C9:C8:1C:EA:F2:9D:95:B6:CC:A0:08:1B:67:EC:9D
-			// OR
-			// Certificate fingerprint (SHA-256): 9A:CF:AB:7E:43:C8:D8:80:D0:6B:26:2A:94:DE:EE:E4:B4:65:99:89:C3:D0:CA:F1:9B:AF:64:05:E4:1A:B7:DF
-			if strings.Contains(curr, "SHA1") {
-				fp := curr[len(curr)-40-19:] // 40 chars from sha1 output, 19 :'s
-				fp = strings.ToLower(strings.Replace(fp, ":", "", -1))
-				item.sha1Fingerprint = fp
-			}
-			if strings.Contains(curr, "SHA-256") {
-				fp := curr[len(curr)-64-31:] // 64 chars from sha1 output, 31 :'s
-				fp = strings.ToLower(strings.Replace(fp, ":", "", -1))
-				item.sha256Fingerprint = fp
-			}
-
-			if !item.hasFingerprints() {
-				if debug {
-					fmt.Printf("store/java: Failed to determine fingerprint algorithm of: %s\n%s\n", item.alias, curr)
-				}
-				return nil, fmt.Errorf("Unable to determine fingerprint of cert: %s", item)
-			}
+		// Java 9 changes the fingerprint algorithm to SHA-256, which is identified inline
+		m := keytoolFingerprint.FindStringSubmatch(curr)
+		if m == nil {
+			continue
+		}
+		item := &cert{
+			// verisignclass2g2ca [jdk], Aug 25, 2016, trustedCertEntry,
+			alias: strings.TrimSpace(strings.Split(prev, ",")[0]),
+		}
+		fp := strings.ToLower(strings.Replace(m[2], ":", "", -1))
+		switch {
+		case strings.Contains(m[1], "1") && len(fp) == 40:
+			item.sha1Fingerprint = fp
+		case strings.Contains(m[1], "256") && len(fp) == 64:
+			item.sha256Fingerprint = fp
+		}
 
+		if !item.hasFingerprints() {
 			if debug {
-				fmt.Printf("store/java: Parsed cert: %s\n", item)
+				fmt.Printf("store/java: Failed to determine fingerprint algorithm of: %s\n%s\n", item.alias, curr)
 			}
+			return nil, fmt.Errorf("Unable to determine fingerprint of cert: %s", item)
+		}
 
-			res = append(res, item)
+		if debug {
+			fmt.Printf("store/java: Parsed cert: %s\n", item)
 		}
+
+		res = append(res, item)
 	}
 
 	return res, nil
@@ -488,20 +627,21 @@ func (k keytool) deleteCertificate(kpath, alias string) error {
 		return nil
 	}
 
-	args := []string{
+	args := append([]string{
 		"keytool",
 		"-delete",
 		"-alias", alias,
 		"-keystore", kpath,
 		"-storepass", defaultKeystorePassword,
-	}
+	}, keytoolLocaleArgs...)
 
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" || os.Getuid() == 0 {
-		// already root
-		cmd = exec.Command(args[0], args[1:]...)
-	} else {
-		cmd = exec.Command("sudo", args...)
+	// The `cacerts` file is often owned by root, so only escalate if needed
+	cmd, err := privilege.CommandFor(kpath, args[0], args[1:]...)
+	if err == privilege.ErrSkipped {
+		return nil // reported after we're done
+	}
+	if err != nil {
+		return fmt.Errorf("%v when running keytool -delete", err)
 	}
 
 	var stdout bytes.Buffer
@@ -509,7 +649,7 @@ func (k keytool) deleteCertificate(kpath, alias string) error {
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
-	err := cmd.Run()
+	err = cmd.Run()
 	if err != nil {
 		if debug {
 			fmt.Printf("Command was: %s\n", strings.Join(cmd.Args, " "))
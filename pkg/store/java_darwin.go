@@ -18,15 +18,30 @@ package store
 
 import (
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
 	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
 )
 
 var ktool keytool
 
+// javaSearchRoots are walked to find keystores, see FindJavaKeystores
+var javaSearchRoots = []string{
+	"/Library/Java/JavaVirtualMachines",
+	filepath.Join(file.HomeDir(), "Library/Java/JavaVirtualMachines"),
+}
+
+// jlinkRuntimeGlobs match runtimes bundled in app bundles by jpackage
+var jlinkRuntimeGlobs = []string{
+	"/Applications/*.app/Contents/runtime/Contents/Home",
+	filepath.Join(file.HomeDir(), "Applications/*.app/Contents/runtime/Contents/Home"),
+}
+
+// containerLayerGlobs is empty as container images live inside a VM
+var containerLayerGlobs []string
+
 func init() {
 	full := expandKnownJavaInstall()
 	if full == "" {
@@ -47,7 +62,7 @@ func expandKnownJavaInstall() string {
 	full := "/System/Library/Frameworks/JavaVM.framework/Versions/Current/Commands/java_home"
 	if file.Exists(full) && file.IsExecutable(full) {
 		// We need to exec the script and return its result as JAVA_HOME
-		out, err := exec.Command(full).Output()
+		out, err := interrupt.Command(full).Output()
 		if err != nil {
 			// return we found nothing
 			return ""
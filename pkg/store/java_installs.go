@@ -0,0 +1,270 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/file"
+)
+
+var (
+	// containerJavaHomeGlobs are where common container images install java,
+	// relative to the image's filesystem. They cover distro packages, the
+	// eclipse-temurin, openjdk and amazoncorretto images and buildpacks.
+	containerJavaHomeGlobs = []string{
+		"usr/lib/jvm/*",
+		"usr/java/*",
+		"opt/java/openjdk",
+		"usr/local/openjdk-*",
+		"layers/*/jre",
+		"layers/*/jdk",
+	}
+)
+
+// JavaInstall is a JVM (JDK, JRE or jlink runtime) and the keystore it uses
+type JavaInstall struct {
+	Home string
+
+	// Keystore is the path of its cacerts, after following symlinks
+	Keystore string
+
+	// Vendor and Version are read from the install's release file
+	Vendor  string
+	Version string
+
+	// Source is how the install was found: system, sdkman, container or jlink
+	Source string
+}
+
+// javaSearchRoot is a directory walked for keystores
+type javaSearchRoot struct {
+	path   string
+	source string
+
+	// within is set for container layers, keystores linking outside of it
+	// point at the host's files rather than the image's and are skipped
+	within string
+}
+
+// defaultJavaSearchRoots returns where java is installed on the platform,
+// SDKMAN's candidates and the java installs of unpacked container image
+// layers and jlink runtimes.
+func defaultJavaSearchRoots() []javaSearchRoot {
+	var out []javaSearchRoot
+	for i := range javaSearchRoots {
+		out = append(out, javaSearchRoot{path: javaSearchRoots[i]})
+	}
+	for _, pattern := range append(containerJavaHomeGlobs, jlinkRuntimeGlobs...) {
+		if !filepath.IsAbs(pattern) {
+			pattern = string(filepath.Separator) + pattern
+		}
+		matches, _ := filepath.Glob(pattern)
+		for i := range matches {
+			out = append(out, javaSearchRoot{path: matches[i]})
+		}
+	}
+
+	sdkman := os.Getenv("SDKMAN_DIR")
+	if sdkman == "" {
+		sdkman = filepath.Join(file.HomeDir(), ".sdkman")
+	}
+	out = append(out, javaSearchRoot{
+		path:   filepath.Join(sdkman, "candidates", "java"),
+		source: "sdkman",
+	})
+
+	for i := range containerLayerGlobs {
+		layers, _ := filepath.Glob(containerLayerGlobs[i])
+		for j := range layers {
+			for k := range containerJavaHomeGlobs {
+				homes, _ := filepath.Glob(filepath.Join(layers[j], containerJavaHomeGlobs[k]))
+				for n := range homes {
+					out = append(out, javaSearchRoot{
+						path:   homes[n],
+						source: "container",
+						within: layers[j],
+					})
+				}
+			}
+		}
+	}
+	return out
+}
+
+// FindJavaKeystores walks each of roots (or the default locations, see
+// FindJavaInstalls) and returns every `cacerts` keystore found. Roots
+// which don't exist are skipped.
+func FindJavaKeystores(roots []string) ([]string, error) {
+	installs, err := FindJavaInstalls(roots)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var out []string
+	for i := range installs {
+		if !seen[installs[i].Keystore] {
+			seen[installs[i].Keystore] = true
+			out = append(out, installs[i].Keystore)
+		}
+	}
+	file.SortNames(out)
+	return out, nil
+}
+
+// FindJavaInstalls walks each of roots for java installs and their
+// keystores. Without roots the platform's java install locations, SDKMAN,
+// jlink runtimes of packaged apps and the JAVA_HOMEs of common images in
+// container storage (docker, containerd and podman) are searched.
+//
+// Installs are sorted by keystore then home, many JVMs share one keystore.
+func FindJavaInstalls(roots []string) ([]JavaInstall, error) {
+	var search []javaSearchRoot
+	if len(roots) == 0 {
+		search = defaultJavaSearchRoots()
+	} else {
+		for i := range roots {
+			search = append(search, javaSearchRoot{path: roots[i]})
+		}
+	}
+
+	seen := make(map[string]bool) // homes
+	var out []JavaInstall
+	for i := range search {
+		root := search[i]
+		if !file.Exists(root.path) {
+			continue
+		}
+		err := filepath.Walk(root.path, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if debug {
+					fmt.Printf("store/java: skipping %s, err=%v\n", path, err)
+				}
+				if info != nil && info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() || info.Name() != "cacerts" || info.Size() == 0 {
+				return nil
+			}
+			home := javaHomeOf(path)
+			if seen[home] {
+				return nil
+			}
+			seen[home] = true
+
+			// Many installs link their cacerts to a shared keystore
+			kpath := path
+			if real, err := filepath.EvalSymlinks(path); err == nil {
+				kpath = real
+			}
+			if root.within != "" && !strings.HasPrefix(kpath, root.within+string(filepath.Separator)) {
+				if debug {
+					fmt.Printf("store/java: skipping %s, links outside of its container layer to %s\n", path, kpath)
+				}
+				return nil
+			}
+			out = append(out, newJavaInstall(home, kpath, root.source))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Keystore != out[j].Keystore {
+			return strings.ToLower(out[i].Keystore) < strings.ToLower(out[j].Keystore)
+		}
+		return out[i].Home < out[j].Home
+	})
+	return out, nil
+}
+
+// javaHomeOf returns the JAVA_HOME of a keystore, which is under
+// lib/security (or jre/lib/security for java 8 and older).
+func javaHomeOf(kpath string) string {
+	dir := filepath.Dir(kpath)
+	if filepath.Base(dir) != "security" || filepath.Base(filepath.Dir(dir)) != "lib" {
+		return dir
+	}
+	home := filepath.Dir(filepath.Dir(dir))
+	if filepath.Base(home) == "jre" && file.Exists(filepath.Join(filepath.Dir(home), "bin")) {
+		return filepath.Dir(home)
+	}
+	return home
+}
+
+func newJavaInstall(home, kpath, source string) JavaInstall {
+	release := readJavaRelease(filepath.Join(home, "release"))
+	install := JavaInstall{
+		Home:     home,
+		Keystore: kpath,
+		Vendor:   release["IMPLEMENTOR"],
+		Version:  release["JAVA_VERSION"],
+		Source:   source,
+	}
+	if install.Vendor == "" {
+		install.Vendor = release["JAVA_VENDOR"]
+	}
+	if install.Source == "" {
+		install.Source = "system"
+		if isJlinkRuntime(release) {
+			install.Source = "jlink"
+		}
+	}
+	return install
+}
+
+// isJlinkRuntime guesses if a release file is from a runtime built by jlink
+// (or jpackage). JDK and JRE builds include the java.se aggregate module,
+// custom runtimes are usually trimmed to the modules an app needs.
+func isJlinkRuntime(release map[string]string) bool {
+	modules, ok := release["MODULES"]
+	if !ok {
+		return false // java 8 and older
+	}
+	for _, m := range strings.Fields(modules) {
+		if m == "java.se" {
+			return false
+		}
+	}
+	return true
+}
+
+// readJavaRelease parses the KEY="value" lines of a java install's release
+// file, a missing file gives an empty map.
+func readJavaRelease(path string) map[string]string {
+	out := make(map[string]string)
+	fd, err := os.Open(path)
+	if err != nil {
+		return out
+	}
+	defer fd.Close()
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		out[strings.TrimSpace(parts[0])] = strings.Trim(strings.TrimSpace(parts[1]), `"`)
+	}
+	return out
+}
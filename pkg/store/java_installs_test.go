@@ -0,0 +1,125 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStoreJava__FindJavaInstalls(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-java")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir, _ = filepath.EvalSymlinks(dir)
+
+	write := func(rel, body string) string {
+		where := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(where), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(where, []byte(body), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return where
+	}
+
+	// java 8 keeps its keystore under jre/
+	jdk8 := write("jvm/jdk8/jre/lib/security/cacerts", "A")
+	write("jvm/jdk8/bin/java", "")
+	write("jvm/jdk8/release", "JAVA_VERSION=\"1.8.0_292\"\nJAVA_VENDOR=\"Oracle Corporation\"\n")
+
+	temurin := write("jvm/temurin-17/lib/security/cacerts", "B")
+	write("jvm/temurin-17/release", "IMPLEMENTOR=\"Eclipse Adoptium\"\nJAVA_VERSION=\"17.0.2\"\nMODULES=\"java.base java.logging java.se jdk.jfr\"\n")
+
+	runtime := write("app/lib/runtime/lib/security/cacerts", "C")
+	write("app/lib/runtime/release", "JAVA_VERSION=\"21\"\nMODULES=\"java.base java.net.http\"\n")
+
+	installs, err := FindJavaInstalls([]string{filepath.Join(dir, "jvm"), filepath.Join(dir, "app")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(installs) != 3 {
+		t.Fatalf("got %#v", installs)
+	}
+	expected := []JavaInstall{
+		{Home: filepath.Join(dir, "app/lib/runtime"), Keystore: runtime, Version: "21", Source: "jlink"},
+		{Home: filepath.Join(dir, "jvm/jdk8"), Keystore: jdk8, Vendor: "Oracle Corporation", Version: "1.8.0_292", Source: "system"},
+		{Home: filepath.Join(dir, "jvm/temurin-17"), Keystore: temurin, Vendor: "Eclipse Adoptium", Version: "17.0.2", Source: "system"},
+	}
+	for i := range expected {
+		if installs[i] != expected[i] {
+			t.Errorf("got %#v, expected %#v", installs[i], expected[i])
+		}
+	}
+}
+
+func TestStoreJava__defaultJavaSearchRoots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-java")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir, _ = filepath.EvalSymlinks(dir)
+
+	write := func(rel, body string) string {
+		where := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(where), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(where, []byte(body), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return where
+	}
+	sdk := write("sdkman/candidates/java/17.0.2-tem/lib/security/cacerts", "A")
+	layer := write("docker/overlay2/abc/diff/opt/java/openjdk/lib/security/cacerts", "B")
+
+	// linked to the host's /etc, not the image's
+	linked := filepath.Join(dir, "docker/overlay2/def/diff/usr/lib/jvm/java-11/lib/security/cacerts")
+	if err := os.MkdirAll(filepath.Dir(linked), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(write("etc/cacerts", "C"), linked); err != nil {
+		t.Skipf("can't create symlink: %v", err)
+	}
+
+	origRoots, origLayers, origJlink := javaSearchRoots, containerLayerGlobs, jlinkRuntimeGlobs
+	origSdkman := os.Getenv("SDKMAN_DIR")
+	defer func() {
+		javaSearchRoots, containerLayerGlobs, jlinkRuntimeGlobs = origRoots, origLayers, origJlink
+		os.Setenv("SDKMAN_DIR", origSdkman)
+	}()
+	javaSearchRoots = []string{filepath.Join(dir, "missing")}
+	containerLayerGlobs = []string{filepath.Join(dir, "docker/overlay2/*/diff")}
+	jlinkRuntimeGlobs = nil
+	os.Setenv("SDKMAN_DIR", filepath.Join(dir, "sdkman"))
+
+	installs, err := FindJavaInstalls(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]string)
+	for i := range installs {
+		found[installs[i].Keystore] = installs[i].Source
+	}
+	if len(found) != 2 || found[sdk] != "sdkman" || found[layer] != "container" {
+		t.Errorf("got %#v", installs)
+	}
+}
@@ -0,0 +1,440 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+// Keystores are read and written here, without keytool, when their format is
+// understood. JKS and JCEKS keystores are documented in OpenJDK's
+// sun.security.provider.JavaKeyStore and PKCS#12 keystores (the default
+// since Java 9) are read with certutil.
+//
+// Private keys in JKS keystores are kept as is, but keystores where entries
+// would be lost (JCEKS secret keys, PKCS#12 private keys) are left to keytool.
+
+var (
+	jksMagic   = []byte{0xfe, 0xed, 0xfe, 0xed}
+	jceksMagic = []byte{0xce, 0xce, 0xce, 0xce}
+
+	// jksWhitener is mixed into the integrity digest of JKS keystores
+	jksWhitener = []byte("Mighty Aphrodite")
+
+	errKeystorePassword = errors.New("store/java: keystore password is incorrect")
+)
+
+const (
+	jksPrivateKeyEntry   = 1
+	jksTrustedCertEntry  = 2
+	jceksSecretKeyEntry  = 3
+	jksDigestSize        = sha1.Size
+	jksCertificateType   = "X.509"
+	jksDefaultVersion    = 2
+	jksMillisecondsScale = int64(time.Millisecond)
+)
+
+type javaKeystore struct {
+	// magic is jksMagic or jceksMagic, nil for PKCS#12 keystores
+	magic   []byte
+	version uint32
+
+	entries []keystoreEntry
+
+	// skipped is how many PKCS#12 entries (e.g. private keys) weren't read
+	skipped int
+}
+
+type keystoreEntry struct {
+	alias   string
+	created time.Time
+
+	// cert is set for trusted certificates, other (JKS) entries are kept
+	// encoded in raw and written back unchanged.
+	cert *x509.Certificate
+	raw  []byte
+}
+
+// readKeystore reads the keystore at kpath with the default password
+func readKeystore(kpath string) (*javaKeystore, error) {
+	bs, err := ioutil.ReadFile(kpath)
+	if err != nil {
+		return nil, err
+	}
+	return parseKeystore(bs, defaultKeystorePassword)
+}
+
+func parseKeystore(bs []byte, password string) (*javaKeystore, error) {
+	if len(bs) >= 4 && (bytes.Equal(bs[:4], jksMagic) || bytes.Equal(bs[:4], jceksMagic)) {
+		return parseJKS(bs, password)
+	}
+	entries, skipped, err := certutil.DecodePKCS12Entries(bs, password)
+	if err != nil {
+		if err == certutil.ErrPKCS12Password {
+			return nil, errKeystorePassword
+		}
+		return nil, fmt.Errorf("store/java: unknown keystore format: %v", err)
+	}
+	ks := &javaKeystore{
+		skipped: skipped,
+	}
+	for i := range entries {
+		ks.entries = append(ks.entries, keystoreEntry{
+			alias: entries[i].Name,
+			cert:  entries[i].Cert,
+		})
+	}
+	return ks, nil
+}
+
+func parseJKS(bs []byte, password string) (*javaKeystore, error) {
+	if len(bs) < 12+jksDigestSize {
+		return nil, errors.New("store/java: keystore is truncated")
+	}
+	body, digest := bs[:len(bs)-jksDigestSize], bs[len(bs)-jksDigestSize:]
+	if !bytes.Equal(jksDigest(body, password), digest) {
+		return nil, errKeystorePassword
+	}
+
+	r := &jksReader{bs: body}
+	ks := &javaKeystore{
+		magic: r.read(4),
+	}
+	ks.version = r.uint32()
+	if ks.version != 1 && ks.version != 2 {
+		return nil, fmt.Errorf("store/java: unsupported keystore version %d", ks.version)
+	}
+	count := r.uint32()
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		start := r.off
+		tag := r.uint32()
+		entry := keystoreEntry{
+			alias:   r.utf(),
+			created: time.Unix(0, int64(r.uint64())*jksMillisecondsScale),
+		}
+		switch tag {
+		case jksTrustedCertEntry:
+			der := r.certificate(ks.version)
+			if r.err != nil {
+				break
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, fmt.Errorf("store/java: error parsing %s: %v", entry.alias, err)
+			}
+			entry.cert = cert
+		case jksPrivateKeyEntry:
+			r.bytes() // encrypted key
+			chain := r.uint32()
+			for j := uint32(0); j < chain && r.err == nil; j++ {
+				r.certificate(ks.version)
+			}
+			entry.raw = body[start:r.off]
+		case jceksSecretKeyEntry:
+			// stored as a serialized java object, which has no length
+			return nil, fmt.Errorf("store/java: secret key %s isn't supported", entry.alias)
+		default:
+			return nil, fmt.Errorf("store/java: unknown keystore entry type %d", tag)
+		}
+		ks.entries = append(ks.entries, entry)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.off != len(body) {
+		return nil, errors.New("store/java: unexpected data after keystore entries")
+	}
+	return ks, nil
+}
+
+// jksDigest is SHA1(password as UTF-16 || "Mighty Aphrodite" || body)
+func jksDigest(body []byte, password string) []byte {
+	h := sha1.New()
+	for _, c := range utf16.Encode([]rune(password)) {
+		h.Write([]byte{byte(c >> 8), byte(c)})
+	}
+	h.Write(jksWhitener)
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// writable returns false if writing the keystore would lose entries
+func (ks *javaKeystore) writable() bool {
+	return ks.skipped == 0
+}
+
+func (ks *javaKeystore) certificates() []*x509.Certificate {
+	var out []*x509.Certificate
+	for i := range ks.entries {
+		if ks.entries[i].cert != nil {
+			out = append(out, ks.entries[i].cert)
+		}
+	}
+	return out
+}
+
+// add trusts cert under alias (made unique if needed), certificates already
+// in the keystore aren't added again. JKS aliases are lowercase, as keytool
+// writes them.
+func (ks *javaKeystore) add(alias string, cert *x509.Certificate) bool {
+	if ks.magic != nil {
+		alias = strings.ToLower(alias)
+	}
+	aliases := make(map[string]bool)
+	for i := range ks.entries {
+		if ks.entries[i].cert != nil && ks.entries[i].cert.Equal(cert) {
+			return false
+		}
+		aliases[strings.ToLower(ks.entries[i].alias)] = true
+	}
+	unique := alias
+	for n := 2; aliases[strings.ToLower(unique)]; n++ {
+		unique = fmt.Sprintf("%s-%d", alias, n)
+	}
+	ks.entries = append(ks.entries, keystoreEntry{
+		alias:   unique,
+		created: time.Now(),
+		cert:    cert,
+	})
+	return true
+}
+
+// remove drops trusted certificates which aren't whitelisted, returning
+// their aliases. Private keys aren't removed.
+func (ks *javaKeystore) remove(wh whitelist.Whitelist) []string {
+	var removed []string
+	certs := make([]*x509.Certificate, len(ks.entries))
+	for i := range ks.entries {
+		certs[i] = ks.entries[i].cert
+	}
+	matches := wh.MatchEach(certs)
+	kept := ks.entries[:0]
+	for i := range ks.entries {
+		if ks.entries[i].cert != nil && !matches[i] {
+			removed = append(removed, ks.entries[i].alias)
+			continue
+		}
+		kept = append(kept, ks.entries[i])
+	}
+	ks.entries = kept
+	return removed
+}
+
+func (ks *javaKeystore) marshal(password string) ([]byte, error) {
+	if !ks.writable() {
+		return nil, fmt.Errorf("store/java: keystore has %d entries which can't be written", ks.skipped)
+	}
+	if ks.magic == nil {
+		var entries []certutil.PKCS12Entry
+		for i := range ks.entries {
+			entries = append(entries, certutil.PKCS12Entry{
+				Name: ks.entries[i].alias,
+				Cert: ks.entries[i].cert,
+			})
+		}
+		return certutil.EncodePKCS12Entries(entries, password)
+	}
+
+	w := &jksWriter{}
+	version := ks.version
+	if version == 0 {
+		version = jksDefaultVersion
+	}
+	w.buf.Write(ks.magic)
+	w.uint32(version)
+	w.uint32(uint32(len(ks.entries)))
+	for i := range ks.entries {
+		e := ks.entries[i]
+		if e.raw != nil {
+			w.buf.Write(e.raw)
+			continue
+		}
+		w.uint32(jksTrustedCertEntry)
+		if err := w.utf(e.alias); err != nil {
+			return nil, err
+		}
+		w.uint64(uint64(e.created.UnixNano() / jksMillisecondsScale))
+		if version == 2 {
+			w.utf(jksCertificateType)
+		}
+		w.uint32(uint32(len(e.cert.Raw)))
+		w.buf.Write(e.cert.Raw)
+	}
+	w.buf.Write(jksDigest(w.buf.Bytes(), password))
+	return w.buf.Bytes(), nil
+}
+
+// writeKeystore replaces the keystore at kpath, escalating if needed (as
+// cacerts is often owned by root) and keeping its permissions.
+func writeKeystore(kpath string, ks *javaKeystore) error {
+	bs, err := ks.marshal(defaultKeystorePassword)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(kpath)
+	if err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir("", "cert-manage-java-keystore")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, filepath.Base(kpath))
+	if err := ioutil.WriteFile(tmp, bs, info.Mode()); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, info.Mode()); err != nil {
+		return err
+	}
+	return file.SudoCopyFile(tmp, kpath)
+}
+
+// jksReader reads big-endian values, keeping the first error
+type jksReader struct {
+	bs  []byte
+	off int
+	err error
+}
+
+func (r *jksReader) read(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.bs)-r.off < n {
+		r.err = errors.New("store/java: keystore is truncated")
+		return nil
+	}
+	out := r.bs[r.off : r.off+n]
+	r.off += n
+	return out
+}
+
+func (r *jksReader) uint32() uint32 {
+	if bs := r.read(4); bs != nil {
+		return binary.BigEndian.Uint32(bs)
+	}
+	return 0
+}
+
+func (r *jksReader) uint64() uint64 {
+	if bs := r.read(8); bs != nil {
+		return binary.BigEndian.Uint64(bs)
+	}
+	return 0
+}
+
+func (r *jksReader) bytes() []byte {
+	n := r.uint32()
+	if n > uint32(len(r.bs)) {
+		r.err = errors.New("store/java: keystore is truncated")
+		return nil
+	}
+	return r.read(int(n))
+}
+
+// utf reads java's DataInput.readUTF format, a length and modified UTF-8
+func (r *jksReader) utf() string {
+	bs := r.read(2)
+	if bs == nil {
+		return ""
+	}
+	return decodeModifiedUTF8(r.read(int(binary.BigEndian.Uint16(bs))))
+}
+
+func (r *jksReader) certificate(version uint32) []byte {
+	if version == 2 {
+		if typ := r.utf(); r.err == nil && typ != jksCertificateType {
+			r.err = fmt.Errorf("store/java: unsupported certificate type %q", typ)
+		}
+	}
+	return r.bytes()
+}
+
+type jksWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *jksWriter) uint32(n uint32) {
+	binary.Write(&w.buf, binary.BigEndian, n)
+}
+
+func (w *jksWriter) uint64(n uint64) {
+	binary.Write(&w.buf, binary.BigEndian, n)
+}
+
+func (w *jksWriter) utf(s string) error {
+	bs := encodeModifiedUTF8(s)
+	if len(bs) > 0xffff {
+		return fmt.Errorf("store/java: alias %q is too long", s)
+	}
+	binary.Write(&w.buf, binary.BigEndian, uint16(len(bs)))
+	w.buf.Write(bs)
+	return nil
+}
+
+// Java's modified UTF-8 encodes NUL as two bytes and supplementary
+// characters as surrogate pairs of three bytes each.
+func encodeModifiedUTF8(s string) []byte {
+	var out []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		switch {
+		case c != 0 && c < 0x80:
+			out = append(out, byte(c))
+		case c < 0x800:
+			out = append(out, byte(0xc0|c>>6), byte(0x80|c&0x3f))
+		default:
+			out = append(out, byte(0xe0|c>>12), byte(0x80|(c>>6)&0x3f), byte(0x80|c&0x3f))
+		}
+	}
+	return out
+}
+
+func decodeModifiedUTF8(bs []byte) string {
+	var units []uint16
+	for i := 0; i < len(bs); {
+		switch {
+		case bs[i] < 0x80:
+			units = append(units, uint16(bs[i]))
+			i++
+		case bs[i]&0xe0 == 0xc0 && i+1 < len(bs):
+			units = append(units, uint16(bs[i]&0x1f)<<6|uint16(bs[i+1]&0x3f))
+			i += 2
+		case bs[i]&0xf0 == 0xe0 && i+2 < len(bs):
+			units = append(units, uint16(bs[i]&0x0f)<<12|uint16(bs[i+1]&0x3f)<<6|uint16(bs[i+2]&0x3f))
+			i += 3
+		default:
+			units = append(units, 0xfffd)
+			i++
+		}
+	}
+	return string(utf16.Decode(units))
+}
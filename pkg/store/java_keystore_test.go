@@ -0,0 +1,162 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+func TestStoreJava__parseJKS(t *testing.T) {
+	bs, err := ioutil.ReadFile("../../testdata/keystore.jks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := parseKeystore(bs, defaultKeystorePassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ks.entries) != 3 || len(ks.certificates()) != 2 {
+		t.Fatalf("got %d entries, %d certificates", len(ks.entries), len(ks.certificates()))
+	}
+	if ks.entries[1].alias != "mykey" || ks.entries[1].raw == nil {
+		t.Errorf("unexpected private key entry: %#v", ks.entries[1])
+	}
+	if ks.entries[2].alias != "zertifikat-ü" {
+		t.Errorf("got alias %q", ks.entries[2].alias)
+	}
+
+	// Writing an unchanged keystore gives the same bytes
+	out, err := ks.marshal(defaultKeystorePassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bs, out) {
+		t.Error("keystore changed")
+	}
+
+	if _, err := parseKeystore(bs, "other"); err != errKeystorePassword {
+		t.Errorf("expected errKeystorePassword, got %v", err)
+	}
+	if _, err := parseKeystore(bs[:len(bs)/2], defaultKeystorePassword); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestStoreJava__nativeKeystore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-java-keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kpath := filepath.Join(dir, "cacerts")
+	if err := file.CopyFile("../../testdata/keystore.jks", kpath); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chmod(kpath, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := JavaKeystore(kpath)
+	if err := s.Add(certs); err != nil {
+		t.Fatal(err)
+	}
+	listed, err := s.List(&ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != len(certs) {
+		t.Errorf("got %d certificates", len(listed))
+	}
+
+	if err := s.Remove(whitelist.Whitelist{}); err != nil {
+		t.Fatal(err)
+	}
+	ks, err := readKeystore(kpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ks.entries) != 1 || ks.entries[0].alias != "mykey" {
+		t.Errorf("expected only the private key, got %d entries", len(ks.entries))
+	}
+	if info, err := os.Stat(kpath); err != nil || info.Mode() != 0644 {
+		t.Errorf("mode=%v err=%v", info.Mode(), err)
+	}
+}
+
+func TestStoreJava__nativePKCS12Keystore(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := certutil.EncodePKCS12Entries([]certutil.PKCS12Entry{
+		{Name: "first", Cert: certs[0]},
+		{Name: "second", Cert: certs[1]},
+	}, defaultKeystorePassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := parseKeystore(bs, defaultKeystorePassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ks.add("First", certs[2]) || ks.add("dup", certs[0]) {
+		t.Error("unexpected add result")
+	}
+	if ks.entries[2].alias != "First-2" {
+		t.Errorf("got alias %q", ks.entries[2].alias)
+	}
+
+	wh := whitelist.Whitelist{
+		Fingerprints: []string{certutil.GetHexSHA256Fingerprint(*certs[1])},
+	}
+	if removed := ks.remove(wh); len(removed) != 2 {
+		t.Errorf("removed %v", removed)
+	}
+	bs, err = ks.marshal(defaultKeystorePassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err = parseKeystore(bs, defaultKeystorePassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ks.entries) != 1 || ks.entries[0].alias != "second" {
+		t.Errorf("got %#v", ks.entries)
+	}
+}
+
+func TestStoreJava__modifiedUTF8(t *testing.T) {
+	for _, s := range []string{"plain", "nul\x00", "zertifikat-ü", "emoji 😀"} {
+		if out := decodeModifiedUTF8(encodeModifiedUTF8(s)); out != s {
+			t.Errorf("got %q, expected %q", out, s)
+		}
+	}
+	if bs := encodeModifiedUTF8("\x00"); !bytes.Equal(bs, []byte{0xc0, 0x80}) {
+		t.Errorf("got %x", bs)
+	}
+}
@@ -18,8 +18,31 @@ package store
 
 import (
 	"os"
+	"path/filepath"
+
+	"github.com/adamdecaf/cert-manage/pkg/file"
 )
 
+// javaSearchRoots are walked to find keystores, see FindJavaKeystores
+var javaSearchRoots = []string{
+	"/usr/lib/jvm",
+	"/usr/java",
+	"/opt",
+}
+
+// jlinkRuntimeGlobs match runtimes bundled with apps outside of
+// javaSearchRoots, jpackage installs under /opt/<app>/lib/runtime
+var jlinkRuntimeGlobs []string
+
+// containerLayerGlobs match the unpacked image layers of docker, containerd
+// and (rootful or rootless) podman
+var containerLayerGlobs = []string{
+	"/var/lib/docker/overlay2/*/diff",
+	"/var/lib/containerd/io.containerd.snapshotter.v1.overlayfs/snapshots/*/fs",
+	"/var/lib/containers/storage/overlay/*/diff",
+	filepath.Join(file.HomeDir(), ".local/share/containers/storage/overlay/*/diff"),
+}
+
 var ktool = keytool{
 	javahome: os.Getenv("JAVA_HOME"),
 	javaInstallPaths: []string{
@@ -129,3 +129,129 @@ func TestStoreJava__info(t *testing.T) {
 		t.Error("blank Version")
 	}
 }
+
+func TestStoreJava__FindJavaKeystores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-java")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir, _ = filepath.EvalSymlinks(dir)
+
+	write := func(rel string, body []byte) string {
+		where := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(where), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(where, body, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return where
+	}
+	jdk8 := write("jdk8/jre/lib/security/cacerts", []byte("A"))
+	jdk11 := write("jdk11/lib/security/cacerts", []byte("B"))
+	write("empty/lib/security/cacerts", nil)
+	write("jdk11/lib/security/other", []byte("C"))
+
+	// linked to a shared keystore
+	link := filepath.Join(dir, "jdk12", "lib", "security", "cacerts")
+	if err := os.MkdirAll(filepath.Dir(link), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(jdk11, link); err != nil {
+		t.Skipf("can't create symlink: %v", err)
+	}
+
+	found, err := FindJavaKeystores([]string{dir, filepath.Join(dir, "missing")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || found[0] != jdk11 || found[1] != jdk8 {
+		t.Errorf("got %q", found)
+	}
+
+	s, ok := javaKeystoreFor("java:" + jdk8)
+	if !ok {
+		t.Fatal("expected java keystore store")
+	}
+	if s.GetInfo().Location != jdk8 {
+		t.Errorf("got %q", s.GetInfo().Location)
+	}
+	if _, ok := javaKeystoreFor("java:"); ok {
+		t.Error("expected no store without a path")
+	}
+}
+
+func TestStoreJava__parseKeytoolList(t *testing.T) {
+	sha1 := []string{"a8985d3a65e5e5c4b2d7d66d40c6dd2fb19c5436", "cabd2a79a1076a31f21d253635cb039d4329a5e8"}
+	sha256 := []string{
+		"4348a0e9444c78cb265e058d5e8944b4d84f9662bd26db257f8934a443c70161",
+		"96bcec06264976f37460779acf28c5a7cfe8a3c0aae11a8ffcee05c0bddf08c6",
+	}
+	cases := []struct {
+		fixture string
+		sha1    []string
+		sha256  []string
+	}{
+		{"keytool-list-java8.txt", sha1, nil},
+		{"keytool-list-java11.txt", nil, sha256},
+		{"keytool-list-java11-fr.txt", nil, sha256},
+		{"keytool-list-java11-ja.txt", nil, sha256},
+		{"keytool-list-java17-de.txt", nil, sha256},
+	}
+	for _, tc := range cases {
+		out, err := ioutil.ReadFile(filepath.Join("../../testdata/exec", tc.fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs, err := parseKeytoolList(out)
+		if err != nil {
+			t.Errorf("%s: %v", tc.fixture, err)
+			continue
+		}
+		if len(certs) != 2 {
+			t.Errorf("%s: got %d certs", tc.fixture, len(certs))
+			continue
+		}
+		if certs[0].alias != "digicertglobalrootca [jdk]" || certs[1].alias != "letsencryptisrgx1 [jdk]" {
+			t.Errorf("%s: got aliases %q and %q", tc.fixture, certs[0].alias, certs[1].alias)
+		}
+		for i := range certs {
+			if tc.sha1 != nil && certs[i].sha1Fingerprint != tc.sha1[i] {
+				t.Errorf("%s: got SHA1 %s", tc.fixture, certs[i].sha1Fingerprint)
+			}
+			if tc.sha256 != nil && certs[i].sha256Fingerprint != tc.sha256[i] {
+				t.Errorf("%s: got SHA256 %s", tc.fixture, certs[i].sha256Fingerprint)
+			}
+		}
+	}
+
+	// A JVM printing in windows-1252 mangles the alias, but not fingerprints
+	out, err := ioutil.ReadFile("../../testdata/exec/keytool-list-java8-windows-1252.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := parseKeytoolList(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 1 || certs[0].sha1Fingerprint != sha1[0] || certs[0].alias != "zertifikat-m\xfcller" {
+		t.Errorf("got %v", certs)
+	}
+}
+
+func TestStoreJava__parseJavaVersion(t *testing.T) {
+	cases := map[string]string{
+		"java-showsettings-17.txt": "17.0.8",
+		"java-version-8.txt":       "1.8.0_152",
+	}
+	for fixture, expected := range cases {
+		out, err := ioutil.ReadFile(filepath.Join("../../testdata/exec", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := parseJavaVersion(out); v != expected {
+			t.Errorf("%s: got %q", fixture, v)
+		}
+	}
+}
@@ -20,6 +20,21 @@ import (
 	"os"
 )
 
+// javaSearchRoots are walked to find keystores, see FindJavaKeystores
+var javaSearchRoots = []string{
+	`C:\Program Files\Java`,
+	`C:\Program Files (x86)\Java`,
+}
+
+// jlinkRuntimeGlobs match runtimes installed with apps by jpackage
+var jlinkRuntimeGlobs = []string{
+	`C:\Program Files\*\runtime`,
+}
+
+// containerLayerGlobs is empty as windows container images don't use the
+// linux JAVA_HOME paths
+var containerLayerGlobs []string
+
 var ktool = keytool{
 	javahome:              os.Getenv("JAVA_HOME"),
 	javaInstallPaths:      []string{},
@@ -0,0 +1,84 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+var (
+	// keychainUnlock is set by UnlockKeychains, the darwin store then unlocks
+	// the keychains it reads or modifies before using them.
+	keychainUnlock   = false
+	keychainPassword = ""
+
+	// keychainSmartCards is set by IncludeSmartCards, otherwise the darwin
+	// store keeps trust in certificates from smart cards and their issuers.
+	keychainSmartCards = false
+)
+
+// UnlockKeychains makes the darwin store unlock each keychain before it's used.
+// If password is empty `security` prompts for it on the terminal. Other
+// platforms ignore this.
+func UnlockKeychains(password string) {
+	keychainUnlock = true
+	keychainPassword = password
+}
+
+// unlockKeychainInput returns the line `security -i` reads to unlock path
+// with password. It's given on stdin as arguments are visible to anyone
+// running ps.
+func unlockKeychainInput(path, password string) string {
+	quote := func(s string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+	}
+	return fmt.Sprintf("unlock-keychain -p %s %s\n", quote(password), quote(path))
+}
+
+// IncludeSmartCards lets the darwin store remove trust in certificates
+// provided by smart cards and tokens (CryptoTokenKit extensions), and the
+// roots they chain to. These are kept by default as removing them breaks
+// logging in or authenticating with the card. Other platforms ignore this.
+func IncludeSmartCards() {
+	keychainSmartCards = true
+}
+
+// smartCardAnchors returns the SHA256 fingerprints of each token certificate
+// and every issuer in candidates its chain passes through.
+func smartCardAnchors(tokens, candidates []*x509.Certificate) map[string]bool {
+	out := make(map[string]bool)
+	queue := append([]*x509.Certificate{}, tokens...)
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+
+		fp := certutil.GetHexSHA256Fingerprint(*c)
+		if out[fp] {
+			continue
+		}
+		out[fp] = true
+		for i := range candidates {
+			if bytes.Equal(c.RawIssuer, candidates[i].RawSubject) && c.CheckSignatureFrom(candidates[i]) == nil {
+				queue = append(queue, candidates[i])
+			}
+		}
+	}
+	return out
+}
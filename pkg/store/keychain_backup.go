@@ -0,0 +1,214 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/file"
+)
+
+const keychainManifestFile = "manifest.json"
+
+var (
+	// keychainRestore is set by RestoreKeychain, otherwise every keychain in
+	// a darwin backup is restored.
+	keychainRestore = ""
+)
+
+// RestoreKeychain limits darwin restores to one keychain of the backup,
+// given by name (e.g. login or System) or path. Other platforms ignore this.
+func RestoreKeychain(name string) {
+	keychainRestore = name
+}
+
+// keychainManifest describes a darwin backup, which holds a directory of
+// certificates for each keychain.
+type keychainManifest struct {
+	// Home is the home directory of the user the backup was taken as, it's
+	// empty for older backups
+	Home string `json:"home,omitempty"`
+
+	Keychains []keychainBackup `json:"keychains"`
+}
+
+// keychainBackup is one keychain in a backup. TrustSettings is the exported
+// trust settings plist of the keychain's domain (admin for the System
+// keychain, user for the login keychain) and is empty for other keychains.
+type keychainBackup struct {
+	Name          string `json:"name"`
+	Path          string `json:"path"`
+	Dir           string `json:"dir"`
+	TrustSettings string `json:"trustSettings,omitempty"`
+	Certificates  int    `json:"certificates"`
+}
+
+// keychainName is the name of a keychain file, e.g. "login" for
+// ~/Library/Keychains/login.keychain-db
+func keychainName(path string) string {
+	name := filepath.Base(path)
+	name = strings.TrimSuffix(name, "-db")
+	return strings.TrimSuffix(name, ".keychain")
+}
+
+// add records a keychain, its directory is named after the keychain file
+// unless another keychain already uses that name.
+func (m *keychainManifest) add(path string) *keychainBackup {
+	dir := filepath.Base(path)
+	for i := 2; m.hasDir(dir); i++ {
+		dir = fmt.Sprintf("%s-%d", filepath.Base(path), i)
+	}
+	m.Keychains = append(m.Keychains, keychainBackup{
+		Name: keychainName(path),
+		Path: path,
+		Dir:  dir,
+	})
+	return &m.Keychains[len(m.Keychains)-1]
+}
+
+func (m *keychainManifest) hasDir(dir string) bool {
+	for i := range m.Keychains {
+		if m.Keychains[i].Dir == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// selected returns the keychains to restore, all of them unless name is
+// given. Names are matched without case and a path can be given instead.
+func (m *keychainManifest) selected(name string) ([]keychainBackup, error) {
+	if name == "" {
+		return m.Keychains, nil
+	}
+	for i := range m.Keychains {
+		if m.Keychains[i].Path == name {
+			return m.Keychains[i : i+1], nil
+		}
+	}
+	for i := range m.Keychains {
+		if strings.EqualFold(m.Keychains[i].Name, keychainName(name)) {
+			return m.Keychains[i : i+1], nil
+		}
+	}
+	var names []string
+	for i := range m.Keychains {
+		names = append(names, m.Keychains[i].Name)
+	}
+	return nil, fmt.Errorf("keychain %q isn't in the backup, options: %s", name, strings.Join(names, ", "))
+}
+
+// AdaptBackup rewrites a darwin backup taken as another user, or on another
+// machine, so its keychains are restored into the current user's home
+// directory (e.g. when moving to a new laptop). Each keychain which moved is
+// returned as "name: old -> new". Backups of other stores are left alone.
+func AdaptBackup(dir string) ([]string, error) {
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return nil, err
+	}
+	m, err := readKeychainManifest(dir)
+	if err != nil || m == nil {
+		return nil, err // older backups only hold the login keychain, which is always the current user's
+	}
+	changes := m.adapt(file.HomeDir())
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	return changes, writeKeychainManifest(dir, m)
+}
+
+// adapt moves keychains under the home directory of the backup to `home`.
+func (m *keychainManifest) adapt(home string) []string {
+	from := m.Home
+	if from == "" {
+		from = m.guessHome()
+	}
+	if from == "" || home == "" || filepath.Clean(from) == filepath.Clean(home) {
+		return nil
+	}
+	var changes []string
+	for i := range m.Keychains {
+		k := &m.Keychains[i]
+		rel, err := filepath.Rel(from, k.Path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue // e.g. the System keychain
+		}
+		where := existingKeychain(filepath.Join(home, rel))
+		changes = append(changes, fmt.Sprintf("%s: %s -> %s", k.Name, k.Path, where))
+		k.Path = where
+	}
+	m.Home = home
+	return changes
+}
+
+// guessHome returns the home directory of a backup without one recorded,
+// from the first keychain under a ~/Library/Keychains directory.
+func (m *keychainManifest) guessHome() string {
+	dir := string(filepath.Separator) + filepath.Join("Library", "Keychains") + string(filepath.Separator)
+	for i := range m.Keychains {
+		if idx := strings.Index(m.Keychains[i].Path, dir); idx > 0 {
+			return m.Keychains[i].Path[:idx]
+		}
+	}
+	return ""
+}
+
+// existingKeychain returns path, or its "-db" variant when only that exists.
+// Keychains created since Sierra are named login.keychain-db, so a backup
+// from an older install can be restored onto a newer one and the reverse.
+func existingKeychain(path string) string {
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	other := path + "-db"
+	if strings.HasSuffix(path, "-db") {
+		other = strings.TrimSuffix(path, "-db")
+	}
+	if _, err := os.Stat(other); err == nil {
+		return other
+	}
+	return path
+}
+
+func writeKeychainManifest(dir string, m *keychainManifest) error {
+	bs, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, keychainManifestFile), bs, file.TempFilePermissions)
+}
+
+// readKeychainManifest returns the manifest of a darwin backup, which is nil
+// for backups made before keychains were saved separately. Those only hold
+// the login keychain.
+func readKeychainManifest(dir string) (*keychainManifest, error) {
+	bs, err := ioutil.ReadFile(filepath.Join(dir, keychainManifestFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var m keychainManifest
+	if err := json.Unmarshal(bs, &m); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", keychainManifestFile, err)
+	}
+	return &m, nil
+}
@@ -0,0 +1,165 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+)
+
+func TestStoreKeychain__smartCardAnchors(t *testing.T) {
+	h, err := testca.NewHierarchy("piv.example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := testca.NewRoot("Other Root CA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	candidates := []*x509.Certificate{other.Certificate, h.Root.Certificate, h.Intermediate.Certificate}
+	anchors := smartCardAnchors([]*x509.Certificate{h.Leaf}, candidates)
+	if len(anchors) != 3 {
+		t.Errorf("got %d anchors", len(anchors))
+	}
+	for _, c := range h.Chain() {
+		if !anchors[certutil.GetHexSHA256Fingerprint(*c)] {
+			t.Errorf("%s should be kept", c.Subject.CommonName)
+		}
+	}
+	if anchors[certutil.GetHexSHA256Fingerprint(*other.Certificate)] {
+		t.Error("unrelated root shouldn't be kept")
+	}
+
+	if anchors := smartCardAnchors(nil, candidates); len(anchors) != 0 {
+		t.Errorf("got %v", anchors)
+	}
+}
+
+func TestStoreKeychain__manifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-keychains")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// backups made before the manifest
+	m, err := readKeychainManifest(dir)
+	if err != nil || m != nil {
+		t.Fatalf("got %v, err=%v", m, err)
+	}
+
+	m = &keychainManifest{}
+	m.add("/Library/Keychains/System.keychain").TrustSettings = "admin.plist"
+	m.add("/Users/me/Library/Keychains/login.keychain-db").Certificates = 2
+	m.add("/Users/me/work/login.keychain-db")
+	if err := writeKeychainManifest(dir, m); err != nil {
+		t.Fatal(err)
+	}
+	m, err = readKeychainManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Keychains) != 3 {
+		t.Fatalf("got %#v", m.Keychains)
+	}
+	if k := m.Keychains[1]; k.Name != "login" || k.Dir != "login.keychain-db" || k.Certificates != 2 {
+		t.Errorf("got %#v", k)
+	}
+	if k := m.Keychains[2]; k.Dir != "login.keychain-db-2" {
+		t.Errorf("got %#v", k)
+	}
+
+	all, err := m.selected("")
+	if err != nil || len(all) != 3 {
+		t.Errorf("got %d keychains, err=%v", len(all), err)
+	}
+	for _, name := range []string{"system", "System.keychain", "/Library/Keychains/System.keychain"} {
+		ks, err := m.selected(name)
+		if err != nil || len(ks) != 1 || ks[0].TrustSettings != "admin.plist" {
+			t.Errorf("%s: got %#v, err=%v", name, ks, err)
+		}
+	}
+	ks, err := m.selected("/Users/me/work/login.keychain-db")
+	if err != nil || len(ks) != 1 || ks[0].Dir != "login.keychain-db-2" {
+		t.Errorf("got %#v, err=%v", ks, err)
+	}
+	if _, err := m.selected("other"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestStoreKeychain__adapt(t *testing.T) {
+	home, err := ioutil.TempDir("", "cert-manage-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	keychains := filepath.Join(home, "Library", "Keychains")
+	if err := os.MkdirAll(keychains, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// the new machine only has a login.keychain-db
+	if err := ioutil.WriteFile(filepath.Join(keychains, "login.keychain-db"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &keychainManifest{}
+	m.add("/Library/Keychains/System.keychain")
+	m.add("/Users/alice/Library/Keychains/login.keychain")
+	m.add("/Users/alice/work/vpn.keychain")
+	changes := m.adapt(home)
+	if len(changes) != 2 {
+		t.Fatalf("got %q", changes)
+	}
+	if p := m.Keychains[0].Path; p != "/Library/Keychains/System.keychain" {
+		t.Errorf("got %s", p)
+	}
+	if p := m.Keychains[1].Path; p != filepath.Join(keychains, "login.keychain-db") {
+		t.Errorf("got %s", p)
+	}
+	if p := m.Keychains[2].Path; p != filepath.Join(home, "work", "vpn.keychain") {
+		t.Errorf("got %s", p)
+	}
+	if m.Home != home {
+		t.Errorf("got %s", m.Home)
+	}
+
+	// already this user's
+	if changes := m.adapt(home); len(changes) != 0 {
+		t.Errorf("got %q", changes)
+	}
+
+	// the recorded home is used over guessing
+	m = &keychainManifest{Home: "/Users/bob"}
+	m.add("/Users/bob/Library/Keychains/login.keychain-db")
+	m.add("/Users/alice/Library/Keychains/shared.keychain")
+	if changes := m.adapt(home); len(changes) != 1 || m.Keychains[1].Path != "/Users/alice/Library/Keychains/shared.keychain" {
+		t.Errorf("got %q, %#v", changes, m.Keychains)
+	}
+}
+
+func TestStoreKeychain__unlockKeychainInput(t *testing.T) {
+	got := unlockKeychainInput(`/Users/a b/login.keychain`, `pa"ss\word`)
+	if ans := `unlock-keychain -p "pa\"ss\\word" "/Users/a b/login.keychain"` + "\n"; got != ans {
+		t.Errorf("got %q", got)
+	}
+}
@@ -23,13 +23,16 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/adamdecaf/cert-manage/pkg/certutil"
 	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
+	"github.com/adamdecaf/cert-manage/pkg/privilege"
+	"github.com/adamdecaf/cert-manage/pkg/progress"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
 	"github.com/adamdecaf/cert-manage/pkg/whitelist"
 )
 
@@ -45,6 +48,9 @@ type cadir struct {
 
 	// reload/refresh command
 	refresh string
+
+	// file selecting which certs from dir are trusted (optional)
+	conf string
 }
 
 func (ca *cadir) empty() bool {
@@ -64,14 +70,24 @@ var (
 			dir:     "/usr/share/ca-certificates",
 			all:     "/etc/ssl/certs/ca-certificates.crt",
 			refresh: "/usr/sbin/update-ca-certificates",
+			conf:    "/etc/ca-certificates.conf",
 		},
 	}
 
 	linuxBackupDir = "linux"
+
+	// userNSSDB is the per-user NSS shared database read by Chrome and other
+	// apps, it's the user scope of the platform store.
+	userNSSDB = filepath.Join(file.HomeDir(), ".pki/nssdb")
 )
 
+// linuxStore manages the system wide CA bundle (e.g. /etc/ssl/certs) and the
+// user's NSS database, unless limited with SetScope.
 type linuxStore struct {
 	ca cadir
+
+	// user is the NSS database in userNSSDB, nil if there isn't one
+	user Store
 }
 
 func platform() Store {
@@ -83,12 +99,33 @@ func platform() Store {
 		}
 	}
 
-	return linuxStore{
+	s := linuxStore{
 		ca: ca,
 	}
+	if containsCertdb(userNSSDB) {
+		s.user = NssStore("nssdb", "", userNSSDB)
+	}
+	return s
+}
+
+// userStore returns the user's NSS database, or an error if there isn't one
+func (s linuxStore) userStore() (Store, error) {
+	if s.user == nil {
+		return nil, fmt.Errorf("no NSS database found in %s", userNSSDB)
+	}
+	return s.user, nil
 }
 
+// Add installs certificates into the system CA bundle, or the user's NSS
+// database with the user scope.
 func (s linuxStore) Add(certs []*x509.Certificate) error {
+	if scope == ScopeUser {
+		user, err := s.userStore()
+		if err != nil {
+			return err
+		}
+		return user.Add(certs)
+	}
 	if s.ca.empty() {
 		return errors.New("unable to find certificate directory")
 	}
@@ -100,9 +137,10 @@ func (s linuxStore) Add(certs []*x509.Certificate) error {
 
 		err := certutil.ToFile(path, certs[i:i+1])
 		if err != nil {
-			return err
+			return securityError(path, err)
 		}
 	}
+	relabel(s.ca.add)
 
 	if len(certs) > 0 {
 		return s.rebundleCerts()
@@ -112,15 +150,36 @@ func (s linuxStore) Add(certs []*x509.Certificate) error {
 
 // Backup takes a snapshot of the current set of CA certificates and
 // saves them to another location. It will overwrite any previous backup.
+//
+// The user's NSS database is backed up too when it's in scope, but it's only
+// restored with the user scope.
 func (s linuxStore) Backup() error {
-	dir, err := getCertManageDir(fmt.Sprintf("%s/%d", linuxBackupDir, time.Now().Unix()))
+	if inScope(ScopeUser) && s.user != nil {
+		if err := s.user.Backup(); err != nil {
+			return err
+		}
+	}
+	if !inScope(ScopeSystem) {
+		return nil
+	}
+	dir, err := getCertManageDir(linuxBackupDir + "/" + timeutil.Stamp(time.Now()))
 	if err != nil {
 		return err
 	}
-	return file.MirrorDir(s.ca.dir, dir)
+	if err := file.MirrorDir(s.ca.dir, dir); err != nil {
+		return err
+	}
+	return s.backupConf(dir)
 }
 
 func (s linuxStore) GetLatestBackup() (string, error) {
+	if scope == ScopeUser {
+		user, err := s.userStore()
+		if err != nil {
+			return "", err
+		}
+		return user.GetLatestBackup()
+	}
 	dir, err := getCertManageDir(linuxBackupDir)
 	if err != nil {
 		return "", fmt.Errorf("GetLatestBackup: error getting linux backup directory, err=%v", err)
@@ -129,7 +188,7 @@ func (s linuxStore) GetLatestBackup() (string, error) {
 }
 
 func (s linuxStore) uname(args ...string) string {
-	out, err := exec.Command("uname", args...).CombinedOutput()
+	out, err := interrupt.Command("uname", args...).CombinedOutput()
 	if err != nil {
 		return ""
 	}
@@ -137,17 +196,67 @@ func (s linuxStore) uname(args ...string) string {
 }
 
 func (s linuxStore) GetInfo() *Info {
+	var locations []string
+	if inScope(ScopeSystem) {
+		locations = append(locations, s.ca.all)
+	}
+	if inScope(ScopeUser) && s.user != nil {
+		locations = append(locations, userNSSDB)
+	}
+	writable := !s.ca.empty()
+	if scope == ScopeUser {
+		writable = s.user != nil
+	}
 	return &Info{
-		Name:    s.uname("-o"), // GNU/Linux,
-		Version: s.uname("-r"), // 4.9.60-linuxkit-aufs
+		Name:     s.uname("-o"), // GNU/Linux,
+		Version:  s.Version(),
+		Location: strings.Join(locations, ", "),
+		Writable: writable,
+	}
+}
+
+func (s linuxStore) Version() string {
+	return s.uname("-r") // 4.9.60-linuxkit-aufs
+}
+
+// List returns the x509 Certificates trusted on a Linux system, along with
+// those trusted by the user's NSS database.
+//
+// The NSS database is read with crtutil, if that fails the system's
+// certificates are returned with a *PartialError.
+func (s linuxStore) List(opts *ListOptions) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	if inScope(ScopeSystem) {
+		found, err := s.listBundle()
+		if err != nil {
+			return nil, err
+		}
+		certs = found
+	}
+	if !inScope(ScopeUser) || s.user == nil {
+		return certs, nil
+	}
+
+	if opts == nil {
+		opts = &ListOptions{Trusted: true}
+	}
+	found, err := s.user.List(opts)
+	if err != nil {
+		if scope == ScopeUser {
+			return nil, err
+		}
+		perr := &PartialError{}
+		perr.add(userNSSDB, err)
+		return certs, perr
 	}
+	return certutil.Dedup(append(certs, found...)), nil
 }
 
-// List returns the x509 Certificates trusted on a Linux system
+// listBundle reads the system's CA bundle
 //
 // Note: Linux does not offer support for "untrusting" a certificate
 // it must be removed instead.
-func (s linuxStore) List(_ *ListOptions) ([]*x509.Certificate, error) {
+func (s linuxStore) listBundle() ([]*x509.Certificate, error) {
 	if s.ca.empty() {
 		return nil, nil
 	}
@@ -172,19 +281,60 @@ func (s linuxStore) List(_ *ListOptions) ([]*x509.Certificate, error) {
 // Steps
 // 1. Walk through the dir (/etc/ssl/certs/) and chmod 000 the certs we aren't trusting
 // 2. Run `update-ca-certificates` to re-create the ca-certificates.crt file
+//
+// When there's a ca-certificates.conf the untrusted certs are deactivated there
+// instead, see removeWithConf.
+//
+// Certificates in the user's NSS database are distrusted too, when in scope.
 func (s linuxStore) Remove(wh whitelist.Whitelist) error {
-	// Check each CA cert file and optionally disable
+	var err error
+	if inScope(ScopeSystem) {
+		err = s.removeFromBundle(wh)
+		if _, partial := IsPartial(err); err != nil && !partial {
+			return err
+		}
+	}
+	if !inScope(ScopeUser) || s.user == nil {
+		return err
+	}
+
+	if uerr := s.user.Remove(wh); uerr != nil {
+		if scope == ScopeUser {
+			return uerr
+		}
+		perr, ok := IsPartial(err)
+		if !ok {
+			perr = &PartialError{}
+		}
+		perr.add(userNSSDB, uerr)
+		return perr
+	}
+	return err
+}
+
+func (s linuxStore) removeFromBundle(wh whitelist.Whitelist) error {
+	if s.ca.hasConf() {
+		return s.removeWithConf(wh)
+	}
+
+	// Check each CA cert file and optionally disable, files which can't be
+	// read or written are reported after the others are processed.
+	perr := &PartialError{}
+	bar := progress.New("Applying whitelist", 0)
+	defer bar.Done()
 	walk := func(path string, info os.FileInfo, err error) error {
 		// Ignore SkipDir and directories
 		if (err != nil && err != filepath.SkipDir) || info.IsDir() {
 			return nil
 		}
+		bar.Increment()
 
 		// read the cert(s) contained at the file and only keep those
 		// that aren't removable
 		read, err := certutil.FromFile(path)
 		if err != nil {
-			return err
+			perr.add(path, err)
+			return nil
 		}
 		for i := 0; i < len(read); i++ {
 			// Remove the cert if we don't match
@@ -199,7 +349,7 @@ func (s linuxStore) Remove(wh whitelist.Whitelist) error {
 		// otherwise, write kept certs from `read` back
 		err = certutil.ToFile(path, read)
 		if err != nil {
-			return err
+			perr.add(path, securityError(path, err))
 		}
 
 		return nil
@@ -211,29 +361,50 @@ func (s linuxStore) Remove(wh whitelist.Whitelist) error {
 		return err
 	}
 
-	return s.rebundleCerts()
+	if err := s.rebundleCerts(); err != nil {
+		return err
+	}
+	return perr.orNil()
 }
 
+// Restore brings back the system's CA certificates, or the user's NSS database
+// with the user scope.
 func (s linuxStore) Restore(where string) error {
-	dir, err := s.GetLatestBackup()
-	if err != nil {
-		return err
+	if scope == ScopeUser {
+		user, err := s.userStore()
+		if err != nil {
+			return err
+		}
+		return user.Restore(where)
+	}
+	dir := where
+	if dir == "" {
+		latest, err := s.GetLatestBackup()
+		if err != nil {
+			return err
+		}
+		dir = latest
 	}
 	if debug {
 		fmt.Printf("store/linux: restoring from backup dir %s\n", dir)
 	}
 
-	// Remove the current dir
+	// Remove the current dir, keeping its SELinux labels as the copies
+	// would otherwise be labeled like our backup dir.
+	labels := selinuxContexts(s.ca.dir)
 	if file.Exists(s.ca.dir) {
 		err := os.RemoveAll(s.ca.dir)
 		if err != nil && !os.IsNotExist(err) {
-			return err
+			return securityError(s.ca.dir, err)
 		}
 	}
 
 	// Restore
-	err = file.MirrorDir(dir, s.ca.dir)
-	if err != nil {
+	if err := file.MirrorDir(dir, s.ca.dir); err != nil {
+		return err
+	}
+	setSELinuxContexts(s.ca.dir, labels)
+	if err := s.restoreConf(); err != nil {
 		return err
 	}
 	return s.rebundleCerts()
@@ -243,10 +414,12 @@ func (s linuxStore) Restore(where string) error {
 func (s linuxStore) rebundleCerts() error {
 	var out bytes.Buffer
 
-	cmd := exec.Command("sudo", s.ca.refresh)
-	if os.Getuid() == 0 {
-		// drop sudo if we're already root
-		cmd = exec.Command(s.ca.refresh)
+	cmd, err := privilege.Command(s.ca.refresh)
+	if err == privilege.ErrSkipped {
+		return nil // reported after we're done
+	}
+	if err != nil {
+		return fmt.Errorf("error updating trust status: err=%v", err)
 	}
 	cmd.Stdout = &out
 
@@ -254,7 +427,7 @@ func (s linuxStore) rebundleCerts() error {
 		fmt.Println("store/linux: updated CA certificates")
 	}
 
-	err := cmd.Run()
+	err = cmd.Run()
 	if err != nil {
 		return fmt.Errorf("error updating trust status: err=%v, out=%s", err, out.String())
 	}
@@ -0,0 +1,131 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build linux
+
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+// caConfBackupName is where ca-certificates.conf is kept inside a backup of
+// the ca dir, Restore moves it back into place.
+const caConfBackupName = ".ca-certificates.conf"
+
+// hasConf returns true if certificates are selected by a ca-certificates.conf
+// file, as on Debian and Ubuntu.
+func (ca *cadir) hasConf() bool {
+	return ca.conf != "" && file.Exists(ca.conf)
+}
+
+// removeWithConf deactivates certificates by prefixing their entry in
+// ca-certificates.conf with "!". This is how Debian expects certificates to be
+// distrusted and, unlike deleting the files, survives package upgrades.
+func (s linuxStore) removeWithConf(wh whitelist.Whitelist) error {
+	bs, err := ioutil.ReadFile(s.ca.conf)
+	if err != nil {
+		return securityError(s.ca.conf, err)
+	}
+
+	perr := &PartialError{}
+	lines := strings.Split(string(bs), "\n")
+	changed := false
+	for i := range lines {
+		entry := strings.TrimSpace(lines[i])
+		if entry == "" || strings.HasPrefix(entry, "#") || strings.HasPrefix(entry, "!") {
+			continue
+		}
+		path := filepath.Join(s.ca.dir, entry)
+		certs, err := certutil.FromFile(path)
+		if err != nil {
+			perr.add(path, err)
+			continue
+		}
+		for j := range certs {
+			if !wh.Matches(certs[j]) {
+				if debug {
+					fmt.Printf("store/linux: deactivating %s in %s\n", entry, s.ca.conf)
+				}
+				lines[i] = "!" + entry
+				changed = true
+				break
+			}
+		}
+	}
+
+	if changed {
+		if err := s.writeConf([]byte(strings.Join(lines, "\n"))); err != nil {
+			return securityError(s.ca.conf, err)
+		}
+	}
+	if err := s.rebundleCerts(); err != nil {
+		return err
+	}
+	return perr.orNil()
+}
+
+// writeConf replaces ca-certificates.conf, which is usually owned by root, so
+// it's written to a temp file and copied over with escalation if needed.
+func (s linuxStore) writeConf(bs []byte) error {
+	tmp, err := ioutil.TempFile("", "cert-manage-ca-conf")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bs); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return file.SudoCopyFile(tmp.Name(), s.ca.conf)
+}
+
+// backupConf saves ca-certificates.conf alongside the ca dir's backup
+func (s linuxStore) backupConf(dir string) error {
+	if !s.ca.hasConf() {
+		return nil
+	}
+	return file.CopyFile(s.ca.conf, filepath.Join(dir, caConfBackupName))
+}
+
+// restoreConf moves ca-certificates.conf from a restored ca dir back into place
+func (s linuxStore) restoreConf() error {
+	where := filepath.Join(s.ca.dir, caConfBackupName)
+	if s.ca.conf == "" || !file.Exists(where) {
+		return nil
+	}
+	current, _ := ioutil.ReadFile(s.ca.conf)
+	saved, err := ioutil.ReadFile(where)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, saved) {
+		if err := file.SudoCopyFile(where, s.ca.conf); err != nil {
+			return securityError(s.ca.conf, err)
+		}
+	}
+	return os.Remove(where)
+}
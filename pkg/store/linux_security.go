@@ -0,0 +1,162 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build linux
+
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/adamdecaf/cert-manage/pkg/privilege"
+)
+
+const selinuxXattr = "security.selinux"
+
+var (
+	selinuxEnforceFile  = "/sys/fs/selinux/enforce"
+	apparmorCurrentFile = "/proc/self/attr/current"
+
+	geteuid = os.Geteuid
+)
+
+// selinuxEnabled returns true if SELinux is loaded, in either permissive or enforcing mode
+func selinuxEnabled() bool {
+	_, err := os.Stat(selinuxEnforceFile)
+	return err == nil
+}
+
+func selinuxEnforcing() bool {
+	bs, err := ioutil.ReadFile(selinuxEnforceFile)
+	return err == nil && strings.TrimSpace(string(bs)) == "1"
+}
+
+// apparmorProfile returns the AppArmor profile we're confined by, or an
+// empty string if we're unconfined or AppArmor isn't loaded.
+func apparmorProfile() string {
+	bs, err := ioutil.ReadFile(apparmorCurrentFile)
+	if err != nil {
+		return ""
+	}
+	// e.g. "unconfined" or "/usr/bin/cert-manage (enforce)"
+	profile := strings.TrimSpace(strings.TrimRight(string(bs), "\x00"))
+	if profile == "" || profile == "unconfined" {
+		return ""
+	}
+	if idx := strings.LastIndex(profile, " ("); idx > 0 {
+		if !strings.HasSuffix(profile, "(enforce)") {
+			return "" // complain mode only logs denials
+		}
+		profile = profile[:idx]
+	}
+	return profile
+}
+
+// securityError explains a permission error on path when it was denied by
+// SELinux or AppArmor rather than file modes. Only root is checked as other
+// users are usually refused by the file modes themselves.
+func securityError(path string, err error) error {
+	if err == nil || !os.IsPermission(err) || geteuid() != 0 {
+		return err
+	}
+	if selinuxEnforcing() {
+		return fmt.Errorf("%v: denied by SELinux, check 'ausearch -m avc -ts recent' and relabel with 'restorecon -Rv %s'", err, filepath.Dir(path))
+	}
+	if profile := apparmorProfile(); profile != "" {
+		return fmt.Errorf("%v: denied by AppArmor profile %s, allow '%s/** rw,' in the profile or run 'aa-complain %s'", err, profile, filepath.Dir(path), profile)
+	}
+	return err
+}
+
+// selinuxContexts reads the SELinux label of each file under dir, keyed by
+// their path relative to dir.
+func selinuxContexts(dir string) map[string]string {
+	labels := make(map[string]string)
+	if !selinuxEnabled() {
+		return labels
+	}
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		buf := make([]byte, 256)
+		n, err := syscall.Getxattr(path, selinuxXattr, buf)
+		if err != nil || n <= 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err == nil {
+			labels[rel] = string(buf[:n])
+		}
+		return nil
+	})
+	return labels
+}
+
+// setSELinuxContexts writes labels read by selinuxContexts back onto the
+// files under dir, files which didn't exist before are relabeled with
+// restorecon.
+func setSELinuxContexts(dir string, labels map[string]string) {
+	if !selinuxEnabled() {
+		return
+	}
+	missing := false
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		label, ok := labels[rel]
+		if !ok {
+			missing = true
+			return nil
+		}
+		if err := syscall.Setxattr(path, selinuxXattr, []byte(label), 0); err != nil {
+			missing = true
+			if debug {
+				fmt.Printf("store/linux: error setting SELinux context on %s: %v\n", path, err)
+			}
+		}
+		return nil
+	})
+	if missing {
+		relabel(dir)
+	}
+}
+
+// relabel resets the SELinux labels under dir to the system's defaults
+func relabel(dir string) {
+	if !selinuxEnabled() {
+		return
+	}
+	if _, err := exec.LookPath("restorecon"); err != nil {
+		if debug {
+			fmt.Printf("store/linux: restorecon not found, SELinux contexts of %s might be wrong\n", dir)
+		}
+		return
+	}
+	cmd, err := privilege.Command("restorecon", "-R", dir)
+	if err == nil {
+		err = cmd.Run()
+	}
+	if err != nil && debug {
+		fmt.Printf("store/linux: error running restorecon on %s: %v\n", dir, err)
+	}
+}
@@ -17,8 +17,17 @@
 package store
 
 import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
 )
 
 func TestStoreLinux__cadir(t *testing.T) {
@@ -31,3 +40,178 @@ func TestStoreLinux__cadir(t *testing.T) {
 		t.Errorf("no cadir found on platform: %s", runtime.GOOS)
 	}
 }
+
+func TestStoreLinux__securityError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	enforce, current := selinuxEnforceFile, apparmorCurrentFile
+	defer func() {
+		selinuxEnforceFile, apparmorCurrentFile, geteuid = enforce, current, os.Geteuid
+	}()
+	selinuxEnforceFile = filepath.Join(dir, "enforce")
+	apparmorCurrentFile = filepath.Join(dir, "current")
+	geteuid = func() int { return 0 }
+
+	perm := &os.PathError{Op: "open", Path: "/usr/share/ca-certificates/a.crt", Err: os.ErrPermission}
+
+	// neither loaded
+	if err := securityError(perm.Path, perm); err != perm {
+		t.Errorf("got %v", err)
+	}
+
+	// AppArmor in complain mode doesn't deny
+	ioutil.WriteFile(apparmorCurrentFile, []byte("/usr/bin/cert-manage (complain)\n"), 0644)
+	if err := securityError(perm.Path, perm); err != perm {
+		t.Errorf("got %v", err)
+	}
+	ioutil.WriteFile(apparmorCurrentFile, []byte("/usr/bin/cert-manage (enforce)\n"), 0644)
+	if err := securityError(perm.Path, perm); err == nil || !strings.Contains(err.Error(), "aa-complain /usr/bin/cert-manage") {
+		t.Errorf("got %v", err)
+	}
+
+	ioutil.WriteFile(selinuxEnforceFile, []byte("1"), 0644)
+	if err := securityError(perm.Path, perm); err == nil || !strings.Contains(err.Error(), "restorecon -Rv /usr/share/ca-certificates") {
+		t.Errorf("got %v", err)
+	}
+
+	// other errors and non-root users are left alone
+	other := errors.New("other")
+	if err := securityError(perm.Path, other); err != other {
+		t.Errorf("got %v", err)
+	}
+	geteuid = func() int { return 1000 }
+	if err := securityError(perm.Path, perm); err != perm {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestStoreLinux__conf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	caDir := filepath.Join(dir, "ca-certificates")
+	for i, name := range []string{"a.crt", "b.crt", "c.crt"} {
+		if err := os.MkdirAll(filepath.Join(caDir, "mozilla"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := certutil.ToFile(filepath.Join(caDir, "mozilla", name), certs[i:i+1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conf := filepath.Join(dir, "ca-certificates.conf")
+	original := "# comment\nmozilla/a.crt\nmozilla/b.crt\n!mozilla/c.crt\n"
+	if err := ioutil.WriteFile(conf, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := linuxStore{
+		ca: cadir{dir: caDir, conf: conf, refresh: "true"},
+	}
+	if !s.ca.hasConf() {
+		t.Fatal("expected conf")
+	}
+
+	// keep a copy as Backup would
+	backup := filepath.Join(dir, "backup")
+	if err := os.MkdirAll(backup, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.backupConf(backup); err != nil {
+		t.Fatal(err)
+	}
+
+	// only trust b.crt and c.crt, c.crt stays deactivated
+	if err := s.Remove(whitelist.FromCertificates(certs[1:3])); err != nil {
+		t.Fatal(err)
+	}
+	bs, _ := ioutil.ReadFile(conf)
+	if v := string(bs); v != "# comment\n!mozilla/a.crt\nmozilla/b.crt\n!mozilla/c.crt\n" {
+		t.Errorf("got %q", v)
+	}
+	if _, err := certutil.FromFile(filepath.Join(caDir, "mozilla", "a.crt")); err != nil {
+		t.Errorf("a.crt was modified: %v", err)
+	}
+
+	// restore the conf
+	if err := file.CopyFile(filepath.Join(backup, caConfBackupName), filepath.Join(caDir, caConfBackupName)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.restoreConf(); err != nil {
+		t.Fatal(err)
+	}
+	bs, _ = ioutil.ReadFile(conf)
+	if string(bs) != original {
+		t.Errorf("got %q", string(bs))
+	}
+	if file.Exists(filepath.Join(caDir, caConfBackupName)) {
+		t.Error("backup of conf left in ca dir")
+	}
+}
+
+func TestStoreLinux__scope(t *testing.T) {
+	defer SetScope(ScopeAll)
+
+	dir, err := ioutil.TempDir("", "cert-manage-linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := filepath.Join(dir, "ca-certificates.crt")
+	if err := certutil.ToFile(bundle, certs[:2]); err != nil {
+		t.Fatal(err)
+	}
+	s := linuxStore{
+		ca:   cadir{all: bundle},
+		user: newMemoryStore(certs[1:3]),
+	}
+
+	expected := map[string]int{ScopeAll: 3, ScopeSystem: 2, ScopeUser: 2}
+	for sc, n := range expected {
+		if err := SetScope(sc); err != nil {
+			t.Fatal(err)
+		}
+		found, err := s.List(&ListOptions{Trusted: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != n {
+			t.Errorf("%s: got %d certificates, expected %d", sc, len(found), n)
+		}
+	}
+
+	// the user scope only modifies the NSS database
+	if err := SetScope(ScopeUser); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove(whitelist.FromCertificates(certs[2:3])); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := s.user.List(nil); len(found) != 1 {
+		t.Errorf("got %d certificates in NSS database", len(found))
+	}
+	if found, _ := certutil.FromFile(bundle); len(found) != 2 {
+		t.Errorf("got %d certificates in bundle", len(found))
+	}
+
+	// without an NSS database the user scope has nothing to modify
+	s.user = nil
+	if err := s.Add(certs[:1]); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+// memoryStore is a Store held entirely in memory, it has the same List, Remove,
+// Backup and Restore semantics as the other stores without touching the system.
+//
+// Backups are kept in memory and named "memory:<n>".
+type memoryStore struct {
+	mu      *sync.Mutex
+	certs   *[]*x509.Certificate
+	backups *[][]*x509.Certificate
+}
+
+// MemoryStore returns a Store containing certs, which is only kept in memory
+func MemoryStore(certs []*x509.Certificate) Store {
+	return newMemoryStore(certs)
+}
+
+func newMemoryStore(certs []*x509.Certificate) memoryStore {
+	s := memoryStore{
+		mu:      &sync.Mutex{},
+		certs:   &[]*x509.Certificate{},
+		backups: &[][]*x509.Certificate{},
+	}
+	s.add(certs)
+	return s
+}
+
+func (s memoryStore) GetInfo() *Info {
+	return &Info{
+		Name:     "Memory",
+		Writable: true,
+	}
+}
+
+func (s memoryStore) Version() string {
+	return ""
+}
+
+func (s memoryStore) List(_ *ListOptions) ([]*x509.Certificate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*x509.Certificate(nil), *s.certs...), nil
+}
+
+func (s memoryStore) Add(certs []*x509.Certificate) error {
+	s.add(certs)
+	return nil
+}
+
+// add includes each certificate which isn't already in the store
+func (s memoryStore) add(certs []*x509.Certificate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pool := certutil.Pool{}
+	pool.AddCertificates(*s.certs)
+	pool.AddCertificates(certs)
+	*s.certs = pool.GetCertificates()
+}
+
+func (s memoryStore) Remove(wh whitelist.Whitelist) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var kept []*x509.Certificate
+	matches := wh.MatchEach(*s.certs)
+	for i := range *s.certs {
+		if matches[i] {
+			kept = append(kept, (*s.certs)[i])
+		}
+	}
+	*s.certs = kept
+	return nil
+}
+
+func (s memoryStore) Backup() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*s.backups = append(*s.backups, append([]*x509.Certificate(nil), *s.certs...))
+	return nil
+}
+
+func (s memoryStore) GetLatestBackup() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(*s.backups) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("memory:%d", len(*s.backups)), nil
+}
+
+// backupNames returns the name of each backup, oldest first
+func (s memoryStore) backupNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]string, len(*s.backups))
+	for i := range out {
+		out[i] = fmt.Sprintf("memory:%d", i+1)
+	}
+	return out
+}
+
+// Restore replaces the certificates with a backup, the latest if `where` is empty
+func (s memoryStore) Restore(where string) error {
+	if where == "" {
+		latest, err := s.GetLatestBackup()
+		if err != nil {
+			return err
+		}
+		where = latest
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, err := strconv.Atoi(strings.TrimPrefix(where, "memory:"))
+	if err != nil || n < 1 || n > len(*s.backups) {
+		return fmt.Errorf("memory backup %q not found", where)
+	}
+	*s.certs = append([]*x509.Certificate(nil), (*s.backups)[n-1]...)
+	return nil
+}
+
+// listBackup returns the certificates of an in-memory backup
+func (s memoryStore) listBackup(where string) ([]*x509.Certificate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, err := strconv.Atoi(strings.TrimPrefix(where, "memory:"))
+	if err != nil || n < 1 || n > len(*s.backups) {
+		return nil, fmt.Errorf("memory backup %q not found", where)
+	}
+	return append([]*x509.Certificate(nil), (*s.backups)[n-1]...), nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+func TestStoreMemory(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := MemoryStore(certs[:2])
+
+	// duplicates aren't added twice
+	if err := s.Add(certs[1:3]); err != nil {
+		t.Fatal(err)
+	}
+	found, _ := s.List(nil)
+	if len(found) != 3 {
+		t.Fatalf("got %d certs", len(found))
+	}
+
+	// no backup yet
+	if latest, _ := s.GetLatestBackup(); latest != "" {
+		t.Errorf("unexpected backup %q", latest)
+	}
+	if err := s.Backup(); err != nil {
+		t.Fatal(err)
+	}
+	latest, _ := s.GetLatestBackup()
+	if latest != "memory:1" {
+		t.Errorf("got %q", latest)
+	}
+	backups, _ := GetBackups(s)
+	if len(backups) != 1 || backups[0] != latest {
+		t.Errorf("got %v", backups)
+	}
+
+	// only keep the first certificate
+	if err := s.Remove(whitelist.FromCertificates(certs[:1])); err != nil {
+		t.Fatal(err)
+	}
+	found, _ = s.List(nil)
+	if len(found) != 1 || !found[0].Equal(certs[0]) {
+		t.Fatalf("got %d certs", len(found))
+	}
+
+	inBackup, err := ListBackup(s, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inBackup) != 3 {
+		t.Errorf("got %d certs in backup", len(inBackup))
+	}
+
+	if err := s.Restore(""); err != nil {
+		t.Fatal(err)
+	}
+	found, _ = s.List(nil)
+	if len(found) != 3 {
+		t.Errorf("got %d certs after restore", len(found))
+	}
+	if err := s.Restore("memory:2"); err == nil {
+		t.Error("expected error")
+	}
+}
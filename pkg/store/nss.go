@@ -15,21 +15,23 @@
 package store
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/x509"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/adamdecaf/cert-manage/pkg/certutil"
 	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/progress"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
 	"github.com/adamdecaf/cert-manage/pkg/whitelist"
 )
 
@@ -79,23 +81,46 @@ func NssStore(nssType string, appVersion string, certdbPath string) Store {
 	}
 }
 
+// NSS keeps certificates in either a sqlite (cert9.db) or legacy Berkeley DB
+// (cert8.db) database, which crtutil addresses with a "sql:" or "dbm:" prefix.
+//
+// https://wiki.mozilla.org/NSS_Shared_DB
+const (
+	nssFormatSQL = "sql"
+	nssFormatDBM = "dbm"
+)
+
+// nssDatabaseFiles are the files of each database format, the first holds
+// the certificates.
+var nssDatabaseFiles = map[string][]string{
+	nssFormatSQL: {"cert9.db", "key4.db", "pkcs11.txt"},
+	nssFormatDBM: {"cert8.db", "key3.db", "secmod.db"},
+}
+
+// nssFormat returns the database format used in dir, or an empty string
+// if there isn't a (non-empty) database. sql is preferred when both exist,
+// as that's what NSS migrates to.
+func nssFormat(dir string) string {
+	for _, format := range []string{nssFormatSQL, nssFormatDBM} {
+		fd, err := os.Stat(filepath.Join(dir, nssDatabaseFiles[format][0]))
+		if err == nil && fd.Size() > 0 {
+			return format
+		}
+	}
+	return ""
+}
+
 // Checks if a cert8.db or cert9.db file exists at the given path
 func containsCertdb(where string) bool {
 	if fd, err := os.Stat(where); err != nil || !fd.IsDir() {
 		return false // ignore non-directories
 	}
-	if fd, err := os.Stat(filepath.Join(where, "cert9.db")); !os.IsNotExist(err) {
-		return fd.Size() > 0
-	}
-	if fd, err := os.Stat(filepath.Join(where, "cert8.db")); !os.IsNotExist(err) {
-		return fd.Size() > 0
-	}
-	return false
+	return nssFormat(where) != ""
 }
 
 // NSS apps on cert8.db require being restarted to get the updated set of trustAttrs for each certificate
 func (s nssStore) notifyToRestart() {
-	if strings.Contains(s.foundCertdbLocation, "cert8.db") {
+	if nssFormat(s.foundCertdbLocation) == nssFormatDBM {
 		s.notify.Do(func() {
 			fmt.Printf("Restart %s to refresh certificate trust\n", strings.Title(s.nssType))
 		})
@@ -103,6 +128,9 @@ func (s nssStore) notifyToRestart() {
 }
 
 func (s nssStore) Add(certs []*x509.Certificate) error {
+	if err := waitForProfileUnlock(s.nssType, s.foundCertdbLocation); err != nil {
+		return err
+	}
 	dir, err := ioutil.TempDir("", "cert-manage-nss-add")
 	if err != nil {
 		return err
@@ -133,21 +161,32 @@ func (s nssStore) Add(certs []*x509.Certificate) error {
 	return nil
 }
 
+// Backup copies each file of the database (e.g. cert9.db, key4.db and
+// pkcs11.txt) into a directory.
 func (s nssStore) Backup() error {
-	dir, err := getCertManageDir(s.nssType)
-	if err != nil {
-		return err
-	}
-
 	// Only backup the first nss cert.db path for now
 	if s.foundCertdbLocation == "" {
 		return errors.New("No NSS cert db paths found")
 	}
+	format := nssFormat(s.foundCertdbLocation)
+	if format == "" {
+		return fmt.Errorf("no NSS database found in %s", s.foundCertdbLocation)
+	}
 
-	// Copy file into backup location
-	src := filepath.Join(s.foundCertdbLocation, filepath.Base(s.foundCertdbLocation))
-	dst := filepath.Join(dir, fmt.Sprintf("cert.db-%d", time.Now().Unix()))
-	return file.CopyFile(src, dst)
+	dir, err := getCertManageDir(filepath.Join(s.nssType, "cert.db-"+timeutil.Stamp(time.Now())))
+	if err != nil {
+		return err
+	}
+	for _, name := range nssDatabaseFiles[format] {
+		src := filepath.Join(s.foundCertdbLocation, name)
+		if !file.Exists(src) {
+			continue
+		}
+		if err := file.CopyFile(src, filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s nssStore) GetLatestBackup() (string, error) {
@@ -160,11 +199,17 @@ func (s nssStore) GetLatestBackup() (string, error) {
 
 func (s nssStore) GetInfo() *Info {
 	return &Info{
-		Name:    strings.Title(s.nssType),
-		Version: s.appVersion,
+		Name:     strings.Title(s.nssType),
+		Version:  s.Version(),
+		Location: s.foundCertdbLocation,
+		Writable: s.foundCertdbLocation != "",
 	}
 }
 
+func (s nssStore) Version() string {
+	return s.appVersion
+}
+
 // List returns the installed (and trusted) certificates contained in a NSS cert.db file
 //
 // To list certificates with the NSS `crtutil` tool the following would be ran
@@ -197,15 +242,36 @@ func (s nssStore) Remove(wh whitelist.Whitelist) error {
 	if s.foundCertdbLocation == "" {
 		return errors.New("unable to find NSS db directory")
 	}
+	if err := waitForProfileUnlock(s.nssType, s.foundCertdbLocation); err != nil {
+		return err
+	}
 
 	items, err := cutil.listCertsFromDB(s.foundCertdbLocation)
 	if err != nil {
 		return err
 	}
 
-	// Remove trust from each cert if needed.
+	// Remove trust from each cert if needed. Certificates which fail are
+	// reported after the others are processed.
+	perr := &PartialError{}
+	bar := progress.New("Applying whitelist", len(items))
+	defer bar.Done()
 	for i := range items {
+		bar.Increment()
 		if wh.MatchesAll(items[i].certs) {
+			// restrict trust to the whitelisted usages, if needed
+			if len(items[i].certs) == 0 {
+				continue
+			}
+			usages := wh.AllowedUsages(items[i].certs[0])
+			if usages == nil {
+				continue
+			}
+			defer s.notifyToRestart()
+			err = cutil.modifyTrustAttributes(s.foundCertdbLocation, items[i].nick, nssTrustAttrs(usages))
+			if err != nil {
+				perr.add(fmt.Sprintf("%s (%s)", s.foundCertdbLocation, items[i].nick), err)
+			}
 			continue
 		}
 
@@ -213,29 +279,94 @@ func (s nssStore) Remove(wh whitelist.Whitelist) error {
 		defer s.notifyToRestart()
 		err = cutil.modifyTrustAttributes(s.foundCertdbLocation, items[i].nick, trustAttrsProhibited)
 		if err != nil {
-			return err
+			perr.add(fmt.Sprintf("%s (%s)", s.foundCertdbLocation, items[i].nick), err)
 		}
 	}
-	return nil
+	return perr.orNil()
 }
 
+// Restore copies the database files of a backup over the current database.
+// Backups from before databases were backed up as a directory are a single
+// cert.db file, which is copied over the current cert9.db or cert8.db.
 func (s nssStore) Restore(where string) error {
-	src, err := s.GetLatestBackup()
+	src := where
+	if src == "" {
+		latest, err := s.GetLatestBackup()
+		if err != nil {
+			return err
+		}
+		src = latest
+	}
+	if src == "" {
+		return errors.New("no NSS backup found")
+	}
+	if err := waitForProfileUnlock(s.nssType, s.foundCertdbLocation); err != nil {
+		return err
+	}
+
+	// Queue notification to restart app
+	defer s.notifyToRestart()
+
+	fd, err := os.Stat(src)
 	if err != nil {
 		return err
 	}
+	if !fd.IsDir() {
+		format := nssFormat(s.foundCertdbLocation)
+		if format == "" {
+			format = nssFormatSQL
+		}
+		return file.CopyFile(src, filepath.Join(s.foundCertdbLocation, nssDatabaseFiles[format][0]))
+	}
 
-	// Find filename from src (latest backup)
-	fname := "cert9.db"
-	if _, err := os.Stat(filepath.Join(src, "cert8.db")); !os.IsNotExist(err) {
-		fname = "cert8.db"
+	format := nssFormat(src)
+	if format == "" {
+		return fmt.Errorf("no NSS database found in backup %s", src)
+	}
+	for _, name := range nssDatabaseFiles[format] {
+		from := filepath.Join(src, name)
+		if !file.Exists(from) {
+			continue
+		}
+		if err := file.CopyFile(from, filepath.Join(s.foundCertdbLocation, name)); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	// Queue notification to restart app
-	defer s.notifyToRestart()
+// listBackup reads the trusted certificates of a backed up database
+func (s nssStore) listBackup(where string) ([]*x509.Certificate, error) {
+	if fd, err := os.Stat(where); err != nil || !fd.IsDir() {
+		return nil, fmt.Errorf("unable to read NSS backup %s, only directory backups can be listed", where)
+	}
+	items, err := cutil.listCertsFromDB(where)
+	if err != nil {
+		return nil, err
+	}
+	var out []*x509.Certificate
+	for i := range items {
+		if items[i].trustedForSSL() {
+			out = append(out, items[i].certs...)
+		}
+	}
+	return out, nil
+}
 
-	// Restore the latest backup file
-	return file.CopyFile(src, filepath.Join(s.foundCertdbLocation, fname))
+// nssTrustAttrs returns the SSL,S/MIME,JAR/XPI trust attributes which only
+// keep trust for the given Extended Key Usages.
+func nssTrustAttrs(usages []x509.ExtKeyUsage) string {
+	attrs := []string{"p", "p", "p"}
+	if whitelist.HasUsage(usages, x509.ExtKeyUsageServerAuth) || whitelist.HasUsage(usages, x509.ExtKeyUsageClientAuth) {
+		attrs[0] = "C"
+	}
+	if whitelist.HasUsage(usages, x509.ExtKeyUsageEmailProtection) {
+		attrs[1] = "C"
+	}
+	if whitelist.HasUsage(usages, x509.ExtKeyUsageCodeSigning) {
+		attrs[2] = "C"
+	}
+	return strings.Join(attrs, ",")
 }
 
 // certdbItem represents an x509 Certificate with the NSS trust attributes
@@ -283,12 +414,12 @@ func (c crtutil) getExecPath() (string, error) {
 }
 
 // Different versions of NSS/cert.db files require different prefixes
-// when passed to crtutil.
+// when passed to crtutil, `where` is the directory containing the database.
 func (c crtutil) appendScheme(where string) string {
-	if filepath.Base(where) == "cert9.db" {
-		return "sql:" + where
+	if nssFormat(where) == nssFormatDBM {
+		return "dbm:" + where
 	}
-	return "dbm:" + where
+	return "sql:" + where
 }
 
 // Emulates the following
@@ -305,7 +436,7 @@ func (c crtutil) addCertificate(dir string, where string, nick string) error {
 		"-i", where,
 		"-d", c.appendScheme(dir),
 	}
-	cmd := exec.Command(expath, args...)
+	cmd := commandC(expath, args...)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		if debug {
@@ -331,7 +462,7 @@ func (c crtutil) listCertsFromDB(path string) ([]certdbItem, error) {
 		"-L",
 		"-d", c.appendScheme(path),
 	}
-	cmd := exec.Command(expath, args...)
+	cmd := commandC(expath, args...)
 
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
@@ -346,66 +477,57 @@ func (c crtutil) listCertsFromDB(path string) ([]certdbItem, error) {
 		return nil, err
 	}
 
-	// parse out each 'Certificate Nickname' field
-	// there are some header lines that are either whitespace or contain the following:
-	//
-	// Certificate Nickname                                         Trust Attributes
-	// SSL,S/MIME,JAR/XPI
-	//
 	items := make([]certdbItem, 0)
-	for {
-		// read next line
-		line, err := stdout.ReadString(byte('\n'))
-		if err != nil && err != io.EOF {
-			return nil, err
-		}
-
-		// convert the line into a certdbItem
-		nick, trust := c.parseCertdbItem(line)
-		if nick == "" || trust == "" {
-			if err == io.EOF {
-				break
-			}
-			continue // skip blank lines (headers are returned here as blank)
-		}
-		certs, err := c.readCertificatesForNick(path, nick)
+	for _, item := range parseCertdbList(stdout.Bytes()) {
+		certs, err := c.readCertificatesForNick(path, item.nick)
 		if err != nil {
 			return nil, err
 		}
+		item.certs = certs
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// certdbTrustAttrs matches the trust attributes ending each line of `certutil -L`
+// e.g. "CT,C,C" or ",," (for SSL, S/MIME and JAR/XPI)
+var certdbTrustAttrs = regexp.MustCompile(`^[a-zA-Z]*,[a-zA-Z]*,[a-zA-Z]*$`)
 
+// parseCertdbList reads the nickname and trust attributes of each line of
+// `certutil -L`. There are some header lines that are either whitespace or
+// contain the following, which are skipped as they don't end in trust
+// attributes:
+//
+// Certificate Nickname                                         Trust Attributes
+//                                                              SSL,S/MIME,JAR/XPI
+func parseCertdbList(out []byte) []certdbItem {
+	var items []certdbItem
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		nick, trust := parseCertdbItem(scanner.Text())
+		if nick == "" || !certdbTrustAttrs.MatchString(trust) {
+			continue
+		}
 		items = append(items, certdbItem{
 			nick:       nick,
-			certs:      certs,
 			trustAttrs: trust,
 		})
-
-		// quit if we hit the end
-		if err == io.EOF {
-			break
-		}
 	}
-
-	return items, nil
+	return items
 }
 
-func (c crtutil) parseCertdbItem(line string) (nick string, trust string) {
-	line = strings.TrimSpace(line)
-
-	if len(line) == 0 ||
-		strings.Contains(line, "Certificate Nickname") ||
-		strings.Contains(line, "SSL,S/MIME,JAR/XPI") {
+// parseCertdbItem splits a line of `certutil -L` into its nickname and trust
+// attributes, which are the last field. Examples:
+//
+// DigiCert SHA2 Extended Validation Server CA                  ,,
+// Symantec Class 3 Extended Validation SHA256 SSL CA           CT,C,C
+func parseCertdbItem(line string) (nick string, trust string) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
 		return
 	}
-
-	// Pull out the 'Certificate Nickname'
-	// Examples:
-	// DigiCert SHA2 Extended Validation Server CA                  ,,
-	// Symantec Class 3 Extended Validation SHA256 SSL CA           CT,C,C
-	split := strings.Split(line, " ")
-
-	nick = strings.TrimSpace(strings.Join(split[:len(split)-1], " "))
-	trust = strings.TrimSpace(split[len(split)-1:][0]) // last
-
+	trust = fields[len(fields)-1]
+	nick = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line), trust))
 	return
 }
 
@@ -424,7 +546,7 @@ func (c crtutil) readCertificatesForNick(path string, nick string) ([]*x509.Cert
 		"-d", c.appendScheme(path),
 		"-n", nick,
 	}
-	cmd := exec.Command(expath, args...)
+	cmd := commandC(expath, args...)
 	var stdout bytes.Buffer
 	cmd.Stdout = &stdout
 
@@ -459,7 +581,7 @@ func (c crtutil) modifyTrustAttributes(path string, nick, trustAttrs string) err
 		"-t", trustAttrs,
 		"-d", c.appendScheme(path),
 	}
-	cmd := exec.Command(expath, args...)
+	cmd := commandC(expath, args...)
 	var stdout bytes.Buffer
 	cmd.Stdout = &stdout
 
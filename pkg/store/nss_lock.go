@@ -0,0 +1,69 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var (
+	// lockPromptIn and lockPromptOut are where the retry/skip flow for
+	// locked profiles reads and writes, they're swapped out in tests.
+	lockPromptIn  io.Reader = os.Stdin
+	lockPromptOut io.Writer = os.Stdout
+
+	lockPromptInteractive = func() bool {
+		return isTerminal(os.Stdin)
+	}
+)
+
+// waitForProfileUnlock checks if the profile at dir is in use by a running
+// browser (which holds its certificate database open) and, on a terminal,
+// asks the user to close it and retry or skip the profile. Otherwise an
+// error describing which app needs to be closed is returned.
+func waitForProfileUnlock(app, dir string) error {
+	if dir == "" || !profileLocked(dir) {
+		return nil
+	}
+	name := strings.Title(app)
+	if !lockPromptInteractive() {
+		return fmt.Errorf("%s profile %s is in use, close %s and try again", name, dir, name)
+	}
+
+	r := bufio.NewReader(lockPromptIn)
+	for profileLocked(dir) {
+		fmt.Fprintf(lockPromptOut, "%s profile %s is in use. Close %s and press Enter to retry, or type 'skip': ", name, dir, name)
+		line, err := r.ReadString('\n')
+		if strings.EqualFold(strings.TrimSpace(line), "skip") {
+			return fmt.Errorf("skipped %s profile %s, it is in use", name, dir)
+		}
+		if err != nil {
+			return fmt.Errorf("%s profile %s is in use, close %s and try again", name, dir, name)
+		}
+	}
+	return nil
+}
+
+func isTerminal(f *os.File) bool {
+	s, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return s.Mode()&os.ModeCharDevice != 0
+}
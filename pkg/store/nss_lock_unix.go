@@ -0,0 +1,56 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !windows
+
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// profileLocked checks the lock files a running Firefox (or other NSS app)
+// leaves in its profile directory.
+//
+// On linux "lock" is a symlink to "<ip>:+<pid>", which can be stale after a
+// crash so the pid is checked. ".parentlock" is held with fcntl(2) while the
+// app is running.
+func profileLocked(dir string) bool {
+	if target, err := os.Readlink(filepath.Join(dir, "lock")); err == nil {
+		if idx := strings.LastIndex(target, "+"); idx >= 0 {
+			pid, err := strconv.Atoi(target[idx+1:])
+			if err == nil && pid > 0 && syscall.Kill(pid, 0) == nil {
+				return true
+			}
+		}
+	}
+
+	fd, err := os.Open(filepath.Join(dir, ".parentlock"))
+	if err != nil {
+		return false
+	}
+	defer fd.Close()
+	lk := syscall.Flock_t{
+		Type:   syscall.F_WRLCK,
+		Whence: int16(os.SEEK_SET),
+	}
+	if err := syscall.FcntlFlock(fd.Fd(), syscall.F_GETLK, &lk); err != nil {
+		return false
+	}
+	return lk.Type != syscall.F_UNLCK
+}
@@ -0,0 +1,38 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build windows
+
+package store
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// profileLocked checks if "parent.lock" is held open by a running Firefox
+// (or other NSS app). Firefox opens the file without sharing it, but it's left
+// behind after a crash so only a failed open means the profile is in use.
+func profileLocked(dir string) bool {
+	where := filepath.Join(dir, "parent.lock")
+	if _, err := os.Stat(where); err != nil {
+		return false
+	}
+	fd, err := os.OpenFile(where, os.O_RDWR, 0)
+	if err != nil {
+		return true
+	}
+	fd.Close()
+	return false
+}
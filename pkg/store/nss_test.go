@@ -15,9 +15,14 @@
 package store
 
 import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -66,3 +71,247 @@ func TestStoreNSS_trustedForSSL(t *testing.T) {
 		}
 	}
 }
+
+func TestStoreNSS_trustAttrsForUsages(t *testing.T) {
+	cases := []struct {
+		usages []x509.ExtKeyUsage
+		attrs  string
+	}{
+		{[]x509.ExtKeyUsage{}, "p,p,p"},
+		{[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, "C,p,p"},
+		{[]x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection, x509.ExtKeyUsageCodeSigning}, "p,C,C"},
+	}
+	for i := range cases {
+		if v := nssTrustAttrs(cases[i].usages); v != cases[i].attrs {
+			t.Errorf("got %q, expected %q", v, cases[i].attrs)
+		}
+	}
+}
+
+func TestStoreNSS_format(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nss-format")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if f := nssFormat(dir); f != "" {
+		t.Errorf("expected no format, got %q", f)
+	}
+	if s := cutil.appendScheme(dir); s != "sql:"+dir {
+		t.Errorf("got %q", s)
+	}
+
+	// legacy dbm
+	if err := ioutil.WriteFile(filepath.Join(dir, "cert8.db"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if f := nssFormat(dir); f != nssFormatDBM {
+		t.Errorf("expected dbm, got %q", f)
+	}
+	if s := cutil.appendScheme(dir); s != "dbm:"+dir {
+		t.Errorf("got %q", s)
+	}
+
+	// an empty cert9.db isn't used yet
+	if err := ioutil.WriteFile(filepath.Join(dir, "cert9.db"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if f := nssFormat(dir); f != nssFormatDBM {
+		t.Errorf("expected dbm, got %q", f)
+	}
+
+	// migrated to sqlite
+	if err := ioutil.WriteFile(filepath.Join(dir, "cert9.db"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if f := nssFormat(dir); f != nssFormatSQL {
+		t.Errorf("expected sql, got %q", f)
+	}
+	if s := cutil.appendScheme(dir); s != "sql:"+dir {
+		t.Errorf("got %q", s)
+	}
+}
+
+func TestStoreNSS_backupRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nss-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range nssDatabaseFiles[nssFormatSQL] {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NssStore("nss-backup-test", "", dir).(nssStore)
+	if err := s.Backup(); err != nil {
+		t.Fatal(err)
+	}
+	latest, err := s.GetLatestBackup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(filepath.Dir(latest))
+	if !strings.HasPrefix(filepath.Base(latest), "cert.db-") {
+		t.Errorf("unexpected backup %s", latest)
+	}
+
+	// modify the database and restore
+	for _, name := range nssDatabaseFiles[nssFormatSQL] {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("changed"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Restore(""); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range nssDatabaseFiles[nssFormatSQL] {
+		bs, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(bs) != name {
+			t.Errorf("%s wasn't restored, got %q", name, string(bs))
+		}
+	}
+
+	// a legacy single file backup replaces the certificate database
+	legacy := filepath.Join(dir, "cert.db-1")
+	if err := ioutil.WriteFile(legacy, []byte("legacy"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Restore(legacy); err != nil {
+		t.Fatal(err)
+	}
+	bs, err := ioutil.ReadFile(filepath.Join(dir, "cert9.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bs) != "legacy" {
+		t.Errorf("got %q", string(bs))
+	}
+}
+
+func TestStoreNSS_profileLocked(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("lock symlinks aren't used on windows")
+	}
+
+	dir, err := ioutil.TempDir("", "nss-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if profileLocked(dir) {
+		t.Error("empty profile shouldn't be locked")
+	}
+
+	// Our own pid is running
+	lock := filepath.Join(dir, "lock")
+	if err := os.Symlink(fmt.Sprintf("127.0.1.1:+%d", os.Getpid()), lock); err != nil {
+		t.Fatal(err)
+	}
+	if !profileLocked(dir) {
+		t.Error("expected profile to be locked")
+	}
+
+	// A stale lock, left after a crash
+	os.Remove(lock)
+	if err := os.Symlink("127.0.1.1:+999999999", lock); err != nil {
+		t.Fatal(err)
+	}
+	if profileLocked(dir) {
+		t.Error("stale lock shouldn't lock the profile")
+	}
+
+	// .parentlock without anyone holding it
+	if err := ioutil.WriteFile(filepath.Join(dir, ".parentlock"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if profileLocked(dir) {
+		t.Error("unheld .parentlock shouldn't lock the profile")
+	}
+}
+
+func TestStoreNSS_waitForProfileUnlock(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("lock symlinks aren't used on windows")
+	}
+
+	dir, err := ioutil.TempDir("", "nss-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	lock := filepath.Join(dir, "lock")
+	if err := os.Symlink(fmt.Sprintf("127.0.1.1:+%d", os.Getpid()), lock); err != nil {
+		t.Fatal(err)
+	}
+
+	in, out, interactive := lockPromptIn, lockPromptOut, lockPromptInteractive
+	defer func() {
+		lockPromptIn, lockPromptOut, lockPromptInteractive = in, out, interactive
+	}()
+	var buf bytes.Buffer
+	lockPromptOut = &buf
+
+	// not on a terminal
+	lockPromptInteractive = func() bool { return false }
+	if err := waitForProfileUnlock("firefox", dir); err == nil || !strings.Contains(err.Error(), "close Firefox") {
+		t.Errorf("expected error, got %v", err)
+	}
+
+	// skip
+	lockPromptInteractive = func() bool { return true }
+	lockPromptIn = strings.NewReader("\nskip\n")
+	if err := waitForProfileUnlock("firefox", dir); err == nil || !strings.Contains(err.Error(), "skipped") {
+		t.Errorf("expected skip, got %v", err)
+	}
+	if n := strings.Count(buf.String(), "press Enter to retry"); n != 2 {
+		t.Errorf("expected two prompts, got %d: %q", n, buf.String())
+	}
+
+	// closed after the first prompt
+	buf.Reset()
+	lockPromptIn = &unlockingReader{lock: lock}
+	if err := waitForProfileUnlock("firefox", dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// unlockingReader removes the lock (as if the browser was closed) when read
+type unlockingReader struct {
+	lock string
+}
+
+func (r *unlockingReader) Read(p []byte) (int, error) {
+	os.Remove(r.lock)
+	return copy(p, "\n"), nil
+}
+
+func TestStoreNSS_parseCertdbList(t *testing.T) {
+	out, err := ioutil.ReadFile("../../testdata/exec/certutil-list-nss3.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := parseCertdbList(out)
+	expected := []certdbItem{
+		{nick: "DigiCert SHA2 Extended Validation Server CA", trustAttrs: ",,"},
+		{nick: "Symantec Class 3 Extended Validation SHA256 SSL CA", trustAttrs: ",,"},
+		{nick: "Corporate Proxy Root", trustAttrs: "CT,C,C"},
+		{nick: "Let's Encrypt Authority X3", trustAttrs: ",,"},
+		{nick: "Zertifizierungsstelle Müller GmbH", trustAttrs: "C,,"},
+	}
+	if len(items) != len(expected) {
+		t.Fatalf("got %d items: %v", len(items), items)
+	}
+	for i := range expected {
+		if items[i].nick != expected[i].nick || items[i].trustAttrs != expected[i].trustAttrs {
+			t.Errorf("got %q %q, expected %q %q", items[i].nick, items[i].trustAttrs, expected[i].nick, expected[i].trustAttrs)
+		}
+	}
+}
@@ -18,12 +18,13 @@ import (
 	"crypto/x509"
 	"errors"
 	"fmt"
-	"os/exec"
+	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/adamdecaf/cert-manage/pkg/certutil"
 	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
 	"github.com/adamdecaf/cert-manage/pkg/whitelist"
 )
 
@@ -33,12 +34,6 @@ var (
 		"/usr/local/etc/openssl/certs",       // Darwin/OSX
 		// `C:\Users\etc\openssl\certs`,         // Windows // TODO(adam)
 	}
-
-	openSSLRehashPaths = []string{
-		"/usr/bin/c_rehash",                   // Ubuntu
-		"/usr/local/opt/openssl/bin/c_rehash", // Darwin/OSX
-		// `C:\OpenSSL-Win32\bin\c_rehash`,       // Windows
-	}
 )
 
 type opensslStore struct{}
@@ -77,20 +72,33 @@ func (s opensslStore) GetLatestBackup() (string, error) {
 }
 
 func (s opensslStore) GetInfo() *Info {
-	out, err := exec.Command("openssl", "version").CombinedOutput()
+	name, version := s.nameAndVersion()
+	location, _ := s.findCertPath()
+	return &Info{
+		Name:     name,
+		Version:  version,
+		Location: location,
+		Writable: location != "",
+	}
+}
+
+func (s opensslStore) Version() string {
+	_, version := s.nameAndVersion()
+	return version
+}
+
+func (s opensslStore) nameAndVersion() (string, string) {
+	out, err := interrupt.Command("openssl", "version").CombinedOutput()
 	if err != nil {
-		return &Info{ // just return something non-nil
-			Name: "OpenSSL",
-		}
+		return "OpenSSL", ""
 	}
 
 	// 'LibreSSL 2.2.7' or 'OpenSSL 1.0.2g  1 Mar 2016'
 	parts := strings.Split(string(out), " ")
-
-	return &Info{
-		Name:    strings.TrimSpace(parts[0]),
-		Version: strings.TrimSpace(parts[1]),
+	if len(parts) < 2 {
+		return "OpenSSL", ""
 	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
 }
 
 func (s opensslStore) List(_ *ListOptions) ([]*x509.Certificate, error) {
@@ -115,27 +123,18 @@ func (s opensslStore) findCertPath() (string, error) {
 	return "", errors.New("unable to find openssl cert directory")
 }
 
+// rehash regenerates the hash symlinks OpenSSL uses to find certificates
+// in a -CApath directory, c_rehash isn't needed (e.g. in minimal containers).
 func (s opensslStore) rehash() error {
-	var bin string
-	for i := range openSSLRehashPaths {
-		if file.Exists(openSSLRehashPaths[i]) {
-			bin = openSSLRehashPaths[i]
-			break
-		}
-	}
-	if bin == "" {
-		return errors.New("unable to find openssl c_rehash binary")
-	}
-
-	// run c_rehash
-	cmd := exec.Command(bin)
-	out, err := cmd.CombinedOutput()
+	dir, err := s.findCertPath()
 	if err != nil {
-		if debug {
-			fmt.Printf("store/openssl: Command was: %s\n", strings.Join(cmd.Args, " "))
-			fmt.Printf("store/openssl: Output: %q\n", string(out))
-		}
 		return err
 	}
-	return nil
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return nil // a bundle file, there are no links to update
+	}
+	if debug {
+		fmt.Printf("store/openssl: rehashing %s\n", dir)
+	}
+	return certutil.Rehash(dir)
 }
@@ -0,0 +1,59 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PartialError is returned when some paths of a store (e.g. a locked keychain or
+// an unreadable keystore) failed while the others were still processed. Certificates
+// from the readable paths are returned alongside a PartialError.
+type PartialError struct {
+	Errors []PathError
+}
+
+// PathError holds why a single path in a store failed
+type PathError struct {
+	Path string
+	Err  error
+}
+
+func (e *PartialError) Error() string {
+	var msgs []string
+	for i := range e.Errors {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", e.Errors[i].Path, e.Errors[i].Err))
+	}
+	return fmt.Sprintf("%d path(s) failed: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+func (e *PartialError) add(path string, err error) {
+	e.Errors = append(e.Errors, PathError{Path: path, Err: err})
+}
+
+// orNil returns nil when no paths failed, this avoids returning a typed nil
+func (e *PartialError) orNil() error {
+	if e == nil || len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// IsPartial returns the PartialError of err, if err is one
+func IsPartial(err error) (*PartialError, bool) {
+	pe, ok := err.(*PartialError)
+	return pe, ok
+}
@@ -0,0 +1,49 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStore__PartialError(t *testing.T) {
+	perr := &PartialError{}
+	if err := perr.orNil(); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	var nilErr *PartialError
+	if err := nilErr.orNil(); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+
+	perr.add("/a.keychain", errors.New("locked"))
+	perr.add("/b.keychain", errors.New("permission denied"))
+	err := perr.orNil()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if v := err.Error(); v != "2 path(s) failed: /a.keychain: locked; /b.keychain: permission denied" {
+		t.Errorf("got %q", v)
+	}
+
+	pe, ok := IsPartial(err)
+	if !ok || len(pe.Errors) != 2 {
+		t.Errorf("expected PartialError, got %v", err)
+	}
+	if _, ok := IsPartial(errors.New("other")); ok {
+		t.Error("expected other errors to not be partial")
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
+)
+
+// kSecTrustSettingsResult values, from SecTrustSettings.h
+const (
+	trustSettingsResultInvalid     = 0
+	trustSettingsResultTrustRoot   = 1
+	trustSettingsResultTrustAsRoot = 2
+	trustSettingsResultDeny        = 3
+	trustSettingsResultUnspecified = 4
+)
+
+// emptyTrustSettings is an exported trust settings plist without any
+// certificates, importing it clears a trust settings domain.
+const emptyTrustSettings = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>trustList</key>
+	<dict/>
+	<key>trustVersion</key>
+	<integer>1</integer>
+</dict>
+</plist>
+`
+
+// trustSettings maps the (uppercase hex) SHA1 fingerprint of each certificate
+// in a `security trust-settings-export` plist to its trustItem.
+type trustSettings map[string]trustItem
+
+// trustItem is one certificate's entry in a trust settings plist. results
+// holds the kSecTrustSettingsResult values, one per policy. An empty
+// trustSettings array trusts the certificate as a root for every policy, so
+// it's read as a single TrustRoot result.
+//
+// The plist is keyed by SHA1, so the issuer (DER) and serial number are kept
+// to confirm which certificate an entry is for, as macOS does.
+type trustItem struct {
+	results []int
+	issuer  []byte
+	serial  *big.Int
+}
+
+// matches returns true if the entry is for c, an entry without an issuer
+// or serial number only needs a matching SHA1 fingerprint.
+func (i trustItem) matches(c *x509.Certificate) bool {
+	if len(i.issuer) > 0 && !bytes.Equal(i.issuer, c.RawIssuer) {
+		return false
+	}
+	if i.serial != nil && i.serial.Cmp(c.SerialNumber) != 0 {
+		return false
+	}
+	return true
+}
+
+// denies returns true if the settings have a 'Never Trust' result for any
+// policy of c
+func (t trustSettings) denies(c *x509.Certificate) bool {
+	item, ok := t[strings.ToUpper(certutil.GetHexSHA1Fingerprint(*c))]
+	if !ok || !item.matches(c) {
+		return false
+	}
+	for i := range item.results {
+		if item.results[i] == trustSettingsResultDeny {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustSettings reads the output of `security trust-settings-export`
+func parseTrustSettings(bs []byte) (trustSettings, error) {
+	list, err := parseTrustList(bs)
+	if err != nil {
+		return nil, err
+	}
+	out := make(trustSettings)
+	for fp, entry := range list {
+		var item trustItem
+		e, _ := entry.(map[string]interface{})
+		if issuer, ok := e["issuerName"].([]byte); ok {
+			item.issuer = issuer
+		}
+		if serial, ok := e["serialNumber"].([]byte); ok {
+			item.serial = new(big.Int).SetBytes(serial)
+		}
+		settings, _ := e["trustSettings"].([]interface{})
+		if len(settings) == 0 {
+			item.results = append(item.results, trustSettingsResultTrustRoot)
+		}
+		for i := range settings {
+			setting, _ := settings[i].(map[string]interface{})
+			if n, ok := setting["kSecTrustSettingsResult"].(int64); ok {
+				item.results = append(item.results, int(n))
+			} else {
+				// an entry without a result means "trust as root"
+				item.results = append(item.results, trustSettingsResultTrustRoot)
+			}
+		}
+		out[strings.ToUpper(fp)] = item
+	}
+	return out, nil
+}
+
+// parseTrustList returns the trustList dict of a trust settings plist, keyed
+// by each certificate's SHA1 fingerprint
+func parseTrustList(bs []byte) (map[string]interface{}, error) {
+	v, err := parsePlist(bytes.NewReader(bs))
+	if err != nil {
+		return nil, err
+	}
+	root, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("trust settings plist isn't a dict")
+	}
+	list, _ := root["trustList"].(map[string]interface{})
+	return list, nil
+}
+
+// parsePlist decodes an XML property list into map[string]interface{},
+// []interface{}, string, int64, float64, bool, []byte or time.Time values.
+// Dates which can't be read are kept as their string form.
+func parsePlist(r io.Reader) (interface{}, error) {
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil, errors.New("plist: no value found")
+			}
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local != "plist" {
+			return decodePlistValue(dec, start)
+		}
+	}
+}
+
+func decodePlistValue(dec *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	switch start.Name.Local {
+	case "dict":
+		out := make(map[string]interface{})
+		var key string
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				if t.Name.Local == "key" {
+					if err := dec.DecodeElement(&key, &t); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				v, err := decodePlistValue(dec, t)
+				if err != nil {
+					return nil, err
+				}
+				out[key] = v
+			case xml.EndElement:
+				return out, nil
+			}
+		}
+	case "array":
+		var out []interface{}
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				v, err := decodePlistValue(dec, t)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, v)
+			case xml.EndElement:
+				return out, nil
+			}
+		}
+	case "true", "false":
+		if err := dec.Skip(); err != nil {
+			return nil, err
+		}
+		return start.Name.Local == "true", nil
+	}
+
+	var s string
+	if err := dec.DecodeElement(&s, &start); err != nil {
+		return nil, err
+	}
+	s = strings.TrimSpace(s)
+	switch start.Name.Local {
+	case "string":
+		return s, nil
+	case "date":
+		if t, err := timeutil.ParseISO8601(s); err == nil {
+			return t, nil
+		}
+		return s, nil
+	case "integer":
+		return strconv.ParseInt(s, 10, 64)
+	case "real":
+		return strconv.ParseFloat(s, 64)
+	case "data":
+		return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+	}
+	return nil, fmt.Errorf("plist: unknown element %q", start.Name.Local)
+}
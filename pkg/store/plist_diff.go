@@ -0,0 +1,191 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+var (
+	// trustSettingsPolicies names the policy OIDs found in trust settings,
+	// for entries without a kSecTrustSettingsPolicyName
+	trustSettingsPolicies = map[string]string{
+		"1.2.840.113635.100.1.2":  "basicX509",
+		"1.2.840.113635.100.1.3":  "sslServer",
+		"1.2.840.113635.100.1.8":  "smime",
+		"1.2.840.113635.100.1.16": "codeSign",
+	}
+
+	trustSettingsResults = map[int]string{
+		trustSettingsResultInvalid:     "Invalid",
+		trustSettingsResultTrustRoot:   "Always Trust",
+		trustSettingsResultTrustAsRoot: "Trust As Root",
+		trustSettingsResultDeny:        "Never Trust",
+		trustSettingsResultUnspecified: "Use System Defaults",
+	}
+)
+
+// TrustSettingsChange is a certificate whose trust settings differ between
+// two `security trust-settings-export` plists
+type TrustSettingsChange struct {
+	// Fingerprint is the certificate's SHA1 fingerprint, in uppercase hex
+	Fingerprint string
+	Issuer      string
+	Serial      string
+
+	// Change is "added", "removed" or "changed"
+	Change string
+
+	// Before and After describe the trust settings in each plist, e.g.
+	// "sslServer: Never Trust", they're empty when the certificate isn't in
+	// that plist
+	Before string
+	After  string
+
+	// Modified is the entry's modDate in the later plist (or the earlier
+	// one for removed entries), it's zero if the entry has none
+	Modified time.Time
+}
+
+// trustEntry is a certificate in a trust settings plist
+type trustEntry struct {
+	issuer   string
+	serial   string
+	settings string
+	modified time.Time
+}
+
+// DiffTrustSettings compares two trust settings plists and returns each
+// certificate which was added, removed or had its trust settings changed,
+// sorted by issuer. Modification dates aren't compared.
+func DiffTrustSettings(before, after []byte) ([]TrustSettingsChange, error) {
+	a, err := parseTrustEntries(before)
+	if err != nil {
+		return nil, err
+	}
+	b, err := parseTrustEntries(after)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []TrustSettingsChange
+	for fp, ea := range a {
+		eb, ok := b[fp]
+		switch {
+		case !ok:
+			out = append(out, TrustSettingsChange{fp, ea.issuer, ea.serial, "removed", ea.settings, "", ea.modified})
+		case ea.settings != eb.settings:
+			out = append(out, TrustSettingsChange{fp, ea.issuer, ea.serial, "changed", ea.settings, eb.settings, eb.modified})
+		}
+	}
+	for fp, eb := range b {
+		if _, ok := a[fp]; !ok {
+			out = append(out, TrustSettingsChange{fp, eb.issuer, eb.serial, "added", "", eb.settings, eb.modified})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Issuer != out[j].Issuer {
+			return out[i].Issuer < out[j].Issuer
+		}
+		return out[i].Fingerprint < out[j].Fingerprint
+	})
+	return out, nil
+}
+
+func parseTrustEntries(bs []byte) (map[string]trustEntry, error) {
+	list, err := parseTrustList(bs)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]trustEntry)
+	for fp, v := range list {
+		e, _ := v.(map[string]interface{})
+		entry := trustEntry{}
+		if der, ok := e["issuerName"].([]byte); ok {
+			var rdns pkix.RDNSequence
+			if _, err := asn1.Unmarshal(der, &rdns); err == nil {
+				var name pkix.Name
+				name.FillFromRDNSequence(&rdns)
+				entry.issuer = certutil.StringifyPKIXName(name)
+			}
+		}
+		if serial, ok := e["serialNumber"].([]byte); ok {
+			entry.serial = hex.EncodeToString(serial)
+		}
+		if modified, ok := e["modDate"].(time.Time); ok {
+			entry.modified = modified
+		}
+		settings, _ := e["trustSettings"].([]interface{})
+		entry.settings = describeTrustSettings(settings)
+		out[strings.ToUpper(fp)] = entry
+	}
+	return out, nil
+}
+
+// describeTrustSettings returns the result of each policy, an empty array
+// trusts the certificate as a root for every policy
+func describeTrustSettings(settings []interface{}) string {
+	if len(settings) == 0 {
+		return "all policies: " + trustSettingsResults[trustSettingsResultTrustRoot]
+	}
+	var parts []string
+	for i := range settings {
+		s, _ := settings[i].(map[string]interface{})
+		result := trustSettingsResultTrustRoot
+		if n, ok := s["kSecTrustSettingsResult"].(int64); ok {
+			result = int(n)
+		}
+		label, ok := trustSettingsResults[result]
+		if !ok {
+			label = fmt.Sprintf("result %d", result)
+		}
+		desc := trustSettingsPolicy(s) + ": " + label
+		if str, ok := s["kSecTrustSettingsPolicyString"].(string); ok && str != "" {
+			desc += fmt.Sprintf(" (%s)", str)
+		}
+		if n, ok := s["kSecTrustSettingsAllowedError"].(int64); ok {
+			desc += fmt.Sprintf(", allows error %d", n)
+		}
+		parts = append(parts, desc)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func trustSettingsPolicy(s map[string]interface{}) string {
+	if name, ok := s["kSecTrustSettingsPolicyName"].(string); ok && name != "" {
+		return name
+	}
+	bs, ok := s["kSecTrustSettingsPolicy"].([]byte)
+	if !ok {
+		return "all policies"
+	}
+	// the OID's contents, without a tag and length
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(append([]byte{0x06, byte(len(bs))}, bs...), &oid); err != nil {
+		return hex.EncodeToString(bs)
+	}
+	if name, ok := trustSettingsPolicies[oid.String()]; ok {
+		return name
+	}
+	return oid.String()
+}
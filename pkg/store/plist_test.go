@@ -0,0 +1,321 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+)
+
+const exportedTrustSettings = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>trustList</key>
+	<dict>
+		<key>0D445C165344C1827E1D20AB25F40163D8BE79A5</key>
+		<dict>
+			<key>issuerName</key>
+			<data>
+			MEExCzAJBgNVBAYTAlVT
+			</data>
+			<key>modDate</key>
+			<date>2018-03-01T17:21:04Z</date>
+			<key>serialNumber</key>
+			<data>
+			AQ==
+			</data>
+			<key>trustSettings</key>
+			<array>
+				<dict>
+					<key>kSecTrustSettingsPolicy</key>
+					<data>
+					KoZIhvdjZAEC
+					</data>
+					<key>kSecTrustSettingsPolicyName</key>
+					<string>sslServer</string>
+					<key>kSecTrustSettingsResult</key>
+					<integer>3</integer>
+				</dict>
+				<dict>
+					<key>kSecTrustSettingsAllowedError</key>
+					<integer>-2147408896</integer>
+					<key>kSecTrustSettingsResult</key>
+					<integer>4</integer>
+				</dict>
+			</array>
+		</dict>
+		<key>1111111111111111111111111111111111111111</key>
+		<dict>
+			<key>trustSettings</key>
+			<array/>
+		</dict>
+		<key>a1b2c3d4e5f60718293a4b5c6d7e8f9012345678</key>
+		<dict>
+			<key>trustSettings</key>
+			<array>
+				<dict>
+					<key>kSecTrustSettingsPolicyName</key>
+					<string>sslServer</string>
+				</dict>
+			</array>
+		</dict>
+	</dict>
+	<key>trustVersion</key>
+	<integer>1</integer>
+</dict>
+</plist>
+`
+
+func TestStorePlist__trustSettings(t *testing.T) {
+	settings, err := parseTrustSettings([]byte(exportedTrustSettings))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(settings) != 3 {
+		t.Fatalf("got %#v", settings)
+	}
+	results := settings["0D445C165344C1827E1D20AB25F40163D8BE79A5"].results
+	if len(results) != 2 || results[0] != trustSettingsResultDeny || results[1] != trustSettingsResultUnspecified {
+		t.Errorf("got %v", results)
+	}
+	// missing kSecTrustSettingsResult defaults to trusting as a root
+	results = settings["A1B2C3D4E5F60718293A4B5C6D7E8F9012345678"].results
+	if len(results) != 1 || results[0] != trustSettingsResultTrustRoot {
+		t.Errorf("got %v", results)
+	}
+	// as does an empty array, for every policy
+	results = settings["1111111111111111111111111111111111111111"].results
+	if len(results) != 1 || results[0] != trustSettingsResultTrustRoot {
+		t.Errorf("got %v", results)
+	}
+
+	if item := settings["0D445C165344C1827E1D20AB25F40163D8BE79A5"]; item.serial.Int64() != 1 || len(item.issuer) == 0 {
+		t.Errorf("got %#v", item)
+	}
+
+	// an empty export
+	settings, err = parseTrustSettings([]byte(emptyTrustSettings))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(settings) != 0 {
+		t.Errorf("got %#v", settings)
+	}
+}
+
+func TestStorePlist__values(t *testing.T) {
+	v, err := parsePlist(strings.NewReader(`<plist><array><true/><false/><real>1.5</real><data>AQI=</data><string> a </string></array></plist>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) != 5 {
+		t.Fatalf("got %#v", v)
+	}
+	if arr[0] != true || arr[1] != false || arr[2] != 1.5 || arr[4] != "a" {
+		t.Errorf("got %#v", arr)
+	}
+	if bs, ok := arr[3].([]byte); !ok || len(bs) != 2 || bs[1] != 2 {
+		t.Errorf("got %#v", arr[3])
+	}
+
+	if _, err := parsePlist(strings.NewReader(`<plist><bogus>1</bogus></plist>`)); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestStorePlist__dates(t *testing.T) {
+	// newer macOS releases write fractional seconds and zone offsets
+	v, err := parsePlist(strings.NewReader(`<plist><array>
+<date>2018-03-01T17:21:04Z</date>
+<date>2018-03-01T17:21:04.123456Z</date>
+<date>2018-03-01T18:21:04+01:00</date>
+<date>2018-03-01T17:21:04</date>
+<date>yesterday</date>
+</array></plist>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) != 5 {
+		t.Fatalf("got %#v", v)
+	}
+	want := time.Date(2018, 3, 1, 17, 21, 4, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		ts, ok := arr[i].(time.Time)
+		if !ok || !ts.Truncate(time.Second).Equal(want) {
+			t.Errorf("%d: got %#v", i, arr[i])
+		}
+	}
+	if arr[4] != "yesterday" {
+		t.Errorf("got %#v", arr[4])
+	}
+}
+
+func TestStorePlist__diff(t *testing.T) {
+	issuer, err := asn1.Marshal(pkix.Name{Country: []string{"US"}, Organization: []string{"Test CA"}, CommonName: "Test Root"}.ToRDNSequence())
+	if err != nil {
+		t.Fatal(err)
+	}
+	added := `<key>FFEEDDCCBBAA99887766554433221100FFEEDDCC</key>
+		<dict>
+			<key>issuerName</key>
+			<data>` + base64.StdEncoding.EncodeToString(issuer) + `</data>
+			<key>serialNumber</key>
+			<data>AQI=</data>
+			<key>trustSettings</key>
+			<array/>
+		</dict>
+		<key>0D445C165344C1827E1D20AB25F40163D8BE79A5</key>`
+
+	// deny becomes trust, one certificate is removed and another added
+	after := strings.Replace(exportedTrustSettings, "<integer>3</integer>", "<integer>1</integer>", 1)
+	after = strings.Replace(after, "<key>0D445C165344C1827E1D20AB25F40163D8BE79A5</key>", added, 1)
+	after = after[:strings.Index(after, "<key>a1b2c3d4")] + after[strings.Index(after, "\n\t</dict>\n\t<key>trustVersion"):]
+	after = strings.Replace(after, "2018-03-01T17:21:04Z", "2018-04-01T00:00:00Z", 1)
+
+	changes, err := DiffTrustSettings([]byte(exportedTrustSettings), []byte(after))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("got %#v", changes)
+	}
+	byFp := make(map[string]TrustSettingsChange)
+	for i := range changes {
+		byFp[changes[i].Fingerprint] = changes[i]
+	}
+
+	c := byFp["0D445C165344C1827E1D20AB25F40163D8BE79A5"]
+	if c.Change != "changed" || c.Serial != "01" {
+		t.Errorf("got %#v", c)
+	}
+	if c.Before != "sslServer: Never Trust; all policies: Use System Defaults, allows error -2147408896" {
+		t.Errorf("before: %q", c.Before)
+	}
+	if !strings.HasPrefix(c.After, "sslServer: Always Trust;") {
+		t.Errorf("after: %q", c.After)
+	}
+	if !c.Modified.Equal(time.Date(2018, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("modified: %v", c.Modified)
+	}
+
+	c = byFp["A1B2C3D4E5F60718293A4B5C6D7E8F9012345678"]
+	if c.Change != "removed" || c.Before != "sslServer: Always Trust" || c.After != "" {
+		t.Errorf("got %#v", c)
+	}
+
+	c = byFp["FFEEDDCCBBAA99887766554433221100FFEEDDCC"]
+	if c.Change != "added" || c.After != "all policies: Always Trust" || c.Serial != "0102" || !strings.Contains(c.Issuer, "Test Root") {
+		t.Errorf("got %#v", c)
+	}
+
+	// only the modification date changed
+	changes, err = DiffTrustSettings([]byte(exportedTrustSettings), []byte(strings.Replace(exportedTrustSettings, "2018-03-01T17:21:04Z", "2018-04-01T00:00:00Z", 1)))
+	if err != nil || len(changes) != 0 {
+		t.Errorf("got %#v, err=%v", changes, err)
+	}
+}
+
+func TestStorePlist__policyName(t *testing.T) {
+	// 1.2.840.113635.100.1.3, without a kSecTrustSettingsPolicyName
+	policy := map[string]interface{}{
+		"kSecTrustSettingsPolicy": []byte{0x2a, 0x86, 0x48, 0x86, 0xf7, 0x63, 0x64, 0x01, 0x03},
+	}
+	if name := trustSettingsPolicy(policy); name != "sslServer" {
+		t.Errorf("got %q", name)
+	}
+	policy["kSecTrustSettingsPolicy"] = []byte{0x2a, 0x03}
+	if name := trustSettingsPolicy(policy); name != "1.2.3" {
+		t.Errorf("got %q", name)
+	}
+}
+
+// trustSettingsPlist returns an exported plist denying c, with the issuer
+// and serial number of as (if set)
+func trustSettingsPlist(c, as *x509.Certificate) []byte {
+	entry := ""
+	if as != nil {
+		entry = `<key>issuerName</key>
+			<data>` + base64.StdEncoding.EncodeToString(as.RawIssuer) + `</data>
+			<key>serialNumber</key>
+			<data>` + base64.StdEncoding.EncodeToString(as.SerialNumber.Bytes()) + `</data>`
+	}
+	list := `<key>` + strings.ToUpper(certutil.GetHexSHA1Fingerprint(*c)) + `</key>
+		<dict>
+			` + entry + `
+			<key>trustSettings</key>
+			<array><dict><key>kSecTrustSettingsResult</key><integer>3</integer></dict></array>
+		</dict>`
+	return []byte(strings.Replace(emptyTrustSettings, "<dict/>", "<dict>"+list+"</dict>", 1))
+}
+
+func TestStorePlist__serialCollision(t *testing.T) {
+	// distinct roots with the same short serial number
+	a, err := testca.NewRoot("Collide Root A", &testca.Options{SerialNumber: big.NewInt(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := testca.NewRoot("Collide Root B", &testca.Options{SerialNumber: big.NewInt(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		plist   []byte
+		deniesA bool
+		deniesB bool
+		desc    string
+	}{
+		{trustSettingsPlist(a.Certificate, a.Certificate), true, false, "issuer and serial match"},
+		{trustSettingsPlist(a.Certificate, nil), true, false, "only the SHA1 is exported"},
+		{trustSettingsPlist(a.Certificate, b.Certificate), false, false, "the issuer belongs to another certificate"},
+	}
+	for i := range cases {
+		settings, err := parseTrustSettings(cases[i].plist)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := settings.denies(a.Certificate); v != cases[i].deniesA {
+			t.Errorf("%s: A denied=%v", cases[i].desc, v)
+		}
+		if v := settings.denies(b.Certificate); v != cases[i].deniesB {
+			t.Errorf("%s: B denied=%v", cases[i].desc, v)
+		}
+	}
+
+	// the serial number has to match as well as the issuer
+	c, err := testca.NewRoot("Collide Root A", &testca.Options{SerialNumber: big.NewInt(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, err := parseTrustSettings(trustSettingsPlist(a.Certificate, c.Certificate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.denies(a.Certificate) {
+		t.Error("expected a different serial number to not match")
+	}
+}
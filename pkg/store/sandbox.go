@@ -0,0 +1,338 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"bufio"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+	"gopkg.in/yaml.v2"
+)
+
+// Snaps and flatpaks are sandboxed and carry their own CA bundles (from the app
+// or its base/runtime) so changes to /etc/ssl on the host aren't seen by them.
+//
+// They're addressed with `-app snap:<name>` and `-app flatpak:<id>`.
+
+var (
+	// snapRoot is where snaps are mounted
+	snapRoot = "/snap"
+
+	// flatpakInstallations are the system and user flatpak installations
+	flatpakInstallations = []string{
+		"/var/lib/flatpak",
+		filepath.Join(file.HomeDir(), ".local/share/flatpak"),
+	}
+
+	// sandboxBundlePaths are where CA bundles are found inside a snap or flatpak
+	sandboxBundlePaths = []string{
+		"etc/ssl/certs/ca-certificates.crt", // Debian, Ubuntu
+		"etc/pki/tls/certs/ca-bundle.crt",   // Fedora
+		"etc/ssl/cert.pem",                  // Alpine, freedesktop runtimes
+	}
+
+	errSnapReadOnly = errors.New("snaps are read-only squashfs images, their CA bundle can't be modified")
+)
+
+// sandboxStore represents the CA bundles used by a snap or flatpak application.
+//
+// Snaps can only be listed and backed up. Flatpaks are modified by writing a new
+// bundle under ~/.cert-manage/flatpak/<id>/ and pointing the app at it with
+// `flatpak override --env=SSL_CERT_FILE`, which OpenSSL based apps honor.
+type sandboxStore struct {
+	kind string // snap or flatpak
+	name string
+}
+
+// sandboxStoreFor returns a Store for apps named like "snap:<name>" or "flatpak:<id>"
+func sandboxStoreFor(app string) (Store, bool) {
+	parts := strings.SplitN(app, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, false
+	}
+	switch strings.ToLower(parts[0]) {
+	case "snap", "flatpak":
+		return sandboxStore{kind: strings.ToLower(parts[0]), name: parts[1]}, true
+	}
+	return nil, false
+}
+
+// GetSandboxedApps returns each snap and flatpak which carries its own CA bundle,
+// named as they're given to -app.
+func GetSandboxedApps() []string {
+	var out []string
+	if fis, err := ioutil.ReadDir(snapRoot); err == nil {
+		for i := range fis {
+			s := sandboxStore{kind: "snap", name: fis[i].Name()}
+			if len(s.bundles()) > 0 {
+				out = append(out, "snap:"+s.name)
+			}
+		}
+	}
+	seen := make(map[string]bool)
+	for _, inst := range flatpakInstallations {
+		fis, err := ioutil.ReadDir(filepath.Join(inst, "app"))
+		if err != nil {
+			continue
+		}
+		for i := range fis {
+			s := sandboxStore{kind: "flatpak", name: fis[i].Name()}
+			if !seen[s.name] && len(s.bundles()) > 0 {
+				seen[s.name] = true
+				out = append(out, "flatpak:"+s.name)
+			}
+		}
+	}
+	file.SortNames(out)
+	return out
+}
+
+// bundles returns the CA bundles which exist for the app, its own first
+func (s sandboxStore) bundles() []string {
+	var roots []string
+	switch s.kind {
+	case "snap":
+		dir := filepath.Join(snapRoot, s.name, "current")
+		roots = append(roots, dir, filepath.Join(snapRoot, snapBase(dir), "current"))
+	case "flatpak":
+		for _, inst := range flatpakInstallations {
+			dir := filepath.Join(inst, "app", s.name, "current", "active")
+			if !file.Exists(dir) {
+				continue
+			}
+			roots = append(roots, filepath.Join(dir, "files"))
+			if runtime := flatpakRuntime(dir); runtime != "" {
+				for _, rinst := range flatpakInstallations {
+					roots = append(roots, filepath.Join(rinst, "runtime", runtime, "active", "files"))
+				}
+			}
+			break
+		}
+	}
+
+	var out []string
+	for _, root := range roots {
+		for _, p := range sandboxBundlePaths {
+			where := filepath.Join(root, p)
+			if file.Exists(where) {
+				out = append(out, where)
+			}
+		}
+	}
+	return out
+}
+
+// snapBase reads the base snap (e.g. core18) from meta/snap.yaml, snaps without
+// a base use "core".
+func snapBase(dir string) string {
+	var meta struct {
+		Base string `yaml:"base"`
+	}
+	bs, err := ioutil.ReadFile(filepath.Join(dir, "meta", "snap.yaml"))
+	if err == nil && yaml.Unmarshal(bs, &meta) == nil && meta.Base != "" {
+		return meta.Base
+	}
+	return "core"
+}
+
+// flatpakRuntime reads the runtime (e.g. org.freedesktop.Platform/x86_64/18.08)
+// from an app's metadata file.
+func flatpakRuntime(dir string) string {
+	fd, err := os.Open(filepath.Join(dir, "metadata"))
+	if err != nil {
+		return ""
+	}
+	defer fd.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			section = line
+			continue
+		}
+		if section == "[Application]" && strings.HasPrefix(line, "runtime=") {
+			return strings.TrimPrefix(line, "runtime=")
+		}
+	}
+	return ""
+}
+
+// overrideBundle is where we write the bundle a flatpak is pointed at, the
+// parent directory isn't created.
+func (s sandboxStore) overrideBundle() (string, error) {
+	parent, err := getCertManageParentDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(parent, s.kind, s.name, "ca-certificates.crt"), nil
+}
+
+func (s sandboxStore) Add(certs []*x509.Certificate) error {
+	if s.kind == "snap" {
+		return errSnapReadOnly
+	}
+	current, err := s.List(nil)
+	if err != nil {
+		return err
+	}
+	pool := certutil.Pool{}
+	pool.AddCertificates(current)
+	pool.AddCertificates(certs)
+	return s.override(pool.GetCertificates())
+}
+
+// Backup writes the certificates currently used by the app to
+// ~/.cert-manage/<kind>/<name>/backups/<time>.crt
+func (s sandboxStore) Backup() error {
+	certs, err := s.List(nil)
+	if err != nil {
+		return err
+	}
+	dir, err := getCertManageDir(filepath.Join(s.kind, s.name, "backups"))
+	if err != nil {
+		return err
+	}
+	return certutil.ToFile(filepath.Join(dir, timeutil.Stamp(time.Now())+".crt"), certs)
+}
+
+func (s sandboxStore) GetLatestBackup() (string, error) {
+	dir, err := getCertManageDir(filepath.Join(s.kind, s.name, "backups"))
+	if err != nil {
+		return "", err
+	}
+	return getLatestBackup(dir)
+}
+
+func (s sandboxStore) GetInfo() *Info {
+	info := &Info{
+		Name:     fmt.Sprintf("%s %s", s.kind, s.name),
+		Location: strings.Join(s.bundles(), ", "),
+		Writable: s.kind == "flatpak",
+	}
+	if s.kind == "flatpak" {
+		if where, err := s.overrideBundle(); err == nil && file.Exists(where) {
+			info.Location = where
+		}
+	}
+	return info
+}
+
+func (s sandboxStore) Version() string {
+	return ""
+}
+
+// List returns the certificates of our override bundle (flatpak) if one was
+// written, otherwise the app's own bundles.
+func (s sandboxStore) List(_ *ListOptions) ([]*x509.Certificate, error) {
+	if s.kind == "flatpak" {
+		if where, err := s.overrideBundle(); err == nil && file.Exists(where) {
+			return certutil.FromFile(where)
+		}
+	}
+
+	bundles := s.bundles()
+	if len(bundles) == 0 {
+		return nil, fmt.Errorf("no CA bundle found for %s %s", s.kind, s.name)
+	}
+	pool := certutil.Pool{}
+	for i := range bundles {
+		certs, err := certutil.FromFile(bundles[i])
+		if err != nil {
+			return nil, err
+		}
+		pool.AddCertificates(certs)
+	}
+	return pool.GetCertificates(), nil
+}
+
+func (s sandboxStore) Remove(wh whitelist.Whitelist) error {
+	if s.kind == "snap" {
+		return errSnapReadOnly
+	}
+	certs, err := s.List(nil)
+	if err != nil {
+		return err
+	}
+	var kept []*x509.Certificate
+	matches := wh.MatchEach(certs)
+	for i := range certs {
+		if matches[i] {
+			kept = append(kept, certs[i])
+		}
+	}
+	return s.override(kept)
+}
+
+// Restore removes our override, so the flatpak uses its own bundle again.
+// Flatpak bundles are never modified, so `where` isn't needed.
+func (s sandboxStore) Restore(where string) error {
+	if s.kind == "snap" {
+		return nil
+	}
+	bundle, err := s.overrideBundle()
+	if err != nil {
+		return err
+	}
+	if err := flatpakOverride(s.name, "--unset-env=SSL_CERT_FILE"); err != nil {
+		return err
+	}
+	if err := os.Remove(bundle); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// override writes certs to our bundle and points the flatpak at it
+func (s sandboxStore) override(certs []*x509.Certificate) error {
+	bundle, err := s.overrideBundle()
+	if err != nil {
+		return err
+	}
+	if _, err := getCertManageDir(filepath.Dir(bundle)); err != nil {
+		return err
+	}
+	if err := certutil.ToFile(bundle, certs); err != nil {
+		return err
+	}
+	return flatpakOverride(s.name, "--env=SSL_CERT_FILE="+bundle, "--filesystem="+filepath.Dir(bundle)+":ro")
+}
+
+func flatpakOverride(id string, args ...string) error {
+	args = append(append([]string{"override", "--user"}, args...), id)
+	cmd := interrupt.Command("flatpak", args...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if debug {
+			fmt.Printf("store/sandbox: Command was: %s\n", strings.Join(cmd.Args, " "))
+			fmt.Printf("store/sandbox: Output: %q\n", string(out))
+		}
+		return fmt.Errorf("error running flatpak override for %s: %v", id, err)
+	}
+	return nil
+}
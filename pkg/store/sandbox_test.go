@@ -0,0 +1,102 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/file"
+)
+
+// writeBundle copies our example certificate into dir/rel, creating parent directories
+func writeBundle(t *testing.T, dir, rel string) {
+	t.Helper()
+	where := filepath.Join(dir, rel)
+	if err := os.MkdirAll(filepath.Dir(where), file.TempDirPermissions); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.CopyFile("../../testdata/example.crt", where); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreSandbox__detect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-sandbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	origSnap, origFlatpak := snapRoot, flatpakInstallations
+	snapRoot = filepath.Join(dir, "snap")
+	flatpakInstallations = []string{filepath.Join(dir, "flatpak")}
+	defer func() {
+		snapRoot, flatpakInstallations = origSnap, origFlatpak
+	}()
+
+	// a snap using the core18 base, and one without any bundle
+	writeBundle(t, snapRoot, "core18/current/etc/ssl/certs/ca-certificates.crt")
+	if err := os.MkdirAll(filepath.Join(snapRoot, "hello", "current", "meta"), file.TempDirPermissions); err != nil {
+		t.Fatal(err)
+	}
+	meta := []byte("name: hello\nbase: core18\n")
+	if err := ioutil.WriteFile(filepath.Join(snapRoot, "hello", "current", "meta", "snap.yaml"), meta, file.TempFilePermissions); err != nil {
+		t.Fatal(err)
+	}
+
+	// a flatpak with a bundle from its runtime
+	app := filepath.Join(dir, "flatpak", "app", "org.example.App", "current", "active")
+	if err := os.MkdirAll(app, file.TempDirPermissions); err != nil {
+		t.Fatal(err)
+	}
+	metadata := []byte("[Application]\nname=org.example.App\nruntime=org.example.Platform/x86_64/1.0\n")
+	if err := ioutil.WriteFile(filepath.Join(app, "metadata"), metadata, file.TempFilePermissions); err != nil {
+		t.Fatal(err)
+	}
+	writeBundle(t, filepath.Join(dir, "flatpak"), "runtime/org.example.Platform/x86_64/1.0/active/files/etc/ssl/cert.pem")
+
+	apps := GetSandboxedApps()
+	expected := []string{"flatpak:org.example.App", "snap:core18", "snap:hello"}
+	if !reflect.DeepEqual(apps, expected) {
+		t.Errorf("got %v", apps)
+	}
+
+	for _, name := range expected {
+		s, err := ForApp(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs, err := s.List(&ListOptions{Trusted: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(certs) != 1 {
+			t.Errorf("%s: got %d certs", name, len(certs))
+		}
+	}
+
+	// snaps can't be modified
+	s, _ := ForApp("snap:hello")
+	if err := s.Add(nil); err != errSnapReadOnly {
+		t.Errorf("expected errSnapReadOnly, got %v", err)
+	}
+	if _, ok := sandboxStoreFor("other:thing"); ok {
+		t.Error("expected no store")
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// ScopeAll operates on every store a platform has
+	ScopeAll = "all"
+
+	// ScopeUser operates on the current user's stores (e.g. CurrentUser on windows,
+	// the login keychain on darwin or ~/.pki/nssdb on linux)
+	ScopeUser = "user"
+
+	// ScopeSystem operates on the machine wide stores (e.g. LocalMachine on windows,
+	// the System keychain on darwin or /etc/ssl on linux)
+	ScopeSystem = "system"
+)
+
+var (
+	scope = ScopeAll
+)
+
+// GetScopes returns the values accepted by SetScope
+func GetScopes() []string {
+	return []string{ScopeAll, ScopeSystem, ScopeUser}
+}
+
+// SetScope limits the stores a platform reads and modifies to those of the
+// current user or the whole system:
+//
+//   - darwin: the login keychain, or the System and SystemRootCertificates keychains
+//   - linux: the NSS database in ~/.pki/nssdb, or the CA bundle in /etc/ssl
+//   - windows: the CurrentUser or LocalMachine locations
+//
+// Apps aren't split by scope and ignore it.
+func SetScope(s string) error {
+	s = strings.ToLower(s)
+	for _, v := range GetScopes() {
+		if s == v {
+			scope = s
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown scope %q, options: %s", s, strings.Join(GetScopes(), ", "))
+}
+
+// inScope returns true if the given scope is selected
+func inScope(s string) bool {
+	return scope == ScopeAll || scope == s
+}
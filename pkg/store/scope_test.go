@@ -0,0 +1,41 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"testing"
+)
+
+func TestStore__SetScope(t *testing.T) {
+	defer SetScope(ScopeAll)
+
+	if err := SetScope("other"); err == nil {
+		t.Error("expected error")
+	}
+
+	if err := SetScope("USER"); err != nil {
+		t.Fatal(err)
+	}
+	if !inScope(ScopeUser) || inScope(ScopeSystem) {
+		t.Errorf("expected only user scope, got %q", scope)
+	}
+
+	if err := SetScope(ScopeAll); err != nil {
+		t.Fatal(err)
+	}
+	if !inScope(ScopeUser) || !inScope(ScopeSystem) {
+		t.Errorf("expected all scopes, got %q", scope)
+	}
+}
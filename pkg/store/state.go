@@ -0,0 +1,149 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+// State records what was last applied to a store, so re-applying the same
+// whitelist to an unchanged store can be skipped.
+type State struct {
+	// SHA256 of the applied whitelist, see whitelist.Hash()
+	Whitelist string `json:"whitelist"`
+
+	// SHA256 of the trusted certificates left after applying, see HashCertificates()
+	Certificates string `json:"certificates"`
+
+	// SHA256 fingerprints of the trusted certificates left after applying, sorted
+	Fingerprints []string `json:"fingerprints,omitempty"`
+
+	// Rules is the applied whitelist, kept so it can be applied again
+	// without the original file (see 'reconcile')
+	Rules *whitelist.Whitelist `json:"rules,omitempty"`
+
+	// Cascade is set when intermediates left without a trusted root were
+	// removed along with the whitelist (whitelist -cascade)
+	Cascade bool `json:"cascade,omitempty"`
+
+	Applied time.Time `json:"applied"`
+}
+
+// GetState returns the state recorded for the store `name` (e.g. an app or
+// platform name), or nil if nothing has been recorded.
+func GetState(name string) (*State, error) {
+	path, err := stateFile()
+	if err != nil {
+		return nil, err
+	}
+	return readState(path, name)
+}
+
+// SaveState records the state of the store `name`
+func SaveState(name string, st State) error {
+	path, err := stateFile()
+	if err != nil {
+		return err
+	}
+	return writeState(path, name, st)
+}
+
+// Fingerprints returns the sorted SHA256 fingerprints of certs
+func Fingerprints(certs []*x509.Certificate) []string {
+	fps := make([]string, len(certs))
+	for i := range certs {
+		fps[i] = certutil.GetHexSHA256Fingerprint(*certs[i])
+	}
+	sort.Strings(fps)
+	return fps
+}
+
+// HashCertificates returns a SHA256 over the sorted fingerprints of certs,
+// which doesn't change with the order certificates are listed in.
+func HashCertificates(certs []*x509.Certificate) string {
+	fps := Fingerprints(certs)
+
+	h := sha256.New()
+	for i := range fps {
+		h.Write([]byte(fps[i]))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// stateFile returns where the state of every store is kept
+func stateFile() (string, error) {
+	parent, err := getCertManageParentDir()
+	if err != nil {
+		return "", err
+	}
+	if parent == "" {
+		return "", errors.New("unable to find home directory for state file")
+	}
+	return filepath.Join(parent, "state.json"), nil
+}
+
+func readStates(path string) (map[string]State, error) {
+	states := make(map[string]State)
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return states, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(bs, &states); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+func readState(path, name string) (*State, error) {
+	states, err := readStates(path)
+	if err != nil {
+		return nil, err
+	}
+	st, ok := states[name]
+	if !ok {
+		return nil, nil
+	}
+	return &st, nil
+}
+
+func writeState(path, name string, st State) error {
+	states, err := readStates(path)
+	if err != nil {
+		return err
+	}
+	states[name] = st
+
+	bs, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bs, file.TempFilePermissions)
+}
@@ -0,0 +1,77 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+func TestStore__state(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	st, err := readState(path, "java")
+	if err != nil || st != nil {
+		t.Fatalf("st=%v err=%v", st, err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := writeState(path, "java", State{Whitelist: "a", Certificates: "b", Applied: now}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeState(path, "linux", State{Whitelist: "c"}); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err = readState(path, "java")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st == nil || st.Whitelist != "a" || st.Certificates != "b" || !st.Applied.Equal(now) {
+		t.Errorf("got %#v", st)
+	}
+	st, err = readState(path, "linux")
+	if err != nil || st == nil || st.Whitelist != "c" {
+		t.Errorf("st=%#v err=%v", st, err)
+	}
+}
+
+func TestStore__HashCertificates(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reversed := make([]*x509.Certificate, len(certs))
+	for i := range certs {
+		reversed[len(certs)-1-i] = certs[i]
+	}
+	if HashCertificates(certs) != HashCertificates(reversed) {
+		t.Error("expected hash to ignore order")
+	}
+	if HashCertificates(certs) == HashCertificates(certs[1:]) {
+		t.Error("expected different hashes")
+	}
+}
@@ -65,6 +65,10 @@ type Store interface {
 	// GetInfo returns basic information about the store
 	GetInfo() *Info
 
+	// Version returns the version of the application (or OS) which the
+	// store belongs to, or an empty string if it can't be found.
+	Version() string
+
 	// List returns the currently trusted X509 certificates contained
 	// within the cert store
 	List(opts *ListOptions) ([]*x509.Certificate, error)
@@ -110,11 +114,41 @@ type Store interface {
 type Info struct {
 	Name    string
 	Version string
+
+	// Location is where the store's certificates are kept, e.g. a file,
+	// directory, keychain(s) or system store.
+	Location string
+
+	// Writable is false for stores which can only be listed or backed up
+	Writable bool
+
+	// Certificates is how many trusted certificates the store has, it's
+	// only filled in by Describe as counting them requires a List.
+	Certificates int
+}
+
+// Describe returns the Info of a store along with how many trusted
+// certificates it has.
+func Describe(s Store) (*Info, error) {
+	info := s.GetInfo()
+	if info == nil {
+		info = &Info{}
+	}
+	certs, err := s.List(&ListOptions{
+		Trusted: true,
+	})
+	if err != nil {
+		if _, ok := IsPartial(err); !ok {
+			return info, err
+		}
+	}
+	info.Certificates = len(certs)
+	return info, nil
 }
 
 // Platform returns a new instance of Store for the running os/platform
 func Platform() Store {
-	return platform()
+	return wrapDryRun(wrapVersioned(platform()))
 }
 
 // GetApps returns an array the supported app names
@@ -129,11 +163,34 @@ func GetApps() []string {
 
 // ForApp returns a `Store` instance for the given app
 func ForApp(app string) (Store, error) {
+	if s, ok := sandboxStoreFor(app); ok {
+		return wrapDryRun(wrapVersioned(s)), nil
+	}
+	if s, ok := fileStoreFor(app); ok {
+		return wrapDryRun(wrapVersioned(s)), nil
+	}
+	if s, ok := javaKeystoreFor(app); ok {
+		return wrapDryRun(wrapVersioned(s)), nil
+	}
 	s, ok := appStores[strings.ToLower(app)]
 	if !ok {
 		return nil, fmt.Errorf("application %q not found", app)
 	}
-	return s, nil
+	return wrapDryRun(wrapVersioned(s)), nil
+}
+
+// unwrap returns the Store underneath the dry-run and versioned wrappers
+func unwrap(s Store) Store {
+	for {
+		switch w := s.(type) {
+		case dryRunStore:
+			s = w.underlying
+		case versionedStore:
+			s = w.underlying
+		default:
+			return s
+		}
+	}
 }
 
 // getCertManageDir returns the fs location (always creating first) where a specific
@@ -171,6 +228,16 @@ func getCertManageDir(name string) (string, error) {
 	return dir, nil
 }
 
+// StateDir returns the directory cert-manage keeps backups and other state
+// in between runs, e.g. ~/.cert-manage. It's created if missing.
+func StateDir() (string, error) {
+	dir, err := getCertManageParentDir()
+	if err == nil && dir == "" {
+		err = errors.New("unable to find home directory")
+	}
+	return dir, err
+}
+
 func getCertManageParentDir() (string, error) {
 	uhome := file.HomeDir()
 	if uhome != "" {
@@ -214,3 +281,29 @@ func getLatestBackup(dir string) (string, error) {
 	latest := fis[len(fis)-1]
 	return filepath.Join(dir, latest.Name()), nil
 }
+
+// GetBackups returns the path of each backup for a store, oldest first.
+//
+// Backups are assumed to be stored alongside the latest backup.
+func GetBackups(s Store) ([]string, error) {
+	s = unwrap(s)
+	if m, ok := s.(memoryStore); ok {
+		return m.backupNames(), nil
+	}
+	latest, err := s.GetLatestBackup()
+	if err != nil || latest == "" {
+		return nil, err
+	}
+	dir := filepath.Dir(latest)
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	file.SortFileInfos(fis)
+
+	out := make([]string, len(fis))
+	for i := range fis {
+		out[i] = filepath.Join(dir, fis[i].Name())
+	}
+	return out, nil
+}
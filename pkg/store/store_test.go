@@ -18,8 +18,15 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/exectest"
 )
 
+func TestMain(m *testing.M) {
+	exectest.Main(m)
+}
+
 func TestStore__getCertManageDir(t *testing.T) {
 	name := "test-getCertManageDir"
 	d1, err := getCertManageDir(name)
@@ -126,3 +133,28 @@ func TestStore__getLatestBackup(t *testing.T) {
 		t.Errorf("got other backup dir, dir=%s", dir)
 	}
 }
+
+func TestStore__Describe(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := Describe(MemoryStore(certs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "Memory" || !info.Writable {
+		t.Errorf("got %#v", info)
+	}
+	if info.Certificates != len(certs) {
+		t.Errorf("got %d certificates, expected %d", info.Certificates, len(certs))
+	}
+
+	info, err = Describe(emptyStore{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Writable || info.Certificates != 0 {
+		t.Errorf("got %#v", info)
+	}
+}
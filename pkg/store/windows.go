@@ -17,17 +17,17 @@
 package store
 
 import (
-	"bytes"
 	"crypto/x509"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"os/exec"
-	"regexp"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
+	"unsafe"
 
 	"github.com/adamdecaf/cert-manage/pkg/certutil"
-	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
 	"github.com/adamdecaf/cert-manage/pkg/whitelist"
 )
 
@@ -36,8 +36,9 @@ import (
 // https://social.technet.microsoft.com/wiki/contents/articles/31633.microsoft-trusted-root-program-requirements.aspx
 // https://social.technet.microsoft.com/wiki/contents/articles/31680.microsoft-trusted-root-certificate-program-updates.aspx
 
-// https://blogs.technet.microsoft.com/yuridiogenes/2011/04/20/exporting-certificates-using-certutil/
-// https://docs.microsoft.com/en-us/previous-versions/windows/it-pro/windows-server-2012-R2-and-2012/cc732443(v=ws.11)
+// CryptoAPI:
+// - https://msdn.microsoft.com/en-us/library/windows/desktop/aa376559(v=vs.85).aspx (CertOpenStore)
+// - https://msdn.microsoft.com/en-us/library/windows/desktop/aa376023(v=vs.85).aspx (CertDeleteCertificateFromStore)
 
 // Certificate store locations:
 // - https://superuser.com/questions/411909/where-is-the-certificate-folder-in-windows-7
@@ -54,173 +55,376 @@ var (
 		"CA",       // "Intermediate Certification Authorities"
 		"AuthRoot", // "Third-Party Root Certification Authorities"
 	}
+
+	// windowsRootStoreNames are the stores holding trust anchors, these are
+	// what Remove, Backup and Restore modify.
+	windowsRootStoreNames = []string{"Root", "AuthRoot"}
+
+	// windowsIntermediateStore is also modified after IncludeEnterpriseStores
+	windowsIntermediateStore = "CA"
+
+	// windowsScopes maps our scopes onto CryptoAPI system store locations
+	windowsScopes = []struct {
+		scope string
+		name  string
+		flags uint32
+	}{
+		{ScopeUser, "CurrentUser", certSystemStoreCurrentUser},
+		{ScopeSystem, "LocalMachine", certSystemStoreLocalMachine},
+	}
+
+	// Folder under ~/.cert-manage/ to put backups
+	windowsBackupDir = "windows"
+
+	// Functions not exposed by the syscall package
+	crypt32                              = syscall.NewLazyDLL("crypt32.dll")
+	procCertDeleteCertificateFromStore   = crypt32.NewProc("CertDeleteCertificateFromStore")
+	procCertDuplicateCertificateContext  = crypt32.NewProc("CertDuplicateCertificateContext")
+	procCertAddEncodedCertificateToStore = crypt32.NewProc("CertAddEncodedCertificateToStore")
 )
 
+// From wincrypt.h
+const (
+	certStoreProvSystemW        = 10
+	certSystemStoreCurrentUser  = 1 << 16
+	certSystemStoreLocalMachine = 2 << 16
+
+	certSystemStoreLocalMachineEnterprise = 9 << 16
+	certStoreOpenExistingFlag             = 0x4000
+	certStoreReadonlyFlag                 = 0x8000
+	certStoreAddUseExisting               = 2
+)
+
+// windowsTarget is a certificate store in one location
+type windowsTarget struct {
+	location string
+	flags    uint32
+	name     string
+
+	// optional stores are skipped if they can't be opened, NTAuth only
+	// exists on machines joined to a domain
+	optional bool
+}
+
+func (t windowsTarget) String() string {
+	return fmt.Sprintf("%s\\%s", t.location, t.name)
+}
+
+// windowsTargets returns the stores in scope. List reads every store, while
+// Remove, Backup and Restore only modify the root stores (and the
+// intermediate and NTAuth stores after IncludeEnterpriseStores).
+func windowsTargets(modify bool) []windowsTarget {
+	names := windowsStoreNames
+	if modify {
+		names = windowsRootStoreNames
+		if enterpriseStores {
+			names = append(append([]string(nil), names...), windowsIntermediateStore)
+		}
+	}
+	var out []windowsTarget
+	for _, loc := range windowsScopes {
+		if !inScope(loc.scope) {
+			continue
+		}
+		for _, name := range names {
+			out = append(out, windowsTarget{location: loc.name, flags: loc.flags, name: name})
+		}
+	}
+	// NTAuth lists the CAs trusted to issue smart card and domain logon
+	// certificates, it's shared by the whole machine
+	if enterpriseStores && inScope(ScopeSystem) {
+		out = append(out, windowsTarget{
+			location: "LocalMachineEnterprise",
+			flags:    certSystemStoreLocalMachineEnterprise,
+			name:     "NTAuth",
+			optional: true,
+		})
+	}
+	return out
+}
+
+// windowsStore manages the system certificate stores through CryptoAPI (crypt32.dll),
+// which avoids calling out to certutil or PowerShell. Both the CurrentUser and
+// LocalMachine locations are used unless limited with SetScope.
 type windowsStore struct{}
 
 func platform() Store {
 	return windowsStore{}
 }
 
+// Add inserts certificates into the Root store of the LocalMachine location
+// with the system scope, otherwise CurrentUser.
+//
+// Windows shows a confirmation dialog when adding to CurrentUser's Root store.
 func (s windowsStore) Add(certs []*x509.Certificate) error {
+	flags := uint32(certSystemStoreCurrentUser)
+	if scope == ScopeSystem {
+		flags = certSystemStoreLocalMachine
+	}
+	h, err := openWindowsStore(flags, "Root", false)
+	if err != nil {
+		return err
+	}
+	defer syscall.CertCloseStore(h, 0)
+
+	for i := range certs {
+		if err := addEncodedCert(h, certs[i].Raw); err != nil {
+			return fmt.Errorf("error adding %s to Root store: %v", certs[i].Subject, err)
+		}
+	}
 	return nil
 }
 
+// Backup writes the certificates of each root store into PEM files with the
+// layout: windows/$time/$location-$store.crt
 func (s windowsStore) Backup() error {
+	dir, err := getCertManageDir(windowsBackupDir + "/" + timeutil.Stamp(time.Now()))
+	if err != nil {
+		return fmt.Errorf("Backup: error getting cert-manage dir, err=%v", err)
+	}
+	for _, t := range windowsTargets(true) {
+		certs, err := certsFromWindowsStore(t.flags, t.name)
+		if err != nil {
+			if t.optional {
+				continue
+			}
+			return fmt.Errorf("Backup: error reading %s, err=%v", t, err)
+		}
+		where := filepath.Join(dir, fmt.Sprintf("%s-%s.crt", t.location, t.name))
+		if err := certutil.ToFile(where, certs); err != nil {
+			return fmt.Errorf("Backup: error writing %s, err=%v", where, err)
+		}
+	}
 	return nil
 }
 
 func (s windowsStore) GetLatestBackup() (string, error) {
-	return "", nil
+	dir, err := getCertManageDir(windowsBackupDir)
+	if err != nil {
+		return "", fmt.Errorf("GetLatestBackup: error getting cert-manage dir, err=%v", err)
+	}
+	return getLatestBackup(dir)
 }
 
 func (s windowsStore) GetInfo() *Info {
-	// From https://stackoverflow.com/a/42778990
-	out, err := exec.Command("systeminfo").CombinedOutput()
-	if err != nil {
-		return &Info{
-			Name: "Windows",
+	name, version := s.systemInfo()
+	var locations []string
+	for _, loc := range windowsScopes {
+		if inScope(loc.scope) {
+			locations = append(locations, loc.name)
 		}
 	}
-	info := string(out)
-
-	nameRegex := regexp.MustCompile(`OS Name:\s*([\w\s]*)`)
-	versionRegex := regexp.MustCompile(`OS Version:\s*([\w\s\.\/]*)`)
+	return &Info{
+		Name:     name,
+		Version:  version,
+		Location: strings.Join(locations, ", "),
+		Writable: true,
+	}
+}
 
-	name := strings.TrimPrefix(nameRegex.FindString(info), "OS Name:")
-	version := strings.TrimPrefix(versionRegex.FindString(info), "OS Version:")
+func (s windowsStore) Version() string {
+	_, version := s.systemInfo()
+	return version
+}
 
-	return &Info{
-		Name:    strings.TrimSpace(name),
-		Version: strings.TrimSpace(version),
+// systemInfo returns the OS name and version, read from the registry as
+// systeminfo's labels are translated.
+func (s windowsStore) systemInfo() (string, string) {
+	out, err := commandC("reg", "query", `HKLM\SOFTWARE\Microsoft\Windows NT\CurrentVersion`).CombinedOutput()
+	if err != nil {
+		return "Windows", ""
 	}
+	return windowsVersionInfo(parseRegQuery(out))
 }
 
 func (s windowsStore) List(_ *ListOptions) ([]*x509.Certificate, error) {
 	pool := certutil.Pool{}
-	for i := range windowsStoreNames {
-		certs, err := s.certsFromStore(windowsStoreNames[i])
+	perr := &PartialError{}
+	read := 0
+	for _, t := range windowsTargets(false) {
+		certs, err := certsFromWindowsStore(t.flags, t.name)
 		if err != nil {
-			return nil, err
+			if !t.optional {
+				perr.add(t.String(), err)
+			}
+			continue
 		}
+		read++
 		pool.AddCertificates(certs)
 	}
-	return pool.GetCertificates(), nil
+	if read == 0 && len(perr.Errors) > 0 {
+		return nil, perr.Errors[0].Err
+	}
+	return pool.GetCertificates(), perr.orNil()
 }
 
-func (s windowsStore) certsFromStore(store string) ([]*x509.Certificate, error) {
-	serials, err := s.certSerialsFromStore(store)
-	if err != nil {
-		return nil, err
+// Remove deletes certificates which aren't whitelisted from the root stores,
+// and the intermediate and NTAuth stores after IncludeEnterpriseStores.
+//
+// Modifying the LocalMachine location requires running as an Administrator.
+func (s windowsStore) Remove(wh whitelist.Whitelist) error {
+	perr := &PartialError{}
+	for _, t := range windowsTargets(true) {
+		err := removeFromWindowsStore(t.flags, t.name, func(c *x509.Certificate) bool {
+			return !wh.Matches(c)
+		})
+		if err != nil && !t.optional {
+			perr.add(t.String(), err)
+		}
 	}
-	var accum []*x509.Certificate
-	for i := range serials {
-		cert, err := s.exportCertFromStore(serials[i], store)
+	return perr.orNil()
+}
+
+// Restore adds back every certificate from a backup, certificates which are
+// still installed are left as-is.
+func (s windowsStore) Restore(where string) error {
+	dir := where
+	if dir == "" {
+		latest, err := s.GetLatestBackup()
 		if err != nil {
-			return nil, err
+			return err
 		}
-		if cert != nil {
-			accum = append(accum, cert)
+		if latest == "" {
+			return fmt.Errorf("Restore: no backup found")
 		}
+		dir = latest
 	}
-	return accum, nil
-}
 
-func (s windowsStore) certSerialsFromStore(store string) ([]string, error) {
-	cmd := exec.Command("certutil", "-store", store)
-	var stdout bytes.Buffer
-	cmd.Stdout = &stdout
-	err := cmd.Run()
-	if err != nil {
-		return nil, fmt.Errorf("error reading serials from store %s err=%v", store, err)
+	perr := &PartialError{}
+	for _, t := range windowsTargets(true) {
+		path := filepath.Join(dir, fmt.Sprintf("%s-%s.crt", t.location, t.name))
+		certs, err := certutil.FromFile(path)
+		if err != nil {
+			// backups taken without IncludeEnterpriseStores, or of machines
+			// without NTAuth, don't have these stores
+			if t.optional || (t.name == windowsIntermediateStore && os.IsNotExist(err)) {
+				continue
+			}
+			perr.add(path, err)
+			continue
+		}
+		if err := restoreWindowsStore(t.flags, t.name, certs); err != nil {
+			perr.add(t.String(), err)
+		}
 	}
-	return s.readCertSerials(string(stdout.Bytes()))
+	return perr.orNil()
 }
 
-var (
-	// C:\Users>certutil -store Root
-	// Root "Trusted Root Certification Authorities"
-	// ================ Certificate 0 ================
-	// Serial Number: 72696afcd5edce864658141cb588a3a8
-	winSerialNumberPrefix = "Serial Number:"
-	winSerialNumberRegex  = regexp.MustCompile(fmt.Sprintf(`%s ([0-9a-f]+)\r?\n?`, winSerialNumberPrefix))
-)
-
-func (s windowsStore) readCertSerials(out string) ([]string, error) {
-	matches := winSerialNumberRegex.FindAllString(out, -1)
-	for i := range matches {
-		matches[i] = strings.TrimSpace(strings.Replace(matches[i], winSerialNumberPrefix, "", -1))
+func openWindowsStore(location uint32, name string, readonly bool) (syscall.Handle, error) {
+	ptr, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return 0, err
+	}
+	flags := location | certStoreOpenExistingFlag
+	if readonly {
+		flags |= certStoreReadonlyFlag
+	}
+	h, err := syscall.CertOpenStore(certStoreProvSystemW, 0, 0, flags, uintptr(unsafe.Pointer(ptr)))
+	if err != nil {
+		return 0, fmt.Errorf("error opening store %s: %v", name, err)
 	}
-	return matches, nil
+	return h, nil
 }
 
-var (
-	pfxPassword = "password"
-)
+// certBytes copies the DER encoding out of a CertContext
+func certBytes(ctx *syscall.CertContext) []byte {
+	encoded := (*[1 << 30]byte)(unsafe.Pointer(ctx.EncodedCert))[:ctx.Length:ctx.Length]
+	out := make([]byte, len(encoded))
+	copy(out, encoded)
+	return out
+}
 
-func (s windowsStore) exportCertFromStore(serial, store string) (*x509.Certificate, error) {
-	tmp, err := ioutil.TempFile("", "cert-manage-windows")
+func certsFromWindowsStore(location uint32, name string) ([]*x509.Certificate, error) {
+	h, err := openWindowsStore(location, name, true)
 	if err != nil {
-		return nil, fmt.Errorf("error creating temp file, err=%v", err)
+		return nil, err
 	}
+	defer syscall.CertCloseStore(h, 0)
 
-	// close and rm file, we got a unique name
-	// This avoids: "The process cannot access the file because it is being used by another process."
-	err = tmp.Close()
-	if err != nil {
-		return nil, err
+	var certs []*x509.Certificate
+	var ctx *syscall.CertContext
+	for {
+		ctx, _ = syscall.CertEnumCertificatesInStore(h, ctx)
+		if ctx == nil {
+			break // CRYPT_E_NOT_FOUND once we're done
+		}
+		cert, err := x509.ParseCertificate(certBytes(ctx))
+		if err != nil {
+			if debug {
+				fmt.Printf("store/windows: skipping unparsable certificate in %s, err=%v\n", name, err)
+			}
+			continue
+		}
+		certs = append(certs, cert)
 	}
-	err = os.Remove(tmp.Name())
+	return certs, nil
+}
+
+// removeFromWindowsStore deletes each certificate in a store that `remove` returns true for
+func removeFromWindowsStore(location uint32, name string, remove func(*x509.Certificate) bool) error {
+	h, err := openWindowsStore(location, name, false)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer func() { // then make sure it's gone afterwords
-		if file.Exists(tmp.Name()) {
-			os.Remove(tmp.Name())
+	defer syscall.CertCloseStore(h, 0)
+
+	var ctx *syscall.CertContext
+	for {
+		ctx, _ = syscall.CertEnumCertificatesInStore(h, ctx)
+		if ctx == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(certBytes(ctx))
+		if err != nil || !remove(cert) {
+			continue
 		}
-	}()
 
-	// export cert into PKCS #12 format
-	out, err := exec.Command("certutil", "-exportPFX", "-f", "-p", pfxPassword, store, serial, tmp.Name()).CombinedOutput()
-	if debug {
-		fmt.Printf("%q\n", string(out))
-	}
-	if err != nil {
-		if debug && bytes.Contains(out, []byte("Keyset does not exist")) {
-			// TODO(adam): Issue repair? That might muck with the store(s)
-			return nil, nil
+		// CertDeleteCertificateFromStore frees the context it's given, so delete
+		// a duplicate to keep enumerating with ctx.
+		dup, _, _ := procCertDuplicateCertificateContext.Call(uintptr(unsafe.Pointer(ctx)))
+		if dup == 0 {
+			return fmt.Errorf("error duplicating certificate context for %s", cert.Subject)
+		}
+		ok, _, err := procCertDeleteCertificateFromStore.Call(dup)
+		if ok == 0 {
+			return fmt.Errorf("error deleting %s from %s: %v", cert.Subject, name, err)
 		}
-		if debug && bytes.Contains(out, []byte("Cannot find object or property.")) {
-			// TODO(adam): uhh..?
-			// CertUtil: -exportPFX command FAILED: 0x80092004 (-2146885628 CRYPT_E_NOT_FOUND)\r\nCertUtil: Cannot find object or property.
-			return nil, nil
+		if debug {
+			fmt.Printf("store/windows: deleted %s from %s\n", certutil.GetHexSHA256Fingerprint(*cert), name)
 		}
-		return nil, fmt.Errorf("error exporting cert %q (from %s) to PKCS #12 err=%q", serial, store, err)
 	}
+	return nil
+}
 
-	bs, err := ioutil.ReadFile(tmp.Name())
+func restoreWindowsStore(location uint32, name string, certs []*x509.Certificate) error {
+	h, err := openWindowsStore(location, name, false)
 	if err != nil {
-		return nil, fmt.Errorf("error reading temp file, err=%v", err)
+		return err
 	}
-	cert, err := certutil.DecodePKCS12(bs, pfxPassword)
-	if err != nil {
-		if debug && strings.Contains(err.Error(), "expected exactly two items in the authenticated safe") {
-			// TODO(adam): https://github.com/golang/go/issues/23499
-			return nil, nil
-		}
-		if debug && strings.Contains(err.Error(), "OID 1.3.6.1.4.1.311.17.2") {
-			// TODO(adam): http://oidref.com/1.3.6.1.4.1.311.17.2
-			return nil, nil
+	defer syscall.CertCloseStore(h, 0)
+
+	for i := range certs {
+		if err := addEncodedCert(h, certs[i].Raw); err != nil {
+			return fmt.Errorf("error restoring %s: %v", certs[i].Subject, err)
 		}
-		return nil, fmt.Errorf("error parsing PKCS #12 of serial %q from %s, err=%q", serial, store, err)
 	}
-	return cert, nil
-}
-
-func (s windowsStore) Remove(wh whitelist.Whitelist) error {
 	return nil
 }
 
-func (s windowsStore) Restore(where string) error {
+func addEncodedCert(h syscall.Handle, der []byte) error {
+	if len(der) == 0 {
+		return nil
+	}
+	ok, _, err := procCertAddEncodedCertificateToStore.Call(
+		uintptr(h),
+		uintptr(syscall.X509_ASN_ENCODING|syscall.PKCS_7_ASN_ENCODING),
+		uintptr(unsafe.Pointer(&der[0])),
+		uintptr(len(der)),
+		certStoreAddUseExisting,
+		0,
+	)
+	if ok == 0 {
+		return err
+	}
 	return nil
 }
@@ -17,43 +17,31 @@
 package store
 
 import (
-	"reflect"
 	"testing"
 )
 
-func TestStoreWindows__certSerialsFromStore(t *testing.T) {
-	win := windowsStore{}
+func TestStoreWindows__List(t *testing.T) {
+	defer SetScope(ScopeAll)
 
-	in := `Root "Trusted Root Certification Authorities"
-================ Certificate 0 ================
-Serial Number: 72696afcd5edce864658141cb588a3a8
-Issuer: CN=WinDev1712Eval
- NotBefore: 12/3/2017 9:55 PM
- NotAfter: 4/5/3017 9:55 PM
-Subject: CN=WinDev1712Eval
-Signature matches Public Key
-Root Certificate: Subject matches Issuer
-Cert Hash(sha1): ef56cf1f0052b3ff7a1c834cfa3d71ea0d72c04e
-  Key Container = a3815d1a-0473-4a96-9375-cf18cc03b2f5
-  Provider = Microsoft RSA SChannel Cryptographic Provider
-Missing stored keyset
-
-Root "other"
-================ Certificate 0 ================
-Serial Number: 214817429841748bbbcccca`
-	serials, err := win.readCertSerials(in)
+	all, err := Platform().List(&ListOptions{Trusted: true})
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(serials) != 2 {
-		t.Errorf("got %d serials", len(serials))
+	if len(all) == 0 {
+		t.Fatal("expected certificates")
 	}
-	ans := []string{
-		"72696afcd5edce864658141cb588a3a8",
-		"214817429841748bbbcccca",
+
+	// LocalMachine has every root, CurrentUser inherits them but we only read
+	// what's stored in each location.
+	if err := SetScope(ScopeSystem); err != nil {
+		t.Fatal(err)
 	}
-	if !reflect.DeepEqual(serials, ans) {
-		t.Errorf("got %q", serials)
+	system, err := Platform().List(&ListOptions{Trusted: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(system) == 0 || len(system) > len(all) {
+		t.Errorf("got %d system certificates, %d total", len(system), len(all))
 	}
 }
 
@@ -69,3 +57,45 @@ func TestStoreWindows__getInfo(t *testing.T) {
 		t.Error("blank Version")
 	}
 }
+
+func TestStoreWindows__targets(t *testing.T) {
+	defer func() {
+		SetScope(ScopeAll)
+		enterpriseStores = false
+	}()
+
+	names := func(ts []windowsTarget) []string {
+		var out []string
+		for i := range ts {
+			out = append(out, ts[i].String())
+		}
+		return out
+	}
+	has := func(ts []windowsTarget, name string) bool {
+		for _, n := range names(ts) {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ts := windowsTargets(true); len(ts) != 4 || has(ts, `LocalMachine\CA`) {
+		t.Errorf("got %v", names(ts))
+	}
+
+	IncludeEnterpriseStores()
+	ts := windowsTargets(true)
+	if !has(ts, `CurrentUser\CA`) || !has(ts, `LocalMachine\CA`) || !has(ts, `LocalMachineEnterprise\NTAuth`) {
+		t.Errorf("got %v", names(ts))
+	}
+	if ts := windowsTargets(false); !has(ts, `LocalMachineEnterprise\NTAuth`) {
+		t.Errorf("got %v", names(ts))
+	}
+
+	// NTAuth is machine wide
+	SetScope(ScopeUser)
+	if ts := windowsTargets(true); has(ts, `LocalMachineEnterprise\NTAuth`) || len(ts) != 3 {
+		t.Errorf("got %v", names(ts))
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testca mints root, intermediate and leaf certificates on the fly
+// so tests don't depend on the certificates installed on a machine.
+package testca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+var (
+	// defaultValidity is how long certificates are valid for without Options.NotAfter
+	defaultValidity = 365 * 24 * time.Hour
+
+	serialLimit = new(big.Int).Lsh(big.NewInt(1), 128)
+)
+
+// Options changes the certificates created, every field is optional.
+type Options struct {
+	Country      string
+	Organization string
+
+	// NotBefore defaults to an hour ago and NotAfter to a year after NotBefore
+	NotBefore time.Time
+	NotAfter  time.Time
+
+	// RSABits creates an RSA key of the given size, otherwise ECDSA P-256 is used
+	RSABits int
+
+	ExtKeyUsage []x509.ExtKeyUsage
+
+	// SerialNumber is random (128 bits) if unset
+	SerialNumber *big.Int
+}
+
+// CA is a certificate and private key which can issue other certificates
+type CA struct {
+	Certificate *x509.Certificate
+	Key         crypto.Signer
+}
+
+// NewRoot creates a self-signed root CA with `name` as its CommonName
+func NewRoot(name string, opts *Options) (*CA, error) {
+	tmpl, key, err := template(name, opts)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.IsCA = true
+	tmpl.BasicConstraintsValid = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	cert, err := create(tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{cert, key}, nil
+}
+
+// NewRoots creates n self-signed roots named "<prefix> <i>", which share
+// one key so thousands can be made quickly (e.g. for benchmarks).
+func NewRoots(prefix string, n int, opts *Options) ([]*x509.Certificate, error) {
+	key, err := newKey(opts)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*x509.Certificate, n)
+	for i := range out {
+		tmpl, err := newTemplate(fmt.Sprintf("%s %d", prefix, i), opts)
+		if err != nil {
+			return nil, err
+		}
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		if out[i], err = create(tmpl, tmpl, key.Public(), key); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// NewIntermediate creates an intermediate CA signed by ca
+func (ca *CA) NewIntermediate(name string, opts *Options) (*CA, error) {
+	tmpl, key, err := template(name, opts)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.IsCA = true
+	tmpl.BasicConstraintsValid = true
+	tmpl.MaxPathLenZero = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	cert, err := create(tmpl, ca.Certificate, key.Public(), ca.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{cert, key}, nil
+}
+
+// CrossSign issues a certificate for other's subject and key signed by ca,
+// as when one root cross-signs another.
+func (ca *CA) CrossSign(other *CA) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, serialLimit)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               other.Certificate.Subject,
+		NotBefore:             other.Certificate.NotBefore,
+		NotAfter:              other.Certificate.NotAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              other.Certificate.KeyUsage,
+	}
+	return create(tmpl, ca.Certificate, other.Key.Public(), ca.Key)
+}
+
+// NewLeaf creates a server certificate for dnsName signed by ca
+func (ca *CA) NewLeaf(dnsName string, opts *Options) (*x509.Certificate, crypto.Signer, error) {
+	tmpl, key, err := template(dnsName, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl.DNSNames = []string{dnsName}
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	if len(tmpl.ExtKeyUsage) == 0 {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+
+	cert, err := create(tmpl, ca.Certificate, key.Public(), ca.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// Hierarchy is a root, an intermediate it issued and a leaf issued by the intermediate
+type Hierarchy struct {
+	Root         *CA
+	Intermediate *CA
+
+	Leaf    *x509.Certificate
+	LeafKey crypto.Signer
+}
+
+// NewHierarchy creates a root, intermediate and leaf for `dnsName`, opts
+// are applied to the root and intermediate.
+func NewHierarchy(dnsName string, opts *Options) (*Hierarchy, error) {
+	root, err := NewRoot(dnsName+" Root CA", opts)
+	if err != nil {
+		return nil, err
+	}
+	inter, err := root.NewIntermediate(dnsName+" Intermediate CA", opts)
+	if err != nil {
+		return nil, err
+	}
+	leaf, key, err := inter.NewLeaf(dnsName, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Hierarchy{
+		Root:         root,
+		Intermediate: inter,
+		Leaf:         leaf,
+		LeafKey:      key,
+	}, nil
+}
+
+// Chain returns the leaf, intermediate and root certificates
+func (h *Hierarchy) Chain() []*x509.Certificate {
+	return []*x509.Certificate{h.Leaf, h.Intermediate.Certificate, h.Root.Certificate}
+}
+
+func template(name string, opts *Options) (*x509.Certificate, crypto.Signer, error) {
+	tmpl, err := newTemplate(name, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := newKey(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tmpl, key, nil
+}
+
+func newTemplate(name string, opts *Options) (*x509.Certificate, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	serial := opts.SerialNumber
+	if serial == nil {
+		var err error
+		if serial, err = rand.Int(rand.Reader, serialLimit); err != nil {
+			return nil, err
+		}
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName: name,
+		},
+		NotBefore:   opts.NotBefore,
+		NotAfter:    opts.NotAfter,
+		ExtKeyUsage: opts.ExtKeyUsage,
+	}
+	if opts.Country != "" {
+		tmpl.Subject.Country = []string{opts.Country}
+	}
+	if opts.Organization != "" {
+		tmpl.Subject.Organization = []string{opts.Organization}
+	}
+	if tmpl.NotBefore.IsZero() {
+		tmpl.NotBefore = time.Now().Add(-1 * time.Hour)
+	}
+	if tmpl.NotAfter.IsZero() {
+		tmpl.NotAfter = tmpl.NotBefore.Add(defaultValidity)
+	}
+	return tmpl, nil
+}
+
+func newKey(opts *Options) (crypto.Signer, error) {
+	if opts != nil && opts.RSABits > 0 {
+		return rsa.GenerateKey(rand.Reader, opts.RSABits)
+	}
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+func create(tmpl, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) (*x509.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, signer)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
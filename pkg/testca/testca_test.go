@@ -0,0 +1,93 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testca
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTestCA__NewHierarchy(t *testing.T) {
+	h, err := NewHierarchy("example.com", &Options{Country: "US"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(h.Root.Certificate)
+	inters := x509.NewCertPool()
+	inters.AddCert(h.Intermediate.Certificate)
+	chains, err := h.Leaf.Verify(x509.VerifyOptions{
+		DNSName:       "example.com",
+		Roots:         roots,
+		Intermediates: inters,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chains) != 1 || len(chains[0]) != 3 {
+		t.Errorf("got %d chains", len(chains))
+	}
+
+	if c := h.Root.Certificate.Subject.Country; len(c) != 1 || c[0] != "US" {
+		t.Errorf("got %q", c)
+	}
+	if len(h.Chain()) != 3 || h.Chain()[0] != h.Leaf {
+		t.Errorf("got %v", h.Chain())
+	}
+}
+
+func TestTestCA__options(t *testing.T) {
+	notAfter := time.Now().Add(-24 * time.Hour)
+	root, err := NewRoot("expired", &Options{
+		NotBefore: notAfter.Add(-48 * time.Hour),
+		NotAfter:  notAfter,
+		RSABits:   1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !root.Certificate.NotAfter.Equal(notAfter.Truncate(time.Second)) {
+		t.Errorf("got %v", root.Certificate.NotAfter)
+	}
+	key, ok := root.Certificate.PublicKey.(*rsa.PublicKey)
+	if !ok || key.N.BitLen() != 1024 {
+		t.Errorf("got %T", root.Certificate.PublicKey)
+	}
+}
+
+func TestTestCA__NewRoots(t *testing.T) {
+	roots, err := NewRoots("Synthetic Root", 3, &Options{Organization: "Bench"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 3 {
+		t.Fatalf("got %d roots", len(roots))
+	}
+	for i := range roots {
+		if roots[i].Subject.CommonName != fmt.Sprintf("Synthetic Root %d", i) || roots[i].Subject.Organization[0] != "Bench" {
+			t.Errorf("got %v", roots[i].Subject)
+		}
+		if err := roots[i].CheckSignatureFrom(roots[i]); err != nil {
+			t.Errorf("%d: %v", i, err)
+		}
+	}
+	if roots[0].SerialNumber.Cmp(roots[1].SerialNumber) == 0 {
+		t.Error("expected unique serials")
+	}
+}
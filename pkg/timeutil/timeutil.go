@@ -0,0 +1,105 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package timeutil formats the dates and times cert-manage prints, so every
+// command shows them in the same zone and layout whatever the machine's
+// locale or timezone.
+package timeutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// location dates and times are shown in, certificates are read in UTC
+	location = time.UTC
+
+	// dateLayout and timeLayout are used for dates (e.g. a certificate's
+	// expiry in a table) and full timestamps
+	dateLayout = "2006-01-02"
+	timeLayout = "2006-01-02 15:04:05 MST"
+
+	// formats are the layouts of each -time-format, as a date and a time
+	formats = map[string][2]string{
+		"date":    {"2006-01-02", "2006-01-02 15:04:05 MST"},
+		"rfc3339": {time.RFC3339, time.RFC3339},
+	}
+
+	// isoLayouts are the forms of ISO 8601 times found in property lists,
+	// newer macOS versions write fractional seconds and numeric zones
+	isoLayouts = []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05.999999999Z0700",
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02",
+	}
+)
+
+// UseUTC shows dates and times in UTC, which is the default
+func UseUTC() {
+	location = time.UTC
+}
+
+// UseLocal shows dates and times in the machine's timezone
+func UseLocal() {
+	location = time.Local
+}
+
+// GetFormats returns the names SetFormat accepts
+func GetFormats() []string {
+	return []string{"date", "rfc3339"}
+}
+
+// SetFormat changes the layout dates and times are shown with. "date" (the
+// default) shows 2006-01-02 and "rfc3339" shows RFC 3339 timestamps.
+func SetFormat(name string) error {
+	f, ok := formats[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown time format %q, options: %s", name, strings.Join(GetFormats(), ", "))
+	}
+	dateLayout, timeLayout = f[0], f[1]
+	return nil
+}
+
+// Date formats t as a date, e.g. for a certificate's expiry
+func Date(t time.Time) string {
+	return t.In(location).Format(dateLayout)
+}
+
+// Time formats t with the time of day
+func Time(t time.Time) string {
+	return t.In(location).Format(timeLayout)
+}
+
+// Stamp returns the name backups taken at t are stored under. It's the Unix
+// time, so the names sort by when they were taken in any zone or locale.
+func Stamp(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// ParseISO8601 reads the ISO 8601 times property lists (and other Apple
+// tools) write. Fractional seconds and a Z, +hh:mm or +hhmm zone are
+// optional, times without a zone are read as UTC.
+func ParseISO8601(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for i := range isoLayouts {
+		if t, err := time.Parse(isoLayouts[i], s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unable to read %q as an ISO 8601 time", s)
+}
@@ -0,0 +1,77 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timeutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeutil__format(t *testing.T) {
+	defer func() {
+		UseUTC()
+		SetFormat("date")
+	}()
+	when := time.Date(2021, 6, 30, 23, 30, 0, 0, time.FixedZone("EST", -5*60*60))
+
+	if ans := Date(when); ans != "2021-07-01" {
+		t.Errorf("got %s", ans)
+	}
+	if ans := Time(when); ans != "2021-07-01 04:30:00 UTC" {
+		t.Errorf("got %s", ans)
+	}
+	if err := SetFormat("RFC3339"); err != nil {
+		t.Fatal(err)
+	}
+	if ans := Date(when); ans != "2021-07-01T04:30:00Z" {
+		t.Errorf("got %s", ans)
+	}
+	if err := SetFormat("iso"); err == nil {
+		t.Error("expected an error")
+	}
+
+	UseLocal()
+	if ans, want := Time(when), when.In(time.Local).Format(time.RFC3339); ans != want {
+		t.Errorf("got %s, want %s", ans, want)
+	}
+}
+
+func TestTimeutil__Stamp(t *testing.T) {
+	if ans := Stamp(time.Unix(1530000000, 0)); ans != "1530000000" {
+		t.Errorf("got %s", ans)
+	}
+}
+
+func TestTimeutil__ParseISO8601(t *testing.T) {
+	want := time.Date(2018, 3, 1, 17, 21, 4, 0, time.UTC)
+	cases := map[string]time.Time{
+		"2018-03-01T17:21:04Z":         want,
+		" 2018-03-01T17:21:04Z\n":      want,
+		"2018-03-01T17:21:04.25Z":      want.Add(250 * time.Millisecond),
+		"2018-03-01T18:21:04+01:00":    want,
+		"2018-03-01T18:21:04.000+0100": want,
+		"2018-03-01T17:21:04":          want,
+		"2018-03-01":                   time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for in, expected := range cases {
+		ans, err := ParseISO8601(in)
+		if err != nil || !ans.Equal(expected) {
+			t.Errorf("%q: got %v, err=%v", in, ans, err)
+		}
+	}
+	if _, err := ParseISO8601("March 1st"); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -16,15 +16,14 @@ package ui
 
 import (
 	"crypto/x509"
-	"fmt"
 	"os"
 )
 
 // showCertsOnCli outputs the slice of certificates in `cfg.Format` to stdout
 func showCertsOnCli(certs []*x509.Certificate, cfg *Config) error {
-	p, ok := getPrinter(cfg.Format)
-	if !ok {
-		return fmt.Errorf("Unknown format %s specified", cfg.Format)
+	p, err := getPrinter(cfg)
+	if err != nil {
+		return err
 	}
 	p.write(os.Stdout, certs)
 	return nil
@@ -0,0 +1,72 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ui
+
+import (
+	"crypto/x509"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+var (
+	// expiringSoon is how far ahead of NotAfter a row is highlighted as
+	// expiring, the same as 'audit' warns at
+	expiringSoon = 90 * 24 * time.Hour
+
+	colorRed     = "\x1b[31m"
+	colorYellow  = "\x1b[33m"
+	colorMagenta = "\x1b[35m"
+	colorReset   = "\x1b[0m"
+)
+
+// useColor is true when stdout is a terminal which shows ANSI colors and
+// they weren't disabled with -no-color or NO_COLOR (https://no-color.org)
+func useColor(cfg *Config) bool {
+	if cfg.NoColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	// The windows console only shows colors once a program enables them,
+	// Windows Terminal and terminals setting TERM (e.g. mintty) always do.
+	if runtime.GOOS == "windows" && os.Getenv("WT_SESSION") == "" && os.Getenv("TERM") == "" {
+		return false
+	}
+	return isTerminal(os.Stdout)
+}
+
+func isTerminal(f *os.File) bool {
+	s, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return s.Mode()&os.ModeCharDevice != 0
+}
+
+// rowColor returns the color a certificate's row is highlighted with: red
+// when expired, yellow when expiring soon and magenta when it doesn't match
+// wh (if given). Empty is returned for rows which aren't highlighted.
+func rowColor(c *x509.Certificate, wh *whitelist.Whitelist, now time.Time) string {
+	switch {
+	case now.After(c.NotAfter):
+		return colorRed
+	case now.Add(expiringSoon).After(c.NotAfter):
+		return colorYellow
+	case wh != nil && !wh.Matches(c):
+		return colorMagenta
+	}
+	return ""
+}
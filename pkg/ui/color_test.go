@@ -0,0 +1,87 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ui
+
+import (
+	"bytes"
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
+)
+
+func TestUI__color(t *testing.T) {
+	now := time.Now()
+	root := func(name string, notAfter time.Time) *x509.Certificate {
+		ca, err := testca.NewRoot(name, &testca.Options{
+			NotBefore: now.Add(-365 * 24 * time.Hour),
+			NotAfter:  notAfter,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ca.Certificate
+	}
+	expired := root("A Expired Root", now.Add(-time.Hour))
+	expiring := root("B Expiring Root", now.Add(7*24*time.Hour))
+	other := root("C Other Root", now.Add(5*365*24*time.Hour))
+	kept := root("D Kept Root", now.Add(5*365*24*time.Hour))
+	certs := []*x509.Certificate{kept, other, expiring, expired}
+
+	wh := whitelist.FromCertificates([]*x509.Certificate{expired, expiring, kept})
+	if c := rowColor(other, &wh, now); c != colorMagenta {
+		t.Errorf("got %q", c)
+	}
+	if c := rowColor(other, nil, now); c != "" {
+		t.Errorf("got %q", c)
+	}
+
+	p, err := newTablePrinter(&Config{NoColor: true, Whitelist: &wh}, "sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plain bytes.Buffer
+	p.write(&plain, certs)
+
+	p.color = true
+	var colored bytes.Buffer
+	p.write(&colored, certs)
+
+	lines := strings.Split(strings.TrimSpace(colored.String()), "\n")
+	expected := []string{"", colorRed, colorYellow, colorMagenta, ""}
+	if len(lines) != len(expected) {
+		t.Fatalf("got %q", colored.String())
+	}
+	for i := range lines {
+		if expected[i] == "" && strings.Contains(lines[i], "\x1b[") {
+			t.Errorf("line %d shouldn't be colored: %q", i, lines[i])
+		}
+		if expected[i] != "" && (!strings.HasPrefix(lines[i], expected[i]) || !strings.HasSuffix(lines[i], colorReset)) {
+			t.Errorf("line %d: got %q", i, lines[i])
+		}
+	}
+
+	// colors don't change the alignment
+	stripped := colored.String()
+	for _, c := range []string{colorRed, colorYellow, colorMagenta, colorReset} {
+		stripped = strings.Replace(stripped, c, "", -1)
+	}
+	if stripped != plain.String() {
+		t.Errorf("got\n%s\nexpected\n%s", stripped, plain.String())
+	}
+}
@@ -16,9 +16,9 @@ package ui
 
 import (
 	"fmt"
-	"os/exec"
 	"runtime"
 
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
 	"github.com/adamdecaf/cert-manage/pkg/ui/server"
 )
 
@@ -32,7 +32,7 @@ func Open() error {
 	}
 
 	if command != "" {
-		cmd := exec.Command(command, server.Address())
+		cmd := interrupt.CommandTimeout(0, command, server.Address())
 		_, err := cmd.CombinedOutput()
 		if err != nil {
 			fmt.Printf("ERROR: while loading ui, err=%v\n", err)
@@ -15,17 +15,21 @@
 package ui
 
 import (
+	"bytes"
 	"crypto/x509"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
+	"sort"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/adamdecaf/cert-manage/pkg/certutil"
-	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
 )
 
 var (
@@ -60,44 +64,351 @@ type printer interface {
 	write(io.Writer, []*x509.Certificate)
 }
 
-func getPrinter(name string) (printer, bool) {
-	p, ok := printers[strings.ToLower(name)]
-	return p, ok
+func getPrinter(cfg *Config) (printer, error) {
+	p, ok := printers[strings.ToLower(cfg.Format)]
+	if !ok {
+		return nil, fmt.Errorf("Unknown format %s specified", cfg.Format)
+	}
+	algo, err := getFingerprintAlgo(cfg.FingerprintAlgo)
+	if err != nil {
+		return nil, err
+	}
+	switch p.(type) {
+	case tablePrinter:
+		return newTablePrinter(cfg, algo)
+	case shortPrinter:
+		return shortPrinter{fingerprintAlgo: algo, issuance: cfg.Issuance, distrustAfter: cfg.DistrustAfter}, nil
+	}
+	return p, nil
+}
+
+// checkFormatOptions returns an error if an option is given which the
+// format doesn't use, rather than silently ignoring it.
+func checkFormatOptions(cfg *Config) error {
+	format := strings.ToLower(cfg.Format)
+	if format == "table" {
+		return nil
+	}
+	if format == "" {
+		format = defaultFormat
+	}
+	switch {
+	case len(cfg.Columns) > 0:
+		return fmt.Errorf("-columns can only be used with '-format table', not %s", format)
+	case cfg.Sort != "":
+		return fmt.Errorf("-sort can only be used with '-format table', not %s", format)
+	case cfg.Wide:
+		return fmt.Errorf("-wide can only be used with '-format table', not %s", format)
+	case cfg.FingerprintAlgo != "" && format != defaultFormat:
+		return fmt.Errorf("-fingerprint-algo can only be used with '-format table' or '-format %s', not %s", defaultFormat, format)
+	}
+	return nil
+}
+
+var fingerprintAlgos = []string{"sha256", "sha1", "spki-sha256"}
+
+// GetFingerprintAlgos returns the fingerprint algorithms certificates can be shown with
+func GetFingerprintAlgos() []string {
+	return fingerprintAlgos
+}
+
+func getFingerprintAlgo(name string) (string, error) {
+	if name == "" {
+		return fingerprintAlgos[0], nil
+	}
+	for i := range fingerprintAlgos {
+		if strings.EqualFold(fingerprintAlgos[i], name) {
+			return fingerprintAlgos[i], nil
+		}
+	}
+	return "", fmt.Errorf("Unknown fingerprint algorithm %q, options: %s", name, strings.Join(fingerprintAlgos, ", "))
+}
+
+// fingerprintName returns the display name for a fingerprint algorithm
+func fingerprintName(algo string) string {
+	switch algo {
+	case "sha1":
+		return "SHA1"
+	case "spki-sha256":
+		return "SPKI SHA256"
+	}
+	return "SHA256"
+}
+
+// issuedCount returns how many certificates c issued in the last 12 months,
+// or "-" when that isn't known.
+func issuedCount(c *x509.Certificate, issuance map[string]int) string {
+	if n, ok := issuance[certutil.GetHexSHA256Fingerprint(*c)]; ok {
+		return fmt.Sprintf("%d", n)
+	}
+	return "-"
+}
+
+// distrustAfter returns the date after which TLS certificates issued by c
+// aren't trusted, or "" when it has none.
+func distrustAfter(c *x509.Certificate, dates map[string]time.Time) string {
+	if when, ok := dates[certutil.GetHexSHA256Fingerprint(*c)]; ok {
+		return timeutil.Date(when)
+	}
+	return ""
+}
+
+// anyDistrustAfter returns true if any of certs has a distrust-after date
+func anyDistrustAfter(certs []*x509.Certificate, dates map[string]time.Time) bool {
+	for i := range certs {
+		if distrustAfter(certs[i], dates) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// sameKeyGroups maps the SHA256 fingerprint of each certificate sharing its
+// key with others (a cross-signed or reissued CA) to every certificate of
+// that key.
+func sameKeyGroups(certs []*x509.Certificate) map[string][]*x509.Certificate {
+	out := make(map[string][]*x509.Certificate)
+	groups := certutil.SameKeyGroups(certs)
+	for i := range groups {
+		for j := range groups[i] {
+			out[certutil.GetHexSHA256Fingerprint(*groups[i][j])] = groups[i]
+		}
+	}
+	return out
+}
+
+// fingerprint returns a certificate's fingerprint using `algo`
+func fingerprint(c *x509.Certificate, algo string) string {
+	switch algo {
+	case "sha1":
+		return certutil.GetHexSHA1Fingerprint(*c)
+	case "spki-sha256":
+		return certutil.GetBase64SPKISHA256Fingerprint(*c)
+	}
+	return certutil.GetHexSHA256Fingerprint(*c)
+}
+
+// tableColumn is a named column which can be rendered by tablePrinter
+type tableColumn struct {
+	name   string
+	header string
+	value  func(*x509.Certificate, tablePrinter) string
+}
+
+var (
+	tableColumns = []tableColumn{
+		{"subject", "Subject", func(c *x509.Certificate, _ tablePrinter) string {
+			return certutil.StringifyPKIXName(c.Subject)
+		}},
+		{"issuer", "Issuer", func(c *x509.Certificate, _ tablePrinter) string {
+			return certutil.StringifyPKIXName(c.Issuer)
+		}},
+		{"algorithm", "Public Key Algorithm", func(c *x509.Certificate, _ tablePrinter) string {
+			return certutil.StringifyPubKeyAlgo(c.PublicKeyAlgorithm)
+		}},
+		{"fingerprint", "Fingerprint", func(c *x509.Certificate, p tablePrinter) string {
+			fp := fingerprint(c, p.fingerprintAlgo)
+			if p.wide {
+				return fp
+			}
+			return fp[:fingerprintPreviewLength]
+		}},
+		{"notbefore", "Not Before", func(c *x509.Certificate, _ tablePrinter) string {
+			return timeutil.Date(c.NotBefore)
+		}},
+		{"expiry", "Not After", func(c *x509.Certificate, _ tablePrinter) string {
+			return timeutil.Date(c.NotAfter)
+		}},
+		{"issued", "Issued (12mo)", func(c *x509.Certificate, p tablePrinter) string {
+			return issuedCount(c, p.issuance)
+		}},
+		{"distrustafter", "Distrust After", func(c *x509.Certificate, p tablePrinter) string {
+			return distrustAfter(c, p.distrustAfter)
+		}},
+		{"samekey", "Same Key", func(c *x509.Certificate, p tablePrinter) string {
+			group := p.sameKey[certutil.GetHexSHA256Fingerprint(*c)]
+			if len(group) == 0 {
+				return ""
+			}
+			spki := certutil.GetBase64SPKISHA256Fingerprint(*c)
+			return fmt.Sprintf("%s (%d certs)", spki[:8], len(group))
+		}},
+	}
+
+	// alternate names accepted for -columns and -sort
+	tableColumnAliases = map[string]string{
+		"algo":     "algorithm",
+		"notafter": "expiry",
+	}
+)
+
+// defaultTableColumns returns the columns shown without -columns, "issued"
+// is only included when issuance has been looked up. "samekey" and
+// "distrustafter" are added by write when a listed certificate has one.
+func defaultTableColumns(issuance map[string]int) []tableColumn {
+	var out []tableColumn
+	for i := range tableColumns {
+		if tableColumns[i].name == "issued" && issuance == nil {
+			continue
+		}
+		if tableColumns[i].name == "samekey" || tableColumns[i].name == "distrustafter" {
+			continue
+		}
+		out = append(out, tableColumns[i])
+	}
+	return out
+}
+
+// GetTableColumns returns the names of each column tablePrinter can show
+func GetTableColumns() []string {
+	out := make([]string, len(tableColumns))
+	for i := range tableColumns {
+		out[i] = tableColumns[i].name
+	}
+	return out
+}
+
+func findTableColumn(name string) (tableColumn, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := tableColumnAliases[name]; ok {
+		name = alias
+	}
+	for i := range tableColumns {
+		if tableColumns[i].name == name {
+			return tableColumns[i], true
+		}
+	}
+	return tableColumn{}, false
 }
 
 // tablePrinter outputs a nicely formatted table of the certs found. This uses golang's
 // native text/tabwriter package to align based on the rows given to it.
-type tablePrinter struct{}
+type tablePrinter struct {
+	columns []tableColumn
+	sortBy  *tableColumn
+	wide    bool
 
-func (tablePrinter) close() {}
-func (tablePrinter) write(fd io.Writer, certs []*x509.Certificate) {
-	w := tabwriter.NewWriter(fd, 0, 0, 1, ' ', 0)
-	fmt.Fprintln(w, "Subject\tIssuer\tPublic Key Algorithm\tSHA256 Fingerprint\tNot Before\tNot After")
-	defer func() {
-		err := w.Flush()
-		if err != nil {
-			fmt.Printf("error flushing output table - %s\n", err)
+	fingerprintAlgo string
+	issuance        map[string]int
+	distrustAfter   map[string]time.Time
+
+	// color highlights rows, see rowColor
+	color     bool
+	whitelist *whitelist.Whitelist
+
+	// sameKey is filled in by write, see sameKeyGroups
+	defaultColumns bool
+	sameKey        map[string][]*x509.Certificate
+}
+
+func newTablePrinter(cfg *Config, algo string) (tablePrinter, error) {
+	p := tablePrinter{
+		columns:         defaultTableColumns(cfg.Issuance),
+		defaultColumns:  true,
+		wide:            cfg.Wide,
+		fingerprintAlgo: algo,
+		issuance:        cfg.Issuance,
+		distrustAfter:   cfg.DistrustAfter,
+		color:           useColor(cfg),
+		whitelist:       cfg.Whitelist,
+	}
+	if len(cfg.Columns) > 0 {
+		p.columns = nil
+		p.defaultColumns = false
+		for i := range cfg.Columns {
+			col, ok := findTableColumn(cfg.Columns[i])
+			if !ok {
+				return p, fmt.Errorf("Unknown column %q, options: %s", cfg.Columns[i], strings.Join(GetTableColumns(), ", "))
+			}
+			p.columns = append(p.columns, col)
+		}
+	}
+	if cfg.Sort != "" {
+		col, ok := findTableColumn(cfg.Sort)
+		if !ok {
+			return p, fmt.Errorf("Unknown sort column %q, options: %s", cfg.Sort, strings.Join(GetTableColumns(), ", "))
 		}
-	}()
+		p.sortBy = &col
+	}
+	return p, nil
+}
 
-	rows := make([]string, len(certs))
-	for i := range certs {
-		fingerprint := certutil.GetHexSHA256Fingerprint(*certs[i])
+func (tablePrinter) close() {}
+func (p tablePrinter) write(fd io.Writer, certs []*x509.Certificate) {
+	if len(p.columns) == 0 {
+		p.columns = defaultTableColumns(p.issuance)
+		p.defaultColumns = true
+	}
+	p.sameKey = sameKeyGroups(certs)
+	if p.defaultColumns && anyDistrustAfter(certs, p.distrustAfter) {
+		col, _ := findTableColumn("distrustafter")
+		p.columns = append(p.columns, col)
+	}
+	if p.defaultColumns && len(p.sameKey) > 0 {
+		col, _ := findTableColumn("samekey")
+		p.columns = append(p.columns, col)
+	}
 
-		c1 := certutil.StringifyPKIXName(certs[i].Subject)
-		c2 := certutil.StringifyPKIXName(certs[i].Issuer)
-		c3 := certutil.StringifyPubKeyAlgo(certs[i].PublicKeyAlgorithm)
-		c4 := fingerprint[:fingerprintPreviewLength]
+	headers := make([]string, len(p.columns))
+	for i := range p.columns {
+		headers[i] = p.columns[i].header
+		if p.columns[i].name == "fingerprint" {
+			headers[i] = fingerprintName(p.fingerprintAlgo) + " Fingerprint"
+		}
+	}
 
-		c5 := certs[i].NotBefore.Format("2006-01-02")
-		c6 := certs[i].NotAfter.Format("2006-01-02")
+	// Sort by the chosen column, otherwise each rendered row
+	if p.sortBy != nil {
+		sortBy, full := *p.sortBy, p
+		full.wide = true
+		sorted := make([]*x509.Certificate, len(certs))
+		copy(sorted, certs)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sortBy.value(sorted[i], full) < sortBy.value(sorted[j], full)
+		})
+		certs = sorted
+	}
 
-		rows[i] = fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s", c1, c2, c3, c4, c5, c6)
+	type row struct {
+		text, color string
+	}
+	now := time.Now()
+	rows := make([]row, len(certs))
+	for i := range certs {
+		cols := make([]string, len(p.columns))
+		for j := range p.columns {
+			cols[j] = p.columns[j].value(certs[i], p)
+		}
+		rows[i].text = strings.Join(cols, "\t")
+		if p.color {
+			rows[i].color = rowColor(certs[i], p.whitelist, now)
+		}
 	}
 
-	file.SortNames(rows)
+	if p.sortBy == nil {
+		sort.SliceStable(rows, func(i, j int) bool {
+			return strings.ToLower(rows[i].text) < strings.ToLower(rows[j].text)
+		})
+	}
+
+	// Colors are added once aligned, as tabwriter counts escape codes as text
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
 	for i := range rows {
-		fmt.Fprintln(w, rows[i])
+		fmt.Fprintln(w, rows[i].text)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Printf("error flushing output table - %s\n", err)
+		return
+	}
+	lines := strings.SplitAfter(buf.String(), "\n")
+	for i := range lines {
+		if i > 0 && i <= len(rows) && rows[i-1].color != "" {
+			fmt.Fprint(fd, rows[i-1].color+strings.TrimSuffix(lines[i], "\n")+colorReset+"\n")
+			continue
+		}
+		fmt.Fprint(fd, lines[i])
 	}
 }
 
@@ -111,7 +422,7 @@ func (p opensslPrinter) printCertificate(w io.Writer, cert []*x509.Certificate)
 		return err
 	}
 
-	out, err := exec.Command("openssl", "x509", "-in", p.tmp.Name(), "-noout", "-text").CombinedOutput()
+	out, err := interrupt.Command("openssl", "x509", "-in", p.tmp.Name(), "-noout", "-text").CombinedOutput()
 	if err != nil {
 		return err
 	}
@@ -148,22 +459,45 @@ func (p opensslPrinter) close() {
 
 // shortPrinter very verbosly prints out the ecah certificate's information
 // to stdout. This isn't very useful for machine parsing or small screen displays.
-type shortPrinter struct{}
+type shortPrinter struct {
+	fingerprintAlgo string
+	issuance        map[string]int
+	distrustAfter   map[string]time.Time
+}
 
 func (shortPrinter) close() {}
-func (shortPrinter) write(w io.Writer, certs []*x509.Certificate) {
+func (p shortPrinter) write(w io.Writer, certs []*x509.Certificate) {
+	sameKey := sameKeyGroups(certs)
 	for i := range certs {
 		fmt.Fprintf(w, "Certificate\n")
-		fmt.Fprintf(w, "  SHA256 Fingerprint: %s\n", certutil.GetHexSHA256Fingerprint(*certs[i]))
+		fmt.Fprintf(w, "  %s Fingerprint: %s\n", fingerprintName(p.fingerprintAlgo), fingerprint(certs[i], p.fingerprintAlgo))
 		fmt.Fprintf(w, "  SerialNumber: %d\n", certs[i].SerialNumber)
 		fmt.Fprintf(w, "  Subject: %s\n", certutil.StringifyPKIXName(certs[i].Subject))
 		fmt.Fprintf(w, "  Issuer: %s\n", certutil.StringifyPKIXName(certs[i].Issuer))
-		fmt.Fprintf(w, "  NotBefore: %s | NotAfter: %s\n", certs[i].NotBefore, certs[i].NotAfter)
+		fmt.Fprintf(w, "  NotBefore: %s | NotAfter: %s\n", timeutil.Time(certs[i].NotBefore), timeutil.Time(certs[i].NotAfter))
 
 		if certs[i].IsCA {
 			fmt.Fprintf(w, "  IsCA: %t\n", certs[i].IsCA)
 		}
 
+		if p.issuance != nil {
+			fmt.Fprintf(w, "  Issued (last 12 months): %s\n", issuedCount(certs[i], p.issuance))
+		}
+
+		if when := distrustAfter(certs[i], p.distrustAfter); when != "" {
+			fmt.Fprintf(w, "  Distrusted for TLS certificates issued after: %s\n", when)
+		}
+
+		// The same CA listed under other certificates, e.g. cross-signed
+		if group := sameKey[certutil.GetHexSHA256Fingerprint(*certs[i])]; len(group) > 0 {
+			fmt.Fprintf(w, "  Same Key As (cross-signed or reissued):\n")
+			for j := range group {
+				if group[j] != certs[i] && !group[j].Equal(certs[i]) {
+					fmt.Fprintf(w, "    %s\n", fingerprint(group[j], p.fingerprintAlgo))
+				}
+			}
+		}
+
 		if len(certs[i].DNSNames) > 0 {
 			fmt.Fprintf(w, "  DNSNames:\n")
 			for j := range certs[i].DNSNames {
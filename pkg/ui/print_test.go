@@ -0,0 +1,291 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ui
+
+import (
+	"bytes"
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+)
+
+func TestUI__tablePrinter(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// default columns
+	p, err := getPrinter(&Config{Format: "table"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	p.write(&buf, certs)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(certs)+1 {
+		t.Errorf("got %d lines", len(lines))
+	}
+	if !strings.HasPrefix(lines[0], "Subject") {
+		t.Errorf("got %q", lines[0])
+	}
+
+	// custom columns, wide and sorted by expiry
+	p, err = getPrinter(&Config{
+		Format:  "table",
+		Columns: []string{"expiry", "fingerprint"},
+		Sort:    "notafter",
+		Wide:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	p.write(&buf, certs)
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !strings.HasPrefix(lines[0], "Not After") {
+		t.Errorf("got %q", lines[0])
+	}
+	for i := 2; i < len(lines); i++ {
+		if lines[i-1][:10] > lines[i][:10] {
+			t.Errorf("not sorted by expiry: %q then %q", lines[i-1], lines[i])
+		}
+		if fields := strings.Fields(lines[i]); len(fields[1]) != 64 {
+			t.Errorf("expected full fingerprint, got %q", fields[1])
+		}
+	}
+
+	// bad options
+	if _, err := getPrinter(&Config{Format: "table", Columns: []string{"other"}}); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := getPrinter(&Config{Format: "table", Sort: "other"}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestUI__fingerprintAlgo(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/example.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := getPrinter(&Config{Format: "short", FingerprintAlgo: "SPKI-SHA256"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	p.write(&buf, certs)
+	expected := "SPKI SHA256 Fingerprint: " + certutil.GetBase64SPKISHA256Fingerprint(*certs[0])
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("got %q", buf.String())
+	}
+
+	p, err = getPrinter(&Config{Format: "table", FingerprintAlgo: "sha1", Wide: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	p.write(&buf, certs)
+	if !strings.Contains(buf.String(), certutil.GetHexSHA1Fingerprint(*certs[0])) {
+		t.Errorf("got %q", buf.String())
+	}
+
+	if _, err := getPrinter(&Config{Format: "short", FingerprintAlgo: "md5"}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestUI__showFingerprintAlgo(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/example.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha1 := "  SHA1: " + certutil.GetHexSHA1Fingerprint(*certs[0])
+	spki := "  SPKI SHA256: " + certutil.GetBase64SPKISHA256Fingerprint(*certs[0])
+
+	var buf bytes.Buffer
+	if err := ShowCertificate(&buf, certs[0], ""); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), sha1) || !strings.Contains(buf.String(), spki) {
+		t.Errorf("got %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := ShowCertificate(&buf, certs[0], "spki-sha256"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), sha1) || !strings.Contains(buf.String(), spki) {
+		t.Errorf("got %q", buf.String())
+	}
+
+	if err := ShowCertificate(&buf, certs[0], "md5"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestUI__issuance(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/example.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// not shown unless looked up
+	p, err := getPrinter(&Config{Format: "table"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	p.write(&buf, certs)
+	if strings.Contains(buf.String(), "Issued") {
+		t.Errorf("got %q", buf.String())
+	}
+
+	issuance := map[string]int{
+		certutil.GetHexSHA256Fingerprint(*certs[0]): 1234,
+	}
+	p, err = getPrinter(&Config{Format: "table", Issuance: issuance})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	p.write(&buf, certs)
+	if !strings.Contains(buf.String(), "Issued (12mo)") || !strings.Contains(buf.String(), "1234") {
+		t.Errorf("got %q", buf.String())
+	}
+
+	p, err = getPrinter(&Config{Format: "short", Issuance: map[string]int{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	p.write(&buf, certs)
+	if !strings.Contains(buf.String(), "Issued (last 12 months): -") {
+		t.Errorf("got %q", buf.String())
+	}
+}
+
+func TestUI__sameKey(t *testing.T) {
+	old, err := testca.NewRoot("Old Root", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := testca.NewRoot("New Root", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cross, err := old.CrossSign(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs := []*x509.Certificate{old.Certificate, root.Certificate, cross}
+
+	p, err := getPrinter(&Config{Format: "table"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	p.write(&buf, certs)
+	if out := buf.String(); !strings.Contains(out, "Same Key") || strings.Count(out, "(2 certs)") != 2 {
+		t.Errorf("unexpected table:\n%s", out)
+	}
+
+	// not shown without cross-signed certificates
+	buf.Reset()
+	p.write(&buf, certs[:2])
+	if strings.Contains(buf.String(), "Same Key") {
+		t.Errorf("unexpected table:\n%s", buf.String())
+	}
+
+	p, err = getPrinter(&Config{Format: "short"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	p.write(&buf, certs)
+	out := buf.String()
+	if strings.Count(out, "Same Key As") != 2 || !strings.Contains(out, certutil.GetHexSHA256Fingerprint(*cross)) {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestUI__distrustAfter(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/example.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dates := map[string]time.Time{
+		certutil.GetHexSHA256Fingerprint(*certs[0]): time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	p, err := getPrinter(&Config{Format: "table", DistrustAfter: dates})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	p.write(&buf, certs)
+	if !strings.Contains(buf.String(), "Distrust After") || !strings.Contains(buf.String(), "2019-12-01") {
+		t.Errorf("got %q", buf.String())
+	}
+
+	// only shown when a listed certificate has a date
+	p, err = getPrinter(&Config{Format: "table", DistrustAfter: map[string]time.Time{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	p.write(&buf, certs)
+	if strings.Contains(buf.String(), "Distrust After") {
+		t.Errorf("got %q", buf.String())
+	}
+
+	p, err = getPrinter(&Config{Format: "short", DistrustAfter: dates})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	p.write(&buf, certs)
+	if !strings.Contains(buf.String(), "Distrusted for TLS certificates issued after: 2019-12-01") {
+		t.Errorf("got %q", buf.String())
+	}
+}
+
+func TestUI__checkFormatOptions(t *testing.T) {
+	cases := []struct {
+		cfg Config
+		ok  bool
+	}{
+		{Config{Format: "table", Columns: []string{"subject"}, Sort: "subject", Wide: true, FingerprintAlgo: "sha1"}, true},
+		{Config{Format: "short", FingerprintAlgo: "sha1"}, true},
+		{Config{FingerprintAlgo: "sha1"}, true},
+		{Config{Format: "openssl", NoColor: true}, true},
+		{Config{Format: "openssl", FingerprintAlgo: "sha1"}, false},
+		{Config{Format: "observatory", FingerprintAlgo: "sha1"}, false},
+		{Config{Format: "short", Columns: []string{"subject"}}, false},
+		{Config{Format: "short", Sort: "subject"}, false},
+		{Config{Format: "openssl", Wide: true}, false},
+	}
+	for i := range cases {
+		err := checkFormatOptions(&cases[i].cfg)
+		if cases[i].ok != (err == nil) {
+			t.Errorf("%d: err=%v", i, err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ui
+
+import (
+	"crypto/x509"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
+)
+
+// Report is the trust posture of every store found on a machine
+type Report struct {
+	Generated time.Time
+	Hostname  string
+
+	// ExpiringWithin is how soon before NotAfter a certificate is reported as expiring
+	ExpiringWithin time.Duration
+
+	// Whitelist is the whitelist compliance is checked against, empty if none
+	Whitelist string
+
+	Stores []ReportStore
+}
+
+// ReportStore is a single store included in a Report
+type ReportStore struct {
+	Name         string
+	Certificates []*x509.Certificate
+
+	// NonCompliant holds the certificates not matching the report's Whitelist
+	NonCompliant []*x509.Certificate
+
+	// Err is set when the store couldn't be read
+	Err error
+}
+
+type reportCert struct {
+	Subject     string
+	Fingerprint string
+	NotAfter    string
+}
+
+type reportCount struct {
+	Name  string
+	Count int
+}
+
+type reportStoreView struct {
+	Name      string
+	Err       string
+	Total     int
+	Expired   []reportCert
+	Expiring  []reportCert
+	Countries []reportCount
+
+	NonCompliant []reportCert
+}
+
+// WriteReport renders a self-contained HTML page of the report into w, there
+// are no external scripts, styles or images so it can be attached to audits.
+func WriteReport(w io.Writer, r Report) error {
+	data := struct {
+		Report
+		Views []reportStoreView
+	}{
+		Report: r,
+	}
+	for i := range r.Stores {
+		data.Views = append(data.Views, reportView(r, r.Stores[i]))
+	}
+	return reportTemplate.Execute(w, data)
+}
+
+func reportView(r Report, s ReportStore) reportStoreView {
+	v := reportStoreView{
+		Name:  s.Name,
+		Total: len(s.Certificates),
+	}
+	if s.Err != nil {
+		v.Err = s.Err.Error()
+		return v
+	}
+
+	countries := make(map[string]int)
+	for i := range s.Certificates {
+		c := s.Certificates[i]
+		switch {
+		case r.Generated.After(c.NotAfter):
+			v.Expired = append(v.Expired, toReportCert(c))
+		case r.Generated.Add(r.ExpiringWithin).After(c.NotAfter):
+			v.Expiring = append(v.Expiring, toReportCert(c))
+		}
+
+		country := "Unknown"
+		if len(c.Subject.Country) > 0 {
+			country = strings.ToUpper(c.Subject.Country[0])
+		}
+		countries[country]++
+	}
+	for k, n := range countries {
+		v.Countries = append(v.Countries, reportCount{k, n})
+	}
+	sort.Slice(v.Countries, func(i, j int) bool {
+		if v.Countries[i].Count == v.Countries[j].Count {
+			return v.Countries[i].Name < v.Countries[j].Name
+		}
+		return v.Countries[i].Count > v.Countries[j].Count
+	})
+	for i := range s.NonCompliant {
+		v.NonCompliant = append(v.NonCompliant, toReportCert(s.NonCompliant[i]))
+	}
+	return v
+}
+
+func toReportCert(c *x509.Certificate) reportCert {
+	return reportCert{
+		Subject:     certutil.StringifyPKIXName(c.Subject),
+		Fingerprint: certutil.GetHexSHA256Fingerprint(*c),
+		NotAfter:    timeutil.Date(c.NotAfter),
+	}
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!doctype html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>cert-manage report{{if .Hostname}} for {{.Hostname}}{{end}}</title>
+  <style>
+  body { font-family: sans-serif; margin: 2em; }
+  table { border-collapse: collapse; margin-bottom: 1em; }
+  th, td { border: 1px solid #CCC; padding: 4px 8px; text-align: left; }
+  th { background: #EEE; }
+  td.fp { font-family: monospace; }
+  .error { color: #A00; }
+  </style>
+</head>
+<body>
+<h1>Certificate trust report{{if .Hostname}} for {{.Hostname}}{{end}}</h1>
+<p>Generated {{.Generated.Format "2006-01-02 15:04:05 MST"}}{{if .Whitelist}}, compliance checked against {{.Whitelist}}{{end}}</p>
+
+<h2>Summary</h2>
+<table>
+<tr><th>Store</th><th>Certificates</th><th>Expired</th><th>Expiring</th>{{if .Whitelist}}<th>Not whitelisted</th>{{end}}</tr>
+{{range .Views}}{{if .Err}}
+<tr><td>{{.Name}}</td><td colspan="{{if $.Whitelist}}4{{else}}3{{end}}" class="error">{{.Err}}</td></tr>
+{{else}}
+<tr><td><a href="#{{.Name}}">{{.Name}}</a></td><td>{{.Total}}</td><td>{{len .Expired}}</td><td>{{len .Expiring}}</td>{{if $.Whitelist}}<td>{{len .NonCompliant}}</td>{{end}}</tr>
+{{end}}{{end}}
+</table>
+
+{{range .Views}}{{if not .Err}}
+<h2 id="{{.Name}}">{{.Name}}</h2>
+<h3>Countries</h3>
+<table>
+<tr><th>Country</th><th>Certificates</th></tr>
+{{range .Countries}}<tr><td>{{.Name}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+{{if .Expired}}<h3>Expired</h3>
+<table>
+<tr><th>Subject</th><th>SHA256 Fingerprint</th><th>Not After</th></tr>
+{{range .Expired}}<tr><td>{{.Subject}}</td><td class="fp">{{.Fingerprint}}</td><td>{{.NotAfter}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Expiring}}<h3>Expiring</h3>
+<table>
+<tr><th>Subject</th><th>SHA256 Fingerprint</th><th>Not After</th></tr>
+{{range .Expiring}}<tr><td>{{.Subject}}</td><td class="fp">{{.Fingerprint}}</td><td>{{.NotAfter}}</td></tr>
+{{end}}</table>
+{{end}}{{if .NonCompliant}}<h3>Not whitelisted</h3>
+<table>
+<tr><th>Subject</th><th>SHA256 Fingerprint</th><th>Not After</th></tr>
+{{range .NonCompliant}}<tr><td>{{.Subject}}</td><td class="fp">{{.Fingerprint}}</td><td>{{.NotAfter}}</td></tr>
+{{end}}</table>
+{{end}}{{end}}{{end}}
+</body>
+</html>
+`))
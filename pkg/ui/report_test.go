@@ -0,0 +1,74 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ui
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+func TestUI__WriteReport(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := Report{
+		Generated:      certs[0].NotAfter.Add(-24 * time.Hour),
+		ExpiringWithin: 90 * 24 * time.Hour,
+		Whitelist:      "wh.yaml",
+		Stores: []ReportStore{
+			{Name: "linux", Certificates: certs, NonCompliant: certs[:1]},
+			{Name: "java", Err: errors.New("keytool <not found>")},
+		},
+	}
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, s := range []string{
+		"compliance checked against wh.yaml",
+		"<h2 id=\"linux\">linux</h2>",
+		"Not whitelisted",
+		certutil.GetHexSHA256Fingerprint(*certs[0]),
+		"keytool &lt;not found&gt;",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected %q in report", s)
+		}
+	}
+	if strings.Contains(out, "<script") || strings.Contains(out, "src=") {
+		t.Error("report should be self-contained")
+	}
+
+	v := reportView(r, r.Stores[0])
+	if v.Total != len(certs) || len(v.Expiring) == 0 || len(v.NonCompliant) != 1 {
+		t.Errorf("got %#v", v)
+	}
+	total := 0
+	for i := range v.Countries {
+		total += v.Countries[i].Count
+	}
+	if total != len(certs) {
+		t.Errorf("countries sum to %d", total)
+	}
+}
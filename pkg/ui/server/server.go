@@ -24,6 +24,8 @@ import (
 	"os"
 	"sync"
 	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/interrupt"
 )
 
 var (
@@ -107,8 +109,16 @@ func Start() {
 
 // Stop calls for a shutdown of the http server, if it exists
 func Stop() error {
-	// hold on until the form has been filled out
-	wg.Wait()
+	// hold on until the form has been filled out, or we're interrupted
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-interrupt.Context().Done():
+	}
 
 	if srv != nil {
 		return srv.Shutdown(context.TODO())
@@ -0,0 +1,189 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ui
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/timeutil"
+)
+
+var (
+	// OID for embedded Signed Certificate Timestamps, RFC 6962 Section 3.3
+	oidExtensionSCT = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+	keyUsageNames = []struct {
+		usage x509.KeyUsage
+		name  string
+	}{
+		{x509.KeyUsageDigitalSignature, "Digital Signature"},
+		{x509.KeyUsageContentCommitment, "Content Commitment"},
+		{x509.KeyUsageKeyEncipherment, "Key Encipherment"},
+		{x509.KeyUsageDataEncipherment, "Data Encipherment"},
+		{x509.KeyUsageKeyAgreement, "Key Agreement"},
+		{x509.KeyUsageCertSign, "Certificate Sign"},
+		{x509.KeyUsageCRLSign, "CRL Sign"},
+		{x509.KeyUsageEncipherOnly, "Encipher Only"},
+		{x509.KeyUsageDecipherOnly, "Decipher Only"},
+	}
+
+	extKeyUsageNames = map[x509.ExtKeyUsage]string{
+		x509.ExtKeyUsageAny:             "Any",
+		x509.ExtKeyUsageServerAuth:      "Server Authentication",
+		x509.ExtKeyUsageClientAuth:      "Client Authentication",
+		x509.ExtKeyUsageCodeSigning:     "Code Signing",
+		x509.ExtKeyUsageEmailProtection: "Email Protection",
+		x509.ExtKeyUsageTimeStamping:    "Time Stamping",
+		x509.ExtKeyUsageOCSPSigning:     "OCSP Signing",
+	}
+)
+
+// ShowCertificate writes every detail we know about a certificate to `w`.
+// Only the fingerprint for fingerprintAlgo (see GetFingerprintAlgos) is
+// shown, or all of them if it's empty.
+func ShowCertificate(w io.Writer, cert *x509.Certificate, fingerprintAlgo string) error {
+	algos := []string{"sha1", "sha256", "spki-sha256"}
+	if fingerprintAlgo != "" {
+		algo, err := getFingerprintAlgo(fingerprintAlgo)
+		if err != nil {
+			return err
+		}
+		algos = []string{algo}
+	}
+
+	fmt.Fprintf(w, "Certificate\n")
+	fmt.Fprintf(w, "  Subject: %s\n", cert.Subject.String())
+	fmt.Fprintf(w, "  Issuer: %s\n", cert.Issuer.String())
+	fmt.Fprintf(w, "  Serial Number: %s\n", cert.SerialNumber)
+	fmt.Fprintf(w, "  Version: %d\n", cert.Version)
+	fmt.Fprintf(w, "  Not Before: %s\n", timeutil.Time(cert.NotBefore))
+	fmt.Fprintf(w, "  Not After: %s\n", timeutil.Time(cert.NotAfter))
+
+	fmt.Fprintf(w, "Fingerprints\n")
+	for i := range algos {
+		fmt.Fprintf(w, "  %s: %s\n", fingerprintName(algos[i]), fingerprint(cert, algos[i]))
+	}
+
+	fmt.Fprintf(w, "Public Key\n")
+	fmt.Fprintf(w, "  Algorithm: %s\n", certutil.StringifyPubKeyAlgo(cert.PublicKeyAlgorithm))
+	if size := certutil.PublicKeySize(*cert); size > 0 {
+		fmt.Fprintf(w, "  Size: %d bits\n", size)
+	}
+	fmt.Fprintf(w, "  Signature Algorithm: %s\n", cert.SignatureAlgorithm)
+
+	fmt.Fprintf(w, "Constraints\n")
+	fmt.Fprintf(w, "  IsCA: %t\n", cert.IsCA)
+	if cert.MaxPathLen > 0 || cert.MaxPathLenZero {
+		fmt.Fprintf(w, "  Max Path Length: %d\n", cert.MaxPathLen)
+	}
+	if usages := keyUsages(cert.KeyUsage); len(usages) > 0 {
+		fmt.Fprintf(w, "  Key Usage: %s\n", strings.Join(usages, ", "))
+	}
+	if usages := extKeyUsages(cert); len(usages) > 0 {
+		fmt.Fprintf(w, "  Extended Key Usage: %s\n", strings.Join(usages, ", "))
+	}
+	writeList(w, "Permitted DNS Domains", cert.PermittedDNSDomains)
+
+	var ips []string
+	for i := range cert.IPAddresses {
+		ips = append(ips, cert.IPAddresses[i].String())
+	}
+	if len(cert.DNSNames)+len(cert.EmailAddresses)+len(ips) > 0 {
+		fmt.Fprintf(w, "Subject Alternative Names\n")
+		writeList(w, "DNS Names", cert.DNSNames)
+		writeList(w, "Email Addresses", cert.EmailAddresses)
+		writeList(w, "IP Addresses", ips)
+	}
+
+	fmt.Fprintf(w, "Extensions\n")
+	if len(cert.SubjectKeyId) > 0 {
+		fmt.Fprintf(w, "  Subject Key ID: %s\n", hex.EncodeToString(cert.SubjectKeyId))
+	}
+	if len(cert.AuthorityKeyId) > 0 {
+		fmt.Fprintf(w, "  Authority Key ID: %s\n", hex.EncodeToString(cert.AuthorityKeyId))
+	}
+	writeList(w, "OCSP Servers", cert.OCSPServer)
+	writeList(w, "Issuing Certificate URLs", cert.IssuingCertificateURL)
+	writeList(w, "CRL Distribution Points", cert.CRLDistributionPoints)
+
+	var policies []string
+	for i := range cert.PolicyIdentifiers {
+		policies = append(policies, cert.PolicyIdentifiers[i].String())
+	}
+	writeList(w, "Policies", policies)
+
+	var oids []string
+	for i := range cert.Extensions {
+		ext := cert.Extensions[i]
+		oid := ext.Id.String()
+		if ext.Critical {
+			oid += " (critical)"
+		}
+		oids = append(oids, oid)
+	}
+	writeList(w, "All", oids)
+
+	fmt.Fprintf(w, "Certificate Transparency\n")
+	fmt.Fprintf(w, "  Embedded SCTs: %t\n", hasEmbeddedSCTs(cert))
+	return nil
+}
+
+func writeList(w io.Writer, name string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "  %s:\n", name)
+	for i := range items {
+		fmt.Fprintf(w, "    %s\n", items[i])
+	}
+}
+
+func keyUsages(ku x509.KeyUsage) []string {
+	var out []string
+	for i := range keyUsageNames {
+		if ku&keyUsageNames[i].usage != 0 {
+			out = append(out, keyUsageNames[i].name)
+		}
+	}
+	return out
+}
+
+func extKeyUsages(cert *x509.Certificate) []string {
+	var out []string
+	for i := range cert.ExtKeyUsage {
+		if name, ok := extKeyUsageNames[cert.ExtKeyUsage[i]]; ok {
+			out = append(out, name)
+		}
+	}
+	for i := range cert.UnknownExtKeyUsage {
+		out = append(out, cert.UnknownExtKeyUsage[i].String())
+	}
+	return out
+}
+
+func hasEmbeddedSCTs(cert *x509.Certificate) bool {
+	for i := range cert.Extensions {
+		if cert.Extensions[i].Id.Equal(oidExtensionSCT) {
+			return true
+		}
+	}
+	return false
+}
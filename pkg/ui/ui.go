@@ -19,6 +19,9 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/whitelist"
 )
 
 type uiface func(certs []*x509.Certificate, cfg *Config) error
@@ -60,9 +63,36 @@ type Config struct {
 	// Which user interface to show users, e.g. cli or web
 	// Default (and possible) value(s) can be found in the ui package
 	UI string
+
+	// Columns, sort order and if fingerprints are truncated in the 'table' format
+	// Possible values can be found with GetTableColumns()
+	Columns []string
+	Sort    string
+	Wide    bool
+
+	// FingerprintAlgo is the hash shown for each certificate, see GetFingerprintAlgos()
+	FingerprintAlgo string
+
+	// Issuance holds how many certificates each root has issued in the last
+	// 12 months, keyed by SHA256 fingerprint. It's non-nil when -issuance is given
+	// and filled in before the certificates are shown.
+	Issuance map[string]int
+
+	// DistrustAfter holds Mozilla's distrust-after date of roots, keyed by
+	// SHA256 fingerprint. TLS certificates they issue after it aren't trusted.
+	DistrustAfter map[string]time.Time
+
+	// NoColor disables highlighting rows of the 'table' format, which is only
+	// done on a terminal. Rows of certificates not matching Whitelist (if
+	// given) are highlighted, along with expired and expiring certificates.
+	NoColor   bool
+	Whitelist *whitelist.Whitelist
 }
 
 func ListCertificates(certs []*x509.Certificate, cfg *Config) error {
+	if err := checkFormatOptions(cfg); err != nil {
+		return err
+	}
 	if cfg.Count { // ignore any cfg.UI setting
 		fmt.Printf("%d\n", len(certs))
 		return nil
@@ -88,6 +118,9 @@ type Meta struct {
 
 func ListCertificatesWithMeta(meta Meta, certs []*x509.Certificate, cfg *Config) error {
 	if isObservatory(cfg.Format) {
+		if err := checkFormatOptions(cfg); err != nil {
+			return err
+		}
 		return writeObservatoryReport(meta, certs, cfg)
 	}
 	return ListCertificates(certs, cfg)
@@ -100,14 +100,14 @@ func write(w io.Writer, tpl string, data interface{}) error {
 func showCertsOnWeb(certs []*x509.Certificate, cfg *Config) error {
 	server.Register()
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		p, ok := getPrinter(cfg.Format)
-		if !ok {
-			io.WriteString(w, fmt.Sprintf("Unknown format %s", cfg.Format))
+		p, err := getPrinter(cfg)
+		if err != nil {
+			io.WriteString(w, err.Error())
 			return
 		}
 		defer p.close()
 
-		err := write(w, head, struct {
+		err = write(w, head, struct {
 			Operation string
 		}{
 			Operation: "list certificates",
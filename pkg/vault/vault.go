@@ -0,0 +1,152 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vault reads the CA certificates of HashiCorp Vault PKI mounts
+package vault
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"github.com/adamdecaf/cert-manage/pkg/httputil"
+)
+
+var (
+	maxResponseSize int64 = 10 * 1024 * 1024 // bytes
+
+	// caPaths are read from each mount, ca_chain holds the issuing CA and
+	// its parents while ca/pem is the issuing CA on its own (which older
+	// mounts without a chain only have).
+	caPaths = []string{"ca_chain", "ca/pem"}
+)
+
+// Client reads from a Vault server
+type Client struct {
+	// Addr is the server's URL, e.g. https://vault.internal:8200
+	Addr string
+
+	// Token is sent as X-Vault-Token, the CA endpoints don't need one
+	// unless the server has been configured to
+	Token string
+
+	// Namespace is sent as X-Vault-Namespace (Vault Enterprise)
+	Namespace string
+
+	// CACert is a PEM file of roots to trust for Addr instead of the system's
+	CACert string
+}
+
+// FromEnv returns a Client configured like the vault CLI, from VAULT_ADDR,
+// VAULT_TOKEN (or ~/.vault-token), VAULT_NAMESPACE and VAULT_CACERT
+func FromEnv() (*Client, error) {
+	c := &Client{
+		Addr:      os.Getenv("VAULT_ADDR"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+		CACert:    os.Getenv("VAULT_CACERT"),
+	}
+	if c.Addr == "" {
+		return nil, errors.New("VAULT_ADDR isn't set")
+	}
+	if c.Token == "" {
+		if bs, err := ioutil.ReadFile(filepath.Join(file.HomeDir(), ".vault-token")); err == nil {
+			c.Token = strings.TrimSpace(string(bs))
+		}
+	}
+	return c, nil
+}
+
+// CACertificates returns the CA certificates (roots and intermediates) of
+// the PKI secrets engine mounted at mount, e.g. "pki" or "pki_int"
+func (c *Client) CACertificates(mount string) ([]*x509.Certificate, error) {
+	client, err := c.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	mount = strings.Trim(mount, "/")
+
+	pool := certutil.Pool{}
+	var lastErr error
+	for i := range caPaths {
+		certs, err := c.get(client, mount+"/"+caPaths[i])
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		pool.AddCertificates(certs)
+	}
+	certs := pool.GetCertificates()
+	if len(certs) == 0 {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no CA certificates found in %s", mount)
+		}
+		return nil, lastErr
+	}
+	return certs, nil
+}
+
+func (c *Client) httpClient() (*http.Client, error) {
+	if c.CACert == "" {
+		return httputil.New(), nil
+	}
+	certs, err := certutil.FromFile(c.CACert)
+	if err != nil {
+		return nil, fmt.Errorf("reading VAULT_CACERT: %v", err)
+	}
+	roots := x509.NewCertPool()
+	for i := range certs {
+		roots.AddCert(certs[i])
+	}
+	return httputil.WithRoots(roots), nil
+}
+
+func (c *Client) get(client *http.Client, path string) ([]*x509.Certificate, error) {
+	u := strings.TrimSuffix(c.Addr, "/") + "/v1/" + path
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("X-Vault-Token", c.Token)
+	}
+	if c.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.Namespace)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %s", u, resp.Status)
+	}
+	bs, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	// an empty body means the mount doesn't have a chain (or CA) yet
+	if len(strings.TrimSpace(string(bs))) == 0 {
+		return nil, nil
+	}
+	return certutil.ParsePEM(bs)
+}
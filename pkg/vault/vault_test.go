@@ -0,0 +1,95 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/testca"
+)
+
+func TestVault__CACertificates(t *testing.T) {
+	h, err := testca.NewHierarchy("vault.example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, inter := h.Root.Certificate, h.Intermediate.Certificate
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" || r.Header.Get("X-Vault-Namespace") != "team" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/pki_int/ca_chain":
+			pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: inter.Raw})
+			pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})
+		case "/v1/pki_int/ca/pem":
+			pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: inter.Raw})
+		case "/v1/pki/ca_chain":
+			// root mounts don't have a chain
+		case "/v1/pki/ca/pem":
+			pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	os.Setenv("VAULT_ADDR", srv.URL)
+	os.Setenv("VAULT_TOKEN", "s.token")
+	os.Setenv("VAULT_NAMESPACE", "team")
+	defer func() {
+		os.Unsetenv("VAULT_ADDR")
+		os.Unsetenv("VAULT_TOKEN")
+		os.Unsetenv("VAULT_NAMESPACE")
+	}()
+	c, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certs, err := c.CACertificates("pki_int")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 {
+		t.Errorf("got %d certificates", len(certs))
+	}
+	certs, err = c.CACertificates("/pki/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 1 || !certs[0].Equal(root) {
+		t.Errorf("got %d certificates", len(certs))
+	}
+
+	if _, err := c.CACertificates("missing"); err == nil {
+		t.Error("expected error")
+	}
+	c.Token = ""
+	if _, err := c.CACertificates("pki"); err == nil {
+		t.Error("expected error")
+	}
+
+	os.Unsetenv("VAULT_ADDR")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected error without VAULT_ADDR")
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package whitelist
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/file"
+	"gopkg.in/yaml.v2"
+)
+
+// ReadExtended reads a whitelist file for editing. Unlike FromFile the
+// whitelists it extends aren't merged into it, they're returned merged
+// together as `extended`. A missing file is read as an empty whitelist.
+func ReadExtended(path string) (own Whitelist, extended Whitelist, err error) {
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return own, extended, err
+	}
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return own, extended, nil
+		}
+		return own, extended, err
+	}
+	own, err = parse(bs)
+	if err != nil {
+		return own, extended, err
+	}
+	for i := range own.Extends {
+		parent, err := fromSource(resolveSource(path, own.Extends[i]), []string{path})
+		if err != nil {
+			return own, extended, err
+		}
+		extended = merge(extended, parent)
+	}
+	return own, extended, nil
+}
+
+// Extending returns the whitelist merged over `parent`, as FromFile merges
+// the whitelists a file extends
+func (w Whitelist) Extending(parent Whitelist) Whitelist {
+	return merge(parent, w)
+}
+
+// AddFingerprint keeps the certificate with SHA256 fingerprint fp
+func (w *Whitelist) AddFingerprint(fp string) {
+	w.Fingerprints = appendUnique(w.Fingerprints, []string{fp})
+}
+
+// RemoveFingerprint drops fp from the fingerprints, entries and policies of
+// the whitelist. The certificate can still be kept by other items (e.g. its
+// key or country).
+func (w *Whitelist) RemoveFingerprint(fp string) {
+	w.Fingerprints, _ = partition(w.Fingerprints, []string{fp})
+	var entries []Entry
+	for _, e := range w.Entries {
+		e.Fingerprints, _ = partition(e.Fingerprints, []string{fp})
+		if len(e.Fingerprints) > 0 || len(e.Keys) > 0 {
+			entries = append(entries, e)
+		}
+	}
+	w.Entries = entries
+	for name, p := range w.Policies {
+		p.Fingerprints, _ = partition(p.Fingerprints, []string{fp})
+		w.Policies[name] = p
+	}
+}
+
+// Save writes the whitelist to path as it is, in JSON when path ends with
+// .json and otherwise in yaml. Unlike ToFile nothing is kept from the file
+// already at path.
+func (w Whitelist) Save(path string) error {
+	var out []byte
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		out, err = json.MarshalIndent(w, "", "  ")
+	} else {
+		out, err = yaml.Marshal(&w)
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, out, file.TempFilePermissions)
+}
@@ -0,0 +1,198 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package whitelist
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+// now is when entries are checked for expiry, it's replaced in tests
+var now = time.Now
+
+// Entry keeps certificates until it expires, which is used for temporary
+// trust (e.g. onboarding a vendor or a migration) that shouldn't linger.
+// Entries also record who asked for the trust and why, which cert-manage
+// keeps when it rewrites the whitelist.
+type Entry struct {
+	// SHA256 fingerprints kept by this entry
+	Fingerprints []string `json:"Fingerprints,omitempty" yaml:"fingerprints,omitempty"`
+
+	// SHA256 fingerprints of public keys kept by this entry, see Whitelist.Keys
+	Keys []string `json:"Keys,omitempty" yaml:"keys,omitempty"`
+
+	// Expires is the last day (YYYY-MM-DD, in UTC) the entry matches, or an
+	// RFC 3339 time. Entries without it don't expire.
+	Expires string `json:"Expires,omitempty" yaml:"expires,omitempty"`
+
+	// Who the trust is for and why, these aren't used for matching
+	Owner   string `json:"Owner,omitempty" yaml:"owner,omitempty"`
+	Ticket  string `json:"Ticket,omitempty" yaml:"ticket,omitempty"`
+	Reason  string `json:"Reason,omitempty" yaml:"reason,omitempty"`
+	AddedBy string `json:"AddedBy,omitempty" yaml:"addedBy,omitempty"`
+}
+
+// Annotation describes the entry's owner, ticket, reason and who added it,
+// e.g. "owner: payments, ticket: SEC-42". It's empty if none are set.
+func (e Entry) Annotation() string {
+	var out []string
+	for _, kv := range [][2]string{{"owner", e.Owner}, {"ticket", e.Ticket}, {"reason", e.Reason}, {"added by", e.AddedBy}} {
+		if kv[1] != "" {
+			out = append(out, kv[0]+": "+kv[1])
+		}
+	}
+	return strings.Join(out, ", ")
+}
+
+// ExpiresAt returns when the entry stops matching, which is zero if it
+// doesn't expire
+func (e Entry) ExpiresAt() (time.Time, error) {
+	if e.Expires == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", e.Expires); err == nil {
+		return t.Add(24 * time.Hour), nil
+	}
+	t, err := time.Parse(time.RFC3339, e.Expires)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("entry expires %q isn't a YYYY-MM-DD date or RFC 3339 time", e.Expires)
+	}
+	return t, nil
+}
+
+// Expired returns true if the entry no longer matches at `when`
+func (e Entry) Expired(when time.Time) bool {
+	at, err := e.ExpiresAt()
+	return err == nil && !at.IsZero() && !when.Before(at)
+}
+
+// Matches returns true if the entry includes the certificate, whether or not
+// it has expired
+func (e Entry) Matches(inc *x509.Certificate) bool {
+	if inc == nil {
+		return false
+	}
+	fp := certutil.GetHexSHA256Fingerprint(*inc)
+	for i := range e.Fingerprints {
+		if strings.EqualFold(e.Fingerprints[i], fp) {
+			return true
+		}
+	}
+	return matchesKey(e.Keys, inc)
+}
+
+// ExpiredEntries returns the entries which no longer match at `when`
+func (w Whitelist) ExpiredEntries(when time.Time) []Entry {
+	var out []Entry
+	for i := range w.Entries {
+		if w.Entries[i].Expired(when) {
+			out = append(out, w.Entries[i])
+		}
+	}
+	return out
+}
+
+// EntriesFor returns the entries which include the certificate, expired or not
+func (w Whitelist) EntriesFor(inc *x509.Certificate) []Entry {
+	var out []Entry
+	for i := range w.Entries {
+		if w.Entries[i].Matches(inc) {
+			out = append(out, w.Entries[i])
+		}
+	}
+	return out
+}
+
+// keepEntries moves the fingerprints and keys of w which an entry of prev
+// included back into a copy of that entry, so rewriting a whitelist (e.g.
+// regenerating it) keeps their expiry and annotations.
+func (w Whitelist) keepEntries(prev Whitelist) Whitelist {
+	for i := range prev.Entries {
+		e := prev.Entries[i]
+		var fps, keys []string
+		w.Fingerprints, fps = partition(w.Fingerprints, e.Fingerprints)
+		w.Keys, keys = partition(w.Keys, e.Keys)
+		if len(fps) == 0 && len(keys) == 0 {
+			continue
+		}
+		e.Fingerprints, e.Keys = fps, keys
+		w.Entries = append(w.Entries, e)
+	}
+	return w
+}
+
+// partition splits items into those not in `of` and those which are
+func partition(items, of []string) (rest, found []string) {
+	for i := range items {
+		in := false
+		for j := range of {
+			if strings.EqualFold(items[i], of[j]) {
+				in = true
+				break
+			}
+		}
+		if in {
+			found = append(found, items[i])
+		} else {
+			rest = append(rest, items[i])
+		}
+	}
+	return rest, found
+}
+
+// matchesEntries returns true if an entry which hasn't expired includes the certificate
+func (w Whitelist) matchesEntries(inc *x509.Certificate) bool {
+	when := now()
+	for i := range w.Entries {
+		if !w.Entries[i].Expired(when) && w.Entries[i].Matches(inc) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesKey returns true if the certificate's SPKI SHA256 fingerprint is in
+// keys, which can be base64 (as printed by '-fingerprint spki-sha256') or hex
+// encoded and have a "sha256/" prefix (as in HPKP pins).
+func matchesKey(keys []string, inc *x509.Certificate) bool {
+	if len(keys) == 0 {
+		return false
+	}
+	sum := sha256.Sum256(inc.RawSubjectPublicKeyInfo)
+	b64, hx := base64.StdEncoding.EncodeToString(sum[:]), hex.EncodeToString(sum[:])
+	for i := range keys {
+		key := strings.TrimPrefix(strings.TrimSpace(keys[i]), "sha256/")
+		if key == b64 || strings.EqualFold(key, hx) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w Whitelist) validateEntries() error {
+	for i := range w.Entries {
+		if _, err := w.Entries[i].ExpiresAt(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package whitelist
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/cosign"
+	"github.com/adamdecaf/cert-manage/pkg/httputil"
+)
+
+var (
+	maxWhitelistDownloadSize int64 = 10 * 1024 * 1024 // bytes
+)
+
+// fromSource reads the whitelist at a path or URL and merges in each whitelist
+// it extends. Extended whitelists are merged in the order they're listed with
+// the extending whitelist last. `stack` holds the sources currently being read,
+// which is used to detect cycles.
+func fromSource(src string, stack []string) (Whitelist, error) {
+	for i := range stack {
+		if stack[i] == src {
+			return Whitelist{}, fmt.Errorf("whitelist extends cycle: %s -> %s", strings.Join(stack, " -> "), src)
+		}
+	}
+
+	b, err := readSource(src)
+	if err != nil {
+		return Whitelist{}, err
+	}
+	wh, err := parse(b)
+	if err != nil {
+		return wh, fmt.Errorf("%s: %v", src, err)
+	}
+	next := make([]string, len(stack), len(stack)+1)
+	copy(next, stack)
+	next = append(next, src)
+
+	// variants extend relative to this whitelist too
+	for i := range wh.Variants {
+		v := &wh.Variants[i]
+		for j := range v.Extends {
+			parent, err := fromSource(resolveSource(src, v.Extends[j]), next)
+			if err != nil {
+				return Whitelist{}, err
+			}
+			if len(parent.Variants) > 0 {
+				return Whitelist{}, fmt.Errorf("%s: variant %q extends %s which has variants", src, v.Selector, v.Extends[j])
+			}
+			v.Whitelist = merge(parent, v.Whitelist)
+		}
+		v.Extends = nil
+	}
+	if len(wh.Extends) == 0 {
+		return wh, nil
+	}
+
+	out := Whitelist{}
+	for i := range wh.Extends {
+		parent, err := fromSource(resolveSource(src, wh.Extends[i]), next)
+		if err != nil {
+			return Whitelist{}, err
+		}
+		out = merge(out, parent)
+	}
+	wh.Extends = nil
+	return merge(out, wh), nil
+}
+
+func isURL(src string) bool {
+	return strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://")
+}
+
+// resolveSource returns where `ref` points to, relative to the whitelist
+// which extended it.
+func resolveSource(base, ref string) string {
+	if isURL(ref) {
+		return ref
+	}
+	if isURL(base) {
+		u, err := url.Parse(base)
+		if err != nil {
+			return ref
+		}
+		r, err := u.Parse(ref)
+		if err != nil {
+			return ref
+		}
+		return r.String()
+	}
+	if !filepath.IsAbs(ref) {
+		ref = filepath.Join(filepath.Dir(base), ref)
+	}
+	return filepath.Clean(ref)
+}
+
+func readSource(src string) ([]byte, error) {
+	if !isURL(src) {
+		return ioutil.ReadFile(src)
+	}
+
+	req, err := http.NewRequest("GET", src, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httputil.New().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %s", src, resp.Status)
+	}
+	bs, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxWhitelistDownloadSize))
+	if err != nil {
+		return nil, err
+	}
+	// downloaded whitelists are refused unless signed as -cosign-* requires
+	if err := cosign.VerifyDownload(src, bs); err != nil {
+		return nil, err
+	}
+	return bs, nil
+}
+
+// merge returns a whitelist with the items of a followed by the items of b
+// which aren't already included.
+func merge(a, b Whitelist) Whitelist {
+	return Whitelist{
+		Fingerprints:     appendUnique(a.Fingerprints, b.Fingerprints),
+		Keys:             appendUnique(a.Keys, b.Keys),
+		Entries:          append(append([]Entry(nil), a.Entries...), b.Entries...),
+		Countries:        appendUnique(a.Countries, b.Countries),
+		IssuerCountries:  appendUnique(a.IssuerCountries, b.IssuerCountries),
+		Jurisdictions:    appendUnique(a.Jurisdictions, b.Jurisdictions),
+		ExcludeCountries: appendUnique(a.ExcludeCountries, b.ExcludeCountries),
+		GPGKeys:          appendUnique(a.GPGKeys, b.GPGKeys),
+		SSHKeys:          appendUnique(a.SSHKeys, b.SSHKeys),
+		Usages:           append(append([]Usage(nil), a.Usages...), b.Usages...),
+		Policies:         mergePolicies(a.Policies, b.Policies),
+		Variants:         append(append([]Variant(nil), a.Variants...), b.Variants...),
+		Provenance:       append(append([]Provenance(nil), a.Provenance...), b.Provenance...),
+	}
+}
+
+// mergePolicies combines the fingerprints of policies with the same name,
+// usages set in b replace those of a.
+func mergePolicies(a, b map[string]Policy) map[string]Policy {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	out := make(map[string]Policy)
+	for name, p := range a {
+		out[name] = p
+	}
+	for name, p := range b {
+		prev := out[name]
+		prev.Fingerprints = appendUnique(prev.Fingerprints, p.Fingerprints)
+		if len(p.Usages) > 0 {
+			prev.Usages = p.Usages
+		}
+		out[name] = prev
+	}
+	return out
+}
+
+func appendUnique(a, b []string) []string {
+	if len(b) == 0 {
+		return a
+	}
+	out := append([]string(nil), a...)
+	for i := range b {
+		found := false
+		for j := range out {
+			if strings.EqualFold(out[j], b[i]) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, b[i])
+		}
+	}
+	return out
+}
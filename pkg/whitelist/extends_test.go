@@ -0,0 +1,175 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package whitelist
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adamdecaf/cert-manage/pkg/cosign"
+)
+
+func writeWhitelists(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "cert-manage-extends")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, body := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestWhitelist__extends(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"Fingerprints": ["remote"], "Countries": ["GB"]}`)
+	}))
+	defer srv.Close()
+
+	dir := writeWhitelists(t, map[string]string{
+		"base/corp.yaml": "fingerprints:\n  - corp\n  - shared\ncountries:\n  - US\n",
+		"team.json":      fmt.Sprintf(`{"extends": ["base/corp.yaml", "%s/extra.json"], "Fingerprints": ["shared", "team"]}`, srv.URL),
+	})
+	defer os.RemoveAll(dir)
+
+	wh, err := FromFile(filepath.Join(dir, "team.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(wh.Fingerprints, []string{"corp", "shared", "remote", "team"}) {
+		t.Errorf("got %q", wh.Fingerprints)
+	}
+	if !reflect.DeepEqual(wh.Countries, []string{"US", "GB"}) {
+		t.Errorf("got %q", wh.Countries)
+	}
+	if len(wh.Extends) != 0 {
+		t.Errorf("got %q", wh.Extends)
+	}
+}
+
+func TestWhitelist__extendsUnsigned(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/extra.json" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"Fingerprints": ["remote"]}`)
+	}))
+	defer srv.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := writeWhitelists(t, map[string]string{
+		"cosign.pub": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		"team.json":  fmt.Sprintf(`{"extends": ["%s/extra.json"], "Fingerprints": ["team"]}`, srv.URL),
+	})
+	defer os.RemoveAll(dir)
+
+	orig := cosign.Required
+	cosign.Required = cosign.Policy{Key: filepath.Join(dir, "cosign.pub")}
+	defer func() { cosign.Required = orig }()
+
+	_, err = FromFile(filepath.Join(dir, "team.json"))
+	if err == nil || !strings.Contains(err.Error(), "no signature found") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestWhitelist__extendsCycle(t *testing.T) {
+	dir := writeWhitelists(t, map[string]string{
+		"a.yaml": "extends:\n  - b.yaml\n",
+		"b.yaml": "extends:\n  - ./a.yaml\n",
+		"c.yaml": "extends:\n  - d.yaml\n  - d.yaml\n",
+		"d.yaml": "fingerprints:\n  - d\n",
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := FromFile(filepath.Join(dir, "a.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("expected cycle error, got %v", err)
+	}
+
+	// extending the same whitelist twice isn't a cycle
+	wh, err := FromFile(filepath.Join(dir, "c.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(wh.Fingerprints, []string{"d"}) {
+		t.Errorf("got %q", wh.Fingerprints)
+	}
+}
+
+func TestWhitelist__readExtended(t *testing.T) {
+	dir := writeWhitelists(t, map[string]string{
+		"base.yaml": "fingerprints:\n  - base\n",
+		"team.yaml": "extends:\n  - base.yaml\nfingerprints:\n  - team\n  - gone\nentries:\n  - fingerprints: [gone]\n    owner: payments\n",
+	})
+	defer os.RemoveAll(dir)
+
+	own, extended, err := ReadExtended(filepath.Join(dir, "team.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(own.Extends, []string{"base.yaml"}) || !reflect.DeepEqual(extended.Fingerprints, []string{"base"}) {
+		t.Errorf("got %#v and %#v", own, extended)
+	}
+	if wh := own.Extending(extended); !reflect.DeepEqual(wh.Fingerprints, []string{"base", "team", "gone"}) {
+		t.Errorf("got %q", wh.Fingerprints)
+	}
+
+	own.RemoveFingerprint("gone")
+	own.AddFingerprint("new")
+	own.AddFingerprint("team")
+	path := filepath.Join(dir, "team.json")
+	if err := own.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	saved, _, err := ReadExtended(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(saved.Fingerprints, []string{"team", "new"}) || len(saved.Entries) != 0 || len(saved.Extends) != 1 {
+		t.Errorf("got %#v", saved)
+	}
+
+	// a missing file is empty
+	if own, _, err := ReadExtended(filepath.Join(dir, "missing.json")); err != nil || len(own.Fingerprints) != 0 {
+		t.Errorf("got %#v, err=%v", own, err)
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/httputil"
 )
 
 var (
@@ -267,6 +268,10 @@ func getChain(u *url.URL, roots *x509.CertPool) chain {
 	if debug {
 		fmt.Printf("whitelist/gen: getChain: getting chain for addr=%q\n", addr)
 	}
+	if err := httputil.CheckOnline("connecting to " + addr); err != nil {
+		fmt.Printf("WARNING: %v\n", err)
+		return nil
+	}
 	conn, err := tls.DialWithDialer(dialer, "tcp", addr, cfg)
 	if err != nil {
 		if debug {
@@ -0,0 +1,81 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package whitelist
+
+import (
+	"crypto/x509"
+	"strings"
+)
+
+// operatorJurisdictions maps a CA's Subject Organization to the ISO 3166-1
+// country of the company (or government) which operates it today. Roots are
+// often sold or were issued under a foreign subsidiary, so the Subject's
+// Country doesn't always say who controls the CA.
+var operatorJurisdictions = map[string]string{
+	// DigiCert
+	"baltimore":            "US",
+	"digicert inc":         "US",
+	"geotrust inc.":        "US",
+	"symantec corporation": "US",
+	"thawte, inc.":         "US",
+	"thawte consulting cc": "US",
+	"verisign, inc.":       "US",
+
+	// Cybertrust, sold by Verizon to DigiCert
+	"cybertrust, inc": "US",
+
+	// Entrust
+	"entrust, inc.": "US",
+	"entrust.net":   "US",
+
+	// IdenTrust, formerly Digital Signature Trust
+	"digital signature trust co.": "US",
+
+	// Sectigo
+	"addtrust ab":           "GB",
+	"comodo ca limited":     "GB",
+	"the usertrust network": "GB",
+
+	// Let's Encrypt
+	"internet security research group": "US",
+
+	// Government operated programs
+	"staat der nederlanden":                   "NL",
+	"government root certification authority": "TW",
+	"hongkong post":                           "HK",
+}
+
+// jurisdictions returns the ISO 3166-1 country codes a certificate is
+// operated from. The curated operator mapping is preferred over the Subject.
+func jurisdictions(c *x509.Certificate) []string {
+	for i := range c.Subject.Organization {
+		if country, ok := operatorJurisdictions[strings.ToLower(c.Subject.Organization[i])]; ok {
+			return []string{country}
+		}
+	}
+	return c.Subject.Country
+}
+
+// countriesOverlap returns true if any country in `as` is also in `bs`
+func countriesOverlap(as, bs []string) bool {
+	for i := range as {
+		for j := range bs {
+			if strings.EqualFold(as[i], bs[j]) {
+				return true
+			}
+		}
+	}
+	return false
+}
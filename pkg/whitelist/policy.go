@@ -0,0 +1,135 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package whitelist
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Policy is a named keep-list within a whitelist, e.g. "web" or "email".
+// Certificates only kept by policies are restricted to the Extended Key
+// Usages of those policies.
+type Policy struct {
+	// SHA256 fingerprints kept by this policy
+	Fingerprints []string `json:"Fingerprints,omitempty" yaml:"fingerprints,omitempty"`
+
+	// Names of Extended Key Usages the policy is for (see GetUsages), the
+	// well known policies default to policyUsages
+	Usages []string `json:"Usages,omitempty" yaml:"usages,omitempty"`
+}
+
+// policyUsages are the Extended Key Usages of well known policy names
+var policyUsages = map[string][]string{
+	"web":          {"serverAuth"},
+	"email":        {"emailProtection"},
+	"code-signing": {"codeSigning"},
+}
+
+// usages returns the Extended Key Usages of the policy called name
+func (p Policy) usages(name string) []string {
+	if len(p.Usages) > 0 {
+		return p.Usages
+	}
+	return policyUsages[strings.ToLower(name)]
+}
+
+// GetPolicies returns the names of the policies defined in the whitelist
+func (w Whitelist) GetPolicies() []string {
+	var out []string
+	for name := range w.Policies {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ForPolicies returns the whitelist with the named policies applied, or every
+// policy if names is empty. Fingerprints kept by a policy are added and, unless
+// the whitelist keeps them outright, restricted to the policy's usages.
+func (w Whitelist) ForPolicies(names []string) (Whitelist, error) {
+	if len(names) == 0 {
+		names = w.GetPolicies()
+	}
+	out := w
+	out.Policies = nil
+	out.Fingerprints = append([]string(nil), w.Fingerprints...)
+	out.Usages = append([]Usage(nil), w.Usages...)
+
+	kept, added := make(map[string]bool), make(map[string]bool)
+	for i := range w.Fingerprints {
+		kept[strings.ToLower(w.Fingerprints[i])] = true
+	}
+	for _, name := range names {
+		p, ok := w.lookupPolicy(name)
+		if !ok {
+			return Whitelist{}, fmt.Errorf("unknown policy %q, options: %s", name, strings.Join(w.GetPolicies(), ", "))
+		}
+		var restricted []string
+		for i := range p.Fingerprints {
+			fp := strings.ToLower(p.Fingerprints[i])
+			if kept[fp] {
+				continue
+			}
+			if !added[fp] {
+				added[fp] = true
+				out.Fingerprints = append(out.Fingerprints, fp)
+			}
+			restricted = append(restricted, fp)
+		}
+		if len(restricted) > 0 {
+			out.Usages = append(out.Usages, Usage{
+				Fingerprints: restricted,
+				Allow:        p.usages(name),
+			})
+		}
+	}
+	return out, nil
+}
+
+func (w Whitelist) lookupPolicy(name string) (Policy, bool) {
+	for k, v := range w.Policies {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return Policy{}, false
+}
+
+func (w Whitelist) validatePolicies() error {
+	for name, p := range w.Policies {
+		usages := p.usages(name)
+		if len(usages) == 0 {
+			return fmt.Errorf("policy %q needs usages, only %s have defaults", name, strings.Join(GetDefaultPolicies(), ", "))
+		}
+		for i := range usages {
+			if _, ok := lookupUsage(usages[i]); !ok {
+				return fmt.Errorf("policy %q: unknown extended key usage %q", name, usages[i])
+			}
+		}
+	}
+	return nil
+}
+
+// GetDefaultPolicies returns the policy names which don't need usages
+func GetDefaultPolicies() []string {
+	var out []string
+	for name := range policyUsages {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
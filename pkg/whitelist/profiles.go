@@ -0,0 +1,58 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package whitelist
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/file"
+)
+
+// profiles are built-in whitelists for common postures. Their fingerprints
+// are generated from Mozilla's root program, see profiles_gen.go
+var profiles = map[string][]string{
+	// Roots which anchor the vast majority of publicly trusted websites
+	"minimal-web": profileMinimalWeb,
+
+	// Every root included in Mozilla's root program
+	"mozilla-only": profileMozillaOnly,
+
+	// Mozilla's roots, minus CAs under United States jurisdiction (Subject C=US)
+	"us-gov-excluded": profileUSGovExcluded,
+}
+
+// GetProfiles returns the names of each built-in whitelist profile
+func GetProfiles() []string {
+	var out []string
+	for k := range profiles {
+		out = append(out, k)
+	}
+	file.SortNames(out)
+	return out
+}
+
+// FromProfile returns the built-in whitelist for a given profile name
+func FromProfile(name string) (Whitelist, error) {
+	fps, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		return Whitelist{}, fmt.Errorf("unknown whitelist profile %q", name)
+	}
+	wh := Whitelist{
+		Fingerprints: make([]string, len(fps)),
+	}
+	copy(wh.Fingerprints, fps)
+	return wh, nil
+}
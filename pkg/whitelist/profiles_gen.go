@@ -0,0 +1,208 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build ignore
+
+// Generates profiles_data.go.
+//
+// Profiles are whitelists built into cert-manage for common postures, so users
+// can apply a reasonable reduction of trust without writing their own whitelist.
+// Each profile is computed from Mozilla's certdata.txt (the NSS root program).
+//
+// Optionally, a local certdata.txt (or certdata.txt.gz) path can be given as
+// the first argument instead of downloading the latest copy.
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/x509"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/user"
+	"runtime"
+	"time"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/httputil"
+)
+
+var (
+	mozillaCertdata = "https://hg.mozilla.org/mozilla-central/raw-file/tip/security/nss/lib/ckfw/builtins/certdata.txt"
+
+	outputFilename = "pkg/whitelist/profiles_data.go"
+
+	// minimalWebCommonNames are the roots which anchor the vast majority of
+	// publicly trusted websites.
+	minimalWebCommonNames = []string{
+		"AddTrust External CA Root",
+		"Amazon Root CA 1",
+		"Baltimore CyberTrust Root",
+		"COMODO RSA Certification Authority",
+		"DST Root CA X3",
+		"DigiCert Global Root CA",
+		"DigiCert Global Root G2",
+		"DigiCert High Assurance EV Root CA",
+		"Entrust Root Certification Authority",
+		"Entrust Root Certification Authority - G2",
+		"GeoTrust Global CA",
+		"GlobalSign",
+		"GlobalSign Root CA",
+		"Go Daddy Root Certificate Authority - G2",
+		"ISRG Root X1",
+		"Starfield Root Certificate Authority - G2",
+		"USERTrust RSA Certification Authority",
+		"VeriSign Class 3 Public Primary Certification Authority - G5",
+	}
+)
+
+type profile struct {
+	name    string
+	varName string
+	keep    func(*x509.Certificate) bool
+}
+
+var profiles = []profile{
+	{
+		name:    "minimal-web",
+		varName: "profileMinimalWeb",
+		keep: func(c *x509.Certificate) bool {
+			for i := range minimalWebCommonNames {
+				if c.Subject.CommonName == minimalWebCommonNames[i] {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	{
+		name:    "mozilla-only",
+		varName: "profileMozillaOnly",
+		keep: func(c *x509.Certificate) bool {
+			return true
+		},
+	},
+	{
+		name:    "us-gov-excluded",
+		varName: "profileUSGovExcluded",
+		keep: func(c *x509.Certificate) bool {
+			for i := range c.Subject.Country {
+				if c.Subject.Country[i] == "US" {
+					return false
+				}
+			}
+			return true
+		},
+	},
+}
+
+func main() {
+	when := time.Now().Format("2006-01-02T03:04:05Z")
+	who, err := user.Current()
+	if err != nil {
+		log.Fatalf("Unable to get user on %s", runtime.GOOS)
+	}
+
+	certs, err := getMozillaCerts()
+	if err != nil {
+		log.Fatalf("error getting mozilla certs, err=%v", err)
+	}
+	certutil.Sort(certs)
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, `// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Generated on %s by %s, any modifications will be overwritten
+package whitelist
+`, when, who.Username)
+
+	for i := range profiles {
+		fmt.Fprintf(&buf, "\n// %s\n", profiles[i].name)
+		fmt.Fprintf(&buf, "var %s = []string{\n", profiles[i].varName)
+		for j := range certs {
+			if profiles[i].keep(certs[j]) {
+				fmt.Fprintf(&buf, "// %s\n", certs[j].Subject.String())
+				fmt.Fprintf(&buf, "`%s`,\n", certutil.GetHexSHA256Fingerprint(*certs[j]))
+			}
+		}
+		fmt.Fprintf(&buf, "}\n")
+	}
+
+	// format source code and write to profiles_data.go
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("error formatting output code, err=%v", err)
+	}
+
+	err = ioutil.WriteFile(outputFilename, out, 0644)
+	if err != nil {
+		log.Fatalf("error writing file, err=%v", err)
+	}
+}
+
+func getMozillaCerts() ([]*x509.Certificate, error) {
+	var r io.Reader
+	if len(os.Args) > 1 {
+		fd, err := os.Open(os.Args[1])
+		if err != nil {
+			return nil, err
+		}
+		defer fd.Close()
+		r = fd
+
+		if bytes.HasSuffix([]byte(os.Args[1]), []byte(".gz")) {
+			r, err = gzip.NewReader(fd)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		req, err := http.NewRequest("GET", mozillaCertdata, nil)
+		if err != nil {
+			return nil, fmt.Errorf("getMozillaCerts: can't build request for %s: %v", mozillaCertdata, err)
+		}
+		req.Close = true
+
+		resp, err := httputil.New().Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		r = resp.Body
+	}
+
+	bs, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return certutil.Decode(bs)
+}
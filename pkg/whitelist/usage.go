@@ -0,0 +1,110 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package whitelist
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/adamdecaf/cert-manage/pkg/certutil"
+)
+
+// Usage restricts the Extended Key Usages a whitelisted certificate is
+// trusted for, e.g. a CA can be kept for serverAuth but not codeSigning.
+type Usage struct {
+	// SHA256 fingerprints this restriction applies to
+	Fingerprints []string `json:"Fingerprints,omitempty" yaml:"fingerprints,omitempty"`
+
+	// Names of Extended Key Usages to keep trust for, see GetUsages()
+	Allow []string `json:"Allow,omitempty" yaml:"allow,omitempty"`
+}
+
+var extKeyUsages = map[string]x509.ExtKeyUsage{
+	"any":             x509.ExtKeyUsageAny,
+	"serverAuth":      x509.ExtKeyUsageServerAuth,
+	"clientAuth":      x509.ExtKeyUsageClientAuth,
+	"codeSigning":     x509.ExtKeyUsageCodeSigning,
+	"emailProtection": x509.ExtKeyUsageEmailProtection,
+	"timeStamping":    x509.ExtKeyUsageTimeStamping,
+	"ocspSigning":     x509.ExtKeyUsageOCSPSigning,
+}
+
+// GetUsages returns the names of Extended Key Usages which can be used in a whitelist
+func GetUsages() []string {
+	return []string{"any", "serverAuth", "clientAuth", "codeSigning", "emailProtection", "timeStamping", "ocspSigning"}
+}
+
+// AllowedUsages returns the Extended Key Usages a certificate should remain
+// trusted for. A nil slice means the certificate isn't restricted.
+func (w Whitelist) AllowedUsages(inc *x509.Certificate) []x509.ExtKeyUsage {
+	if inc == nil || len(w.Usages) == 0 {
+		return nil
+	}
+	fp := certutil.GetHexSHA256Fingerprint(*inc)
+
+	var out []x509.ExtKeyUsage
+	found := false
+	for i := range w.Usages {
+		for j := range w.Usages[i].Fingerprints {
+			if !strings.EqualFold(w.Usages[i].Fingerprints[j], fp) {
+				continue
+			}
+			found = true
+			for k := range w.Usages[i].Allow {
+				if u, ok := lookupUsage(w.Usages[i].Allow[k]); ok {
+					if u == x509.ExtKeyUsageAny {
+						return nil
+					}
+					out = append(out, u)
+				}
+			}
+		}
+	}
+	if found && out == nil {
+		return []x509.ExtKeyUsage{} // restricted to nothing
+	}
+	return out
+}
+
+func (w Whitelist) validateUsages() error {
+	for i := range w.Usages {
+		for j := range w.Usages[i].Allow {
+			if _, ok := lookupUsage(w.Usages[i].Allow[j]); !ok {
+				return fmt.Errorf("unknown extended key usage %q", w.Usages[i].Allow[j])
+			}
+		}
+	}
+	return nil
+}
+
+func lookupUsage(name string) (x509.ExtKeyUsage, bool) {
+	for k, v := range extKeyUsages {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return x509.ExtKeyUsageAny, false
+}
+
+// HasUsage returns true if `u` is in `usages`
+func HasUsage(usages []x509.ExtKeyUsage, u x509.ExtKeyUsage) bool {
+	for i := range usages {
+		if usages[i] == u {
+			return true
+		}
+	}
+	return false
+}
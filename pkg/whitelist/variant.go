@@ -0,0 +1,182 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package whitelist
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// hostLabels are the labels of this host, see SetLabels
+var hostLabels = Labels{}
+
+// Labels describe a host, e.g. role=ci or env=prod, and select which
+// Variants of a whitelist it gets.
+type Labels map[string]string
+
+// Variant is kept on top of the rest of a whitelist by hosts whose labels
+// match its Selector, so one whitelist can serve a heterogeneous fleet.
+type Variant struct {
+	// Selector is comma separated requirements which must all match a host's
+	// labels: "key=value" (the value can be a pattern, e.g. hostname=ci-*),
+	// "key!=value", "key" (the label is set) or "!key" (it isn't)
+	Selector string `json:"Selector" yaml:"selector"`
+
+	// What the variant keeps, its Extends are read relative to the
+	// whitelist the variant is in. Variants can't have variants.
+	Whitelist `yaml:",inline"`
+}
+
+// ParseLabels reads comma separated key=value pairs, e.g. "role=ci,env=prod"
+func ParseLabels(s string) (Labels, error) {
+	out := Labels{}
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		idx := strings.Index(kv, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("label %q isn't key=value", kv)
+		}
+		out[strings.TrimSpace(kv[:idx])] = strings.TrimSpace(kv[idx+1:])
+	}
+	return out, nil
+}
+
+// SetLabels sets the labels of this host from -labels. The hostname is
+// always included as "hostname", unless it's given.
+func SetLabels(s string) error {
+	labels, err := ParseLabels(s)
+	if err != nil {
+		return err
+	}
+	if _, ok := labels["hostname"]; !ok {
+		if hostname, err := os.Hostname(); err == nil {
+			labels["hostname"] = hostname
+		}
+	}
+	hostLabels = labels
+	return nil
+}
+
+// HostLabels returns the labels of this host, see SetLabels
+func HostLabels() Labels {
+	out := Labels{}
+	for k, v := range hostLabels {
+		out[k] = v
+	}
+	return out
+}
+
+// String returns the labels as sorted key=value pairs
+func (l Labels) String() string {
+	var out []string
+	for k, v := range l {
+		out = append(out, k+"="+v)
+	}
+	sort.Strings(out)
+	return strings.Join(out, ",")
+}
+
+// Matches returns if labels satisfies the variant's Selector
+func (v Variant) Matches(labels Labels) bool {
+	ok, _ := matchSelector(v.Selector, labels)
+	return ok
+}
+
+// ForLabels returns the whitelist with the items of every variant matching
+// labels merged in, in the order they're listed. The variants themselves
+// are left out.
+func (w Whitelist) ForLabels(labels Labels) Whitelist {
+	out := w
+	out.Variants = nil
+	for i := range w.Variants {
+		if w.Variants[i].Matches(labels) {
+			provenance := out.Provenance
+			out = merge(out, w.Variants[i].Whitelist)
+			out.Provenance = provenance
+		}
+	}
+	return out
+}
+
+func matchSelector(selector string, labels Labels) (bool, error) {
+	terms := strings.Split(selector, ",")
+	for i := range terms {
+		term := strings.TrimSpace(terms[i])
+		var key, value string
+		var ok bool
+		switch {
+		case term == "":
+			return false, errors.New("empty selector")
+		case strings.Contains(term, "!="):
+			parts := strings.SplitN(term, "!=", 2)
+			key, value = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+			have, set := labels[key]
+			matched, err := path.Match(value, have)
+			if err != nil {
+				return false, err
+			}
+			ok = !set || !matched
+		case strings.Contains(term, "="):
+			parts := strings.SplitN(term, "=", 2)
+			key, value = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+			have, set := labels[key]
+			matched, err := path.Match(value, have)
+			if err != nil {
+				return false, err
+			}
+			ok = set && matched
+		case strings.HasPrefix(term, "!"):
+			key = strings.TrimSpace(term[1:])
+			_, set := labels[key]
+			ok = !set
+		default:
+			key = term
+			_, ok = labels[key]
+		}
+		if key == "" {
+			return false, fmt.Errorf("selector %q has no label name", term)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (w Whitelist) validateVariants() error {
+	for i := range w.Variants {
+		v := w.Variants[i]
+		if v.Selector == "" {
+			return fmt.Errorf("variant %d has no selector", i+1)
+		}
+		if _, err := matchSelector(v.Selector, Labels{}); err != nil {
+			return fmt.Errorf("variant %q: %v", v.Selector, err)
+		}
+		if len(v.Variants) > 0 {
+			return fmt.Errorf("variant %q can't have variants", v.Selector)
+		}
+		if err := v.Whitelist.validate(); err != nil {
+			return fmt.Errorf("variant %q: %v", v.Selector, err)
+		}
+	}
+	return nil
+}
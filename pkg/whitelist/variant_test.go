@@ -0,0 +1,161 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package whitelist
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWhitelist__matchSelector(t *testing.T) {
+	labels := Labels{"role": "ci", "env": "prod", "hostname": "ci-runner-3"}
+	cases := map[string]bool{
+		"role=ci":             true,
+		"role=ci,env=prod":    true,
+		"role=ci,env=staging": false,
+		"hostname=ci-*":       true,
+		"hostname=web-*":      false,
+		"env!=staging":        true,
+		"env!=prod":           false,
+		"team!=payments":      true,
+		"role":                true,
+		"team":                false,
+		"!team":               true,
+		"!role":               false,
+	}
+	for selector, want := range cases {
+		got, err := matchSelector(selector, labels)
+		if err != nil {
+			t.Errorf("%s: %v", selector, err)
+		}
+		if got != want {
+			t.Errorf("%s: got %v", selector, got)
+		}
+	}
+	for _, selector := range []string{"", "role=ci,", "=ci", "!", "hostname=["} {
+		if _, err := matchSelector(selector, labels); err == nil {
+			t.Errorf("%q: expected error", selector)
+		}
+	}
+}
+
+func TestWhitelist__ParseLabels(t *testing.T) {
+	labels, err := ParseLabels("role=ci, env=prod,empty=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(labels, Labels{"role": "ci", "env": "prod", "empty": ""}) {
+		t.Errorf("got %v", labels)
+	}
+	if labels.String() != "empty=,env=prod,role=ci" {
+		t.Errorf("got %s", labels)
+	}
+	if _, err := ParseLabels("role"); err == nil {
+		t.Error("expected error")
+	}
+
+	if err := SetLabels("role=ci"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetLabels("")
+	hostname, _ := os.Hostname()
+	if l := HostLabels(); l["role"] != "ci" || l["hostname"] != hostname {
+		t.Errorf("got %v", l)
+	}
+}
+
+func TestWhitelist__variants(t *testing.T) {
+	dir := writeWhitelists(t, map[string]string{
+		"ci.yaml": "fingerprints:\n  - ci-tools\n",
+		"fleet.yaml": `fingerprints:
+  - base
+variants:
+  - selector: role=ci
+    extends:
+      - ci.yaml
+    fingerprints:
+      - ci
+  - selector: role=ci,env=prod
+    keys:
+      - prod-key
+  - selector: hostname=db-*
+    policies:
+      email:
+        fingerprints:
+          - mail
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	wh, err := FromFile(filepath.Join(dir, "fleet.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wh.Variants) != 3 || len(wh.Variants[0].Extends) != 0 {
+		t.Fatalf("got %#v", wh.Variants)
+	}
+
+	ci := wh.ForLabels(Labels{"role": "ci", "env": "prod"})
+	if !reflect.DeepEqual(ci.Fingerprints, []string{"base", "ci-tools", "ci"}) || !reflect.DeepEqual(ci.Keys, []string{"prod-key"}) {
+		t.Errorf("got %#v", ci)
+	}
+	if len(ci.Variants) != 0 {
+		t.Errorf("variants weren't removed: %#v", ci.Variants)
+	}
+	if db := wh.ForLabels(Labels{"hostname": "db-1"}); len(db.Fingerprints) != 1 || len(db.Policies["email"].Fingerprints) != 1 {
+		t.Errorf("got %#v", db)
+	}
+
+	// selecting is stable, so hashes of the same host's whitelist match
+	if ci.Hash() != wh.ForLabels(Labels{"role": "ci", "env": "prod"}).Hash() || ci.Hash() == wh.Hash() {
+		t.Error("unexpected hash")
+	}
+	if again := ci.ForLabels(Labels{}); again.Hash() != ci.Hash() {
+		t.Error("selecting again changed the whitelist")
+	}
+
+	// json
+	wh, err = parse([]byte(`{"Fingerprints": ["base"], "Variants": [{"Selector": "role=ci", "Fingerprints": ["ci"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ci := wh.ForLabels(Labels{"role": "ci"}); !reflect.DeepEqual(ci.Fingerprints, []string{"base", "ci"}) {
+		t.Errorf("got %#v", ci)
+	}
+}
+
+func TestWhitelist__variantsInvalid(t *testing.T) {
+	cases := map[string]string{
+		"variants:\n  - fingerprints:\n      - a\n":                                                     "has no selector",
+		"variants:\n  - selector: role=\n    fingerprints:\n      - a\n":                                "",
+		"variants:\n  - selector: a=b\n    variants:\n      - selector: c=d\n":                          "can't have variants",
+		"variants:\n  - selector: a=b\n    usages:\n      - fingerprints: [a]\n        allow: [nope]\n": "unknown",
+	}
+	for body, want := range cases {
+		_, err := parse([]byte(body))
+		if want == "" {
+			if err != nil {
+				t.Errorf("%q: %v", body, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: expected %q, got %v", body, want, err)
+		}
+	}
+}
@@ -15,10 +15,13 @@
 package whitelist
 
 import (
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
+	"path/filepath"
 	"strings"
 
 	"github.com/adamdecaf/cert-manage/pkg/certutil"
@@ -32,9 +35,69 @@ type Whitelist struct {
 	// SHA256 fingerprints
 	Fingerprints []string `json:"Fingerprints,omitempty" yaml:"fingerprints,omitempty"`
 
+	// SHA256 fingerprints of a public key (SPKI), these match every
+	// certificate for the key so a CA's cross-signed and reissued
+	// certificates are all kept
+	Keys []string `json:"Keys,omitempty" yaml:"keys,omitempty"`
+
+	// Fingerprints and keys which can expire, see Entry
+	Entries []Entry `json:"Entries,omitempty" yaml:"entries,omitempty"`
+
 	// ISO 3166-1 two-letter country codes used to match
 	// RFC 2253 Distinguished Names in certificates
 	Countries []string `json:"Countries,omitempty" yaml:"countries,omitempty"`
+
+	// ISO 3166-1 two-letter country codes used to match the Issuer
+	IssuerCountries []string `json:"IssuerCountries,omitempty" yaml:"issuerCountries,omitempty"`
+
+	// ISO 3166-1 two-letter country codes of where a CA is operated from,
+	// this uses a curated mapping of CA operators before falling back to the Subject
+	Jurisdictions []string `json:"Jurisdictions,omitempty" yaml:"jurisdictions,omitempty"`
+
+	// ISO 3166-1 two-letter country codes which are never matched, this is
+	// checked against the Subject, Issuer and operator jurisdiction.
+	ExcludeCountries []string `json:"ExcludeCountries,omitempty" yaml:"excludeCountries,omitempty"`
+
+	// Extended Key Usage restrictions for matched certificates
+	Usages []Usage `json:"Usages,omitempty" yaml:"usages,omitempty"`
+
+	// Named keep-lists (e.g. "web", "email" and "code-signing") which are
+	// selected with -policy, see ForPolicies
+	Policies map[string]Policy `json:"Policies,omitempty" yaml:"policies,omitempty"`
+
+	// GnuPG key fingerprints which keep their ownertrust with -app gpg
+	GPGKeys []string `json:"GPGKeys,omitempty" yaml:"gpgKeys,omitempty"`
+
+	// SSH CA key fingerprints (e.g. SHA256:...) which stay trusted with -app ssh
+	SSHKeys []string `json:"SSHKeys,omitempty" yaml:"sshKeys,omitempty"`
+
+	// Other whitelist files (or URLs) merged into this one, relative paths are
+	// read from the directory of the file extending them
+	Extends []string `json:"Extends,omitempty" yaml:"extends,omitempty"`
+
+	// Items kept only on hosts with matching labels (see -labels), selected
+	// with ForLabels
+	Variants []Variant `json:"Variants,omitempty" yaml:"variants,omitempty"`
+
+	// Where the fingerprints were fetched from, this isn't used for matching
+	Provenance []Provenance `json:"Provenance,omitempty" yaml:"provenance,omitempty"`
+}
+
+// Provenance records the root program download fingerprints were read from
+type Provenance struct {
+	Source string `json:"Source" yaml:"source"`
+	URL    string `json:"URL" yaml:"url"`
+
+	// RFC 3339 timestamp, in UTC
+	Retrieved string `json:"Retrieved" yaml:"retrieved"`
+
+	// SHA256 of the downloaded bundle, hex encoded
+	SHA256 string `json:"SHA256" yaml:"sha256"`
+
+	// Signer of the bundle, if it was signed and verified
+	Signer string `json:"Signer,omitempty" yaml:"signer,omitempty"`
+
+	Fingerprints []string `json:"Fingerprints" yaml:"fingerprints"`
 }
 
 // Matches checks a given x509 certificate against the criteria and
@@ -47,10 +110,21 @@ func (w Whitelist) Matches(inc *x509.Certificate) bool {
 	fp := certutil.GetHexSHA256Fingerprint(*inc)
 
 	// is the certificate explicitly distrusted?
-	for i := range blacklistedFingerprints {
-		if blacklistedFingerprints[i] == fp {
+	if isBlacklisted(fp) {
+		return false
+	}
+
+	// is the certificate from an excluded country?
+	if len(w.ExcludeCountries) > 0 {
+		if countriesOverlap(inc.Subject.Country, w.ExcludeCountries) ||
+			countriesOverlap(inc.Issuer.Country, w.ExcludeCountries) ||
+			countriesOverlap(jurisdictions(inc), w.ExcludeCountries) {
 			return false
 		}
+		// with nothing else to match on keep everything not excluded
+		if !w.hasIncludes() {
+			return true
+		}
 	}
 
 	// check if our whitelist's fingerprints include this certificate
@@ -60,28 +134,111 @@ func (w Whitelist) Matches(inc *x509.Certificate) bool {
 		}
 	}
 
-	// check Country in Subject
-	for i := range inc.Subject.Country {
-		for j := range w.Countries {
-			if strings.ToLower(inc.Subject.Country[i]) == strings.ToLower(w.Countries[j]) {
-				return true
-			}
+	// check if the certificate's key is whitelisted
+	if matchesKey(w.Keys, inc) {
+		return true
+	}
+
+	// check entries which haven't expired
+	if w.matchesEntries(inc) {
+		return true
+	}
+
+	// check Country in Subject and Issuer
+	if countriesOverlap(inc.Subject.Country, w.Countries) {
+		return true
+	}
+	if countriesOverlap(inc.Issuer.Country, w.IssuerCountries) {
+		return true
+	}
+
+	// check where the CA is operated from
+	if len(w.Jurisdictions) > 0 && countriesOverlap(jurisdictions(inc), w.Jurisdictions) {
+		return true
+	}
+
+	return false
+}
+
+// hasIncludes returns true if the whitelist has any items matching
+// certificates, ExcludeCountries only removes from those.
+func (w Whitelist) hasIncludes() bool {
+	return len(w.Fingerprints) > 0 || len(w.Keys) > 0 || len(w.Entries) > 0 ||
+		len(w.Countries) > 0 || len(w.IssuerCountries) > 0 || len(w.Jurisdictions) > 0
+}
+
+// MatchesGPGKey returns true if a GnuPG key's fingerprint is in GPGKeys.
+// Spaces, which gpg prints between groups of the fingerprint, are ignored.
+func (w Whitelist) MatchesGPGKey(fingerprint string) bool {
+	fingerprint = strings.Replace(fingerprint, " ", "", -1)
+	for i := range w.GPGKeys {
+		if strings.EqualFold(strings.Replace(w.GPGKeys[i], " ", "", -1), fingerprint) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesSSHKey returns true if an SSH key's SHA256 fingerprint is in
+// SSHKeys, the "SHA256:" prefix is optional.
+func (w Whitelist) MatchesSSHKey(fingerprint string) bool {
+	fingerprint = strings.TrimPrefix(fingerprint, "SHA256:")
+	for i := range w.SSHKeys {
+		if strings.TrimPrefix(w.SSHKeys[i], "SHA256:") == fingerprint {
+			return true
 		}
 	}
+	return false
+}
+
+// IsBlacklisted returns true if the certificate is explicitly distrusted by
+// Chromium's blacklist, these certificates never match a whitelist.
+func IsBlacklisted(inc *x509.Certificate) bool {
+	if inc == nil {
+		return false
+	}
+	return isBlacklisted(certutil.GetHexSHA256Fingerprint(*inc))
+}
 
+func isBlacklisted(fp string) bool {
+	for i := range blacklistedFingerprints {
+		if blacklistedFingerprints[i] == fp {
+			return true
+		}
+	}
 	return false
 }
 
+// Hash returns a hex encoded SHA256 of the whitelist's items, provenance
+// is left out so refetching the same roots doesn't change it.
+func (w Whitelist) Hash() string {
+	w.Provenance = nil
+	bs, _ := json.Marshal(w)
+	sum := sha256.Sum256(bs)
+	return hex.EncodeToString(sum[:])
+}
+
 // MatchesAll checks if a given list of certificates all match against a whitelist
 func (w Whitelist) MatchesAll(cs []*x509.Certificate) bool {
-	for i := range cs {
-		if !w.Matches(cs[i]) {
+	matches := w.MatchEach(cs)
+	for i := range matches {
+		if !matches[i] {
 			return false
 		}
 	}
 	return true
 }
 
+// MatchEach returns if each certificate matches the whitelist, large stores
+// are checked in parallel.
+func (w Whitelist) MatchEach(cs []*x509.Certificate) []bool {
+	out := make([]bool, len(cs))
+	certutil.ForEach(len(cs), func(i int) {
+		out[i] = w.Matches(cs[i])
+	})
+	return out
+}
+
 // FromCertificates returns a Whitelist with only the fingerprints of the passed
 // certificates included.
 func FromCertificates(certs []*x509.Certificate) Whitelist {
@@ -96,28 +253,56 @@ func FromCertificates(certs []*x509.Certificate) Whitelist {
 	return wh
 }
 
-// FromFile reads a whitelist file and parses it into items
+// FromFile reads a whitelist file and parses it into items, including the
+// items of any whitelists it extends
 func FromFile(path string) (Whitelist, error) {
-	wh := Whitelist{}
-	b, err := ioutil.ReadFile(path)
-	if err != nil {
-		return wh, err
+	if !isURL(path) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return Whitelist{}, err
+		}
+		path = abs
 	}
+	return fromSource(path, nil)
+}
+
+func parse(b []byte) (Whitelist, error) {
+	wh := Whitelist{}
 
 	// try reading as json
-	if err = json.Unmarshal(b, &wh); err == nil {
-		return wh, nil
+	if err := json.Unmarshal(b, &wh); err == nil {
+		return wh, wh.validate()
 	}
 
 	// try reading as yaml
-	if err = yaml.Unmarshal(b, &wh); err == nil {
-		return wh, nil
+	if err := yaml.Unmarshal(b, &wh); err == nil {
+		return wh, wh.validate()
 	}
 	return wh, errors.New("Unable to read whitelist")
 }
 
-// ToFile take a Whitelist, encodes it in yaml and writes the result
+func (w Whitelist) validate() error {
+	if err := w.validateUsages(); err != nil {
+		return err
+	}
+	if err := w.validateEntries(); err != nil {
+		return err
+	}
+	if err := w.validateVariants(); err != nil {
+		return err
+	}
+	return w.validatePolicies()
+}
+
+// ToFile take a Whitelist, encodes it in yaml and writes the result. Entries
+// of the whitelist already at path are kept for the fingerprints and keys
+// still included.
 func (w Whitelist) ToFile(path string) error {
+	if bs, err := ioutil.ReadFile(path); err == nil {
+		if prev, err := parse(bs); err == nil {
+			w = w.keepEntries(prev)
+		}
+	}
 	out, err := yaml.Marshal(&w)
 	if err != nil {
 		return err
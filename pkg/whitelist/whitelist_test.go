@@ -15,11 +15,17 @@
 package whitelist
 
 import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/adamdecaf/cert-manage/pkg/certutil"
+	"github.com/adamdecaf/cert-manage/pkg/testca"
 )
 
 func TestWhitelist_nocert(t *testing.T) {
@@ -83,6 +89,28 @@ func TestWhitelist_remove(t *testing.T) {
 	}
 }
 
+func TestWhitelist__MatchEach(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// enough certificates to be checked in parallel
+	var many []*x509.Certificate
+	for len(many) < 200 {
+		many = append(many, certs...)
+	}
+	wh := FromCertificates(certs[:2])
+	matches := wh.MatchEach(many)
+	for i := range many {
+		if matches[i] != wh.Matches(many[i]) {
+			t.Errorf("%d: got %v", i, matches[i])
+		}
+	}
+	if wh.MatchesAll(many) || !wh.MatchesAll(certs[:2]) {
+		t.Error("unexpected MatchesAll")
+	}
+}
+
 func TestWhitelist__jsonFile(t *testing.T) {
 	wh, err := FromFile("../../testdata/complete-whitelist.json")
 	if err != nil {
@@ -204,3 +232,355 @@ func TestWhitlist__matching(t *testing.T) {
 		t.Error("should have matched")
 	}
 }
+
+func TestWhitelist__profiles(t *testing.T) {
+	names := GetProfiles()
+	if len(names) != 3 {
+		t.Fatalf("got %q", names)
+	}
+	for i := range names {
+		wh, err := FromProfile(names[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(wh.Fingerprints) == 0 {
+			t.Errorf("%s has no fingerprints", names[i])
+		}
+	}
+
+	// minimal-web should be a subset of mozilla-only
+	all, _ := FromProfile("mozilla-only")
+	min, _ := FromProfile("minimal-web")
+	if len(min.Fingerprints) >= len(all.Fingerprints) {
+		t.Errorf("minimal-web=%d mozilla-only=%d", len(min.Fingerprints), len(all.Fingerprints))
+	}
+
+	// us-gov-excluded shouldn't contain any US CAs
+	wh, _ := FromProfile("us-gov-excluded")
+	certs, err := certutil.FromFile("../../testdata/lots.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range certs {
+		if !wh.Matches(certs[i]) {
+			continue
+		}
+		for _, c := range certs[i].Subject.Country {
+			if c == "US" {
+				t.Errorf("found US CA: %s", certs[i].Subject.CommonName)
+			}
+		}
+	}
+
+	if _, err := FromProfile("other"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestWhitelist__geography(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/example.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := certs[0]
+
+	cases := []struct {
+		wh      Whitelist
+		matches bool
+	}{
+		{Whitelist{IssuerCountries: []string{"us"}}, true},
+		{Whitelist{IssuerCountries: []string{"GB"}}, false},
+		{Whitelist{Jurisdictions: []string{"US"}}, true},
+		{Whitelist{Jurisdictions: []string{"NL"}}, false},
+		// exclusions win over anything else
+		{Whitelist{Countries: []string{"US"}, ExcludeCountries: []string{"US"}}, false},
+		{Whitelist{Fingerprints: []string{certutil.GetHexSHA256Fingerprint(*cert)}, ExcludeCountries: []string{"US"}}, false},
+		{Whitelist{Countries: []string{"US"}, ExcludeCountries: []string{"CN"}}, true},
+		{Whitelist{ExcludeCountries: []string{"CN"}}, true},
+		{Whitelist{ExcludeCountries: []string{"US"}}, false},
+	}
+	for i := range cases {
+		if v := cases[i].wh.Matches(cert); v != cases[i].matches {
+			t.Errorf("idx=%d got %v, expected %v", i, v, cases[i].matches)
+		}
+	}
+
+	// operator mapping overrides the Subject's Country
+	cert.Subject.Organization = []string{"Baltimore"}
+	cert.Subject.Country = []string{"IE"}
+	if v := jurisdictions(cert); len(v) != 1 || v[0] != "US" {
+		t.Errorf("got %q", v)
+	}
+	cert.Subject.Organization = []string{"Other"}
+	if v := jurisdictions(cert); len(v) != 1 || v[0] != "IE" {
+		t.Errorf("got %q", v)
+	}
+}
+
+func TestWhitelist__usages(t *testing.T) {
+	certs, err := certutil.FromFile("../../testdata/example.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := certutil.GetHexSHA256Fingerprint(*certs[0])
+
+	wh := Whitelist{Fingerprints: []string{fp}}
+	if v := wh.AllowedUsages(certs[0]); v != nil {
+		t.Errorf("expected no restriction, got %v", v)
+	}
+
+	wh.Usages = []Usage{
+		{Fingerprints: []string{fp}, Allow: []string{"serverauth"}},
+	}
+	v := wh.AllowedUsages(certs[0])
+	if len(v) != 1 || v[0] != x509.ExtKeyUsageServerAuth {
+		t.Errorf("got %v", v)
+	}
+	if !HasUsage(v, x509.ExtKeyUsageServerAuth) || HasUsage(v, x509.ExtKeyUsageCodeSigning) {
+		t.Errorf("got %v", v)
+	}
+
+	// 'any' removes restrictions
+	wh.Usages[0].Allow = []string{"serverAuth", "any"}
+	if v := wh.AllowedUsages(certs[0]); v != nil {
+		t.Errorf("expected no restriction, got %v", v)
+	}
+
+	wh.Usages[0].Allow = []string{"other"}
+	if err := wh.validateUsages(); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestWhitelist__Hash(t *testing.T) {
+	a := Whitelist{Fingerprints: []string{"a"}}
+	b := Whitelist{Fingerprints: []string{"a"}}
+	if a.Hash() != b.Hash() {
+		t.Error("expected equal hashes")
+	}
+	b.Provenance = []Provenance{{Source: "nss"}}
+	if a.Hash() != b.Hash() {
+		t.Error("expected provenance to be ignored")
+	}
+	b.Countries = []string{"US"}
+	if a.Hash() == b.Hash() {
+		t.Error("expected different hashes")
+	}
+}
+
+func TestWhitelist__testca(t *testing.T) {
+	h, err := testca.NewHierarchy("example.com", &testca.Options{Country: "GB"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := testca.NewRoot("Other Root CA", &testca.Options{Country: "FR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, inter := h.Root.Certificate, h.Intermediate.Certificate
+
+	wh := Whitelist{Countries: []string{"GB"}}
+	if !wh.MatchesAll([]*x509.Certificate{root, inter}) {
+		t.Error("expected GB certificates to match")
+	}
+	if wh.Matches(other.Certificate) {
+		t.Error("expected FR root to not match")
+	}
+
+	wh = FromCertificates([]*x509.Certificate{root})
+	if !wh.Matches(root) || wh.Matches(inter) {
+		t.Error("expected only the root to match")
+	}
+}
+
+func TestWhitelist__keys(t *testing.T) {
+	root, err := testca.NewRoot("Cross Root CA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := testca.NewRoot("Other Root CA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cross, err := other.CrossSign(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs := []*x509.Certificate{root.Certificate, cross, other.Certificate}
+
+	// a fingerprint only keeps one representation of the CA
+	wh := FromCertificates([]*x509.Certificate{root.Certificate})
+	if ans := wh.MatchEach(certs); !reflect.DeepEqual(ans, []bool{true, false, false}) {
+		t.Errorf("got %v", ans)
+	}
+
+	spki := certutil.GetBase64SPKISHA256Fingerprint(*root.Certificate)
+	for _, key := range []string{spki, "sha256/" + spki} {
+		wh = Whitelist{Keys: []string{key}}
+		if ans := wh.MatchEach(certs); !reflect.DeepEqual(ans, []bool{true, true, false}) {
+			t.Errorf("%s: got %v", key, ans)
+		}
+	}
+}
+
+func TestWhitelist__policies(t *testing.T) {
+	wh, err := parse([]byte(`
+fingerprints:
+ - "aa"
+policies:
+  web:
+    fingerprints: ["aa", "bb", "cc"]
+  email:
+    fingerprints: ["CC", "dd"]
+  clients:
+    fingerprints: ["ee"]
+    usages: ["clientAuth"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := wh.GetPolicies(); !reflect.DeepEqual(names, []string{"clients", "email", "web"}) {
+		t.Errorf("got %v", names)
+	}
+
+	web, err := wh.ForPolicies([]string{"WEB"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(web.Fingerprints, []string{"aa", "bb", "cc"}) || web.Policies != nil {
+		t.Errorf("got %#v", web)
+	}
+	// aa is kept outright by the whitelist
+	if len(web.Usages) != 1 || !reflect.DeepEqual(web.Usages[0], Usage{Fingerprints: []string{"bb", "cc"}, Allow: []string{"serverAuth"}}) {
+		t.Errorf("got %#v", web.Usages)
+	}
+
+	all, err := wh.ForPolicies(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(all.Fingerprints, []string{"aa", "ee", "cc", "dd", "bb"}) {
+		t.Errorf("got %v", all.Fingerprints)
+	}
+	if len(all.Usages) != 3 {
+		t.Errorf("got %#v", all.Usages)
+	}
+
+	if _, err := wh.ForPolicies([]string{"other"}); err == nil {
+		t.Error("expected error")
+	}
+
+	// policies without a default need usages
+	if _, err := parse([]byte(`{"Policies": {"internal": {"Fingerprints": ["aa"]}}}`)); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := parse([]byte(`{"Policies": {"web": {"Usages": ["bogus"]}}}`)); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestWhitelist__expiringEntries(t *testing.T) {
+	temp, err := testca.NewRoot("Vendor Root CA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := testca.NewRoot("Other Root CA", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := certutil.GetHexSHA256Fingerprint(*temp.Certificate)
+	wh, err := parse([]byte(fmt.Sprintf(`{"entries": [{"fingerprints": ["%s"], "expires": "2025-12-31"}]}`, fp)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs := []*x509.Certificate{temp.Certificate, other.Certificate}
+
+	defer func() { now = time.Now }()
+	cases := map[string][]bool{
+		"2025-12-31T23:59:59Z": {true, false}, // the last day is included
+		"2026-01-01T00:00:00Z": {false, false},
+	}
+	for when, want := range cases {
+		at, _ := time.Parse(time.RFC3339, when)
+		now = func() time.Time { return at }
+		if ans := wh.MatchEach(certs); !reflect.DeepEqual(ans, want) {
+			t.Errorf("%s: got %v", when, ans)
+		}
+		if expired := len(wh.ExpiredEntries(at)) == 1; expired == want[0] {
+			t.Errorf("%s: expired=%v", when, expired)
+		}
+	}
+
+	// an RFC 3339 time is exact, entries without one don't expire
+	e := Entry{Fingerprints: []string{fp}, Expires: "2026-03-01T12:00:00Z"}
+	at, _ := e.ExpiresAt()
+	if !e.Expired(at) || e.Expired(at.Add(-time.Second)) {
+		t.Errorf("unexpected expiry at %v", at)
+	}
+	if (Entry{}).Expired(time.Now()) {
+		t.Error("entry without expires expired")
+	}
+
+	if _, err := parse([]byte(`entries: [{fingerprints: ["aa"], expires: "31/12/2025"}]`)); err == nil {
+		t.Error("expected an error for a malformed expires")
+	}
+}
+
+func TestWhitelist__entryAnnotations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert-manage-whitelist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "wh.yaml")
+
+	err = ioutil.WriteFile(path, []byte(`
+fingerprints: ["aa"]
+entries:
+ - fingerprints: ["bb", "cc"]
+   expires: "2025-12-31"
+   owner: "payments"
+   ticket: "SEC-42"
+   reason: "vendor onboarding"
+   addedBy: "alice"
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wh, err := FromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "owner: payments, ticket: SEC-42, reason: vendor onboarding, added by: alice"
+	if len(wh.Entries) != 1 || wh.Entries[0].Annotation() != want {
+		t.Fatalf("got %#v", wh.Entries)
+	}
+	if (Entry{}).Annotation() != "" {
+		t.Error("expected no annotation")
+	}
+
+	// rewriting the whitelist keeps the entry for fingerprints still included
+	regen := Whitelist{Fingerprints: []string{"aa", "CC", "dd"}}
+	if err := regen.ToFile(path); err != nil {
+		t.Fatal(err)
+	}
+	wh, err = FromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(wh.Fingerprints, []string{"aa", "dd"}) {
+		t.Errorf("got %v", wh.Fingerprints)
+	}
+	if len(wh.Entries) != 1 || !reflect.DeepEqual(wh.Entries[0].Fingerprints, []string{"CC"}) ||
+		wh.Entries[0].Annotation() != want || wh.Entries[0].Expires != "2025-12-31" {
+		t.Errorf("got %#v", wh.Entries)
+	}
+
+	// entries whose fingerprints are all gone are dropped
+	if err := (Whitelist{Fingerprints: []string{"aa"}}).ToFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if wh, err = FromFile(path); err != nil || len(wh.Entries) != 0 {
+		t.Errorf("got %#v, err=%v", wh.Entries, err)
+	}
+}
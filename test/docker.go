@@ -37,12 +37,12 @@ var (
 )
 
 type dockerfile struct {
+	// Commands to be ran in the image
+	script
+
 	// Local fs path to the Dockerfile
 	base string
 
-	// Commands represents a series of commands to be ran in the image
-	commands []*Cmd
-
 	// -t flag with build/run
 	tag string
 
@@ -51,11 +51,9 @@ type dockerfile struct {
 
 	// only run build, tag and run steps once
 	wg sync.WaitGroup
-
-	// used for cert-manage init
-	sync.Once
 }
 
+// Dockerfile returns a linux image, commands are ran with /bin/sh
 func Dockerfile(where string) *dockerfile {
 	if !strings.HasSuffix(where, "Dockerfile") {
 		where = filepath.Join(where, "/Dockerfile")
@@ -67,53 +65,24 @@ func Dockerfile(where string) *dockerfile {
 	tag := fmt.Sprintf("cert-manage:%s-%d", filepath.Base(dir), now)
 
 	return &dockerfile{
+		script: script{
+			platform: "linux",
+			root:     "/",
+		},
 		base: where,
 		tag:  tag,
 	}
 }
 
-func (d *dockerfile) Run(cmd string, args ...string) {
-	d.commands = append(d.commands, Command(cmd, args...))
-}
-
-func (d *dockerfile) RunSplit(stmt string) {
-	parts := strings.Split(stmt, " ")
-	d.Run(parts[0], parts[1:]...)
-}
-
-func (d *dockerfile) ShouldFail(cmd string, args ...string) {
-	d.Run("set +e")
-	d.Run(cmd, args...)
-	d.Run("set -e")
-}
-
-func (d *dockerfile) ExitCode(code, cmd string, args ...string) {
-	d.Run("set +e")
-	d.Run(cmd, args...)
-	d.Run("code=$?")
-	d.Run("set -e")
-	d.Run("echo", "$code", "|", "grep", code)
-}
-
-// Equals returns an os/exec array of bash commands to check the previous command
-func (d *dockerfile) OutputEquals(answer string) []string {
-	return []string{
-		// store stdout
-		">", "/tmp/answer",
-		// compare against last line of output
-		"&&", fmt.Sprintf(`[ $(tail -1 /tmp/answer) -eq "%s" ]`, answer),
+// WindowsDockerfile returns a windows container image, which needs docker
+// to be running windows containers. Commands are ran with PowerShell.
+func WindowsDockerfile(where string) *dockerfile {
+	d := Dockerfile(where)
+	d.script = script{
+		platform: "windows",
+		root:     `C:\cert-manage`,
 	}
-}
-
-func (d *dockerfile) CertManage(args ...string) {
-	d.Do(func() {
-		d.Run("chmod", "+x", "/bin/cert-manage")
-	})
-	d.Run("/bin/cert-manage", args...)
-}
-
-func (d *dockerfile) CertManageEQ(args, answer string) {
-	d.CertManage(append(strings.Split(args, " "), d.OutputEquals(answer)...)...)
+	return d
 }
 
 func (d *dockerfile) SuccessT(t *testing.T) {
@@ -143,21 +112,10 @@ func (d *dockerfile) build() {
 		return
 	}
 
-	// Copy cert-manage and whitelist to the temp directory and assume it's linux
-	copyable := []string{
-		"../bin/cert-manage-linux-amd64",
-		"../testdata/Download.java",
-		"../testdata/globalsign-whitelist.json",
-		"../testdata/us-whitelist.yaml",
-		"../testdata/localcert.pem",
-	}
-	for i := range copyable {
-		name := filepath.Base(copyable[i])
-		err = file.CopyFile(copyable[i], filepath.Join(dir, name))
-		if err != nil {
-			d.err = fmt.Errorf("error copying %s to tmp dir, err=%v", name, err)
-			return
-		}
+	// Copy cert-manage and whitelist to the temp directory
+	if err := copyTestFiles(d.platform, dir); err != nil {
+		d.err = err
+		return
 	}
 
 	dst, err := os.Create(filepath.Join(dir, "Dockerfile"))
@@ -187,30 +145,11 @@ func (d *dockerfile) build() {
 	}
 
 	// Add all commands to a script copied Dockerfile
-	script, err := os.Create(filepath.Join(dir, "script.sh"))
-	if err != nil {
+	name, contents := d.render()
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
 		d.err = err
 		return
 	}
-	defer os.Remove(script.Name())
-	_, err = script.WriteString(`#!/bin/sh
-set +x
-set -e` + "\n") // force newline
-	if err != nil {
-		d.err = err
-		return
-	}
-	for i := range d.commands {
-		line := fmt.Sprintf("%s %s\n", d.commands[i].command, strings.Join(d.commands[i].args, " "))
-		if _, err := script.WriteString(line); err != nil {
-			d.err = fmt.Errorf("command=%q err=%v", line, err)
-			return
-		}
-	}
-	d.err = script.Sync()
-	if d.err != nil {
-		return
-	}
 
 	// Build docker image now
 	out, err := exec.Command("docker", "build", "-t", d.tag, dir).CombinedOutput()
@@ -251,7 +190,11 @@ func (d *dockerfile) prep() {
 }
 
 func (d *dockerfile) enabled() bool {
-	return IsDockerEnabled()
+	if !IsDockerEnabled() {
+		return false
+	}
+	// windows containers only run when docker is switched to them
+	return (d.platform == "windows") == (dockerOSType() == "windows")
 }
 
 func IsDockerEnabled() bool {
@@ -268,3 +211,36 @@ func IsDockerEnabled() bool {
 	// declare docker is disabled (avoid docker-in-docker)
 	return !file.Exists("/.dockerenv")
 }
+
+// dockerOSType returns the kind of containers docker runs, linux or windows
+func dockerOSType() string {
+	out, err := exec.Command("docker", "info", "-f", "{{.OSType}}").CombinedOutput()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// copyTestFiles copies the cert-manage binary for platform along with the
+// files suites use into dir
+func copyTestFiles(platform, dir string) error {
+	binary := map[string]string{
+		"darwin":  "../bin/cert-manage-osx-amd64",
+		"linux":   "../bin/cert-manage-linux-amd64",
+		"windows": "../bin/cert-manage-amd64.exe",
+	}
+	copyable := []string{
+		binary[platform],
+		"../testdata/Download.java",
+		"../testdata/globalsign-whitelist.json",
+		"../testdata/us-whitelist.yaml",
+		"../testdata/localcert.pem",
+	}
+	for i := range copyable {
+		name := filepath.Base(copyable[i])
+		if err := file.CopyFile(copyable[i], filepath.Join(dir, name)); err != nil {
+			return fmt.Errorf("error copying %s to tmp dir, err=%v", name, err)
+		}
+	}
+	return nil
+}
@@ -217,7 +217,7 @@ func TestIntegration__WhitelistAndRemove(t *testing.T) {
 	}
 
 	// restore
-	cmd = CertManage("restore").Trim()
+	cmd = CertManage("restore", "-y").Trim()
 	cmd.EqualT(t, "Restore completed successfully")
 	cmd.SuccessT(t)
 
@@ -0,0 +1,153 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+var (
+	// macosVM picks where macOS suites run, they're skipped when it's empty
+	//  - local: this machine, which must be a disposable CI runner (e.g. GitHub's macOS runners)
+	//  - tart:<vm>: a running Tart VM, reached over ssh as $MACOS_VM_USER (default admin)
+	//  - anka:<vm>: a running Anka VM
+	macosVM = os.Getenv("MACOS_VM")
+
+	macosVMUser = func() string {
+		if u := os.Getenv("MACOS_VM_USER"); u != "" {
+			return u
+		}
+		return "admin"
+	}()
+)
+
+// macVM runs a suite against the real keychains of a macOS machine
+type macVM struct {
+	script
+}
+
+func MacOS() *macVM {
+	return &macVM{
+		script: script{
+			platform: "darwin",
+			root:     "/tmp/cert-manage",
+		},
+	}
+}
+
+func (m *macVM) SuccessT(t *testing.T) {
+	t.Helper()
+
+	kind, name := macosVM, ""
+	if i := strings.Index(macosVM, ":"); i > 0 {
+		kind, name = macosVM[:i], macosVM[i+1:]
+	}
+	switch kind {
+	case "":
+		t.Skip("MACOS_VM isn't set")
+	case "local":
+		if runtime.GOOS != "darwin" || !inCI() {
+			t.Skip("not mutating non-CI keychains")
+		}
+	case "tart", "anka":
+		if name == "" {
+			t.Fatalf("MACOS_VM=%s needs a VM name, e.g. %s:<vm>", kind, kind)
+		}
+	default:
+		t.Fatalf("unknown MACOS_VM %q, options: local, tart:<vm>, anka:<vm>", macosVM)
+	}
+
+	dir, err := ioutil.TempDir("", "cert-manage-macos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := m.prepare(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	var out []byte
+	switch kind {
+	case "local":
+		os.RemoveAll(m.root)
+		if err := os.Rename(dir, m.root); err != nil {
+			t.Fatal(err)
+		}
+		out, err = exec.Command("sh", m.Path("script.sh")).CombinedOutput()
+	case "tart":
+		out, err = m.runTart(name, dir)
+	case "anka":
+		out, err = m.runAnka(name, dir)
+	}
+	if debug {
+		fmt.Println(string(out))
+	}
+	if err != nil {
+		t.Fatalf("ERROR: err=%v\nOutput: %s", err, string(out))
+	}
+}
+
+// prepare copies cert-manage, the test files and our script into dir, named
+// as they are in the VM
+func (m *macVM) prepare(dir string) error {
+	if err := copyTestFiles(m.platform, dir); err != nil {
+		return err
+	}
+	renames := map[string]string{
+		"cert-manage-osx-amd64":     "cert-manage",
+		"globalsign-whitelist.json": "whitelist.json",
+	}
+	for from, to := range renames {
+		if err := os.Rename(filepath.Join(dir, from), filepath.Join(dir, to)); err != nil {
+			return err
+		}
+	}
+	name, contents := m.render()
+	return ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+}
+
+func (m *macVM) runTart(vm, dir string) ([]byte, error) {
+	ip, err := exec.Command("tart", "ip", vm).Output()
+	if err != nil {
+		return nil, fmt.Errorf("error finding ip of tart vm %s: %v", vm, err)
+	}
+	host := fmt.Sprintf("%s@%s", macosVMUser, strings.TrimSpace(string(ip)))
+	opts := []string{"-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null"}
+
+	if out, err := exec.Command("ssh", append(opts, host, "rm -rf "+m.root)...).CombinedOutput(); err != nil {
+		return out, err
+	}
+	if out, err := exec.Command("scp", append(opts, "-r", dir, host+":"+m.root)...).CombinedOutput(); err != nil {
+		return out, err
+	}
+	return exec.Command("ssh", append(opts, host, "sh "+m.Path("script.sh"))...).CombinedOutput()
+}
+
+func (m *macVM) runAnka(vm, dir string) ([]byte, error) {
+	if out, err := exec.Command("anka", "run", "-n", vm, "rm", "-rf", m.root).CombinedOutput(); err != nil {
+		return out, err
+	}
+	if out, err := exec.Command("anka", "cp", "-a", dir+"/", vm+":"+m.root).CombinedOutput(); err != nil {
+		return out, err
+	}
+	return exec.Command("anka", "run", "-n", vm, "sh", m.Path("script.sh")).CombinedOutput()
+}
@@ -0,0 +1,30 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"testing"
+)
+
+func TestMacOS__suite(t *testing.T) {
+	t.Parallel()
+
+	// The roots differ between macOS releases, so counts are read before
+	// whitelisting instead.
+	platformSuite(t, MacOS(), cfg{
+		platform:     "darwin",
+		curlExitCode: "60",
+	})
+}
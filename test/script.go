@@ -0,0 +1,208 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Kinds of steps in a script
+const (
+	stepRun      = iota // must exit zero
+	stepAny             // any exit code
+	stepExitCode        // must exit with answer
+	stepOutput          // last line of output must equal answer
+	stepSave            // last line of output is saved into the variable answer
+)
+
+// step is a command in a script. Commands which aren't portable between
+// shells are given as raw text instead.
+type step struct {
+	cmd    *Cmd
+	raw    string
+	kind   int
+	answer string
+}
+
+// script collects the commands a suite runs on one platform ("linux",
+// "darwin" or "windows"), which are rendered as a POSIX shell script or a
+// PowerShell script on windows.
+type script struct {
+	platform string
+
+	// root is the directory cert-manage and the test files are copied into
+	root string
+
+	steps []step
+
+	// used for cert-manage init
+	sync.Once
+}
+
+func (s *script) Run(cmd string, args ...string) {
+	s.steps = append(s.steps, step{cmd: Command(cmd, args...)})
+}
+
+func (s *script) RunSplit(stmt string) {
+	parts := strings.Split(stmt, " ")
+	s.Run(parts[0], parts[1:]...)
+}
+
+func (s *script) ShouldFail(cmd string, args ...string) {
+	s.steps = append(s.steps, step{cmd: Command(cmd, args...), kind: stepAny})
+}
+
+func (s *script) ExitCode(code, cmd string, args ...string) {
+	s.steps = append(s.steps, step{cmd: Command(cmd, args...), kind: stepExitCode, answer: code})
+}
+
+// Path returns where a copied test file is, e.g. whitelist.json
+func (s *script) Path(name string) string {
+	if s.platform == "windows" {
+		return s.root + `\` + name
+	}
+	return strings.TrimSuffix(s.root, "/") + "/" + name
+}
+
+func (s *script) binary() string {
+	switch s.platform {
+	case "windows":
+		return s.Path("cert-manage.exe")
+	case "linux":
+		return "/bin/cert-manage"
+	}
+	return s.Path("cert-manage")
+}
+
+// init makes cert-manage executable before it's first ran
+func (s *script) init() {
+	s.Do(func() {
+		if s.platform != "windows" {
+			s.Run("chmod", "+x", s.binary())
+		}
+	})
+}
+
+func (s *script) CertManage(args ...string) {
+	s.init()
+	s.Run(s.binary(), args...)
+}
+
+func (s *script) CertManageEQ(args, answer string) {
+	s.init()
+	s.steps = append(s.steps, step{cmd: Command(s.binary(), strings.Split(args, " ")...), kind: stepOutput, answer: answer})
+}
+
+// CertManageVar saves the last line of output from cert-manage into the
+// variable name, which Var expands.
+func (s *script) CertManageVar(args, name string) {
+	s.init()
+	s.steps = append(s.steps, step{cmd: Command(s.binary(), strings.Split(args, " ")...), kind: stepSave, answer: name})
+}
+
+// Var expands a variable saved by CertManageVar, plus n
+func (s *script) Var(name string, n int) string {
+	if s.platform == "windows" {
+		if n == 0 {
+			return "$" + name
+		}
+		return fmt.Sprintf("$([int]$%s+%d)", name, n)
+	}
+	if n == 0 {
+		return "$" + name
+	}
+	return fmt.Sprintf("$((%s+%d))", name, n)
+}
+
+// BackupsEQ checks how many backups of a store (e.g. linux or java) exist
+func (s *script) BackupsEQ(store, answer string) {
+	var raw string
+	switch s.platform {
+	case "windows":
+		raw = fmt.Sprintf(`(Get-ChildItem "$HOME\.cert-manage\%s").Count`, store)
+	case "darwin":
+		raw = fmt.Sprintf("ls -1 ~/Library/cert-manage/%s | wc -l", store)
+	default:
+		raw = fmt.Sprintf("ls -1 ~/.cert-manage/%s | wc -l", store)
+	}
+	s.steps = append(s.steps, step{raw: raw, kind: stepOutput, answer: answer})
+}
+
+// Fetch checks loading url exits with code, "0" when it should load
+func (s *script) Fetch(code, url string) {
+	curl := "curl"
+	if s.platform == "windows" {
+		curl = "curl.exe" // curl is an alias of Invoke-WebRequest in PowerShell
+	}
+	s.ExitCode(code, curl, "-s", "-I", url)
+}
+
+// render returns the script's file name and contents
+func (s *script) render() (string, string) {
+	if s.platform == "windows" {
+		return "script.ps1", s.renderPowerShell()
+	}
+	return "script.sh", s.renderShell()
+}
+
+func (s *script) renderShell() string {
+	lines := []string{"#!/bin/sh", "set +x", "set -e"}
+	for _, st := range s.steps {
+		line := st.raw
+		if st.cmd != nil {
+			line = fmt.Sprintf("%s %s", st.cmd.command, strings.Join(st.cmd.args, " "))
+		}
+		switch st.kind {
+		case stepRun:
+			lines = append(lines, line)
+		case stepAny:
+			lines = append(lines, "set +e", line, "set -e")
+		case stepExitCode:
+			lines = append(lines, "set +e", line, "code=$?", "set -e", "echo $code | grep "+st.answer)
+		case stepOutput:
+			lines = append(lines, line+" > /tmp/answer && "+fmt.Sprintf(`[ $(tail -1 /tmp/answer) -eq "%s" ]`, st.answer))
+		case stepSave:
+			lines = append(lines, fmt.Sprintf("%s=$(%s | tail -1)", st.answer, line))
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// renderPowerShell writes each step followed by a check of its exit code,
+// as PowerShell doesn't stop when a native command fails.
+func (s *script) renderPowerShell() string {
+	lines := []string{`$ErrorActionPreference = "Stop"`}
+	for _, st := range s.steps {
+		line := st.raw
+		if st.cmd != nil {
+			line = fmt.Sprintf("& %s %s", st.cmd.command, strings.Join(st.cmd.args, " "))
+		}
+		switch st.kind {
+		case stepRun:
+			lines = append(lines, line, "if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }")
+		case stepAny:
+			lines = append(lines, line)
+		case stepExitCode:
+			lines = append(lines, line, fmt.Sprintf("if ($LASTEXITCODE -ne %s) { exit 1 }", st.answer))
+		case stepOutput:
+			lines = append(lines, fmt.Sprintf("$answer = %s | Select-Object -Last 1", line), fmt.Sprintf(`if ("$answer".Trim() -ne "%s") { exit 1 }`, st.answer))
+		case stepSave:
+			lines = append(lines, fmt.Sprintf("$%s = %s | Select-Object -Last 1", st.answer, line))
+		}
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
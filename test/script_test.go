@@ -0,0 +1,74 @@
+// Copyright 2018 Adam Shannon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScript__shell(t *testing.T) {
+	s := &script{platform: "linux", root: "/"}
+	s.CertManageVar("list -count", "total")
+	s.CertManageEQ("list -count", s.Var("total", 1))
+	s.ExitCode("35", "curl", "-I", "https://www.yahoo.com/")
+	s.BackupsEQ("linux", "1")
+
+	name, out := s.render()
+	if name != "script.sh" {
+		t.Errorf("got %s", name)
+	}
+	lines := []string{
+		"chmod +x /bin/cert-manage",
+		"total=$(/bin/cert-manage list -count | tail -1)",
+		`/bin/cert-manage list -count > /tmp/answer && [ $(tail -1 /tmp/answer) -eq "$((total+1))" ]`,
+		"set +e\ncurl -I https://www.yahoo.com/\ncode=$?\nset -e\necho $code | grep 35",
+		`ls -1 ~/.cert-manage/linux | wc -l > /tmp/answer`,
+	}
+	for i := range lines {
+		if !strings.Contains(out, lines[i]) {
+			t.Errorf("missing %q in\n%s", lines[i], out)
+		}
+	}
+}
+
+func TestScript__powershell(t *testing.T) {
+	s := &script{platform: "windows", root: `C:\cert-manage`}
+	s.CertManage("whitelist", "-file", s.Path("whitelist.json"))
+	s.CertManageVar("list -count", "total")
+	s.CertManageEQ("list -count", s.Var("total", 1))
+	s.Fetch("35", "https://www.yahoo.com/")
+	s.BackupsEQ("windows", "1")
+
+	name, out := s.render()
+	if name != "script.ps1" {
+		t.Errorf("got %s", name)
+	}
+	lines := []string{
+		"& C:\\cert-manage\\cert-manage.exe whitelist -file C:\\cert-manage\\whitelist.json\r\nif ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }",
+		"$total = & C:\\cert-manage\\cert-manage.exe list -count | Select-Object -Last 1",
+		`if ("$answer".Trim() -ne "$([int]$total+1)") { exit 1 }`,
+		"& curl.exe -s -I https://www.yahoo.com/\r\nif ($LASTEXITCODE -ne 35) { exit 1 }",
+		`$answer = (Get-ChildItem "$HOME\.cert-manage\windows").Count | Select-Object -Last 1`,
+	}
+	for i := range lines {
+		if !strings.Contains(out, lines[i]) {
+			t.Errorf("missing %q in\n%s", lines[i], out)
+		}
+	}
+	if strings.Contains(out, "chmod") {
+		t.Error("unexpected chmod")
+	}
+}
@@ -20,55 +20,95 @@ import (
 	"testing"
 )
 
+// env is where a suite runs: a docker image (linux or windows) or a macOS
+// VM. Commands are collected and then ran together by SuccessT.
+type env interface {
+	CertManage(args ...string)
+	CertManageEQ(args, answer string)
+	CertManageVar(args, name string)
+	Var(name string, n int) string
+	BackupsEQ(store, answer string)
+	Fetch(code, url string)
+	Path(name string) string
+	SuccessT(t *testing.T)
+}
+
 type cfg struct {
+	// platform is the name of the platform's store, e.g. linux, darwin or windows
+	platform string
+
+	// total and after are the number of certificates before and after
+	// whitelisting, they're read from the store when blank (e.g. macOS
+	// releases ship different roots)
 	total, after string
+
+	// curlExitCode is how curl fails once our test site isn't trusted
 	curlExitCode string
 }
 
 func (c *cfg) failIfEmpty(t *testing.T) {
 	t.Helper()
 
-	if c.total == "" || c.after == "" {
-		t.Fatalf("total=%q or after=%q is blank", c.total, c.after)
+	if c.platform == "" {
+		t.Fatal("missing platform")
 	}
 	if c.curlExitCode == "" {
 		t.Fatal("missing curlExitCode")
 	}
 }
 
-func linuxSuite(t *testing.T, img *dockerfile, config cfg) {
+// platformSuite backs up, whitelists, restores and adds to the platform's
+// store in e.
+func platformSuite(t *testing.T, e env, config cfg) {
 	config.failIfEmpty(t)
 
 	if debug {
-		fmt.Println("Linux start")
+		fmt.Printf("%s start\n", config.platform)
+	}
+
+	total := config.total
+	if total == "" {
+		e.CertManageVar("list -count", "total")
+		total = e.Var("total", 0)
 	}
 
 	// List
-	img.CertManage("list", "-count", "|", "grep", config.total)
+	e.CertManageEQ("list -count", total)
 	// Backup
-	img.CertManage("backup")
-	img.RunSplit(fmt.Sprintf("ls -1 /usr/share/ca-certificates/* | wc -l | grep %s", config.total))
-	img.RunSplit("ls -1 ~/.cert-manage/linux | wc -l | grep 1")
+	e.CertManage("backup")
+	e.BackupsEQ(config.platform, "1")
 	// Whitelist
-	img.CertManage("whitelist", "-file", "/whitelist.json")
-	img.CertManage("list", "-count", "|", "grep", config.after)
+	e.CertManage("whitelist", "-file", e.Path("whitelist.json"))
+	if config.after != "" {
+		e.CertManageEQ("list -count", config.after)
+	}
 	// Verify our test domain fails to load
-	img.ExitCode(config.curlExitCode, "curl", "-I", "https://www.yahoo.com/")
+	e.Fetch(config.curlExitCode, "https://www.yahoo.com/")
 	// Restore
-	img.CertManage("restore")
+	e.CertManage("restore", "-y")
 	// Verify Restore
-	img.CertManage("list", "-count", "|", "grep", config.total)
-	img.Run("curl", "-I", "https://www.yahoo.com/")
+	e.CertManageEQ("list -count", total)
+	e.Fetch("0", "https://www.yahoo.com/")
 	// Add certificate
-	img.CertManage("add", "-file", "/localcert.pem")
-	img.CertManage("list", "-count", "|", "grep", incr(config.total))
-	img.SuccessT(t)
+	e.CertManage("add", "-file", e.Path("localcert.pem"))
+	if config.total != "" {
+		e.CertManageEQ("list -count", incr(config.total))
+	} else {
+		e.CertManageEQ("list -count", e.Var("total", 1))
+	}
+	e.SuccessT(t)
 
 	if debug {
-		fmt.Println("Linux end")
+		fmt.Printf("%s end\n", config.platform)
 	}
 }
 
+func linuxSuite(t *testing.T, img *dockerfile, config cfg) {
+	config.platform = "linux"
+	img.RunSplit(fmt.Sprintf("ls -1 /usr/share/ca-certificates/* | wc -l | grep %s", config.total))
+	platformSuite(t, img, config)
+}
+
 func javaSuite(t *testing.T, img *dockerfile, total, after string) {
 	if total == "" || after == "" {
 		t.Fatalf("total=%q or after=%q is blank", total, after)
@@ -91,7 +131,7 @@ func javaSuite(t *testing.T, img *dockerfile, total, after string) {
 	img.Run("cd", "/")
 	img.ShouldFail("java", "Download", "2>&1", "|", "grep", `'PKIX path building failed'`)
 	// Restore
-	img.CertManage("restore", "-app", "java")
+	img.CertManage("restore", "-app", "java", "-y")
 	img.CertManageEQ("list -app java -count", total)
 	// Verify Restore
 	img.RunSplit("cd / && java Download")